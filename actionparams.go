@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sort"
+)
+
+// ActionParam describes a parameter of an action in a flattened form,
+// suitable for generating command line flags or web forms, rather than
+// as the JSON-Schema held in ActionSpec.Params.
+type ActionParam struct {
+	// Name holds the name of the parameter. The properties of
+	// parameters that are objects are described as parameters
+	// of their own, named with the path of the property, as in
+	// "backup.target".
+	Name string
+
+	// Type holds the JSON-Schema type of the parameter, such as
+	// "string" or "integer", or the empty string if it is not
+	// specified or the parameter accepts several types.
+	Type string
+
+	// Description holds the description of the parameter, if any.
+	Description string
+
+	// Default holds the default value of the parameter, or nil
+	// if there is none.
+	Default interface{}
+
+	// Enum holds the values allowed for the parameter,
+	// or nil if the values are not restricted.
+	Enum []interface{}
+
+	// Required holds whether a value must be
+	// given for the parameter.
+	Required bool
+}
+
+// ActionNames returns the names of the actions,
+// in alphabetical order.
+func (a *Actions) ActionNames() []string {
+	names := make([]string, 0, len(a.ActionSpecs))
+	for name := range a.ActionSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActionParams returns the parameters of the named action, as
+// returned by ActionSpec.FlatParams. It returns an error with
+// code CodeInvalidActionName if there is no such action.
+func (a *Actions) ActionParams(name string) ([]ActionParam, error) {
+	spec, ok := a.ActionSpecs[name]
+	if !ok {
+		return nil, errorCodef(CodeInvalidActionName, "unknown action %q", name)
+	}
+	return spec.FlatParams(), nil
+}
+
+// FlatParams returns the parameters of the action, sorted by name.
+// Parameters that are objects with properties are replaced by their
+// properties; a property is required if it is required by its object
+// and the object is itself required.
+func (spec *ActionSpec) FlatParams() []ActionParam {
+	var params []ActionParam
+	flattenActionParams(&params, "", spec.Params, true)
+	sort.Sort(actionParamsByName(params))
+	return params
+}
+
+// flattenActionParams appends to params the properties of the
+// object described by the given JSON-Schema, prefixing their names
+// with prefix.
+func flattenActionParams(params *[]ActionParam, prefix string, schema map[string]interface{}, required bool) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	requiredNames := make(map[string]bool)
+	if names, ok := schema["required"].([]interface{}); ok {
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				requiredNames[name] = true
+			}
+		}
+	}
+	for name, prop := range properties {
+		propSchema, _ := prop.(map[string]interface{})
+		propRequired := required && requiredNames[name]
+		if _, ok := propSchema["properties"].(map[string]interface{}); ok {
+			flattenActionParams(params, prefix+name+".", propSchema, propRequired)
+			continue
+		}
+		param := ActionParam{
+			Name:     prefix + name,
+			Default:  propSchema["default"],
+			Required: propRequired,
+		}
+		param.Type, _ = propSchema["type"].(string)
+		param.Description, _ = propSchema["description"].(string)
+		param.Enum, _ = propSchema["enum"].([]interface{})
+		*params = append(*params, param)
+	}
+}
+
+type actionParamsByName []ActionParam
+
+func (params actionParamsByName) Len() int { return len(params) }
+func (params actionParamsByName) Swap(i, j int) {
+	params[i], params[j] = params[j], params[i]
+}
+func (params actionParamsByName) Less(i, j int) bool { return params[i].Name < params[j].Name }
@@ -0,0 +1,96 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ActionParamsSuite struct{}
+
+var _ = gc.Suite(&ActionParamsSuite{})
+
+const actionParamsYAML = `
+snapshot:
+    description: Take a snapshot of the database.
+    params:
+        outfile:
+            type: string
+            description: The file to write out to.
+            default: foo.bz2
+        compression:
+            type: object
+            properties:
+                kind:
+                    type: string
+                    enum: [gzip, bzip2, xz]
+                quality:
+                    type: integer
+                    default: 5
+            required: [kind]
+    required: [outfile, compression]
+backup:
+    params:
+        target:
+            description: Where to send the backup.
+        verbose:
+            type: boolean
+`
+
+func (s *ActionParamsSuite) readActions(c *gc.C) *charm.Actions {
+	actions, err := charm.ReadActionsYaml(strings.NewReader(actionParamsYAML))
+	c.Assert(err, jc.ErrorIsNil)
+	return actions
+}
+
+func (s *ActionParamsSuite) TestActionNames(c *gc.C) {
+	c.Assert(s.readActions(c).ActionNames(), jc.DeepEquals, []string{"backup", "snapshot"})
+}
+
+func (s *ActionParamsSuite) TestActionParams(c *gc.C) {
+	params, err := s.readActions(c).ActionParams("snapshot")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(params, jc.DeepEquals, []charm.ActionParam{{
+		Name:     "compression.kind",
+		Type:     "string",
+		Enum:     []interface{}{"gzip", "bzip2", "xz"},
+		Required: true,
+	}, {
+		Name:    "compression.quality",
+		Type:    "integer",
+		Default: 5,
+	}, {
+		Name:        "outfile",
+		Type:        "string",
+		Description: "The file to write out to.",
+		Default:     "foo.bz2",
+		Required:    true,
+	}})
+
+	params, err = s.readActions(c).ActionParams("backup")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(params, jc.DeepEquals, []charm.ActionParam{{
+		Name:        "target",
+		Description: "Where to send the backup.",
+	}, {
+		Name: "verbose",
+		Type: "boolean",
+	}})
+}
+
+func (s *ActionParamsSuite) TestActionParamsUnknownAction(c *gc.C) {
+	_, err := s.readActions(c).ActionParams("restore")
+	c.Assert(err, gc.ErrorMatches, `unknown action "restore"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidActionName)
+}
+
+func (s *ActionParamsSuite) TestFlatParamsNoParams(c *gc.C) {
+	spec := charm.ActionSpec{}
+	c.Assert(spec.FlatParams(), gc.HasLen, 0)
+}
@@ -6,11 +6,9 @@ package charm
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"regexp"
 	"strings"
 
-	"github.com/juju/errors"
 	gjs "github.com/juju/gojsonschema"
 	"gopkg.in/yaml.v1"
 )
@@ -23,6 +21,10 @@ var actionNameRule = regexp.MustCompile("^[a-z](?:[a-z-]*[a-z])?$")
 // may be added as metadata at a future time (e.g. version.)
 type Actions struct {
 	ActionSpecs map[string]ActionSpec `yaml:"actions,omitempty" bson:",omitempty"`
+
+	// Warnings holds any warnings found when reading
+	// the actions, such as parameters with no type.
+	Warnings []Warning `bson:"-" json:"-" yaml:"-"`
 }
 
 // Build this out further if it becomes necessary.
@@ -34,8 +36,8 @@ func NewActions() *Actions {
 // The Params map is expected to conform to JSON-Schema Draft 4 as defined at
 // http://json-schema.org/draft-04/schema# (see http://json-schema.org/latest/json-schema-core.html)
 type ActionSpec struct {
-	Description string
-	Params      map[string]interface{}
+	Description string                 `json:"description"`
+	Params      map[string]interface{} `json:"params"`
 }
 
 // ValidateParams validates the passed params map against the given ActionSpec
@@ -47,7 +49,7 @@ func (spec *ActionSpec) ValidateParams(params map[string]interface{}) error {
 	specLoader := gjs.NewGoLoader(spec.Params)
 	schema, err := gjs.NewSchema(specLoader)
 	if err != nil {
-		return err
+		return withCode(CodeInvalidActionParams, err)
 	}
 
 	// Load the params as a document to validate.
@@ -59,7 +61,7 @@ func (spec *ActionSpec) ValidateParams(params map[string]interface{}) error {
 	docLoader := gjs.NewGoLoader(p)
 	results, err := schema.Validate(docLoader)
 	if err != nil {
-		return err
+		return withCode(CodeInvalidActionParams, err)
 	}
 	if results.Valid() {
 		return nil
@@ -70,7 +72,7 @@ func (spec *ActionSpec) ValidateParams(params map[string]interface{}) error {
 	for _, validationError := range results.Errors() {
 		errorStrings = append(errorStrings, validationError.String())
 	}
-	return errors.Errorf("validation failed: %s", strings.Join(errorStrings, "; "))
+	return errorCodef(CodeInvalidActionParams, "validation failed: %s", strings.Join(errorStrings, "; "))
 }
 
 // InsertDefaults inserts the schema's default values in target using
@@ -91,7 +93,7 @@ func (spec *ActionSpec) InsertDefaults(target map[string]interface{}) (map[strin
 
 // ReadActions builds an Actions spec from a charm's actions.yaml.
 func ReadActionsYaml(r io.Reader) (*Actions, error) {
-	data, err := ioutil.ReadAll(r)
+	data, err := readDocument(r, ActionsFile, MaxDocumentSize)
 	if err != nil {
 		return nil, err
 	}
@@ -102,12 +104,12 @@ func ReadActionsYaml(r io.Reader) (*Actions, error) {
 
 	var unmarshaledActions map[string]map[string]interface{}
 	if err := yaml.Unmarshal(data, &unmarshaledActions); err != nil {
-		return nil, err
+		return nil, withCode(CodeInvalidActions, err)
 	}
 
 	for name, actionSpec := range unmarshaledActions {
 		if valid := actionNameRule.MatchString(name); !valid {
-			return nil, fmt.Errorf("bad action name %s", name)
+			return nil, errorCodef(CodeInvalidActionName, "bad action name %s", name)
 		}
 
 		desc := "No description"
@@ -124,7 +126,7 @@ func ReadActionsYaml(r io.Reader) (*Actions, error) {
 				// These fields must be strings.
 				typed, ok := value.(string)
 				if !ok {
-					return nil, errors.Errorf("value for schema key %q must be a string", key)
+					return nil, errorCodef(CodeInvalidActions, "value for schema key %q must be a string", key)
 				}
 				thisActionSchema[key] = typed
 				desc = typed
@@ -132,13 +134,13 @@ func ReadActionsYaml(r io.Reader) (*Actions, error) {
 				// These fields must be strings.
 				typed, ok := value.(string)
 				if !ok {
-					return nil, errors.Errorf("value for schema key %q must be a string", key)
+					return nil, errorCodef(CodeInvalidActions, "value for schema key %q must be a string", key)
 				}
 				thisActionSchema[key] = typed
 			case "required":
 				typed, ok := value.([]interface{})
 				if !ok {
-					return nil, errors.Errorf("value for schema key %q must be a YAML list", key)
+					return nil, errorCodef(CodeInvalidActions, "value for schema key %q must be a YAML list", key)
 				}
 				thisActionSchema[key] = typed
 			case "params":
@@ -146,20 +148,21 @@ func ReadActionsYaml(r io.Reader) (*Actions, error) {
 				// cause problems with BSON serialization later.
 				cleansedParams, err := cleanse(value)
 				if err != nil {
-					return nil, err
+					return nil, withCode(CodeInvalidActions, err)
 				}
 
 				// JSON-Schema must be a map
 				typed, ok := cleansedParams.(map[string]interface{})
 				if !ok {
-					return nil, errors.New("params failed to parse as a map")
+					return nil, errorCodef(CodeInvalidActions, "params failed to parse as a map")
 				}
 				thisActionSchema["properties"] = typed
+				result.Warnings = append(result.Warnings, actionParamWarnings(name, typed)...)
 			default:
 				// In case this has nested maps, we must clean them out.
 				typed, err := cleanse(value)
 				if err != nil {
-					return nil, err
+					return nil, withCode(CodeInvalidActions, err)
 				}
 				thisActionSchema[key] = typed
 			}
@@ -170,7 +173,7 @@ func ReadActionsYaml(r io.Reader) (*Actions, error) {
 		schemaLoader := gjs.NewGoLoader(thisActionSchema)
 		_, err := gjs.NewSchema(schemaLoader)
 		if err != nil {
-			return nil, errors.Annotatef(err, "invalid params schema for action schema %s", name)
+			return nil, annotateCodef(CodeInvalidActions, err, "invalid params schema for action schema %s: %v", name, err)
 		}
 
 		// Now assign the resulting schema to the final entry for the result.
@@ -179,9 +182,37 @@ func ReadActionsYaml(r io.Reader) (*Actions, error) {
 			Params:      thisActionSchema,
 		}
 	}
+	sortWarnings(result.Warnings)
 	return result, nil
 }
 
+// actionParamWarnings returns the warnings for the parameters
+// of the named action.
+func actionParamWarnings(action string, params map[string]interface{}) []Warning {
+	var warnings []Warning
+	for name, param := range params {
+		spec, ok := param.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if !hasParamType(spec) {
+			warnings = append(warnings, warningf(CodeImplicitSchema, "action %q parameter %q has no type; any value is accepted", action, name))
+		}
+	}
+	return warnings
+}
+
+// hasParamType reports whether the given parameter schema
+// constrains the type of the parameter's value.
+func hasParamType(spec map[string]interface{}) bool {
+	for _, key := range []string{"type", "enum", "oneOf", "anyOf", "allOf"} {
+		if _, ok := spec[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // cleanse rejects schemas containing references or maps keyed with non-
 // strings, and coerces acceptable maps to contain only maps with string keys.
 func cleanse(input interface{}) (interface{}, error) {
@@ -210,7 +241,7 @@ func cleanse(input interface{}) (interface{}, error) {
 		for key, value := range typedInput {
 			typedKey, ok := key.(string)
 			if !ok {
-				return nil, errors.New("map keyed with non-string value")
+				return nil, errorCodef(CodeInvalidActions, "map keyed with non-string value")
 			}
 			newMap[typedKey] = value
 		}
@@ -222,7 +253,7 @@ func cleanse(input interface{}) (interface{}, error) {
 		for _, sliceValue := range typedInput {
 			newSliceValue, err := cleanse(sliceValue)
 			if err != nil {
-				return nil, errors.New("map keyed with non-string value")
+				return nil, errorCodef(CodeInvalidActions, "map keyed with non-string value")
 			}
 			newSlice = append(newSlice, newSliceValue)
 		}
@@ -302,6 +302,7 @@ func (s *ActionsSuite) TestCleanseFail(c *gc.C) {
 		_, err := cleanse(test.failInterface)
 		c.Assert(err, gc.NotNil)
 		c.Assert(err.Error(), gc.Equals, test.expectedError)
+		c.Assert(ErrorCode(err), gc.Equals, CodeInvalidActions)
 	}
 }
 
@@ -321,7 +322,7 @@ snapshot:
          type: string
    required: ["outfile"]
 `,
-		expectedActions: &Actions{map[string]ActionSpec{
+		expectedActions: &Actions{ActionSpecs: map[string]ActionSpec{
 			"snapshot": ActionSpec{
 				Description: "Take a snapshot of the database.",
 				Params: map[string]interface{}{
@@ -371,7 +372,7 @@ remote-sync:
          enum: ["rsync", "scp"]
    required: ["file", "remote-uri"]
 `,
-		expectedActions: &Actions{map[string]ActionSpec{
+		expectedActions: &Actions{ActionSpecs: map[string]ActionSpec{
 			"snapshot": ActionSpec{
 				Description: "Take a snapshot of the database.",
 				Params: map[string]interface{}{
@@ -427,7 +428,7 @@ snapshot:
       diskdevice: {}
       something-else: {}
 `,
-		expectedActions: &Actions{map[string]ActionSpec{
+		expectedActions: &Actions{ActionSpecs: map[string]ActionSpec{
 			"snapshot": ActionSpec{
 				Description: "Take a snapshot of the database.",
 				Params: map[string]interface{}{
@@ -461,7 +462,7 @@ snapshot:
    description: Take a snapshot of the database.
 `,
 
-		expectedActions: &Actions{map[string]ActionSpec{
+		expectedActions: &Actions{ActionSpecs: map[string]ActionSpec{
 			"snapshot": ActionSpec{
 				Description: "Take a snapshot of the database.",
 				Params: map[string]interface{}{
@@ -476,7 +477,7 @@ snapshot:
 snapshot:
 `,
 
-		expectedActions: &Actions{map[string]ActionSpec{
+		expectedActions: &Actions{ActionSpecs: map[string]ActionSpec{
 			"snapshot": ActionSpec{
 				Description: "No description",
 				Params: map[string]interface{}{
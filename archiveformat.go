@@ -0,0 +1,493 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveFormat identifies the format of a file that is expected to
+// hold a charm or bundle archive.
+type ArchiveFormat int
+
+const (
+	// ArchiveUnknown identifies files of an unrecognized format.
+	ArchiveUnknown ArchiveFormat = iota
+
+	// ArchiveZip identifies zip files, the format
+	// of charm and bundle archives.
+	ArchiveZip
+
+	// ArchiveNestedZip identifies zip files that hold nothing but
+	// another zip file, as produced by tools that zip charm
+	// archives a second time.
+	ArchiveNestedZip
+
+	// ArchiveTar identifies uncompressed tar files.
+	ArchiveTar
+
+	// ArchiveTarGzip identifies tar files compressed with gzip.
+	ArchiveTarGzip
+)
+
+// String returns a description of f.
+func (f ArchiveFormat) String() string {
+	switch f {
+	case ArchiveZip:
+		return "zip archive"
+	case ArchiveNestedZip:
+		return "nested zip archive"
+	case ArchiveTar:
+		return "tar archive"
+	case ArchiveTarGzip:
+		return "gzipped tar archive"
+	}
+	return "unknown format"
+}
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte("\x1f\x8b")
+)
+
+// tarMagicOffset holds the offset of the magic
+// string in the header of a tar file.
+const tarMagicOffset = 257
+
+// SniffArchiveFormat returns the format of the file whose contents are
+// read from r, judging by the first few hundred bytes. It cannot tell
+// ArchiveNestedZip from ArchiveZip, as that requires access to the
+// whole file.
+func SniffArchiveFormat(r io.Reader) (ArchiveFormat, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(tarMagicOffset + 8)
+	if err != nil && err != io.EOF {
+		return ArchiveUnknown, err
+	}
+	switch {
+	case bytes.HasPrefix(head, zipMagic), bytes.HasPrefix(head, emptyZipMagic):
+		return ArchiveZip, nil
+	case isTarHeader(head):
+		return ArchiveTar, nil
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return ArchiveUnknown, nil
+		}
+		defer zr.Close()
+		head := make([]byte, tarMagicOffset+8)
+		n, _ := io.ReadFull(zr, head)
+		if isTarHeader(head[:n]) {
+			return ArchiveTarGzip, nil
+		}
+	}
+	return ArchiveUnknown, nil
+}
+
+// isTarHeader reports whether head starts with the header of a tar
+// file in the POSIX or GNU formats.
+func isTarHeader(head []byte) bool {
+	return len(head) >= tarMagicOffset+5 && string(head[tarMagicOffset:tarMagicOffset+5]) == "ustar"
+}
+
+// ArchiveFormatError is returned when reading a charm or bundle
+// archive from a file that is not a zip file, or that holds another
+// zip file instead of the charm or bundle.
+type ArchiveFormatError struct {
+	// Path holds the path of the file, or the empty
+	// string if it was not read from a file.
+	Path string
+
+	// Format holds the format of the file.
+	Format ArchiveFormat
+
+	// Inner holds the name of the zip file held by
+	// the file when Format is ArchiveNestedZip.
+	Inner string
+}
+
+func (err *ArchiveFormatError) Error() string {
+	what := "archive"
+	if err.Path != "" {
+		what = fmt.Sprintf("%q", err.Path)
+	}
+	switch err.Format {
+	case ArchiveNestedZip:
+		return fmt.Sprintf("cannot read %s: zip file holds only the zip file %q; it appears to have been zipped twice", what, err.Inner)
+	case ArchiveTar, ArchiveTarGzip:
+		msg := fmt.Sprintf("cannot read %s: file is a %s, not a zip archive", what, err.Format)
+		if ext := strings.ToLower(filepath.Ext(err.Path)); ext == ".charm" || ext == ".zip" {
+			msg += fmt.Sprintf(", despite its %q extension", ext)
+		}
+		return msg
+	}
+	return fmt.Sprintf("cannot read %s: not a zip archive", what)
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (err *ArchiveFormatError) ErrorCode() string {
+	return CodeInvalidArchive
+}
+
+// archiveOpenError returns the error to return when zopen fails to
+// open its zip file with the given error. If the file is not a zip
+// file, the returned error is an *ArchiveFormatError describing the
+// format of the file.
+func archiveOpenError(zopen zipOpener, err error) error {
+	if err != zip.ErrFormat {
+		return err
+	}
+	r, rerr := zopen.openReader()
+	if rerr != nil {
+		return err
+	}
+	defer r.Close()
+	format, serr := SniffArchiveFormat(r)
+	if serr != nil || format == ArchiveZip {
+		return err
+	}
+	return &ArchiveFormatError{Format: format}
+}
+
+// nestedArchiveError returns an *ArchiveFormatError if zipr holds a
+// single file, which is itself a zip file, or nil otherwise. It is
+// used to explain why the metadata of a charm or bundle cannot be
+// found in an archive.
+func nestedArchiveError(zipr *zipReadCloser) error {
+	var inner *zip.File
+	for _, fh := range zipr.File {
+		if fh.Mode().IsDir() {
+			continue
+		}
+		if inner != nil {
+			return nil
+		}
+		inner = fh
+	}
+	if inner == nil {
+		return nil
+	}
+	r, err := inner.Open()
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	if format, _ := SniffArchiveFormat(r); format != ArchiveZip {
+		return nil
+	}
+	return &ArchiveFormatError{
+		Format: ArchiveNestedZip,
+		Inner:  inner.Name,
+	}
+}
+
+// setArchiveErrorPath sets the path of err
+// if it is an *ArchiveFormatError.
+func setArchiveErrorPath(err error, path string) {
+	if err, ok := err.(*ArchiveFormatError); ok {
+		err.Path = path
+	}
+}
+
+// ReadArchiveOptions holds options for ReadCharmArchiveWithOptions
+// and ReadBundleArchiveWithOptions.
+type ReadArchiveOptions struct {
+	// AllowTar specifies that tar files, compressed with gzip or
+	// not, are accepted in place of zip files.
+	AllowTar bool
+
+	// AllowNestedZip specifies that zip files holding nothing
+	// but the zip file of the archive are accepted.
+	AllowNestedZip bool
+
+	// MaxSize holds the maximum total size in bytes of the files
+	// read from a file that must be converted, beyond which a
+	// *SizeLimitError is returned. If it is zero,
+	// DefaultMaxConvertedSize is used.
+	MaxSize int64
+
+	// Meta holds the options used to read the charm metadata.
+	// It is ignored for bundles.
+	Meta ReadMetaOptions
+}
+
+// DefaultMaxConvertedSize holds the default limit on the total size
+// of the files read from an archive that is converted in memory.
+const DefaultMaxConvertedSize = 256 * 1024 * 1024
+
+func (opts ReadArchiveOptions) maxSize() int64 {
+	if opts.MaxSize > 0 {
+		return opts.MaxSize
+	}
+	return DefaultMaxConvertedSize
+}
+
+// ReadCharmArchiveWithOptions is like ReadCharmArchive, but it reads
+// the charm metadata with opts.Meta, and it can transparently read
+// charms from files in the formats allowed by opts. Such files are
+// converted to zip files in memory, from which the returned archive
+// reads the charm, so they must fit in memory.
+func ReadCharmArchiveWithOptions(path string, opts ReadArchiveOptions) (*CharmArchive, error) {
+	a, err := readCharmArchiveFile(path, opts.Meta)
+	if err == nil {
+		return a, nil
+	}
+	data, err := convertArchive(path, err, opts)
+	if err != nil {
+		return nil, err
+	}
+	a, err = readCharmArchive(newZipOpenerFromReader(bytes.NewReader(data), int64(len(data))), opts.Meta)
+	if err != nil {
+		return nil, err
+	}
+	a.Path = path
+	return a, nil
+}
+
+// ReadBundleArchiveWithOptions is like ReadBundleArchive, but it can
+// transparently read bundles from files in the formats allowed by
+// opts. Such files are converted to zip files in memory, from which
+// the returned archive reads the bundle, so they must fit in memory.
+func ReadBundleArchiveWithOptions(path string, opts ReadArchiveOptions) (*BundleArchive, error) {
+	a, err := ReadBundleArchive(path)
+	if err == nil {
+		return a, nil
+	}
+	data, err := convertArchive(path, err, opts)
+	if err != nil {
+		return nil, err
+	}
+	a, err = ReadBundleArchiveBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	a.Path = path
+	return a, nil
+}
+
+// convertArchive returns the contents of the zip file held in the
+// file at path, which could not be read as an archive because of
+// readErr. It returns readErr if the format of the file is not
+// allowed by opts.
+func convertArchive(path string, readErr error, opts ReadArchiveOptions) ([]byte, error) {
+	ferr, ok := readErr.(*ArchiveFormatError)
+	if !ok {
+		return nil, readErr
+	}
+	limit := opts.maxSize()
+	switch {
+	case ferr.Format == ArchiveNestedZip && opts.AllowNestedZip:
+		zipr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer zipr.Close()
+		for _, fh := range zipr.File {
+			if fh.Name != ferr.Inner {
+				continue
+			}
+			r, err := fh.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(data)) > limit {
+				return nil, &SizeLimitError{
+					Size:  int64(len(data)),
+					Limit: limit,
+				}
+			}
+			return data, nil
+		}
+		return nil, readErr
+	case (ferr.Format == ArchiveTar || ferr.Format == ArchiveTarGzip) && opts.AllowTar:
+		open := func() (io.ReadCloser, error) {
+			return openTar(path, ferr.Format)
+		}
+		prefix, err := tarWrapperDir(open)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %v", path, err)
+		}
+		r, err := open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		var buf bytes.Buffer
+		if err := tarToZip(&buf, r, prefix, limit); err != nil {
+			if _, ok := err.(*SizeLimitError); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("cannot read %q: %v", path, err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, readErr
+}
+
+// openTar opens the tar file at path, which
+// has the given format, for reading.
+func openTar(path string, format ArchiveFormat) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if format != ArchiveTarGzip {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, f: f}, nil
+}
+
+// gzipFile reads a file compressed with gzip.
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+// Close implements io.Closer.Close.
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.f.Close()
+}
+
+// tarWrapperDir returns the directory holding all the entries of the
+// tar file opened by open, followed by a slash, or the empty string
+// if there is no such directory. Charms and bundles are often made
+// into tar files from their parent directory, which then wraps all
+// their files.
+func tarWrapperDir(open func() (io.ReadCloser, error)) (string, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	dir := ""
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if th.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(th.Name, "./"))
+		if name == "." {
+			continue
+		}
+		first := strings.SplitN(name, "/", 2)[0]
+		if name == first && th.Typeflag != tar.TypeDir {
+			// A file at the top level.
+			return "", nil
+		}
+		if dir != "" && first != dir {
+			return "", nil
+		}
+		dir = first
+	}
+	if dir == "" {
+		return "", nil
+	}
+	return dir + "/", nil
+}
+
+// tarToZip writes the directories, regular files and symbolic links
+// held in the tar file read from r to w as a zip file, leaving out
+// the given prefix from their names. It returns a *SizeLimitError
+// if the total size of the files exceeds limit bytes.
+func tarToZip(w io.Writer, r io.Reader, prefix string, limit int64) (err error) {
+	zipw := zip.NewWriter(w)
+	defer func() {
+		if closeErr := zipw.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	tr := tar.NewReader(r)
+	var size int64
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if th.Typeflag == tar.TypeXGlobalHeader {
+			// Global pax headers, such as those written
+			// by git archive, hold no file.
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(th.Name, "./"))
+		if prefix != "" {
+			if name+"/" == prefix {
+				continue
+			}
+			name = strings.TrimPrefix(name, prefix)
+		}
+		if name == "." {
+			continue
+		}
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return fmt.Errorf("tar file holds invalid path %q", th.Name)
+		}
+		h := &zip.FileHeader{
+			Name:   name,
+			Method: zip.Deflate,
+		}
+		h.SetMode(th.FileInfo().Mode())
+		var data io.Reader
+		switch th.Typeflag {
+		case tar.TypeDir:
+			h.Name += "/"
+			h.Method = zip.Store
+		case tar.TypeReg, tar.TypeRegA:
+			size += th.Size
+			if size > limit {
+				return &SizeLimitError{
+					Size:  size,
+					Limit: limit,
+				}
+			}
+			data = tr
+		case tar.TypeSymlink:
+			h.Method = zip.Store
+			data = strings.NewReader(th.Linkname)
+		default:
+			return fmt.Errorf("tar file holds %q, which is not a regular file, directory or symbolic link", th.Name)
+		}
+		fw, err := zipw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			if _, err := io.Copy(fw, data); err != nil {
+				return err
+			}
+		}
+	}
+}
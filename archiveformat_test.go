@@ -0,0 +1,249 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ArchiveFormatSuite struct{}
+
+var _ = gc.Suite(&ArchiveFormatSuite{})
+
+// tarCharmDir writes the files of the named test charm to
+// a tar file at path, compressing it with gzip if compress is true.
+func tarCharmDir(c *gc.C, name, path string, compress bool) {
+	tarCharmDirAs(c, name, path, ".", compress)
+}
+
+// tarCharmDirAs is like tarCharmDir, but the files are held in
+// the given directory, after a global header as written by
+// git archive unless dir is ".".
+func tarCharmDirAs(c *gc.C, name, path, dir string, compress bool) {
+	f, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	var w io.Writer = f
+	if compress {
+		zw := gzip.NewWriter(f)
+		defer zw.Close()
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	if dir != "." {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			Name:       "pax_global_header",
+			PAXRecords: map[string]string{"comment": "0123456789abcdef"},
+		})
+		c.Assert(err, gc.IsNil)
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir + "/",
+			Mode:     0755,
+		})
+		c.Assert(err, gc.IsNil)
+	}
+	root := TestCharms.CharmDirPath(name)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		h, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		h.Name = "./" + filepath.ToSlash(filepath.Join(dir, rel))
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(data)
+			return err
+		}
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+}
+
+// nestCharmArchive writes a zip file holding only the
+// archive of the named test charm to path.
+func nestCharmArchive(c *gc.C, name, path string) {
+	data, err := ioutil.ReadFile(TestCharms.CharmArchivePath(c.MkDir(), name))
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	w, err := zipw.Create(name + ".charm")
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(zipw.Close(), gc.IsNil)
+	err = ioutil.WriteFile(path, buf.Bytes(), 0644)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ArchiveFormatSuite) TestSniffArchiveFormat(c *gc.C) {
+	dir := c.MkDir()
+	tarPath := filepath.Join(dir, "dummy.tar")
+	tarCharmDir(c, "dummy", tarPath, false)
+	tgzPath := filepath.Join(dir, "dummy.tar.gz")
+	tarCharmDir(c, "dummy", tgzPath, true)
+	for i, test := range []struct {
+		path   string
+		expect charm.ArchiveFormat
+	}{{
+		path:   TestCharms.CharmArchivePath(dir, "dummy"),
+		expect: charm.ArchiveZip,
+	}, {
+		path:   tarPath,
+		expect: charm.ArchiveTar,
+	}, {
+		path:   tgzPath,
+		expect: charm.ArchiveTarGzip,
+	}, {
+		path:   filepath.Join(TestCharms.CharmDirPath("dummy"), "metadata.yaml"),
+		expect: charm.ArchiveUnknown,
+	}} {
+		c.Logf("test %d: %s", i, test.path)
+		f, err := os.Open(test.path)
+		c.Assert(err, gc.IsNil)
+		format, err := charm.SniffArchiveFormat(f)
+		f.Close()
+		c.Assert(err, gc.IsNil)
+		c.Assert(format, gc.Equals, test.expect)
+	}
+}
+
+func (s *ArchiveFormatSuite) TestReadCharmArchiveTarGzip(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "dummy.charm")
+	tarCharmDir(c, "dummy", path, true)
+	_, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.ErrorMatches, `cannot read ".*dummy.charm": file is a gzipped tar archive, not a zip archive, despite its ".charm" extension`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidArchive)
+	c.Assert(err.(*charm.ArchiveFormatError).Format, gc.Equals, charm.ArchiveTarGzip)
+
+	_, err = charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{AllowNestedZip: true})
+	c.Assert(err, gc.FitsTypeOf, (*charm.ArchiveFormatError)(nil))
+
+	archive, err := charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{AllowTar: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Path, gc.Equals, path)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	c.Assert(archive.Revision(), gc.Equals, 1)
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.Contains("hooks/install"), gc.Equals, true)
+}
+
+func (s *ArchiveFormatSuite) TestReadCharmArchiveTar(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "dummy.tar")
+	tarCharmDir(c, "dummy", path, false)
+	_, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.ErrorMatches, `cannot read ".*dummy.tar": file is a tar archive, not a zip archive`)
+
+	archive, err := charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{AllowTar: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+}
+
+func (s *ArchiveFormatSuite) TestReadCharmArchiveGitArchive(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "dummy.tar.gz")
+	tarCharmDirAs(c, "dummy", path, "dummy-1.0", true)
+	archive, err := charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{AllowTar: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.Contains("hooks/install"), gc.Equals, true)
+	c.Assert(manifest.Contains("dummy-1.0"), gc.Equals, false)
+}
+
+func (s *ArchiveFormatSuite) TestReadCharmArchiveSizeLimit(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "dummy.tar")
+	tarCharmDir(c, "dummy", path, false)
+	_, err := charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{
+		AllowTar: true,
+		MaxSize:  10,
+	})
+	c.Assert(err, gc.FitsTypeOf, (*charm.SizeLimitError)(nil))
+	c.Assert(err.(*charm.SizeLimitError).Limit, gc.Equals, int64(10))
+
+	path = filepath.Join(c.MkDir(), "dummy.zip")
+	nestCharmArchive(c, "dummy", path)
+	_, err = charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{
+		AllowNestedZip: true,
+		MaxSize:        10,
+	})
+	c.Assert(err, gc.ErrorMatches, `charm contents size 11 exceeds limit 10`)
+}
+
+func (s *ArchiveFormatSuite) TestReadCharmArchiveNestedZip(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "dummy.zip")
+	nestCharmArchive(c, "dummy", path)
+	_, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.ErrorMatches, `cannot read ".*dummy.zip": zip file holds only the zip file "dummy.charm"; it appears to have been zipped twice`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidArchive)
+
+	archive, err := charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{AllowNestedZip: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Path, gc.Equals, path)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+}
+
+func (s *ArchiveFormatSuite) TestReadCharmArchiveUnknownFormat(c *gc.C) {
+	_, err := charm.ReadCharmArchiveBytes([]byte(strings.Repeat("not a charm\n", 100)))
+	c.Assert(err, gc.ErrorMatches, `cannot read archive: not a zip archive`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidArchive)
+}
+
+func (s *ArchiveFormatSuite) TestReadBundleArchiveTarGzip(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "bundle.tgz")
+	f, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	data, err := ioutil.ReadFile(filepath.Join(TestCharms.BundleDirPath("wordpress-simple"), "bundle.yaml"))
+	c.Assert(err, gc.IsNil)
+	err = tw.WriteHeader(&tar.Header{Name: "bundle.yaml", Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+	c.Assert(err, gc.IsNil)
+	_, err = tw.Write(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(tw.Close(), gc.IsNil)
+	c.Assert(zw.Close(), gc.IsNil)
+	c.Assert(f.Close(), gc.IsNil)
+
+	_, err = charm.ReadBundleArchive(path)
+	c.Assert(err, gc.ErrorMatches, `cannot read ".*bundle.tgz": file is a gzipped tar archive, not a zip archive`)
+
+	archive, err := charm.ReadBundleArchiveWithOptions(path, charm.ReadArchiveOptions{AllowTar: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Data().Services, gc.HasLen, 2)
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// ArchiveFromFS writes the contents of fsys to w as a charm or bundle
+// archive, so that charms and bundles generated in memory need not
+// be written to a directory before being archived. The files are
+// archived as CharmDir.ArchiveTo archives those of a directory:
+// top-level hidden files and the build directory are skipped, file
+// modes are checked against DefaultFileModePolicy and the hooks
+// named in any metadata.yaml file are made executable. Unlike
+// CharmDir.ArchiveTo, it archives any revision file as it is.
+//
+// Symbolic links may only be archived if fsys implements
+// fs.ReadLinkFS.
+func ArchiveFromFS(fsys fs.FS, w io.Writer) (err error) {
+	var hooks map[string]bool
+	if data, err := fs.ReadFile(fsys, MetadataFile); err == nil {
+		meta, err := ReadMeta(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		hooks = meta.Hooks()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	zipw := zip.NewWriter(w)
+	defer func() {
+		if closeErr := zipw.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		hidden := name[0] == '.'
+		if d.IsDir() && (hidden || name == "build") {
+			return fs.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		if err := checkFileType(name, mode); err != nil {
+			return err
+		}
+		if hidden {
+			return nil
+		}
+		if err := DefaultFileModePolicy.Check(name, mode); err != nil {
+			return err
+		}
+		return archiveFSFile(zipw, fsys, name, mode, hooks)
+	})
+}
+
+// archiveFSFile adds the named file of fsys, which has
+// the given mode, to the archive written by zipw.
+func archiveFSFile(zipw *zip.Writer, fsys fs.FS, name string, mode os.FileMode, hooks map[string]bool) error {
+	h := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	if mode.IsDir() || mode&os.ModeSymlink != 0 {
+		h.Method = zip.Store
+	}
+	if mode.IsDir() {
+		h.Name += "/"
+	}
+	archiveMode, madeExecutable := archivedMode(name, mode, hooks, DefaultFileModePolicy)
+	if madeExecutable {
+		logger.Warningf("making %q executable in charm", name)
+	}
+	h.SetMode(archiveMode)
+	var target string
+	if mode&os.ModeSymlink != 0 {
+		linkFS, ok := fsys.(fs.ReadLinkFS)
+		if !ok {
+			return fmt.Errorf("cannot archive symlink %q: file system does not support symlinks", name)
+		}
+		var err error
+		target, err = linkFS.ReadLink(name)
+		if err != nil {
+			return err
+		}
+		if err := checkSymlinkTarget("", name, target); err != nil {
+			return err
+		}
+	}
+	fw, err := zipw.CreateHeader(h)
+	if err != nil || mode.IsDir() {
+		return err
+	}
+	if mode&os.ModeSymlink != 0 {
+		_, err = io.WriteString(fw, target)
+		return err
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(fw, f)
+	return err
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"testing/fstest"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ArchiveFromFSSuite struct{}
+
+var _ = gc.Suite(&ArchiveFromFSSuite{})
+
+func (s *ArchiveFromFSSuite) TestArchiveFromFS(c *gc.C) {
+	fsys := fstest.MapFS{
+		"metadata.yaml":  {Data: []byte(dummyMetadata), Mode: 0644},
+		"revision":       {Data: []byte("7"), Mode: 0644},
+		"hooks/install":  {Data: []byte("#!/bin/sh\n"), Mode: 0644},
+		"hooks/start":    {Data: []byte("install"), Mode: fs.ModeSymlink | 0777},
+		"hooks/lib.sh":   {Data: []byte("true\n"), Mode: 0644},
+		"bin/run":        {Data: []byte("#!/bin/sh\n"), Mode: 0755},
+		".hidden":        {Data: []byte("hidden"), Mode: 0644},
+		"build/artifact": {Data: []byte("built"), Mode: 0644},
+	}
+	var buf bytes.Buffer
+	err := charm.ArchiveFromFS(fsys, &buf)
+	c.Assert(err, jc.ErrorIsNil)
+
+	zipr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, jc.ErrorIsNil)
+	modes := make(map[string]os.FileMode)
+	contents := make(map[string]string)
+	for _, f := range zipr.File {
+		modes[f.Name] = f.Mode()
+		if f.Mode().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		c.Assert(err, jc.ErrorIsNil)
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		c.Assert(err, jc.ErrorIsNil)
+		contents[f.Name] = string(data)
+	}
+	c.Assert(modes, jc.DeepEquals, map[string]os.FileMode{
+		"bin/":          os.ModeDir | 0755,
+		"bin/run":       0755,
+		"hooks/":        os.ModeDir | 0755,
+		"hooks/install": 0744,
+		"hooks/lib.sh":  0644,
+		"hooks/start":   os.ModeSymlink | 0777,
+		"metadata.yaml": 0644,
+		"revision":      0644,
+	})
+	c.Assert(contents["hooks/start"], gc.Equals, "install")
+	c.Assert(contents["revision"], gc.Equals, "7")
+
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "a")
+	c.Assert(archive.Revision(), gc.Equals, 7)
+}
+
+func (s *ArchiveFromFSSuite) TestArchiveFromFSBundle(c *gc.C) {
+	bundleFS := os.DirFS(TestCharms.BundleDirPath("wordpress-simple"))
+	var buf bytes.Buffer
+	err := charm.ArchiveFromFS(bundleFS, &buf)
+	c.Assert(err, jc.ErrorIsNil)
+
+	archive, err := charm.ReadBundleArchiveBytes(buf.Bytes())
+	c.Assert(err, jc.ErrorIsNil)
+	dir, err := charm.ReadBundleDir(TestCharms.BundleDirPath("wordpress-simple"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(archive.Data(), jc.DeepEquals, dir.Data())
+	c.Assert(archive.ReadMe(), gc.Equals, dir.ReadMe())
+}
+
+var archiveFromFSErrorTests = []struct {
+	about       string
+	fsys        fstest.MapFS
+	expectError string
+}{{
+	about: "invalid metadata",
+	fsys: fstest.MapFS{
+		"metadata.yaml": {Data: []byte("name: a"), Mode: 0644},
+	},
+	expectError: `metadata: summary: expected string, got nothing`,
+}, {
+	about: "setuid file",
+	fsys: fstest.MapFS{
+		"metadata.yaml": {Data: []byte(dummyMetadata), Mode: 0644},
+		"data":          {Data: []byte("data"), Mode: fs.ModeSetuid | 0755},
+	},
+	expectError: `file "data" is setuid`,
+}, {
+	about: "symlink out of charm",
+	fsys: fstest.MapFS{
+		"metadata.yaml": {Data: []byte(dummyMetadata), Mode: 0644},
+		"hooks/install": {Data: []byte("../../install"), Mode: fs.ModeSymlink | 0777},
+	},
+	expectError: `symlink "hooks/install" links out of charm: "../../install"`,
+}}
+
+func (s *ArchiveFromFSSuite) TestArchiveFromFSErrors(c *gc.C) {
+	for i, test := range archiveFromFSErrorTests {
+		c.Logf("test %d: %s", i, test.about)
+		err := charm.ArchiveFromFS(test.fsys, ioutil.Discard)
+		c.Assert(err, gc.ErrorMatches, test.expectError)
+	}
+}
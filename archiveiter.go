@@ -0,0 +1,129 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ArchiveIter iterates over the entries of a charm archive,
+// reading their contents only when asked to. It is used like this:
+//
+//	iter, err := archive.Iter()
+//	if err != nil {
+//		...
+//	}
+//	defer iter.Close()
+//	for iter.Next() {
+//		r, err := iter.Open()
+//		...
+//	}
+//	if err := iter.Err(); err != nil {
+//		...
+//	}
+type ArchiveIter struct {
+	zipr  *zipReadCloser
+	index int
+	file  *zip.File
+	rc    io.ReadCloser
+	err   error
+}
+
+// Iter returns an iterator over the entries of the archive, in the
+// order they are stored. This allows the whole contents of a charm to
+// be scanned in a single pass without expanding it. The iterator must
+// be closed after use.
+func (a *CharmArchive) Iter() (*ArchiveIter, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveIter{
+		zipr:  zipr,
+		index: -1,
+	}, nil
+}
+
+// Next advances the iterator to the next entry, and reports
+// whether there is one. Any reader returned by Open for
+// the previous entry is closed.
+func (it *ArchiveIter) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.err = it.closeEntry(); it.err != nil {
+		return false
+	}
+	for {
+		it.index++
+		if it.index >= len(it.zipr.File) {
+			it.file = nil
+			return false
+		}
+		it.file = it.zipr.File[it.index]
+		// Some archivers store an entry for the root directory.
+		if p := it.Path(); p != "." && !strings.HasPrefix(p, "../") {
+			return true
+		}
+	}
+}
+
+// Path returns the clean slash-separated path of
+// the current entry, relative to the root of the charm.
+func (it *ArchiveIter) Path() string {
+	return path.Clean(strings.TrimPrefix(it.file.Name, "/"))
+}
+
+// Info returns information on the current entry. Symbolic
+// links are described as such rather than by their targets.
+func (it *ArchiveIter) Info() fs.FileInfo {
+	return it.file.FileInfo()
+}
+
+// Open returns a reader for the contents of the current entry, which
+// is valid until Next or Close is called. The contents of a symbolic
+// link are its target; a directory has no contents.
+func (it *ArchiveIter) Open() (io.Reader, error) {
+	if it.file.Mode().IsDir() {
+		return strings.NewReader(""), nil
+	}
+	if err := it.closeEntry(); err != nil {
+		return nil, err
+	}
+	rc, err := it.file.Open()
+	if err != nil {
+		return nil, err
+	}
+	it.rc = rc
+	return rc, nil
+}
+
+// Err returns any error encountered during the iteration.
+func (it *ArchiveIter) Err() error {
+	return it.err
+}
+
+// Close releases the resources held by the iterator.
+func (it *ArchiveIter) Close() error {
+	err := it.closeEntry()
+	if zerr := it.zipr.Close(); err == nil {
+		err = zerr
+	}
+	it.file = nil
+	it.index = len(it.zipr.File)
+	return err
+}
+
+func (it *ArchiveIter) closeEntry() error {
+	if it.rc == nil {
+		return nil
+	}
+	err := it.rc.Close()
+	it.rc = nil
+	return err
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/set"
+	gc "gopkg.in/check.v1"
+)
+
+type ArchiveIterSuite struct{}
+
+var _ = gc.Suite(&ArchiveIterSuite{})
+
+func (s *ArchiveIterSuite) TestIter(c *gc.C) {
+	srcPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	haveSymlinks := os.Symlink("../target", filepath.Join(srcPath, "hooks/symlink")) == nil
+	archive := archiveDir(c, srcPath)
+
+	iter, err := archive.Iter()
+	c.Assert(err, gc.IsNil)
+	defer iter.Close()
+	paths := set.NewStrings()
+	contents := make(map[string]string)
+	for iter.Next() {
+		p := iter.Path()
+		c.Assert(paths.Contains(p), jc.IsFalse, gc.Commentf("duplicate %q", p))
+		paths.Add(p)
+		info := iter.Info()
+		c.Assert(info.Name(), gc.Equals, filepath.Base(p))
+		r, err := iter.Open()
+		c.Assert(err, gc.IsNil)
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, gc.IsNil)
+		if info.IsDir() {
+			c.Assert(data, gc.HasLen, 0)
+			continue
+		}
+		contents[p] = string(data)
+	}
+	c.Assert(iter.Err(), gc.IsNil)
+
+	expected := set.NewStrings(dummyManifest...)
+	if haveSymlinks {
+		expected.Add("hooks/symlink")
+		c.Assert(contents["hooks/symlink"], gc.Equals, "../target")
+	}
+	c.Assert(paths, gc.DeepEquals, expected)
+	metadata, err := ioutil.ReadFile(filepath.Join(srcPath, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(contents["metadata.yaml"], gc.Equals, string(metadata))
+}
+
+func (s *ArchiveIterSuite) TestIterWithoutReading(c *gc.C) {
+	archive := archiveDir(c, TestCharms.ClonedDirPath(c.MkDir(), "dummy"))
+	iter, err := archive.Iter()
+	c.Assert(err, gc.IsNil)
+	n := 0
+	for iter.Next() {
+		if n%2 == 0 {
+			// Readers may be left partly read.
+			r, err := iter.Open()
+			c.Assert(err, gc.IsNil)
+			_, err = r.Read(make([]byte, 1))
+			c.Assert(err == nil || iter.Info().Size() == 0, jc.IsTrue)
+		}
+		n++
+	}
+	c.Assert(iter.Err(), gc.IsNil)
+	c.Assert(n, gc.Equals, len(dummyManifest))
+	c.Assert(iter.Close(), gc.IsNil)
+	c.Assert(iter.Next(), jc.IsFalse)
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ArchivePolicy holds limits on the contents of the archives created
+// by CharmDir.ArchiveTo, so that the limits imposed by a charm store
+// can be enforced when a charm is built rather than when it is
+// uploaded. The zero value imposes no limits.
+type ArchivePolicy struct {
+	// MaxArchiveSize holds the maximum size in bytes of the
+	// archive written, or zero if there is no limit.
+	MaxArchiveSize int64
+
+	// MaxFileSize holds the maximum size in bytes of any single
+	// file in the charm, or zero if there is no limit.
+	MaxFileSize int64
+
+	// ForbiddenExtensions holds the extensions, such as ".pyc",
+	// of the names of files that may not be archived. They are
+	// matched without regard to case.
+	ForbiddenExtensions []string
+
+	// ForbiddenPaths holds patterns matching the slash-separated
+	// paths of files and directories that may not be archived.
+	// A pattern ending in a slash, such as "tests/", matches the
+	// named directory and everything below it; other patterns are
+	// matched against the whole path, using the syntax of
+	// path.Match.
+	ForbiddenPaths []string
+}
+
+// ArchiveSizeLimitError is returned when an archive would
+// exceed the size allowed by ArchivePolicy.MaxArchiveSize.
+type ArchiveSizeLimitError struct {
+	// Limit holds the limit, in bytes.
+	Limit int64
+}
+
+func (err *ArchiveSizeLimitError) Error() string {
+	return fmt.Sprintf("charm archive size exceeds limit %d", err.Limit)
+}
+
+// FileSizeLimitError is returned when a file in a charm is
+// larger than allowed by ArchivePolicy.MaxFileSize.
+type FileSizeLimitError struct {
+	// Path holds the slash-separated path of the file.
+	Path string
+
+	// Size holds the size of the file, in bytes.
+	Size int64
+
+	// Limit holds the limit, in bytes.
+	Limit int64
+}
+
+func (err *FileSizeLimitError) Error() string {
+	return fmt.Sprintf("charm file %q size %d exceeds limit %d", err.Path, err.Size, err.Limit)
+}
+
+// ForbiddenFileError is returned when a charm holds a file
+// forbidden by ArchivePolicy.ForbiddenExtensions or
+// ArchivePolicy.ForbiddenPaths.
+type ForbiddenFileError struct {
+	// Path holds the slash-separated path of the file.
+	Path string
+
+	// Rule holds the forbidden extension or
+	// path pattern matched by the file.
+	Rule string
+}
+
+func (err *ForbiddenFileError) Error() string {
+	return fmt.Sprintf("charm file %q is forbidden by %q", err.Path, err.Rule)
+}
+
+// SetArchivePolicy sets the policy used by ArchiveTo to limit the
+// contents of the archive. If it is not called, no limits apply.
+func (dir *CharmDir) SetArchivePolicy(policy ArchivePolicy) {
+	dir.archivePolicy = policy
+}
+
+// checkPatterns returns an error if any of the
+// forbidden path patterns is malformed.
+func (p ArchivePolicy) checkPatterns() error {
+	for _, pattern := range p.ForbiddenPaths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid forbidden path pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// checkFile returns an error if the file or directory at the given
+// slash-separated path, with the given size, may not be archived.
+func (p ArchivePolicy) checkFile(name string, isDir bool, size int64) error {
+	for _, pattern := range p.ForbiddenPaths {
+		if matchAny([]string{pattern}, name) {
+			return &ForbiddenFileError{
+				Path: name,
+				Rule: pattern,
+			}
+		}
+	}
+	if isDir {
+		return nil
+	}
+	ext := path.Ext(name)
+	for _, forbidden := range p.ForbiddenExtensions {
+		if ext != "" && strings.EqualFold(ext, "."+strings.TrimPrefix(forbidden, ".")) {
+			return &ForbiddenFileError{
+				Path: name,
+				Rule: forbidden,
+			}
+		}
+	}
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return &FileSizeLimitError{
+			Path:  name,
+			Size:  size,
+			Limit: p.MaxFileSize,
+		}
+	}
+	return nil
+}
+
+// archiveSizeWriter wraps a writer, failing with an
+// *ArchiveSizeLimitError once more than limit bytes
+// have been written.
+type archiveSizeWriter struct {
+	w     io.Writer
+	limit int64
+	size  int64
+	err   error
+}
+
+func (w *archiveSizeWriter) Write(buf []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.size+int64(len(buf)) > w.limit {
+		w.err = &ArchiveSizeLimitError{
+			Limit: w.limit,
+		}
+		return 0, w.err
+	}
+	n, err := w.w.Write(buf)
+	w.size += int64(n)
+	return n, err
+}
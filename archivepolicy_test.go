@@ -0,0 +1,132 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ArchivePolicySuite struct{}
+
+var _ = gc.Suite(&ArchivePolicySuite{})
+
+func (s *ArchivePolicySuite) TestMaxArchiveSize(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	dir.SetArchivePolicy(charm.ArchivePolicy{
+		MaxArchiveSize: 100,
+	})
+	err := dir.ArchiveTo(&bytes.Buffer{})
+	c.Assert(err, gc.FitsTypeOf, &charm.ArchiveSizeLimitError{})
+	c.Assert(err, gc.ErrorMatches, `charm archive size exceeds limit 100`)
+
+	var b bytes.Buffer
+	dir.SetArchivePolicy(charm.ArchivePolicy{
+		MaxArchiveSize: 1 << 20,
+	})
+	err = dir.ArchiveTo(&b)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmArchiveBytes(b.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	// The limit applies exactly to the size of the archive.
+	dir.SetArchivePolicy(charm.ArchivePolicy{
+		MaxArchiveSize: int64(b.Len()),
+	})
+	err = dir.ArchiveTo(&bytes.Buffer{})
+	c.Assert(err, gc.IsNil)
+	dir.SetArchivePolicy(charm.ArchivePolicy{
+		MaxArchiveSize: int64(b.Len() - 1),
+	})
+	err = dir.ArchiveTo(&bytes.Buffer{})
+	c.Assert(err, gc.FitsTypeOf, &charm.ArchiveSizeLimitError{})
+}
+
+func (s *ArchivePolicySuite) TestMaxFileSize(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "src", "big"), make([]byte, 2000), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	dir.SetArchivePolicy(charm.ArchivePolicy{
+		MaxFileSize: 1000,
+	})
+	err = dir.ArchiveTo(&bytes.Buffer{})
+	c.Assert(err, gc.FitsTypeOf, &charm.FileSizeLimitError{})
+	c.Assert(err, gc.ErrorMatches, `charm file "src/big" size 2000 exceeds limit 1000`)
+	c.Assert(*err.(*charm.FileSizeLimitError), gc.Equals, charm.FileSizeLimitError{
+		Path:  "src/big",
+		Size:  2000,
+		Limit: 1000,
+	})
+
+	dir.SetArchivePolicy(charm.ArchivePolicy{
+		MaxFileSize: 2000,
+	})
+	err = dir.ArchiveTo(&bytes.Buffer{})
+	c.Assert(err, gc.IsNil)
+}
+
+var forbiddenFileTests = []struct {
+	about  string
+	policy charm.ArchivePolicy
+	err    string
+	rule   string
+}{{
+	about: "forbidden extension",
+	policy: charm.ArchivePolicy{
+		ForbiddenExtensions: []string{".pyc", "C"},
+	},
+	err:  `charm file "src/hello.c" is forbidden by "C"`,
+	rule: "C",
+}, {
+	about: "forbidden directory",
+	policy: charm.ArchivePolicy{
+		ForbiddenPaths: []string{"tests/", "src/"},
+	},
+	err:  `charm file "src" is forbidden by "src/"`,
+	rule: "src/",
+}, {
+	about: "forbidden file pattern",
+	policy: charm.ArchivePolicy{
+		ForbiddenPaths: []string{"*/*.c"},
+	},
+	err:  `charm file "src/hello.c" is forbidden by "\*/\*.c"`,
+	rule: "*/*.c",
+}, {
+	about: "allowed files",
+	policy: charm.ArchivePolicy{
+		ForbiddenExtensions: []string{".pyc"},
+		ForbiddenPaths:      []string{"*.c", "tests/"},
+	},
+}, {
+	about: "invalid pattern",
+	policy: charm.ArchivePolicy{
+		ForbiddenPaths: []string{"src/["},
+	},
+	err: `invalid forbidden path pattern "src/\[": syntax error in pattern`,
+}}
+
+func (s *ArchivePolicySuite) TestForbiddenFiles(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	for i, test := range forbiddenFileTests {
+		c.Logf("test %d: %s", i, test.about)
+		dir.SetArchivePolicy(test.policy)
+		err := dir.ArchiveTo(&bytes.Buffer{})
+		if test.err == "" {
+			c.Assert(err, gc.IsNil)
+			continue
+		}
+		c.Assert(err, gc.ErrorMatches, test.err)
+		if test.rule != "" {
+			c.Assert(err, gc.FitsTypeOf, &charm.ForbiddenFileError{})
+			c.Assert(err.(*charm.ForbiddenFileError).Rule, gc.Equals, test.rule)
+		}
+	}
+}
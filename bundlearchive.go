@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"sort"
+	"strings"
 
 	ziputil "github.com/juju/utils/zip"
 )
@@ -17,12 +19,20 @@ type BundleArchive struct {
 	Path   string
 	data   *BundleData
 	readMe string
+
+	// Warnings holds any warnings produced when reading the
+	// bundle, such as a CodeMissingReadme warning when the
+	// bundle has no README file.
+	Warnings []Warning
 }
 
 // ReadBundleArchive reads a bundle archive from the given file path.
+// A missing README file is not an error, but is reported in the
+// Warnings field.
 func ReadBundleArchive(path string) (*BundleArchive, error) {
 	a, err := readBundleArchive(newZipOpenerFromPath(path))
 	if err != nil {
+		setArchiveErrorPath(err, path)
 		return nil, err
 	}
 	a.Path = path
@@ -52,11 +62,14 @@ func readBundleArchive(zopen zipOpener) (*BundleArchive, error) {
 	}
 	zipr, err := zopen.openZip()
 	if err != nil {
-		return nil, err
+		return nil, archiveOpenError(zopen, err)
 	}
 	defer zipr.Close()
-	reader, err := zipOpenFile(zipr, "bundle.yaml")
+	reader, err := zipOpenFile(zipr, BundleFile)
 	if err != nil {
+		if nestedErr := nestedArchiveError(zipr); nestedErr != nil {
+			return nil, nestedErr
+		}
 		return nil, err
 	}
 	a.data, err = ReadBundleData(reader)
@@ -64,11 +77,17 @@ func readBundleArchive(zopen zipOpener) (*BundleArchive, error) {
 	if err != nil {
 		return nil, err
 	}
-	reader, err = zipOpenFile(zipr, "README.md")
+	name := findReadme(zipRootFiles(zipr))
+	if name == "" {
+		a.Warnings = append(a.Warnings, noReadmeWarning())
+		return a, nil
+	}
+	reader, err = zipOpenFile(zipr, name)
 	if err != nil {
 		return nil, err
 	}
 	readMe, err := ioutil.ReadAll(reader)
+	reader.Close()
 	if err != nil {
 		return nil, err
 	}
@@ -76,16 +95,78 @@ func readBundleArchive(zopen zipOpener) (*BundleArchive, error) {
 	return a, nil
 }
 
+// zipRootFiles returns the names of the regular
+// files at the root of the archive.
+func zipRootFiles(zipr *zipReadCloser) []string {
+	var names []string
+	for _, fh := range zipr.File {
+		if fh.Mode().IsRegular() && !strings.Contains(fh.Name, "/") {
+			names = append(names, fh.Name)
+		}
+	}
+	return names
+}
+
 // Data implements Bundle.Data.
 func (a *BundleArchive) Data() *BundleData {
 	return a.data
 }
 
-// ReadMe implements Bundle.ReadMe.
+// ReadMe implements Bundle.ReadMe. It returns the
+// empty string if the bundle has no README file.
 func (a *BundleArchive) ReadMe() string {
 	return a.readMe
 }
 
+// Readme returns the contents of the bundle's README file, along
+// with its name, which may be used to determine its format. The
+// same names are recognized as for charms. It returns ErrNoReadme
+// if the bundle has no README. The returned reader must be closed
+// after use.
+func (a *BundleArchive) Readme() (io.ReadCloser, string, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, "", err
+	}
+	name := findReadme(zipRootFiles(zipr))
+	if name == "" {
+		zipr.Close()
+		return nil, "", ErrNoReadme
+	}
+	rc, err := zipOpenFile(zipr, name)
+	if err != nil {
+		zipr.Close()
+		return nil, "", err
+	}
+	return &multiReadCloser{
+		Reader: rc,
+		Closer: closerFunc(func() error {
+			rc.Close()
+			return zipr.Close()
+		}),
+	}, name, nil
+}
+
+// DocsFiles returns the paths within the archive of the
+// documentation files held in the bundle's docs directory, in
+// alphabetical order. Hidden files are ignored. It returns no
+// paths if the bundle has no docs directory.
+func (a *BundleArchive) DocsFiles() ([]string, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	var names []string
+	for _, fh := range zipr.File {
+		if fh.Mode().IsRegular() && isDocsFile(fh.Name) {
+			names = append(names, fh.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // ExpandTo expands the bundle archive into dir, creating it if necessary.
 // If any errors occur during the expansion procedure, the process will
 // abort.
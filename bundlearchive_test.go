@@ -4,11 +4,11 @@
 package charm_test
 
 import (
-	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
 	"gopkg.in/juju/charm.v5"
@@ -52,14 +52,28 @@ func (s *BundleArchiveSuite) TestReadBundleArchiveFromReader(c *gc.C) {
 }
 
 func (s *BundleArchiveSuite) TestReadBundleArchiveWithoutBundleYAML(c *gc.C) {
-	testReadBundleArchiveWithoutFile(c, "bundle.yaml")
+	archivePath := archiveBundleWithoutFile(c, "bundle.yaml")
+	archive, err := charm.ReadBundleArchive(archivePath)
+	c.Assert(err, gc.ErrorMatches, `archive file "bundle.yaml" not found`)
+	c.Assert(archive, gc.IsNil)
 }
 
 func (s *BundleArchiveSuite) TestReadBundleArchiveWithoutREADME(c *gc.C) {
-	testReadBundleArchiveWithoutFile(c, "README.md")
+	archivePath := archiveBundleWithoutFile(c, "README.md")
+	archive, err := charm.ReadBundleArchive(archivePath)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.ReadMe(), gc.Equals, "")
+	c.Assert(archive.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeMissingReadme,
+		Message: "bundle has no README file; expected one of README.md, README.rst, README.txt",
+	}})
+	_, _, err = archive.Readme()
+	c.Assert(err, gc.Equals, charm.ErrNoReadme)
 }
 
-func testReadBundleArchiveWithoutFile(c *gc.C, fileToRemove string) {
+// archiveBundleWithoutFile archives a copy of the wordpress-simple
+// bundle with the given file removed, returning the archive's path.
+func archiveBundleWithoutFile(c *gc.C, fileToRemove string) string {
 	path := TestCharms.ClonedBundleDirPath(c.MkDir(), "wordpress-simple")
 	dir, err := charm.ReadBundleDir(path)
 	c.Assert(err, gc.IsNil)
@@ -77,12 +91,8 @@ func testReadBundleArchiveWithoutFile(c *gc.C, fileToRemove string) {
 
 	err = dir.ArchiveTo(dstf)
 	dstf.Close()
-
-	archive, err := charm.ReadBundleArchive(archivePath)
-	// Slightly dubious assumption: the quoted file name has no
-	// regexp metacharacters worth worrying about.
-	c.Assert(err, gc.ErrorMatches, fmt.Sprintf("archive file %q not found", fileToRemove))
-	c.Assert(archive, gc.IsNil)
+	c.Assert(err, gc.IsNil)
+	return archivePath
 }
 
 func (s *BundleArchiveSuite) TestExpandTo(c *gc.C) {
@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+// verifyBindings verifies the bindings of the given service. When
+// the charm of the service is known, each bound name must be an
+// endpoint or an extra binding of the charm.
+func (verifier *bundleDataVerifier) verifyBindings(svcName string, svc *ServiceSpec) {
+	if len(svc.Bindings) == 0 {
+		return
+	}
+	var meta *Meta
+	if ch := verifier.charms[svc.Charm]; ch != nil {
+		meta = ch.Meta()
+	}
+	for name, space := range svc.Bindings {
+		if space != "" && !validSpaceName.MatchString(space) {
+			verifier.addErrorf(CodeInvalidBinding, "invalid space name %q bound to %q in service %q", space, name, svcName)
+		}
+		if name == "" {
+			continue
+		}
+		if !validEndpointName.MatchString(name) {
+			verifier.addErrorf(CodeInvalidBinding, "invalid endpoint name %q in bindings of service %q", name, svcName)
+			continue
+		}
+		if meta == nil {
+			continue
+		}
+		if _, ok := meta.ExtraBindings[name]; !ok && !hasEndpoint(meta, name) {
+			verifier.addErrorf(CodeInvalidBinding, "charm %q used by service %q does not define endpoint or extra binding %q", svc.Charm, svcName, name)
+		}
+	}
+}
+
+// boundSpace returns the space the named endpoint of the service is
+// bound to, or the empty string if the bundle does not bind it.
+func (svc *ServiceSpec) boundSpace(endpoint string) string {
+	if space, ok := svc.Bindings[endpoint]; ok {
+		return space
+	}
+	return svc.Bindings[""]
+}
+
+// RelationBinding holds the spaces the endpoints of
+// a relation in a bundle are bound to.
+type RelationBinding struct {
+	// Endpoints holds the endpoints of the relation, in the form
+	// "service:relation", in the order they are given in the bundle.
+	// Relation names left out of the bundle are inferred.
+	Endpoints [2]string
+
+	// Spaces holds the spaces the endpoints are bound to, either by
+	// name or by the default binding of their service. An empty
+	// space means that the bundle does not bind the endpoint.
+	Spaces [2]string
+
+	// Err, if not nil, describes why the spaces the endpoints
+	// are bound to are not compatible.
+	Err error
+}
+
+// RelationBindings returns the spaces the endpoints of each relation
+// in the bundle are bound to, in the order the relations are given.
+// The charms map must hold an entry for each charm URL returned by
+// bd.RequiredCharms; it is used to infer relation names left out of
+// the relations.
+//
+// The endpoints of a relation are compatible if they are bound to the
+// same space, or if either is not bound by the bundle. The Err field
+// of each incompatible relation is set to an error with the
+// CodeInvalidBinding code, and RelationBindings also returns a
+// *VerificationError holding all of them.
+//
+// Relations that are malformed, or whose endpoints cannot be
+// inferred, are left out; VerifyWithCharms reports those.
+func (bd *BundleData) RelationBindings(charms map[string]Charm) ([]RelationBinding, error) {
+	verifier := &bundleDataVerifier{
+		bd:     bd,
+		charms: charms,
+	}
+	var bindings []RelationBinding
+	for _, relPair := range bd.Relations {
+		if len(relPair) != 2 {
+			continue
+		}
+		ep0, err0 := parseEndpoint(relPair[0])
+		ep1, err1 := parseEndpoint(relPair[1])
+		if err0 != nil || err1 != nil {
+			continue
+		}
+		svc0, svc1 := bd.Services[ep0.service], bd.Services[ep1.service]
+		if svc0 == nil || svc1 == nil || svc0 == svc1 {
+			continue
+		}
+		ep0, ep1, err := inferEndpoints(ep0, ep1, verifier.getCharmMetaForService)
+		if err != nil {
+			continue
+		}
+		b := RelationBinding{
+			Endpoints: [2]string{ep0.String(), ep1.String()},
+			Spaces:    [2]string{svc0.boundSpace(ep0.relation), svc1.boundSpace(ep1.relation)},
+		}
+		if b.Spaces[0] != "" && b.Spaces[1] != "" && b.Spaces[0] != b.Spaces[1] {
+			b.Err = errorCodef(CodeInvalidBinding, "relation %q to %q joins endpoints bound to different spaces (%q vs %q)", ep0, ep1, b.Spaces[0], b.Spaces[1])
+			verifier.addError(b.Err)
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, verifier.err()
+}
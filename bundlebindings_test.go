@@ -0,0 +1,93 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type bundleBindingsSuite struct{}
+
+var _ = gc.Suite(&bundleBindingsSuite{})
+
+const bindingsBundle = `
+services:
+    wordpress:
+        charm: wordpress
+        bindings:
+            "": public
+            db: internal
+    mysql:
+        charm: mysql
+        bindings:
+            server: internal
+            monitoring: admin
+    logging:
+        charm: logging
+        bindings:
+            "": admin
+relations:
+    - ["wordpress:db", "mysql:server"]
+    - ["wordpress", "logging"]
+`
+
+func bindingsCharms() map[string]charm.Charm {
+	mysql := testCharm("mysql", "server:mysql")
+	mysql.Meta().ExtraBindings = map[string]charm.ExtraBinding{
+		"monitoring": {Name: "monitoring"},
+	}
+	return map[string]charm.Charm{
+		"wordpress": testCharm("wordpress", "url:http | db:mysql logging-dir:logging"),
+		"mysql":     mysql,
+		"logging":   testCharm("logging", "logging-directory:logging"),
+	}
+}
+
+func (*bundleBindingsSuite) TestVerifyBindings(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(bindingsBundle))
+	c.Assert(err, gc.IsNil)
+	err = bd.VerifyWithCharms(nil, bindingsCharms())
+	c.Assert(err, gc.IsNil)
+
+	bd.Services["mysql"].Bindings["nowhere"] = "internal"
+	bd.Services["logging"].Bindings["logging-directory"] = "Not Valid"
+	err = bd.VerifyWithCharms(nil, bindingsCharms())
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	var messages []string
+	for _, err := range err.(*charm.VerificationError).Errors {
+		c.Check(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidBinding)
+		messages = append(messages, err.Error())
+	}
+	c.Assert(messages, jc.SameContents, []string{
+		`charm "mysql" used by service "mysql" does not define endpoint or extra binding "nowhere"`,
+		`invalid space name "Not Valid" bound to "logging-directory" in service "logging"`,
+	})
+}
+
+func (*bundleBindingsSuite) TestRelationBindings(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(bindingsBundle))
+	c.Assert(err, gc.IsNil)
+	bindings, err := bd.RelationBindings(bindingsCharms())
+	c.Assert(err, gc.ErrorMatches, `relation "wordpress:logging-dir" to "logging:logging-directory" joins endpoints bound to different spaces \("public" vs "admin"\)`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeVerificationFailed)
+	c.Assert(bindings, gc.HasLen, 2)
+	c.Assert(bindings[0], jc.DeepEquals, charm.RelationBinding{
+		Endpoints: [2]string{"wordpress:db", "mysql:server"},
+		Spaces:    [2]string{"internal", "internal"},
+	})
+	c.Assert(bindings[1].Endpoints, gc.Equals, [2]string{"wordpress:logging-dir", "logging:logging-directory"})
+	c.Assert(bindings[1].Spaces, gc.Equals, [2]string{"public", "admin"})
+	c.Assert(charm.ErrorCode(bindings[1].Err), gc.Equals, charm.CodeInvalidBinding)
+
+	delete(bd.Services["logging"].Bindings, "")
+	bindings, err = bd.RelationBindings(bindingsCharms())
+	c.Assert(err, gc.IsNil)
+	c.Assert(bindings[1].Spaces, gc.Equals, [2]string{"public", ""})
+	c.Assert(bindings[1].Err, gc.IsNil)
+}
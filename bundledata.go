@@ -6,7 +6,7 @@ package charm
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
+	"net"
 	"regexp"
 	"sort"
 	"strconv"
@@ -49,6 +49,23 @@ type BundleData struct {
 
 	// Short paragraph explaining what the bundle is useful for.
 	Description string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Type holds the type of the bundle. It is empty for
+	// bundles deployed to machines, and KubernetesBundle for
+	// bundles deployed to Kubernetes, whose services are
+	// sized with Scale and placed with Placement.
+	Type string `bson:"bundle,omitempty" json:"bundle,omitempty" yaml:"bundle,omitempty"`
+}
+
+// KubernetesBundle is the type of the bundles
+// deployed to Kubernetes.
+const KubernetesBundle = "kubernetes"
+
+// IsKubernetes reports whether the bundle is deployed to
+// Kubernetes, because it has type KubernetesBundle or its
+// default series is KubernetesSeries.
+func (bd *BundleData) IsKubernetes() bool {
+	return bd.Type == KubernetesBundle || bd.Series == KubernetesSeries
 }
 
 // MachineSpec represents a notional machine that will be mapped
@@ -66,6 +83,18 @@ type ServiceSpec struct {
 	// use for the given service.
 	Charm string
 
+	// Channel, if not nil, holds the channel the charm is
+	// deployed from, such as "8.0/stable", written in the
+	// form accepted by ParseChannel.
+	Channel *Channel `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Revision, if not nil, pins the service to the given
+	// revision of the charm. As the resources of the charm
+	// are resolved through its channel, a revision may only
+	// be pinned along with Channel, and not when the charm
+	// URL holds a revision.
+	Revision *int `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
 	// NumUnits holds the number of units of the
 	// service that will be deployed.
 	NumUnits int `yaml:"num_units"`
@@ -130,19 +159,85 @@ type ServiceSpec struct {
 	// when creating new machines for units of the service.
 	// This is ignored for units with explicit placement directives.
 	Constraints string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Expose holds whether the service must be exposed
+	// to all networks once it is deployed.
+	Expose bool `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// ExposedEndpoints holds, for each endpoint to be exposed,
+	// the spaces and CIDRs allowed to reach it once the service
+	// is deployed. An entry with an empty endpoint name applies
+	// to all the service's endpoints. It cannot be used
+	// together with Expose.
+	ExposedEndpoints map[string]ExposedEndpointSpec `bson:"exposed-endpoints,omitempty" json:"exposed-endpoints,omitempty" yaml:"exposed-endpoints,omitempty"`
+
+	// Scale holds the number of units of the service
+	// that will be deployed in a Kubernetes bundle,
+	// where it is used instead of NumUnits.
+	Scale int `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Placement holds the placement directive, such as a
+	// node selector, of the units of the service in a
+	// Kubernetes bundle, where it is used instead of To.
+	Placement string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Storage holds the constraints of the storage to attach to
+	// the units of the service, keyed by the name of the store
+	// in the charm, such as "ebs,10G,2". See
+	// ParseStorageConstraints.
+	Storage map[string]string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Devices holds the constraints of the devices to attach to
+	// the units of the service, keyed by device name, such as
+	// "2,nvidia.com/gpu". See ParseDeviceConstraints.
+	Devices map[string]string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Resources holds the resources to use for the service,
+	// keyed by the name of the resource in the charm. Each value
+	// holds either the revision of the resource in the store
+	// or the path of a local file. See BundleResource.
+	Resources map[string]interface{} `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Bindings maps the endpoints and extra bindings of the
+	// service's charm to the spaces they are bound to. An entry
+	// with an empty endpoint name sets the space of all the
+	// endpoints not otherwise bound.
+	Bindings map[string]string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+}
+
+// DesiredScale returns the number of units of the service that will
+// be deployed, whether it is specified by NumUnits or by Scale.
+func (svc *ServiceSpec) DesiredScale() int {
+	if svc.Scale != 0 {
+		return svc.Scale
+	}
+	return svc.NumUnits
+}
+
+// ExposedEndpointSpec describes the networks an exposed endpoint of
+// a service is reachable from. If both fields are empty, the endpoint
+// is reachable from everywhere.
+type ExposedEndpointSpec struct {
+	// ToSpaces holds the names of the spaces
+	// that may reach the endpoint.
+	ToSpaces []string `bson:"to-spaces,omitempty" json:"to-spaces,omitempty" yaml:"to-spaces,omitempty"`
+
+	// ToCIDRs holds the CIDRs that may reach the endpoint.
+	ToCIDRs []string `bson:"to-cidrs,omitempty" json:"to-cidrs,omitempty" yaml:"to-cidrs,omitempty"`
 }
 
 // ReadBundleData reads bundle data from the given reader.
 // The returned data is not verified - call Verify to ensure
-// that it is OK.
+// that it is OK. It returns a *DocumentTooLargeError if the
+// data exceeds MaxBundleDataSize.
 func ReadBundleData(r io.Reader) (*BundleData, error) {
-	bytes, err := ioutil.ReadAll(r)
+	bytes, err := readDocument(r, BundleFile, MaxBundleDataSize)
 	if err != nil {
 		return nil, err
 	}
 	var bd BundleData
 	if err := yaml.Unmarshal(bytes, &bd); err != nil {
-		return nil, fmt.Errorf("cannot unmarshal bundle data: %v", err)
+		return nil, errorCodef(CodeInvalidBundle, "cannot unmarshal bundle data: %v", err)
 	}
 	return &bd, nil
 }
@@ -153,6 +248,12 @@ type VerificationError struct {
 	Errors []error
 }
 
+// ErrorCode implements CodedError.ErrorCode. The codes of the
+// individual verification errors are available from err.Errors.
+func (err *VerificationError) ErrorCode() string {
+	return CodeVerificationFailed
+}
+
 func (err *VerificationError) Error() string {
 	switch len(err.Errors) {
 	case 0:
@@ -176,8 +277,8 @@ type bundleDataVerifier struct {
 	verifyConstraints func(c string) error
 }
 
-func (verifier *bundleDataVerifier) addErrorf(f string, a ...interface{}) {
-	verifier.addError(fmt.Errorf(f, a...))
+func (verifier *bundleDataVerifier) addErrorf(code string, f string, a ...interface{}) {
+	verifier.addError(errorCodef(code, f, a...))
 }
 
 func (verifier *bundleDataVerifier) addError(err error) {
@@ -213,7 +314,9 @@ func (bd *BundleData) Verify(
 // VerifyWithCharms verifies that the bundle is consistent.
 // The verifyConstraints function is called to verify any constraints
 // that are found. If verifyConstraints is nil, no checking
-// of constraints will be done.
+// of constraints will be done; VerifyConstraints may be used
+// to check them with ParseConstraints. Errors are reported
+// with the machine or service holding the invalid constraints.
 //
 // It verifies the following:
 //
@@ -248,7 +351,13 @@ func (bd *BundleData) VerifyWithCharms(
 		verifier.machineRefCounts[id] = 0
 	}
 	if bd.Series != "" && !IsValidSeries(bd.Series) {
-		verifier.addErrorf("bundle declares an invalid series %q", bd.Series)
+		verifier.addErrorf(CodeInvalidSeries, "bundle declares an invalid series %q", bd.Series)
+	}
+	if bd.Type != "" && bd.Type != KubernetesBundle {
+		verifier.addErrorf(CodeInvalidBundle, "bundle declares an unknown type %q", bd.Type)
+	}
+	if bd.IsKubernetes() && len(bd.Machines) > 0 {
+		verifier.addErrorf(CodeInvalidMachine, "machines cannot be specified in a kubernetes bundle")
 	}
 	verifier.verifyMachines()
 	verifier.verifyServices()
@@ -257,7 +366,7 @@ func (bd *BundleData) VerifyWithCharms(
 
 	for id, count := range verifier.machineRefCounts {
 		if count == 0 {
-			verifier.addErrorf("machine %q is not referred to by a placement directive", id)
+			verifier.addErrorf(CodeUnusedMachine, "machine %q is not referred to by a placement directive", id)
 		}
 	}
 	return verifier.err()
@@ -268,48 +377,156 @@ var validMachineId = regexp.MustCompile("^" + names.NumberSnippet + "$")
 func (verifier *bundleDataVerifier) verifyMachines() {
 	for id, m := range verifier.bd.Machines {
 		if !validMachineId.MatchString(id) {
-			verifier.addErrorf("invalid machine id %q found in machines", id)
+			verifier.addErrorf(CodeInvalidMachine, "invalid machine id %q found in machines", id)
 		}
 		if m == nil {
 			continue
 		}
 		if m.Constraints != "" {
 			if err := verifier.verifyConstraints(m.Constraints); err != nil {
-				verifier.addErrorf("invalid constraints %q in machine %q: %v", m.Constraints, id, err)
+				verifier.addErrorf(CodeInvalidConstraints, "invalid constraints %q in machine %q: %v", m.Constraints, id, err)
 			}
 		}
 		if m.Series != "" && !IsValidSeries(m.Series) {
-			verifier.addErrorf("invalid series %s for machine %q", m.Series, id)
+			verifier.addErrorf(CodeInvalidSeries, "invalid series %s for machine %q", m.Series, id)
 		}
 	}
 }
 
 func (verifier *bundleDataVerifier) verifyServices() {
 	if len(verifier.bd.Services) == 0 {
-		verifier.addErrorf("at least one service must be specified")
+		verifier.addErrorf(CodeInvalidService, "at least one service must be specified")
 		return
 	}
 	for name, svc := range verifier.bd.Services {
-		if _, err := ParseReference(svc.Charm); err != nil {
-			verifier.addErrorf("invalid charm URL in service %q: %v", name, err)
+		if ref, err := ParseReference(svc.Charm); err != nil {
+			verifier.addErrorf(CodeInvalidService, "invalid charm URL in service %q: %v", name, err)
+		} else {
+			verifier.verifyPinning(name, svc, ref)
 		}
 		if err := verifier.verifyConstraints(svc.Constraints); err != nil {
-			verifier.addErrorf("invalid constraints %q in service %q: %v", svc.Constraints, name, err)
+			verifier.addErrorf(CodeInvalidConstraints, "invalid constraints %q in service %q: %v", svc.Constraints, name, err)
 		}
-		verifier.verifyPlacement(svc.To)
-		if svc.NumUnits < 0 {
-			verifier.addErrorf("negative number of units specified on service %q", name)
-		} else if len(svc.To) > svc.NumUnits {
-			verifier.addErrorf("too many units specified in unit placement for service %q", name)
+		if verifier.bd.IsKubernetes() {
+			verifier.verifyKubernetesScale(name, svc)
+		} else {
+			verifier.verifyMachineScale(name, svc)
 		}
 		if verifier.charms != nil {
 			if _, ok := verifier.charms[svc.Charm]; !ok {
-				verifier.addErrorf("service %q refers to non-existent charm %q", name, svc.Charm)
+				verifier.addErrorf(CodeCharmNotFound, "service %q refers to non-existent charm %q", name, svc.Charm)
+			}
+		}
+		verifier.verifyExpose(name, svc)
+		verifier.verifyBindings(name, svc)
+		verifier.verifyOverrides(name, svc)
+	}
+}
+
+// verifyMachineScale verifies the number of units and the
+// placement of the given service in a bundle deployed to machines.
+func (verifier *bundleDataVerifier) verifyMachineScale(name string, svc *ServiceSpec) {
+	if svc.Scale != 0 {
+		verifier.addErrorf(CodeInvalidUnitCount, "scale specified on service %q, which is not in a kubernetes bundle; use num_units instead", name)
+	}
+	if svc.Placement != "" {
+		verifier.addErrorf(CodeInvalidPlacement, "placement specified on service %q, which is not in a kubernetes bundle; use to instead", name)
+	}
+	verifier.verifyPlacement(svc.To)
+	if svc.NumUnits < 0 {
+		verifier.addErrorf(CodeInvalidUnitCount, "negative number of units specified on service %q", name)
+	} else if len(svc.To) > svc.NumUnits {
+		verifier.addErrorf(CodeInvalidUnitCount, "too many units specified in unit placement for service %q", name)
+	}
+}
+
+// verifyPinning verifies the channel and the revision of the
+// given service, whose charm URL has been parsed as ref.
+func (verifier *bundleDataVerifier) verifyPinning(name string, svc *ServiceSpec, ref *Reference) {
+	if svc.Channel != nil {
+		if err := svc.Channel.Validate(); err != nil {
+			verifier.addErrorf(CodeInvalidChannel, "invalid channel %q in service %q: %v", svc.Channel, name, err)
+		}
+	}
+	if svc.Revision == nil {
+		return
+	}
+	switch {
+	case *svc.Revision < 0:
+		verifier.addErrorf(CodeBadRevision, "negative revision %d specified on service %q", *svc.Revision, name)
+	case ref.Revision != -1:
+		verifier.addErrorf(CodeBadRevision, "revision specified on service %q, whose charm URL %q already holds a revision", name, svc.Charm)
+	case svc.Channel == nil:
+		verifier.addErrorf(CodeBadRevision, "revision specified on service %q without a channel", name)
+	}
+}
+
+// verifyKubernetesScale verifies the scale and the placement
+// of the given service in a bundle deployed to Kubernetes.
+func (verifier *bundleDataVerifier) verifyKubernetesScale(name string, svc *ServiceSpec) {
+	if svc.NumUnits != 0 {
+		verifier.addErrorf(CodeInvalidUnitCount, "num_units specified on service %q in a kubernetes bundle; use scale instead", name)
+	}
+	if len(svc.To) > 0 {
+		verifier.addErrorf(CodeInvalidPlacement, "to specified on service %q in a kubernetes bundle; use placement instead", name)
+	}
+	if svc.Scale < 0 {
+		verifier.addErrorf(CodeInvalidUnitCount, "negative scale specified on service %q", name)
+	}
+}
+
+var (
+	validEndpointName = regexp.MustCompile("^" + names.RelationSnippet + "$")
+	validSpaceName    = regexp.MustCompile("^[a-z0-9]+(?:-[a-z0-9]+)*$")
+)
+
+// verifyExpose verifies the expose settings of the given service.
+func (verifier *bundleDataVerifier) verifyExpose(svcName string, svc *ServiceSpec) {
+	if len(svc.ExposedEndpoints) == 0 {
+		return
+	}
+	if svc.Expose {
+		verifier.addErrorf(CodeInvalidExpose, "exposed-endpoints cannot be specified together with expose: true in service %q", svcName)
+	}
+	var meta *Meta
+	if ch := verifier.charms[svc.Charm]; ch != nil {
+		meta = ch.Meta()
+	}
+	for epName, spec := range svc.ExposedEndpoints {
+		if epName != "" {
+			if !validEndpointName.MatchString(epName) {
+				verifier.addErrorf(CodeInvalidExpose, "invalid endpoint name %q in exposed-endpoints of service %q", epName, svcName)
+				continue
+			}
+			if meta != nil && !hasEndpoint(meta, epName) {
+				verifier.addErrorf(CodeInvalidExpose, "charm %q used by service %q does not define endpoint %q", svc.Charm, svcName, epName)
+			}
+		}
+		for _, space := range spec.ToSpaces {
+			if !validSpaceName.MatchString(space) {
+				verifier.addErrorf(CodeInvalidExpose, "invalid space name %q for exposed endpoint %q of service %q", space, epName, svcName)
+			}
+		}
+		for _, cidr := range spec.ToCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				verifier.addErrorf(CodeInvalidExpose, "invalid CIDR %q for exposed endpoint %q of service %q", cidr, epName, svcName)
 			}
 		}
 	}
 }
 
+// hasEndpoint reports whether the charm with the given
+// metadata defines the named endpoint.
+func hasEndpoint(meta *Meta, name string) bool {
+	if name == infoRelation.Name {
+		return true
+	}
+	_, okProv := meta.Provides[name]
+	_, okReq := meta.Requires[name]
+	_, okPeer := meta.Peers[name]
+	return okProv || okReq || okPeer
+}
+
 func (verifier *bundleDataVerifier) verifyPlacement(to []string) {
 	for _, p := range to {
 		up, err := ParsePlacement(p)
@@ -321,17 +538,17 @@ func (verifier *bundleDataVerifier) verifyPlacement(to []string) {
 		case up.Service != "":
 			spec, ok := verifier.bd.Services[up.Service]
 			if !ok {
-				verifier.addErrorf("placement %q refers to a service not defined in this bundle", p)
+				verifier.addErrorf(CodeInvalidPlacement, "placement %q refers to a service not defined in this bundle", p)
 				continue
 			}
 			if up.Unit >= 0 && up.Unit >= spec.NumUnits {
-				verifier.addErrorf("placement %q specifies a unit greater than the %d unit(s) started by the target service", p, spec.NumUnits)
+				verifier.addErrorf(CodeInvalidPlacement, "placement %q specifies a unit greater than the %d unit(s) started by the target service", p, spec.NumUnits)
 			}
 		case up.Machine == "new":
 		default:
 			_, ok := verifier.bd.Machines[up.Machine]
 			if !ok {
-				verifier.addErrorf("placement %q refers to a machine not defined in this bundle", p)
+				verifier.addErrorf(CodeInvalidPlacement, "placement %q refers to a machine not defined in this bundle", p)
 				continue
 			}
 			verifier.machineRefCounts[up.Machine]++
@@ -342,11 +559,11 @@ func (verifier *bundleDataVerifier) verifyPlacement(to []string) {
 func (verifier *bundleDataVerifier) getCharmMetaForService(svcName string) (*Meta, error) {
 	svc, ok := verifier.bd.Services[svcName]
 	if !ok {
-		return nil, fmt.Errorf("service %q not found", svcName)
+		return nil, errorCodef(CodeInvalidService, "service %q not found", svcName)
 	}
 	ch, ok := verifier.charms[svc.Charm]
 	if !ok {
-		return nil, fmt.Errorf("charm %q from service %q not found", svc.Charm, svcName)
+		return nil, errorCodef(CodeCharmNotFound, "charm %q from service %q not found", svc.Charm, svcName)
 	}
 	return ch.Meta(), nil
 }
@@ -355,7 +572,7 @@ func (verifier *bundleDataVerifier) verifyRelations() {
 	seen := make(map[[2]endpoint]bool)
 	for _, relPair := range verifier.bd.Relations {
 		if len(relPair) != 2 {
-			verifier.addErrorf("relation %q has %d endpoint(s), not 2", relPair, len(relPair))
+			verifier.addErrorf(CodeInvalidRelation, "relation %q has %d endpoint(s), not 2", relPair, len(relPair))
 			continue
 		}
 		var epPair [2]endpoint
@@ -368,7 +585,7 @@ func (verifier *bundleDataVerifier) verifyRelations() {
 				continue
 			}
 			if _, ok := verifier.bd.Services[ep.service]; !ok {
-				verifier.addErrorf("relation %q refers to service %q not defined in this bundle", relPair, ep.service)
+				verifier.addErrorf(CodeInvalidRelation, "relation %q refers to service %q not defined in this bundle", relPair, ep.service)
 			}
 			epPair[i] = ep
 		}
@@ -378,14 +595,14 @@ func (verifier *bundleDataVerifier) verifyRelations() {
 			continue
 		}
 		if epPair[0].service == epPair[1].service {
-			verifier.addErrorf("relation %q relates a service to itself", relPair)
+			verifier.addErrorf(CodeInvalidRelation, "relation %q relates a service to itself", relPair)
 		}
 		// Resolve endpoint relations if necessary and we have
 		// the necessary charm information.
 		if (epPair[0].relation == "" || epPair[1].relation == "") && verifier.charms != nil {
 			iep0, iep1, err := inferEndpoints(epPair[0], epPair[1], verifier.getCharmMetaForService)
 			if err != nil {
-				verifier.addErrorf("cannot infer endpoint between %s and %s: %v", epPair[0], epPair[1], err)
+				verifier.addErrorf(CodeInvalidRelation, "cannot infer endpoint between %s and %s: %v", epPair[0], epPair[1], err)
 			} else {
 				// Change the endpoints that get recorded
 				// as seen, so we'll diagnose a duplicate
@@ -402,7 +619,7 @@ func (verifier *bundleDataVerifier) verifyRelations() {
 			epPair[1], epPair[0] = epPair[0], epPair[1]
 		}
 		if _, ok := seen[epPair]; ok {
-			verifier.addErrorf("relation %q is defined more than once", relPair)
+			verifier.addErrorf(CodeInvalidRelation, "relation %q is defined more than once", relPair)
 		}
 		if verifier.charms != nil && epPair[0].relation != "" && epPair[1].relation != "" {
 			// We have charms to verify against, and the
@@ -446,7 +663,7 @@ func (verifier *bundleDataVerifier) verifyRelation(ep0, ep1 endpoint) {
 	}
 	relReq0, okReq0 := charm0.Meta().Requires[ep0.relation]
 	if !okProv0 && !okReq0 {
-		verifier.addErrorf("charm %q used by service %q does not define relation %q", svc0.Charm, ep0.service, ep0.relation)
+		verifier.addErrorf(CodeInvalidRelation, "charm %q used by service %q does not define relation %q", svc0.Charm, ep0.service, ep0.relation)
 	}
 	relProv1, okProv1 := charm1.Meta().Provides[ep1.relation]
 	// The juju-info relation is provided implicitly by every
@@ -456,7 +673,7 @@ func (verifier *bundleDataVerifier) verifyRelation(ep0, ep1 endpoint) {
 	}
 	relReq1, okReq1 := charm1.Meta().Requires[ep1.relation]
 	if !okProv1 && !okReq1 {
-		verifier.addErrorf("charm %q used by service %q does not define relation %q", svc1.Charm, ep1.service, ep1.relation)
+		verifier.addErrorf(CodeInvalidRelation, "charm %q used by service %q does not define relation %q", svc1.Charm, ep1.service, ep1.relation)
 	}
 
 	var relProv, relReq Relation
@@ -469,17 +686,17 @@ func (verifier *bundleDataVerifier) verifyRelation(ep0, ep1 endpoint) {
 		relProv, relReq = relProv1, relReq0
 		epProv, epReq = ep1, ep0
 	case okProv0 && okProv1:
-		verifier.addErrorf("relation %q to %q relates provider to provider", ep0, ep1)
+		verifier.addErrorf(CodeInvalidRelation, "relation %q to %q relates provider to provider", ep0, ep1)
 		return
 	case okReq0 && okReq1:
-		verifier.addErrorf("relation %q to %q relates requirer to requirer", ep0, ep1)
+		verifier.addErrorf(CodeInvalidRelation, "relation %q to %q relates requirer to requirer", ep0, ep1)
 		return
 	default:
 		// Errors were added above.
 		return
 	}
 	if relProv.Interface != relReq.Interface {
-		verifier.addErrorf("mismatched interface between %q and %q (%q vs %q)", epProv, epReq, relProv.Interface, relReq.Interface)
+		verifier.addErrorf(CodeInvalidRelation, "mismatched interface between %q and %q (%q vs %q)", epProv, epReq, relProv.Interface, relReq.Interface)
 	}
 }
 
@@ -495,21 +712,80 @@ func (verifier *bundleDataVerifier) verifyOptions() {
 			// An error will be produced by verifyServices for this case.
 			continue
 		}
-		config := charm.Config()
+		var options map[string]Option
+		if config := charm.Config(); config != nil {
+			options = config.Options
+		}
 		for name, value := range svc.Options {
-			opt, ok := config.Options[name]
+			opt, ok := options[name]
 			if !ok {
-				verifier.addErrorf("cannot validate service %q: configuration option %q not found in charm %q", svcName, name, svc.Charm)
+				verifier.addOptionError(svcName, name, errorCodef(CodeInvalidBundleOption, "configuration option %q not found in charm %q", name, svc.Charm))
 				continue
 			}
-			_, err := opt.validate(name, value)
-			if err != nil {
-				verifier.addErrorf("cannot validate service %q: %v", svcName, err)
+			if optionTypeCheckers[opt.Type] == nil {
+				verifier.addOptionError(svcName, name, errorCodef(CodeInvalidOptionType, "option %q has unknown type %q in charm %q", name, opt.Type, svc.Charm))
+				continue
+			}
+			if _, err := opt.validate(name, value); err != nil {
+				verifier.addOptionError(svcName, name, err)
 			}
 		}
 	}
 }
 
+func (verifier *bundleDataVerifier) addOptionError(svcName, option string, err error) {
+	verifier.addError(&BundleOptionError{
+		Service: svcName,
+		Option:  option,
+		Err:     err,
+	})
+}
+
+// BundleOptionError describes a problem with the value given
+// to a charm configuration option by a service in a bundle.
+type BundleOptionError struct {
+	// Service holds the name of the service.
+	Service string
+
+	// Option holds the name of the configuration option.
+	Option string
+
+	// Err describes the problem. It has the code
+	// CodeInvalidOptionValue when the value cannot be
+	// coerced to the type declared by the charm.
+	Err error
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (err *BundleOptionError) ErrorCode() string {
+	return CodeInvalidBundleOption
+}
+
+func (err *BundleOptionError) Error() string {
+	return fmt.Sprintf("cannot validate service %q: %v", err.Service, err.Err)
+}
+
+// OptionErrors returns the problems found with service
+// options, indexed by service name and then option name.
+// It returns nil if there are none.
+func (err *VerificationError) OptionErrors() map[string]map[string]error {
+	var errs map[string]map[string]error
+	for _, e := range err.Errors {
+		oerr, ok := e.(*BundleOptionError)
+		if !ok {
+			continue
+		}
+		if errs == nil {
+			errs = make(map[string]map[string]error)
+		}
+		if errs[oerr.Service] == nil {
+			errs[oerr.Service] = make(map[string]error)
+		}
+		errs[oerr.Service][oerr.Option] = oerr.Err
+	}
+	return errs
+}
+
 var validServiceRelation = regexp.MustCompile("^(" + names.ServiceSnippet + "):(" + names.RelationSnippet + ")$")
 
 type endpoint struct {
@@ -540,7 +816,7 @@ func parseEndpoint(ep string) (endpoint, error) {
 		}, nil
 	}
 	if !names.IsValidService(ep) {
-		return endpoint{}, fmt.Errorf("invalid relation syntax %q", ep)
+		return endpoint{}, errorCodef(CodeInvalidRelation, "invalid relation syntax %q", ep)
 	}
 	return endpoint{
 		service: ep,
@@ -629,7 +905,7 @@ var validPlacement = regexp.MustCompile(
 func ParsePlacement(p string) (*UnitPlacement, error) {
 	m := validPlacement.FindStringSubmatch(p)
 	if m == nil {
-		return nil, fmt.Errorf("invalid placement syntax %q", p)
+		return nil, errorCodef(CodeInvalidPlacement, "invalid placement syntax %q", p)
 	}
 	up := UnitPlacement{
 		ContainerType: m[1],
@@ -645,7 +921,7 @@ func ParsePlacement(p string) (*UnitPlacement, error) {
 	}
 	if up.Service == "new" {
 		if up.Unit != -1 {
-			return nil, fmt.Errorf("invalid placement syntax %q", p)
+			return nil, errorCodef(CodeInvalidPlacement, "invalid placement syntax %q", p)
 		}
 		up.Machine, up.Service = "new", ""
 	}
@@ -680,7 +956,7 @@ func inferEndpoints(epSpec0, epSpec1 endpoint, get func(svc string) (*Meta, erro
 	}
 	switch len(candidates) {
 	case 0:
-		return endpoint{}, endpoint{}, fmt.Errorf("no relations found")
+		return endpoint{}, endpoint{}, errorCodef(CodeInvalidRelation, "no relations found")
 	case 1:
 		return candidates[0][0].endpoint(), candidates[0][1].endpoint(), nil
 	}
@@ -696,7 +972,7 @@ func inferEndpoints(epSpec0, epSpec1 endpoint, get func(svc string) (*Meta, erro
 		keys = append(keys, fmt.Sprintf("%q", relationKey(cand)))
 	}
 	sort.Strings(keys)
-	return endpoint{}, endpoint{}, fmt.Errorf("ambiguous relation: %s %s could refer to %s",
+	return endpoint{}, endpoint{}, errorCodef(CodeInvalidRelation, "ambiguous relation: %s %s could refer to %s",
 		epSpec0, epSpec1, strings.Join(keys, "; "))
 }
 
@@ -4,6 +4,7 @@
 package charm_test
 
 import (
+	"bytes"
 	"fmt"
 	"sort"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
 
 	"gopkg.in/juju/charm.v5"
 )
@@ -140,6 +142,42 @@ relations:
 			{"mysql:foo", "mediawiki:bar"},
 		},
 	},
+}, {
+	about: "expose settings",
+	data: `
+services:
+    wordpress:
+        charm: wordpress
+        expose: true
+    mysql:
+        charm: mysql
+        exposed-endpoints:
+            "":
+                to-spaces: [alpha]
+            db:
+                to-spaces: [internal, dmz]
+                to-cidrs: ["10.0.0.0/24", "2001:db8::/32"]
+`,
+	expectedBD: &charm.BundleData{
+		Services: map[string]*charm.ServiceSpec{
+			"wordpress": {
+				Charm:  "wordpress",
+				Expose: true,
+			},
+			"mysql": {
+				Charm: "mysql",
+				ExposedEndpoints: map[string]charm.ExposedEndpointSpec{
+					"": {
+						ToSpaces: []string{"alpha"},
+					},
+					"db": {
+						ToSpaces: []string{"internal", "dmz"},
+						ToCIDRs:  []string{"10.0.0.0/24", "2001:db8::/32"},
+					},
+				},
+			},
+		},
+	},
 }}
 
 func (*bundleDataSuite) TestParse(c *gc.C) {
@@ -234,6 +272,90 @@ relations:
 }, {
 	about: "mediawiki should be ok",
 	data:  mediawikiBundle,
+}, {
+	about: "invalid expose settings",
+	data: `
+services:
+    wordpress:
+        charm: wordpress
+        expose: true
+        exposed-endpoints:
+            website:
+                to-cidrs: ["0.0.0.0/0"]
+    mysql:
+        charm: mysql
+        exposed-endpoints:
+            "bad endpoint":
+                to-spaces: [alpha]
+            db:
+                to-spaces: [Bad_Space]
+                to-cidrs: ["10.0.0.0/33", "10.0.0.1"]
+`,
+	errors: []string{
+		`exposed-endpoints cannot be specified together with expose: true in service "wordpress"`,
+		`invalid endpoint name "bad endpoint" in exposed-endpoints of service "mysql"`,
+		`invalid space name "Bad_Space" for exposed endpoint "db" of service "mysql"`,
+		`invalid CIDR "10.0.0.0/33" for exposed endpoint "db" of service "mysql"`,
+		`invalid CIDR "10.0.0.1" for exposed endpoint "db" of service "mysql"`,
+	},
+}, {
+	about: "kubernetes bundle ok",
+	data: `
+bundle: kubernetes
+services:
+    mariadb:
+        charm: cs:~juju/mariadb-k8s
+        scale: 2
+        placement: foo=bar
+    gitlab:
+        charm: cs:~juju/gitlab-k8s
+`,
+}, {
+	about: "kubernetes bundle with machine fields",
+	data: `
+bundle: kubernetes
+machines:
+    0:
+services:
+    mariadb:
+        charm: cs:~juju/mariadb-k8s
+        num_units: 2
+        to: [0]
+    gitlab:
+        charm: cs:~juju/gitlab-k8s
+        scale: -1
+`,
+	errors: []string{
+		`machines cannot be specified in a kubernetes bundle`,
+		`num_units specified on service "mariadb" in a kubernetes bundle; use scale instead`,
+		`to specified on service "mariadb" in a kubernetes bundle; use placement instead`,
+		`negative scale specified on service "gitlab"`,
+		`machine "0" is not referred to by a placement directive`,
+	},
+}, {
+	about: "machine bundle with kubernetes fields",
+	data: `
+services:
+    mysql:
+        charm: mysql
+        scale: 2
+        placement: foo=bar
+`,
+	errors: []string{
+		`scale specified on service "mysql", which is not in a kubernetes bundle; use num_units instead`,
+		`placement specified on service "mysql", which is not in a kubernetes bundle; use to instead`,
+	},
+}, {
+	about: "unknown bundle type",
+	data: `
+bundle: lxd
+services:
+    mysql:
+        charm: mysql
+`,
+	errors: []string{
+		`bundle declares an unknown type "lxd"`,
+	},
 }}
 
 func (*bundleDataSuite) TestVerifyErrors(c *gc.C) {
@@ -272,6 +394,18 @@ func assertVerifyWithCharmsErrors(c *gc.C, bundleData string, charms map[string]
 	c.Assert(errStrings, jc.DeepEquals, expectErrors)
 }
 
+func (*bundleDataSuite) TestDesiredScale(c *gc.C) {
+	c.Assert((&charm.ServiceSpec{NumUnits: 3}).DesiredScale(), gc.Equals, 3)
+	c.Assert((&charm.ServiceSpec{Scale: 2}).DesiredScale(), gc.Equals, 2)
+	c.Assert((&charm.ServiceSpec{}).DesiredScale(), gc.Equals, 0)
+}
+
+func (*bundleDataSuite) TestIsKubernetes(c *gc.C) {
+	c.Assert((&charm.BundleData{}).IsKubernetes(), jc.IsFalse)
+	c.Assert((&charm.BundleData{Type: charm.KubernetesBundle}).IsKubernetes(), jc.IsTrue)
+	c.Assert((&charm.BundleData{Series: charm.KubernetesSeries}).IsKubernetes(), jc.IsTrue)
+}
+
 func (*bundleDataSuite) TestVerifyCharmURL(c *gc.C) {
 	bd, err := charm.ReadBundleData(strings.NewReader(mediawikiBundle))
 	c.Assert(err, gc.IsNil)
@@ -304,6 +438,113 @@ func (*bundleDataSuite) TestVerifyBundleUsingJujuInfoRelation(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 }
 
+func (*bundleDataSuite) TestExposeRoundTrip(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    mysql:
+        charm: mysql
+        exposed-endpoints:
+            db:
+                to-spaces: [internal]
+                to-cidrs: ["10.0.0.0/24"]
+`))
+	c.Assert(err, gc.IsNil)
+	data, err := yaml.Marshal(bd)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, `(?s).*exposed-endpoints:.*`)
+	c.Assert(string(data), gc.Matches, `(?s).*to-cidrs:.*`)
+	bd1, err := charm.ReadBundleData(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd1, jc.DeepEquals, bd)
+}
+
+func (*bundleDataSuite) TestVerifyExposedEndpointsWithCharms(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    wordpress:
+        charm: wordpress
+        exposed-endpoints:
+            web:
+                to-cidrs: ["0.0.0.0/0"]
+            juju-info:
+            nowhere:
+                to-spaces: [alpha]
+`))
+	c.Assert(err, gc.IsNil)
+	err = bd.VerifyWithCharms(nil, map[string]charm.Charm{
+		"wordpress": testCharm("wordpress", "web:http | db:mysql"),
+	})
+	c.Assert(err, gc.ErrorMatches, `charm "wordpress" used by service "wordpress" does not define endpoint "nowhere"`)
+	c.Assert(charm.ErrorCode(err.(*charm.VerificationError).Errors[0]), gc.Equals, charm.CodeInvalidExpose)
+}
+
+func (*bundleDataSuite) TestChannelAndRevision(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    mysql:
+        charm: ch:mysql
+        channel: 8.0/stable
+        revision: 42
+        num_units: 1
+`))
+	c.Assert(err, gc.IsNil)
+	svc := bd.Services["mysql"]
+	c.Assert(svc.Channel, jc.DeepEquals, &charm.Channel{Track: "8.0", Risk: charm.ChannelStable})
+	c.Assert(svc.Revision, gc.NotNil)
+	c.Assert(*svc.Revision, gc.Equals, 42)
+	c.Assert(bd.Verify(nil), gc.IsNil)
+
+	data, err := yaml.Marshal(bd)
+	c.Assert(err, gc.IsNil)
+	bd1, err := charm.ReadBundleData(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd1, jc.DeepEquals, bd)
+}
+
+func (*bundleDataSuite) TestVerifyChannelAndRevision(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    mysql:
+        charm: ch:mysql
+        channel: 8.0/bleeding
+        num_units: 1
+    postgresql:
+        charm: ch:postgresql
+        revision: 3
+        num_units: 1
+    wordpress:
+        charm: ch:wordpress-4
+        channel: stable
+        revision: 5
+        num_units: 1
+    varnish:
+        charm: ch:varnish
+        channel: stable
+        revision: -1
+        num_units: 1
+`))
+	c.Assert(err, gc.IsNil)
+	err = bd.Verify(nil)
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	var messages, codes []string
+	for _, err := range err.(*charm.VerificationError).Errors {
+		messages = append(messages, err.Error())
+		codes = append(codes, charm.ErrorCode(err))
+	}
+	c.Assert(messages, jc.SameContents, []string{
+		`invalid channel "8.0/bleeding" in service "mysql": unknown risk "bleeding"`,
+		`revision specified on service "postgresql" without a channel`,
+		`revision specified on service "wordpress", whose charm URL "ch:wordpress-4" already holds a revision`,
+		`negative revision -1 specified on service "varnish"`,
+	})
+	c.Assert(codes, jc.SameContents, []string{
+		charm.CodeInvalidChannel,
+		charm.CodeBadRevision,
+		charm.CodeBadRevision,
+		charm.CodeBadRevision,
+	})
+}
+
 func (*bundleDataSuite) TestRequiredCharms(c *gc.C) {
 	bd, err := charm.ReadBundleData(strings.NewReader(mediawikiBundle))
 	c.Assert(err, gc.IsNil)
@@ -796,6 +1037,62 @@ var parsePlacementTests = []struct {
 	expectErr: `invalid placement syntax "new/2"`,
 }}
 
+func (*bundleDataSuite) TestVerifyOptionErrors(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    service1:
+        charm: "test"
+        options:
+            title: "some title"
+            skill-level: "too much"
+            unknown-option: 2345
+    service2:
+        charm: "noconfig"
+        options:
+            title: "another title"
+`))
+	c.Assert(err, gc.IsNil)
+	err = bd.VerifyWithCharms(nil, map[string]charm.Charm{
+		"test":     testCharm("test", ""),
+		"noconfig": testCharmImpl{meta: &charm.Meta{Name: "noconfig"}},
+	})
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	for _, e := range err.(*charm.VerificationError).Errors {
+		c.Assert(e, gc.FitsTypeOf, (*charm.BundleOptionError)(nil))
+		c.Assert(charm.ErrorCode(e), gc.Equals, charm.CodeInvalidBundleOption)
+	}
+	optErrs := err.(*charm.VerificationError).OptionErrors()
+	c.Assert(optErrs, gc.HasLen, 2)
+	c.Assert(optErrs["service1"], gc.HasLen, 2)
+	c.Assert(optErrs["service1"]["skill-level"], gc.ErrorMatches, `option "skill-level" expected int, got "too much"`)
+	c.Assert(charm.ErrorCode(optErrs["service1"]["skill-level"]), gc.Equals, charm.CodeInvalidOptionValue)
+	c.Assert(optErrs["service1"]["unknown-option"], gc.ErrorMatches, `configuration option "unknown-option" not found in charm "test"`)
+	c.Assert(optErrs["service2"], gc.HasLen, 1)
+	c.Assert(optErrs["service2"]["title"], gc.ErrorMatches, `configuration option "title" not found in charm "noconfig"`)
+}
+
+func (*bundleDataSuite) TestVerifyOptionUnknownType(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    service1:
+        charm: "test"
+        options:
+            colour: red
+`))
+	c.Assert(err, gc.IsNil)
+	ch := testCharmImpl{
+		meta: &charm.Meta{Name: "test"},
+		config: &charm.Config{
+			Options: map[string]charm.Option{
+				"colour": {Type: "colour"},
+			},
+		},
+	}
+	err = bd.VerifyWithCharms(nil, map[string]charm.Charm{"test": ch})
+	c.Assert(err, gc.ErrorMatches, `cannot validate service "service1": option "colour" has unknown type "colour" in charm "test"`)
+	c.Assert(err.(*charm.VerificationError).OptionErrors()["service1"]["colour"], gc.NotNil)
+}
+
 func (*bundleDataSuite) TestParsePlacement(c *gc.C) {
 	for i, test := range parsePlacementTests {
 		c.Logf("test %d: %q", i, test.placement)
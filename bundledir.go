@@ -9,22 +9,29 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 type BundleDir struct {
 	Path   string
 	data   *BundleData
 	readMe string
+
+	// Warnings holds any warnings produced when reading the
+	// bundle, such as a CodeMissingReadme warning when the
+	// bundle has no README file.
+	Warnings []Warning
 }
 
 // Trick to ensure *BundleDir implements the Bundle interface.
 var _ Bundle = (*BundleDir)(nil)
 
 // ReadBundleDir returns a BundleDir representing an expanded
-// bundle directory. It does not verify the bundle data.
+// bundle directory. It does not verify the bundle data. A missing
+// README file is not an error, but is reported in the Warnings field.
 func ReadBundleDir(path string) (dir *BundleDir, err error) {
 	dir = &BundleDir{Path: path}
-	file, err := os.Open(dir.join("bundle.yaml"))
+	file, err := os.Open(dir.join(BundleFile))
 	if err != nil {
 		return nil, err
 	}
@@ -33,11 +40,20 @@ func ReadBundleDir(path string) (dir *BundleDir, err error) {
 	if err != nil {
 		return nil, err
 	}
-	readMe, err := ioutil.ReadFile(dir.join("README.md"))
-	if err != nil {
+	rc, _, err := dir.Readme()
+	switch {
+	case err == ErrNoReadme:
+		dir.Warnings = append(dir.Warnings, noReadmeWarning())
+	case err != nil:
 		return nil, fmt.Errorf("cannot read README file: %v", err)
+	default:
+		readMe, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read README file: %v", err)
+		}
+		dir.readMe = string(readMe)
 	}
-	dir.readMe = string(readMe)
 	return dir, nil
 }
 
@@ -45,12 +61,73 @@ func (dir *BundleDir) Data() *BundleData {
 	return dir.data
 }
 
+// ReadMe returns the contents of the bundle's README file,
+// or the empty string if it has none.
 func (dir *BundleDir) ReadMe() string {
 	return dir.readMe
 }
 
+// Readme returns the contents of the bundle's README file, along
+// with its name, which may be used to determine its format. The
+// same names are recognized as for charms. It returns ErrNoReadme
+// if the bundle has no README. The returned reader must be closed
+// after use.
+func (dir *BundleDir) Readme() (io.ReadCloser, string, error) {
+	infos, err := ioutil.ReadDir(dir.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			names = append(names, info.Name())
+		}
+	}
+	name := findReadme(names)
+	if name == "" {
+		return nil, "", ErrNoReadme
+	}
+	file, err := os.Open(dir.join(name))
+	if err != nil {
+		return nil, "", err
+	}
+	return file, name, nil
+}
+
+// DocsFiles returns the slash-separated paths, relative to the
+// bundle directory, of the documentation files held in the bundle's
+// docs directory, in alphabetical order. Hidden files are ignored.
+// It returns no paths if the bundle has no docs directory.
+func (dir *BundleDir) DocsFiles() ([]string, error) {
+	var names []string
+	err := filepath.Walk(dir.join(bundleDocsDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir.Path, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); isDocsFile(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 func (dir *BundleDir) ArchiveTo(w io.Writer) error {
-	return writeArchive(w, dir.Path, -1, nil)
+	return writeArchive(w, dir.Path, -1, nil, 0, DefaultFileModePolicy, ArchivePolicy{})
 }
 
 // join builds a path rooted at the bundle's expanded directory
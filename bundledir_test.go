@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 
 	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
 	"gopkg.in/juju/charm.v5"
@@ -31,8 +32,14 @@ func (s *BundleDirSuite) TestReadBundleDirWithoutREADME(c *gc.C) {
 	err := os.Remove(filepath.Join(path, "README.md"))
 	c.Assert(err, gc.IsNil)
 	dir, err := charm.ReadBundleDir(path)
-	c.Assert(err, gc.ErrorMatches, "cannot read README file: .*")
-	c.Assert(dir, gc.IsNil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.ReadMe(), gc.Equals, "")
+	c.Assert(dir.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeMissingReadme,
+		Message: "bundle has no README file; expected one of README.md, README.rst, README.txt",
+	}})
+	_, _, err = dir.Readme()
+	c.Assert(err, gc.Equals, charm.ErrNoReadme)
 }
 
 func (s *BundleDirSuite) TestArchiveTo(c *gc.C) {
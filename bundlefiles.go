@@ -0,0 +1,34 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"path"
+	"strings"
+)
+
+// bundleDocsDir holds the name of the directory holding
+// a bundle's additional documentation.
+const bundleDocsDir = "docs"
+
+// noReadmeWarning returns the warning produced
+// when a bundle has no README file.
+func noReadmeWarning() Warning {
+	return warningf(CodeMissingReadme, "bundle has no README file; expected one of %s", strings.Join(readmeFiles, ", "))
+}
+
+// isDocsFile reports whether the slash-separated path names a
+// documentation file of a bundle: a file within bundleDocsDir
+// that is not hidden and is not within a hidden directory.
+func isDocsFile(name string) bool {
+	if !strings.HasPrefix(name, bundleDocsDir+"/") {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return false
+		}
+	}
+	return path.Clean(name) == name
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type BundleFilesSuite struct{}
+
+var _ = gc.Suite(&BundleFilesSuite{})
+
+// bundleWithDocs returns the path of a copy of the wordpress-simple
+// bundle with its README renamed to README.rst and a docs directory
+// added, along with the path of an archive of it.
+func bundleWithDocs(c *gc.C) (dirPath, archivePath string) {
+	dirPath = TestCharms.ClonedBundleDirPath(c.MkDir(), "wordpress-simple")
+	err := os.Rename(filepath.Join(dirPath, "README.md"), filepath.Join(dirPath, "README.rst"))
+	c.Assert(err, jc.ErrorIsNil)
+	for _, name := range []string{
+		"docs/usage.md",
+		"docs/images/layout.svg",
+		"docs/.hidden",
+		"docs/.cache/notes.md",
+	} {
+		path := filepath.Join(dirPath, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		c.Assert(err, jc.ErrorIsNil)
+		err = ioutil.WriteFile(path, []byte(name), 0644)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	dir, err := charm.ReadBundleDir(dirPath)
+	c.Assert(err, jc.ErrorIsNil)
+	archivePath = filepath.Join(c.MkDir(), "out.bundle")
+	f, err := os.Create(archivePath)
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Close()
+	err = dir.ArchiveTo(f)
+	c.Assert(err, jc.ErrorIsNil)
+	return dirPath, archivePath
+}
+
+// bundleFiles is implemented by both *BundleDir and *BundleArchive.
+type bundleFiles interface {
+	charm.Bundle
+	Readme() (io.ReadCloser, string, error)
+	DocsFiles() ([]string, error)
+}
+
+func (s *BundleFilesSuite) checkBundleFiles(c *gc.C, b bundleFiles, warnings []charm.Warning) {
+	c.Assert(warnings, gc.HasLen, 0)
+	c.Assert(b.ReadMe(), gc.Not(gc.Equals), "")
+
+	rc, name, err := b.Readme()
+	c.Assert(err, jc.ErrorIsNil)
+	defer rc.Close()
+	c.Assert(name, gc.Equals, "README.rst")
+	data, err := ioutil.ReadAll(rc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, b.ReadMe())
+
+	docs, err := b.DocsFiles()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(docs, jc.DeepEquals, []string{"docs/images/layout.svg", "docs/usage.md"})
+}
+
+func (s *BundleFilesSuite) TestBundleDirFiles(c *gc.C) {
+	dirPath, _ := bundleWithDocs(c)
+	dir, err := charm.ReadBundleDir(dirPath)
+	c.Assert(err, jc.ErrorIsNil)
+	s.checkBundleFiles(c, dir, dir.Warnings)
+}
+
+func (s *BundleFilesSuite) TestBundleArchiveFiles(c *gc.C) {
+	_, archivePath := bundleWithDocs(c)
+	archive, err := charm.ReadBundleArchive(archivePath)
+	c.Assert(err, jc.ErrorIsNil)
+	s.checkBundleFiles(c, archive, archive.Warnings)
+}
+
+func (s *BundleFilesSuite) TestDocsFilesWithoutDocs(c *gc.C) {
+	dir, err := charm.ReadBundleDir(TestCharms.BundleDirPath("wordpress-simple"))
+	c.Assert(err, jc.ErrorIsNil)
+	docs, err := dir.DocsFiles()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(docs, gc.HasLen, 0)
+
+	archive, err := charm.ReadBundleArchive(TestCharms.BundleArchivePath(c.MkDir(), "wordpress-simple"))
+	c.Assert(err, jc.ErrorIsNil)
+	docs, err = archive.DocsFiles()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(docs, gc.HasLen, 0)
+}
@@ -0,0 +1,234 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/utils"
+)
+
+// StorageConstraints holds the storage constraints given to a
+// store of a service in a bundle, as parsed by
+// ParseStorageConstraints.
+type StorageConstraints struct {
+	// Pool holds the name of the storage pool,
+	// or the empty string if it is not specified.
+	Pool string
+
+	// Size holds the size of each storage instance in
+	// megabytes, or zero if it is not specified.
+	Size uint64
+
+	// Count holds the number of storage instances,
+	// or zero if it is not specified.
+	Count int
+}
+
+var validStoragePool = regexp.MustCompile(`^[a-zA-Z]+[-?a-zA-Z0-9]*$`)
+
+// ParseStorageConstraints parses storage constraints in the form used
+// by bundles, such as "ebs,10G,2": a comma-separated list of a pool
+// name, which must come first, a size, with an optional M, G, T or P
+// suffix, and a count, all of which are optional. It returns an error
+// with code CodeInvalidStorage if the constraints are malformed.
+func ParseStorageConstraints(s string) (StorageConstraints, error) {
+	var cons StorageConstraints
+	if s == "" {
+		return cons, errorCodef(CodeInvalidStorage, "cannot parse storage constraints %q: no constraints specified", s)
+	}
+	for i, field := range strings.Split(s, ",") {
+		switch {
+		case field == "":
+			return StorageConstraints{}, errorCodef(CodeInvalidStorage, "cannot parse storage constraints %q: empty field", s)
+		case isDigits(field):
+			if cons.Count != 0 {
+				return StorageConstraints{}, errorCodef(CodeInvalidStorage, "cannot parse storage constraints %q: count specified more than once", s)
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 1 {
+				return StorageConstraints{}, errorCodef(CodeInvalidStorage, "cannot parse storage constraints %q: count must be a positive integer", s)
+			}
+			cons.Count = n
+		case constraintSize.MatchString(field):
+			if cons.Size != 0 {
+				return StorageConstraints{}, errorCodef(CodeInvalidStorage, "cannot parse storage constraints %q: size specified more than once", s)
+			}
+			size, err := utils.ParseSize(field)
+			if err != nil || size == 0 {
+				return StorageConstraints{}, errorCodef(CodeInvalidStorage, "cannot parse storage constraints %q: invalid size %q", s, field)
+			}
+			cons.Size = size
+		case i == 0 && validStoragePool.MatchString(field):
+			cons.Pool = field
+		default:
+			return StorageConstraints{}, errorCodef(CodeInvalidStorage, "cannot parse storage constraints %q: unrecognized field %q", s, field)
+		}
+	}
+	return cons, nil
+}
+
+// DeviceConstraints holds the constraints on the devices given to a
+// service in a bundle, as parsed by ParseDeviceConstraints.
+type DeviceConstraints struct {
+	// Count holds the number of devices required.
+	Count int
+
+	// Type holds the type of the devices, such
+	// as "gpu" or "nvidia.com/gpu".
+	Type string
+
+	// Attributes holds any attributes the devices must have,
+	// or nil if there are none.
+	Attributes map[string]string
+}
+
+var validDeviceType = regexp.MustCompile(`^[a-z0-9]+(?:[-.][a-z0-9]+)*(?:/[a-z0-9]+(?:[-.][a-z0-9]+)*)?$`)
+
+// ParseDeviceConstraints parses device constraints in the form used
+// by bundles, such as "2,nvidia.com/gpu,gpu=nvidia-tesla-p100": an
+// optional count, which defaults to 1, the type of the devices and
+// optional attributes, as a semicolon-separated list of key=value
+// pairs. It returns an error with code CodeInvalidDevice if the
+// constraints are malformed.
+func ParseDeviceConstraints(s string) (DeviceConstraints, error) {
+	cons := DeviceConstraints{Count: 1}
+	fields := strings.Split(s, ",")
+	if len(fields) > 0 && isDigits(fields[0]) {
+		n, err := strconv.Atoi(fields[0])
+		if err != nil || n < 1 {
+			return DeviceConstraints{}, errorCodef(CodeInvalidDevice, "cannot parse device constraints %q: count must be a positive integer", s)
+		}
+		cons.Count = n
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || fields[0] == "" {
+		return DeviceConstraints{}, errorCodef(CodeInvalidDevice, "cannot parse device constraints %q: no device type specified", s)
+	}
+	if len(fields) > 2 {
+		return DeviceConstraints{}, errorCodef(CodeInvalidDevice, "cannot parse device constraints %q: too many fields", s)
+	}
+	if !validDeviceType.MatchString(fields[0]) {
+		return DeviceConstraints{}, errorCodef(CodeInvalidDevice, "cannot parse device constraints %q: invalid device type %q", s, fields[0])
+	}
+	cons.Type = fields[0]
+	if len(fields) == 2 {
+		cons.Attributes = make(map[string]string)
+		for _, attr := range strings.Split(fields[1], ";") {
+			kv := strings.SplitN(attr, "=", 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				return DeviceConstraints{}, errorCodef(CodeInvalidDevice, "cannot parse device constraints %q: attribute %q is not of the form key=value", s, attr)
+			}
+			if _, ok := cons.Attributes[kv[0]]; ok {
+				return DeviceConstraints{}, errorCodef(CodeInvalidDevice, "cannot parse device constraints %q: attribute %q specified more than once", s, kv[0])
+			}
+			cons.Attributes[kv[0]] = kv[1]
+		}
+	}
+	return cons, nil
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// BundleResource returns the revision or the path held in the given
+// value of the Resources field of a ServiceSpec. Exactly one of the
+// returned revision and path is valid: the revision is -1 when the
+// value holds a path. It returns an error with code
+// CodeInvalidResource if the value holds neither a non-negative
+// revision number nor a path.
+func BundleResource(value interface{}) (revision int, path string, err error) {
+	switch value := value.(type) {
+	case int:
+		if value >= 0 {
+			return value, "", nil
+		}
+	case int64:
+		if value >= 0 && value <= math.MaxInt32 {
+			return int(value), "", nil
+		}
+	case float64:
+		if value >= 0 && value <= math.MaxInt32 && value == math.Trunc(value) {
+			return int(value), "", nil
+		}
+	case string:
+		if value != "" {
+			return -1, value, nil
+		}
+	}
+	return 0, "", errorCodef(CodeInvalidResource, "expected revision number or path, got %s", resourceValueString(value))
+}
+
+func resourceValueString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
+
+// verifyOverrides verifies the storage, devices and resources of the
+// given service, against the metadata of its charm if available.
+func (verifier *bundleDataVerifier) verifyOverrides(svcName string, svc *ServiceSpec) {
+	var meta *Meta
+	if ch := verifier.charms[svc.Charm]; ch != nil {
+		meta = ch.Meta()
+	}
+	for name, s := range svc.Storage {
+		cons, err := ParseStorageConstraints(s)
+		if err != nil {
+			verifier.addErrorf(CodeInvalidStorage, "invalid storage %q in service %q: %v", name, svcName, err)
+			continue
+		}
+		if meta == nil {
+			continue
+		}
+		store, ok := meta.Storage[name]
+		if !ok {
+			verifier.addErrorf(CodeInvalidStorage, "charm %q used by service %q does not define storage %q", svc.Charm, svcName, name)
+			continue
+		}
+		if cons.Count != 0 {
+			if cons.Count < store.CountMin {
+				verifier.addErrorf(CodeInvalidStorage, "storage %q in service %q requires at least %d instance(s), not %d", name, svcName, store.CountMin, cons.Count)
+			}
+			if store.CountMax != -1 && cons.Count > store.CountMax {
+				verifier.addErrorf(CodeInvalidStorage, "storage %q in service %q allows at most %d instance(s), not %d", name, svcName, store.CountMax, cons.Count)
+			}
+		}
+		if cons.Size != 0 && cons.Size < store.MinimumSize {
+			verifier.addErrorf(CodeInvalidStorage, "storage %q in service %q requires at least %dM, not %dM", name, svcName, store.MinimumSize, cons.Size)
+		}
+	}
+	for name, s := range svc.Devices {
+		if _, err := ParseDeviceConstraints(s); err != nil {
+			verifier.addErrorf(CodeInvalidDevice, "invalid device %q in service %q: %v", name, svcName, err)
+		}
+	}
+	for name, value := range svc.Resources {
+		if _, _, err := BundleResource(value); err != nil {
+			verifier.addErrorf(CodeInvalidResource, "invalid resource %q in service %q: %v", name, svcName, err)
+			continue
+		}
+		if meta == nil {
+			continue
+		}
+		if _, ok := meta.Resources[name]; !ok {
+			verifier.addErrorf(CodeInvalidResource, "charm %q used by service %q does not define resource %q", svc.Charm, svcName, name)
+		}
+	}
+}
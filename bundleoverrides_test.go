@@ -0,0 +1,208 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type bundleOverridesSuite struct{}
+
+var _ = gc.Suite(&bundleOverridesSuite{})
+
+var parseStorageConstraintsTests = []struct {
+	s         string
+	expect    charm.StorageConstraints
+	expectErr string
+}{{
+	s:      "ebs,10G,2",
+	expect: charm.StorageConstraints{Pool: "ebs", Size: 10 * 1024, Count: 2},
+}, {
+	s:      "ebs",
+	expect: charm.StorageConstraints{Pool: "ebs"},
+}, {
+	s:      "3,512M",
+	expect: charm.StorageConstraints{Size: 512, Count: 3},
+}, {
+	s:         "",
+	expectErr: `cannot parse storage constraints "": no constraints specified`,
+}, {
+	s:         "ebs,,2",
+	expectErr: `cannot parse storage constraints "ebs,,2": empty field`,
+}, {
+	s:         "ebs,2,3",
+	expectErr: `cannot parse storage constraints "ebs,2,3": count specified more than once`,
+}, {
+	s:         "0",
+	expectErr: `cannot parse storage constraints "0": count must be a positive integer`,
+}, {
+	s:         "10G,ebs",
+	expectErr: `cannot parse storage constraints "10G,ebs": unrecognized field "ebs"`,
+}}
+
+func (*bundleOverridesSuite) TestParseStorageConstraints(c *gc.C) {
+	for i, test := range parseStorageConstraintsTests {
+		c.Logf("test %d: %q", i, test.s)
+		cons, err := charm.ParseStorageConstraints(test.s)
+		if test.expectErr != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectErr)
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidStorage)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(cons, jc.DeepEquals, test.expect)
+	}
+}
+
+var parseDeviceConstraintsTests = []struct {
+	s         string
+	expect    charm.DeviceConstraints
+	expectErr string
+}{{
+	s:      "nvidia.com/gpu",
+	expect: charm.DeviceConstraints{Count: 1, Type: "nvidia.com/gpu"},
+}, {
+	s: "2,nvidia.com/gpu,gpu=nvidia-tesla-p100;arch=x86",
+	expect: charm.DeviceConstraints{
+		Count: 2,
+		Type:  "nvidia.com/gpu",
+		Attributes: map[string]string{
+			"gpu":  "nvidia-tesla-p100",
+			"arch": "x86",
+		},
+	},
+}, {
+	s:         "2",
+	expectErr: `cannot parse device constraints "2": no device type specified`,
+}, {
+	s:         "0,gpu",
+	expectErr: `cannot parse device constraints "0,gpu": count must be a positive integer`,
+}, {
+	s:         "GPU!",
+	expectErr: `cannot parse device constraints "GPU!": invalid device type "GPU!"`,
+}, {
+	s:         "gpu,a=b,c=d",
+	expectErr: `cannot parse device constraints "gpu,a=b,c=d": too many fields`,
+}, {
+	s:         "gpu,a",
+	expectErr: `cannot parse device constraints "gpu,a": attribute "a" is not of the form key=value`,
+}, {
+	s:         "gpu,a=b;a=c",
+	expectErr: `cannot parse device constraints "gpu,a=b;a=c": attribute "a" specified more than once`,
+}}
+
+func (*bundleOverridesSuite) TestParseDeviceConstraints(c *gc.C) {
+	for i, test := range parseDeviceConstraintsTests {
+		c.Logf("test %d: %q", i, test.s)
+		cons, err := charm.ParseDeviceConstraints(test.s)
+		if test.expectErr != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectErr)
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidDevice)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(cons, jc.DeepEquals, test.expect)
+	}
+}
+
+func (*bundleOverridesSuite) TestBundleResource(c *gc.C) {
+	rev, path, err := charm.BundleResource(3)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 3)
+	c.Assert(path, gc.Equals, "")
+
+	rev, path, err = charm.BundleResource("./data.tgz")
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, -1)
+	c.Assert(path, gc.Equals, "./data.tgz")
+
+	_, _, err = charm.BundleResource(-1)
+	c.Assert(err, gc.ErrorMatches, `expected revision number or path, got -1`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidResource)
+
+	_, _, err = charm.BundleResource("")
+	c.Assert(err, gc.ErrorMatches, `expected revision number or path, got ""`)
+}
+
+func (*bundleOverridesSuite) TestVerifyOverrides(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    mysql:
+        charm: mysql
+        num_units: 1
+        storage:
+            data: ebs,10G,2
+        devices:
+            gpu: 2,nvidia.com/gpu
+        resources:
+            image: 4
+            config: ./config.tgz
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd.Services["mysql"].Storage, jc.DeepEquals, map[string]string{"data": "ebs,10G,2"})
+	c.Assert(bd.Services["mysql"].Devices, jc.DeepEquals, map[string]string{"gpu": "2,nvidia.com/gpu"})
+	c.Assert(bd.Services["mysql"].Resources, jc.DeepEquals, map[string]interface{}{
+		"image":  4,
+		"config": "./config.tgz",
+	})
+	err = bd.Verify(nil)
+	c.Assert(err, gc.IsNil)
+}
+
+func (*bundleOverridesSuite) TestVerifyOverridesErrors(c *gc.C) {
+	assertVerifyWithCharmsErrors(c, `
+services:
+    mysql:
+        charm: mysql
+        num_units: 1
+        storage:
+            data: ebs,,2
+        devices:
+            gpu: "0,gpu"
+        resources:
+            image: -2
+`, nil, []string{
+		`invalid storage "data" in service "mysql": cannot parse storage constraints "ebs,,2": empty field`,
+		`invalid device "gpu" in service "mysql": cannot parse device constraints "0,gpu": count must be a positive integer`,
+		`invalid resource "image" in service "mysql": expected revision number or path, got -2`,
+	})
+}
+
+func (*bundleOverridesSuite) TestVerifyOverridesWithCharms(c *gc.C) {
+	ch := testCharm("mysql", "db:mysql").(testCharmImpl)
+	ch.meta.Storage = map[string]charm.Storage{
+		"data": {
+			Name:        "data",
+			Type:        charm.StorageFilesystem,
+			CountMin:    1,
+			CountMax:    2,
+			MinimumSize: 1024,
+		},
+	}
+	ch.meta.Resources = map[string]charm.Resource{
+		"image": {Name: "image", Type: charm.ResourceTypeFile, Filename: "image.tgz"},
+	}
+	assertVerifyWithCharmsErrors(c, `
+services:
+    mysql:
+        charm: mysql
+        num_units: 1
+        storage:
+            data: ebs,512M,3
+            logs: ebs
+        resources:
+            image: 4
+            other: 1
+`, map[string]charm.Charm{"mysql": ch}, []string{
+		`storage "data" in service "mysql" allows at most 2 instance(s), not 3`,
+		`storage "data" in service "mysql" requires at least 1024M, not 512M`,
+		`charm "mysql" used by service "mysql" does not define storage "logs"`,
+		`charm "mysql" used by service "mysql" does not define resource "other"`,
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sort"
+	"strings"
+)
+
+// NormalizeRelations rewrites the relations in the bundle into a
+// canonical form, so that bundles that define the same relations
+// differently compare equal. In the canonical form:
+//
+//   - each relation is a pair of "service:relation" endpoints, even
+//     when it was written as a single space-separated string;
+//   - the endpoints of each relation are in lexical order;
+//   - the relations themselves are in lexical order.
+//
+// If charms is not nil, it should hold an entry for each charm URL
+// returned by bd.RequiredCharms; relation names left out of endpoints
+// are then inferred from the charm metadata. Endpoints whose relation
+// names cannot be inferred are left as they are.
+//
+// If any relation is malformed, refers to a service not defined in
+// the bundle, relates a service to itself or duplicates another
+// relation, NormalizeRelations leaves the bundle unchanged and returns
+// a *VerificationError describing all the problems found.
+func (bd *BundleData) NormalizeRelations(charms map[string]Charm) error {
+	verifier := &bundleDataVerifier{
+		bd:     bd,
+		charms: charms,
+	}
+	seen := make(map[[2]endpoint]bool)
+	var pairs [][2]endpoint
+	for _, relPair := range bd.Relations {
+		if len(relPair) == 1 {
+			relPair = strings.Fields(relPair[0])
+		}
+		if len(relPair) != 2 {
+			verifier.addErrorf(CodeInvalidRelation, "relation %q has %d endpoint(s), not 2", relPair, len(relPair))
+			continue
+		}
+		var epPair [2]endpoint
+		ok := true
+		for i, svcRel := range relPair {
+			ep, err := parseEndpoint(svcRel)
+			if err != nil {
+				verifier.addError(err)
+				ok = false
+				continue
+			}
+			if _, found := bd.Services[ep.service]; !found {
+				verifier.addErrorf(CodeInvalidRelation, "relation %q refers to service %q not defined in this bundle", relPair, ep.service)
+				ok = false
+			}
+			epPair[i] = ep
+		}
+		if !ok {
+			continue
+		}
+		if epPair[0].service == epPair[1].service {
+			verifier.addErrorf(CodeInvalidRelation, "relation %q relates a service to itself", relPair)
+			continue
+		}
+		if (epPair[0].relation == "" || epPair[1].relation == "") && verifier.haveCharms(epPair[0].service, epPair[1].service) {
+			iep0, iep1, err := inferEndpoints(epPair[0], epPair[1], verifier.getCharmMetaForService)
+			if err != nil {
+				verifier.addErrorf(CodeInvalidRelation, "cannot infer endpoint between %s and %s: %v", epPair[0], epPair[1], err)
+				continue
+			}
+			epPair[0], epPair[1] = iep0, iep1
+		}
+		if epPair[1].less(epPair[0]) {
+			epPair[1], epPair[0] = epPair[0], epPair[1]
+		}
+		if seen[epPair] {
+			verifier.addErrorf(CodeInvalidRelation, "relation %q is defined more than once", relPair)
+			continue
+		}
+		seen[epPair] = true
+		pairs = append(pairs, epPair)
+	}
+	if err := verifier.err(); err != nil {
+		return err
+	}
+	sort.Sort(endpointPairs(pairs))
+	relations := make([][]string, len(pairs))
+	for i, pair := range pairs {
+		relations[i] = []string{pair[0].String(), pair[1].String()}
+	}
+	bd.Relations = relations
+	return nil
+}
+
+// haveCharms reports whether the charms used by all the
+// given services are available to the verifier.
+func (verifier *bundleDataVerifier) haveCharms(svcNames ...string) bool {
+	if verifier.charms == nil {
+		return false
+	}
+	for _, name := range svcNames {
+		if verifier.charms[verifier.bd.Services[name].Charm] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+type endpointPairs [][2]endpoint
+
+func (p endpointPairs) Len() int      { return len(p) }
+func (p endpointPairs) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p endpointPairs) Less(i, j int) bool {
+	if p[i][0] != p[j][0] {
+		return p[i][0].less(p[j][0])
+	}
+	return p[i][1].less(p[j][1])
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type bundleRelationsSuite struct{}
+
+var _ = gc.Suite(&bundleRelationsSuite{})
+
+const normalizeRelationsBundle = `
+services:
+    wordpress:
+        charm: wordpress
+    mysql:
+        charm: mysql
+    logging:
+        charm: logging
+`
+
+var normalizeRelationsCharms = map[string]charm.Charm{
+	"wordpress": testCharm("wordpress", "web:http | db:mysql"),
+	"mysql":     testCharm("mysql", "server:mysql | "),
+	"logging":   testCharm("logging", " | logging-directory:logging juju-info:juju-info"),
+}
+
+var normalizeRelationsTests = []struct {
+	about     string
+	relations [][]string
+	charms    map[string]charm.Charm
+	expect    [][]string
+	errors    []string
+}{{
+	about: "already normal",
+	relations: [][]string{
+		{"mysql:server", "wordpress:db"},
+	},
+	expect: [][]string{
+		{"mysql:server", "wordpress:db"},
+	},
+}, {
+	about: "reversed endpoints and relations are sorted",
+	relations: [][]string{
+		{"wordpress:juju-info", "logging:juju-info"},
+		{"wordpress:db", "mysql:server"},
+	},
+	expect: [][]string{
+		{"logging:juju-info", "wordpress:juju-info"},
+		{"mysql:server", "wordpress:db"},
+	},
+}, {
+	about: "space separated relation",
+	relations: [][]string{
+		{"wordpress:db mysql:server"},
+	},
+	expect: [][]string{
+		{"mysql:server", "wordpress:db"},
+	},
+}, {
+	about: "unnamed endpoints without charms are kept",
+	relations: [][]string{
+		{"wordpress", "mysql"},
+	},
+	expect: [][]string{
+		{"mysql", "wordpress"},
+	},
+}, {
+	about: "unnamed endpoints are inferred from charms",
+	relations: [][]string{
+		{"wordpress", "mysql"},
+		{"logging", "wordpress"},
+	},
+	charms: normalizeRelationsCharms,
+	expect: [][]string{
+		{"logging:juju-info", "wordpress:juju-info"},
+		{"mysql:server", "wordpress:db"},
+	},
+}, {
+	about: "duplicate relations",
+	relations: [][]string{
+		{"wordpress:db", "mysql:server"},
+		{"mysql:server", "wordpress:db"},
+	},
+	errors: []string{
+		`relation \["mysql:server" "wordpress:db"\] is defined more than once`,
+	},
+}, {
+	about: "duplicate relation found by inference",
+	relations: [][]string{
+		{"wordpress:db", "mysql:server"},
+		{"mysql", "wordpress"},
+	},
+	charms: normalizeRelationsCharms,
+	errors: []string{
+		`relation \["mysql" "wordpress"\] is defined more than once`,
+	},
+}, {
+	about: "invalid relations",
+	relations: [][]string{
+		{"wordpress:db", "wordpress:web"},
+		{"wordpress:db", "haproxy:reverseproxy"},
+		{"wordpress:db"},
+		{"wordpress:web", "mysql"},
+	},
+	charms: normalizeRelationsCharms,
+	errors: []string{
+		`relation \["wordpress:db" "wordpress:web"\] relates a service to itself`,
+		`relation \["wordpress:db" "haproxy:reverseproxy"\] refers to service "haproxy" not defined in this bundle`,
+		`relation \["wordpress:db"\] has 1 endpoint\(s\), not 2`,
+		`cannot infer endpoint between wordpress:web and mysql: no relations found`,
+	},
+}}
+
+func (*bundleRelationsSuite) TestNormalizeRelations(c *gc.C) {
+	for i, test := range normalizeRelationsTests {
+		c.Logf("test %d: %s", i, test.about)
+		bd, err := charm.ReadBundleData(strings.NewReader(normalizeRelationsBundle))
+		c.Assert(err, gc.IsNil)
+		bd.Relations = test.relations
+		err = bd.NormalizeRelations(test.charms)
+		if len(test.errors) == 0 {
+			c.Assert(err, gc.IsNil)
+			c.Assert(bd.Relations, jc.DeepEquals, test.expect)
+			continue
+		}
+		c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+		errs := err.(*charm.VerificationError).Errors
+		c.Assert(errs, gc.HasLen, len(test.errors))
+		for j, e := range errs {
+			c.Check(e, gc.ErrorMatches, test.errors[j])
+		}
+		// The bundle is left unchanged.
+		c.Assert(bd.Relations, jc.DeepEquals, test.relations)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Risk describes the stability of the revisions of a charm
+// published to a channel.
+type Risk string
+
+const (
+	ChannelStable    Risk = "stable"
+	ChannelCandidate Risk = "candidate"
+	ChannelBeta      Risk = "beta"
+	ChannelEdge      Risk = "edge"
+)
+
+// Risks holds all the valid risks, from the most to the least stable.
+var Risks = []Risk{ChannelStable, ChannelCandidate, ChannelBeta, ChannelEdge}
+
+func isRisk(s string) bool {
+	for _, risk := range Risks {
+		if string(risk) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultTrack holds the track that channels
+// without an explicit track refer to.
+const DefaultTrack = "latest"
+
+// validChannelPart matches the track and branch of a channel.
+var validChannelPart = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9._-]*[a-zA-Z0-9])?$`)
+
+// Channel identifies a channel from which charms are published, in
+// the form "[track/]risk[/branch]", such as "stable", "latest/edge"
+// or "8.0/candidate/hotfix". A channel holding only a track, such as
+// "8.0", refers to the stable risk of that track.
+type Channel struct {
+	// Track holds the track of the channel, such as "8.0",
+	// or the empty string if it is not specified.
+	Track string
+
+	// Risk holds the risk of the channel, or the empty
+	// string if only a track is specified.
+	Risk Risk
+
+	// Branch holds the branch of the channel, such as "hotfix",
+	// or the empty string if there is none.
+	Branch string
+}
+
+// ParseChannel parses the given channel string. The returned
+// channel is not normalized; see Channel.Normalize.
+func ParseChannel(s string) (Channel, error) {
+	ch, err := splitChannel(s)
+	if err != nil {
+		return Channel{}, err
+	}
+	if err := ch.Validate(); err != nil {
+		return Channel{}, errorCodef(CodeInvalidChannel, "invalid channel %q: %v", s, err)
+	}
+	return ch, nil
+}
+
+// splitChannel splits the given channel string into its components,
+// without validating them.
+func splitChannel(s string) (Channel, error) {
+	if s == "" {
+		return Channel{}, errorCodef(CodeInvalidChannel, "empty channel")
+	}
+	parts := strings.Split(s, "/")
+	for _, part := range parts {
+		if part == "" {
+			return Channel{}, errorCodef(CodeInvalidChannel, "channel %q has an empty component", s)
+		}
+	}
+	var ch Channel
+	switch len(parts) {
+	case 1:
+		if isRisk(parts[0]) {
+			ch.Risk = Risk(parts[0])
+		} else {
+			ch.Track = parts[0]
+		}
+	case 2:
+		if isRisk(parts[0]) {
+			ch.Risk, ch.Branch = Risk(parts[0]), parts[1]
+		} else {
+			ch.Track, ch.Risk = parts[0], Risk(parts[1])
+		}
+	case 3:
+		ch.Track, ch.Risk, ch.Branch = parts[0], Risk(parts[1]), parts[2]
+	default:
+		return Channel{}, errorCodef(CodeInvalidChannel, "channel %q has too many components", s)
+	}
+	return ch, nil
+}
+
+// MustParseChannel works like ParseChannel, but panics in case of errors.
+func MustParseChannel(s string) Channel {
+	ch, err := ParseChannel(s)
+	if err != nil {
+		panic(err)
+	}
+	return ch
+}
+
+// Validate checks that the channel is well formed: its risk, if
+// any, must be one of Risks, and its track and branch must be
+// made of letters, digits, dots, underscores and hyphens. A channel
+// must have a risk or a track, and may only have a branch if it
+// has a risk.
+func (ch Channel) Validate() error {
+	if ch.Risk == "" && ch.Track == "" {
+		return errorCodef(CodeInvalidChannel, "channel has neither track nor risk")
+	}
+	if ch.Risk != "" && !isRisk(string(ch.Risk)) {
+		return errorCodef(CodeInvalidChannel, "unknown risk %q", ch.Risk)
+	}
+	if ch.Track != "" && !validChannelPart.MatchString(ch.Track) {
+		return errorCodef(CodeInvalidChannel, "invalid track %q", ch.Track)
+	}
+	if ch.Branch != "" {
+		if ch.Risk == "" {
+			return errorCodef(CodeInvalidChannel, "branch %q specified without a risk", ch.Branch)
+		}
+		if !validChannelPart.MatchString(ch.Branch) {
+			return errorCodef(CodeInvalidChannel, "invalid branch %q", ch.Branch)
+		}
+	}
+	return nil
+}
+
+// Normalize returns the channel in its canonical form, in which the
+// default track is left out and the risk is always specified, so that
+// channels that refer to the same revisions compare equal. For
+// example, both "latest/stable" and "latest" normalize to "stable".
+func (ch Channel) Normalize() Channel {
+	if ch.Track == DefaultTrack {
+		ch.Track = ""
+	}
+	if ch.Risk == "" {
+		ch.Risk = ChannelStable
+	}
+	return ch
+}
+
+// String returns the channel in the form accepted by ParseChannel.
+func (ch Channel) String() string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{ch.Track, string(ch.Risk), ch.Branch} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// MarshalText implements encoding.TextMarshaler,
+// so that channels are encoded as strings in JSON.
+func (ch Channel) MarshalText() ([]byte, error) {
+	return []byte(ch.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. As with
+// the other unmarshaling methods, the components of the channel
+// are not validated, so that problems can be reported when the
+// containing document is verified; see Validate.
+func (ch *Channel) UnmarshalText(data []byte) error {
+	c, err := splitChannel(string(data))
+	if err != nil {
+		return err
+	}
+	*ch = c
+	return nil
+}
+
+// GetYAML implements yaml.Getter.GetYAML.
+func (ch Channel) GetYAML() (tag string, value interface{}) {
+	return "", ch.String()
+}
+
+// SetYAML implements yaml.Setter.SetYAML.
+func (ch *Channel) SetYAML(tag string, value interface{}) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	return ch.UnmarshalText([]byte(s)) == nil
+}
+
+// GetBSON turns ch into a bson.Getter so it can be saved directly
+// on a MongoDB database with mgo.
+func (ch Channel) GetBSON() (interface{}, error) {
+	return ch.String(), nil
+}
+
+// SetBSON turns ch into a bson.Setter so it can be loaded directly
+// from a MongoDB database with mgo.
+func (ch *Channel) SetBSON(raw bson.Raw) error {
+	var s string
+	if err := raw.Unmarshal(&s); err != nil {
+		return err
+	}
+	return ch.UnmarshalText([]byte(s))
+}
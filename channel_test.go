@@ -0,0 +1,142 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ChannelSuite struct{}
+
+var _ = gc.Suite(&ChannelSuite{})
+
+var parseChannelTests = []struct {
+	channel   string
+	expect    charm.Channel
+	normalize string
+	err       string
+}{{
+	channel:   "stable",
+	expect:    charm.Channel{Risk: charm.ChannelStable},
+	normalize: "stable",
+}, {
+	channel:   "latest/stable",
+	expect:    charm.Channel{Track: "latest", Risk: charm.ChannelStable},
+	normalize: "stable",
+}, {
+	channel:   "latest",
+	expect:    charm.Channel{Track: "latest"},
+	normalize: "stable",
+}, {
+	channel:   "8.0",
+	expect:    charm.Channel{Track: "8.0"},
+	normalize: "8.0/stable",
+}, {
+	channel:   "edge/hotfix",
+	expect:    charm.Channel{Risk: charm.ChannelEdge, Branch: "hotfix"},
+	normalize: "edge/hotfix",
+}, {
+	channel:   "8.0/edge/hotfix",
+	expect:    charm.Channel{Track: "8.0", Risk: charm.ChannelEdge, Branch: "hotfix"},
+	normalize: "8.0/edge/hotfix",
+}, {
+	channel: "",
+	err:     `empty channel`,
+}, {
+	channel: "8.0//hotfix",
+	err:     `channel "8.0//hotfix" has an empty component`,
+}, {
+	channel: "8.0/bleeding",
+	err:     `invalid channel "8.0/bleeding": unknown risk "bleeding"`,
+}, {
+	channel: "8.0/edge/hot fix",
+	err:     `invalid channel "8.0/edge/hot fix": invalid branch "hot fix"`,
+}, {
+	channel: "a/stable/b/c",
+	err:     `channel "a/stable/b/c" has too many components`,
+}}
+
+func (s *ChannelSuite) TestParseChannel(c *gc.C) {
+	for i, test := range parseChannelTests {
+		c.Logf("test %d: %q", i, test.channel)
+		ch, err := charm.ParseChannel(test.channel)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidChannel)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(ch, gc.Equals, test.expect)
+		c.Assert(ch.String(), gc.Equals, test.channel)
+		c.Assert(ch.Normalize().String(), gc.Equals, test.normalize)
+	}
+}
+
+func (s *ChannelSuite) TestValidate(c *gc.C) {
+	err := charm.Channel{}.Validate()
+	c.Assert(err, gc.ErrorMatches, `channel has neither track nor risk`)
+	err = charm.Channel{Track: "8.0", Branch: "hotfix"}.Validate()
+	c.Assert(err, gc.ErrorMatches, `branch "hotfix" specified without a risk`)
+	err = charm.Channel{Track: "8.0", Risk: charm.ChannelBeta}.Validate()
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ChannelSuite) TestMustParseChannel(c *gc.C) {
+	c.Assert(charm.MustParseChannel("2.0/candidate"), gc.Equals, charm.Channel{Track: "2.0", Risk: charm.ChannelCandidate})
+	c.Assert(func() { charm.MustParseChannel("/") }, gc.PanicMatches, `channel "/" has an empty component`)
+}
+
+type channelDoc struct {
+	Channel *charm.Channel `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+}
+
+var channelMarshalers = []struct {
+	name      string
+	marshal   func(interface{}) ([]byte, error)
+	unmarshal func([]byte, interface{}) error
+}{
+	{"json", json.Marshal, json.Unmarshal},
+	{"yaml", yaml.Marshal, yaml.Unmarshal},
+	{"bson", bson.Marshal, bson.Unmarshal},
+}
+
+func (s *ChannelSuite) TestMarshal(c *gc.C) {
+	for _, m := range channelMarshalers {
+		c.Logf("%s", m.name)
+		doc := channelDoc{Channel: &charm.Channel{Track: "8.0", Risk: charm.ChannelEdge, Branch: "hotfix"}}
+		data, err := m.marshal(doc)
+		c.Assert(err, gc.IsNil)
+		if m.name != "bson" {
+			c.Assert(string(data), jc.Contains, "8.0/edge/hotfix")
+		}
+		var doc1 channelDoc
+		err = m.unmarshal(data, &doc1)
+		c.Assert(err, gc.IsNil)
+		c.Assert(doc1, jc.DeepEquals, doc)
+
+		// Channels are not validated when unmarshaled.
+		doc = channelDoc{Channel: &charm.Channel{Track: "8.0", Risk: "bleeding"}}
+		data, err = m.marshal(doc)
+		c.Assert(err, gc.IsNil)
+		doc1 = channelDoc{}
+		err = m.unmarshal(data, &doc1)
+		c.Assert(err, gc.IsNil)
+		c.Assert(doc1, jc.DeepEquals, doc)
+
+		// Channels that are omitted stay nil.
+		data, err = m.marshal(channelDoc{})
+		c.Assert(err, gc.IsNil)
+		doc1 = channelDoc{}
+		err = m.unmarshal(data, &doc1)
+		c.Assert(err, gc.IsNil)
+		c.Assert(doc1.Channel, gc.IsNil)
+	}
+}
@@ -60,7 +60,7 @@ func checkDummy(c *gc.C, f charm.Charm, path string) {
 	c.Assert(f.Config().Options["title"].Default, gc.Equals, "My Title")
 	c.Assert(f.Actions(), jc.DeepEquals,
 		&charm.Actions{
-			map[string]charm.ActionSpec{
+			ActionSpecs: map[string]charm.ActionSpec{
 				"snapshot": charm.ActionSpec{
 					Description: "Take a snapshot of the database.",
 					Params: map[string]interface{}{
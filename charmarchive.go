@@ -6,13 +6,16 @@ package charm
 import (
 	"archive/zip"
 	"bytes"
-	"errors"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/juju/utils/set"
 	ziputil "github.com/juju/utils/zip"
@@ -28,7 +31,18 @@ type CharmArchive struct {
 	config   *Config
 	metrics  *Metrics
 	actions  *Actions
+	manifest *Manifest
 	revision int
+	size     int64
+	comment  string
+
+	// modePolicy holds the policy set by SetFileModePolicy,
+	// or nil if the default policy applies.
+	modePolicy *FileModePolicy
+
+	// mu guards sha256, which is calculated on demand.
+	mu     sync.Mutex
+	sha256 string
 }
 
 // Trick to ensure *CharmArchive implements the Charm interface.
@@ -36,8 +50,15 @@ var _ Charm = (*CharmArchive)(nil)
 
 // ReadCharmArchive returns a CharmArchive for the charm in path.
 func ReadCharmArchive(path string) (*CharmArchive, error) {
-	a, err := readCharmArchive(newZipOpenerFromPath(path))
+	return readCharmArchiveFile(path, ReadMetaOptions{})
+}
+
+// readCharmArchiveFile is like ReadCharmArchive, but it reads the
+// charm metadata with the given options.
+func readCharmArchiveFile(path string, opts ReadMetaOptions) (*CharmArchive, error) {
+	a, err := readCharmArchive(newZipOpenerFromPath(path), opts)
 	if err != nil {
+		setArchiveErrorPath(err, path)
 		return nil, err
 	}
 	a.Path = path
@@ -48,7 +69,7 @@ func ReadCharmArchive(path string) (*CharmArchive, error) {
 // Make sure the archive fits in memory before using this.
 func ReadCharmArchiveBytes(data []byte) (archive *CharmArchive, err error) {
 	zopener := newZipOpenerFromReader(bytes.NewReader(data), int64(len(data)))
-	return readCharmArchive(zopener)
+	return readCharmArchive(zopener, ReadMetaOptions{})
 }
 
 // ReadCharmArchiveFromReader returns a CharmArchive that uses
@@ -58,29 +79,48 @@ func ReadCharmArchiveBytes(data []byte) (archive *CharmArchive, err error) {
 // Note that the caller is responsible for closing r - methods on
 // the returned CharmArchive may fail after that.
 func ReadCharmArchiveFromReader(r io.ReaderAt, size int64) (archive *CharmArchive, err error) {
-	return readCharmArchive(newZipOpenerFromReader(r, size))
+	return readCharmArchive(newZipOpenerFromReader(r, size), ReadMetaOptions{})
 }
 
-func readCharmArchive(zopen zipOpener) (archive *CharmArchive, err error) {
+func readCharmArchive(zopen zipOpener, opts ReadMetaOptions) (archive *CharmArchive, err error) {
 	b := &CharmArchive{
 		zopen: zopen,
 	}
 	zipr, err := zopen.openZip()
 	if err != nil {
-		return nil, err
+		return nil, archiveOpenError(zopen, err)
 	}
 	defer zipr.Close()
-	reader, err := zipOpenFile(zipr, "metadata.yaml")
+	b.size = zipr.size
+	b.comment = zipr.Comment
+	reader, err := zipOpenFile(zipr, MetadataFile)
 	if err != nil {
+		if nestedErr := nestedArchiveError(zipr); nestedErr != nil {
+			return nil, nestedErr
+		}
 		return nil, err
 	}
-	b.meta, err = ReadMeta(reader)
+	b.meta, err = ReadMetaWithOptions(reader, opts)
 	reader.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	reader, err = zipOpenFile(zipr, "config.yaml")
+	var localeNames []string
+	for _, fh := range zipr.File {
+		dir, name := path.Split(fh.Name)
+		if dir == localeDir+"/" && name != "" && fh.Mode().IsRegular() {
+			localeNames = append(localeNames, name)
+		}
+	}
+	b.meta.Locales, err = readLocales(localeNames, func(name string) (io.ReadCloser, error) {
+		return zipOpenFile(zipr, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = zipOpenFile(zipr, ConfigFile)
 	if _, ok := err.(*noCharmArchiveFile); ok {
 		b.config = NewConfig()
 	} else if err != nil {
@@ -93,7 +133,7 @@ func readCharmArchive(zopen zipOpener) (archive *CharmArchive, err error) {
 		}
 	}
 
-	reader, err = zipOpenFile(zipr, "metrics.yaml")
+	reader, err = zipOpenFile(zipr, MetricsFile)
 	if err == nil {
 		b.metrics, err = ReadMetrics(reader)
 		reader.Close()
@@ -104,29 +144,38 @@ func readCharmArchive(zopen zipOpener) (archive *CharmArchive, err error) {
 		return nil, err
 	}
 
-	reader, err = zipOpenFile(zipr, "actions.yaml")
-	if _, ok := err.(*noCharmArchiveFile); ok {
-		b.actions = NewActions()
-	} else if err != nil {
+	b.actions, err = readActionsFiles(b.meta.Name, func(name string) (io.ReadCloser, error) {
+		return zipOpenFile(zipr, name)
+	}, func(err error) bool {
+		_, ok := err.(*noCharmArchiveFile)
+		return ok
+	})
+	if err != nil {
 		return nil, err
-	} else {
-		b.actions, err = ReadActionsYaml(reader)
+	}
+
+	reader, err = zipOpenFile(zipr, ManifestFile)
+	if err == nil {
+		b.manifest, err = ReadManifest(reader)
 		reader.Close()
 		if err != nil {
-			return nil, err
+			b.meta.Warnings = append(b.meta.Warnings, manifestWarning(err))
 		}
+	} else if _, ok := err.(*noCharmArchiveFile); !ok {
+		return nil, err
 	}
 
-	reader, err = zipOpenFile(zipr, "revision")
+	reader, err = zipOpenFile(zipr, RevisionFile)
 	if err != nil {
 		if _, ok := err.(*noCharmArchiveFile); !ok {
 			return nil, err
 		}
 		b.revision = b.meta.OldRevision
 	} else {
-		_, err = fmt.Fscan(reader, &b.revision)
+		b.revision, err = readRevision(reader)
+		reader.Close()
 		if err != nil {
-			return nil, errors.New("invalid revision file")
+			return nil, err
 		}
 	}
 
@@ -180,21 +229,143 @@ func (a *CharmArchive) Metrics() *Metrics {
 	return a.metrics
 }
 
-// Actions returns the Actions map for the actions.yaml file for the charm
-// archive.
+// Actions returns the Actions map for the actions.yaml file, or the
+// deprecated functions.yaml file, for the charm archive.
 func (a *CharmArchive) Actions() *Actions {
 	return a.actions
 }
 
+// CharmManifest returns the Manifest representing the manifest.yaml
+// file for the charm archive, or nil if there is none.
+func (a *CharmArchive) CharmManifest() *Manifest {
+	return a.manifest
+}
+
+// Icon returns the contents of the charm's icon.svg file, along with
+// its detected content type. It returns ErrNoIcon if the charm
+// has no icon. The returned reader must be closed after use.
+func (a *CharmArchive) Icon() (io.ReadCloser, string, error) {
+	rc, err := a.openFile(IconFile)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return nil, "", ErrNoIcon
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return sniffIcon(rc)
+}
+
+// Readme returns the contents of the charm's README file, along with
+// its name, which may be used to determine its format. README.md,
+// README.rst and README.txt are recognized, in that order of
+// preference. It returns ErrNoReadme if the charm has no README.
+// The returned reader must be closed after use.
+func (a *CharmArchive) Readme() (io.ReadCloser, string, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, "", err
+	}
+	var names []string
+	for _, fh := range zipr.File {
+		if fh.Mode().IsRegular() {
+			names = append(names, fh.Name)
+		}
+	}
+	zipr.Close()
+	name := findReadme(names)
+	if name == "" {
+		return nil, "", ErrNoReadme
+	}
+	rc, err := a.openFile(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return rc, name, nil
+}
+
+// openFile opens the file with the given path in the archive.
+// Closing the returned reader also closes the archive.
+func (a *CharmArchive) openFile(path string) (io.ReadCloser, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := zipOpenFile(zipr, path)
+	if err != nil {
+		zipr.Close()
+		return nil, err
+	}
+	return &multiReadCloser{
+		Reader: rc,
+		Closer: closerFunc(func() error {
+			rc.Close()
+			return zipr.Close()
+		}),
+	}, nil
+}
+
+// Size returns the size in bytes of the charm archive, as
+// recorded when it was read.
+func (a *CharmArchive) Size() int64 {
+	return a.size
+}
+
+// Comment returns the zip file comment of the charm archive.
+func (a *CharmArchive) Comment() string {
+	return a.comment
+}
+
+// SHA256 returns the hex-encoded SHA256 digest of the charm archive.
+// The digest is calculated the first time SHA256 is called and
+// remembered thereafter, so the archive is read at most once.
+func (a *CharmArchive) SHA256() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sha256 != "" {
+		return a.sha256, nil
+	}
+	r, err := a.zopen.openReader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("cannot read charm archive: %v", err)
+	}
+	a.sha256 = fmt.Sprintf("%x", hash.Sum(nil))
+	return a.sha256, nil
+}
+
+// ArchiveTo writes the contents of the charm archive to w, as they
+// were read, so that archives that were not read from a file can be
+// copied. Changes made with SetRevision are not reflected.
+func (a *CharmArchive) ArchiveTo(w io.Writer) error {
+	r, err := a.zopen.openReader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
 type zipReadCloser struct {
 	io.Closer
 	*zip.Reader
+
+	// size holds the size of the zip file.
+	size int64
 }
 
 // zipOpener holds the information needed to open a zip
 // file.
 type zipOpener interface {
 	openZip() (*zipReadCloser, error)
+
+	// openReader returns a reader for the raw
+	// contents of the zip file.
+	openReader() (io.ReadCloser, error)
 }
 
 // newZipOpenerFromPath returns a zipOpener that can be
@@ -232,7 +403,11 @@ func (zo *zipPathOpener) openZip() (*zipReadCloser, error) {
 		f.Close()
 		return nil, err
 	}
-	return &zipReadCloser{Closer: f, Reader: r}, nil
+	return &zipReadCloser{Closer: f, Reader: r, size: fi.Size()}, nil
+}
+
+func (zo *zipPathOpener) openReader() (io.ReadCloser, error) {
+	return os.Open(zo.path)
 }
 
 type zipReaderOpener struct {
@@ -245,7 +420,11 @@ func (zo *zipReaderOpener) openZip() (*zipReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &zipReadCloser{Closer: ioutil.NopCloser(nil), Reader: r}, nil
+	return &zipReadCloser{Closer: ioutil.NopCloser(nil), Reader: r, size: zo.size}, nil
+}
+
+func (zo *zipReaderOpener) openReader() (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.NewSectionReader(zo.r, 0, zo.size)), nil
 }
 
 // Manifest returns a set of the charm's contents.
@@ -262,31 +441,100 @@ func (a *CharmArchive) Manifest() (set.Strings, error) {
 	manifest := set.NewStrings(paths...)
 	// We always write out a revision file, even if there isn't one in the
 	// archive; and we always strip ".", because that's sometimes not present.
-	manifest.Add("revision")
+	manifest.Add(RevisionFile)
 	manifest.Remove(".")
 	return manifest, nil
 }
 
+// SizeLimitError is returned when the contents of a charm
+// exceed a size limit imposed by the caller.
+type SizeLimitError struct {
+	// Size holds the size of the contents, in bytes, at the
+	// point the limit was found to be exceeded.
+	Size int64
+
+	// Limit holds the limit, in bytes.
+	Limit int64
+}
+
+func (err *SizeLimitError) Error() string {
+	return fmt.Sprintf("charm contents size %d exceeds limit %d", err.Size, err.Limit)
+}
+
+// SetFileModePolicy sets the policy used by ExpandTo to check the
+// modes of the files in the archive. If it is not called,
+// DefaultFileModePolicy is used.
+func (a *CharmArchive) SetFileModePolicy(policy FileModePolicy) {
+	a.modePolicy = &policy
+}
+
+func (a *CharmArchive) fileModePolicy() FileModePolicy {
+	if a.modePolicy != nil {
+		return *a.modePolicy
+	}
+	return DefaultFileModePolicy
+}
+
 // ExpandTo expands the charm archive into dir, creating it if necessary.
 // If any errors occur during the expansion procedure, the process will
-// abort.
+// abort. Nothing is expanded if the archive holds files, recorded on
+// unix, with modes rejected by the archive's file mode policy; the
+// special mode bits of accepted files are preserved.
 func (a *CharmArchive) ExpandTo(dir string) error {
+	return a.expandTo(dir, 0)
+}
+
+// ExpandToLimit is like ExpandTo, but returns a *SizeLimitError
+// without expanding anything if the total uncompressed size of the
+// files in the archive exceeds limit bytes.
+func (a *CharmArchive) ExpandToLimit(dir string, limit int64) error {
+	return a.expandTo(dir, limit)
+}
+
+func (a *CharmArchive) expandTo(dir string, limit int64) error {
 	zipr, err := a.zopen.openZip()
 	if err != nil {
 		return err
 	}
 	defer zipr.Close()
+	if limit > 0 {
+		var size uint64
+		for _, fh := range zipr.File {
+			size += fh.UncompressedSize64
+			if size > uint64(limit) {
+				if size > math.MaxInt64 {
+					size = math.MaxInt64
+				}
+				return &SizeLimitError{
+					Size:  int64(size),
+					Limit: limit,
+				}
+			}
+		}
+	}
+	policy := a.fileModePolicy()
+	for _, fh := range zipr.File {
+		if !hasUnixMode(fh) {
+			continue
+		}
+		if err := policy.Check(fh.Name, fh.Mode()); err != nil {
+			return err
+		}
+	}
 	if err := ziputil.ExtractAll(zipr.Reader, dir); err != nil {
 		return err
 	}
-	hooksDir := filepath.Join(dir, "hooks")
+	if err := restoreModes(zipr.Reader, dir, policy); err != nil {
+		return err
+	}
+	hooksDir := filepath.Join(dir, HooksDir)
 	fixHook := fixHookFunc(hooksDir, a.meta.Hooks())
 	if err := filepath.Walk(hooksDir, fixHook); err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
 	}
-	revFile, err := os.Create(filepath.Join(dir, "revision"))
+	revFile, err := os.Create(filepath.Join(dir, RevisionFile))
 	if err != nil {
 		return err
 	}
@@ -295,6 +543,34 @@ func (a *CharmArchive) ExpandTo(dir string) error {
 	return err
 }
 
+// restoreModes sets the special mode bits recorded in the archive,
+// which are not applied when the files are extracted, on the expanded
+// files in dir, and removes the world-writable permissions not
+// preserved by policy.
+func restoreModes(zipr *zip.Reader, dir string, policy FileModePolicy) error {
+	for _, fh := range zipr.File {
+		mode := checkedMode(fh)
+		if mode&os.ModeSymlink != 0 || mode&(preservedModeBits|0002) == 0 {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(fh.Name))
+		if err := os.Chmod(path, expandedMode(mode, policy)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandedMode returns the permissions and special mode bits with
+// which a file with the given archived mode is expanded.
+func expandedMode(mode os.FileMode, policy FileModePolicy) os.FileMode {
+	mode &= os.ModePerm | preservedModeBits
+	if !policy.AllowWorldWritable {
+		mode &^= 0002
+	}
+	return mode
+}
+
 // fixHookFunc returns a WalkFunc that makes sure hooks are owner-executable.
 func fixHookFunc(hooksDir string, hookNames map[string]bool) filepath.WalkFunc {
 	return func(path string, info os.FileInfo, err error) error {
@@ -6,7 +6,9 @@ package charm_test
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -100,6 +102,46 @@ func (s *CharmArchiveSuite) TestReadCharmArchiveWithoutActions(c *gc.C) {
 	c.Assert(archive.Actions().ActionSpecs, gc.HasLen, 0)
 }
 
+func (s *CharmArchiveSuite) TestReadCharmArchiveWithFunctions(c *gc.C) {
+	dirPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Rename(filepath.Join(dirPath, "actions.yaml"), filepath.Join(dirPath, "functions.yaml"))
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(dirPath)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Actions().ActionSpecs, gc.HasLen, 1)
+	c.Assert(archive.Actions().ActionSpecs["snapshot"].Description, gc.Equals, "Take a snapshot of the database.")
+}
+
+func (s *CharmArchiveSuite) TestReadCharmArchiveWithLegacyMeta(c *gc.C) {
+	dirPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(dirPath, "metadata.yaml"), []byte(legacyMetadata), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDirWithOptions(dirPath, charm.ReadMetaOptions{Legacy: true})
+	c.Assert(err, gc.IsNil)
+	path := filepath.Join(c.MkDir(), "legacy.charm")
+	f, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(f)
+	f.Close()
+	c.Assert(err, gc.IsNil)
+
+	_, err = charm.ReadCharmArchive(path)
+	c.Assert(err, gc.NotNil)
+
+	archive, err := charm.ReadCharmArchiveWithOptions(path, charm.ReadArchiveOptions{
+		Meta: charm.ReadMetaOptions{Legacy: true},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Requires["info"].Interface, gc.Equals, "juju-info")
+	c.Assert(archive.Meta().Warnings, gc.HasLen, 5)
+}
+
 func (s *CharmArchiveSuite) TestReadCharmArchiveBytes(c *gc.C) {
 	data, err := ioutil.ReadFile(s.archivePath)
 	c.Assert(err, gc.IsNil)
@@ -121,6 +163,87 @@ func (s *CharmArchiveSuite) TestReadCharmArchiveFromReader(c *gc.C) {
 	checkDummy(c, archive, "")
 }
 
+func (s *CharmArchiveSuite) TestSizeAndSHA256(c *gc.C) {
+	data, err := ioutil.ReadFile(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	expectSHA256 := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	fromPath, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	fromBytes, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	fromReader, err := charm.ReadCharmArchiveFromReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+
+	for i, archive := range []*charm.CharmArchive{fromPath, fromBytes, fromReader} {
+		c.Logf("test %d", i)
+		c.Assert(archive.Size(), gc.Equals, int64(len(data)))
+		sum, err := archive.SHA256()
+		c.Assert(err, gc.IsNil)
+		c.Assert(sum, gc.Equals, expectSHA256)
+		// The digest is cached after the first call.
+		sum, err = archive.SHA256()
+		c.Assert(err, gc.IsNil)
+		c.Assert(sum, gc.Equals, expectSHA256)
+	}
+}
+
+func (s *CharmArchiveSuite) TestComment(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Comment(), gc.Equals, "")
+
+	data, err := ioutil.ReadFile(filepath.Join(TestCharms.CharmDirPath("dummy"), "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	buf := new(bytes.Buffer)
+	zipw := zip.NewWriter(buf)
+	w, err := zipw.Create("metadata.yaml")
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write(data)
+	c.Assert(err, gc.IsNil)
+	err = zipw.SetComment("built by the test suite")
+	c.Assert(err, gc.IsNil)
+	err = zipw.Close()
+	c.Assert(err, gc.IsNil)
+
+	archive, err = charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Comment(), gc.Equals, "built by the test suite")
+}
+
+func (s *CharmArchiveSuite) TestIconAndReadme(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	_, _, err = archive.Icon()
+	c.Assert(err, gc.Equals, charm.ErrNoIcon)
+	_, _, err = archive.Readme()
+	c.Assert(err, gc.Equals, charm.ErrNoReadme)
+
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	icon := `<svg xmlns="http://www.w3.org/2000/svg"></svg>`
+	err = ioutil.WriteFile(filepath.Join(charmDir, "icon.svg"), []byte(icon), 0644)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(charmDir, "README.rst"), []byte("readme"), 0644)
+	c.Assert(err, gc.IsNil)
+	archive = archiveDir(c, charmDir)
+
+	r, contentType, err := archive.Icon()
+	c.Assert(err, gc.IsNil)
+	c.Assert(contentType, gc.Equals, "image/svg+xml")
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Close(), gc.IsNil)
+	c.Assert(string(data), gc.Equals, icon)
+
+	r, name, err := archive.Readme()
+	c.Assert(err, gc.IsNil)
+	c.Assert(name, gc.Equals, "README.rst")
+	data, err = ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Close(), gc.IsNil)
+	c.Assert(string(data), gc.Equals, "readme")
+}
+
 func (s *CharmArchiveSuite) TestManifest(c *gc.C) {
 	archive, err := charm.ReadCharmArchive(s.archivePath)
 	c.Assert(err, gc.IsNil)
@@ -170,6 +293,120 @@ func (s *CharmArchiveSuite) TestExpandTo(c *gc.C) {
 	checkDummy(c, dir, path)
 }
 
+func (s *CharmArchiveSuite) TestExpandToLimit(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExpandToLimit(path, 10)
+	c.Assert(err, gc.FitsTypeOf, &charm.SizeLimitError{})
+	c.Assert(err, gc.ErrorMatches, `charm contents size [0-9]+ exceeds limit 10`)
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+
+	err = archive.ExpandToLimit(path, 1<<20)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	checkDummy(c, dir, path)
+}
+
+func (s *CharmArchiveSuite) TestExtractFiles(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExtractFiles(path, []string{"hooks/", "*.yaml"})
+	c.Assert(err, gc.IsNil)
+
+	var names []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		c.Assert(err, gc.IsNil)
+		if !info.IsDir() {
+			rel, err := filepath.Rel(path, p)
+			c.Assert(err, gc.IsNil)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(names, jc.SameContents, []string{
+		"actions.yaml",
+		"config.yaml",
+		"hooks/install",
+		"metadata.yaml",
+	})
+	info, err := os.Stat(filepath.Join(path, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0100, gc.Not(gc.Equals), os.FileMode(0))
+}
+
+func (s *CharmArchiveSuite) TestExtractFilesRevision(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	archive.SetRevision(42)
+
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExtractFiles(path, []string{"metadata.yaml", "revision"})
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(path, "revision"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "42")
+	_, err = os.Stat(filepath.Join(path, "hooks"))
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *CharmArchiveSuite) TestExtractFilesBadPattern(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+
+	err = archive.ExtractFiles(c.MkDir(), []string{"hooks/["})
+	c.Assert(err, gc.ErrorMatches, `invalid pattern "hooks/\[": syntax error in pattern`)
+}
+
+func (s *CharmArchiveSuite) TestExtractFilesWithBadLink(c *gc.C) {
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Symlink("../../target", filepath.Join(charmDir, "hooks", "badlink"))
+	c.Assert(err, gc.IsNil)
+	archive := extCharmArchiveDir(c, charmDir)
+
+	// Nothing is extracted when a selected file is unsafe.
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExtractFiles(path, []string{"hooks/"})
+	c.Assert(err, gc.ErrorMatches, `cannot extract "hooks/badlink": symlink "../../target" leads out of scope`)
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+
+	// Unselected files are not checked.
+	err = archive.ExtractFiles(path, []string{"metadata.yaml"})
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CharmArchiveSuite) TestExtractFilesSpecialModes(c *gc.C) {
+	srcPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Chmod(filepath.Join(srcPath, "src", "hello.c"), os.ModeSetuid|0755)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(srcPath)
+	c.Assert(err, gc.IsNil)
+	dir.SetFileModePolicy(charm.FileModePolicy{AllowSetuid: true})
+	buf := new(bytes.Buffer)
+	err = dir.ArchiveTo(buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExtractFiles(path, []string{"src/"})
+	c.Assert(err, gc.ErrorMatches, `file "src/hello.c" is setuid`)
+
+	archive.SetFileModePolicy(charm.FileModePolicy{AllowSetuid: true})
+	err = archive.ExtractFiles(path, []string{"src/"})
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(path, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&os.ModeSetuid, gc.Equals, os.ModeSetuid)
+}
+
 func (s *CharmArchiveSuite) prepareCharmArchive(c *gc.C, charmDir *charm.CharmDir, archivePath string) {
 	file, err := os.Create(archivePath)
 	c.Assert(err, gc.IsNil)
@@ -280,6 +517,137 @@ func (s *CharmArchiveSuite) TestCharmArchiveFileModes(c *gc.C) {
 	}
 }
 
+func (s *CharmArchiveSuite) TestExpandToSpecialModes(c *gc.C) {
+	srcPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Chmod(filepath.Join(srcPath, "src", "hello.c"), os.ModeSetuid|0755)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(srcPath)
+	c.Assert(err, gc.IsNil)
+	dir.SetFileModePolicy(charm.FileModePolicy{AllowSetuid: true})
+	buf := new(bytes.Buffer)
+	err = dir.ArchiveTo(buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	// The default policy rejects the archive without expanding it.
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExpandTo(path)
+	c.Assert(err, gc.ErrorMatches, `file "src/hello.c" is setuid`)
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+
+	// When allowed, the setuid bit is preserved.
+	archive.SetFileModePolicy(charm.FileModePolicy{AllowSetuid: true})
+	err = archive.ExpandTo(path)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(path, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&(os.ModeSetuid|0777), gc.Equals, os.ModeSetuid|0755)
+}
+
+func (s *CharmArchiveSuite) TestExpandToSpecialModesMacOSX(c *gc.C) {
+	srcPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Chmod(filepath.Join(srcPath, "src", "hello.c"), os.ModeSetuid|os.ModeSetgid|0755)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(srcPath)
+	c.Assert(err, gc.IsNil)
+	dir.SetFileModePolicy(charm.FileModePolicy{AllowSetuid: true, AllowSetgid: true})
+	buf := new(bytes.Buffer)
+	err = dir.ArchiveTo(buf)
+	c.Assert(err, gc.IsNil)
+
+	// Mark the archive as created on Mac OS X,
+	// whose modes are decoded as unix modes.
+	zipr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, gc.IsNil)
+	var macBuf bytes.Buffer
+	zipw := zip.NewWriter(&macBuf)
+	for _, f := range zipr.File {
+		h := f.FileHeader
+		h.CreatorVersion = 19<<8 | h.CreatorVersion&0xff
+		w, err := zipw.CreateHeader(&h)
+		c.Assert(err, gc.IsNil)
+		r, err := f.Open()
+		c.Assert(err, gc.IsNil)
+		_, err = io.Copy(w, r)
+		r.Close()
+		c.Assert(err, gc.IsNil)
+	}
+	err = zipw.Close()
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(macBuf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExpandTo(path)
+	c.Assert(err, gc.ErrorMatches, `file "src/hello.c" is setuid`)
+	err = archive.ExtractFiles(path, []string{"src/"})
+	c.Assert(err, gc.ErrorMatches, `file "src/hello.c" is setuid`)
+
+	archive.SetFileModePolicy(charm.FileModePolicy{AllowSetuid: true, AllowSetgid: true})
+	err = archive.ExpandTo(path)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(path, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&(os.ModeSetuid|os.ModeSetgid|0777), gc.Equals, os.ModeSetuid|os.ModeSetgid|0755)
+}
+
+func (s *CharmArchiveSuite) TestExpandToWorldWritable(c *gc.C) {
+	srcPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Chmod(filepath.Join(srcPath, "src", "hello.c"), 0666)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(srcPath)
+	c.Assert(err, gc.IsNil)
+	dir.SetFileModePolicy(charm.FileModePolicy{AllowWorldWritable: true})
+	buf := new(bytes.Buffer)
+	err = dir.ArchiveTo(buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	// The default policy removes the write permissions.
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExpandTo(path)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(path, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0002, gc.Equals, os.FileMode(0))
+
+	// When allowed, they are preserved.
+	archive.SetFileModePolicy(charm.FileModePolicy{AllowWorldWritable: true})
+	path = filepath.Join(c.MkDir(), "charm")
+	err = archive.ExpandTo(path)
+	c.Assert(err, gc.IsNil)
+	info, err = os.Stat(filepath.Join(path, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0777, gc.Equals, os.FileMode(0666))
+}
+
+func (s *CharmArchiveSuite) TestExpandToNonUnixArchive(c *gc.C) {
+	// Archives made on other systems record nominal modes,
+	// such as 0666, which are not checked.
+	data, err := ioutil.ReadFile(filepath.Join(TestCharms.CharmDirPath("dummy"), "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	buf := new(bytes.Buffer)
+	zipw := zip.NewWriter(buf)
+	w, err := zipw.Create("metadata.yaml")
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write(data)
+	c.Assert(err, gc.IsNil)
+	err = zipw.Close()
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	path := filepath.Join(c.MkDir(), "charm")
+	err = archive.ExpandTo(path)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(path, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0002, gc.Equals, os.FileMode(0))
+}
+
 func (s *CharmArchiveSuite) TestCharmArchiveRevisionFile(c *gc.C) {
 	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
 	revPath := filepath.Join(charmDir, "revision")
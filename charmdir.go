@@ -8,13 +8,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+
+	"github.com/juju/utils/fs"
 )
 
+// ErrReadOnly is returned when an attempt is made to modify the files
+// of a charm directory that has been made read-only with SetReadOnly.
+var ErrReadOnly = errors.New("charm directory is read-only")
+
 // The CharmDir type encapsulates access to data and operations
 // on a charm directory.
 type CharmDir struct {
@@ -23,7 +30,19 @@ type CharmDir struct {
 	config   *Config
 	metrics  *Metrics
 	actions  *Actions
+	manifest *Manifest
 	revision int
+
+	// modePolicy holds the policy set by SetFileModePolicy,
+	// or nil if the default policy applies.
+	modePolicy *FileModePolicy
+
+	// archivePolicy holds the policy set by SetArchivePolicy.
+	archivePolicy ArchivePolicy
+
+	// readOnly holds whether the files of the charm
+	// may not be modified, as set by SetReadOnly.
+	readOnly bool
 }
 
 // Trick to ensure *CharmDir implements the Charm interface.
@@ -31,18 +50,41 @@ var _ Charm = (*CharmDir)(nil)
 
 // ReadCharmDir returns a CharmDir representing an expanded charm directory.
 func ReadCharmDir(path string) (dir *CharmDir, err error) {
+	return ReadCharmDirWithOptions(path, ReadMetaOptions{})
+}
+
+// ReadCharmDirWithOptions is like ReadCharmDir, but it reads
+// the charm metadata with the given options.
+func ReadCharmDirWithOptions(path string, opts ReadMetaOptions) (dir *CharmDir, err error) {
 	dir = &CharmDir{Path: path}
-	file, err := os.Open(dir.join("metadata.yaml"))
+	file, err := os.Open(dir.join(MetadataFile))
 	if err != nil {
 		return nil, err
 	}
-	dir.meta, err = ReadMeta(file)
+	dir.meta, err = ReadMetaWithOptions(file, opts)
 	file.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	file, err = os.Open(dir.join("config.yaml"))
+	localeInfos, err := ioutil.ReadDir(dir.join(localeDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var localeNames []string
+	for _, info := range localeInfos {
+		if info.Mode().IsRegular() {
+			localeNames = append(localeNames, info.Name())
+		}
+	}
+	dir.meta.Locales, err = readLocales(localeNames, func(name string) (io.ReadCloser, error) {
+		return os.Open(dir.join(filepath.FromSlash(name)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err = os.Open(dir.join(ConfigFile))
 	if _, ok := err.(*os.PathError); ok {
 		dir.config = NewConfig()
 	} else if err != nil {
@@ -55,7 +97,7 @@ func ReadCharmDir(path string) (dir *CharmDir, err error) {
 		}
 	}
 
-	file, err = os.Open(dir.join("metrics.yaml"))
+	file, err = os.Open(dir.join(MetricsFile))
 	if err == nil {
 		dir.metrics, err = ReadMetrics(file)
 		file.Close()
@@ -66,24 +108,32 @@ func ReadCharmDir(path string) (dir *CharmDir, err error) {
 		return nil, err
 	}
 
-	file, err = os.Open(dir.join("actions.yaml"))
-	if _, ok := err.(*os.PathError); ok {
-		dir.actions = NewActions()
-	} else if err != nil {
+	dir.actions, err = readActionsFiles(dir.meta.Name, func(name string) (io.ReadCloser, error) {
+		return os.Open(dir.join(name))
+	}, func(err error) bool {
+		_, ok := err.(*os.PathError)
+		return ok
+	})
+	if err != nil {
 		return nil, err
-	} else {
-		dir.actions, err = ReadActionsYaml(file)
+	}
+
+	file, err = os.Open(dir.join(ManifestFile))
+	if err == nil {
+		dir.manifest, err = ReadManifest(file)
 		file.Close()
 		if err != nil {
-			return nil, err
+			dir.meta.Warnings = append(dir.meta.Warnings, manifestWarning(err))
 		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
 	}
 
-	if file, err = os.Open(dir.join("revision")); err == nil {
-		_, err = fmt.Fscan(file, &dir.revision)
+	if file, err = os.Open(dir.join(RevisionFile)); err == nil {
+		dir.revision, err = readRevision(file)
 		file.Close()
 		if err != nil {
-			return nil, errors.New("invalid revision file")
+			return nil, err
 		}
 	} else {
 		dir.revision = dir.meta.OldRevision
@@ -123,12 +173,101 @@ func (dir *CharmDir) Metrics() *Metrics {
 	return dir.metrics
 }
 
-// Actions returns the Actions representing the actions.yaml file
-// for the charm expanded in dir.
+// Actions returns the Actions representing the actions.yaml file,
+// or the deprecated functions.yaml file, for the charm expanded in dir.
 func (dir *CharmDir) Actions() *Actions {
 	return dir.actions
 }
 
+// CharmManifest returns the Manifest representing the manifest.yaml
+// file for the charm expanded in dir, or nil if there is none.
+func (dir *CharmDir) CharmManifest() *Manifest {
+	return dir.manifest
+}
+
+// Icon returns the contents of the charm's icon.svg file, along with
+// its detected content type. It returns ErrNoIcon if the charm
+// has no icon. The returned reader must be closed after use.
+func (dir *CharmDir) Icon() (io.ReadCloser, string, error) {
+	file, err := os.Open(dir.join(IconFile))
+	if os.IsNotExist(err) {
+		return nil, "", ErrNoIcon
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return sniffIcon(file)
+}
+
+// Readme returns the contents of the charm's README file, along with
+// its name, which may be used to determine its format. README.md,
+// README.rst and README.txt are recognized, in that order of
+// preference. It returns ErrNoReadme if the charm has no README.
+// The returned reader must be closed after use.
+func (dir *CharmDir) Readme() (io.ReadCloser, string, error) {
+	infos, err := ioutil.ReadDir(dir.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			names = append(names, info.Name())
+		}
+	}
+	name := findReadme(names)
+	if name == "" {
+		return nil, "", ErrNoReadme
+	}
+	file, err := os.Open(dir.join(name))
+	if err != nil {
+		return nil, "", err
+	}
+	return file, name, nil
+}
+
+// PebbleLayers reads and checks the pebble layer files found in the
+// charm's layers directory, returning them keyed by file name. It
+// returns nil if the charm has no layers directory. If any layer file
+// is invalid, the returned error is a *VerificationError holding an
+// error for each problem found, and the valid layers are returned.
+func (dir *CharmDir) PebbleLayers() (map[string]*PebbleLayer, error) {
+	infos, err := ioutil.ReadDir(dir.join(PebbleLayersDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	layers := make(map[string]*PebbleLayer)
+	var errs []error
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || filepath.Ext(name) != ".yaml" {
+			continue
+		}
+		if !IsValidPebbleLayerFile(name) {
+			errs = append(errs, errorCodef(CodeInvalidPebbleLayer, "invalid pebble layer file name %q", name))
+			continue
+		}
+		file, err := os.Open(dir.join(PebbleLayersDir, name))
+		if err != nil {
+			return nil, err
+		}
+		layer, err := ReadPebbleLayer(file)
+		file.Close()
+		if err != nil {
+			errs = append(errs, annotateCodef(CodeInvalidPebbleLayer, err, "%s: %v", name, err))
+			continue
+		}
+		layers[name] = layer
+	}
+	if len(errs) > 0 {
+		return layers, &VerificationError{Errors: errs}
+	}
+	return layers, nil
+}
+
 // SetRevision changes the charm revision number. This affects
 // the revision reported by Revision and the revision of the
 // charm archived by ArchiveTo.
@@ -138,10 +277,14 @@ func (dir *CharmDir) SetRevision(revision int) {
 }
 
 // SetDiskRevision does the same as SetRevision but also changes
-// the revision file in the charm directory.
+// the revision file in the charm directory. It returns ErrReadOnly,
+// leaving the revision unchanged, if the directory is read-only.
 func (dir *CharmDir) SetDiskRevision(revision int) error {
+	if dir.readOnly {
+		return ErrReadOnly
+	}
 	dir.SetRevision(revision)
-	file, err := os.OpenFile(dir.join("revision"), os.O_WRONLY|os.O_CREATE, 0644)
+	file, err := os.OpenFile(dir.join(RevisionFile), os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
@@ -150,6 +293,49 @@ func (dir *CharmDir) SetDiskRevision(revision int) error {
 	return err
 }
 
+// SetReadOnly sets whether the files of the charm directory may be
+// modified. Methods that would modify them, such as SetDiskRevision,
+// return ErrReadOnly when the directory is read-only, so that tools
+// can work on a checked-out charm without risk of altering it. Use
+// Clone to obtain a copy that may be modified.
+func (dir *CharmDir) SetReadOnly(readOnly bool) {
+	dir.readOnly = readOnly
+}
+
+// ReadOnly reports whether the directory has been
+// made read-only with SetReadOnly.
+func (dir *CharmDir) ReadOnly() bool {
+	return dir.readOnly
+}
+
+// Clone copies the files of the charm to dest, which must not exist,
+// and returns a writable CharmDir reading from the copy, whatever the
+// mode of dir. The revision and the policies set on dir are carried
+// over to the copy, but changes made to either charm afterwards do
+// not affect the other.
+func (dir *CharmDir) Clone(dest string) (*CharmDir, error) {
+	if _, err := os.Lstat(dest); err == nil {
+		return nil, fmt.Errorf("cannot clone charm to %q: destination already exists", dest)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot clone charm: %v", err)
+	}
+	src, err := resolveSymlinkedRoot(dir.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.Copy(src, dest); err != nil {
+		return nil, fmt.Errorf("cannot clone charm: %v", err)
+	}
+	clone, err := ReadCharmDir(dest)
+	if err != nil {
+		return nil, err
+	}
+	clone.revision = dir.revision
+	clone.modePolicy = dir.modePolicy
+	clone.archivePolicy = dir.archivePolicy
+	return clone, nil
+}
+
 // resolveSymlinkedRoot returns the target destination of a
 // charm root directory if the root directory is a symlink.
 func resolveSymlinkedRoot(rootPath string) (string, error) {
@@ -163,15 +349,65 @@ func resolveSymlinkedRoot(rootPath string) (string, error) {
 	return rootPath, nil
 }
 
+// SetFileModePolicy sets the policy used by ArchiveTo to check the
+// modes of the files in the charm. If it is not called,
+// DefaultFileModePolicy is used.
+func (dir *CharmDir) SetFileModePolicy(policy FileModePolicy) {
+	dir.modePolicy = &policy
+}
+
+func (dir *CharmDir) fileModePolicy() FileModePolicy {
+	if dir.modePolicy != nil {
+		return *dir.modePolicy
+	}
+	return DefaultFileModePolicy
+}
+
 // ArchiveTo creates a charm file from the charm expanded in dir.
 // By convention a charm archive should have a ".charm" suffix.
+// Files larger than 4GB are stored using the zip64 extensions.
+// Files with modes not accepted by the charm's file mode policy
+// cause an error, as do files and archives exceeding the limits of
+// its archive policy, which is set with SetArchivePolicy.
 func (dir *CharmDir) ArchiveTo(w io.Writer) error {
-	return writeArchive(w, dir.Path, dir.revision, dir.Meta().Hooks())
+	return writeArchive(w, dir.Path, dir.revision, dir.Meta().Hooks(), 0, dir.fileModePolicy(), dir.archivePolicy)
 }
 
-func writeArchive(w io.Writer, path string, revision int, hooks map[string]bool) error {
+// ArchiveToLimit is like ArchiveTo, but returns a *SizeLimitError
+// if the total size of the files in the charm exceeds limit bytes.
+func (dir *CharmDir) ArchiveToLimit(w io.Writer, limit int64) error {
+	return writeArchive(w, dir.Path, dir.revision, dir.Meta().Hooks(), limit, dir.fileModePolicy(), dir.archivePolicy)
+}
+
+// writeArchive writes the contents of path to w as a zip archive. If
+// limit is greater than zero, the total size of the archived files
+// may not exceed it. The mode of each file is checked against policy,
+// and the archive and its files against archivePolicy.
+func writeArchive(w io.Writer, path string, revision int, hooks map[string]bool, limit int64, policy FileModePolicy, archivePolicy ArchivePolicy) (err error) {
+	if err := archivePolicy.checkPatterns(); err != nil {
+		return err
+	}
+	if archivePolicy.MaxArchiveSize > 0 {
+		sw := &archiveSizeWriter{
+			w:     w,
+			limit: archivePolicy.MaxArchiveSize,
+		}
+		w = sw
+		defer func() {
+			// The zip writer may wrap or replace the error.
+			if sw.err != nil {
+				err = sw.err
+			}
+		}()
+	}
 	zipw := zip.NewWriter(w)
-	defer zipw.Close()
+	defer func() {
+		// Close writes the central directory, including any zip64
+		// records, so its error must not be lost.
+		if closeErr := zipw.Close(); err == nil {
+			err = closeErr
+		}
+	}()
 
 	// The root directory may be symlinked elsewhere so
 	// resolve that before creating the zip.
@@ -179,7 +415,14 @@ func writeArchive(w io.Writer, path string, revision int, hooks map[string]bool)
 	if err != nil {
 		return err
 	}
-	zp := zipPacker{zipw, rootPath, hooks}
+	zp := zipPacker{
+		Writer:        zipw,
+		root:          rootPath,
+		hooks:         hooks,
+		policy:        policy,
+		archivePolicy: archivePolicy,
+		limit:         limit,
+	}
 	if revision != -1 {
 		zp.AddRevision(revision)
 	}
@@ -188,8 +431,18 @@ func writeArchive(w io.Writer, path string, revision int, hooks map[string]bool)
 
 type zipPacker struct {
 	*zip.Writer
-	root  string
-	hooks map[string]bool
+	root   string
+	hooks  map[string]bool
+	policy FileModePolicy
+
+	// archivePolicy holds the limits on the archived files.
+	archivePolicy ArchivePolicy
+
+	// limit holds the maximum total size of the archived
+	// files, or zero if there is no limit; size holds the
+	// total size of the files archived so far.
+	limit int64
+	size  int64
 }
 
 func (zp *zipPacker) WalkFunc() filepath.WalkFunc {
@@ -199,7 +452,7 @@ func (zp *zipPacker) WalkFunc() filepath.WalkFunc {
 }
 
 func (zp *zipPacker) AddRevision(revision int) error {
-	h := &zip.FileHeader{Name: "revision"}
+	h := &zip.FileHeader{Name: RevisionFile}
 	h.SetMode(syscall.S_IFREG | 0644)
 	w, err := zp.CreateHeader(h)
 	if err == nil {
@@ -236,28 +489,37 @@ func (zp *zipPacker) visit(path string, fi os.FileInfo, err error) error {
 	if mode&os.ModeSymlink != 0 {
 		method = zip.Store
 	}
-	if hidden || relpath == "revision" {
+	if hidden || relpath == RevisionFile {
 		return nil
 	}
+	if err := zp.policy.Check(relpath, mode); err != nil {
+		return err
+	}
+	if name := filepath.ToSlash(strings.TrimSuffix(relpath, "/")); name != "." {
+		if err := zp.archivePolicy.checkFile(name, fi.IsDir(), fi.Size()); err != nil {
+			return err
+		}
+	}
 	h := &zip.FileHeader{
 		Name:   relpath,
 		Method: method,
 	}
 
-	perm := os.FileMode(0644)
-	if mode&os.ModeSymlink != 0 {
-		perm = 0777
-	} else if mode&0100 != 0 {
-		perm = 0755
+	archiveMode, madeExecutable := archivedMode(relpath, mode, zp.hooks, zp.policy)
+	if madeExecutable {
+		logger.Warningf("making %q executable in charm", path)
 	}
-	if filepath.Dir(relpath) == "hooks" {
-		hookName := filepath.Base(relpath)
-		if _, ok := zp.hooks[hookName]; ok && !fi.IsDir() && mode&0100 == 0 {
-			logger.Warningf("making %q executable in charm", path)
-			perm = perm | 0100
+	h.SetMode(archiveMode)
+
+	if !fi.IsDir() {
+		zp.size += fi.Size()
+		if zp.limit > 0 && zp.size > zp.limit {
+			return &SizeLimitError{
+				Size:  zp.size,
+				Limit: zp.limit,
+			}
 		}
 	}
-	h.SetMode(mode&^0777 | perm)
 
 	w, err := zp.CreateHeader(h)
 	if err != nil || fi.IsDir() {
@@ -285,6 +547,33 @@ func (zp *zipPacker) visit(path string, fi os.FileInfo, err error) error {
 	return err
 }
 
+// archivedMode returns the mode with which the file with the given
+// relative path and mode is archived, normalizing its permissions
+// and keeping only the write permissions preserved by policy.
+// Files in the hooks directory named in hooks are made executable,
+// in which case archivedMode also returns true.
+func archivedMode(relpath string, mode os.FileMode, hooks map[string]bool, policy FileModePolicy) (os.FileMode, bool) {
+	perm := os.FileMode(0644)
+	if mode&os.ModeSymlink != 0 {
+		perm = 0777
+	} else if mode&0100 != 0 {
+		perm = 0755
+	}
+	madeExecutable := false
+	if filepath.Dir(relpath) == HooksDir {
+		hookName := filepath.Base(relpath)
+		if _, ok := hooks[hookName]; ok && !mode.IsDir() && mode&0100 == 0 {
+			perm = perm | 0100
+			madeExecutable = true
+		}
+	}
+	if mode&os.ModeSymlink == 0 {
+		// The policy has accepted any special bits, so keep them.
+		perm |= mode&preservedModeBits | policy.writePerm(mode)
+	}
+	return mode&^(0777|preservedModeBits) | perm, madeExecutable
+}
+
 func checkSymlinkTarget(basedir, symlink, target string) error {
 	if filepath.IsAbs(target) {
 		return fmt.Errorf("symlink %q is absolute: %q", symlink, target)
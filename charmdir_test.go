@@ -6,6 +6,7 @@ package charm_test
 import (
 	"archive/zip"
 	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -78,6 +79,41 @@ func (s *CharmDirSuite) TestReadCharmDirWithoutActions(c *gc.C) {
 	c.Assert(dir.Actions().ActionSpecs, gc.HasLen, 0)
 }
 
+func (s *CharmDirSuite) TestReadCharmDirWithFunctions(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Rename(filepath.Join(path, "actions.yaml"), filepath.Join(path, "functions.yaml"))
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Actions().ActionSpecs, gc.HasLen, 1)
+	c.Assert(dir.Actions().ActionSpecs["snapshot"].Description, gc.Equals, "Take a snapshot of the database.")
+	c.Assert(c.GetTestLog(), gc.Matches, `(.|\n)*WARNING juju.charm charm "dummy" uses deprecated functions.yaml; rename it to actions.yaml\n`)
+}
+
+func (s *CharmDirSuite) TestReadCharmDirWithActionsAndFunctions(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "functions.yaml"), []byte("other:\n  description: Other.\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Actions().ActionSpecs, gc.HasLen, 1)
+	c.Assert(dir.Actions().ActionSpecs["snapshot"].Description, gc.Equals, "Take a snapshot of the database.")
+	c.Assert(c.GetTestLog(), gc.Matches, `(.|\n)*WARNING juju.charm charm "dummy" has both actions.yaml and functions.yaml; ignoring functions.yaml\n`)
+}
+
+func (s *CharmDirSuite) TestReadCharmDirWithOptions(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "metadata.yaml"), []byte(legacyMetadata), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmDir(path)
+	c.Assert(err, gc.NotNil)
+
+	dir, err := charm.ReadCharmDirWithOptions(path, charm.ReadMetaOptions{Legacy: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta().Requires["info"].Interface, gc.Equals, "juju-info")
+	c.Assert(dir.Meta().Warnings, gc.HasLen, 5)
+}
+
 func (s *CharmDirSuite) TestArchiveTo(c *gc.C) {
 	baseDir := c.MkDir()
 	charmDir := TestCharms.ClonedDirPath(baseDir, "dummy")
@@ -258,6 +294,185 @@ func (s *CharmDirSuite) TestArchiveToWithBadType(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, `file is a named pipe: "hooks/badfile"`)
 }
 
+func (s *CharmDirSuite) TestArchiveToWithSpecialModes(c *gc.C) {
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	setuidFile := filepath.Join(charmDir, "src", "hello.c")
+	err := os.Chmod(setuidFile, os.ModeSetuid|0755)
+	c.Assert(err, gc.IsNil)
+
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(&bytes.Buffer{})
+	c.Assert(err, gc.ErrorMatches, `file "src/hello.c" is setuid`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidFileMode)
+
+	var b bytes.Buffer
+	dir.SetFileModePolicy(charm.FileModePolicy{AllowSetuid: true})
+	err = dir.ArchiveTo(&b)
+	c.Assert(err, gc.IsNil)
+	zipr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	c.Assert(err, gc.IsNil)
+	var found bool
+	for _, f := range zipr.File {
+		if f.Name == "src/hello.c" {
+			found = true
+			c.Assert(f.Mode()&(os.ModeSetuid|0777), gc.Equals, os.ModeSetuid|0755)
+		}
+	}
+	c.Assert(found, gc.Equals, true)
+
+	// World-writable files lose their write permissions unless allowed.
+	err = os.Chmod(setuidFile, 0666)
+	c.Assert(err, gc.IsNil)
+	dir.SetFileModePolicy(charm.DefaultFileModePolicy)
+	c.Assert(archivedFileMode(c, dir, "src/hello.c"), gc.Equals, os.FileMode(0644))
+	dir.SetFileModePolicy(charm.FileModePolicy{AllowWorldWritable: true})
+	c.Assert(archivedFileMode(c, dir, "src/hello.c"), gc.Equals, os.FileMode(0666))
+}
+
+// archivedFileMode archives dir and returns the
+// mode with which the named file was archived.
+func archivedFileMode(c *gc.C, dir *charm.CharmDir, name string) os.FileMode {
+	var b bytes.Buffer
+	err := dir.ArchiveTo(&b)
+	c.Assert(err, gc.IsNil)
+	zipr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	c.Assert(err, gc.IsNil)
+	for _, f := range zipr.File {
+		if f.Name == name {
+			return f.Mode()
+		}
+	}
+	c.Fatalf("%q not found in archive", name)
+	return 0
+}
+
+func (s *CharmDirSuite) TestArchiveToLimit(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+
+	err := dir.ArchiveToLimit(&bytes.Buffer{}, 10)
+	c.Assert(err, gc.FitsTypeOf, &charm.SizeLimitError{})
+	c.Assert(err.(*charm.SizeLimitError).Limit, gc.Equals, int64(10))
+	c.Assert(err, gc.ErrorMatches, `charm contents size [0-9]+ exceeds limit 10`)
+
+	var b bytes.Buffer
+	err = dir.ArchiveToLimit(&b, 1<<20)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmArchiveBytes(b.Bytes())
+	c.Assert(err, gc.IsNil)
+}
+
+var largeFiles = flag.Bool("charm.large-files", false, "run tests that archive files larger than 4GB")
+
+func (s *CharmDirSuite) TestArchiveToLargeFile(c *gc.C) {
+	if !*largeFiles {
+		c.Skip("large file tests not enabled; use -charm.large-files")
+	}
+	const size = 1<<32 + 1
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	f, err := os.Create(filepath.Join(charmDir, "large"))
+	c.Assert(err, gc.IsNil)
+	// Create a sparse file so that the test does not need
+	// 4GB of real disk space for the source.
+	err = f.Truncate(size)
+	f.Close()
+	c.Assert(err, gc.IsNil)
+
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	path := filepath.Join(c.MkDir(), "archive.charm")
+	file, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(file)
+	file.Close()
+	c.Assert(err, gc.IsNil)
+
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	err = archive.ExpandToLimit(c.MkDir(), size)
+	c.Assert(err, gc.FitsTypeOf, &charm.SizeLimitError{})
+
+	expandDir := c.MkDir()
+	err = archive.ExpandTo(expandDir)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(expandDir, "large"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Size(), gc.Equals, int64(size))
+}
+
+func (s *CharmDirSuite) TestIcon(c *gc.C) {
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	_, _, err = dir.Icon()
+	c.Assert(err, gc.Equals, charm.ErrNoIcon)
+
+	icon := `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`
+	err = ioutil.WriteFile(filepath.Join(charmDir, "icon.svg"), []byte(icon), 0644)
+	c.Assert(err, gc.IsNil)
+	r, contentType, err := dir.Icon()
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	c.Assert(contentType, gc.Equals, "image/svg+xml")
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, icon)
+}
+
+func (s *CharmDirSuite) TestReadme(c *gc.C) {
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	_, _, err = dir.Readme()
+	c.Assert(err, gc.Equals, charm.ErrNoReadme)
+
+	err = ioutil.WriteFile(filepath.Join(charmDir, "readme.txt"), []byte("text"), 0644)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(charmDir, "README.md"), []byte("# markdown"), 0644)
+	c.Assert(err, gc.IsNil)
+	r, name, err := dir.Readme()
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	c.Assert(name, gc.Equals, "README.md")
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "# markdown")
+}
+
+func (s *CharmDirSuite) TestPebbleLayers(c *gc.C) {
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	layers, err := dir.PebbleLayers()
+	c.Assert(err, gc.IsNil)
+	c.Assert(layers, gc.IsNil)
+
+	layersDir := filepath.Join(charmDir, "layers")
+	err = os.Mkdir(layersDir, 0755)
+	c.Assert(err, gc.IsNil)
+	files := map[string]string{
+		"001-base.yaml":  "services: {web: {override: replace, command: /bin/web}}",
+		"002-bad.yaml":   "services: {web: {override: replace}}",
+		"badname.yaml":   "services: {}",
+		"README.md":      "not a layer",
+		"003-empty.yaml": "",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(layersDir, name), []byte(content), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+
+	layers, err = dir.PebbleLayers()
+	c.Assert(err, gc.FitsTypeOf, &charm.VerificationError{})
+	errs := err.(*charm.VerificationError).Errors
+	c.Assert(errs, gc.HasLen, 2)
+	c.Assert(errs[0], gc.ErrorMatches, `002-bad.yaml: pebble service "web": command must be specified when replacing`)
+	c.Assert(errs[1], gc.ErrorMatches, `invalid pebble layer file name "badname.yaml"`)
+	c.Assert(layers, gc.HasLen, 2)
+	c.Assert(layers["001-base.yaml"].Services["web"].Command, gc.Equals, "/bin/web")
+	c.Assert(layers["003-empty.yaml"], gc.NotNil)
+}
+
 func (s *CharmDirSuite) TestDirRevisionFile(c *gc.C) {
 	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
 	revPath := filepath.Join(charmDir, "revision")
@@ -316,3 +531,55 @@ func (s *CharmDirSuite) TestDirSetDiskRevision(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(dir.Revision(), gc.Equals, 42)
 }
+
+func (s *CharmDirSuite) TestDirSetDiskRevisionReadOnly(c *gc.C) {
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.ReadOnly(), gc.Equals, false)
+
+	dir.SetReadOnly(true)
+	c.Assert(dir.ReadOnly(), gc.Equals, true)
+	err = dir.SetDiskRevision(42)
+	c.Assert(err, gc.Equals, charm.ErrReadOnly)
+	c.Assert(dir.Revision(), gc.Equals, 1)
+
+	dir, err = charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Revision(), gc.Equals, 1)
+}
+
+func (s *CharmDirSuite) TestDirClone(c *gc.C) {
+	charmDir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	dir.SetReadOnly(true)
+	dir.SetRevision(7)
+
+	dest := filepath.Join(c.MkDir(), "clone")
+	clone, err := dir.Clone(dest)
+	c.Assert(err, gc.IsNil)
+	c.Assert(clone.Path, gc.Equals, dest)
+	c.Assert(clone.ReadOnly(), gc.Equals, false)
+	c.Assert(clone.Revision(), gc.Equals, 7)
+	c.Assert(clone.Meta(), gc.DeepEquals, dir.Meta())
+
+	err = clone.SetDiskRevision(42)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Revision(), gc.Equals, 7)
+
+	dir, err = charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Revision(), gc.Equals, 1)
+	clone, err = charm.ReadCharmDir(dest)
+	c.Assert(err, gc.IsNil)
+	c.Assert(clone.Revision(), gc.Equals, 42)
+}
+
+func (s *CharmDirSuite) TestDirCloneExistingDestination(c *gc.C) {
+	dir, err := charm.ReadCharmDir(TestCharms.CharmDirPath("dummy"))
+	c.Assert(err, gc.IsNil)
+	dest := c.MkDir()
+	_, err = dir.Clone(dest)
+	c.Assert(err, gc.ErrorMatches, `cannot clone charm to ".*": destination already exists`)
+}
@@ -0,0 +1,325 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build fsnotify
+// +build fsnotify
+
+package charm
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+// WatchEventKind identifies the kind of a WatchEvent.
+type WatchEventKind string
+
+const (
+	// EventMetadataChanged is sent when metadata.yaml changes.
+	EventMetadataChanged WatchEventKind = "metadata-changed"
+
+	// EventConfigChanged is sent when config.yaml changes.
+	EventConfigChanged WatchEventKind = "config-changed"
+
+	// EventActionsChanged is sent when actions.yaml, or the
+	// deprecated functions.yaml, changes.
+	EventActionsChanged WatchEventKind = "actions-changed"
+
+	// EventHookAdded is sent when a hook is created.
+	EventHookAdded WatchEventKind = "hook-added"
+
+	// EventHookRemoved is sent when a hook is removed.
+	EventHookRemoved WatchEventKind = "hook-removed"
+
+	// EventHookChanged is sent when the contents or the
+	// mode of a hook change.
+	EventHookChanged WatchEventKind = "hook-changed"
+
+	// EventFileChanged is sent when any other file
+	// in the charm is created, changed or removed.
+	EventFileChanged WatchEventKind = "file-changed"
+
+	// EventValidationFailing is sent when the charm fails
+	// to be read or validated after a change, with a
+	// different error than before.
+	EventValidationFailing WatchEventKind = "validation-failing"
+
+	// EventValidationPassing is sent when the charm is
+	// read and validated successfully after failing to.
+	EventValidationPassing WatchEventKind = "validation-passing"
+
+	// EventWatchError is sent when the underlying
+	// file system watcher reports an error.
+	EventWatchError WatchEventKind = "watch-error"
+)
+
+// WatchEvent describes a change seen by a CharmDirWatcher.
+type WatchEvent struct {
+	// Kind holds the kind of the event.
+	Kind WatchEventKind
+
+	// Path holds the slash-separated path, relative to the
+	// charm directory, of the file that changed. It is empty
+	// for validation and watch error events.
+	Path string
+
+	// Err holds the error for EventValidationFailing
+	// and EventWatchError events.
+	Err error
+}
+
+// CharmDirWatcher depends on gopkg.in/fsnotify.v1. So that it is not
+// a dependency of every user of this package, the watcher is only
+// built with the fsnotify build tag.
+
+// watchDebounce holds the time a CharmDirWatcher waits for changes
+// to settle before reporting them, so that editors writing several
+// files at once cause a single validation.
+var watchDebounce = 100 * time.Millisecond
+
+// CharmDirWatcher watches a charm directory for changes, reporting
+// them as events and validating the charm after each batch of
+// changes. It is intended for development tools that reload charms
+// as they are edited.
+type CharmDirWatcher struct {
+	path    string
+	watcher *fsnotify.Watcher
+	events  chan WatchEvent
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	// stopOnce guards the stopping of the watcher,
+	// and stopErr holds the error returned by Stop.
+	stopOnce sync.Once
+	stopErr  error
+
+	// mu guards the fields below.
+	mu      sync.Mutex
+	charm   *CharmDir
+	lastErr error
+}
+
+// NewCharmDirWatcher starts watching the charm directory at path.
+// The charm is read and validated immediately; if that fails, the
+// first event sent is an EventValidationFailing event. The watcher
+// must be stopped with Stop when it is no longer needed.
+func NewCharmDirWatcher(path string) (*CharmDirWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &CharmDirWatcher{
+		path:    path,
+		watcher: watcher,
+		events:  make(chan WatchEvent),
+		done:    make(chan struct{}),
+	}
+	if err := w.addDirs(path); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	var initial []WatchEvent
+	if ev, ok := w.validate(); ok {
+		initial = append(initial, ev)
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.loop(initial)
+	}()
+	return w, nil
+}
+
+// Events returns the channel on which changes are reported. It is
+// closed when the watcher is stopped.
+func (w *CharmDirWatcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Charm returns the charm as last read and validated successfully,
+// or nil if it has never been.
+func (w *CharmDirWatcher) Charm() *CharmDir {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.charm
+}
+
+// Err returns the error from the last attempt to read and validate
+// the charm, or nil if it succeeded.
+func (w *CharmDirWatcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastErr
+}
+
+// Stop stops the watcher and closes its events channel. It may be
+// called more than once, returning the same error each time.
+func (w *CharmDirWatcher) Stop() error {
+	w.stopOnce.Do(func() {
+		close(w.done)
+		w.stopErr = w.watcher.Close()
+		w.wg.Wait()
+	})
+	return w.stopErr
+}
+
+// addDirs adds watches for dir and all the directories below it.
+func (w *CharmDirWatcher) addDirs(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			// Ignore version control and editor directories.
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+func (w *CharmDirWatcher) loop(pending []WatchEvent) {
+	defer close(w.events)
+	changes := make(map[string]fsnotify.Op)
+	var settled <-chan time.Time
+	for {
+		var out chan WatchEvent
+		var next WatchEvent
+		if len(pending) > 0 {
+			out, next = w.events, pending[0]
+		}
+		select {
+		case <-w.done:
+			return
+		case out <- next:
+			pending = pending[1:]
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					w.addDirs(ev.Name)
+				}
+			}
+			changes[ev.Name] |= ev.Op
+			settled = time.After(watchDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			pending = append(pending, WatchEvent{
+				Kind: EventWatchError,
+				Err:  err,
+			})
+		case <-settled:
+			settled = nil
+			pending = append(pending, w.changeEvents(changes)...)
+			changes = make(map[string]fsnotify.Op)
+			if ev, ok := w.validate(); ok {
+				pending = append(pending, ev)
+			}
+		}
+	}
+}
+
+// changeEvents returns the events describing the given changes,
+// ordered by path.
+func (w *CharmDirWatcher) changeEvents(changes map[string]fsnotify.Op) []WatchEvent {
+	var events []WatchEvent
+	for name, op := range changes {
+		rel, err := filepath.Rel(w.path, name)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if isHiddenPath(rel) {
+			continue
+		}
+		events = append(events, WatchEvent{
+			Kind: changeKind(rel, op),
+			Path: rel,
+		})
+	}
+	sort.Sort(watchEventsByPath(events))
+	return events
+}
+
+// isHiddenPath reports whether any element of the
+// given slash-separated path starts with a dot.
+func isHiddenPath(p string) bool {
+	for _, elem := range strings.Split(p, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// changeKind returns the kind of event describing the change
+// made by op to the file at the given relative path.
+func changeKind(rel string, op fsnotify.Op) WatchEventKind {
+	switch rel {
+	case MetadataFile:
+		return EventMetadataChanged
+	case ConfigFile:
+		return EventConfigChanged
+	case ActionsFile, FunctionsFile:
+		return EventActionsChanged
+	}
+	if dir, name := filepath.Split(filepath.FromSlash(rel)); filepath.Clean(dir) == HooksDir && name != "" {
+		switch {
+		case op&(fsnotify.Remove|fsnotify.Rename) != 0:
+			return EventHookRemoved
+		case op&fsnotify.Create != 0:
+			return EventHookAdded
+		default:
+			return EventHookChanged
+		}
+	}
+	return EventFileChanged
+}
+
+// validate reads and validates the charm, recording the result. It
+// returns an event and true if the result differs from the previous
+// one.
+func (w *CharmDirWatcher) validate() (WatchEvent, bool) {
+	dir, err := ReadCharmDir(w.path)
+	if err == nil {
+		err = Validate(dir)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lastErr := w.lastErr
+	w.lastErr = err
+	if err != nil {
+		if lastErr != nil && lastErr.Error() == err.Error() {
+			return WatchEvent{}, false
+		}
+		return WatchEvent{
+			Kind: EventValidationFailing,
+			Err:  err,
+		}, true
+	}
+	w.charm = dir
+	if lastErr == nil {
+		return WatchEvent{}, false
+	}
+	return WatchEvent{
+		Kind: EventValidationPassing,
+	}, true
+}
+
+type watchEventsByPath []WatchEvent
+
+func (evs watchEventsByPath) Len() int           { return len(evs) }
+func (evs watchEventsByPath) Swap(i, j int)      { evs[i], evs[j] = evs[j], evs[i] }
+func (evs watchEventsByPath) Less(i, j int) bool { return evs[i].Path < evs[j].Path }
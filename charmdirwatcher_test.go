@@ -0,0 +1,129 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build fsnotify
+// +build fsnotify
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type CharmDirWatcherSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&CharmDirWatcherSuite{})
+
+func (s *CharmDirWatcherSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchValue(charm.WatchDebounce, 10*time.Millisecond)
+}
+
+// nextEvents returns the events received from w up to and
+// including the first event of the given kind.
+func nextEvents(c *gc.C, w *charm.CharmDirWatcher, kind charm.WatchEventKind) []charm.WatchEvent {
+	var events []charm.WatchEvent
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev, ok := <-w.Events():
+			c.Assert(ok, gc.Equals, true)
+			events = append(events, ev)
+			if ev.Kind == kind {
+				return events
+			}
+		case <-timeout:
+			c.Fatalf("timed out waiting for %s event; got %#v", kind, events)
+		}
+	}
+}
+
+func eventKinds(events []charm.WatchEvent) map[charm.WatchEventKind]string {
+	kinds := make(map[charm.WatchEventKind]string)
+	for _, ev := range events {
+		kinds[ev.Kind] = ev.Path
+	}
+	return kinds
+}
+
+func (s *CharmDirWatcherSuite) TestWatch(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Mkdir(filepath.Join(path, "actions"), 0755)
+	c.Assert(err, gc.IsNil)
+
+	w, err := charm.NewCharmDirWatcher(path)
+	c.Assert(err, gc.IsNil)
+	defer w.Stop()
+
+	// The dummy charm has no script for its snapshot action.
+	events := nextEvents(c, w, charm.EventValidationFailing)
+	c.Assert(events, gc.HasLen, 1)
+	c.Assert(events[0].Err, gc.ErrorMatches, `charm is inconsistent: .*"snapshot" has no script.*`)
+	c.Assert(w.Charm(), gc.IsNil)
+	c.Assert(w.Err(), gc.NotNil)
+
+	err = ioutil.WriteFile(filepath.Join(path, "actions", "snapshot"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	events = nextEvents(c, w, charm.EventValidationPassing)
+	c.Assert(eventKinds(events)[charm.EventFileChanged], gc.Equals, "actions/snapshot")
+	c.Assert(w.Charm(), gc.NotNil)
+	c.Assert(w.Err(), gc.IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(path, "hooks", "start"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	events = nextEvents(c, w, charm.EventHookAdded)
+	c.Assert(events[len(events)-1].Path, gc.Equals, "hooks/start")
+
+	err = os.Remove(filepath.Join(path, "hooks", "start"))
+	c.Assert(err, gc.IsNil)
+	events = nextEvents(c, w, charm.EventHookRemoved)
+	c.Assert(events[len(events)-1].Path, gc.Equals, "hooks/start")
+
+	err = ioutil.WriteFile(filepath.Join(path, "metadata.yaml"), []byte("name: dummy\nsummary: changed\ndescription: changed\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	nextEvents(c, w, charm.EventMetadataChanged)
+	// Wait for the new metadata to be read.
+	for a := testing.LongAttempt.Start(); a.Next(); {
+		if w.Charm().Meta().Summary == "changed" {
+			break
+		}
+	}
+	c.Assert(w.Charm().Meta().Summary, gc.Equals, "changed")
+
+	err = ioutil.WriteFile(filepath.Join(path, "metadata.yaml"), []byte("name: dummy\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	events = nextEvents(c, w, charm.EventValidationFailing)
+	c.Assert(eventKinds(events)[charm.EventMetadataChanged], gc.Equals, "metadata.yaml")
+	c.Assert(events[len(events)-1].Err, gc.ErrorMatches, `metadata: .*`)
+	// The last valid charm is still available.
+	c.Assert(w.Charm().Meta().Summary, gc.Equals, "changed")
+}
+
+func (s *CharmDirWatcherSuite) TestStop(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "wordpress")
+	w, err := charm.NewCharmDirWatcher(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(w.Charm(), gc.NotNil)
+	err = w.Stop()
+	c.Assert(err, gc.IsNil)
+	_, ok := <-w.Events()
+	c.Assert(ok, gc.Equals, false)
+	// Stopping the watcher again has no effect.
+	err = w.Stop()
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CharmDirWatcherSuite) TestNotFound(c *gc.C) {
+	_, err := charm.NewCharmDirWatcher(filepath.Join(c.MkDir(), "missing"))
+	c.Assert(err, gc.NotNil)
+}
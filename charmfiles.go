@@ -0,0 +1,105 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrNoIcon is returned by the Icon methods when the charm
+// has no icon.svg file.
+var ErrNoIcon = errors.New("charm has no icon")
+
+// ErrNoReadme is returned by the Readme methods when the charm
+// or bundle has no README file.
+var ErrNoReadme = errors.New("charm has no README file")
+
+// readmeFiles holds the names of the files recognized as the README
+// of a charm or bundle, in order of preference.
+var readmeFiles = []string{ReadmeFile, ReadmeRSTFile, ReadmeTextFile}
+
+// findReadme returns the name of the preferred README file among the
+// names of the files at the root of a charm or bundle, or the empty
+// string if there is none. Names are matched case-insensitively.
+func findReadme(names []string) string {
+	for _, readme := range readmeFiles {
+		for _, name := range names {
+			if strings.EqualFold(name, readme) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// readActionsFiles reads the actions of the charm with the given name,
+// using open to open its files and isNotExist to recognize the errors
+// returned for missing files. Actions are read from ActionsFile or,
+// failing that, from FunctionsFile. If neither file exists, empty
+// actions are returned.
+func readActionsFiles(charmName string, open func(name string) (io.ReadCloser, error), isNotExist func(error) bool) (*Actions, error) {
+	r, err := open(ActionsFile)
+	switch {
+	case err == nil:
+		defer r.Close()
+		if fr, err := open(FunctionsFile); err == nil {
+			fr.Close()
+			logger.Warningf("charm %q has both %s and %s; ignoring %s", charmName, ActionsFile, FunctionsFile, FunctionsFile)
+		}
+		return ReadActionsYaml(r)
+	case !isNotExist(err):
+		return nil, err
+	}
+	r, err = open(FunctionsFile)
+	switch {
+	case err == nil:
+		defer r.Close()
+		logger.Warningf("charm %q uses deprecated %s; rename it to %s", charmName, FunctionsFile, ActionsFile)
+		return ReadActionsYaml(r)
+	case !isNotExist(err):
+		return nil, err
+	}
+	return NewActions(), nil
+}
+
+// sniffIcon reads the start of the icon from rc and returns a reader
+// holding the whole icon along with its detected content type.
+func sniffIcon(rc io.ReadCloser) (io.ReadCloser, string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		rc.Close()
+		return nil, "", err
+	}
+	head = head[:n]
+	return &multiReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(head), rc),
+		Closer: rc,
+	}, iconContentType(head), nil
+}
+
+// iconContentType returns the content type of an icon starting with
+// the given data. SVG images are not recognized by
+// http.DetectContentType, so they are detected separately.
+func iconContentType(head []byte) string {
+	if bytes.Contains(head, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	return http.DetectContentType(head)
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,145 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FS returns a read-only view of the files in the charm directory,
+// suitable for use with generic code such as fs.WalkDir or
+// http.FS. Files are read from disk when they are opened, so the
+// view reflects changes made to the directory after it was read.
+func (dir *CharmDir) FS() fs.FS {
+	return dirFS{
+		FS:   os.DirFS(dir.Path),
+		path: dir.Path,
+	}
+}
+
+// dirFS implements fs.FS on top of a charm directory, also
+// giving access to the targets of its symlinks.
+type dirFS struct {
+	fs.FS
+	path string
+}
+
+// ReadLink returns the target of the symlink with the given name.
+func (dfs dirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(dfs.path, filepath.FromSlash(name)))
+}
+
+// readLink returns the target of the symlink at p in fsys. Charm
+// archives hold the target of each symlink as its content.
+func readLink(fsys fs.FS, p string) (string, error) {
+	if lfs, ok := fsys.(interface {
+		ReadLink(name string) (string, error)
+	}); ok {
+		return lfs.ReadLink(p)
+	}
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// FS returns a read-only view of the files in the charm archive,
+// suitable for use with generic code such as fs.WalkDir or http.FS.
+// Directories are presented even when the archive holds no entries
+// for them. The archive is opened afresh for each file, and any
+// error reading it is returned from Open.
+func (a *CharmArchive) FS() fs.FS {
+	return archiveFS{a.zopen}
+}
+
+// archiveFS implements fs.FS on top of a charm archive.
+type archiveFS struct {
+	zopen zipOpener
+}
+
+// Open implements fs.FS.Open.
+func (afs archiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	zipr, err := afs.zopen.openZip()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	f, err := zipr.Reader.Open(name)
+	if err != nil {
+		zipr.Close()
+		return nil, err
+	}
+	return &archiveFile{File: f, zipr: zipr}, nil
+}
+
+// archiveFile is a file opened by archiveFS. Closing it
+// also closes the archive it was read from.
+type archiveFile struct {
+	fs.File
+	zipr *zipReadCloser
+}
+
+// ReadDir implements fs.ReadDirFile.ReadDir.
+func (f *archiveFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name(), Err: fs.ErrInvalid}
+	}
+	return d.ReadDir(n)
+}
+
+// Close implements fs.File.Close.
+func (f *archiveFile) Close() error {
+	err := f.File.Close()
+	if zerr := f.zipr.Close(); err == nil {
+		err = zerr
+	}
+	return err
+}
+
+func (f *archiveFile) name() string {
+	if info, err := f.File.Stat(); err == nil {
+		return info.Name()
+	}
+	return ""
+}
+
+var (
+	_ interface{ FS() fs.FS } = (*CharmDir)(nil)
+	_ interface{ FS() fs.FS } = (*CharmArchive)(nil)
+)
+
+// walkCharmFiles calls fn with the slash-separated path of each
+// regular file and symlink in fsys, in lexical order. As when a
+// charm directory is archived, hidden files and directories at the
+// top level of the charm and the build directory are skipped.
+func walkCharmFiles(fsys fs.FS, fn func(p string, d fs.DirEntry) error) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if strings.HasPrefix(p, ".") || d.IsDir() && p == "build" {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		return fn(p, d)
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing/fstest"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type CharmFSSuite struct{}
+
+var _ = gc.Suite(&CharmFSSuite{})
+
+func (s *CharmFSSuite) TestCharmDirFS(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	s.checkDummyFS(c, dir.FS())
+}
+
+func (s *CharmFSSuite) TestCharmArchiveFS(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	s.checkDummyFS(c, archive.FS())
+}
+
+func (s *CharmFSSuite) TestCharmArchiveBytesFS(c *gc.C) {
+	archive := archiveDir(c, TestCharms.ClonedDirPath(c.MkDir(), "dummy"))
+	s.checkDummyFS(c, archive.FS())
+}
+
+func (s *CharmFSSuite) TestCharmArchiveFSNotFound(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	_, err = archive.FS().Open("no-such-file")
+	c.Assert(err, jc.Satisfies, func(err error) bool {
+		return errors.Is(err, fs.ErrNotExist)
+	})
+	_, err = archive.FS().Open("../metadata.yaml")
+	c.Assert(err, jc.Satisfies, func(err error) bool {
+		return errors.Is(err, fs.ErrInvalid)
+	})
+}
+
+func (s *CharmFSSuite) checkDummyFS(c *gc.C, fsys fs.FS) {
+	err := fstest.TestFS(fsys, "metadata.yaml", "config.yaml", "hooks/install", "src/hello.c")
+	c.Assert(err, gc.IsNil)
+
+	data, err := fs.ReadFile(fsys, "metadata.yaml")
+	c.Assert(err, gc.IsNil)
+	meta, err := charm.ReadMeta(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "dummy")
+
+	var hooks []string
+	err = fs.WalkDir(fsys, "hooks", func(path string, d fs.DirEntry, err error) error {
+		c.Assert(err, gc.IsNil)
+		if !d.IsDir() {
+			hooks = append(hooks, path)
+		}
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(hooks, gc.DeepEquals, []string{"hooks/install"})
+}
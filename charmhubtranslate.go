@@ -0,0 +1,81 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+// CharmhubStableChannel holds the Charmhub channel that migrated
+// charm store charms are deployed from.
+const CharmhubStableChannel = "stable"
+
+// CharmhubTranslation holds the Charmhub equivalent of a charm
+// store URL, as returned by TranslateToCharmhub.
+type CharmhubTranslation struct {
+	// Reference holds the Charmhub reference of the charm. It
+	// never specifies a user, a series or a revision.
+	Reference *Reference
+
+	// BaseOS and BaseChannel hold the base that replaces the
+	// series of the charm store URL, such as "ubuntu" and
+	// "20.04". They are empty for bundles.
+	BaseOS      string
+	BaseChannel string
+
+	// Channel holds the Charmhub channel to deploy from.
+	Channel string
+}
+
+// TranslateToCharmhub converts the given charm store (cs:) URL into
+// its Charmhub equivalent, following the rules used when migrating
+// models from the charm store:
+//
+//   - the aliases, if not nil, are applied first, so that renamed
+//     charms and charms owned by users can be mapped explicitly;
+//   - the user is dropped; charms still owned by a user after the
+//     aliases are applied cannot be translated, as only promulgated
+//     charms were migrated;
+//   - the revision is dropped, as Charmhub revisions are unrelated
+//     to charm store ones;
+//   - the series is replaced by the equivalent base;
+//   - the charm is deployed from the stable channel.
+//
+// An error is returned if the URL is not a charm store URL or if it
+// cannot be translated.
+func TranslateToCharmhub(csURL *URL, aliases *URLAliases) (*CharmhubTranslation, error) {
+	if csURL.Schema != "cs" {
+		return nil, errorCodef(CodeInvalidSchema, "cannot translate %q: not a charm store URL", csURL)
+	}
+	ref := csURL.Reference()
+	if aliases != nil {
+		ref = aliases.RewriteReference(ref)
+	}
+	switch ref.Schema {
+	case "cs":
+		if ref.User != "" {
+			return nil, errorCodef(CodeUserNotAllowed, "cannot translate %q: charms owned by users are not available on Charmhub", csURL)
+		}
+	case "ch":
+	default:
+		return nil, errorCodef(CodeInvalidSchema, "cannot translate %q: alias refers to %q", csURL, ref)
+	}
+	t := &CharmhubTranslation{
+		Reference: &Reference{
+			Schema:   "ch",
+			Name:     ref.Name,
+			Revision: -1,
+		},
+		Channel: CharmhubStableChannel,
+	}
+	if ref.Series == "bundle" {
+		return t, nil
+	}
+	info, err := LookupSeries(ref.Series)
+	if err != nil {
+		return nil, annotateCodef(CodeUnknownSeries, err, "cannot translate %q: %v", csURL, err)
+	}
+	if info.Version == "" {
+		return nil, errorCodef(CodeUnknownSeries, "cannot translate %q: series %q has no equivalent base", csURL, ref.Series)
+	}
+	t.BaseOS = string(info.OS)
+	t.BaseChannel = info.Version
+	return t, nil
+}
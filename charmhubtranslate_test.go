@@ -0,0 +1,102 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type CharmhubTranslateSuite struct{}
+
+var _ = gc.Suite(&CharmhubTranslateSuite{})
+
+var translateToCharmhubTests = []struct {
+	url         string
+	expectRef   string
+	expectOS    string
+	expectBase  string
+	expectError string
+	expectCode  string
+}{{
+	url:        "cs:focal/mysql-42",
+	expectRef:  "ch:mysql",
+	expectOS:   "ubuntu",
+	expectBase: "20.04",
+}, {
+	url:        "cs:centos7/postgresql",
+	expectRef:  "ch:postgresql",
+	expectOS:   "centos",
+	expectBase: "7",
+}, {
+	url:       "cs:bundle/wordpress-simple-3",
+	expectRef: "ch:wordpress-simple",
+}, {
+	// Aliases map user charms explicitly.
+	url:        "cs:~joe/xenial/percona-3",
+	expectRef:  "ch:percona-cluster",
+	expectOS:   "ubuntu",
+	expectBase: "16.04",
+}, {
+	url:        "cs:trusty/old-mysql",
+	expectRef:  "ch:mysql",
+	expectOS:   "ubuntu",
+	expectBase: "14.04",
+}, {
+	url:         "cs:~bob/focal/mysql",
+	expectError: `cannot translate "cs:~bob/focal/mysql": charms owned by users are not available on Charmhub`,
+	expectCode:  charm.CodeUserNotAllowed,
+}, {
+	url:         "ch:focal/mysql",
+	expectError: `cannot translate "ch:focal/mysql": not a charm store URL`,
+	expectCode:  charm.CodeInvalidSchema,
+}, {
+	url:         "cs:kubernetes/mariadb",
+	expectError: `cannot translate "cs:kubernetes/mariadb": series "kubernetes" has no equivalent base`,
+	expectCode:  charm.CodeUnknownSeries,
+}, {
+	url:         "cs:nosuch/mysql",
+	expectError: `cannot translate "cs:nosuch/mysql": unknown series "nosuch"`,
+	expectCode:  charm.CodeUnknownSeries,
+}}
+
+func (s *CharmhubTranslateSuite) TestTranslateToCharmhub(c *gc.C) {
+	aliases := charm.NewURLAliases()
+	err := aliases.Add("cs:~joe/percona", "ch:percona-cluster")
+	c.Assert(err, gc.IsNil)
+	err = aliases.Add("cs:old-mysql", "cs:mysql")
+	c.Assert(err, gc.IsNil)
+
+	for i, test := range translateToCharmhubTests {
+		c.Logf("test %d: %s", i, test.url)
+		t, err := charm.TranslateToCharmhub(charm.MustParseURL(test.url), aliases)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			c.Assert(charm.ErrorCode(err), gc.Equals, test.expectCode)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(t.Reference.String(), gc.Equals, test.expectRef)
+		c.Assert(t.BaseOS, gc.Equals, test.expectOS)
+		c.Assert(t.BaseChannel, gc.Equals, test.expectBase)
+		c.Assert(t.Channel, gc.Equals, charm.CharmhubStableChannel)
+	}
+}
+
+func (s *CharmhubTranslateSuite) TestTranslateToCharmhubWithoutAliases(c *gc.C) {
+	t, err := charm.TranslateToCharmhub(charm.MustParseURL("cs:bionic/wordpress-3"), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(t, jc.DeepEquals, &charm.CharmhubTranslation{
+		Reference: &charm.Reference{
+			Schema:   "ch",
+			Name:     "wordpress",
+			Revision: -1,
+		},
+		BaseOS:      "ubuntu",
+		BaseChannel: "18.04",
+		Channel:     "stable",
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// DeploymentPlan holds everything needed to deploy a bundle,
+// as returned by ResolveAll.
+type DeploymentPlan struct {
+	// Charms maps each charm URL used in the bundle
+	// to its fully resolved URL.
+	Charms map[string]*charm.URL
+
+	// Services holds the services of the bundle, in deployment
+	// order as returned by charm.DeployOrderWithCharms: each
+	// service comes after the services it depends on.
+	Services []*PlannedService
+
+	// Relations holds the relations of the bundle, sorted,
+	// with the endpoints of each relation sorted.
+	Relations [][]string
+}
+
+// PlannedService holds a service of a deployment plan.
+type PlannedService struct {
+	// Name holds the name of the service in the bundle.
+	Name string
+
+	// URL holds the fully resolved URL of the service charm.
+	URL *charm.URL
+
+	// Charm holds the service charm.
+	Charm charm.Charm
+
+	// Spec holds the service specification in the bundle.
+	Spec *charm.ServiceSpec
+}
+
+// ResolveAll resolves the charms of all the services in the given
+// bundle to exact revisions in repo, retrieves them, verifies the
+// bundle against them, and returns the resulting deployment plan.
+//
+// Charm URLs with no series are resolved with the series of the
+// bundle, if any. If the verification fails, the returned error
+// is a *charm.VerificationError describing all the problems found.
+func ResolveAll(bd *charm.BundleData, repo Interface) (*DeploymentPlan, error) {
+	plan := &DeploymentPlan{
+		Charms: make(map[string]*charm.URL),
+	}
+	charms := make(map[string]charm.Charm)
+	for _, id := range bd.RequiredCharms() {
+		if _, ok := charms[id]; ok {
+			continue
+		}
+		url, ch, err := getBundleCharm(bd, repo, id)
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		plan.Charms[id] = url
+		charms[id] = ch
+	}
+	if err := bd.VerifyWithCharms(nil, charms); err != nil {
+		return nil, err
+	}
+	names, err := charm.DeployOrderWithCharms(bd, charms)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	for _, name := range names {
+		spec := bd.Services[name]
+		plan.Services = append(plan.Services, &PlannedService{
+			Name:  name,
+			URL:   plan.Charms[spec.Charm],
+			Charm: charms[spec.Charm],
+			Spec:  spec,
+		})
+	}
+	for _, rel := range bd.Relations {
+		rel = append([]string(nil), rel...)
+		sort.Strings(rel)
+		plan.Relations = append(plan.Relations, rel)
+	}
+	sort.Sort(relationsByEndpoints(plan.Relations))
+	return plan, nil
+}
+
+// getBundleCharm resolves the charm with the given id, as used in
+// the given bundle, and retrieves it from repo. Charm URLs with no
+// series are resolved with the series of the bundle, if any. When
+// repo is a charm store, the charm is retrieved from the channel of
+// the services using it, if they specify one.
+func getBundleCharm(bd *charm.BundleData, repo Interface, id string) (*charm.URL, charm.Charm, error) {
+	ref, err := charm.ParseReference(id)
+	if err != nil {
+		return nil, nil, errgo.Notef(err, "cannot parse charm URL %q", id)
+	}
+	if cs, ok := repo.(*CharmStoreV5); ok {
+		channel, err := bundleCharmChannel(bd, id)
+		if err != nil {
+			return nil, nil, errgo.Mask(err)
+		}
+		if channel != nil {
+			storeChannel, err := StoreChannel(*channel)
+			if err != nil {
+				return nil, nil, errgo.Notef(err, "cannot resolve charm URL %s", id)
+			}
+			repo = cs.WithChannel(storeChannel)
+		}
+	}
+	if ref.Series == "" {
+		ref.Series = bd.Series
+	}
+	url, err := repo.Resolve(ref)
+	if err != nil {
+		return nil, nil, errgo.NoteMask(err, "cannot resolve charm URL "+id, errgo.Any)
+	}
+	ch, err := repo.Get(url)
+	if err != nil {
+		return nil, nil, errgo.NoteMask(err, "cannot get charm "+url.String(), errgo.Any)
+	}
+	return url, ch, nil
+}
+
+// bundleCharmChannel returns the channel specified by the services
+// using the charm with the given id in the given bundle, or nil if
+// none of them specifies one. The services must not specify
+// different channels.
+func bundleCharmChannel(bd *charm.BundleData, id string) (*charm.Channel, error) {
+	var channel *charm.Channel
+	for _, svc := range bd.Services {
+		if svc.Charm != id || svc.Channel == nil {
+			continue
+		}
+		if channel != nil && channel.Normalize() != svc.Channel.Normalize() {
+			return nil, errgo.Newf("charm %q used with channels %q and %q", id, channel, svc.Channel)
+		}
+		channel = svc.Channel
+	}
+	return channel, nil
+}
+
+// relationsByEndpoints sorts relations by their endpoints.
+type relationsByEndpoints [][]string
+
+func (r relationsByEndpoints) Len() int      { return len(r) }
+func (r relationsByEndpoints) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r relationsByEndpoints) Less(i, j int) bool {
+	return strings.Join(r[i], " ") < strings.Join(r[j], " ")
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type bundlePlanSuite struct {
+	repo charmrepo.Interface
+}
+
+var _ = gc.Suite(&bundlePlanSuite{})
+
+func (s *bundlePlanSuite) SetUpTest(c *gc.C) {
+	root := c.MkDir()
+	seriesPath := filepath.Join(root, "quantal")
+	c.Assert(os.Mkdir(seriesPath, 0777), gc.IsNil)
+	TestCharms.ClonedDirPath(seriesPath, "wordpress")
+	TestCharms.ClonedDirPath(seriesPath, "mysql")
+	s.repo = &charmrepo.LocalRepository{Path: root}
+}
+
+func readBundleData(c *gc.C, data string) *charm.BundleData {
+	bd, err := charm.ReadBundleData(strings.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	return bd
+}
+
+func (s *bundlePlanSuite) TestResolveAll(c *gc.C) {
+	bd := readBundleData(c, `
+series: quantal
+services:
+    blog:
+        charm: local:wordpress
+        num_units: 1
+        to: [db]
+    db:
+        charm: local:quantal/mysql
+        num_units: 1
+    blog2:
+        charm: local:wordpress
+relations:
+    - ["db:server", "blog:db"]
+`)
+	plan, err := charmrepo.ResolveAll(bd, s.repo)
+	c.Assert(err, jc.ErrorIsNil)
+
+	wordpress := charm.MustParseURL("local:quantal/wordpress-3")
+	mysql := charm.MustParseURL("local:quantal/mysql-1")
+	c.Assert(plan.Charms, jc.DeepEquals, map[string]*charm.URL{
+		"local:wordpress":     wordpress,
+		"local:quantal/mysql": mysql,
+	})
+	var names []string
+	for _, svc := range plan.Services {
+		names = append(names, svc.Name)
+		c.Assert(svc.Spec, gc.Equals, bd.Services[svc.Name])
+		c.Assert(svc.Charm.Meta().Name, gc.Equals, svc.URL.Name)
+	}
+	c.Assert(names, jc.DeepEquals, []string{"blog2", "db", "blog"})
+	c.Assert(plan.Services[2].URL, jc.DeepEquals, wordpress)
+	c.Assert(plan.Relations, jc.DeepEquals, [][]string{{"blog:db", "db:server"}})
+}
+
+func (s *bundlePlanSuite) TestResolveAllCharmNotFound(c *gc.C) {
+	bd := readBundleData(c, `
+services:
+    blog:
+        charm: local:quantal/no-such
+`)
+	plan, err := charmrepo.ResolveAll(bd, s.repo)
+	c.Assert(err, gc.ErrorMatches, `cannot resolve charm URL local:quantal/no-such: .*`)
+	c.Assert(plan, gc.IsNil)
+}
+
+func (s *bundlePlanSuite) TestResolveAllVerificationError(c *gc.C) {
+	bd := readBundleData(c, `
+services:
+    blog:
+        charm: local:quantal/wordpress
+        options:
+            no-such-option: 42
+`)
+	plan, err := charmrepo.ResolveAll(bd, s.repo)
+	c.Assert(err, gc.FitsTypeOf, &charm.VerificationError{})
+	c.Assert(plan, gc.IsNil)
+}
+
+func (s *bundlePlanSuite) TestResolveAllCyclicPlacement(c *gc.C) {
+	bd := readBundleData(c, `
+services:
+    blog:
+        charm: local:quantal/wordpress
+        num_units: 1
+        to: [db]
+    db:
+        charm: local:quantal/mysql
+        num_units: 1
+        to: [blog]
+`)
+	plan, err := charmrepo.ResolveAll(bd, s.repo)
+	c.Assert(err, gc.ErrorMatches, `services have cyclic dependencies: blog -> db -> blog`)
+	c.Assert(charm.ErrorCode(errgo.Cause(err)), gc.Equals, charm.CodeDependencyCycle)
+	c.Assert(plan, gc.IsNil)
+}
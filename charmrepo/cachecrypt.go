@@ -0,0 +1,304 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// encryptedArchiveMagic starts the cached archives encrypted with a
+// cache key. It is followed by a random nonce prefix and by the
+// archive, split into segments of encryptedSegmentSize bytes that
+// are each sealed with AES-GCM, so that any part of the archive can
+// be decrypted without reading the rest. The nonce of each segment
+// holds the prefix, the index of the segment and whether it is the
+// last one, so that segments cannot be reordered or dropped. The
+// magic is also used as additional data when sealing.
+const encryptedArchiveMagic = "juju-charm-aes-gcm-1\n"
+
+const (
+	encryptedSegmentSize = 64 * 1024
+	noncePrefixSize      = 7
+)
+
+// newCacheAEAD returns the AES-GCM cipher used to encrypt cached
+// archives with the given key, which must be 16, 24 or 32 bytes long.
+func newCacheAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid cache key")
+	}
+	return cipher.NewGCM(block)
+}
+
+// withCacheKey returns a copy of env which encrypts the archives it
+// stores in the cache using the given key, as described for
+// NewCharmStoreParams.CacheKey. If key is nil, env is returned
+// unchanged.
+func (env cacheEnv) withCacheKey(key []byte) (cacheEnv, error) {
+	if key == nil {
+		return env, nil
+	}
+	aead, err := newCacheAEAD(key)
+	if err != nil {
+		return cacheEnv{}, errgo.Mask(err)
+	}
+	env.aead = aead
+	return env, nil
+}
+
+// encrypted reports whether env encrypts the archives in the cache.
+func (env cacheEnv) encrypted() bool {
+	return env.aead != nil
+}
+
+// segmentNonce returns the nonce of the segment with the given index.
+func segmentNonce(prefix []byte, index int64, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], uint32(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// sealArchive encrypts the archive in the file at path in place,
+// if env has a cache key. It is called once the archive has been
+// verified, before it is moved into the cache. The archive is
+// encrypted a segment at a time, so it is never held in memory.
+func (env cacheEnv) sealArchive(path string) error {
+	if !env.encrypted() {
+		return nil
+	}
+	r, err := env.fs.Open(path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer r.Close()
+	f, err := env.fs.TempFile(filepath.Dir(path), ".seal-")
+	if err != nil {
+		return errgo.Notef(err, "cannot make temporary file")
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+			env.fs.Remove(f.Name())
+		}
+	}()
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return errgo.Notef(err, "cannot generate nonce")
+	}
+	if _, err := f.Write(append([]byte(encryptedArchiveMagic), prefix...)); err != nil {
+		return errgo.Notef(err, "cannot write encrypted archive")
+	}
+	// Read a segment ahead, so that the last
+	// segment is known when it is sealed.
+	segment := make([]byte, encryptedSegmentSize)
+	next := make([]byte, encryptedSegmentSize)
+	n, err := readSegment(r, segment)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	var sealed []byte
+	for index := int64(0); ; index++ {
+		nextn := 0
+		if n == encryptedSegmentSize {
+			if nextn, err = readSegment(r, next); err != nil {
+				return errgo.Mask(err)
+			}
+		}
+		last := nextn == 0
+		sealed = env.aead.Seal(sealed[:0], segmentNonce(prefix, index, last), segment[:n], []byte(encryptedArchiveMagic))
+		if _, err := f.Write(sealed); err != nil {
+			return errgo.Notef(err, "cannot write encrypted archive")
+		}
+		if last {
+			break
+		}
+		segment, next, n = next, segment, nextn
+	}
+	if err := f.Close(); err != nil {
+		return errgo.Notef(err, "cannot write encrypted archive")
+	}
+	if err := env.fs.ReplaceFile(f.Name(), path); err != nil {
+		return errgo.Notef(err, "cannot write encrypted archive")
+	}
+	f = nil
+	return nil
+}
+
+// readSegment reads up to len(buf) bytes from r into buf,
+// returning fewer only at the end of the input.
+func readSegment(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// encryptedArchive gives random access to the decrypted contents of
+// an archive encrypted in the cache, decrypting a segment at a time.
+// The file is opened for each segment read, so nothing needs to be
+// closed once the archive is no longer used.
+type encryptedArchive struct {
+	env      cacheEnv
+	path     string
+	prefix   []byte
+	size     int64
+	segments int64
+
+	// mu guards the last segment read, which is
+	// kept as archives are mostly read sequentially.
+	mu      sync.Mutex
+	index   int64
+	segment []byte
+}
+
+// openEncryptedArchive returns the encrypted archive at path,
+// checking its header.
+func (env cacheEnv) openEncryptedArchive(path string) (*encryptedArchive, error) {
+	info, err := env.fs.Stat(path)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	f, err := env.fs.Open(path)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	defer f.Close()
+	header := make([]byte, len(encryptedArchiveMagic)+noncePrefixSize)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[:len(encryptedArchiveMagic)]) != encryptedArchiveMagic {
+		return nil, errgo.Newf("archive %q is not encrypted", path)
+	}
+	overhead := int64(env.aead.Overhead())
+	body := info.Size() - int64(len(header))
+	segments := (body + encryptedSegmentSize + overhead - 1) / (encryptedSegmentSize + overhead)
+	size := body - segments*overhead
+	if segments == 0 || size < 0 {
+		return nil, errgo.Newf("encrypted archive %q is truncated", path)
+	}
+	return &encryptedArchive{
+		env:      env,
+		path:     path,
+		prefix:   header[len(encryptedArchiveMagic):],
+		size:     size,
+		segments: segments,
+		index:    -1,
+	}, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (a *encryptedArchive) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errgo.Newf("negative offset")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for n < len(buf) {
+		if off >= a.size {
+			return n, io.EOF
+		}
+		index := off / encryptedSegmentSize
+		if err := a.readSegment(index); err != nil {
+			return n, err
+		}
+		copied := copy(buf[n:], a.segment[off-index*encryptedSegmentSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// readSegment reads and decrypts the segment with the given
+// index into a.segment, unless it is already there.
+func (a *encryptedArchive) readSegment(index int64) error {
+	if index == a.index {
+		return nil
+	}
+	a.index = -1
+	f, err := a.env.fs.Open(a.path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer f.Close()
+	overhead := int64(a.env.aead.Overhead())
+	offset := int64(len(encryptedArchiveMagic)+noncePrefixSize) + index*(encryptedSegmentSize+overhead)
+	length := encryptedSegmentSize + overhead
+	if last := a.size - index*encryptedSegmentSize + overhead; last < length {
+		length = last
+	}
+	sealed := make([]byte, length)
+	if ra, ok := f.(io.ReaderAt); ok {
+		var n int
+		if n, err = ra.ReadAt(sealed, offset); n == len(sealed) {
+			err = nil
+		}
+	} else if _, err = io.CopyN(ioutil.Discard, f, offset); err == nil {
+		_, err = io.ReadFull(f, sealed)
+	}
+	if err != nil {
+		return errgo.Newf("encrypted archive %q is truncated", a.path)
+	}
+	nonce := segmentNonce(a.prefix, index, index == a.segments-1)
+	a.segment, err = a.env.aead.Open(a.segment[:0], nonce, sealed, []byte(encryptedArchiveMagic))
+	if err != nil {
+		return errgo.Newf("cannot decrypt archive %q: wrong key or corrupted archive", a.path)
+	}
+	a.index = index
+	return nil
+}
+
+// openArchive opens the cached archive at path for
+// reading, decrypting it if env has a cache key.
+func (env cacheEnv) openArchive(path string) (io.ReadCloser, error) {
+	if !env.encrypted() {
+		return env.fs.Open(path)
+	}
+	a, err := env.openEncryptedArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(io.NewSectionReader(a, 0, a.size)), nil
+}
+
+// readCharmArchive reads the cached charm archive at path. When env
+// has a cache key, the archive is decrypted as it is read, so the
+// Path field of the returned archive is empty.
+func (env cacheEnv) readCharmArchive(path string) (*charm.CharmArchive, error) {
+	if !env.encrypted() {
+		return charm.ReadCharmArchive(path)
+	}
+	a, err := env.openEncryptedArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	return charm.ReadCharmArchiveFromReader(a, a.size)
+}
+
+// readBundleArchive is like readCharmArchive for bundles.
+func (env cacheEnv) readBundleArchive(path string) (*charm.BundleArchive, error) {
+	if !env.encrypted() {
+		return charm.ReadBundleArchive(path)
+	}
+	a, err := env.openEncryptedArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	return charm.ReadBundleArchiveFromReader(a, a.size)
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type cacheCryptSuite struct {
+	dir      string
+	cacheDir string
+	server   *httptest.Server
+}
+
+var _ = gc.Suite(&cacheCryptSuite{})
+
+func (s *cacheCryptSuite) SetUpTest(c *gc.C) {
+	s.dir = c.MkDir()
+	seriesDir := filepath.Join(s.dir, "quantal")
+	c.Assert(os.Mkdir(seriesDir, 0755), gc.IsNil)
+	path := TestCharms.CharmArchivePath(c.MkDir(), "dummy")
+	c.Assert(os.Rename(path, filepath.Join(seriesDir, "dummy.charm")), gc.IsNil)
+	c.Assert(charmrepo.WriteHTTPIndex(s.dir), gc.IsNil)
+	s.server = httptest.NewServer(http.FileServer(http.Dir(s.dir)))
+	s.cacheDir = c.MkDir()
+}
+
+func (s *cacheCryptSuite) TearDownTest(c *gc.C) {
+	s.server.Close()
+}
+
+func (s *cacheCryptSuite) repo(c *gc.C, key []byte) *charmrepo.HTTPRepo {
+	repo, err := charmrepo.NewHTTPRepo(charmrepo.HTTPRepoParams{
+		URL:      s.server.URL,
+		CacheDir: s.cacheDir,
+		CacheKey: key,
+	})
+	c.Assert(err, gc.IsNil)
+	return repo
+}
+
+// cachedArchive returns the content of the only archive in the cache.
+func (s *cacheCryptSuite) cachedArchive(c *gc.C) []byte {
+	paths, err := filepath.Glob(filepath.Join(s.cacheDir, "*.charm"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(paths, gc.HasLen, 1)
+	data, err := ioutil.ReadFile(paths[0])
+	c.Assert(err, gc.IsNil)
+	return data
+}
+
+func (s *cacheCryptSuite) TestEncryptedCache(c *gc.C) {
+	key := bytes.Repeat([]byte{1}, 32)
+	ch, err := s.repo(c, key).Get(charm.MustParseURL("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+
+	// The archive is not stored in the clear.
+	original, err := ioutil.ReadFile(filepath.Join(s.dir, "quantal", "dummy.charm"))
+	c.Assert(err, gc.IsNil)
+	cached := s.cachedArchive(c)
+	c.Assert(bytes.Contains(cached, original[:64]), gc.Equals, false)
+	_, err = charm.ReadCharmArchiveBytes(cached)
+	c.Assert(err, gc.NotNil)
+
+	// The cached archive is used once decrypted and verified:
+	// it is not retrieved again.
+	c.Assert(os.Remove(filepath.Join(s.dir, "quantal", "dummy.charm")), gc.IsNil)
+	ch, err = s.repo(c, key).Get(charm.MustParseURL("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+	c.Assert(s.cachedArchive(c), gc.DeepEquals, cached)
+}
+
+func (s *cacheCryptSuite) TestKeyChange(c *gc.C) {
+	_, err := s.repo(c, nil).Get(charm.MustParseURL("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	plain := s.cachedArchive(c)
+
+	// Archives that cannot be decrypted are retrieved again.
+	for _, b := range []byte{1, 2} {
+		key := bytes.Repeat([]byte{b}, 16)
+		ch, err := s.repo(c, key).Get(charm.MustParseURL("cs:quantal/dummy"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+		c.Assert(s.cachedArchive(c), gc.Not(gc.DeepEquals), plain)
+	}
+}
+
+func (s *cacheCryptSuite) TestLargeArchive(c *gc.C) {
+	// Write an archive spanning several encrypted segments.
+	dir := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	data := make([]byte, 200*1024)
+	_, err := rand.Read(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "big"), data, 0644), gc.IsNil)
+	chDir, err := charm.ReadCharmDir(dir)
+	c.Assert(err, gc.IsNil)
+	f, err := os.Create(filepath.Join(s.dir, "quantal", "dummy.charm"))
+	c.Assert(err, gc.IsNil)
+	err = chDir.ArchiveTo(f)
+	f.Close()
+	c.Assert(err, gc.IsNil)
+	c.Assert(charmrepo.WriteHTTPIndex(s.dir), gc.IsNil)
+
+	key := bytes.Repeat([]byte{1}, 32)
+	for i := 0; i < 2; i++ {
+		ch, err := s.repo(c, key).Get(charm.MustParseURL("cs:quantal/dummy"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(readArchiveFile(c, ch.(*charm.CharmArchive), "big"), gc.DeepEquals, data)
+	}
+	c.Assert(len(s.cachedArchive(c)) > len(data), gc.Equals, true)
+}
+
+func (s *cacheCryptSuite) TestPutEncryptedArchive(c *gc.C) {
+	key := bytes.Repeat([]byte{1}, 32)
+	ch, err := s.repo(c, key).Get(charm.MustParseURL("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.(*charm.CharmArchive).Path, gc.Equals, "")
+
+	dst := &charmrepo.LocalRepository{Path: c.MkDir()}
+	err = dst.Put(charm.MustParseURL("local:quantal/dummy-1"), ch)
+	c.Assert(err, gc.IsNil)
+	put, err := charm.ReadCharmArchive(filepath.Join(dst.Path, "quantal", "dummy-1.charm"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(put.Meta().Name, gc.Equals, "dummy")
+}
+
+// readArchiveFile returns the content of the file
+// with the given name in the archive.
+func readArchiveFile(c *gc.C, ch *charm.CharmArchive, name string) []byte {
+	var buf bytes.Buffer
+	c.Assert(ch.ArchiveTo(&buf), gc.IsNil)
+	zipr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, gc.IsNil)
+	for _, fh := range zipr.File {
+		if fh.Name != name {
+			continue
+		}
+		r, err := fh.Open()
+		c.Assert(err, gc.IsNil)
+		defer r.Close()
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, gc.IsNil)
+		return data
+	}
+	c.Fatalf("file %q not found in archive", name)
+	return nil
+}
+
+func (s *cacheCryptSuite) TestInvalidKey(c *gc.C) {
+	_, err := charmrepo.NewHTTPRepo(charmrepo.HTTPRepoParams{
+		URL:      s.server.URL,
+		CacheDir: s.cacheDir,
+		CacheKey: []byte("short"),
+	})
+	c.Assert(err, gc.ErrorMatches, `invalid cache key: crypto/aes: invalid key size 5`)
+}
+
+func (s *cacheCryptSuite) TestNotSupportedByV5(c *gc.C) {
+	c.Assert(func() {
+		charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+			URL:        s.server.URL,
+			APIVersion: 5,
+			CacheDir:   s.cacheDir,
+			CacheKey:   bytes.Repeat([]byte{1}, 32),
+		})
+	}, gc.PanicMatches, `cache encryption not supported by version 5 of the charm store API`)
+}
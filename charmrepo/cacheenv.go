@@ -0,0 +1,175 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"crypto/cipher"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/juju/utils"
+)
+
+// Clock provides the current time to the charm stores and the cache
+// code, so that tests can simulate the expiry of cached revisions
+// without waiting for it.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// WallClock is the Clock used when none is specified.
+// It returns the time of the system.
+var WallClock Clock = wallClock{}
+
+type wallClock struct{}
+
+// Now implements Clock.Now.
+func (wallClock) Now() time.Time {
+	return timeNow()
+}
+
+// FileSystem provides the file system operations made by the charm
+// stores on cache directories, and by the cache index and revision
+// cache kept in them, so that tests can simulate failures such as
+// full disks or denied permissions. As the archives in the cache are
+// read with the charm package, implementations are expected to wrap
+// OSFileSystem rather than replace it.
+type FileSystem interface {
+	// Open opens the named file for reading.
+	Open(name string) (io.ReadCloser, error)
+
+	// ReadFile returns the contents of the named file.
+	ReadFile(name string) ([]byte, error)
+
+	// WriteFile atomically replaces the named file
+	// with one holding the given data.
+	WriteFile(name string, data []byte, perm os.FileMode) error
+
+	// MkdirAll creates the named directory,
+	// along with any necessary parents.
+	MkdirAll(name string, perm os.FileMode) error
+
+	// ReadDir returns the entries of the named
+	// directory, sorted by name.
+	ReadDir(name string) ([]os.FileInfo, error)
+
+	// Stat returns information about the named file.
+	Stat(name string) (os.FileInfo, error)
+
+	// Remove removes the named file.
+	Remove(name string) error
+
+	// TempFile creates a new temporary file in dir, whose name
+	// starts with prefix, and opens it for writing.
+	TempFile(dir, prefix string) (TempFile, error)
+
+	// ReplaceFile atomically replaces the file
+	// at newpath with the one at oldpath.
+	ReplaceFile(oldpath, newpath string) error
+}
+
+// TempFile is a temporary file created by FileSystem.TempFile.
+type TempFile interface {
+	io.WriteCloser
+
+	// Name returns the path of the file.
+	Name() string
+}
+
+// OSFileSystem is the FileSystem used when none is specified.
+// It operates on the file system of the operating system.
+var OSFileSystem FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+// Open implements FileSystem.Open.
+func (osFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// ReadFile implements FileSystem.ReadFile.
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+// WriteFile implements FileSystem.WriteFile.
+func (osFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return utils.AtomicWriteFile(name, data, perm)
+}
+
+// MkdirAll implements FileSystem.MkdirAll.
+func (osFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+// ReadDir implements FileSystem.ReadDir.
+func (osFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+// Stat implements FileSystem.Stat.
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Remove implements FileSystem.Remove.
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// TempFile implements FileSystem.TempFile.
+func (osFileSystem) TempFile(dir, prefix string) (TempFile, error) {
+	return ioutil.TempFile(dir, prefix)
+}
+
+// ReplaceFile implements FileSystem.ReplaceFile.
+func (osFileSystem) ReplaceFile(oldpath, newpath string) error {
+	return utils.ReplaceFile(oldpath, newpath)
+}
+
+// cacheEnv holds the clock and file system
+// used to maintain a cache directory.
+type cacheEnv struct {
+	clock Clock
+	fs    FileSystem
+
+	// aead, if not nil, holds the cipher with which archives
+	// are encrypted in the cache, as set up by withCacheKey.
+	aead cipher.AEAD
+}
+
+// newCacheEnv returns a cacheEnv using the given clock and file
+// system, or WallClock and OSFileSystem if they are nil.
+func newCacheEnv(clock Clock, fs FileSystem) cacheEnv {
+	if clock == nil {
+		clock = WallClock
+	}
+	if fs == nil {
+		fs = OSFileSystem
+	}
+	return cacheEnv{
+		clock: clock,
+		fs:    fs,
+	}
+}
+
+// Cache gives access to a cache directory through a FileSystem.
+// CacheGC and ListCached use a Cache with the default file system.
+type Cache struct {
+	// Dir holds the cache directory. If empty, the value of the
+	// package-level CacheDir variable at the time of each call
+	// is used.
+	Dir string
+
+	// FileSystem holds the file system the cache directory is
+	// accessed through. If nil, OSFileSystem is used.
+	FileSystem FileSystem
+}
+
+func (c Cache) cacheEnv() cacheEnv {
+	return newCacheEnv(nil, c.FileSystem)
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+// fakeClock is a charmrepo.Clock whose time is set by the tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// diskFullFS is a charmrepo.FileSystem whose
+// temporary files cannot be written to.
+type diskFullFS struct {
+	charmrepo.FileSystem
+}
+
+func (fs diskFullFS) TempFile(dir, prefix string) (charmrepo.TempFile, error) {
+	f, err := fs.FileSystem.TempFile(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return diskFullFile{f}, nil
+}
+
+type diskFullFile struct {
+	charmrepo.TempFile
+}
+
+func (diskFullFile) Write([]byte) (int, error) {
+	return 0, syscall.ENOSPC
+}
+
+// deniedFS is a charmrepo.FileSystem
+// whose directories cannot be read.
+type deniedFS struct {
+	charmrepo.FileSystem
+}
+
+func (deniedFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+}
+
+func (s *legacyCharmStoreSuite) TestClockRevisionCacheExpiry(c *gc.C) {
+	clock := &fakeClock{now: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)}
+	s.store.Clock = clock
+	s.store.RevisionCacheTTL = time.Hour
+	charmURL := charm.MustParseURL("cs:series/good")
+
+	rev, err := charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 23)
+
+	s.server.UpdateStoreRevision("cs:series/good", 24)
+	defer s.server.UpdateStoreRevision("cs:series/good", 23)
+	clock.now = clock.now.Add(30 * time.Minute)
+	rev, err = charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 23)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 1)
+
+	clock.now = clock.now.Add(time.Hour)
+	rev, err = charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 24)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 2)
+}
+
+func (s *legacyCharmStoreSuite) TestFileSystemDiskFull(c *gc.C) {
+	s.store.FileSystem = diskFullFS{charmrepo.OSFileSystem}
+	_, err := s.store.Get(charm.MustParseURL("cs:series/good"))
+	c.Assert(err, gc.ErrorMatches, ".*no space left on device")
+
+	// The temporary file has been removed.
+	infos, err := ioutil.ReadDir(charmrepo.CacheDir)
+	c.Assert(err, jc.ErrorIsNil)
+	for _, info := range infos {
+		c.Assert(info.Name(), gc.Not(gc.Matches), "charm-download.*")
+	}
+}
+
+func (s *cacheGCSuite) TestCacheFileSystemPermissionDenied(c *gc.C) {
+	cache := charmrepo.Cache{
+		Dir:        c.MkDir(),
+		FileSystem: deniedFS{charmrepo.OSFileSystem},
+	}
+	_, err := cache.List()
+	c.Assert(err, gc.ErrorMatches, "cannot read cache directory: open .*: permission denied")
+	_, err = cache.GC(nil, true)
+	c.Assert(err, gc.ErrorMatches, "cannot read cache directory: open .*: permission denied")
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// CacheGCResult describes the entries removed from
+// a cache directory by CacheGC.
+type CacheGCResult struct {
+	// Removed holds the names of the files removed from the
+	// cache directory, or that would have been removed in a dry
+	// run, in alphabetical order.
+	Removed []string
+
+	// Freed holds the number of bytes freed,
+	// or that would have been freed in a dry run.
+	Freed int64
+}
+
+// CacheGC removes from the given cache directory, or from CacheDir if
+// dir is empty, the cached archives and hashes of the charms and
+// bundles not referenced by keep, such as the charms still deployed,
+// so that long-lived processes can reclaim space. A URL with no
+// revision keeps all the revisions of the entity. If dryRun is true,
+// nothing is removed but the result reports what would be.
+//
+// The URLs of entries whose names were truncated by charm.QuoteV2 are
+// found with the cache index, and the removed entries are removed
+// from it. Files that are not cache entries are left alone, as are
+// entries named with charm.Quote, which should first be renamed with
+// MigrateCacheDir.
+func CacheGC(dir string, keep []*charm.URL, dryRun bool) (*CacheGCResult, error) {
+	return Cache{Dir: dir}.GC(keep, dryRun)
+}
+
+// GC is like CacheGC, but removes the entries
+// held in the cache directory of c.
+func (c Cache) GC(keep []*charm.URL, dryRun bool) (*CacheGCResult, error) {
+	dir := cacheDir(c.Dir)
+	if dir == "" {
+		return nil, errgo.New("no cache directory")
+	}
+	env := c.cacheEnv()
+	keepNames := make(map[string]bool)
+	for _, curl := range keep {
+		keepNames[charm.QuoteV2(curl.String())] = true
+	}
+	infos, err := env.fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &CacheGCResult{}, nil
+		}
+		return nil, errgo.Notef(err, "cannot read cache directory")
+	}
+	indexed := env.indexedURLs(dir)
+	result := &CacheGCResult{}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		quoted, ok := cacheEntryName(info.Name())
+		if !ok || keepNames[quoted] {
+			continue
+		}
+		curl, ok := cachedURL(quoted)
+		if !ok {
+			continue
+		}
+		if curl == nil {
+			curl = indexed[quoted]
+		}
+		if curl != nil && (keepNames[charm.QuoteV2(curl.String())] || keepNames[charm.QuoteV2(curl.WithRevision(-1).String())]) {
+			continue
+		}
+		if !dryRun {
+			if err := env.fs.Remove(filepath.Join(dir, info.Name())); err != nil {
+				return result, errgo.Notef(err, "cannot remove cache entry")
+			}
+		}
+		result.Removed = append(result.Removed, info.Name())
+		result.Freed += info.Size()
+	}
+	sort.Strings(result.Removed)
+	if !dryRun {
+		if err := env.unindexCacheFiles(dir, result.Removed); err != nil {
+			return result, errgo.Mask(err)
+		}
+	}
+	return result, nil
+}
+
+// cacheEntryName returns the quoted entity id of the cache entry
+// with the given file name, and reports whether it is a cache entry.
+func cacheEntryName(name string) (string, bool) {
+	for _, ext := range cacheExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+	return "", false
+}
+
+// cachedURL returns the URL of the entity with the given quoted id,
+// and reports whether it is a cache entry. The URL is nil if the name
+// was truncated by charm.QuoteV2, so that it cannot be recovered.
+func cachedURL(quoted string) (*charm.URL, bool) {
+	if strings.Contains(quoted, "%~") {
+		return nil, true
+	}
+	id, err := charm.Unquote(quoted)
+	if err != nil {
+		return nil, false
+	}
+	curl, err := charm.ParseURL(id)
+	if err != nil {
+		return nil, false
+	}
+	return curl, true
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type cacheGCSuite struct{}
+
+var _ = gc.Suite(&cacheGCSuite{})
+
+var longCharmURL = "cs:~" + strings.Repeat("x", 300) + "/trusty/long-1"
+
+// writeCacheFiles writes the given files to dir.
+func writeCacheFiles(c *gc.C, dir string, files map[string]string) {
+	for name, data := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+}
+
+// cacheFileNames returns the sorted names of the files in dir.
+func cacheFileNames(c *gc.C, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *cacheGCSuite) makeCache(c *gc.C) string {
+	dir := c.MkDir()
+	writeCacheFiles(c, dir, map[string]string{
+		charm.QuoteV2("cs:trusty/mysql-1") + ".charm":                   "mysql 1",
+		charm.QuoteV2("cs:trusty/mysql-1") + "." + charmrepo.HashesFile: "hashes",
+		charm.QuoteV2("cs:trusty/mysql-2") + ".charm":                   "mysql 2",
+		charm.QuoteV2("cs:trusty/django-3") + ".charm":                  "django",
+		charm.QuoteV2("cs:bundle/wordpress-2") + ".bundle":              "bundle",
+		charm.QuoteV2(longCharmURL) + ".charm":                          "long",
+		charm.Quote("cs:trusty/haproxy-4") + ".charm":                   "old haproxy",
+		"revisions.json":    "{}",
+		"charm-download123": "partial",
+	})
+	return dir
+}
+
+func (s *cacheGCSuite) TestCacheGC(c *gc.C) {
+	dir := s.makeCache(c)
+	result, err := charmrepo.CacheGC(dir, []*charm.URL{
+		charm.MustParseURL("cs:trusty/mysql-1"),
+		charm.MustParseURL("cs:trusty/mysql-5"),
+	}, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, jc.DeepEquals, &charmrepo.CacheGCResult{
+		Removed: []string{
+			charm.QuoteV2(longCharmURL) + ".charm",
+			charm.QuoteV2("cs:bundle/wordpress-2") + ".bundle",
+			charm.QuoteV2("cs:trusty/django-3") + ".charm",
+			charm.QuoteV2("cs:trusty/mysql-2") + ".charm",
+		},
+		Freed: int64(len("bundle") + len("long") + len("django") + len("mysql 2")),
+	})
+	c.Assert(cacheFileNames(c, dir), jc.DeepEquals, []string{
+		"charm-download123",
+		charm.QuoteV2("cs:trusty/mysql-1") + ".charm",
+		charm.QuoteV2("cs:trusty/mysql-1") + "." + charmrepo.HashesFile,
+		charm.Quote("cs:trusty/haproxy-4") + ".charm",
+		"revisions.json",
+	})
+}
+
+func (s *cacheGCSuite) TestCacheGCKeepAllRevisions(c *gc.C) {
+	dir := s.makeCache(c)
+	result, err := charmrepo.CacheGC(dir, []*charm.URL{
+		charm.MustParseURL("cs:trusty/mysql"),
+		charm.MustParseURL("cs:bundle/wordpress-2"),
+		charm.MustParseURL(longCharmURL),
+	}, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Removed, jc.DeepEquals, []string{
+		charm.QuoteV2("cs:trusty/django-3") + ".charm",
+	})
+}
+
+func (s *cacheGCSuite) TestCacheGCDryRun(c *gc.C) {
+	dir := s.makeCache(c)
+	before := cacheFileNames(c, dir)
+	result, err := charmrepo.CacheGC(dir, nil, true)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Removed, gc.HasLen, 6)
+	c.Assert(cacheFileNames(c, dir), jc.DeepEquals, before)
+}
+
+func (s *cacheGCSuite) TestCacheGCNoDirectory(c *gc.C) {
+	result, err := charmrepo.CacheGC(filepath.Join(c.MkDir(), "missing"), nil, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, jc.DeepEquals, &charmrepo.CacheGCResult{})
+}
@@ -0,0 +1,241 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// cacheIndexFile holds the name of the file, in the charm cache
+// directory, where the index of the cached archives is stored.
+const cacheIndexFile = "index.json"
+
+// cacheIndexEntry holds the location of a cached archive,
+// along with its size and the time it was cached.
+type cacheIndexEntry struct {
+	File string    `json:"file"`
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+}
+
+// cacheIndexMutex serializes the accesses
+// to the cache index files.
+var cacheIndexMutex sync.Mutex
+
+// readCacheIndex reads the index of the cache stored in the given
+// directory, keyed by entity URL. A missing or corrupted index is
+// treated as empty.
+func (env cacheEnv) readCacheIndex(dir string) map[string]cacheIndexEntry {
+	entries := make(map[string]cacheIndexEntry)
+	data, err := env.fs.ReadFile(filepath.Join(dir, cacheIndexFile))
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logger.Warningf("ignoring invalid cache index: %v", err)
+		return make(map[string]cacheIndexEntry)
+	}
+	return entries
+}
+
+// writeCacheIndex atomically replaces the index of the cache stored
+// in the given directory. The entries are written in URL order, so
+// the file is stable and can be compared between runs.
+func (env cacheEnv) writeCacheIndex(dir string, entries map[string]cacheIndexEntry) error {
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := env.fs.WriteFile(filepath.Join(dir, cacheIndexFile), data, 0644); err != nil {
+		return errgo.Notef(err, "cannot write cache index")
+	}
+	return nil
+}
+
+// indexCacheEntry records in the index of the cache stored in the
+// given directory that the archive of the entity with the given id is
+// held at path. As the index is not needed to retrieve archives, a
+// failure to update it is logged rather than returned.
+func (env cacheEnv) indexCacheEntry(dir string, id *charm.URL, path string) {
+	info, err := env.fs.Stat(path)
+	if err != nil {
+		logger.Warningf("cannot index cached archive: %v", err)
+		return
+	}
+	cacheIndexMutex.Lock()
+	defer cacheIndexMutex.Unlock()
+	entries := env.readCacheIndex(dir)
+	key := id.String()
+	if entry, ok := entries[key]; ok && entry.File == info.Name() && entry.Size == info.Size() {
+		return
+	}
+	entries[key] = cacheIndexEntry{
+		File: info.Name(),
+		Size: info.Size(),
+		Time: env.clock.Now().UTC(),
+	}
+	if err := env.writeCacheIndex(dir, entries); err != nil {
+		logger.Warningf("%v", err)
+	}
+}
+
+// unindexCacheFiles removes from the index of the cache stored in the
+// given directory the entries held in the files with the given names.
+func (env cacheEnv) unindexCacheFiles(dir string, names []string) error {
+	removed := make(map[string]bool)
+	for _, name := range names {
+		removed[name] = true
+	}
+	cacheIndexMutex.Lock()
+	defer cacheIndexMutex.Unlock()
+	entries := env.readCacheIndex(dir)
+	changed := false
+	for key, entry := range entries {
+		if removed[entry.File] {
+			delete(entries, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return env.writeCacheIndex(dir, entries)
+}
+
+// indexedURLs returns the URLs of the entities in the index of the
+// cache stored in the given directory, keyed by the cache entry name
+// of their archives, as returned by cacheEntryName.
+func (env cacheEnv) indexedURLs(dir string) map[string]*charm.URL {
+	cacheIndexMutex.Lock()
+	entries := env.readCacheIndex(dir)
+	cacheIndexMutex.Unlock()
+	urls := make(map[string]*charm.URL)
+	for key, entry := range entries {
+		quoted, ok := cacheEntryName(entry.File)
+		if !ok {
+			continue
+		}
+		if curl, err := charm.ParseURL(key); err == nil {
+			urls[quoted] = curl
+		}
+	}
+	return urls
+}
+
+// CachedEntity describes a charm or bundle archive held in a cache
+// directory.
+type CachedEntity struct {
+	// URL holds the fully qualified URL of the entity.
+	URL *charm.URL
+
+	// Path holds the path of the archive.
+	Path string
+
+	// Size holds the size of the archive in bytes.
+	Size int64
+
+	// Time holds the time the archive was cached, or
+	// the zero time if it is not recorded in the index.
+	Time time.Time
+}
+
+// ListCached returns the charm and bundle archives held in the given
+// cache directory, or in CacheDir if dir is empty, in URL order, so
+// that tools can show what is available offline. The archives are
+// found with the index kept by the charm stores as they retrieve
+// archives. Archives cached before the index was introduced are
+// found by decoding their file names, except those whose names were
+// truncated by charm.QuoteV2, whose URLs cannot be recovered.
+func ListCached(dir string) ([]CachedEntity, error) {
+	return Cache{Dir: dir}.List()
+}
+
+// List is like ListCached, but lists the archives
+// held in the cache directory of c.
+func (c Cache) List() ([]CachedEntity, error) {
+	dir := cacheDir(c.Dir)
+	if dir == "" {
+		return nil, errgo.New("no cache directory")
+	}
+	env := c.cacheEnv()
+	infos, err := env.fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errgo.Notef(err, "cannot read cache directory")
+	}
+	files := make(map[string]os.FileInfo)
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			files[info.Name()] = info
+		}
+	}
+	cacheIndexMutex.Lock()
+	entries := env.readCacheIndex(dir)
+	cacheIndexMutex.Unlock()
+
+	var cached []CachedEntity
+	listed := make(map[string]bool)
+	for key, entry := range entries {
+		info, ok := files[entry.File]
+		if !ok {
+			// The archive has been removed.
+			continue
+		}
+		curl, err := charm.ParseURL(key)
+		if err != nil {
+			logger.Warningf("ignoring invalid URL %q in cache index", key)
+			continue
+		}
+		cached = append(cached, CachedEntity{
+			URL:  curl,
+			Path: filepath.Join(dir, entry.File),
+			Size: info.Size(),
+			Time: entry.Time,
+		})
+		listed[entry.File] = true
+	}
+	for name, info := range files {
+		if listed[name] || !isArchiveEntry(name) {
+			continue
+		}
+		quoted, _ := cacheEntryName(name)
+		curl, ok := cachedURL(quoted)
+		if !ok || curl == nil {
+			continue
+		}
+		cached = append(cached, CachedEntity{
+			URL:  curl,
+			Path: filepath.Join(dir, name),
+			Size: info.Size(),
+		})
+	}
+	sort.Sort(cachedEntitiesByURL(cached))
+	return cached, nil
+}
+
+// isArchiveEntry reports whether the cache entry
+// with the given file name holds an archive.
+func isArchiveEntry(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == "."+string(charm.KindCharm) || ext == "."+string(charm.KindBundle)
+}
+
+type cachedEntitiesByURL []CachedEntity
+
+func (es cachedEntitiesByURL) Len() int      { return len(es) }
+func (es cachedEntitiesByURL) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+func (es cachedEntitiesByURL) Less(i, j int) bool {
+	return es[i].URL.String() < es[j].URL.String()
+}
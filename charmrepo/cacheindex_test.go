@@ -0,0 +1,133 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type cacheIndexSuite struct{}
+
+var _ = gc.Suite(&cacheIndexSuite{})
+
+// cacheIndexTime holds the time recorded in the cache indexes
+// used by the tests.
+var cacheIndexTime = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// makeIndexedCache returns a cache directory holding the files of the
+// cache made by cacheGCSuite.makeCache, with an index recording the
+// archives of cs:trusty/mysql-2 and of the charm with a long URL.
+func (s *cacheIndexSuite) makeIndexedCache(c *gc.C) string {
+	dir := (&cacheGCSuite{}).makeCache(c)
+	writeCacheFiles(c, dir, map[string]string{
+		"index.json": `{
+	"cs:trusty/mysql-2": {
+		"file": "` + charm.QuoteV2("cs:trusty/mysql-2") + `.charm",
+		"size": 7,
+		"time": "2015-06-01T12:00:00Z"
+	},
+	"cs:trusty/removed-1": {
+		"file": "` + charm.QuoteV2("cs:trusty/removed-1") + `.charm",
+		"size": 7,
+		"time": "2015-06-01T12:00:00Z"
+	},
+	"` + longCharmURL + `": {
+		"file": "` + charm.QuoteV2(longCharmURL) + `.charm",
+		"size": 4,
+		"time": "2015-06-01T12:00:00Z"
+	}
+}`,
+	})
+	return dir
+}
+
+func (s *cacheIndexSuite) TestListCached(c *gc.C) {
+	dir := s.makeIndexedCache(c)
+	cached, err := charmrepo.ListCached(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cached, jc.DeepEquals, []charmrepo.CachedEntity{{
+		URL:  charm.MustParseURL("cs:bundle/wordpress-2"),
+		Path: filepath.Join(dir, charm.QuoteV2("cs:bundle/wordpress-2")+".bundle"),
+		Size: int64(len("bundle")),
+	}, {
+		URL:  charm.MustParseURL("cs:trusty/django-3"),
+		Path: filepath.Join(dir, charm.QuoteV2("cs:trusty/django-3")+".charm"),
+		Size: int64(len("django")),
+	}, {
+		URL:  charm.MustParseURL("cs:trusty/mysql-1"),
+		Path: filepath.Join(dir, charm.QuoteV2("cs:trusty/mysql-1")+".charm"),
+		Size: int64(len("mysql 1")),
+	}, {
+		URL:  charm.MustParseURL("cs:trusty/mysql-2"),
+		Path: filepath.Join(dir, charm.QuoteV2("cs:trusty/mysql-2")+".charm"),
+		Size: int64(len("mysql 2")),
+		Time: cacheIndexTime,
+	}, {
+		URL:  charm.MustParseURL(longCharmURL),
+		Path: filepath.Join(dir, charm.QuoteV2(longCharmURL)+".charm"),
+		Size: int64(len("long")),
+		Time: cacheIndexTime,
+	}})
+}
+
+func (s *cacheIndexSuite) TestListCachedNoDirectory(c *gc.C) {
+	cached, err := charmrepo.ListCached(filepath.Join(c.MkDir(), "missing"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cached, gc.HasLen, 0)
+}
+
+func (s *cacheIndexSuite) TestCacheGCUsesIndex(c *gc.C) {
+	dir := s.makeIndexedCache(c)
+	result, err := charmrepo.CacheGC(dir, []*charm.URL{
+		charm.MustParseURL("cs:trusty/mysql-1"),
+		charm.MustParseURL("cs:~" + strings.Repeat("x", 300) + "/trusty/long"),
+	}, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Removed, jc.DeepEquals, []string{
+		charm.QuoteV2("cs:bundle/wordpress-2") + ".bundle",
+		charm.QuoteV2("cs:trusty/django-3") + ".charm",
+		charm.QuoteV2("cs:trusty/mysql-2") + ".charm",
+	})
+	cached, err := charmrepo.ListCached(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cached, gc.HasLen, 2)
+	c.Assert(cached[0].URL.String(), gc.Equals, "cs:trusty/mysql-1")
+	c.Assert(cached[1].URL.String(), gc.Equals, longCharmURL)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Not(jc.Contains), "cs:trusty/mysql-2")
+}
+
+func (s *charmStoreV5Suite) TestGetIndexesCache(c *gc.C) {
+	s.PatchValue(charmrepo.TimeNow, func() time.Time {
+		return cacheIndexTime
+	})
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	dir := c.MkDir()
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   dir,
+	})
+	ch, err := repo.Get(url.WithRevision(-1))
+	c.Assert(err, jc.ErrorIsNil)
+	path := ch.(*charm.CharmArchive).Path
+
+	cached, err := charmrepo.ListCached(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cached, gc.HasLen, 1)
+	c.Assert(cached[0].URL, jc.DeepEquals, url)
+	c.Assert(cached[0].Path, gc.Equals, path)
+	c.Assert(cached[0].Time, gc.Equals, cacheIndexTime)
+}
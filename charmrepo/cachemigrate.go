@@ -0,0 +1,101 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// cacheExtensions holds the extensions of the entries stored in a cache
+// directory, longest first so that the hashes file is not mistaken for
+// another entry.
+var cacheExtensions = []string{
+	"." + HashesFile,
+	"." + string(charm.KindBundle),
+	"." + string(charm.KindCharm),
+}
+
+// MigrateCacheDir renames the entries in the given cache directory that
+// were named with charm.Quote so that they follow the charm.QuoteV2 scheme
+// used by the charm stores. The names only differ for entries whose
+// quoted id is longer than charm.MaxQuotedLen; other files are left
+// alone. If an entry already exists under its new name, the old entry
+// is removed.
+func MigrateCacheDir(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errgo.Notef(err, "cannot read cache directory")
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		newName, ok := migratedCacheName(info.Name())
+		if !ok {
+			continue
+		}
+		oldPath, newPath := filepath.Join(dir, info.Name()), filepath.Join(dir, newName)
+		if _, err := os.Stat(newPath); err == nil {
+			if err := os.Remove(oldPath); err != nil {
+				return errgo.Notef(err, "cannot remove stale cache entry")
+			}
+			continue
+		}
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return errgo.Notef(err, "cannot rename cache entry")
+		}
+	}
+	return nil
+}
+
+// migratedCacheName returns the charm.QuoteV2 name corresponding to the
+// given cache entry name, and reports whether the entry needs to be
+// renamed.
+func migratedCacheName(name string) (string, bool) {
+	for _, ext := range cacheExtensions {
+		if !strings.HasSuffix(name, ext) {
+			continue
+		}
+		id, err := charm.Unquote(strings.TrimSuffix(name, ext))
+		if err != nil {
+			// The name is not a cache entry or it was
+			// already truncated by charm.QuoteV2.
+			return "", false
+		}
+		if _, err := charm.ParseReference(id); err != nil {
+			return "", false
+		}
+		newName := charm.QuoteV2(id) + ext
+		return newName, newName != name
+	}
+	return "", false
+}
+
+// entryPath returns the path of the cache entry in dir holding the
+// entity with the given id, with the given extension. An entry stored
+// under its charm.Quote name, which is longer than its charm.QuoteV2
+// name, is moved to the new name first, so that it is still used.
+func (env cacheEnv) entryPath(dir string, id fmt.Stringer, ext string) string {
+	path := filepath.Join(dir, charm.QuoteV2(id.String())+ext)
+	oldPath := filepath.Join(dir, charm.Quote(id.String())+ext)
+	if oldPath != path {
+		if _, err := env.fs.Stat(path); os.IsNotExist(err) {
+			// The old entry most likely does not exist, in
+			// which case the entity is retrieved as usual.
+			env.fs.ReplaceFile(oldPath, path)
+		}
+	}
+	return path
+}
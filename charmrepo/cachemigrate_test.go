@@ -0,0 +1,71 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type cacheMigrateSuite struct{}
+
+var _ = gc.Suite(&cacheMigrateSuite{})
+
+func (s *cacheMigrateSuite) TestMigrateCacheDir(c *gc.C) {
+	dir := c.MkDir()
+	longMySQL := "cs:~" + strings.Repeat("a", 200) + "/trusty/mysql-1"
+	longDjango := "cs:~" + strings.Repeat("a", 200) + "/trusty/django-3"
+	files := map[string]string{
+		charm.Quote("cs:trusty/mysql-1") + ".charm":         "mysql",
+		charm.Quote(longMySQL) + ".charm":                   "old mysql",
+		charm.Quote(longMySQL) + "." + charmrepo.HashesFile: "old hashes",
+		charm.Quote(longDjango) + ".charm":                  "old django",
+		charm.QuoteV2(longDjango) + ".charm":                "new django",
+		"revisions.json":                                    "{}",
+		"charm-download123":                                 "partial",
+	}
+	for name, data := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+
+	err := charmrepo.MigrateCacheDir(dir)
+	c.Assert(err, gc.IsNil)
+
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	got := make(map[string]string)
+	for _, info := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		c.Assert(err, gc.IsNil)
+		got[info.Name()] = string(data)
+	}
+	c.Assert(got, jc.DeepEquals, map[string]string{
+		"cs_3a_trusty_2f_mysql-1.charm":                       "mysql",
+		charm.QuoteV2(longMySQL) + ".charm":                   "old mysql",
+		charm.QuoteV2(longMySQL) + "." + charmrepo.HashesFile: "old hashes",
+		charm.QuoteV2(longDjango) + ".charm":                  "new django",
+		"revisions.json":                                      "{}",
+		"charm-download123":                                   "partial",
+	})
+
+	// Migrating again is a no-op.
+	err = charmrepo.MigrateCacheDir(dir)
+	c.Assert(err, gc.IsNil)
+	infos, err = ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, len(got))
+}
+
+func (s *cacheMigrateSuite) TestMigrateCacheDirNotFound(c *gc.C) {
+	err := charmrepo.MigrateCacheDir(filepath.Join(c.MkDir(), "missing"))
+	c.Assert(err, gc.IsNil)
+}
@@ -7,13 +7,10 @@ import (
 	"crypto/sha512"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
+	"strings"
 
-	"github.com/juju/utils"
 	"gopkg.in/errgo.v1"
 	"gopkg.in/juju/charmstore.v4/csclient"
 	"gopkg.in/juju/charmstore.v4/params"
@@ -21,13 +18,29 @@ import (
 	"gopkg.in/juju/charm.v5"
 )
 
-// CacheDir stores the charm cache directory path.
+// CacheDir stores the default charm cache directory path. It is used
+// by repositories that were not given a cache directory explicitly,
+// when they are created if they were given a Config, and otherwise
+// at each call.
 var CacheDir string
 
+// cacheDir returns dir, or the default cache directory if dir is empty.
+func cacheDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	return CacheDir
+}
+
 // CharmStore is a repository Interface that provides access to the public Juju
 // charm store.
 type CharmStore struct {
-	client *csclient.Client
+	client   *csclient.Client
+	cacheDir string
+	profile  EndpointProfile
+	header   http.Header
+	env      cacheEnv
+	series   []string
 }
 
 var _ Interface = (*CharmStore)(nil)
@@ -37,119 +50,246 @@ type NewCharmStoreParams struct {
 	// URL holds the root endpoint URL of the charm store,
 	// with no trailing slash, not including the version.
 	// For example https://api.jujucharms.com/charmstore
-	// If empty, the default charm store client location is used.
+	// If empty, the charm store is selected by Config, the
+	// CharmStoreEnvVar environment variable or by Profile.
 	URL string
 
+	// Profile holds the endpoint profile of the charm store,
+	// used when URL is empty and the CharmStoreEnvVar
+	// environment variable is not set. If empty,
+	// ProductionProfile is used.
+	Profile EndpointProfile
+
 	// HTTPClient holds the HTTP client to use when making
 	// requests to the store. If nil, httpbakery.NewHTTPClient will
 	// be used.
 	HTTPClient *http.Client
 
+	// Doer holds the Doer used to send all the requests
+	// to the store. If not nil, it takes precedence over
+	// HTTPClient.
+	Doer Doer
+
 	// VisitWebPage is called when authorization requires that
 	// the user visits a web page to authenticate themselves.
 	// If nil, a default function that returns an error will be used.
 	VisitWebPage func(url *url.URL) error
+
+	// CacheDir holds the directory where downloaded charms
+	// are cached. If empty, the value of the package-level
+	// CacheDir variable at the time of each call is used.
+	CacheDir string
+
+	// APIVersion holds the version of the charm store API
+	// to use. If zero, version 4 is used. When it is 5, the
+	// returned repository is a *CharmStoreV5.
+	APIVersion int
+
+	// Channel holds the channel from which charms are
+	// retrieved. It is only supported by version 5 of the
+	// API; if empty, StableChannel is used.
+	Channel Channel
+
+	// Tracer, if not nil, is used to trace the requests to
+	// the store. It is only supported by version 5 of the API.
+	Tracer Tracer
+
+	// Provenance holds the provenance level required for
+	// the charm archives retrieved from the store. It is
+	// only supported by version 5 of the API.
+	Provenance ProvenanceLevel
+
+	// VerifySignature is used to check the signature of
+	// hashes documents. If nil, signed documents are
+	// only trusted for their digests.
+	VerifySignature func(*Hashes) error
+
+	// UserAgent holds the User-Agent header field sent with
+	// every request to the store. If empty, DefaultUserAgent
+	// is used.
+	UserAgent string
+
+	// Header holds extra header fields sent with every request
+	// to the store, which some private stores require for
+	// routing or quota attribution. They do not override the
+	// fields set by the repository itself, such as User-Agent
+	// and the Juju metadata attributes.
+	Header http.Header
+
+	// CompressedTransfer specifies whether charm and bundle
+	// archives are requested with a compressed content coding,
+	// which reduces transfer times on slow links when the store
+	// offers it. The gzip coding is always supported. It is only
+	// supported by version 5 of the API.
+	CompressedTransfer bool
+
+	// ArchiveDecoders holds the decoders of the content codings
+	// supported in addition to gzip when CompressedTransfer is
+	// set, keyed by coding. For instance, "zstd" may be mapped to
+	// a decoder from a third party package. A nil decoder disables
+	// the coding, which may be used to disable gzip.
+	ArchiveDecoders map[string]ArchiveDecoder
+
+	// StaleIfError specifies whether Latest returns the revisions
+	// last retrieved from the store, recorded in an index in the
+	// cache directory, when the store cannot be reached, so that
+	// clients keep working during store outages. Such revisions
+	// are flagged as stale. It is only supported by version 5 of
+	// the API.
+	StaleIfError bool
+
+	// Clock holds the clock used to timestamp the entries of
+	// the cache directory. If nil, WallClock is used.
+	Clock Clock
+
+	// FileSystem holds the file system the cache directory is
+	// accessed through. If nil, OSFileSystem is used.
+	FileSystem FileSystem
+
+	// CacheKey, if not nil, holds the AES key, 16, 24 or 32 bytes
+	// long, used to encrypt the archives stored in the cache
+	// directory with AES-GCM. The digests of the archives are
+	// verified after decryption, and archives found in the cache
+	// that cannot be decrypted are retrieved again. Archives are
+	// briefly held unencrypted in a temporary file in the cache
+	// directory while they are verified. Archives read from the
+	// cache are decrypted as they are read, so the Path field of
+	// the returned charm archives is empty. It is not supported
+	// by version 5 of the API, whose provenance checks read the
+	// cached archives directly, nor by LegacyCharmStore.
+	// NewCharmStore panics if the key is invalid or not
+	// supported, as it does when no cache directory is set.
+	CacheKey []byte
+
+	// Config, if not nil, holds the configuration of the
+	// repository. Its empty fields are set to the package
+	// defaults when the repository is created, so that later
+	// changes to the package-level CacheDir variable do not
+	// affect it. The URL and CacheDir fields, if set, take
+	// precedence over it.
+	Config *Config
+}
+
+// DefaultUserAgent holds the User-Agent header field sent with the
+// requests to the charm store when none is specified. It includes
+// the version of this package.
+const DefaultUserAgent = "juju-charmrepo/5"
+
+// series returns the series of the charms that may be resolved
+// through the store, or nil if any series is allowed.
+func (p NewCharmStoreParams) series() []string {
+	if p.Config == nil {
+		return nil
+	}
+	return p.Config.Series
+}
+
+// requestHeader returns the header fields to send
+// with every request to the store.
+func (p NewCharmStoreParams) requestHeader() http.Header {
+	header := make(http.Header, len(p.Header)+1)
+	for key, values := range p.Header {
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+	header.Set("User-Agent", p.UserAgent)
+	if p.UserAgent == "" {
+		header.Set("User-Agent", DefaultUserAgent)
+	}
+	return header
 }
 
 // NewCharmStore creates and returns a charm store repository.
 // The given parameters are used to instantiate the charm store.
 //
+// The charm store endpoint is chosen as described by
+// NewCharmStoreParams.Endpoint. If the profile or the environment
+// variable is invalid, the error is logged and the production charm
+// store is used.
+//
 // The errors returned from the interface methods will
 // preserve the causes returned from the underlying csclient
 // methods.
 func NewCharmStore(p NewCharmStoreParams) Interface {
-	return &CharmStore{
+	var err error
+	if p.Config != nil {
+		config := p.Config.withDefaults()
+		if p.CacheDir == "" {
+			p.CacheDir = config.CacheDir
+		}
+		p.Config = &config
+	}
+	p.URL, p.Profile, err = p.Endpoint()
+	if err != nil {
+		logger.Errorf("cannot select charm store endpoint: %v; using %s", err, ProductionProfile)
+		p.URL, p.Profile = endpointProfiles[ProductionProfile], ProductionProfile
+	}
+	if p.APIVersion == 5 {
+		return newCharmStoreV5(p)
+	}
+	env, err := newCacheEnv(p.Clock, p.FileSystem).withCacheKey(p.CacheKey)
+	if err != nil {
+		panic(err)
+	}
+	s := &CharmStore{
 		client: csclient.New(csclient.Params{
 			URL:          p.URL,
-			HTTPClient:   p.HTTPClient,
+			HTTPClient:   httpClient(p.Doer, p.HTTPClient),
 			VisitWebPage: p.VisitWebPage,
 		}),
+		cacheDir: p.CacheDir,
+		profile:  p.Profile,
+		header:   p.requestHeader(),
+		env:      env,
+		series:   p.series(),
 	}
+	s.client.SetHTTPHeader(s.header)
+	return s
 }
 
-// Get implements Interface.Get.
-func (s *CharmStore) Get(curl *charm.URL) (charm.Charm, error) {
-	// The cache location must have been previously set.
-	if CacheDir == "" {
-		panic("charm cache directory path is empty")
-	}
-	if curl.Series == "bundle" {
-		return nil, errgo.Newf("expected a charm URL, got bundle URL %q", curl)
-	}
+// charmStore holds the operations implemented differently by the
+// repositories using each version of the charm store API, on top of
+// which they share the implementation of Interface.
+type charmStore interface {
+	// archivePath retrieves the archive of the entity referenced
+	// by curl, unless it is already in the cache, and returns its
+	// path in the cache.
+	archivePath(curl *charm.URL) (string, error)
 
-	// Prepare the cache directory and retrieve the charm.
-	if err := os.MkdirAll(CacheDir, 0755); err != nil {
-		return nil, errgo.Notef(err, "cannot create the cache directory")
-	}
-	r, id, expectHash, expectSize, err := s.client.GetArchive(curl.Reference())
-	if err != nil {
-		if errgo.Cause(err) == params.ErrNotFound {
-			// Make a prettier error message for the user.
-			return nil, errgo.WithCausef(nil, params.ErrNotFound, "cannot retrieve charm %q: charm not found", curl)
-		}
-		return nil, errgo.NoteMask(err, fmt.Sprintf("cannot retrieve charm %q", curl), errgo.Any)
-	}
-	defer r.Close()
+	// getMeta sends a GET request for the given path, relative to
+	// the root of the API, with the given query parameters, and
+	// unmarshals the JSON response into result.
+	getMeta(path string, values url.Values, result interface{}) error
 
-	// Check if the archive already exists in the cache.
-	path := filepath.Join(CacheDir, charm.Quote(id.String())+".charm")
-	if verifyHash384AndSize(path, expectHash, expectSize) == nil {
-		return charm.ReadCharmArchive(path)
-	}
+	// cacheEnv returns the environment of the cache directory.
+	cacheEnv() cacheEnv
+}
 
-	// Verify and save the new archive.
-	f, err := ioutil.TempFile(CacheDir, "charm-download")
-	if err != nil {
-		return nil, errgo.Notef(err, "cannot make temporary file")
-	}
-	defer f.Close()
-	hash := sha512.New384()
-	size, err := io.Copy(io.MultiWriter(hash, f), r)
-	if err != nil {
-		return nil, errgo.Notef(err, "cannot read charm archive")
-	}
-	if size != expectSize {
-		return nil, errgo.Newf("size mismatch; network corruption?")
-	}
-	if fmt.Sprintf("%x", hash.Sum(nil)) != expectHash {
-		return nil, errgo.Newf("hash mismatch; network corruption?")
+// getCharm implements Interface.Get for the given store.
+func getCharm(s charmStore, curl *charm.URL) (charm.Charm, error) {
+	if curl.IsBundle() {
+		return nil, errgo.Newf("expected a charm URL, got bundle URL %q", curl)
 	}
-
-	// Move the archive to the expected place, and return the charm.
-	err = f.Close()
+	path, err := s.archivePath(curl)
 	if err != nil {
-		return nil, err
-	}
-	if err := utils.ReplaceFile(f.Name(), path); err != nil {
-		return nil, errgo.Notef(err, "cannot move the charm archive")
+		return nil, errgo.Mask(err, errgo.Any)
 	}
-	return charm.ReadCharmArchive(path)
+	return s.cacheEnv().readCharmArchive(path)
 }
 
-func verifyHash384AndSize(path, expectHash string, expectSize int64) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return errgo.Mask(err)
+// getBundle returns the bundle referenced by curl from the given store.
+func getBundle(s charmStore, curl *charm.URL) (charm.Bundle, error) {
+	if !curl.IsBundle() {
+		return nil, errgo.Newf("expected a bundle URL, got charm URL %q", curl)
 	}
-	defer f.Close()
-	hash := sha512.New384()
-	size, err := io.Copy(hash, f)
+	path, err := s.archivePath(curl)
 	if err != nil {
-		return errgo.Mask(err)
-	}
-	if size != expectSize {
-		logger.Debugf("size mismatch for %q", path)
-		return errgo.Newf("size mismatch for %q", path)
-	}
-	if fmt.Sprintf("%x", hash.Sum(nil)) != expectHash {
-		logger.Debugf("hash mismatch for %q", path)
-		return errgo.Newf("hash mismatch for %q", path)
+		return nil, errgo.Mask(err, errgo.Any)
 	}
-	return nil
+	return s.cacheEnv().readBundleArchive(path)
 }
 
-// Latest implements Interface.Latest.
-func (s *CharmStore) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
+// latestRevisions implements Interface.Latest for the given store.
+func latestRevisions(s charmStore, curls []*charm.URL) ([]CharmRevision, error) {
 	if len(curls) == 0 {
 		return nil, nil
 	}
@@ -167,10 +307,6 @@ func (s *CharmStore) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
 		urls[i] = url
 		values.Add("id", url)
 	}
-	u := url.URL{
-		Path:     "/meta/any",
-		RawQuery: values.Encode(),
-	}
 
 	// Execute the request and retrieve results.
 	var results map[string]struct {
@@ -179,7 +315,7 @@ func (s *CharmStore) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
 			Hash256    params.HashResponse       `json:"hash256"`
 		}
 	}
-	if err := s.client.Get(u.String(), &results); err != nil {
+	if err := s.getMeta("meta/any", values, &results); err != nil {
 		return nil, errgo.NoteMask(err, "cannot get metadata from the charm store", errgo.Any)
 	}
 
@@ -201,30 +337,184 @@ func (s *CharmStore) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
 	return responses, nil
 }
 
-// Resolve implements Interface.Resolve.
-func (s *CharmStore) Resolve(ref *charm.Reference) (*charm.URL, error) {
+// resolve implements Interface.Resolve for the given store.
+func resolve(s charmStore, ref *charm.Reference) (*charm.URL, error) {
 	var result struct {
-		Id params.IdResponse
+		Id string
 	}
-	if _, err := s.client.Meta(ref, &result); err != nil {
+	values := url.Values{"include": {"id"}}
+	if err := s.getMeta(entityPath(ref)+"/meta/any", values, &result); err != nil {
 		if errgo.Cause(err) == params.ErrNotFound {
 			// Make a prettier error message for the user.
 			return nil, errgo.WithCausef(nil, params.ErrNotFound, "cannot resolve charm URL %q: charm not found", ref)
 		}
 		return nil, errgo.NoteMask(err, fmt.Sprintf("cannot resolve charm URL %q", ref), errgo.Any)
 	}
-	url, err := result.Id.Id.URL("")
+	url, err := charm.ParseURL(result.Id)
 	if err != nil {
-		return nil, errgo.Notef(err, "cannot make fully resolved entity URL from %s", url)
+		return nil, errgo.Notef(err, "cannot make fully resolved entity URL from %q", result.Id)
 	}
 	return url, nil
 }
 
+// resolveSeries implements Interface.Resolve for the given store,
+// which may only resolve charms of the given series.
+func resolveSeries(s charmStore, ref *charm.Reference, series []string) (*charm.URL, error) {
+	curl, err := resolve(s, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSeries(series, curl); err != nil {
+		return nil, errgo.Notef(err, "cannot resolve charm URL %q", ref)
+	}
+	return curl, nil
+}
+
+// entityPath returns the API path of the entity with the given id.
+func entityPath(id *charm.Reference) string {
+	return strings.TrimPrefix(id.String(), "cs:")
+}
+
+// Get implements Interface.Get.
+func (s *CharmStore) Get(curl *charm.URL) (charm.Charm, error) {
+	return getCharm(s, curl)
+}
+
+// GetBundle returns the bundle referenced by curl.
+func (s *CharmStore) GetBundle(curl *charm.URL) (charm.Bundle, error) {
+	return getBundle(s, curl)
+}
+
+// getMeta implements charmStore.getMeta.
+func (s *CharmStore) getMeta(path string, values url.Values, result interface{}) error {
+	u := url.URL{
+		Path:     "/" + path,
+		RawQuery: values.Encode(),
+	}
+	return s.client.Get(u.String(), result)
+}
+
+// cacheEnv implements charmStore.cacheEnv.
+func (s *CharmStore) cacheEnv() cacheEnv {
+	return s.env
+}
+
+// archivePath retrieves the archive of the entity referenced by curl,
+// unless it is already in the cache, and returns its path in the cache.
+func (s *CharmStore) archivePath(curl *charm.URL) (string, error) {
+	// The cache location must have been previously set.
+	dir := cacheDir(s.cacheDir)
+	if dir == "" {
+		panic("charm cache directory path is empty")
+	}
+	kind := curl.Kind()
+
+	// Prepare the cache directory and retrieve the archive.
+	if err := s.env.fs.MkdirAll(dir, 0755); err != nil {
+		return "", errgo.Notef(err, "cannot create the cache directory")
+	}
+	r, id, expectHash, expectSize, err := s.client.GetArchive(curl.Reference())
+	if err != nil {
+		if errgo.Cause(err) == params.ErrNotFound {
+			// Make a prettier error message for the user.
+			return "", errgo.WithCausef(nil, params.ErrNotFound, "cannot retrieve %s %q: %s not found", kind, curl, kind)
+		}
+		return "", errgo.NoteMask(err, fmt.Sprintf("cannot retrieve %s %q", kind, curl), errgo.Any)
+	}
+	defer r.Close()
+
+	// Check if the archive already exists in the cache.
+	path := s.env.entryPath(dir, id, "."+string(kind))
+	if s.env.verifyHash384AndSize(path, expectHash, expectSize) == nil {
+		s.env.indexCacheEntry(dir, id, path)
+		return path, nil
+	}
+
+	// Verify and save the new archive.
+	f, err := s.env.fs.TempFile(dir, string(kind)+"-download")
+	if err != nil {
+		return "", errgo.Notef(err, "cannot make temporary file")
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+			s.env.fs.Remove(f.Name())
+		}
+	}()
+	hash := sha512.New384()
+	size, err := io.Copy(io.MultiWriter(hash, f), r)
+	if err != nil {
+		return "", errgo.Notef(err, "cannot read %s archive", kind)
+	}
+	if size != expectSize {
+		return "", errgo.Newf("size mismatch; network corruption?")
+	}
+	if fmt.Sprintf("%x", hash.Sum(nil)) != expectHash {
+		return "", errgo.Newf("hash mismatch; network corruption?")
+	}
+
+	// Move the archive to the expected place.
+	err = f.Close()
+	if err != nil {
+		return "", err
+	}
+	if err := s.env.sealArchive(f.Name()); err != nil {
+		return "", errgo.Notef(err, "cannot encrypt the %s archive", kind)
+	}
+	if err := s.env.fs.ReplaceFile(f.Name(), path); err != nil {
+		return "", errgo.Notef(err, "cannot move the %s archive", kind)
+	}
+	f = nil
+	s.env.indexCacheEntry(dir, id, path)
+	return path, nil
+}
+
+// verifyHash384AndSize checks that the cached archive at path has the
+// given hex-encoded SHA384 hash and size. The hash is not checked if
+// expectHash is empty, nor the size if expectSize is negative, as
+// when the store did not send them.
+func (env cacheEnv) verifyHash384AndSize(path, expectHash string, expectSize int64) error {
+	f, err := env.openArchive(path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer f.Close()
+	hash := sha512.New384()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if expectSize >= 0 && size != expectSize {
+		logger.Debugf("size mismatch for %q", path)
+		return errgo.Newf("size mismatch for %q", path)
+	}
+	if expectHash != "" && fmt.Sprintf("%x", hash.Sum(nil)) != expectHash {
+		logger.Debugf("hash mismatch for %q", path)
+		return errgo.Newf("hash mismatch for %q", path)
+	}
+	return nil
+}
+
+// Latest implements Interface.Latest.
+func (s *CharmStore) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
+	return latestRevisions(s, curls)
+}
+
+// Resolve implements Interface.Resolve.
+func (s *CharmStore) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	return resolveSeries(s, ref, s.series)
+}
+
 // URL returns the root endpoint URL of the charm store.
 func (s *CharmStore) URL() string {
 	return s.client.ServerURL()
 }
 
+// Profile returns the endpoint profile of the charm store.
+func (s *CharmStore) Profile() EndpointProfile {
+	return s.profile
+}
+
 // WithTestMode returns a repository Interface where test mode is enabled,
 // meaning charm store download stats are not increased when charms are
 // retrieved.
@@ -243,9 +533,14 @@ const JujuMetadataHTTPHeader = "Juju-Metadata"
 func (s *CharmStore) WithJujuAttrs(attrs map[string]string) Interface {
 	newRepo := *s
 	header := make(http.Header)
+	for key, values := range s.header {
+		header[key] = values
+	}
+	header.Del(JujuMetadataHTTPHeader)
 	for k, v := range attrs {
 		header.Add(JujuMetadataHTTPHeader, k+"="+v)
 	}
+	newRepo.header = header
 	newRepo.client.SetHTTPHeader(header)
 	return &newRepo
 }
@@ -20,6 +20,7 @@ import (
 	jujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
 	"gopkg.in/juju/charmstore.v4"
 	"gopkg.in/juju/charmstore.v4/charmstoretesting"
 	"gopkg.in/juju/charmstore.v4/csclient"
@@ -133,6 +134,39 @@ func (s *charmStoreRepoSuite) TestGet(c *gc.C) {
 	checkCharm(c, ch, expect)
 }
 
+func (s *charmStoreRepoSuite) TestGetWithCacheDir(c *gc.C) {
+	s.PatchValue(&charmrepo.CacheDir, "")
+	cacheDir := c.MkDir()
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:      s.srv.URL(),
+		CacheDir: cacheDir,
+	})
+	expect, url := s.addCharm(c, "~who/trusty/mysql-0", "mysql")
+	ch, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	checkCharm(c, ch, expect)
+	_, err = os.Stat(filepath.Join(cacheDir, charm.Quote(url.String())+".charm"))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *charmStoreRepoSuite) TestGetWithConfig(c *gc.C) {
+	cacheDir := c.MkDir()
+	s.PatchValue(&charmrepo.CacheDir, cacheDir)
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		Config: &charmrepo.Config{
+			StoreURL: s.srv.URL(),
+		},
+	})
+	// The default cache directory is read when the repository is created.
+	s.PatchValue(&charmrepo.CacheDir, c.MkDir())
+	expect, url := s.addCharm(c, "~who/trusty/mysql-0", "mysql")
+	ch, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	checkCharm(c, ch, expect)
+	_, err = os.Stat(filepath.Join(cacheDir, charm.Quote(url.String())+".charm"))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
 func (s *charmStoreRepoSuite) TestGetPromulgated(c *gc.C) {
 	expect, url := s.addCharm(c, "trusty/mysql-42", "mysql")
 	ch, err := s.repo.Get(url)
@@ -283,6 +317,19 @@ func (s *charmStoreRepoSuite) TestGetErrorBundle(c *gc.C) {
 	c.Assert(ch, gc.IsNil)
 }
 
+func (s *charmStoreRepoSuite) TestGetBundleErrorCharm(c *gc.C) {
+	b, err := s.repo.(*charmrepo.CharmStore).GetBundle(charm.MustParseURL("cs:trusty/django"))
+	c.Assert(err, gc.ErrorMatches, `expected a bundle URL, got charm URL "cs:trusty/django"`)
+	c.Assert(b, gc.IsNil)
+}
+
+func (s *charmStoreRepoSuite) TestGetBundleErrorNotFound(c *gc.C) {
+	b, err := s.repo.(*charmrepo.CharmStore).GetBundle(charm.MustParseURL("cs:bundle/no-such"))
+	c.Assert(err, gc.ErrorMatches, `cannot retrieve bundle "cs:bundle/no-such": bundle not found`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	c.Assert(b, gc.IsNil)
+}
+
 func (s *charmStoreRepoSuite) TestGetErrorCacheDir(c *gc.C) {
 	parentDir := c.MkDir()
 	err := os.Chmod(parentDir, 0)
@@ -489,6 +536,23 @@ func (s *charmStoreRepoSuite) TestResolve(c *gc.C) {
 	}
 }
 
+func (s *charmStoreRepoSuite) TestResolveWithConfigSeries(c *gc.C) {
+	s.addCharm(c, "~who/trusty/mysql-0", "mysql")
+	s.addCharm(c, "~who/precise/wordpress-2", "wordpress")
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL: s.srv.URL(),
+		Config: &charmrepo.Config{
+			Series: []string{"trusty"},
+		},
+	})
+	url, err := repo.Resolve(charm.MustParseReference("~who/mysql"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("cs:~who/trusty/mysql-0"))
+	url, err = repo.Resolve(charm.MustParseReference("~who/wordpress"))
+	c.Assert(err, gc.ErrorMatches, `cannot resolve charm URL "cs:~who/wordpress": charm "cs:~who/precise/wordpress-2" has unsupported series "precise"`)
+	c.Assert(url, gc.IsNil)
+}
+
 // hashOfCharm returns the SHA256 hash sum for the given charm name.
 func hashOfCharm(c *gc.C, name string) string {
 	path := TestCharms.CharmArchivePath(c.MkDir(), name)
@@ -0,0 +1,510 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charmstore.v4/csclient"
+	"gopkg.in/juju/charmstore.v4/params"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// Channel identifies a charm store channel, from which a published
+// revision of a charm is retrieved. Channels are only supported by
+// version 5 of the charm store API.
+type Channel string
+
+const (
+	// StableChannel holds the revisions published as stable.
+	// It is the default channel.
+	StableChannel Channel = "stable"
+
+	// DevelopmentChannel holds the revisions published for
+	// development, which are not yet considered stable.
+	DevelopmentChannel Channel = "development"
+
+	// UnpublishedChannel holds all the revisions of a charm,
+	// including those that were never published.
+	UnpublishedChannel Channel = "unpublished"
+)
+
+// StoreChannel returns the charm store channel holding the revisions
+// published to the given channel, such as the channel of a service in
+// a bundle: the stable risk maps to StableChannel and the other risks
+// to DevelopmentChannel. As the charm store has neither tracks nor
+// branches, only channels in the default track with no branch are
+// supported.
+func StoreChannel(ch charm.Channel) (Channel, error) {
+	if err := ch.Validate(); err != nil {
+		return "", errgo.Mask(err)
+	}
+	ch = ch.Normalize()
+	if ch.Track != "" || ch.Branch != "" {
+		return "", errgo.Newf("channel %q not supported by the charm store", ch)
+	}
+	if ch.Risk == charm.ChannelStable {
+		return StableChannel, nil
+	}
+	return DevelopmentChannel, nil
+}
+
+// CharmStoreV5 is a repository Interface that provides access to the
+// charm store using version 5 of its API.
+type CharmStoreV5 struct {
+	url      string
+	profile  EndpointProfile
+	doer     Doer
+	channel  Channel
+	cacheDir string
+	header   http.Header
+	noStats  bool
+	tracer   Tracer
+	ctx      context.Context
+	etags    *etagCache
+	decoders map[string]ArchiveDecoder
+
+	staleIfError bool
+	env          cacheEnv
+
+	provenance      ProvenanceLevel
+	verifySignature func(*Hashes) error
+
+	series []string
+}
+
+var _ Interface = (*CharmStoreV5)(nil)
+
+// newCharmStoreV5 returns a repository Interface using version 5
+// of the charm store API.
+func newCharmStoreV5(p NewCharmStoreParams) *CharmStoreV5 {
+	if p.CacheKey != nil {
+		panic("cache encryption not supported by version 5 of the charm store API")
+	}
+	s := &CharmStoreV5{
+		url:      strings.TrimSuffix(p.URL, "/"),
+		profile:  p.Profile,
+		doer:     p.Doer,
+		channel:  p.Channel,
+		cacheDir: p.CacheDir,
+		header:   p.requestHeader(),
+		tracer:   p.Tracer,
+		etags:    newETagCache(),
+		decoders: p.archiveDecoders(),
+
+		staleIfError: p.StaleIfError,
+		env:          newCacheEnv(p.Clock, p.FileSystem),
+
+		provenance:      p.Provenance,
+		verifySignature: p.VerifySignature,
+
+		series: p.series(),
+	}
+	if s.url == "" {
+		s.url, s.profile = csclient.ServerURL, ProductionProfile
+	}
+	if s.doer == nil && p.HTTPClient != nil {
+		s.doer = p.HTTPClient
+	}
+	if s.doer == nil {
+		s.doer = http.DefaultClient
+	}
+	if s.channel == "" {
+		s.channel = StableChannel
+	}
+	return s
+}
+
+// endpoint returns the URL of the given API path,
+// which is relative to the v5 API root, with the
+// given query parameters and the channel added.
+func (s *CharmStoreV5) endpoint(path string, values url.Values) string {
+	if values == nil {
+		values = make(url.Values)
+	}
+	values.Set("channel", string(s.channel))
+	if s.noStats {
+		values.Set("stats", "0")
+	}
+	return s.url + "/v5/" + path + "?" + values.Encode()
+}
+
+// do sends a GET request to the given URL with the given header
+// fields and returns the response. A 304 Not Modified response is
+// returned when the request is conditional. If the response has
+// an error status, the error returned by the
+// charm store is returned instead; its cause is params.ErrNotFound
+// if the entity was not found.
+func (s *CharmStoreV5) do(ctx context.Context, u string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	setTraceParent(ctx, req.Header)
+	resp, err := s.doer.Do(req)
+	if err != nil {
+		return nil, errgo.Mask(&unreachableError{err}, errgo.Any)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	if resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "" {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var errResp params.Error
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := json.Unmarshal(data, &errResp); err != nil || errResp.Message == "" {
+		errResp.Message = fmt.Sprintf("unexpected response status from %q: %s", req.URL.Path, resp.Status)
+	}
+	if resp.StatusCode == http.StatusNotFound || errResp.Code == params.ErrNotFound {
+		return nil, errgo.WithCausef(nil, params.ErrNotFound, "%s", errResp.Message)
+	}
+	return nil, errgo.New(errResp.Message)
+}
+
+// get sends a GET request to the given URL within an info span
+// and unmarshals the JSON response into result. The request is
+// made conditional if the same request was already made, so that
+// unchanged responses are not transferred again.
+func (s *CharmStoreV5) get(ctx context.Context, u string, result interface{}) (err error) {
+	ctx, span := startSpan(ctx, s.tracer, SpanInfo)
+	defer func() {
+		endSpan(span, err)
+	}()
+	cached, isCached := s.etags.get(u)
+	header := make(http.Header)
+	if isCached {
+		header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := s.do(ctx, u, header)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	defer resp.Body.Close()
+	var data []byte
+	if resp.StatusCode == http.StatusNotModified {
+		data = cached.value.([]byte)
+	} else {
+		data, err = ioutil.ReadAll(io.LimitReader(resp.Body, DefaultMaxResponseSize+1))
+		if err != nil {
+			return errgo.Notef(err, "cannot read response")
+		}
+		if len(data) > DefaultMaxResponseSize {
+			return &ResponseTooLargeError{Limit: DefaultMaxResponseSize}
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			s.etags.set(u, etag, data, int64(len(data)))
+		}
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return errgo.Notef(err, "cannot unmarshal response")
+	}
+	return nil
+}
+
+// getMeta implements charmStore.getMeta.
+func (s *CharmStoreV5) getMeta(path string, values url.Values, result interface{}) error {
+	return s.get(s.ctx, s.endpoint(path, values), result)
+}
+
+// cacheEnv implements charmStore.cacheEnv.
+func (s *CharmStoreV5) cacheEnv() cacheEnv {
+	return s.env
+}
+
+// Get implements Interface.Get.
+func (s *CharmStoreV5) Get(curl *charm.URL) (charm.Charm, error) {
+	return getCharm(s, curl)
+}
+
+// GetBundle returns the bundle referenced by curl.
+func (s *CharmStoreV5) GetBundle(curl *charm.URL) (charm.Bundle, error) {
+	return getBundle(s, curl)
+}
+
+// archivePath retrieves and verifies the archive of the entity
+// referenced by curl, unless it is already in the cache, and
+// returns its path in the cache.
+func (s *CharmStoreV5) archivePath(curl *charm.URL) (string, error) {
+	// The cache location must have been previously set.
+	dir := cacheDir(s.cacheDir)
+	if dir == "" {
+		panic("charm cache directory path is empty")
+	}
+	if err := s.env.fs.MkdirAll(dir, 0755); err != nil {
+		return "", errgo.Notef(err, "cannot create the cache directory")
+	}
+	ctx, span := startSpan(s.ctx, s.tracer, SpanDownload)
+	dl, err := s.download(ctx, dir, curl)
+	endSpan(span, err)
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Any)
+	}
+	defer dl.close()
+	ctx, span = startSpan(s.ctx, s.tracer, SpanVerify)
+	err = dl.verify(func(path string) error {
+		return s.checkProvenance(ctx, dir, dl.id, path)
+	})
+	endSpan(span, err)
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Any)
+	}
+	s.env.indexCacheEntry(dir, dl.id, dl.path)
+	return dl.path, nil
+}
+
+// archiveDownload holds an archive retrieved from the charm store.
+type archiveDownload struct {
+	// id holds the fully qualified id of the entity.
+	id *charm.URL
+
+	// path holds the location of the archive in the cache.
+	path string
+
+	// file holds the downloaded archive, or nil if
+	// the archive was already in the cache.
+	file TempFile
+
+	// fs holds the file system the archive is stored in.
+	fs FileSystem
+
+	expectHash string
+	expectSize int64
+	hash       string
+	size       int64
+}
+
+// download retrieves the archive of the given entity into a temporary
+// file in dir, unless a matching archive is already in the cache.
+func (s *CharmStoreV5) download(ctx context.Context, dir string, curl *charm.URL) (*archiveDownload, error) {
+	kind := curl.Kind()
+	archiveURL := s.endpoint(entityPath(curl.Reference())+"/archive", nil)
+
+	// Make the request conditional if the archive was already
+	// retrieved, so that it is not transferred again if unchanged.
+	cacheKey := dir + " " + archiveURL
+	cached, isCached := s.etags.get(cacheKey)
+	header := make(http.Header)
+	if isCached {
+		header.Set("If-None-Match", cached.etag)
+	}
+	if s.decoders != nil {
+		header.Set("Accept-Encoding", acceptEncoding(s.decoders))
+	}
+	resp, err := s.do(ctx, archiveURL, header)
+	if err != nil {
+		if errgo.Cause(err) == params.ErrNotFound {
+			// Make a prettier error message for the user.
+			return nil, errgo.WithCausef(nil, params.ErrNotFound, "cannot retrieve %s %q: %s not found", kind, curl, kind)
+		}
+		return nil, errgo.NoteMask(err, fmt.Sprintf("cannot retrieve %s %q", kind, curl), errgo.Any)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		dl := cached.value.(archiveDownload)
+		if s.env.verifyHash384AndSize(dl.path, dl.expectHash, dl.expectSize) == nil {
+			return &dl, nil
+		}
+		// The cached archive has been removed or altered,
+		// so retrieve it again unconditionally.
+		s.etags.remove(cacheKey)
+		return s.download(ctx, dir, curl)
+	}
+	id, err := charm.ParseURL(resp.Header.Get(params.EntityIdHeader))
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid entity id in response")
+	}
+	// Decode the archive if it was compressed for transfer,
+	// so that its hash is checked against the archive itself.
+	body, encoded, err := decodedBody(resp, s.decoders)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve %s %q", kind, curl)
+	}
+	defer body.Close()
+	dl := &archiveDownload{
+		id:         id,
+		path:       s.env.entryPath(dir, id, "."+string(kind)),
+		fs:         s.env.fs,
+		expectHash: resp.Header.Get(params.ContentHashHeader),
+		expectSize: resp.ContentLength,
+	}
+	if encoded {
+		// The content length is that of the encoded archive.
+		dl.expectSize = -1
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		s.etags.set(cacheKey, etag, *dl, 0)
+	}
+
+	// Check if the archive already exists in the cache.
+	if s.env.verifyHash384AndSize(dl.path, dl.expectHash, dl.expectSize) == nil {
+		return dl, nil
+	}
+
+	// Save the new archive.
+	f, err := s.env.fs.TempFile(dir, string(kind)+"-download")
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot make temporary file")
+	}
+	hash := sha512.New384()
+	size, err := io.Copy(io.MultiWriter(hash, f), body)
+	if err != nil {
+		f.Close()
+		s.env.fs.Remove(f.Name())
+		return nil, errgo.Notef(err, "cannot read %s archive", kind)
+	}
+	dl.file = f
+	dl.hash = fmt.Sprintf("%x", hash.Sum(nil))
+	dl.size = size
+	return dl, nil
+}
+
+// verify checks the downloaded archive against the size and hash
+// sent by the charm store and with the given check function, and
+// moves it into the cache.
+func (dl *archiveDownload) verify(check func(path string) error) error {
+	if dl.file == nil {
+		return errgo.Mask(check(dl.path), errgo.Any)
+	}
+	if dl.expectSize >= 0 && dl.size != dl.expectSize {
+		return errgo.Newf("size mismatch; network corruption?")
+	}
+	if dl.expectHash != "" && dl.hash != dl.expectHash {
+		return errgo.Newf("hash mismatch; network corruption?")
+	}
+	if err := check(dl.file.Name()); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	// Move the archive to the expected place.
+	if err := dl.file.Close(); err != nil {
+		return err
+	}
+	if err := dl.fs.ReplaceFile(dl.file.Name(), dl.path); err != nil {
+		return errgo.Notef(err, "cannot move the %s archive", dl.id.Kind())
+	}
+	dl.file = nil
+	return nil
+}
+
+// close releases the temporary file holding the
+// downloaded archive, if it was not moved to the cache.
+func (dl *archiveDownload) close() {
+	if dl.file != nil {
+		dl.file.Close()
+		dl.fs.Remove(dl.file.Name())
+	}
+}
+
+// Latest implements Interface.Latest. When the repository was
+// created with StaleIfError set, the revisions retrieved are recorded
+// in the cache directory, and used when the store cannot be reached.
+func (s *CharmStoreV5) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
+	revisions, err := latestRevisions(s, curls)
+	dir := cacheDir(s.cacheDir)
+	if !s.staleIfError || dir == "" || len(curls) == 0 {
+		return revisions, err
+	}
+	keys := s.revisionCacheKeys(curls)
+	if err != nil {
+		if isUnreachable(err) {
+			if stale, ok := s.env.staleRevisions(dir, keys, err); ok {
+				return stale, nil
+			}
+		}
+		return nil, err
+	}
+	s.env.recordRevisions(dir, keys, revisions)
+	return revisions, nil
+}
+
+// revisionCacheKeys returns the keys under which the latest revisions
+// of the entities referenced by curls are recorded in the revision
+// cache. As the latest revision depends on the store and on the
+// channel, the keys include them.
+func (s *CharmStoreV5) revisionCacheKeys(curls []*charm.URL) []string {
+	keys := make([]string, len(curls))
+	for i, curl := range curls {
+		keys[i] = s.url + " " + string(s.channel) + " " + curl.WithRevision(-1).String()
+	}
+	return keys
+}
+
+// Resolve implements Interface.Resolve.
+func (s *CharmStoreV5) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	return resolveSeries(s, ref, s.series)
+}
+
+// URL returns the root endpoint URL of the charm store.
+func (s *CharmStoreV5) URL() string {
+	return s.url
+}
+
+// Profile returns the endpoint profile of the charm store.
+func (s *CharmStoreV5) Profile() EndpointProfile {
+	return s.profile
+}
+
+// Channel returns the channel used by the repository.
+func (s *CharmStoreV5) Channel() Channel {
+	return s.channel
+}
+
+// WithChannel returns a repository Interface that retrieves
+// charms from the given channel.
+func (s *CharmStoreV5) WithChannel(channel Channel) Interface {
+	newRepo := *s
+	newRepo.channel = channel
+	return &newRepo
+}
+
+// WithContext returns a repository Interface that traces its
+// operations as children of the span held by ctx, if any, and
+// propagates the trace to the charm store.
+func (s *CharmStoreV5) WithContext(ctx context.Context) Interface {
+	newRepo := *s
+	newRepo.ctx = ctx
+	return &newRepo
+}
+
+// WithTestMode returns a repository Interface where test mode is enabled,
+// meaning charm store download stats are not increased when charms are
+// retrieved.
+func (s *CharmStoreV5) WithTestMode() Interface {
+	newRepo := *s
+	newRepo.noStats = true
+	return &newRepo
+}
+
+// WithJujuAttrs returns a repository Interface with the Juju metadata
+// attributes set.
+func (s *CharmStoreV5) WithJujuAttrs(attrs map[string]string) Interface {
+	newRepo := *s
+	newRepo.header = make(http.Header)
+	for key, values := range s.header {
+		newRepo.header[key] = values
+	}
+	newRepo.header.Del(JujuMetadataHTTPHeader)
+	for k, v := range attrs {
+		newRepo.header.Add(JujuMetadataHTTPHeader, k+"="+v)
+	}
+	return &newRepo
+}
@@ -0,0 +1,859 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charmstore.v4/params"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+// fakeV5Entity holds an entity published in a channel
+// of the fake v5 charm store.
+type fakeV5Entity struct {
+	id      *charm.URL
+	archive []byte
+	hashes  []byte
+}
+
+// fakeV5Store implements a minimal subset of the v5 charm store API.
+// Entities are keyed by channel and then by unrevisioned id.
+type fakeV5Store struct {
+	entities map[string]map[string]fakeV5Entity
+	requests []*http.Request
+
+	// encodings holds the content codings the store
+	// can use to send archives, keyed by coding.
+	encodings map[string]func([]byte) []byte
+
+	// bare specifies that archives are sent in chunks,
+	// with no content hash and no ETag.
+	bare bool
+}
+
+func (s *fakeV5Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r)
+	channel := r.URL.Query().Get("channel")
+	path := strings.TrimPrefix(r.URL.Path, "/v5/")
+	if path == "meta/any" {
+		results := make(map[string]interface{})
+		for _, id := range r.URL.Query()["id"] {
+			e, ok := s.lookup(channel, id)
+			if !ok {
+				continue
+			}
+			results[id] = map[string]interface{}{
+				"Meta": map[string]interface{}{
+					"id-revision": params.IdRevisionResponse{Revision: e.id.Revision},
+					"hash256":     params.HashResponse{Sum: fmt.Sprintf("%x", sha256.Sum256(e.archive))},
+				},
+			}
+		}
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+	for _, suffix := range []string{"/meta/any", "/archive", "/" + charmrepo.HashesFile} {
+		if !strings.HasSuffix(path, suffix) {
+			continue
+		}
+		e, ok := s.lookup(channel, strings.TrimSuffix(path, suffix))
+		if suffix == "/"+charmrepo.HashesFile && e.hashes == nil {
+			ok = false
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(params.Error{
+				Code:    params.ErrNotFound,
+				Message: "no matching charm or bundle",
+			})
+			return
+		}
+		switch suffix {
+		case "/meta/any":
+			etag := `"` + e.id.String() + `"`
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"Id": e.id.String()})
+			return
+		case "/" + charmrepo.HashesFile:
+			w.Write(e.hashes)
+			return
+		}
+		hash := fmt.Sprintf("%x", sha512.Sum384(e.archive))
+		w.Header().Set(params.EntityIdHeader, e.id.String())
+		if s.bare {
+			w.(http.Flusher).Flush()
+			w.Write(e.archive)
+			return
+		}
+		etag := `"` + hash + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(params.ContentHashHeader, hash)
+		for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+			coding = strings.TrimSpace(strings.Split(coding, ";")[0])
+			if encode, ok := s.encodings[coding]; ok {
+				w.Header().Set("Content-Encoding", coding)
+				w.Write(encode(e.archive))
+				return
+			}
+		}
+		w.Write(e.archive)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *fakeV5Store) lookup(channel, id string) (fakeV5Entity, bool) {
+	ref, err := charm.ParseReference(id)
+	if err != nil {
+		return fakeV5Entity{}, false
+	}
+	rev := ref.Revision
+	ref.Revision = -1
+	e, ok := s.entities[channel][ref.String()]
+	if !ok || rev != -1 && rev != e.id.Revision {
+		return fakeV5Entity{}, false
+	}
+	return e, true
+}
+
+type charmStoreV5Suite struct {
+	jujutesting.IsolationSuite
+	store *fakeV5Store
+	srv   *httptest.Server
+	repo  charmrepo.Interface
+}
+
+var _ = gc.Suite(&charmStoreV5Suite{})
+
+func (s *charmStoreV5Suite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.store = &fakeV5Store{
+		entities: make(map[string]map[string]fakeV5Entity),
+	}
+	s.srv = httptest.NewServer(s.store)
+	s.repo = charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   c.MkDir(),
+	})
+}
+
+func (s *charmStoreV5Suite) TearDownTest(c *gc.C) {
+	s.srv.Close()
+	s.IsolationSuite.TearDownTest(c)
+}
+
+// publish adds the named testing charm or bundle to the given
+// channel of the fake store with the given id.
+func (s *charmStoreV5Suite) publish(c *gc.C, channel charmrepo.Channel, id, name string) *charm.URL {
+	url := charm.MustParseURL(id)
+	path := TestCharms.CharmArchivePath
+	if url.IsBundle() {
+		path = TestCharms.BundleArchivePath
+	}
+	data, err := ioutil.ReadFile(path(c.MkDir(), name))
+	c.Assert(err, jc.ErrorIsNil)
+	if s.store.entities[string(channel)] == nil {
+		s.store.entities[string(channel)] = make(map[string]fakeV5Entity)
+	}
+	s.store.entities[string(channel)][url.WithRevision(-1).String()] = fakeV5Entity{
+		id:      url,
+		archive: data,
+	}
+	return url
+}
+
+func (s *charmStoreV5Suite) TestGetChunkedWithoutHash(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.store.bare = true
+	dir := c.MkDir()
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   dir,
+	})
+	for i := 0; i < 2; i++ {
+		ch, err := repo.Get(url)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(ch.Meta().Name, gc.Equals, "mysql")
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.charm"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(paths, gc.HasLen, 1)
+}
+
+func (s *charmStoreV5Suite) TestGetCorruptedLeavesNoTempFile(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	dir := c.MkDir()
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   dir,
+		Doer: charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				resp.Header.Set(params.ContentHashHeader, "bad")
+			}
+			return resp, err
+		}),
+	})
+	_, err := repo.Get(url)
+	c.Assert(err, gc.ErrorMatches, `hash mismatch; network corruption\?`)
+	paths, err := filepath.Glob(filepath.Join(dir, "*-download*"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(paths, gc.HasLen, 0)
+}
+
+func (s *charmStoreV5Suite) TestNewCharmStore(c *gc.C) {
+	repo, ok := s.repo.(*charmrepo.CharmStoreV5)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(repo.URL(), gc.Equals, s.srv.URL)
+	c.Assert(repo.Channel(), gc.Equals, charmrepo.StableChannel)
+}
+
+func (s *charmStoreV5Suite) TestGet(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+
+	ch, err := s.repo.Get(url.WithRevision(-1))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "mysql")
+	c.Assert(ch.(*charm.CharmArchive).Path, gc.Matches, `.*/cs_3a_trusty_2f_mysql-3\.charm`)
+
+	req := s.store.requests[len(s.store.requests)-1]
+	c.Assert(req.URL.Path, gc.Equals, "/v5/trusty/mysql/archive")
+	c.Assert(req.URL.Query().Get("channel"), gc.Equals, "stable")
+}
+
+func (s *charmStoreV5Suite) TestGetNotFound(c *gc.C) {
+	ch, err := s.repo.Get(charm.MustParseURL("cs:trusty/no-such"))
+	c.Assert(err, gc.ErrorMatches, `cannot retrieve charm "cs:trusty/no-such": charm not found`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	c.Assert(ch, gc.IsNil)
+}
+
+func (s *charmStoreV5Suite) TestGetDevelopmentChannel(c *gc.C) {
+	s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.publish(c, charmrepo.DevelopmentChannel, "cs:trusty/mysql-4", "mysql")
+	repo := s.repo.(*charmrepo.CharmStoreV5).WithChannel(charmrepo.DevelopmentChannel)
+
+	url, err := repo.Resolve(charm.MustParseReference("cs:trusty/mysql"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url.String(), gc.Equals, "cs:trusty/mysql-4")
+
+	ch, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.(*charm.CharmArchive).Path, gc.Matches, `.*/cs_3a_trusty_2f_mysql-4\.charm`)
+
+	// The original repository still uses the stable channel.
+	url, err = s.repo.Resolve(charm.MustParseReference("cs:trusty/mysql"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url.String(), gc.Equals, "cs:trusty/mysql-3")
+}
+
+var storeChannelTests = []struct {
+	channel     string
+	expect      charmrepo.Channel
+	expectError string
+}{{
+	channel: "stable",
+	expect:  charmrepo.StableChannel,
+}, {
+	channel: "candidate",
+	expect:  charmrepo.DevelopmentChannel,
+}, {
+	channel: "edge",
+	expect:  charmrepo.DevelopmentChannel,
+}, {
+	channel:     "8.0/stable",
+	expectError: `channel "8.0/stable" not supported by the charm store`,
+}, {
+	channel:     "stable/hotfix",
+	expectError: `channel "stable/hotfix" not supported by the charm store`,
+}}
+
+func (s *charmStoreV5Suite) TestStoreChannel(c *gc.C) {
+	for i, test := range storeChannelTests {
+		c.Logf("test %d: %s", i, test.channel)
+		channel, err := charmrepo.StoreChannel(charm.MustParseChannel(test.channel))
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(channel, gc.Equals, test.expect)
+	}
+}
+
+func (s *charmStoreV5Suite) TestResolveAllChannel(c *gc.C) {
+	s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.publish(c, charmrepo.DevelopmentChannel, "cs:trusty/mysql-4", "mysql")
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    db:
+        charm: cs:trusty/mysql
+        channel: edge
+`))
+	c.Assert(err, jc.ErrorIsNil)
+	plan, err := charmrepo.ResolveAll(bd, s.repo)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(plan.Charms["cs:trusty/mysql"].String(), gc.Equals, "cs:trusty/mysql-4")
+}
+
+func (s *charmStoreV5Suite) TestGetErrorBundle(c *gc.C) {
+	ch, err := s.repo.Get(charm.MustParseURL("cs:bundle/django"))
+	c.Assert(err, gc.ErrorMatches, `expected a charm URL, got bundle URL "cs:bundle/django"`)
+	c.Assert(ch, gc.IsNil)
+}
+
+func (s *charmStoreV5Suite) TestGetMovesLongCacheEntry(c *gc.C) {
+	id := "cs:~" + strings.Repeat("a", 200) + "/trusty/mysql-3"
+	url := s.publish(c, charmrepo.StableChannel, id, "mysql")
+	dir := c.MkDir()
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   dir,
+	})
+	// Entries whose names are too long for charm.QuoteV2
+	// were stored under their charm.Quote name.
+	data, err := ioutil.ReadFile(TestCharms.CharmArchivePath(c.MkDir(), "mysql"))
+	c.Assert(err, jc.ErrorIsNil)
+	oldPath := filepath.Join(dir, charm.Quote(id)+".charm")
+	err = ioutil.WriteFile(oldPath, data, 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	ch, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.(*charm.CharmArchive).Path, gc.Equals, filepath.Join(dir, charm.QuoteV2(id)+".charm"))
+	_, err = os.Stat(oldPath)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *charmStoreV5Suite) TestGetNotModified(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	ch, err := s.repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	path := ch.(*charm.CharmArchive).Path
+	c.Assert(s.store.requests[0].Header.Get("If-None-Match"), gc.Equals, "")
+
+	// The second request is conditional.
+	ch, err = s.repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.(*charm.CharmArchive).Path, gc.Equals, path)
+	c.Assert(s.store.requests, gc.HasLen, 2)
+	c.Assert(s.store.requests[1].Header.Get("If-None-Match"), gc.Not(gc.Equals), "")
+
+	// If the cached archive is removed, it is retrieved again.
+	err = os.Remove(path)
+	c.Assert(err, jc.ErrorIsNil)
+	ch, err = s.repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.(*charm.CharmArchive).Path, gc.Equals, path)
+	c.Assert(s.store.requests, gc.HasLen, 4)
+	c.Assert(s.store.requests[3].Header.Get("If-None-Match"), gc.Equals, "")
+}
+
+func (s *charmStoreV5Suite) TestGetBundle(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:bundle/wordpress-simple-2", "wordpress-simple")
+	repo := s.repo.(*charmrepo.CharmStoreV5)
+
+	b, err := repo.GetBundle(url.WithRevision(-1))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(b.Data().Services, gc.HasLen, 2)
+	c.Assert(b.ReadMe(), gc.Not(gc.Equals), "")
+	path := b.(*charm.BundleArchive).Path
+	c.Assert(path, gc.Matches, `.*/cs_3a_bundle_2f_wordpress-simple-2\.bundle`)
+
+	// The bundle is retrieved from the cache the second time.
+	b, err = repo.GetBundle(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(b.(*charm.BundleArchive).Path, gc.Equals, path)
+}
+
+func (s *charmStoreV5Suite) TestGetBundleErrorCharm(c *gc.C) {
+	b, err := s.repo.(*charmrepo.CharmStoreV5).GetBundle(charm.MustParseURL("cs:trusty/django"))
+	c.Assert(err, gc.ErrorMatches, `expected a bundle URL, got charm URL "cs:trusty/django"`)
+	c.Assert(b, gc.IsNil)
+}
+
+func (s *charmStoreV5Suite) TestGetBundleNotFound(c *gc.C) {
+	b, err := s.repo.(*charmrepo.CharmStoreV5).GetBundle(charm.MustParseURL("cs:bundle/no-such"))
+	c.Assert(err, gc.ErrorMatches, `cannot retrieve bundle "cs:bundle/no-such": bundle not found`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	c.Assert(b, gc.IsNil)
+}
+
+func (s *charmStoreV5Suite) TestLatest(c *gc.C) {
+	mysql := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.publish(c, charmrepo.DevelopmentChannel, "cs:trusty/wordpress-2", "wordpress")
+
+	revs, err := s.repo.Latest(
+		charm.MustParseURL("cs:trusty/mysql-0"),
+		charm.MustParseURL("cs:trusty/wordpress"),
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(revs, gc.HasLen, 2)
+	c.Assert(revs[0].Err, gc.IsNil)
+	c.Assert(revs[0].Revision, gc.Equals, mysql.Revision)
+	c.Assert(revs[0].Sha256, gc.Not(gc.Equals), "")
+	c.Assert(revs[1].Err, gc.ErrorMatches, `charm not found: cs:trusty/wordpress`)
+
+	req := s.store.requests[len(s.store.requests)-1]
+	c.Assert(req.URL.Path, gc.Equals, "/v5/meta/any")
+	c.Assert(req.URL.Query()["include"], jc.SameContents, []string{"id-revision", "hash256"})
+}
+
+func (s *charmStoreV5Suite) TestLatestStaleIfError(c *gc.C) {
+	mysql := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	dir := c.MkDir()
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:          s.srv.URL,
+		APIVersion:   5,
+		CacheDir:     dir,
+		StaleIfError: true,
+	})
+	revs, err := repo.Latest(mysql)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(revs, gc.HasLen, 1)
+	c.Assert(revs[0].Revision, gc.Equals, mysql.Revision)
+	c.Assert(revs[0].Stale, jc.IsFalse)
+
+	unreachable := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:          s.srv.URL,
+		APIVersion:   5,
+		CacheDir:     dir,
+		StaleIfError: true,
+		Doer: charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errgo.New("connection refused")
+		}),
+	})
+	revs, err = unreachable.Latest(mysql)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(revs, jc.DeepEquals, []charmrepo.CharmRevision{{
+		Revision: mysql.Revision,
+		Sha256:   revs[0].Sha256,
+		Stale:    true,
+	}})
+	c.Assert(revs[0].Sha256, gc.Not(gc.Equals), "")
+
+	// The revisions are recorded per channel.
+	_, err = unreachable.(*charmrepo.CharmStoreV5).WithChannel(charmrepo.DevelopmentChannel).Latest(mysql)
+	c.Assert(err, gc.ErrorMatches, `cannot get metadata from the charm store: .*connection refused`)
+
+	// Errors returned by the store are returned as such.
+	failing := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:          s.srv.URL,
+		APIVersion:   5,
+		CacheDir:     dir,
+		StaleIfError: true,
+		Doer: charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusUnauthorized,
+				Status:     "401 Unauthorized",
+				Body:       ioutil.NopCloser(strings.NewReader(`{"Message": "access denied"}`)),
+			}, nil
+		}),
+	})
+	_, err = failing.Latest(mysql)
+	c.Assert(err, gc.ErrorMatches, `cannot get metadata from the charm store: access denied`)
+
+	// The revisions are recorded per store.
+	other := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:          "http://0.1.2.3",
+		APIVersion:   5,
+		CacheDir:     dir,
+		StaleIfError: true,
+		Doer: charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errgo.New("connection refused")
+		}),
+	})
+	_, err = other.Latest(mysql)
+	c.Assert(err, gc.ErrorMatches, `cannot get metadata from the charm store: .*connection refused`)
+}
+
+func (s *charmStoreV5Suite) TestResolveNotFound(c *gc.C) {
+	url, err := s.repo.Resolve(charm.MustParseReference("cs:trusty/no-such"))
+	c.Assert(err, gc.ErrorMatches, `cannot resolve charm URL "cs:trusty/no-such": charm not found`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	c.Assert(url, gc.IsNil)
+}
+
+func (s *charmStoreV5Suite) TestResolveNotModified(c *gc.C) {
+	s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	url, err := s.repo.Resolve(charm.MustParseReference("cs:trusty/mysql"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url.String(), gc.Equals, "cs:trusty/mysql-3")
+	c.Assert(s.store.requests, gc.HasLen, 1)
+	c.Assert(s.store.requests[0].Header.Get("If-None-Match"), gc.Equals, "")
+
+	// The second request is conditional and
+	// the cached response is used.
+	url, err = s.repo.Resolve(charm.MustParseReference("cs:trusty/mysql"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url.String(), gc.Equals, "cs:trusty/mysql-3")
+	c.Assert(s.store.requests, gc.HasLen, 2)
+	c.Assert(s.store.requests[1].Header.Get("If-None-Match"), gc.Equals, `"cs:trusty/mysql-3"`)
+}
+
+func (s *charmStoreV5Suite) TestWithTestMode(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	repo := s.repo.(*charmrepo.CharmStoreV5).WithTestMode()
+	_, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	req := s.store.requests[len(s.store.requests)-1]
+	c.Assert(req.URL.Query().Get("stats"), gc.Equals, "0")
+}
+
+func (s *charmStoreV5Suite) TestWithJujuAttrs(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	repo := s.repo.(*charmrepo.CharmStoreV5).WithJujuAttrs(map[string]string{
+		"environment_uuid": "dead-beef",
+	})
+	_, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	req := s.store.requests[len(s.store.requests)-1]
+	c.Assert(req.Header.Get(charmrepo.JujuMetadataHTTPHeader), gc.Equals, "environment_uuid=dead-beef")
+}
+
+func (s *charmStoreV5Suite) TestDefaultUserAgent(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	_, err := s.repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	for _, req := range s.store.requests {
+		c.Assert(req.Header.Get("User-Agent"), gc.Equals, charmrepo.DefaultUserAgent)
+	}
+}
+
+func (s *charmStoreV5Suite) TestUserAgentAndHeader(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   c.MkDir(),
+		UserAgent:  "my-deployer/1.0",
+		Header: http.Header{
+			"x-quota-project": {"testing"},
+			"User-Agent":      {"ignored"},
+		},
+	})
+	repo = repo.(*charmrepo.CharmStoreV5).WithJujuAttrs(map[string]string{
+		"environment_uuid": "dead-beef",
+	})
+	_, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.store.requests, gc.Not(gc.HasLen), 0)
+	for _, req := range s.store.requests {
+		c.Assert(req.Header.Get("User-Agent"), gc.Equals, "my-deployer/1.0")
+		c.Assert(req.Header.Get("X-Quota-Project"), gc.Equals, "testing")
+		c.Assert(req.Header.Get(charmrepo.JujuMetadataHTTPHeader), gc.Equals, "environment_uuid=dead-beef")
+	}
+}
+
+func (s *charmStoreV5Suite) TestDoer(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	var paths []string
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   c.MkDir(),
+		Doer: charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			paths = append(paths, req.URL.Path)
+			return http.DefaultClient.Do(req)
+		}),
+	})
+	_, err := repo.Resolve(url.Reference())
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(paths, jc.DeepEquals, []string{"/v5/trusty/mysql-3/meta/any", "/v5/trusty/mysql-3/archive"})
+}
+
+func gzipData(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func (s *charmStoreV5Suite) TestGetCompressedTransfer(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.store.encodings = map[string]func([]byte) []byte{
+		"gzip": gzipData,
+	}
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:                s.srv.URL,
+		APIVersion:         5,
+		CacheDir:           c.MkDir(),
+		CompressedTransfer: true,
+	})
+	ch, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "mysql")
+	req := s.store.requests[len(s.store.requests)-1]
+	c.Assert(req.Header.Get("Accept-Encoding"), gc.Equals, "gzip;q=0.5")
+
+	// The cached archive is reused.
+	s.store.requests = nil
+	ch, err = repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "mysql")
+	c.Assert(s.store.requests, gc.HasLen, 1)
+	c.Assert(s.store.requests[0].Header.Get("If-None-Match"), gc.Not(gc.Equals), "")
+}
+
+func (s *charmStoreV5Suite) TestGetCompressedTransferCustomDecoder(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.store.encodings = map[string]func([]byte) []byte{
+		"x-base64": func(data []byte) []byte {
+			return []byte(base64.StdEncoding.EncodeToString(data))
+		},
+		"gzip": gzipData,
+	}
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:                s.srv.URL,
+		APIVersion:         5,
+		CacheDir:           c.MkDir(),
+		CompressedTransfer: true,
+		ArchiveDecoders: map[string]charmrepo.ArchiveDecoder{
+			"x-base64": func(r io.Reader) (io.ReadCloser, error) {
+				return ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, r)), nil
+			},
+		},
+	})
+	ch, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "mysql")
+	req := s.store.requests[len(s.store.requests)-1]
+	c.Assert(req.Header.Get("Accept-Encoding"), gc.Equals, "x-base64, gzip;q=0.5")
+}
+
+func (s *charmStoreV5Suite) TestGetCompressedTransferCorrupted(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.store.encodings = map[string]func([]byte) []byte{
+		"gzip": func(data []byte) []byte {
+			return gzipData(append(data, "extra"...))
+		},
+	}
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:                s.srv.URL,
+		APIVersion:         5,
+		CacheDir:           c.MkDir(),
+		CompressedTransfer: true,
+	})
+	_, err := repo.Get(url)
+	c.Assert(err, gc.ErrorMatches, `hash mismatch; network corruption\?`)
+}
+
+func (s *charmStoreV5Suite) TestGetUnsupportedEncoding(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.store.encodings = map[string]func([]byte) []byte{
+		"br": func(data []byte) []byte {
+			return data
+		},
+	}
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:                s.srv.URL,
+		APIVersion:         5,
+		CacheDir:           c.MkDir(),
+		CompressedTransfer: true,
+		// Simulate a proxy that rewrites the requested encodings.
+		Doer: charmrepo.WithHeader(http.DefaultClient, http.Header{
+			"Accept-Encoding": {"br"},
+		}),
+	})
+	_, err := repo.Get(url)
+	c.Assert(err, gc.ErrorMatches, `cannot retrieve charm "cs:trusty/mysql-3": unsupported content encoding "br"`)
+}
+
+func (s *charmStoreV5Suite) TestTracing(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	tracer := &fakeTracer{}
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   c.MkDir(),
+		Tracer:     tracer,
+	})
+	ctx, parent := tracer.start("deploy")
+	repo = repo.(*charmrepo.CharmStoreV5).WithContext(ctx)
+
+	_, err := repo.Resolve(url.Reference())
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = repo.Resolve(charm.MustParseReference("cs:trusty/no-such"))
+	c.Assert(err, gc.NotNil)
+
+	c.Assert(tracer.spans, gc.HasLen, 5)
+	for i, name := range []string{"deploy", charmrepo.SpanInfo, charmrepo.SpanDownload, charmrepo.SpanVerify, charmrepo.SpanInfo} {
+		span := tracer.spans[i]
+		c.Assert(span.name, gc.Equals, name)
+		if i > 0 {
+			c.Assert(span.parent, gc.Equals, parent)
+			c.Assert(span.ended, jc.IsTrue)
+		}
+	}
+	c.Assert(tracer.spans[2].err, gc.IsNil)
+	c.Assert(tracer.spans[4].err, gc.NotNil)
+
+	// The request spans are propagated to the charm store.
+	c.Assert(s.store.requests, gc.HasLen, 3)
+	for i, spanIndex := range []int{1, 2, 4} {
+		header := s.store.requests[i].Header.Get(charmrepo.TraceParentHeader)
+		c.Assert(header, gc.Equals, tracer.spans[spanIndex].SpanContext().TraceParent())
+	}
+}
+
+func (s *charmStoreV5Suite) TestTraceParentWithoutTracer(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	ctx, _ := (&fakeTracer{}).start("deploy")
+	repo := s.repo.(*charmrepo.CharmStoreV5).WithContext(ctx)
+	_, err := repo.Resolve(url.Reference())
+	c.Assert(err, jc.ErrorIsNil)
+	header := s.store.requests[0].Header.Get(charmrepo.TraceParentHeader)
+	c.Assert(header, gc.Equals, "00-01000000000000000000000000000000-0100000000000000-01")
+}
+
+// setHashes sets the hashes document served for the given
+// published charm, with the given extra fields.
+func (s *charmStoreV5Suite) setHashes(c *gc.C, channel charmrepo.Channel, url *charm.URL, sha384, extra string) {
+	key := url.WithRevision(-1).String()
+	e := s.store.entities[string(channel)][key]
+	if sha384 == "" {
+		sha384 = fmt.Sprintf("%x", sha512.Sum384(e.archive))
+	}
+	e.hashes = []byte(fmt.Sprintf("id: %s\ndigests:\n  sha256: %x\n  sha384: %s\n%s", url, sha256.Sum256(e.archive), sha384, extra))
+	s.store.entities[string(channel)][key] = e
+}
+
+var provenanceTests = []struct {
+	about      string
+	provenance charmrepo.ProvenanceLevel
+	noHashes   bool
+	sha384     string
+	extra      string
+	err        string
+}{{
+	about:      "no provenance required",
+	provenance: charmrepo.ProvenanceNone,
+	noHashes:   true,
+}, {
+	about:      "digest required and missing",
+	provenance: charmrepo.ProvenanceDigest,
+	noHashes:   true,
+	err:        `no hashes document for "cs:trusty/mysql-3"`,
+}, {
+	about:      "digest required",
+	provenance: charmrepo.ProvenanceDigest,
+}, {
+	about:      "digest mismatch",
+	provenance: charmrepo.ProvenanceDigest,
+	sha384:     "bad",
+	err:        `sha384 digest mismatch for "cs:trusty/mysql-3"`,
+}, {
+	about:      "signature required and missing",
+	provenance: charmrepo.ProvenanceSigned,
+	err:        `charm "cs:trusty/mysql-3" has provenance digest, signed required`,
+}, {
+	about:      "signature required",
+	provenance: charmrepo.ProvenanceSigned,
+	extra:      "signature: good\n",
+}, {
+	about:      "invalid signature",
+	provenance: charmrepo.ProvenanceSigned,
+	extra:      "signature: bad\n",
+	err:        `invalid signature for "cs:trusty/mysql-3": bad signature`,
+}, {
+	about:      "attestation required",
+	provenance: charmrepo.ProvenanceAttested,
+	extra:      "signature: good\nattestation: slsa\n",
+}, {
+	about:      "attestation required and missing",
+	provenance: charmrepo.ProvenanceAttested,
+	extra:      "signature: good\n",
+	err:        `charm "cs:trusty/mysql-3" has provenance signed, attested required`,
+}}
+
+func (s *charmStoreV5Suite) TestGetProvenance(c *gc.C) {
+	verifySignature := func(h *charmrepo.Hashes) error {
+		if h.Signature != "good" {
+			return errgo.New("bad signature")
+		}
+		return nil
+	}
+	for i, test := range provenanceTests {
+		c.Logf("test %d: %s", i, test.about)
+		url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+		if !test.noHashes {
+			s.setHashes(c, charmrepo.StableChannel, url, test.sha384, test.extra)
+		}
+		repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+			URL:             s.srv.URL,
+			APIVersion:      5,
+			CacheDir:        c.MkDir(),
+			Provenance:      test.provenance,
+			VerifySignature: verifySignature,
+		})
+		ch, err := repo.Get(url)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(errgo.Cause(err), gc.Equals, charmrepo.ErrInsufficientProvenance)
+			c.Assert(ch, gc.IsNil)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(ch.Meta().Name, gc.Equals, "mysql")
+	}
+}
+
+func (s *charmStoreV5Suite) TestGetProvenanceCachesHashes(c *gc.C) {
+	url := s.publish(c, charmrepo.StableChannel, "cs:trusty/mysql-3", "mysql")
+	s.setHashes(c, charmrepo.StableChannel, url, "", "")
+	dir := c.MkDir()
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		URL:        s.srv.URL,
+		APIVersion: 5,
+		CacheDir:   dir,
+		Provenance: charmrepo.ProvenanceDigest,
+	})
+	_, err := repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = os.Stat(filepath.Join(dir, charm.Quote(url.String())+"."+charmrepo.HashesFile))
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.store.requests = nil
+	_, err = repo.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.store.requests, gc.HasLen, 1)
+	c.Assert(s.store.requests[0].URL.Path, gc.Equals, "/v5/trusty/mysql-3/archive")
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// ArchiveDecoder returns a reader of the decoded contents of r,
+// which holds an archive sent with a content coding such as gzip.
+type ArchiveDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// gzipDecoder is the ArchiveDecoder for the gzip content coding.
+func gzipDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// archiveDecoders returns the decoders used to request compressed
+// archives, keyed by content coding, or nil if compressed transfer
+// is disabled.
+func (p NewCharmStoreParams) archiveDecoders() map[string]ArchiveDecoder {
+	if !p.CompressedTransfer {
+		return nil
+	}
+	decoders := map[string]ArchiveDecoder{
+		"gzip": gzipDecoder,
+	}
+	for coding, decoder := range p.ArchiveDecoders {
+		coding = strings.ToLower(coding)
+		if decoder == nil {
+			delete(decoders, coding)
+		} else {
+			decoders[coding] = decoder
+		}
+	}
+	return decoders
+}
+
+// acceptEncoding returns the value of the Accept-Encoding header field
+// announcing the given decoders. Codings other than gzip, such as
+// zstd, are assumed to compress better and are preferred.
+func acceptEncoding(decoders map[string]ArchiveDecoder) string {
+	codings := make([]string, 0, len(decoders))
+	for coding := range decoders {
+		if coding != "gzip" {
+			codings = append(codings, coding)
+		}
+	}
+	sort.Strings(codings)
+	if _, ok := decoders["gzip"]; ok {
+		codings = append(codings, "gzip;q=0.5")
+	}
+	return strings.Join(codings, ", ")
+}
+
+// decodedBody returns a reader of the decoded body of resp, using
+// the decoder for its content coding, and reports whether the body
+// was encoded, in which case its length is not that of the archive.
+func decodedBody(resp *http.Response, decoders map[string]ArchiveDecoder) (io.ReadCloser, bool, error) {
+	coding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if coding == "" || coding == "identity" {
+		return resp.Body, false, nil
+	}
+	decoder, ok := decoders[coding]
+	if !ok {
+		return nil, false, errgo.Newf("unsupported content encoding %q", coding)
+	}
+	r, err := decoder(resp.Body)
+	if err != nil {
+		return nil, false, errgo.Notef(err, "cannot decode %s archive", coding)
+	}
+	return r, true, nil
+}
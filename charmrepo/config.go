@@ -0,0 +1,57 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// Config holds the configuration of a charm store repository.
+// Programs embedding several repositories, such as servers, may give
+// each of them its own Config instead of relying on the package-level
+// CacheDir variable and the CharmStoreEnvVar environment variable,
+// which are only used as defaults for the fields left empty, and are
+// read once when the repository is created.
+type Config struct {
+	// CacheDir holds the directory where downloaded charms
+	// are cached. If empty, the value of the package-level
+	// CacheDir variable is used.
+	CacheDir string
+
+	// StoreURL holds the root endpoint URL of the store. If
+	// empty, the charm store is selected as described by
+	// NewCharmStoreParams.Endpoint, and the legacy charm
+	// store at LegacyStoreURL is used.
+	StoreURL string
+
+	// Series holds the series of the charms that may be
+	// resolved through the repository. If empty, charms of
+	// any series may be. Bundles are always allowed.
+	Series []string
+}
+
+// withDefaults returns c with its empty fields
+// set to the current package defaults.
+func (c Config) withDefaults() Config {
+	if c.CacheDir == "" {
+		c.CacheDir = CacheDir
+	}
+	return c
+}
+
+// checkSeries returns an error if the charm referenced by curl
+// does not have one of the given series. No series allows all.
+func checkSeries(series []string, curl *charm.URL) error {
+	if len(series) == 0 || curl.IsBundle() {
+		return nil
+	}
+	for _, s := range series {
+		if s == curl.Series {
+			return nil
+		}
+	}
+	return errgo.Newf("charm %q has unsupported series %q", curl, curl.Series)
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charmstore.v4/csclient"
+)
+
+// CharmStoreEnvVar holds the name of the environment variable that
+// overrides the endpoint profile of the charm stores created by
+// NewCharmStore. It may hold the name of a profile, such as "staging",
+// or the root endpoint URL of a charm store.
+const CharmStoreEnvVar = "JUJU_CHARM_STORE"
+
+// EndpointProfile names a charm store deployment.
+type EndpointProfile string
+
+const (
+	// ProductionProfile names the public charm store.
+	// It is the default.
+	ProductionProfile EndpointProfile = "production"
+
+	// StagingProfile names the staging charm store,
+	// used to try changes before they reach production.
+	StagingProfile EndpointProfile = "staging"
+
+	// CustomProfile names any charm store specified by URL,
+	// either in NewCharmStoreParams.URL or in the environment.
+	CustomProfile EndpointProfile = "custom"
+)
+
+// StagingServerURL holds the root endpoint URL of the
+// staging charm store.
+const StagingServerURL = "https://api.staging.jujucharms.com/charmstore"
+
+// endpointProfiles maps the names of the known profiles
+// to the root endpoint URLs of their charm stores.
+var endpointProfiles = map[EndpointProfile]string{
+	ProductionProfile: csclient.ServerURL,
+	StagingProfile:    StagingServerURL,
+}
+
+// EndpointProfiles returns the names of the profiles that can
+// be selected by name, in alphabetical order.
+func EndpointProfiles() []EndpointProfile {
+	profiles := make([]EndpointProfile, 0, len(endpointProfiles))
+	for p := range endpointProfiles {
+		profiles = append(profiles, p)
+	}
+	sort.Sort(endpointProfilesByName(profiles))
+	return profiles
+}
+
+// EndpointProfileURL returns the root endpoint URL
+// of the charm store with the given profile.
+func EndpointProfileURL(profile EndpointProfile) (string, error) {
+	u, ok := endpointProfiles[profile]
+	if !ok {
+		return "", errgo.Newf("unknown charm store endpoint profile %q", profile)
+	}
+	return u, nil
+}
+
+// Endpoint returns the root endpoint URL of the charm store selected
+// by the parameters, and the profile it belongs to. An explicit URL
+// takes precedence, so that callers such as tests are not affected by
+// the environment, followed by the StoreURL field of Config; otherwise
+// the value of the CharmStoreEnvVar environment variable is used if
+// set, then the Profile field, and finally ProductionProfile.
+func (p NewCharmStoreParams) Endpoint() (string, EndpointProfile, error) {
+	if p.URL != "" {
+		return strings.TrimSuffix(p.URL, "/"), CustomProfile, nil
+	}
+	if p.Config != nil && p.Config.StoreURL != "" {
+		return strings.TrimSuffix(p.Config.StoreURL, "/"), CustomProfile, nil
+	}
+	if env := strings.TrimSpace(os.Getenv(CharmStoreEnvVar)); env != "" {
+		u, profile, err := parseEndpoint(env)
+		if err != nil {
+			return "", "", errgo.Notef(err, "invalid $%s", CharmStoreEnvVar)
+		}
+		return u, profile, nil
+	}
+	profile := p.Profile
+	if profile == "" {
+		profile = ProductionProfile
+	}
+	if profile == CustomProfile {
+		return "", "", errgo.Newf("custom charm store endpoint profile requires a URL")
+	}
+	u, err := EndpointProfileURL(profile)
+	if err != nil {
+		return "", "", errgo.Mask(err)
+	}
+	return u, profile, nil
+}
+
+// parseEndpoint parses s, which holds either the
+// name of a profile or a charm store URL.
+func parseEndpoint(s string) (string, EndpointProfile, error) {
+	if !strings.Contains(s, "://") {
+		u, err := EndpointProfileURL(EndpointProfile(s))
+		if err != nil {
+			return "", "", errgo.Mask(err)
+		}
+		return u, EndpointProfile(s), nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", errgo.Mask(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", "", errgo.Newf("charm store URL %q is not an absolute HTTP URL", s)
+	}
+	return strings.TrimSuffix(s, "/"), CustomProfile, nil
+}
+
+type endpointProfilesByName []EndpointProfile
+
+func (profiles endpointProfilesByName) Len() int { return len(profiles) }
+func (profiles endpointProfilesByName) Swap(i, j int) {
+	profiles[i], profiles[j] = profiles[j], profiles[i]
+}
+func (profiles endpointProfilesByName) Less(i, j int) bool { return profiles[i] < profiles[j] }
@@ -0,0 +1,143 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	jujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charmstore.v4/csclient"
+
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type endpointsSuite struct {
+	jujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&endpointsSuite{})
+
+func (s *endpointsSuite) TestEndpointProfiles(c *gc.C) {
+	c.Assert(charmrepo.EndpointProfiles(), jc.DeepEquals, []charmrepo.EndpointProfile{
+		charmrepo.ProductionProfile,
+		charmrepo.StagingProfile,
+	})
+}
+
+var endpointTests = []struct {
+	about       string
+	params      charmrepo.NewCharmStoreParams
+	env         string
+	expectURL   string
+	expectError string
+	expect      charmrepo.EndpointProfile
+}{{
+	about:     "default",
+	expectURL: csclient.ServerURL,
+	expect:    charmrepo.ProductionProfile,
+}, {
+	about: "staging profile",
+	params: charmrepo.NewCharmStoreParams{
+		Profile: charmrepo.StagingProfile,
+	},
+	expectURL: charmrepo.StagingServerURL,
+	expect:    charmrepo.StagingProfile,
+}, {
+	about: "explicit URL",
+	params: charmrepo.NewCharmStoreParams{
+		URL: "https://1.2.3.4/charmstore/",
+	},
+	env:       "staging",
+	expectURL: "https://1.2.3.4/charmstore",
+	expect:    charmrepo.CustomProfile,
+}, {
+	about: "config store URL",
+	params: charmrepo.NewCharmStoreParams{
+		Config: &charmrepo.Config{
+			StoreURL: "https://5.6.7.8/charmstore/",
+		},
+	},
+	env:       "staging",
+	expectURL: "https://5.6.7.8/charmstore",
+	expect:    charmrepo.CustomProfile,
+}, {
+	about: "explicit URL overrides config",
+	params: charmrepo.NewCharmStoreParams{
+		URL: "https://1.2.3.4/charmstore",
+		Config: &charmrepo.Config{
+			StoreURL: "https://5.6.7.8/charmstore",
+		},
+	},
+	expectURL: "https://1.2.3.4/charmstore",
+	expect:    charmrepo.CustomProfile,
+}, {
+	about: "environment profile overrides params",
+	params: charmrepo.NewCharmStoreParams{
+		Profile: charmrepo.ProductionProfile,
+	},
+	env:       "staging",
+	expectURL: charmrepo.StagingServerURL,
+	expect:    charmrepo.StagingProfile,
+}, {
+	about:     "environment URL",
+	env:       "http://localhost:8080/",
+	expectURL: "http://localhost:8080",
+	expect:    charmrepo.CustomProfile,
+}, {
+	about:       "unknown environment profile",
+	env:         "nowhere",
+	expectError: `invalid \$JUJU_CHARM_STORE: unknown charm store endpoint profile "nowhere"`,
+}, {
+	about:       "invalid environment URL",
+	env:         "ftp://localhost/",
+	expectError: `invalid \$JUJU_CHARM_STORE: charm store URL "ftp://localhost/" is not an absolute HTTP URL`,
+}, {
+	about: "unknown profile",
+	params: charmrepo.NewCharmStoreParams{
+		Profile: "testing",
+	},
+	expectError: `unknown charm store endpoint profile "testing"`,
+}, {
+	about: "custom profile without URL",
+	params: charmrepo.NewCharmStoreParams{
+		Profile: charmrepo.CustomProfile,
+	},
+	expectError: `custom charm store endpoint profile requires a URL`,
+}}
+
+func (s *endpointsSuite) TestEndpoint(c *gc.C) {
+	for i, test := range endpointTests {
+		c.Logf("test %d: %s", i, test.about)
+		s.PatchEnvironment(charmrepo.CharmStoreEnvVar, test.env)
+		u, profile, err := test.params.Endpoint()
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(u, gc.Equals, test.expectURL)
+		c.Assert(profile, gc.Equals, test.expect)
+	}
+}
+
+func (s *endpointsSuite) TestNewCharmStoreProfile(c *gc.C) {
+	s.PatchEnvironment(charmrepo.CharmStoreEnvVar, "staging")
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{}).(*charmrepo.CharmStore)
+	c.Assert(repo.URL(), gc.Equals, charmrepo.StagingServerURL)
+	c.Assert(repo.Profile(), gc.Equals, charmrepo.StagingProfile)
+
+	repoV5 := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		APIVersion: 5,
+	}).(*charmrepo.CharmStoreV5)
+	c.Assert(repoV5.URL(), gc.Equals, charmrepo.StagingServerURL)
+	c.Assert(repoV5.Profile(), gc.Equals, charmrepo.StagingProfile)
+}
+
+func (s *endpointsSuite) TestNewCharmStoreInvalidProfile(c *gc.C) {
+	repo := charmrepo.NewCharmStore(charmrepo.NewCharmStoreParams{
+		Profile: "testing",
+	}).(*charmrepo.CharmStore)
+	c.Assert(repo.URL(), gc.Equals, csclient.ServerURL)
+	c.Assert(repo.Profile(), gc.Equals, charmrepo.ProductionProfile)
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// maxETagEntries holds the maximum number of
+	// responses held by an etagCache.
+	maxETagEntries = 1024
+
+	// maxETagSize holds the maximum total size in bytes
+	// of the response bodies held by an etagCache.
+	maxETagSize = 16 * 1024 * 1024
+)
+
+// etagCache holds the entity tags of charm store responses, along
+// with the data derived from them, so that repeated requests can be
+// made conditional with If-None-Match. When it holds more than
+// maxETagEntries entries or maxETagSize bytes, the least recently
+// used entries are evicted. It is safe for concurrent use.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List
+	size    int64
+}
+
+// etagEntry holds a cached response.
+type etagEntry struct {
+	key   string
+	etag  string
+	value interface{}
+	size  int64
+}
+
+// newETagCache returns a new empty etagCache.
+func newETagCache() *etagCache {
+	return &etagCache{
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry cached for the given key, if any.
+func (c *etagCache) get(key string) (etagEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return etagEntry{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return *elem.Value.(*etagEntry), true
+}
+
+// set caches the given value with its entity tag. The size holds
+// the number of bytes held by the value, which is not cached if it
+// exceeds maxETagSize.
+func (c *etagCache) set(key, etag string, value interface{}, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+	if size > maxETagSize {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&etagEntry{
+		key:   key,
+		etag:  etag,
+		value: value,
+		size:  size,
+	})
+	c.size += size
+	for len(c.entries) > maxETagEntries || c.size > maxETagSize {
+		c.removeLocked(c.lru.Back().Value.(*etagEntry).key)
+	}
+}
+
+// remove removes the entry cached for the given key.
+func (c *etagCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+}
+
+func (c *etagCache) removeLocked(key string) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.lru.Remove(elem)
+	delete(c.entries, key)
+	c.size -= elem.Value.(*etagEntry).size
+}
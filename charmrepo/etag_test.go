@@ -0,0 +1,47 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"fmt"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type etagCacheSuite struct{}
+
+var _ = gc.Suite(&etagCacheSuite{})
+
+func (s *etagCacheSuite) TestEntriesBounded(c *gc.C) {
+	cache := charmrepo.NewETagCache()
+	for i := 0; i < charmrepo.MaxETagEntries; i++ {
+		charmrepo.SetETag(cache, fmt.Sprint(i), 1)
+	}
+	// Using an entry keeps it from being evicted.
+	c.Assert(charmrepo.HasETag(cache, "0"), jc.IsTrue)
+	charmrepo.SetETag(cache, "new", 1)
+	c.Assert(charmrepo.HasETag(cache, "0"), jc.IsTrue)
+	c.Assert(charmrepo.HasETag(cache, "1"), jc.IsFalse)
+	c.Assert(charmrepo.HasETag(cache, "2"), jc.IsTrue)
+	c.Assert(charmrepo.HasETag(cache, "new"), jc.IsTrue)
+}
+
+func (s *etagCacheSuite) TestSizeBounded(c *gc.C) {
+	cache := charmrepo.NewETagCache()
+	half := int64(charmrepo.MaxETagSize / 2)
+	charmrepo.SetETag(cache, "a", half)
+	charmrepo.SetETag(cache, "b", half)
+	c.Assert(charmrepo.HasETag(cache, "a"), jc.IsTrue)
+	charmrepo.SetETag(cache, "c", 1)
+	c.Assert(charmrepo.HasETag(cache, "a"), jc.IsTrue)
+	c.Assert(charmrepo.HasETag(cache, "b"), jc.IsFalse)
+	c.Assert(charmrepo.HasETag(cache, "c"), jc.IsTrue)
+
+	// Values larger than the cache are not kept.
+	charmrepo.SetETag(cache, "d", charmrepo.MaxETagSize+1)
+	c.Assert(charmrepo.HasETag(cache, "d"), jc.IsFalse)
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// blobsDir holds the name of the directory, within an ExpandedCache
+// directory, that holds the content-addressed copies of expanded files.
+const blobsDir = ".blobs"
+
+// ExpandedCache holds expanded charm archives in a directory, one
+// subdirectory per charm URL. Regular files with identical contents
+// and modes are hard-linked together, both within and across
+// revisions, so that keeping many revisions of a large charm costs
+// little more disk space than keeping one.
+//
+// Because files are shared, the expanded charm directories must be
+// treated as read-only.
+type ExpandedCache struct {
+	dir string
+}
+
+// NewExpandedCache returns an ExpandedCache that stores
+// expanded charms in the given directory.
+func NewExpandedCache(dir string) *ExpandedCache {
+	return &ExpandedCache{
+		dir: dir,
+	}
+}
+
+// Path returns the path of the directory that holds, or
+// would hold, the expanded charm with the given URL.
+func (c *ExpandedCache) Path(curl *charm.URL) string {
+	return filepath.Join(c.dir, charm.QuoteV2(curl.String()))
+}
+
+// Expand expands the given archive, which must hold the charm with
+// the given URL, into the cache and returns the path of the expanded
+// charm. If the charm has already been expanded, its existing path is
+// returned.
+func (c *ExpandedCache) Expand(curl *charm.URL, archive *charm.CharmArchive) (string, error) {
+	path := c.Path(curl)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	blobs := filepath.Join(c.dir, blobsDir)
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		return "", errgo.Notef(err, "cannot create the cache directory")
+	}
+	tmpDir, err := ioutil.TempDir(c.dir, "charm-expand")
+	if err != nil {
+		return "", errgo.Notef(err, "cannot make temporary directory")
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := archive.ExpandTo(tmpDir); err != nil {
+		return "", errgo.Notef(err, "cannot expand %q", curl)
+	}
+	if err := linkBlobs(tmpDir, blobs); err != nil {
+		return "", errgo.Notef(err, "cannot share files of %q", curl)
+	}
+	if err := os.Rename(tmpDir, path); err != nil {
+		if _, serr := os.Stat(path); serr == nil {
+			// The charm was expanded concurrently.
+			return path, nil
+		}
+		return "", errgo.Notef(err, "cannot move expanded charm")
+	}
+	return path, nil
+}
+
+// Remove removes the expanded charm with the given URL from the cache.
+// The files it shares with other revisions are kept until Prune is
+// called.
+func (c *ExpandedCache) Remove(curl *charm.URL) error {
+	if err := os.RemoveAll(c.Path(curl)); err != nil {
+		return errgo.Notef(err, "cannot remove expanded charm")
+	}
+	return nil
+}
+
+// Prune removes the shared copies of files that are no longer used by
+// any charm in the cache, and returns the number of bytes freed.
+func (c *ExpandedCache) Prune() (int64, error) {
+	blobs := filepath.Join(c.dir, blobsDir)
+	infos, err := ioutil.ReadDir(blobs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errgo.Notef(err, "cannot read shared files")
+	}
+	// Index the blobs by size so that each expanded file
+	// need only be compared with a few of them.
+	unused := make(map[int64][]os.FileInfo)
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			unused[info.Size()] = append(unused[info.Size()], info)
+		}
+	}
+	err = filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == blobs {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		candidates := unused[info.Size()]
+		for i, blob := range candidates {
+			if os.SameFile(info, blob) {
+				unused[info.Size()] = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errgo.Notef(err, "cannot walk cache directory")
+	}
+	var freed int64
+	for _, infos := range unused {
+		for _, info := range infos {
+			if err := os.Remove(filepath.Join(blobs, info.Name())); err != nil {
+				return freed, errgo.Notef(err, "cannot remove shared file")
+			}
+			freed += info.Size()
+		}
+	}
+	return freed, nil
+}
+
+// linkBlobs replaces each regular file under dir with a hard link
+// to the file in blobs holding the same contents and mode, adding
+// the file to blobs first if there is none. Files that cannot be
+// linked, for instance because blobs is on another device, are left
+// as they are.
+func linkBlobs(dir, blobs string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		name, err := blobName(path, info.Mode())
+		if err != nil {
+			return err
+		}
+		blob := filepath.Join(blobs, name)
+		if err := os.Link(path, blob); err == nil || !os.IsExist(err) {
+			// Either the file is now shared or it cannot be.
+			return nil
+		}
+		tmp := path + ".link"
+		if err := os.Link(blob, tmp); err != nil {
+			return nil
+		}
+		return os.Rename(tmp, path)
+	})
+}
+
+// blobName returns the name under which the file at path,
+// which has the given mode, is shared.
+func blobName(path string, mode os.FileMode) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%o", hash.Sum(nil), mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)), nil
+}
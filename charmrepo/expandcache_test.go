@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type expandedCacheSuite struct{}
+
+var _ = gc.Suite(&expandedCacheSuite{})
+
+func (s *expandedCacheSuite) archive(c *gc.C, revision int) *charm.CharmArchive {
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	archive.SetRevision(revision)
+	return archive
+}
+
+func (s *expandedCacheSuite) TestExpandSharesFiles(c *gc.C) {
+	cache := charmrepo.NewExpandedCache(c.MkDir())
+	curl1 := charm.MustParseURL("cs:quantal/dummy-1")
+	curl2 := charm.MustParseURL("cs:quantal/dummy-2")
+
+	path1, err := cache.Expand(curl1, s.archive(c, 1))
+	c.Assert(err, gc.IsNil)
+	c.Assert(path1, gc.Equals, cache.Path(curl1))
+	path2, err := cache.Expand(curl2, s.archive(c, 2))
+	c.Assert(err, gc.IsNil)
+	c.Assert(path2, gc.Equals, cache.Path(curl2))
+
+	dir1, err := charm.ReadCharmDir(path1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir1.Revision(), gc.Equals, 1)
+	dir2, err := charm.ReadCharmDir(path2)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir2.Revision(), gc.Equals, 2)
+
+	// Identical files are shared; the revision files differ.
+	for _, name := range []string{"metadata.yaml", "hooks/install", "src/hello.c"} {
+		c.Assert(sameFile(c, path1, path2, name), jc.IsTrue, gc.Commentf("file %q", name))
+	}
+	c.Assert(sameFile(c, path1, path2, "revision"), jc.IsFalse)
+
+	// Shared files keep their modes.
+	info, err := os.Stat(filepath.Join(path2, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0100, gc.Not(gc.Equals), os.FileMode(0))
+
+	// Expanding again returns the existing directory.
+	path, err := cache.Expand(curl1, s.archive(c, 1))
+	c.Assert(err, gc.IsNil)
+	c.Assert(path, gc.Equals, path1)
+}
+
+func (s *expandedCacheSuite) TestRemoveAndPrune(c *gc.C) {
+	dir := c.MkDir()
+	cache := charmrepo.NewExpandedCache(dir)
+	curl1 := charm.MustParseURL("cs:quantal/dummy-1")
+	curl2 := charm.MustParseURL("cs:quantal/dummy-2")
+	path1, err := cache.Expand(curl1, s.archive(c, 1))
+	c.Assert(err, gc.IsNil)
+	_, err = cache.Expand(curl2, s.archive(c, 2))
+	c.Assert(err, gc.IsNil)
+
+	// Nothing is pruned while all files are in use.
+	freed, err := cache.Prune()
+	c.Assert(err, gc.IsNil)
+	c.Assert(freed, gc.Equals, int64(0))
+
+	// Only the revision file of the removed charm is unused.
+	err = cache.Remove(curl1)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(path1)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+	freed, err = cache.Prune()
+	c.Assert(err, gc.IsNil)
+	c.Assert(freed, gc.Equals, int64(len("1")))
+
+	// Once all charms are removed, nothing is left.
+	err = cache.Remove(curl2)
+	c.Assert(err, gc.IsNil)
+	_, err = cache.Prune()
+	c.Assert(err, gc.IsNil)
+	infos, err := ioutil.ReadDir(filepath.Join(dir, ".blobs"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 0)
+}
+
+func (s *expandedCacheSuite) TestPruneEmptyCache(c *gc.C) {
+	cache := charmrepo.NewExpandedCache(filepath.Join(c.MkDir(), "missing"))
+	freed, err := cache.Prune()
+	c.Assert(err, gc.IsNil)
+	c.Assert(freed, gc.Equals, int64(0))
+}
+
+func sameFile(c *gc.C, dir1, dir2, name string) bool {
+	info1, err := os.Stat(filepath.Join(dir1, filepath.FromSlash(name)))
+	c.Assert(err, gc.IsNil)
+	info2, err := os.Stat(filepath.Join(dir2, filepath.FromSlash(name)))
+	c.Assert(err, gc.IsNil)
+	return os.SameFile(info1, info2)
+}
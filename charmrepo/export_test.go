@@ -0,0 +1,25 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+// Export meaningful bits for tests only.
+
+var TimeNow = &timeNow
+
+var (
+	NewETagCache   = newETagCache
+	MaxETagEntries = maxETagEntries
+	MaxETagSize    = maxETagSize
+)
+
+// SetETag caches a value of the given size under key in c.
+func SetETag(c *etagCache, key string, size int64) {
+	c.set(key, `"`+key+`"`, key, size)
+}
+
+// HasETag reports whether c holds an entry for key.
+func HasETag(c *etagCache, key string) bool {
+	_, ok := c.get(key)
+	return ok
+}
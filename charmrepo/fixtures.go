@@ -0,0 +1,217 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/utils"
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// fixture holds the outcome of a repository call, as
+// recorded by a recording repository. Archives are
+// recorded in separate files.
+type fixture struct {
+	URL      string `json:"url,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+	Sha256   string `json:"sha256,omitempty"`
+	Error    string `json:"error,omitempty"`
+	NotFound bool   `json:"not-found,omitempty"`
+}
+
+// err returns the error recorded in f, if any.
+func (f *fixture) err() error {
+	switch {
+	case f.NotFound:
+		return &NotFoundError{f.Error}
+	case f.Error != "":
+		return errgo.New(f.Error)
+	}
+	return nil
+}
+
+// setErr records err in f.
+func (f *fixture) setErr(err error) {
+	if err == nil {
+		return
+	}
+	f.Error = err.Error()
+	_, f.NotFound = errgo.Cause(err).(*NotFoundError)
+}
+
+// fixtureDir holds fixtures recorded by a recording repository.
+// The outcome of each call is held in a file named after the
+// operation and its argument quoted with charm.QuoteV2, such as
+// get-cs_3a_trusty_2f_mysql-3.json, and archives are held alongside,
+// as in get-cs_3a_trusty_2f_mysql-3.charm.
+type fixtureDir string
+
+func (dir fixtureDir) path(op, key, ext string) string {
+	return filepath.Join(string(dir), op+"-"+charm.QuoteV2(key)+ext)
+}
+
+func (dir fixtureDir) read(op, key string) (*fixture, error) {
+	data, err := ioutil.ReadFile(dir.path(op, key, ".json"))
+	if os.IsNotExist(err) {
+		return nil, errgo.Newf("no fixture for %s %q", op, key)
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, errgo.Notef(err, "cannot decode fixture for %s %q", op, key)
+	}
+	return &f, nil
+}
+
+func (dir fixtureDir) write(op, key string, f *fixture) error {
+	data, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return utils.AtomicWriteFile(dir.path(op, key, ".json"), append(data, '\n'), 0644)
+}
+
+// recordingRepo is a repository recording
+// the outcome of its calls as fixtures.
+type recordingRepo struct {
+	repo Interface
+	dir  fixtureDir
+}
+
+// NewRecordingRepo returns a repository retrieving charms from repo,
+// which records the outcome of all its calls in the given fixture
+// directory, so that they can be served back by a repository returned
+// by NewReplayingRepo, as in tests that must run offline. The
+// repository returns an error if the fixtures cannot be written. It
+// is safe for concurrent use if repo is.
+func NewRecordingRepo(repo Interface, dir string) (Interface, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errgo.Notef(err, "cannot create fixture directory")
+	}
+	return &recordingRepo{
+		repo: repo,
+		dir:  fixtureDir(dir),
+	}, nil
+}
+
+// Get implements Interface.Get.
+func (r *recordingRepo) Get(curl *charm.URL) (charm.Charm, error) {
+	key := curl.String()
+	ch, err := r.repo.Get(curl)
+	if err == nil {
+		if err := writeCharmArchiveFile(r.dir.path("get", key, ".charm"), ch); err != nil {
+			return nil, errgo.Notef(err, "cannot record archive of %q", curl)
+		}
+	}
+	var f fixture
+	f.setErr(err)
+	if err := r.dir.write("get", key, &f); err != nil {
+		return nil, errgo.Notef(err, "cannot record fixture")
+	}
+	return ch, err
+}
+
+// Latest implements Interface.Latest. The revision of each charm
+// is recorded separately, regardless of the revision set on the URL.
+func (r *recordingRepo) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
+	revs, err := r.repo.Latest(curls...)
+	if err != nil {
+		return nil, err
+	}
+	for i, rev := range revs {
+		if i >= len(curls) {
+			break
+		}
+		f := fixture{
+			Revision: rev.Revision,
+			Sha256:   rev.Sha256,
+		}
+		f.setErr(rev.Err)
+		if err := r.dir.write("latest", curls[i].WithRevision(-1).String(), &f); err != nil {
+			return nil, errgo.Notef(err, "cannot record fixture")
+		}
+	}
+	return revs, nil
+}
+
+// Resolve implements Interface.Resolve.
+func (r *recordingRepo) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	curl, err := r.repo.Resolve(ref)
+	var f fixture
+	if err == nil {
+		f.URL = curl.String()
+	}
+	f.setErr(err)
+	if err := r.dir.write("resolve", ref.String(), &f); err != nil {
+		return nil, errgo.Notef(err, "cannot record fixture")
+	}
+	return curl, err
+}
+
+// replayingRepo is a repository serving
+// fixtures recorded by a recordingRepo.
+type replayingRepo struct {
+	dir fixtureDir
+}
+
+// NewReplayingRepo returns a repository serving back the fixtures
+// recorded in the given directory by a repository returned by
+// NewRecordingRepo. Calls for which no fixture was recorded return an
+// error. Errors recorded as *NotFoundError errors are returned as
+// such; other errors are returned with their message only.
+func NewReplayingRepo(dir string) Interface {
+	return &replayingRepo{
+		dir: fixtureDir(dir),
+	}
+}
+
+// Get implements Interface.Get.
+func (r *replayingRepo) Get(curl *charm.URL) (charm.Charm, error) {
+	key := curl.String()
+	f, err := r.dir.read("get", key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+	return charm.ReadCharmArchive(r.dir.path("get", key, ".charm"))
+}
+
+// Latest implements Interface.Latest.
+func (r *replayingRepo) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
+	revs := make([]CharmRevision, len(curls))
+	for i, curl := range curls {
+		f, err := r.dir.read("latest", curl.WithRevision(-1).String())
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		revs[i] = CharmRevision{
+			Revision: f.Revision,
+			Sha256:   f.Sha256,
+			Err:      f.err(),
+		}
+	}
+	return revs, nil
+}
+
+// Resolve implements Interface.Resolve.
+func (r *replayingRepo) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	f, err := r.dir.read("resolve", ref.String())
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+	return charm.ParseURL(f.URL)
+}
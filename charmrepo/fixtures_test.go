@@ -0,0 +1,69 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type fixturesSuite struct {
+	repo charmrepo.Interface
+}
+
+var _ = gc.Suite(&fixturesSuite{})
+
+func (s *fixturesSuite) SetUpTest(c *gc.C) {
+	root := c.MkDir()
+	seriesPath := filepath.Join(root, "quantal")
+	c.Assert(os.Mkdir(seriesPath, 0777), gc.IsNil)
+	TestCharms.ClonedDirPath(seriesPath, "wordpress")
+	s.repo = &charmrepo.LocalRepository{Path: root}
+}
+
+func (s *fixturesSuite) TestRecordAndReplay(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "fixtures")
+	recorder, err := charmrepo.NewRecordingRepo(s.repo, dir)
+	c.Assert(err, gc.IsNil)
+	replayer := charmrepo.NewReplayingRepo(dir)
+
+	for i, repo := range []charmrepo.Interface{recorder, replayer} {
+		c.Logf("repo %d", i)
+		url, err := repo.Resolve(charm.MustParseReference("local:quantal/wordpress"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(url, jc.DeepEquals, charm.MustParseURL("local:quantal/wordpress-3"))
+
+		revs, err := repo.Latest(
+			charm.MustParseURL("local:quantal/wordpress-1"),
+			charm.MustParseURL("local:quantal/mysql"),
+		)
+		c.Assert(err, gc.IsNil)
+		c.Assert(revs, gc.HasLen, 2)
+		c.Assert(revs[0].Revision, gc.Equals, 3)
+		c.Assert(revs[1].Err, gc.FitsTypeOf, &charmrepo.NotFoundError{})
+		c.Assert(revs[1].Err, gc.ErrorMatches, `charm not found in ".*": local:quantal/mysql`)
+
+		ch, err := repo.Get(charm.MustParseURL("local:quantal/wordpress"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(ch.Meta().Name, gc.Equals, "wordpress")
+		c.Assert(ch.Revision(), gc.Equals, 3)
+
+		_, err = repo.Get(charm.MustParseURL("local:quantal/mysql"))
+		c.Assert(err, gc.FitsTypeOf, &charmrepo.NotFoundError{})
+	}
+}
+
+func (s *fixturesSuite) TestReplayMissingFixture(c *gc.C) {
+	repo := charmrepo.NewReplayingRepo(c.MkDir())
+	_, err := repo.Get(charm.MustParseURL("cs:quantal/wordpress"))
+	c.Assert(err, gc.ErrorMatches, `no fixture for get "cs:quantal/wordpress"`)
+	_, err = repo.Resolve(charm.MustParseReference("cs:wordpress"))
+	c.Assert(err, gc.ErrorMatches, `no fixture for resolve "cs:wordpress"`)
+}
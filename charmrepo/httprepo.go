@@ -0,0 +1,369 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/juju/utils"
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// HTTPIndexFile holds the name of the index
+// file at the root of an HTTPRepo.
+const HTTPIndexFile = "index.json"
+
+// HTTPIndex holds the index of the charms served by an HTTPRepo,
+// as stored in its HTTPIndexFile.
+type HTTPIndex struct {
+	Charms []HTTPIndexEntry `json:"charms"`
+}
+
+// HTTPIndexEntry describes a charm archive served by an HTTPRepo.
+type HTTPIndexEntry struct {
+	// User, Series, Name and Revision identify the charm.
+	// User is empty for charms with no owner, such as
+	// those indexed by MakeHTTPIndex.
+	User     string `json:"user,omitempty"`
+	Series   string `json:"series"`
+	Name     string `json:"name"`
+	Revision int    `json:"revision"`
+
+	// Path holds the slash-separated path of the archive,
+	// relative to the root of the repository.
+	Path string `json:"path"`
+
+	// SHA256 holds the hex-encoded SHA256 hash of the archive.
+	SHA256 string `json:"sha256"`
+
+	// Size holds the size of the archive in bytes.
+	Size int64 `json:"size"`
+}
+
+// MakeHTTPIndex returns the index of the charm archives found in dir,
+// which must be laid out as a LocalRepository: in subdirectories
+// named after the series the charms are for. The entries of the
+// index are sorted by series, name and revision.
+func MakeHTTPIndex(dir string) (*HTTPIndex, error) {
+	var index HTTPIndex
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		series := info.Name()
+		paths, err := filepath.Glob(filepath.Join(dir, series, "*.charm"))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		for _, p := range paths {
+			entry, err := makeHTTPIndexEntry(dir, p)
+			if err != nil {
+				return nil, errgo.Notef(err, "cannot index %q", p)
+			}
+			entry.Series = series
+			index.Charms = append(index.Charms, entry)
+		}
+	}
+	sort.Sort(httpIndexEntries(index.Charms))
+	return &index, nil
+}
+
+// WriteHTTPIndex writes the index of the charm archives
+// found in dir, as returned by MakeHTTPIndex, to the
+// HTTPIndexFile in dir.
+func WriteHTTPIndex(dir string) error {
+	index, err := MakeHTTPIndex(dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	data, err := json.MarshalIndent(index, "", "\t")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return utils.AtomicWriteFile(filepath.Join(dir, HTTPIndexFile), append(data, '\n'), 0644)
+}
+
+// makeHTTPIndexEntry returns the index entry of the
+// charm archive at p in the repository held in dir.
+func makeHTTPIndexEntry(dir, p string) (HTTPIndexEntry, error) {
+	ch, err := charm.ReadCharmArchive(p)
+	if err != nil {
+		return HTTPIndexEntry{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return HTTPIndexEntry{}, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return HTTPIndexEntry{}, err
+	}
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return HTTPIndexEntry{}, err
+	}
+	return HTTPIndexEntry{
+		Name:     ch.Meta().Name,
+		Revision: ch.Revision(),
+		Path:     filepath.ToSlash(rel),
+		SHA256:   fmt.Sprintf("%x", hash.Sum(nil)),
+		Size:     size,
+	}, nil
+}
+
+type httpIndexEntries []HTTPIndexEntry
+
+func (es httpIndexEntries) Len() int      { return len(es) }
+func (es httpIndexEntries) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+func (es httpIndexEntries) Less(i, j int) bool {
+	if es[i].User != es[j].User {
+		return es[i].User < es[j].User
+	}
+	if es[i].Series != es[j].Series {
+		return es[i].Series < es[j].Series
+	}
+	if es[i].Name != es[j].Name {
+		return es[i].Name < es[j].Name
+	}
+	return es[i].Revision < es[j].Revision
+}
+
+// HTTPRepo is a repository Interface that retrieves charms from a
+// static HTTP mirror: a directory served by a plain HTTP server,
+// holding charm archives along with an HTTPIndexFile describing them,
+// as written by WriteHTTPIndex. The index is retrieved afresh for
+// each call, and archives are verified against the digests it holds
+// before being cached.
+type HTTPRepo struct {
+	url          string
+	doer         Doer
+	cacheDir     string
+	env          cacheEnv
+	maxIndexSize int64
+}
+
+var _ Interface = (*HTTPRepo)(nil)
+
+// HTTPRepoParams holds parameters for instantiating a new HTTPRepo.
+type HTTPRepoParams struct {
+	// URL holds the URL of the directory served, with
+	// no trailing slash, such as https://example.com/charms.
+	URL string
+
+	// Doer holds the Doer used to send all the requests to the
+	// server. If nil, http.DefaultClient is used.
+	Doer Doer
+
+	// CacheDir holds the directory where downloaded charms
+	// are cached. If empty, the value of the package-level
+	// CacheDir variable at the time of each call is used.
+	CacheDir string
+
+	// FileSystem holds the file system the cache directory is
+	// accessed through. If nil, OSFileSystem is used.
+	FileSystem FileSystem
+
+	// CacheKey, if not nil, holds the key used to encrypt the
+	// archives stored in the cache directory, as described
+	// for NewCharmStoreParams.CacheKey.
+	CacheKey []byte
+
+	// MaxIndexSize holds the maximum size in bytes of the
+	// index retrieved from the server. If zero,
+	// DefaultMaxResponseSize is used.
+	MaxIndexSize int64
+}
+
+// NewHTTPRepo returns a repository retrieving charms
+// from the static HTTP mirror specified by p.
+func NewHTTPRepo(p HTTPRepoParams) (*HTTPRepo, error) {
+	if p.URL == "" {
+		return nil, errgo.New("mirror URL not specified")
+	}
+	doer := p.Doer
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+	env, err := newCacheEnv(nil, p.FileSystem).withCacheKey(p.CacheKey)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	maxIndexSize := p.MaxIndexSize
+	if maxIndexSize <= 0 {
+		maxIndexSize = DefaultMaxResponseSize
+	}
+	return &HTTPRepo{
+		url:          strings.TrimSuffix(p.URL, "/"),
+		doer:         doer,
+		cacheDir:     p.CacheDir,
+		env:          env,
+		maxIndexSize: maxIndexSize,
+	}, nil
+}
+
+// Resolve implements Interface.Resolve. The reference
+// must specify a series.
+func (r *HTTPRepo) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	if ref.Series == "" {
+		return nil, errgo.Newf("no series specified for %s", ref)
+	}
+	u, err := ref.URL("")
+	if err != nil {
+		return nil, err
+	}
+	if u.Revision != -1 {
+		return u, nil
+	}
+	index, err := r.index()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	entry, err := index.find(u)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return u.WithRevision(entry.Revision), nil
+}
+
+// Latest implements Interface.Latest.
+func (r *HTTPRepo) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
+	if len(curls) == 0 {
+		return nil, nil
+	}
+	index, err := r.index()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	result := make([]CharmRevision, len(curls))
+	for i, curl := range curls {
+		entry, err := index.find(curl.WithRevision(-1))
+		if err != nil {
+			result[i].Err = err
+			continue
+		}
+		result[i].Revision = entry.Revision
+		result[i].Sha256 = entry.SHA256
+	}
+	return result, nil
+}
+
+// Get implements Interface.Get.
+func (r *HTTPRepo) Get(curl *charm.URL) (charm.Charm, error) {
+	if curl.IsBundle() {
+		return nil, errgo.Newf("expected a charm URL, got bundle URL %q", curl)
+	}
+	index, err := r.index()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	entry, err := index.find(curl)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	dir := cacheDir(r.cacheDir)
+	if dir == "" {
+		panic("charm cache directory path is empty")
+	}
+	if err := r.env.fs.MkdirAll(dir, 0755); err != nil {
+		return nil, errgo.Notef(err, "cannot create the cache directory")
+	}
+	id := curl.WithRevision(entry.Revision)
+	p := filepath.Join(dir, "http-"+charm.QuoteV2(id.String())+".charm")
+	if r.env.verifySHA256AndSize(p, entry.SHA256, entry.Size) != nil {
+		resp, err := r.get(entry.Path)
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot retrieve %q", id)
+		}
+		defer resp.Body.Close()
+		if err := r.env.storeSHA256(p, resp.Body, entry.SHA256, entry.Size); err != nil {
+			return nil, errgo.Notef(err, "cannot retrieve %q", id)
+		}
+	}
+	return r.env.readCharmArchive(p)
+}
+
+// index retrieves the index of the repository.
+func (r *HTTPRepo) index() (*httpIndex, error) {
+	resp, err := r.get(HTTPIndexFile)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve repository index")
+	}
+	defer resp.Body.Close()
+	var index HTTPIndex
+	lr := &io.LimitedReader{R: resp.Body, N: r.maxIndexSize + 1}
+	err = json.NewDecoder(lr).Decode(&index)
+	if lr.N <= 0 {
+		err = &ResponseTooLargeError{Limit: r.maxIndexSize}
+	}
+	if err != nil {
+		return nil, errgo.NoteMask(err, "cannot decode repository index", errgo.Any)
+	}
+	return &httpIndex{index}, nil
+}
+
+// get retrieves the file at the given slash-separated path relative
+// to the root of the repository. It returns an error if the response
+// status is not 200 OK.
+func (r *HTTPRepo) get(p string) (*http.Response, error) {
+	u := r.url + "/" + strings.TrimPrefix(path.Clean("/"+p), "/")
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errgo.Newf("cannot get %q: %s", u, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// httpIndex wraps HTTPIndex to look up charms.
+type httpIndex struct {
+	HTTPIndex
+}
+
+// find returns the entry of the charm referenced by curl, or that of
+// its latest revision if curl has no revision. The schema of curl is
+// ignored; its user must match that of the entry.
+func (index *httpIndex) find(curl *charm.URL) (HTTPIndexEntry, error) {
+	var found *HTTPIndexEntry
+	for i := range index.Charms {
+		e := &index.Charms[i]
+		if e.User != curl.User || e.Series != curl.Series || e.Name != curl.Name {
+			continue
+		}
+		if e.Revision == curl.Revision {
+			return *e, nil
+		}
+		if curl.Revision == -1 && (found == nil || e.Revision > found.Revision) {
+			found = e
+		}
+	}
+	if found == nil {
+		return HTTPIndexEntry{}, CharmNotFound(curl.String())
+	}
+	return *found, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type httpRepoSuite struct {
+	dir    string
+	server *httptest.Server
+	repo   *charmrepo.HTTPRepo
+}
+
+var _ = gc.Suite(&httpRepoSuite{})
+
+func (s *httpRepoSuite) SetUpTest(c *gc.C) {
+	s.dir = c.MkDir()
+	seriesDir := filepath.Join(s.dir, "quantal")
+	c.Assert(os.Mkdir(seriesDir, 0755), gc.IsNil)
+	for _, name := range []string{"dummy", "mysql"} {
+		path := TestCharms.CharmArchivePath(c.MkDir(), name)
+		err := os.Rename(path, filepath.Join(seriesDir, name+".charm"))
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(charmrepo.WriteHTTPIndex(s.dir), gc.IsNil)
+	s.server = httptest.NewServer(http.FileServer(http.Dir(s.dir)))
+	var err error
+	s.repo, err = charmrepo.NewHTTPRepo(charmrepo.HTTPRepoParams{
+		URL:      s.server.URL + "/",
+		CacheDir: c.MkDir(),
+	})
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *httpRepoSuite) TearDownTest(c *gc.C) {
+	s.server.Close()
+}
+
+func (s *httpRepoSuite) TestMakeHTTPIndex(c *gc.C) {
+	index, err := charmrepo.MakeHTTPIndex(s.dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(index.Charms, gc.HasLen, 2)
+	entry := index.Charms[0]
+	c.Assert(entry.Series, gc.Equals, "quantal")
+	c.Assert(entry.Name, gc.Equals, "dummy")
+	c.Assert(entry.Revision, gc.Equals, 1)
+	c.Assert(entry.Path, gc.Equals, "quantal/dummy.charm")
+	c.Assert(entry.SHA256, gc.HasLen, 64)
+	info, err := os.Stat(filepath.Join(s.dir, "quantal", "dummy.charm"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(entry.Size, gc.Equals, info.Size())
+	c.Assert(index.Charms[1].Name, gc.Equals, "mysql")
+}
+
+func (s *httpRepoSuite) TestResolveAndLatest(c *gc.C) {
+	url, err := s.repo.Resolve(charm.MustParseReference("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("cs:quantal/dummy-1"))
+
+	revs, err := s.repo.Latest(charm.MustParseURL("cs:quantal/dummy-5"), charm.MustParseURL("cs:trusty/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(revs[0].Revision, gc.Equals, 1)
+	c.Assert(revs[1].Err, gc.ErrorMatches, `charm not found: cs:trusty/dummy`)
+}
+
+func (s *httpRepoSuite) TestGet(c *gc.C) {
+	ch, err := s.repo.Get(charm.MustParseURL("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+	c.Assert(ch.Revision(), gc.Equals, 1)
+
+	_, err = s.repo.Get(charm.MustParseURL("cs:quantal/dummy-2"))
+	c.Assert(err, gc.ErrorMatches, `charm not found: cs:quantal/dummy-2`)
+}
+
+func (s *httpRepoSuite) TestGetCorrupted(c *gc.C) {
+	path := filepath.Join(s.dir, "quantal", "mysql.charm")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	data[len(data)/2] ^= 0xff
+	c.Assert(ioutil.WriteFile(path, data, 0644), gc.IsNil)
+	_, err = s.repo.Get(charm.MustParseURL("cs:quantal/mysql"))
+	c.Assert(err, gc.ErrorMatches, `cannot retrieve "cs:quantal/mysql-1": hash mismatch; network corruption\?`)
+}
+
+func (s *httpRepoSuite) TestMissingIndex(c *gc.C) {
+	c.Assert(os.Remove(filepath.Join(s.dir, charmrepo.HTTPIndexFile)), gc.IsNil)
+	_, err := s.repo.Get(charm.MustParseURL("cs:quantal/dummy"))
+	c.Assert(err, gc.ErrorMatches, `cannot retrieve repository index: cannot get ".*/index.json": Not Found`)
+}
+
+func (s *httpRepoSuite) TestGetUserCharm(c *gc.C) {
+	index, err := charmrepo.MakeHTTPIndex(s.dir)
+	c.Assert(err, gc.IsNil)
+	// Publish mysql as dummy for alice, so that
+	// the charms can be told apart.
+	entry := index.Charms[1]
+	entry.User = "alice"
+	entry.Name = "dummy"
+	entry.Revision = 7
+	index.Charms = append(index.Charms, entry)
+	s.writeIndex(c, index)
+
+	url, err := s.repo.Resolve(charm.MustParseReference("cs:~alice/quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("cs:~alice/quantal/dummy-7"))
+	ch, err := s.repo.Get(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "mysql")
+
+	// The charm with no owner is unaffected.
+	url, err = s.repo.Resolve(charm.MustParseReference("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("cs:quantal/dummy-1"))
+	ch, err = s.repo.Get(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+
+	_, err = s.repo.Get(charm.MustParseURL("cs:~bob/quantal/dummy"))
+	c.Assert(err, gc.ErrorMatches, `charm not found: cs:~bob/quantal/dummy`)
+}
+
+func (s *httpRepoSuite) TestIndexTooLarge(c *gc.C) {
+	repo, err := charmrepo.NewHTTPRepo(charmrepo.HTTPRepoParams{
+		URL:          s.server.URL,
+		CacheDir:     c.MkDir(),
+		MaxIndexSize: 100,
+	})
+	c.Assert(err, gc.IsNil)
+	_, err = repo.Resolve(charm.MustParseReference("cs:quantal/dummy"))
+	c.Assert(err, gc.ErrorMatches, `cannot decode repository index: charm store response exceeds 100 bytes`)
+	c.Assert(errgo.Cause(err), jc.DeepEquals, &charmrepo.ResponseTooLargeError{Limit: 100})
+}
+
+// writeIndex replaces the index served by s.server.
+func (s *httpRepoSuite) writeIndex(c *gc.C, index *charmrepo.HTTPIndex) {
+	data, err := json.Marshal(index)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(s.dir, charmrepo.HTTPIndexFile), data, 0644)
+	c.Assert(err, gc.IsNil)
+}
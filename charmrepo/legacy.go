@@ -4,6 +4,8 @@
 package charmrepo
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,8 +15,8 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/juju/utils"
 
@@ -24,7 +26,60 @@ import (
 // LegacyCharmStore is a repository Interface that provides access to the
 // legacy Juju charm store.
 type LegacyCharmStore struct {
-	BaseURL   string
+	BaseURL string
+
+	// CacheDir holds the directory where downloaded charms
+	// are cached. If empty, the value of the package-level
+	// CacheDir variable at the time of each call is used.
+	CacheDir string
+
+	// Series holds the series of the charms that may be
+	// resolved through the store. If empty, charms of any
+	// series may be.
+	Series []string
+
+	// Doer holds the Doer used to send all the requests
+	// to the store. If nil, http.DefaultClient is used.
+	Doer Doer
+
+	// MaxResponseSize holds the maximum size in bytes of the
+	// charm info and event responses. If zero,
+	// DefaultMaxResponseSize is used.
+	MaxResponseSize int64
+
+	// RevisionCacheTTL holds how long the revisions and digests
+	// retrieved from the store are kept in an index in the cache
+	// directory and used by Latest and Get without contacting
+	// the store. If zero, the index is not used. See Refresh.
+	RevisionCacheTTL time.Duration
+
+	// StaleIfError specifies whether Latest and Get use the
+	// revisions last retrieved from the store, recorded in the
+	// index in the cache directory, when the store cannot be
+	// reached. Such revisions are flagged as stale.
+	StaleIfError bool
+
+	// Clock holds the clock used to timestamp the revisions
+	// recorded in the cache directory and to check whether they
+	// have expired. If nil, WallClock is used.
+	Clock Clock
+
+	// FileSystem holds the file system the cache directory is
+	// accessed through. If nil, OSFileSystem is used.
+	FileSystem FileSystem
+
+	// Tracer, if not nil, is used to trace the requests
+	// to the store. See WithContext.
+	Tracer Tracer
+
+	// ctx holds the context set by WithContext.
+	ctx context.Context
+
+	// etags holds the cached charm info responses, or nil if
+	// the store was not created by NewLegacyCharmStore. It is
+	// shared with the repositories derived from this one.
+	etags *etagCache
+
 	authAttrs string // a list of attr=value pairs, comma separated
 	jujuAttrs string // a list of attr=value pairs, comma separated
 	testMode  bool
@@ -32,7 +87,89 @@ type LegacyCharmStore struct {
 
 var _ Interface = (*LegacyCharmStore)(nil)
 
-var LegacyStore = &LegacyCharmStore{BaseURL: "https://store.juju.ubuntu.com"}
+// DefaultMaxResponseSize holds the default maximum size
+// of the responses decoded by LegacyCharmStore.
+const DefaultMaxResponseSize = 10 * 1024 * 1024
+
+// ResponseTooLargeError is returned when a charm store
+// response exceeds the maximum allowed size.
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("charm store response exceeds %d bytes", e.Limit)
+}
+
+// decodeResponse decodes the JSON value read from r into v,
+// reading at most s.MaxResponseSize bytes.
+func (s *LegacyCharmStore) decodeResponse(r io.Reader, v interface{}) error {
+	limit := s.MaxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+	lr := &io.LimitedReader{R: r, N: limit + 1}
+	err := json.NewDecoder(lr).Decode(v)
+	if lr.N <= 0 {
+		return &ResponseTooLargeError{Limit: limit}
+	}
+	return err
+}
+
+// readResponse reads the whole of r, which must hold
+// at most s.MaxResponseSize bytes.
+func (s *LegacyCharmStore) readResponse(r io.Reader) ([]byte, error) {
+	limit := s.MaxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &ResponseTooLargeError{Limit: limit}
+	}
+	return data, nil
+}
+
+// cacheEnv returns the clock and file system
+// used to maintain the cache directory.
+func (s *LegacyCharmStore) cacheEnv() cacheEnv {
+	return newCacheEnv(s.Clock, s.FileSystem)
+}
+
+// NewLegacyCharmStore returns a repository accessing the legacy charm
+// store at the given URL. Unlike a LegacyCharmStore created directly,
+// it keeps the charm info responses it retrieves, in memory, so that
+// the requests for them can be made conditional.
+func NewLegacyCharmStore(baseURL string) *LegacyCharmStore {
+	return &LegacyCharmStore{
+		BaseURL: baseURL,
+		etags:   newETagCache(),
+	}
+}
+
+// NewLegacyCharmStoreWithConfig returns a repository accessing the
+// legacy charm store like NewLegacyCharmStore, configured by config.
+// The empty fields of config are set to the package defaults when
+// the store is created, so that later changes to the package-level
+// CacheDir variable do not affect it.
+func NewLegacyCharmStoreWithConfig(config Config) *LegacyCharmStore {
+	config = config.withDefaults()
+	if config.StoreURL == "" {
+		config.StoreURL = LegacyStoreURL
+	}
+	s := NewLegacyCharmStore(config.StoreURL)
+	s.CacheDir = config.CacheDir
+	s.Series = config.Series
+	return s
+}
+
+// LegacyStoreURL holds the URL of the legacy Juju charm store.
+const LegacyStoreURL = "https://store.juju.ubuntu.com"
+
+var LegacyStore = NewLegacyCharmStore(LegacyStoreURL)
 
 // WithAuthAttrs return a repository Interface with the authentication token
 // list set. authAttrs is a list of attr=value pairs.
@@ -58,12 +195,32 @@ func (s *LegacyCharmStore) WithJujuAttrs(jujuAttrs string) Interface {
 	return &jujuCS
 }
 
+// WithContext returns a repository Interface that traces its
+// operations as children of the span held by ctx, if any, and
+// propagates the trace to the charm store.
+func (s *LegacyCharmStore) WithContext(ctx context.Context) Interface {
+	newRepo := *s
+	newRepo.ctx = ctx
+	return &newRepo
+}
+
 // Perform an http get, adding custom auth header if necessary.
-func (s *LegacyCharmStore) get(url string) (resp *http.Response, err error) {
+// The span held by ctx, if any, is propagated to the store.
+func (s *LegacyCharmStore) get(ctx context.Context, url string) (resp *http.Response, err error) {
+	return s.getWithHeader(ctx, url, nil)
+}
+
+// getWithHeader performs an http get like get, with the
+// given header fields added to the request.
+func (s *LegacyCharmStore) getWithHeader(ctx context.Context, url string, header http.Header) (resp *http.Response, err error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	setTraceParent(ctx, req.Header)
 	if s.authAttrs != "" {
 		// To comply with RFC 2617, we send the authentication data in
 		// the Authorization header with a custom auth scheme
@@ -74,6 +231,9 @@ func (s *LegacyCharmStore) get(url string) (resp *http.Response, err error) {
 		// The use of "X-" to prefix custom header values is deprecated.
 		req.Header.Add("Juju-Metadata", s.jujuAttrs)
 	}
+	if s.Doer != nil {
+		return s.Doer.Do(req)
+	}
 	return http.DefaultClient.Do(req)
 }
 
@@ -93,11 +253,18 @@ func (s *LegacyCharmStore) Resolve(ref *charm.Reference) (*charm.URL, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkSeries(s.Series, curl); err != nil {
+		return nil, fmt.Errorf("cannot resolve charm URL %q: %v", ref, err)
+	}
 	return curl, nil
 }
 
 // Info returns details for all the specified charms in the charm store.
-func (s *LegacyCharmStore) Info(curls ...charm.Location) ([]*InfoResponse, error) {
+func (s *LegacyCharmStore) Info(curls ...charm.Location) (_ []*InfoResponse, err error) {
+	ctx, span := startSpan(s.ctx, s.Tracer, SpanInfo)
+	defer func() {
+		endSpan(span, err)
+	}()
 	baseURL := s.BaseURL + "/charm-info?"
 	queryParams := make([]string, len(curls), len(curls)+1)
 	for i, curl := range curls {
@@ -106,32 +273,53 @@ func (s *LegacyCharmStore) Info(curls ...charm.Location) ([]*InfoResponse, error
 	if s.testMode {
 		queryParams = append(queryParams, "stats=0")
 	}
-	resp, err := s.get(baseURL + strings.Join(queryParams, "&"))
+	infoURL := baseURL + strings.Join(queryParams, "&")
+
+	// Make the request conditional if the same request was already
+	// made, so that unchanged responses are not transferred again.
+	cacheKey := s.authAttrs + " " + infoURL
+	var cached etagEntry
+	isCached := false
+	if s.etags != nil {
+		cached, isCached = s.etags.get(cacheKey)
+	}
+	header := make(http.Header)
+	if isCached {
+		header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := s.getWithHeader(ctx, infoURL, header)
 	if err != nil {
 		if url_error, ok := err.(*url.Error); ok {
 			switch url_error.Err.(type) {
 			case *net.DNSError, *net.OpError:
-				return nil, fmt.Errorf("Cannot access the charm store. Are you connected to the internet? Error details: %v", err)
+				err = fmt.Errorf("Cannot access the charm store. Are you connected to the internet? Error details: %v", err)
 			}
 		}
-		return nil, err
+		return nil, &unreachableError{err}
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
+	var body io.Reader = resp.Body
+	switch {
+	case resp.StatusCode == http.StatusNotModified && isCached:
+		body = bytes.NewReader(cached.value.([]byte))
+	case resp.StatusCode != 200:
 		errMsg := fmt.Errorf("Cannot access the charm store. Invalid response code: %q", resp.Status)
-		body, readErr := ioutil.ReadAll(resp.Body)
+		body, readErr := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
 		if err != nil {
 			return nil, readErr
 		}
 		logger.Errorf("%v Response body: %s", errMsg, body)
 		return nil, errMsg
-	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	case resp.Header.Get("ETag") != "" && s.etags != nil:
+		data, err := s.readResponse(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		s.etags.set(cacheKey, resp.Header.Get("ETag"), data, int64(len(data)))
+		body = bytes.NewReader(data)
 	}
 	infos := make(map[string]*InfoResponse)
-	if err = json.Unmarshal(body, &infos); err != nil {
+	if err := s.decodeResponse(body, &infos); err != nil {
 		return nil, err
 	}
 	result := make([]*InfoResponse, len(curls))
@@ -152,23 +340,23 @@ func (s *LegacyCharmStore) Info(curls ...charm.Location) ([]*InfoResponse, error
 // Event returns details for a charm event in the charm store.
 //
 // If digest is empty, the latest event is returned.
-func (s *LegacyCharmStore) Event(curl *charm.URL, digest string) (*EventResponse, error) {
+func (s *LegacyCharmStore) Event(curl *charm.URL, digest string) (_ *EventResponse, err error) {
+	ctx, span := startSpan(s.ctx, s.Tracer, SpanInfo)
+	defer func() {
+		endSpan(span, err)
+	}()
 	key := curl.String()
 	query := key
 	if digest != "" {
 		query += "@" + digest
 	}
-	resp, err := s.get(s.BaseURL + "/charm-event?charms=" + url.QueryEscape(query))
+	resp, err := s.get(ctx, s.BaseURL+"/charm-event?charms="+url.QueryEscape(query))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
 	events := make(map[string]*EventResponse)
-	if err = json.Unmarshal(body, &events); err != nil {
+	if err := s.decodeResponse(resp.Body, &events); err != nil {
 		return nil, err
 	}
 	event, found := events[key]
@@ -218,7 +406,7 @@ func (s *LegacyCharmStore) Latest(curls ...*charm.URL) ([]CharmRevision, error)
 	for i, curl := range curls {
 		baseCurls[i] = curl.WithRevision(-1)
 	}
-	return s.revisions(baseCurls...)
+	return s.cachedRevisions(baseCurls...)
 }
 
 // BranchLocation returns the location for the branch holding the charm at curl.
@@ -276,8 +464,13 @@ func (s *LegacyCharmStore) CharmURL(location string) (*charm.URL, error) {
 
 // verify returns an error unless a file exists at path with a hex-encoded
 // SHA256 matching digest.
-func verify(path, digest string) error {
-	hash, _, err := utils.ReadFileSHA256(path)
+func (env cacheEnv) verify(path, digest string) error {
+	f, err := env.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash, _, err := utils.ReadSHA256(f)
 	if err != nil {
 		return err
 	}
@@ -288,16 +481,18 @@ func verify(path, digest string) error {
 }
 
 // Get returns the charm referenced by curl.
-// CacheDir must have been set, otherwise Get will panic.
+// Either s.CacheDir or CacheDir must have been set, otherwise Get will panic.
 func (s *LegacyCharmStore) Get(curl *charm.URL) (charm.Charm, error) {
 	// The cache location must have been previously set.
-	if CacheDir == "" {
+	dir := cacheDir(s.CacheDir)
+	if dir == "" {
 		panic("charm cache directory path is empty")
 	}
-	if err := os.MkdirAll(CacheDir, os.FileMode(0755)); err != nil {
+	env := s.cacheEnv()
+	if err := env.fs.MkdirAll(dir, os.FileMode(0755)); err != nil {
 		return nil, err
 	}
-	revInfo, err := s.revisions(curl)
+	revInfo, err := s.cachedRevisions(curl)
 	if err != nil {
 		return nil, err
 	}
@@ -313,40 +508,54 @@ func (s *LegacyCharmStore) Get(curl *charm.URL) (charm.Charm, error) {
 	} else if curl.Revision != rev {
 		return nil, fmt.Errorf("store returned charm with wrong revision %d for %q", rev, curl.String())
 	}
-	path := filepath.Join(CacheDir, charm.Quote(curl.String())+".charm")
-	if verify(path, digest) != nil {
-		store_url := s.BaseURL + "/charm/" + url.QueryEscape(curl.Path())
-		if s.testMode {
-			store_url = store_url + "?stats=0"
-		}
-		resp, err := s.get(store_url)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-		f, err := ioutil.TempFile(CacheDir, "charm-download")
-		if err != nil {
-			return nil, err
-		}
-		dlPath := f.Name()
-		_, err = io.Copy(f, resp.Body)
-		if cerr := f.Close(); err == nil {
-			err = cerr
-		}
-		if err != nil {
-			os.Remove(dlPath)
-			return nil, err
-		}
-		if err := utils.ReplaceFile(dlPath, path); err != nil {
+	path := env.entryPath(dir, curl, ".charm")
+	if env.verify(path, digest) != nil {
+		if err := s.download(env, dir, curl, path); err != nil {
 			return nil, err
 		}
 	}
-	if err := verify(path, digest); err != nil {
+	_, span := startSpan(s.ctx, s.Tracer, SpanVerify)
+	err = env.verify(path, digest)
+	endSpan(span, err)
+	if err != nil {
 		return nil, err
 	}
+	env.indexCacheEntry(dir, curl, path)
 	return charm.ReadCharmArchive(path)
 }
 
+// download retrieves the archive of the charm with the given
+// URL from the store and stores it at the given path in dir.
+func (s *LegacyCharmStore) download(env cacheEnv, dir string, curl *charm.URL, path string) (err error) {
+	ctx, span := startSpan(s.ctx, s.Tracer, SpanDownload)
+	defer func() {
+		endSpan(span, err)
+	}()
+	store_url := s.BaseURL + "/charm/" + url.QueryEscape(curl.Path())
+	if s.testMode {
+		store_url = store_url + "?stats=0"
+	}
+	resp, err := s.get(ctx, store_url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	f, err := env.fs.TempFile(dir, "charm-download")
+	if err != nil {
+		return err
+	}
+	dlPath := f.Name()
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		env.fs.Remove(dlPath)
+		return err
+	}
+	return env.fs.ReplaceFile(dlPath, path)
+}
+
 // LegacyInferRepository returns a charm repository inferred from the provided
 // charm or bundle reference. Local references will use the provided path.
 func LegacyInferRepository(ref *charm.Reference, localRepoPath string) (repo Interface, err error) {
@@ -4,10 +4,14 @@
 package charmrepo_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"time"
 
 	gitjujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
@@ -46,6 +50,7 @@ func (s *legacyCharmStoreSuite) SetUpTest(c *gc.C) {
 	s.server.DownloadsNoStats = nil
 	s.server.InfoRequestCount = 0
 	s.server.InfoRequestCountNoStats = 0
+	s.server.InfoRequestCountNotModified = 0
 }
 
 func (s *legacyCharmStoreSuite) TearDownSuite(c *gc.C) {
@@ -93,9 +98,9 @@ func (s *legacyCharmStoreSuite) TestLatest(c *gc.C) {
 	revInfo, err := s.store.Latest(urls...)
 	c.Assert(err, gc.IsNil)
 	c.Assert(revInfo, jc.DeepEquals, []charmrepo.CharmRevision{
-		{23, "843f8bba130a9705249f038202fab24e5151e3a2f7b6626f4508a5725739a5b5", nil},
-		{23, "843f8bba130a9705249f038202fab24e5151e3a2f7b6626f4508a5725739a5b5", nil},
-		{23, "843f8bba130a9705249f038202fab24e5151e3a2f7b6626f4508a5725739a5b5", nil},
+		{Revision: 23, Sha256: "843f8bba130a9705249f038202fab24e5151e3a2f7b6626f4508a5725739a5b5"},
+		{Revision: 23, Sha256: "843f8bba130a9705249f038202fab24e5151e3a2f7b6626f4508a5725739a5b5"},
+		{Revision: 23, Sha256: "843f8bba130a9705249f038202fab24e5151e3a2f7b6626f4508a5725739a5b5"},
 	})
 }
 
@@ -145,6 +150,58 @@ func (s *legacyCharmStoreSuite) TestGetBadCache(c *gc.C) {
 	s.assertCached(c, revCharmURL)
 }
 
+func (s *legacyCharmStoreSuite) TestGetWithCacheDir(c *gc.C) {
+	s.PatchValue(&charmrepo.CacheDir, "")
+	s.store.CacheDir = c.MkDir()
+	charmURL := charm.MustParseURL("cs:series/good-23")
+	ch, err := s.store.Get(charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch, gc.NotNil)
+	_, err = os.Stat(filepath.Join(s.store.CacheDir, charm.Quote(charmURL.String())+".charm"))
+	c.Assert(err, gc.IsNil)
+	s.assertCached(c, charmURL)
+}
+
+func (s *legacyCharmStoreSuite) TestNewWithConfig(c *gc.C) {
+	store := charmrepo.NewLegacyCharmStoreWithConfig(charmrepo.Config{})
+	c.Assert(store.BaseURL, gc.Equals, charmrepo.LegacyStoreURL)
+	c.Assert(store.CacheDir, gc.Equals, charmrepo.CacheDir)
+
+	cacheDir := charmrepo.CacheDir
+	store = charmrepo.NewLegacyCharmStoreWithConfig(charmrepo.Config{
+		StoreURL: s.server.Address(),
+		Series:   []string{"series"},
+	})
+	// The default cache directory is read when the store is created.
+	s.PatchValue(&charmrepo.CacheDir, c.MkDir())
+	charmURL := charm.MustParseURL("cs:series/good-23")
+	ch, err := store.Get(charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch, gc.NotNil)
+	_, err = os.Stat(filepath.Join(cacheDir, charm.Quote(charmURL.String())+".charm"))
+	c.Assert(err, gc.IsNil)
+
+	curl, err := store.Resolve(charm.MustParseReference("cs:series/good"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(curl, jc.DeepEquals, charm.MustParseURL("cs:series/good"))
+	store.Series = []string{"trusty"}
+	curl, err = store.Resolve(charm.MustParseReference("cs:series/good"))
+	c.Assert(err, gc.ErrorMatches, `cannot resolve charm URL "cs:series/good": charm "cs:series/good" has unsupported series "series"`)
+	c.Assert(curl, gc.IsNil)
+}
+
+func (s *legacyCharmStoreSuite) TestGetWithDoer(c *gc.C) {
+	var paths []string
+	s.store.Doer = charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+		return http.DefaultClient.Do(req)
+	})
+	ch, err := s.store.Get(charm.MustParseURL("cs:series/good-23"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch, gc.NotNil)
+	c.Assert(paths, jc.DeepEquals, []string{"/charm-info", "/charm/series/good-23"})
+}
+
 func (s *legacyCharmStoreSuite) TestGetTestModeFlag(c *gc.C) {
 	base := "cs:series/good-12"
 	charmURL := charm.MustParseURL(base)
@@ -168,6 +225,38 @@ func (s *legacyCharmStoreSuite) TestGetTestModeFlag(c *gc.C) {
 	c.Assert(s.server.InfoRequestCountNoStats, gc.Equals, 1)
 }
 
+func (s *legacyCharmStoreSuite) TestTracing(c *gc.C) {
+	var headers []string
+	s.store.Doer = charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		headers = append(headers, req.Header.Get(charmrepo.TraceParentHeader))
+		return http.DefaultClient.Do(req)
+	})
+	tracer := &fakeTracer{}
+	s.store.Tracer = tracer
+	ctx, parent := tracer.start("deploy")
+	repo := s.store.WithContext(ctx)
+
+	_, err := repo.Get(charm.MustParseURL("cs:series/good-23"))
+	c.Assert(err, gc.IsNil)
+
+	c.Assert(tracer.spans, gc.HasLen, 4)
+	for i, name := range []string{"deploy", charmrepo.SpanInfo, charmrepo.SpanDownload, charmrepo.SpanVerify} {
+		span := tracer.spans[i]
+		c.Assert(span.name, gc.Equals, name)
+		if i > 0 {
+			c.Assert(span.parent, gc.Equals, parent)
+			c.Assert(span.ended, jc.IsTrue)
+			c.Assert(span.err, gc.IsNil)
+		}
+	}
+
+	// The request spans are propagated to the charm store.
+	c.Assert(headers, jc.DeepEquals, []string{
+		tracer.spans[1].SpanContext().TraceParent(),
+		tracer.spans[2].SpanContext().TraceParent(),
+	})
+}
+
 // The following tests cover the low-level CharmStore-specific API.
 
 func (s *legacyCharmStoreSuite) TestInfo(c *gc.C) {
@@ -211,6 +300,171 @@ func (s *legacyCharmStoreSuite) TestInfoWarning(c *gc.C) {
 	c.Assert(info[0].Warnings, jc.DeepEquals, []string{"foolishness"})
 }
 
+func (s *legacyCharmStoreSuite) TestInfoNotModified(c *gc.C) {
+	charmURL := charm.MustParseURL("cs:series/good")
+	for i := 0; i < 3; i++ {
+		rev, err := charmrepo.Latest(s.store, charmURL)
+		c.Assert(err, gc.IsNil)
+		c.Assert(rev, gc.Equals, 23)
+	}
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 3)
+	c.Assert(s.server.InfoRequestCountNotModified, gc.Equals, 2)
+
+	// A changed response is retrieved again.
+	s.server.UpdateStoreRevision("cs:series/good", 26)
+	defer s.server.UpdateStoreRevision("cs:series/good", 23)
+	rev, err := charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 26)
+	c.Assert(s.server.InfoRequestCountNotModified, gc.Equals, 2)
+
+	// The cache is shared with derived repositories.
+	repo := s.store.WithJujuAttrs("foo=bar")
+	_, err = charmrepo.Latest(repo, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.server.InfoRequestCountNotModified, gc.Equals, 3)
+}
+
+func (s *legacyCharmStoreSuite) TestRevisionCache(c *gc.C) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.PatchValue(charmrepo.TimeNow, func() time.Time {
+		return now
+	})
+	s.store.RevisionCacheTTL = time.Hour
+	charmURL := charm.MustParseURL("cs:series/good")
+
+	rev, err := charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 23)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 1)
+
+	// The cached revision is used while it is fresh, including by Get.
+	s.server.UpdateStoreRevision("cs:series/good", 24)
+	defer s.server.UpdateStoreRevision("cs:series/good", 23)
+	now = now.Add(59 * time.Minute)
+	rev, err = charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 23)
+	_, err = s.store.Get(charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 1)
+
+	// The index is persistent.
+	store := newLegacyStore(s.server.Address())
+	store.RevisionCacheTTL = time.Hour
+	rev, err = charmrepo.Latest(store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 23)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 1)
+
+	// Refresh bypasses the cache and updates it.
+	revs, err := s.store.Refresh(charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(revs[0].Revision, gc.Equals, 24)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 2)
+	rev, err = charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 24)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 2)
+
+	// Expired entries are retrieved again.
+	s.server.UpdateStoreRevision("cs:series/good", 25)
+	now = now.Add(time.Hour)
+	rev, err = charmrepo.Latest(s.store, charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 25)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 3)
+}
+
+func (s *legacyCharmStoreSuite) TestStaleIfError(c *gc.C) {
+	s.store.StaleIfError = true
+	goodURL := charm.MustParseURL("cs:series/good")
+	rev, err := charmrepo.Latest(s.store, goodURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 23)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 1)
+
+	// The revision index is not used while the store can be reached.
+	s.server.UpdateStoreRevision("cs:series/good", 24)
+	defer s.server.UpdateStoreRevision("cs:series/good", 23)
+	rev, err = charmrepo.Latest(s.store, goodURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 24)
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 2)
+
+	// When the store cannot be reached, the last
+	// revisions retrieved are returned as stale.
+	store := newLegacyStore(s.server.Address())
+	store.StaleIfError = true
+	store.Doer = charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("connection refused")
+	})
+	revs, err := store.Latest(goodURL, charm.MustParseURL("cs:series/other"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(revs, gc.HasLen, 2)
+	c.Assert(revs[0].Err, gc.IsNil)
+	c.Assert(revs[0].Revision, gc.Equals, 24)
+	c.Assert(revs[0].Stale, jc.IsTrue)
+	c.Assert(revs[1].Err, gc.NotNil)
+	c.Assert(revs[1].Stale, jc.IsFalse)
+
+	// Without StaleIfError, the error is returned.
+	store.StaleIfError = false
+	_, err = store.Latest(goodURL)
+	c.Assert(err, gc.NotNil)
+
+	// Errors returned by the store are returned as such.
+	store.StaleIfError = true
+	store.Doer = charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Status:     "500 Internal Server Error",
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}, nil
+	})
+	_, err = store.Latest(goodURL)
+	c.Assert(err, gc.ErrorMatches, `Cannot access the charm store. Invalid response code: "500 Internal Server Error"`)
+
+	// The revisions retrieved from other stores are not used.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	other := newLegacyStore(srv.URL)
+	other.StaleIfError = true
+	_, err = other.Latest(goodURL)
+	c.Assert(err, gc.NotNil)
+}
+
+func (s *legacyCharmStoreSuite) TestRevisionCacheErrorsNotCached(c *gc.C) {
+	s.store.RevisionCacheTTL = time.Hour
+	charmURL := charm.MustParseURL("cs:series/missing")
+	for i := 0; i < 2; i++ {
+		_, err := charmrepo.Latest(s.store, charmURL)
+		c.Assert(err, gc.ErrorMatches, `charm not found: cs:series/missing`)
+	}
+	c.Assert(s.server.InfoRequestCount, gc.Equals, 2)
+}
+
+func (s *legacyCharmStoreSuite) TestInfoResponseTooLarge(c *gc.C) {
+	s.store.MaxResponseSize = 10
+	info, err := s.store.Info(charm.MustParseURL("cs:series/good"))
+	c.Assert(err, gc.ErrorMatches, `charm store response exceeds 10 bytes`)
+	c.Assert(err, gc.FitsTypeOf, &charmrepo.ResponseTooLargeError{})
+	c.Assert(info, gc.IsNil)
+
+	// The response fits when the limit is raised.
+	s.store.MaxResponseSize = 64 * 1024
+	info, err = s.store.Info(charm.MustParseURL("cs:series/good"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info, gc.HasLen, 1)
+}
+
+func (s *legacyCharmStoreSuite) TestEventResponseTooLarge(c *gc.C) {
+	s.store.MaxResponseSize = 10
+	event, err := s.store.Event(charm.MustParseURL("cs:series/good"), "")
+	c.Assert(err, gc.ErrorMatches, `charm store response exceeds 10 bytes`)
+	c.Assert(event, gc.IsNil)
+}
+
 func (s *legacyCharmStoreSuite) TestInfoTestModeFlag(c *gc.C) {
 	charmURL := charm.MustParseURL("cs:series/good")
 	_, err := s.store.Info(charmURL)
@@ -403,5 +657,5 @@ func (s *legacyCharmStoreSuite) TestInferRepository(c *gc.C) {
 }
 
 func newLegacyStore(url string) *charmrepo.LegacyCharmStore {
-	return &charmrepo.LegacyCharmStore{BaseURL: url}
+	return charmrepo.NewLegacyCharmStore(url)
 }
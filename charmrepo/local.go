@@ -5,6 +5,7 @@ package charmrepo
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -26,7 +27,7 @@ type LocalRepository struct {
 	Path string
 }
 
-var _ Interface = (*LocalRepository)(nil)
+var _ WritableRepo = (*LocalRepository)(nil)
 
 // NewLocalRepository creates and return a new local Juju repository pointing
 // to the given local path.
@@ -88,6 +89,12 @@ func (r *LocalRepository) Get(curl *charm.URL) (charm.Charm, error) {
 	if curl.Schema != "local" {
 		return nil, fmt.Errorf("local repository got URL with non-local schema: %q", curl)
 	}
+	return r.find(curl)
+}
+
+// find returns the charm matching curl as described for Get,
+// whatever the schema of curl.
+func (r *LocalRepository) find(curl *charm.URL) (charm.Charm, error) {
 	info, err := os.Stat(r.Path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -131,3 +138,102 @@ func (r *LocalRepository) Get(curl *charm.URL) (charm.Charm, error) {
 	}
 	return nil, charmNotFound(curl, r.Path)
 }
+
+// archivePath returns the path of the archive
+// written by Put for the charm referenced by curl.
+func (r *LocalRepository) archivePath(curl *charm.URL) string {
+	return filepath.Join(r.Path, curl.Series, fmt.Sprintf("%s-%d.charm", curl.Name, curl.Revision))
+}
+
+// Has implements WritableRepo.Has by looking for the charm
+// as Get does, so that charms put in the repository by other
+// means are found too.
+func (r *LocalRepository) Has(curl *charm.URL) (bool, error) {
+	if curl.Revision == -1 {
+		return false, errgo.Newf("no revision specified for %s", curl)
+	}
+	_, err := r.find(curl)
+	if _, ok := err.(*NotFoundError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put implements WritableRepo.Put by writing the charm as an
+// archive named after its name and revision in the directory
+// of its series, such as precise/mysql-42.charm. The charm must
+// be a *charm.CharmArchive or a *charm.CharmDir. The revision of
+// the archive is set to the revision of curl, so that Get finds
+// it. The archive is written atomically, so that Has does not
+// report charms that were not entirely written.
+func (r *LocalRepository) Put(curl *charm.URL, ch charm.Charm) error {
+	if curl.Revision == -1 {
+		return errgo.Newf("no revision specified for %s", curl)
+	}
+	if err := os.MkdirAll(filepath.Join(r.Path, curl.Series), 0755); err != nil {
+		return errgo.Mask(err)
+	}
+	if ch.Revision() == curl.Revision {
+		return writeCharmArchiveFile(r.archivePath(curl), ch)
+	}
+	var dir charm.CharmDir
+	switch ch := ch.(type) {
+	case *charm.CharmDir:
+		// Copy the charm so that the revision
+		// of the caller's charm is unchanged.
+		dir = *ch
+	case *charm.CharmArchive:
+		// The revision of an archive can only be
+		// changed by archiving it again.
+		tmpDir, err := ioutil.TempDir("", "charm-put-")
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		defer os.RemoveAll(tmpDir)
+		path := filepath.Join(tmpDir, "charm")
+		if err := ch.ExpandTo(path); err != nil {
+			return errgo.Notef(err, "cannot expand %q", curl)
+		}
+		expanded, err := charm.ReadCharmDir(path)
+		if err != nil {
+			return errgo.Notef(err, "cannot expand %q", curl)
+		}
+		dir = *expanded
+	default:
+		return errgo.Newf("cannot archive charm of type %T", ch)
+	}
+	dir.SetRevision(curl.Revision)
+	return writeCharmArchiveFile(r.archivePath(curl), &dir)
+}
+
+// writeCharmArchiveFile atomically writes the given
+// charm as an archive to the file at path.
+func writeCharmArchiveFile(path string, ch charm.Charm) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".put-")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer os.Remove(f.Name())
+	if err := writeCharmArchive(f, ch); err != nil {
+		f.Close()
+		return errgo.Mask(err)
+	}
+	if err := f.Close(); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// writeCharmArchive writes the given charm to w as an archive.
+func writeCharmArchive(w io.Writer, ch charm.Charm) error {
+	switch ch := ch.(type) {
+	case *charm.CharmArchive:
+		return ch.ArchiveTo(w)
+	case *charm.CharmDir:
+		return ch.ArchiveTo(w)
+	}
+	return errgo.Newf("cannot archive charm of type %T", ch)
+}
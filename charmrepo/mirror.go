@@ -0,0 +1,127 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"sort"
+	"sync"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// WritableRepo is a repository that charms can be added to.
+type WritableRepo interface {
+	Interface
+
+	// Has reports whether the repository holds the charm
+	// referenced by curl, which has a revision. The schema
+	// of curl is ignored.
+	Has(curl *charm.URL) (bool, error)
+
+	// Put adds the given charm to the repository under curl,
+	// which has a revision. The schema of curl is ignored.
+	Put(curl *charm.URL, ch charm.Charm) error
+}
+
+// MirrorReport holds the outcome of Mirror.
+type MirrorReport struct {
+	// Copied holds the URLs of the charms copied
+	// to the destination repository.
+	Copied []*charm.URL
+
+	// Skipped holds the URLs of the charms found
+	// in the destination repository already.
+	Skipped []*charm.URL
+
+	// Failed maps the URLs of the charms that could not be
+	// mirrored, as given to Mirror, to the corresponding errors.
+	Failed map[string]error
+}
+
+// Mirror copies the charms referenced by urls from src to dst, with up
+// to the given number of copies running at the same time. A
+// concurrency of less than one means one. Both repositories must be
+// safe for concurrent use.
+//
+// URLs with no revision refer to the latest revision of the charm in
+// src. Charms already held by dst are skipped, so that an interrupted
+// mirroring can be resumed by calling Mirror again with the same URLs.
+// All the charms are processed even when some fail; the URLs in the
+// returned report are sorted.
+func Mirror(src Interface, dst WritableRepo, urls []*charm.URL, concurrency int) *MirrorReport {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		report = &MirrorReport{
+			Failed: make(map[string]error),
+		}
+	)
+	urlc := make(chan *charm.URL)
+	for i := 0; i < concurrency && i < len(urls); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for curl := range urlc {
+				id, copied, err := mirrorCharm(src, dst, curl)
+				mu.Lock()
+				switch {
+				case err != nil:
+					report.Failed[curl.String()] = err
+				case copied:
+					report.Copied = append(report.Copied, id)
+				default:
+					report.Skipped = append(report.Skipped, id)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, curl := range urls {
+		urlc <- curl
+	}
+	close(urlc)
+	wg.Wait()
+	sort.Sort(urlsByString(report.Copied))
+	sort.Sort(urlsByString(report.Skipped))
+	return report
+}
+
+// mirrorCharm copies the charm referenced by curl from src to dst
+// unless dst holds it already. It returns the URL of the charm
+// with its revision resolved, and whether the charm was copied.
+func mirrorCharm(src Interface, dst WritableRepo, curl *charm.URL) (*charm.URL, bool, error) {
+	if curl.Revision == -1 {
+		rev, err := Latest(src, curl)
+		if err != nil {
+			return nil, false, errgo.Notef(err, "cannot resolve %q", curl)
+		}
+		curl = curl.WithRevision(rev)
+	}
+	has, err := dst.Has(curl)
+	if err != nil {
+		return nil, false, errgo.Notef(err, "cannot check for %q", curl)
+	}
+	if has {
+		return curl, false, nil
+	}
+	ch, err := src.Get(curl)
+	if err != nil {
+		return nil, false, errgo.Notef(err, "cannot get %q", curl)
+	}
+	if err := dst.Put(curl, ch); err != nil {
+		return nil, false, errgo.Notef(err, "cannot put %q", curl)
+	}
+	return curl, true, nil
+}
+
+type urlsByString []*charm.URL
+
+func (us urlsByString) Len() int           { return len(us) }
+func (us urlsByString) Swap(i, j int)      { us[i], us[j] = us[j], us[i] }
+func (us urlsByString) Less(i, j int) bool { return us[i].String() < us[j].String() }
@@ -0,0 +1,117 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type mirrorSuite struct {
+	src *concurrencyRepo
+	dst *charmrepo.LocalRepository
+}
+
+var _ = gc.Suite(&mirrorSuite{})
+
+func (s *mirrorSuite) SetUpTest(c *gc.C) {
+	root := c.MkDir()
+	seriesPath := filepath.Join(root, "quantal")
+	c.Assert(os.Mkdir(seriesPath, 0777), gc.IsNil)
+	for _, name := range []string{"wordpress", "mysql", "logging"} {
+		TestCharms.ClonedDirPath(seriesPath, name)
+	}
+	s.src = &concurrencyRepo{
+		Interface: &charmrepo.LocalRepository{Path: root},
+	}
+	s.dst = &charmrepo.LocalRepository{Path: c.MkDir()}
+}
+
+func (s *mirrorSuite) TestMirror(c *gc.C) {
+	urls := []*charm.URL{
+		charm.MustParseURL("local:quantal/wordpress"),
+		charm.MustParseURL("local:quantal/mysql-1"),
+		charm.MustParseURL("local:quantal/logging"),
+		charm.MustParseURL("local:quantal/mongodb"),
+	}
+	report := charmrepo.Mirror(s.src, s.dst, urls, 2)
+	c.Assert(report.Copied, jc.DeepEquals, []*charm.URL{
+		charm.MustParseURL("local:quantal/logging-1"),
+		charm.MustParseURL("local:quantal/mysql-1"),
+		charm.MustParseURL("local:quantal/wordpress-3"),
+	})
+	c.Assert(report.Skipped, gc.HasLen, 0)
+	c.Assert(report.Failed, gc.HasLen, 1)
+	c.Assert(report.Failed["local:quantal/mongodb"], gc.ErrorMatches, `cannot resolve "local:quantal/mongodb": .*charm not found.*`)
+	c.Assert(s.src.max <= 2, jc.IsTrue)
+
+	ch, err := s.dst.Get(charm.MustParseURL("local:quantal/wordpress-3"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "wordpress")
+	_, err = os.Stat(filepath.Join(s.dst.Path, "quantal", "wordpress-3.charm"))
+	c.Assert(err, gc.IsNil)
+
+	// Mirroring again skips the charms copied already.
+	report = charmrepo.Mirror(s.src, s.dst, urls[:3], 1)
+	c.Assert(report.Copied, gc.HasLen, 0)
+	c.Assert(report.Skipped, gc.HasLen, 3)
+	c.Assert(report.Failed, gc.HasLen, 0)
+}
+
+func (s *mirrorSuite) TestPutRequiresRevision(c *gc.C) {
+	ch := TestCharms.CharmDir("dummy")
+	err := s.dst.Put(charm.MustParseURL("cs:quantal/dummy"), ch)
+	c.Assert(err, gc.ErrorMatches, `no revision specified for cs:quantal/dummy`)
+	has, err := s.dst.Has(charm.MustParseURL("cs:quantal/dummy-1"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(has, jc.IsFalse)
+}
+
+func (s *mirrorSuite) TestPutSetsRevision(c *gc.C) {
+	dir := TestCharms.CharmDir("dummy")
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	for i, ch := range []charm.Charm{dir, archive} {
+		rev := ch.Revision() + 10 + i
+		curl := charm.MustParseURL("local:quantal/dummy").WithRevision(rev)
+		err := s.dst.Put(curl, ch)
+		c.Assert(err, gc.IsNil)
+		c.Assert(ch.Revision(), gc.Not(gc.Equals), rev)
+
+		got, err := s.dst.Get(curl)
+		c.Assert(err, gc.IsNil)
+		c.Assert(got.Revision(), gc.Equals, rev)
+		has, err := s.dst.Has(curl)
+		c.Assert(err, gc.IsNil)
+		c.Assert(has, jc.IsTrue)
+	}
+}
+
+func (s *mirrorSuite) TestHasFindsCharmsLikeGet(c *gc.C) {
+	// Charms not written by Put are found too.
+	seriesPath := filepath.Join(s.dst.Path, "quantal")
+	c.Assert(os.Mkdir(seriesPath, 0777), gc.IsNil)
+	TestCharms.ClonedDirPath(seriesPath, "dummy")
+	ch, err := s.dst.Get(charm.MustParseURL("local:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+
+	curl := charm.MustParseURL("cs:quantal/dummy").WithRevision(ch.Revision())
+	has, err := s.dst.Has(curl)
+	c.Assert(err, gc.IsNil)
+	c.Assert(has, jc.IsTrue)
+	has, err = s.dst.Has(curl.WithRevision(ch.Revision() + 1))
+	c.Assert(err, gc.IsNil)
+	c.Assert(has, jc.IsFalse)
+
+	// A missing repository holds no charms.
+	has, err = (&charmrepo.LocalRepository{Path: filepath.Join(c.MkDir(), "missing")}).Has(curl)
+	c.Assert(err, gc.IsNil)
+	c.Assert(has, jc.IsFalse)
+}
@@ -0,0 +1,584 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// Media types used by OCIRepo.
+const (
+	// OCIManifestMediaType holds the media type
+	// of the manifests of OCI artifacts.
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+	// OCICharmMediaType holds the media type of the
+	// layers holding charm archives in OCI artifacts.
+	OCICharmMediaType = "application/vnd.juju.charm.v1+zip"
+
+	// ociTitleAnnotation holds the annotation ORAS
+	// records the file name of each layer in.
+	ociTitleAnnotation = "org.opencontainers.image.title"
+)
+
+// OCIRepo is a repository Interface that retrieves charms published
+// as OCI artifacts to a container registry, as done by ORAS. The charm
+// with URL cs:trusty/wordpress-3 is held in the registry repository
+// named wordpress, within the namespace of the OCIRepo if any, with
+// the tag trusty-3. Charms owned by a user, such as
+// cs:~bob/trusty/wordpress-3, are held in a repository named after the
+// user, such as bob/wordpress. The archive of the charm is the first layer of the
+// artifact whose media type is OCICharmMediaType, or, as ORAS pushes
+// files with a generic media type by default, whose title annotation
+// ends with ".charm".
+//
+// Registries requiring authentication are supported through the
+// standard registry token protocol and through basic authentication.
+type OCIRepo struct {
+	registry  string
+	namespace string
+	username  string
+	password  string
+	doer      Doer
+	cacheDir  string
+	env       cacheEnv
+
+	// mu guards tokens.
+	mu sync.Mutex
+
+	// tokens holds the bearer tokens obtained
+	// from the registry, keyed by scope.
+	tokens map[string]string
+}
+
+var _ Interface = (*OCIRepo)(nil)
+
+// OCIRepoParams holds parameters for instantiating a new OCIRepo.
+type OCIRepoParams struct {
+	// Registry holds the root URL of the registry, with no
+	// trailing slash, such as https://registry.example.com.
+	Registry string
+
+	// Namespace holds the path within the registry under which
+	// charms are published, such as "charms". It may be empty.
+	Namespace string
+
+	// Username and Password hold the credentials sent to the
+	// registry, or to its token service, when it requires
+	// authentication. They may be empty for anonymous access.
+	Username string
+	Password string
+
+	// Doer holds the Doer used to send all the requests to the
+	// registry. If nil, http.DefaultClient is used.
+	Doer Doer
+
+	// CacheDir holds the directory where downloaded charms
+	// are cached. If empty, the value of the package-level
+	// CacheDir variable at the time of each call is used.
+	CacheDir string
+
+	// FileSystem holds the file system the cache directory is
+	// accessed through. If nil, OSFileSystem is used.
+	FileSystem FileSystem
+
+	// CacheKey, if not nil, holds the key used to encrypt the
+	// archives stored in the cache directory, as described
+	// for NewCharmStoreParams.CacheKey.
+	CacheKey []byte
+}
+
+// NewOCIRepo returns a repository retrieving charms from the registry
+// specified by p.
+func NewOCIRepo(p OCIRepoParams) (*OCIRepo, error) {
+	if p.Registry == "" {
+		return nil, errgo.New("registry URL not specified")
+	}
+	if _, err := url.Parse(p.Registry); err != nil {
+		return nil, errgo.Notef(err, "invalid registry URL")
+	}
+	doer := p.Doer
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+	env, err := newCacheEnv(nil, p.FileSystem).withCacheKey(p.CacheKey)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return &OCIRepo{
+		registry:  strings.TrimSuffix(p.Registry, "/"),
+		namespace: strings.Trim(p.Namespace, "/"),
+		username:  p.Username,
+		password:  p.Password,
+		doer:      doer,
+		cacheDir:  p.CacheDir,
+		env:       env,
+		tokens:    make(map[string]string),
+	}, nil
+}
+
+// Resolve implements Interface.Resolve. The reference
+// must specify a series.
+func (r *OCIRepo) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	if ref.Series == "" {
+		return nil, errgo.Newf("no series specified for %s", ref)
+	}
+	u, err := ref.URL("")
+	if err != nil {
+		return nil, err
+	}
+	if u.Revision != -1 {
+		return u, nil
+	}
+	rev, err := r.latest(u)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return u.WithRevision(rev), nil
+}
+
+// Latest implements Interface.Latest by finding the latest revision
+// of each charm among the tags of its registry repository.
+func (r *OCIRepo) Latest(curls ...*charm.URL) ([]CharmRevision, error) {
+	result := make([]CharmRevision, len(curls))
+	for i, curl := range curls {
+		result[i].Revision, result[i].Err = r.latest(curl)
+	}
+	return result, nil
+}
+
+// Get implements Interface.Get.
+func (r *OCIRepo) Get(curl *charm.URL) (charm.Charm, error) {
+	if curl.IsBundle() {
+		return nil, errgo.Newf("expected a charm URL, got bundle URL %q", curl)
+	}
+	if curl.Revision == -1 {
+		rev, err := r.latest(curl)
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		curl = curl.WithRevision(rev)
+	}
+	path, err := r.archivePath(curl)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return r.env.readCharmArchive(path)
+}
+
+// repository returns the name of the registry
+// repository holding the charm referenced by curl.
+func (r *OCIRepo) repository(curl *charm.URL) string {
+	return path.Join(r.namespace, curl.User, curl.Name)
+}
+
+// ociTag returns the tag of the artifact holding
+// the given revision of the charm referenced by curl.
+func ociTag(curl *charm.URL, revision int) string {
+	return fmt.Sprintf("%s-%d", curl.Series, revision)
+}
+
+// latest returns the latest revision of the charm
+// referenced by curl, regardless of its revision.
+func (r *OCIRepo) latest(curl *charm.URL) (int, error) {
+	repo := r.repository(curl)
+	tags, err := r.tags(repo)
+	if err != nil {
+		if isOCINotFound(err) {
+			return 0, CharmNotFound(curl.WithRevision(-1).String())
+		}
+		return 0, errgo.Notef(err, "cannot list the revisions of %q", curl.WithRevision(-1))
+	}
+	latest := -1
+	prefix := curl.Series + "-"
+	for _, t := range tags {
+		if !strings.HasPrefix(t, prefix) {
+			continue
+		}
+		rev, err := strconv.Atoi(strings.TrimPrefix(t, prefix))
+		if err != nil || rev < 0 {
+			continue
+		}
+		if rev > latest {
+			latest = rev
+		}
+	}
+	if latest == -1 {
+		return 0, CharmNotFound(curl.WithRevision(-1).String())
+	}
+	return latest, nil
+}
+
+// tags returns all the tags of the given registry repository,
+// following the Link headers of registries that return the
+// list a page at a time.
+func (r *OCIRepo) tags(repo string) ([]string, error) {
+	var all []string
+	p := "/v2/" + repo + "/tags/list"
+	for p != "" {
+		var tags struct {
+			Tags []string `json:"tags"`
+		}
+		resp, err := r.do(repo, p, "")
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&tags)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot decode response")
+		}
+		all = append(all, tags.Tags...)
+		next, err := nextLink(resp.Header.Get("Link"))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		if next == p {
+			return nil, errgo.Newf("registry returned the same page of tags again")
+		}
+		p = next
+	}
+	return all, nil
+}
+
+// nextLink returns the path and query of the URL in a Link header
+// field with the "next" relation, such as
+// `</v2/wordpress/tags/list?n=100&last=trusty-3>; rel="next"`, or
+// the empty string if there is none.
+func nextLink(link string) (string, error) {
+	for _, l := range strings.Split(link, ",") {
+		parts := strings.Split(l, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) != `rel="next"` && strings.TrimSpace(param) != "rel=next" {
+				continue
+			}
+			u, err := url.Parse(target[1 : len(target)-1])
+			if err != nil {
+				return "", errgo.Notef(err, "invalid Link header")
+			}
+			return u.RequestURI(), nil
+		}
+	}
+	return "", nil
+}
+
+// ociDescriptor describes a blob held in a registry.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest holds the manifest of an OCI artifact.
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// charmLayer returns the layer of the manifest holding
+// the charm archive, or false if there is none.
+func (m *ociManifest) charmLayer() (ociDescriptor, bool) {
+	for _, layer := range m.Layers {
+		if layer.MediaType == OCICharmMediaType {
+			return layer, true
+		}
+	}
+	for _, layer := range m.Layers {
+		if strings.HasSuffix(layer.Annotations[ociTitleAnnotation], ".charm") {
+			return layer, true
+		}
+	}
+	return ociDescriptor{}, false
+}
+
+// archivePath retrieves and verifies the archive of the charm
+// referenced by curl, which must have a revision, unless it is
+// already in the cache, and returns its path in the cache.
+func (r *OCIRepo) archivePath(curl *charm.URL) (string, error) {
+	dir := cacheDir(r.cacheDir)
+	if dir == "" {
+		panic("charm cache directory path is empty")
+	}
+	if err := r.env.fs.MkdirAll(dir, 0755); err != nil {
+		return "", errgo.Notef(err, "cannot create the cache directory")
+	}
+	repo := r.repository(curl)
+	var manifest ociManifest
+	err := r.getJSON(repo, "/v2/"+repo+"/manifests/"+ociTag(curl, curl.Revision), OCIManifestMediaType, &manifest)
+	if err != nil {
+		if isOCINotFound(err) {
+			return "", CharmNotFound(curl.String())
+		}
+		return "", errgo.Notef(err, "cannot retrieve the manifest of %q", curl)
+	}
+	layer, ok := manifest.charmLayer()
+	if !ok {
+		return "", errgo.Newf("artifact of %q holds no charm archive", curl)
+	}
+	if !strings.HasPrefix(layer.Digest, "sha256:") {
+		return "", errgo.Newf("artifact of %q has unsupported digest %q", curl, layer.Digest)
+	}
+	expectHash := strings.TrimPrefix(layer.Digest, "sha256:")
+	path := filepath.Join(dir, "oci-"+charm.QuoteV2(curl.String())+".charm")
+	if r.env.verifySHA256AndSize(path, expectHash, layer.Size) == nil {
+		return path, nil
+	}
+	resp, err := r.do(repo, "/v2/"+repo+"/blobs/"+layer.Digest, "")
+	if err != nil {
+		return "", errgo.Notef(err, "cannot retrieve the archive of %q", curl)
+	}
+	defer resp.Body.Close()
+	if err := r.env.storeSHA256(path, resp.Body, expectHash, layer.Size); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return path, nil
+}
+
+// storeSHA256 reads a charm archive from r and stores it in the cache
+// at path, provided that it has the given hex-encoded SHA256 hash and
+// size. No more than one byte beyond the expected size is read.
+func (env cacheEnv) storeSHA256(path string, r io.Reader, expectHash string, expectSize int64) error {
+	f, err := env.fs.TempFile(filepath.Dir(path), "charm-download")
+	if err != nil {
+		return errgo.Notef(err, "cannot make temporary file")
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+			env.fs.Remove(f.Name())
+		}
+	}()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(hash, f), io.LimitReader(r, expectSize+1))
+	if err != nil {
+		return errgo.Notef(err, "cannot read charm archive")
+	}
+	if size != expectSize {
+		return errgo.Newf("size mismatch; network corruption?")
+	}
+	if fmt.Sprintf("%x", hash.Sum(nil)) != expectHash {
+		return errgo.Newf("hash mismatch; network corruption?")
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := env.sealArchive(f.Name()); err != nil {
+		return errgo.Notef(err, "cannot encrypt the charm archive")
+	}
+	if err := env.fs.ReplaceFile(f.Name(), path); err != nil {
+		return errgo.Notef(err, "cannot move the charm archive")
+	}
+	f = nil
+	return nil
+}
+
+// verifySHA256AndSize checks that the file at path has
+// the given hex-encoded SHA256 hash and size.
+func (env cacheEnv) verifySHA256AndSize(path, expectHash string, expectSize int64) error {
+	f, err := env.openArchive(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if size != expectSize {
+		return errgo.Newf("size mismatch for %q", path)
+	}
+	if fmt.Sprintf("%x", hash.Sum(nil)) != expectHash {
+		return errgo.Newf("hash mismatch for %q", path)
+	}
+	return nil
+}
+
+// ociStatusError is returned when the registry
+// responds with an unexpected status.
+type ociStatusError struct {
+	status int
+	url    string
+}
+
+func (e *ociStatusError) Error() string {
+	return fmt.Sprintf("unexpected response from %s: %s", e.url, http.StatusText(e.status))
+}
+
+func isOCINotFound(err error) bool {
+	e, ok := errgo.Cause(err).(*ociStatusError)
+	return ok && e.status == http.StatusNotFound
+}
+
+// getJSON sends a GET request for the given path of the
+// registry and decodes the JSON response into v.
+func (r *OCIRepo) getJSON(repo, p, accept string, v interface{}) error {
+	resp, err := r.do(repo, p, accept)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errgo.Notef(err, "cannot decode response")
+	}
+	return nil
+}
+
+// do sends a GET request for the given path of the registry,
+// authenticating as required to pull from the given repository.
+// It returns an error if the response status is not 200 OK.
+func (r *OCIRepo) do(repo, p, accept string) (*http.Response, error) {
+	scope := "repository:" + repo + ":pull"
+	u := r.registry + p
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		r.mu.Lock()
+		token := r.tokens[scope]
+		r.mu.Unlock()
+		switch {
+		case token != "":
+			req.Header.Set("Authorization", "Bearer "+token)
+		case r.username != "":
+			req.SetBasicAuth(r.username, r.password)
+		}
+		return r.doer.Do(req)
+	}
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := r.authorize(challenge, scope); err != nil {
+			return nil, errgo.Mask(err)
+		}
+		if resp, err = send(); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &ociStatusError{status: resp.StatusCode, url: u}
+	}
+	return resp, nil
+}
+
+// authorize obtains a token for the given scope from the token
+// service named in the challenge returned by the registry.
+func (r *OCIRepo) authorize(challenge, scope string) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "Bearer") {
+		return errgo.Newf("registry requires unsupported authentication %q", challenge)
+	}
+	realm := params["realm"]
+	if realm == "" {
+		return errgo.Newf("registry authentication challenge has no realm")
+	}
+	key := scope
+	values := make(url.Values)
+	if service := params["service"]; service != "" {
+		values.Set("service", service)
+	}
+	if s := params["scope"]; s != "" {
+		scope = s
+	}
+	values.Set("scope", scope)
+	req, err := http.NewRequest("GET", realm+"?"+values.Encode(), nil)
+	if err != nil {
+		return errgo.Notef(err, "invalid token service")
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.doer.Do(req)
+	if err != nil {
+		return errgo.Notef(err, "cannot get registry token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errgo.Newf("cannot get registry token: %s", http.StatusText(resp.StatusCode))
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return errgo.Notef(err, "cannot decode registry token")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return errgo.Newf("token service returned no token")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[key] = token.Token
+	return nil
+}
+
+// parseChallenge parses the value of a WWW-Authenticate header
+// field, such as `Bearer realm="https://auth.example.com/token",
+// service="registry.example.com"`, into its scheme and parameters.
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	i := strings.IndexAny(challenge, " \t")
+	if i == -1 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		eq := strings.Index(rest, "=")
+		if eq == -1 {
+			return scheme, params
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end == -1 {
+				end = len(rest)
+			}
+			value, rest = strings.TrimSpace(rest[:end]), rest[end:]
+		}
+		params[key] = value
+	}
+}
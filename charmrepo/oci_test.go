@@ -0,0 +1,256 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+// fakeRegistry is a container registry serving charm
+// artifacts, which requires bearer tokens for all requests.
+type fakeRegistry struct {
+	server *httptest.Server
+
+	// manifests holds the manifests, keyed by
+	// repository name and then by tag.
+	manifests map[string]map[string][]byte
+
+	// blobs holds the blobs, keyed by digest.
+	blobs map[string][]byte
+
+	// tokenRequests holds the number
+	// of requests for a token.
+	tokenRequests int
+
+	// pageSize holds the number of tags returned in each
+	// page of a tag list, or zero to return them all at once.
+	pageSize int
+}
+
+func newFakeRegistry() *fakeRegistry {
+	r := &fakeRegistry{
+		manifests: make(map[string]map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+	r.server = httptest.NewServer(r)
+	return r
+}
+
+// push publishes the given charm archive under the given tag
+// of the repository, with the given media type and title.
+func (r *fakeRegistry) push(c *gc.C, repo, tag, mediaType, title string, data []byte) {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	r.blobs[digest] = data
+	layer := map[string]interface{}{
+		"mediaType": mediaType,
+		"digest":    digest,
+		"size":      len(data),
+	}
+	if title != "" {
+		layer["annotations"] = map[string]string{
+			"org.opencontainers.image.title": title,
+		}
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     charmrepo.OCIManifestMediaType,
+		"layers":        []interface{}{layer},
+	})
+	c.Assert(err, gc.IsNil)
+	if r.manifests[repo] == nil {
+		r.manifests[repo] = make(map[string][]byte)
+	}
+	r.manifests[repo][tag] = manifest
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.tokenRequests++
+		user, password, _ := req.BasicAuth()
+		if user != "bob" || password != "secret" {
+			http.Error(w, "bad credentials", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"token": "token-for-" + req.URL.Query().Get("scope"),
+		})
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	var repo, kind, ref string
+	for _, k := range []string{"/manifests/", "/blobs/", "/tags/"} {
+		if i := strings.Index(path, k); i != -1 {
+			repo, kind, ref = path[:i], strings.Trim(k, "/"), path[i+len(k):]
+			break
+		}
+	}
+	if req.Header.Get("Authorization") != "Bearer token-for-repository:"+repo+":pull" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.server.URL))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var data []byte
+	switch kind {
+	case "manifests":
+		data = r.manifests[repo][ref]
+	case "blobs":
+		data = r.blobs[ref]
+	case "tags":
+		if tags, ok := r.manifests[repo]; ok {
+			list := []string{}
+			for tag := range tags {
+				if tag > req.URL.Query().Get("last") {
+					list = append(list, tag)
+				}
+			}
+			sort.Strings(list)
+			if r.pageSize > 0 && len(list) > r.pageSize {
+				list = list[:r.pageSize]
+				w.Header().Set("Link", fmt.Sprintf(`<%s/v2/%s/tags/list?n=%d&last=%s>; rel="next"`, r.server.URL, repo, r.pageSize, list[len(list)-1]))
+			}
+			data, _ = json.Marshal(map[string]interface{}{"name": repo, "tags": list})
+		}
+	}
+	if data == nil {
+		http.NotFound(w, req)
+		return
+	}
+	w.Write(data)
+}
+
+type ociRepoSuite struct {
+	registry *fakeRegistry
+	repo     *charmrepo.OCIRepo
+	archive  []byte
+}
+
+var _ = gc.Suite(&ociRepoSuite{})
+
+func (s *ociRepoSuite) SetUpTest(c *gc.C) {
+	s.registry = newFakeRegistry()
+	var err error
+	s.archive, err = ioutil.ReadFile(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	s.registry.push(c, "charms/dummy", "quantal-1", charmrepo.OCICharmMediaType, "", s.archive)
+	s.registry.push(c, "charms/dummy", "quantal-3", "application/vnd.oci.image.layer.v1.tar", "dummy.charm", s.archive)
+	s.registry.push(c, "charms/dummy", "trusty-7", charmrepo.OCICharmMediaType, "", s.archive)
+	s.repo, err = charmrepo.NewOCIRepo(charmrepo.OCIRepoParams{
+		Registry:  s.registry.server.URL,
+		Namespace: "charms",
+		Username:  "bob",
+		Password:  "secret",
+		CacheDir:  c.MkDir(),
+	})
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ociRepoSuite) TearDownTest(c *gc.C) {
+	s.registry.server.Close()
+}
+
+func (s *ociRepoSuite) TestResolve(c *gc.C) {
+	url, err := s.repo.Resolve(charm.MustParseReference("cs:quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("cs:quantal/dummy-3"))
+
+	_, err = s.repo.Resolve(charm.MustParseReference("cs:dummy"))
+	c.Assert(err, gc.ErrorMatches, `no series specified for cs:dummy`)
+
+	// The token obtained for the repository has been reused.
+	c.Assert(s.registry.tokenRequests, gc.Equals, 1)
+}
+
+func (s *ociRepoSuite) TestLatest(c *gc.C) {
+	revs, err := s.repo.Latest(
+		charm.MustParseURL("cs:quantal/dummy"),
+		charm.MustParseURL("cs:trusty/dummy-1"),
+		charm.MustParseURL("cs:precise/dummy"),
+		charm.MustParseURL("cs:quantal/wordpress"),
+	)
+	c.Assert(err, gc.IsNil)
+	c.Assert(revs, gc.HasLen, 4)
+	c.Assert(revs[0].Revision, gc.Equals, 3)
+	c.Assert(revs[1].Revision, gc.Equals, 7)
+	c.Assert(revs[2].Err, gc.ErrorMatches, `charm not found: cs:precise/dummy`)
+	c.Assert(revs[3].Err, gc.ErrorMatches, `charm not found: cs:quantal/wordpress`)
+}
+
+func (s *ociRepoSuite) TestGet(c *gc.C) {
+	for i, url := range []string{"cs:quantal/dummy-1", "cs:quantal/dummy"} {
+		c.Logf("test %d: %s", i, url)
+		ch, err := s.repo.Get(charm.MustParseURL(url))
+		c.Assert(err, gc.IsNil)
+		c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+	}
+	_, err := s.repo.Get(charm.MustParseURL("cs:quantal/dummy-2"))
+	c.Assert(err, gc.ErrorMatches, `charm not found: cs:quantal/dummy-2`)
+}
+
+func (s *ociRepoSuite) TestGetCorrupted(c *gc.C) {
+	for digest := range s.registry.blobs {
+		data := append([]byte(nil), s.archive...)
+		data[len(data)/2] ^= 0xff
+		s.registry.blobs[digest] = data
+	}
+	_, err := s.repo.Get(charm.MustParseURL("cs:quantal/dummy-1"))
+	c.Assert(err, gc.ErrorMatches, `hash mismatch; network corruption\?`)
+}
+
+func (s *ociRepoSuite) TestBadCredentials(c *gc.C) {
+	repo, err := charmrepo.NewOCIRepo(charmrepo.OCIRepoParams{
+		Registry: s.registry.server.URL,
+		CacheDir: c.MkDir(),
+	})
+	c.Assert(err, gc.IsNil)
+	_, err = repo.Get(charm.MustParseURL("cs:quantal/dummy-1"))
+	c.Assert(err, gc.ErrorMatches, `cannot retrieve the manifest of "cs:quantal/dummy-1": cannot get registry token: Unauthorized`)
+}
+
+func (s *ociRepoSuite) TestLatestPaginated(c *gc.C) {
+	s.registry.pageSize = 1
+	s.registry.push(c, "charms/dummy", "trusty-12", charmrepo.OCICharmMediaType, "", s.archive)
+	revs, err := s.repo.Latest(
+		charm.MustParseURL("cs:quantal/dummy"),
+		charm.MustParseURL("cs:trusty/dummy"),
+	)
+	c.Assert(err, gc.IsNil)
+	c.Assert(revs, gc.HasLen, 2)
+	c.Assert(revs[0].Revision, gc.Equals, 3)
+	c.Assert(revs[1].Revision, gc.Equals, 12)
+}
+
+func (s *ociRepoSuite) TestGetUserCharm(c *gc.C) {
+	s.registry.push(c, "charms/alice/dummy", "quantal-5", charmrepo.OCICharmMediaType, "", s.archive)
+	url, err := s.repo.Resolve(charm.MustParseReference("cs:~alice/quantal/dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("cs:~alice/quantal/dummy-5"))
+	ch, err := s.repo.Get(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+
+	// The charms of other owners are not found.
+	_, err = s.repo.Get(charm.MustParseURL("cs:~alice/quantal/dummy-1"))
+	c.Assert(err, gc.ErrorMatches, `charm not found: cs:~alice/quantal/dummy-1`)
+}
+
+func (s *ociRepoSuite) TestGetOversized(c *gc.C) {
+	for digest := range s.registry.blobs {
+		s.registry.blobs[digest] = append(append([]byte(nil), s.archive...), make([]byte, 1<<20)...)
+	}
+	_, err := s.repo.Get(charm.MustParseURL("cs:quantal/dummy-1"))
+	c.Assert(err, gc.ErrorMatches, `size mismatch; network corruption\?`)
+}
@@ -35,6 +35,12 @@ type CharmRevision struct {
 	Revision int
 	Sha256   string
 	Err      error
+
+	// Stale holds whether the revision was taken from the
+	// revision cache because the store could not be reached,
+	// so that it may be out of date. See the StaleIfError
+	// fields of LegacyCharmStore and NewCharmStoreParams.
+	Stale bool
 }
 
 // NotFoundError represents an error indicating that the requested data wasn't found.
@@ -0,0 +1,90 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"fmt"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// PolicyFunc decides whether the charm referenced by curl, which has
+// a series and a revision, may be used, returning an error describing
+// why if it may not. Meta holds the metadata of the charm when it has
+// been retrieved, and is nil when only its URL is known, as when a
+// reference is resolved.
+type PolicyFunc func(curl *charm.URL, meta *charm.Meta) error
+
+// policyRepo is a repository checking the charms it
+// returns against a policy.
+type policyRepo struct {
+	Interface
+	policy PolicyFunc
+}
+
+// WithPolicy returns a repository retrieving charms from repo, which
+// checks the charms returned by Get and the URLs returned by Resolve
+// against the given policy, so that deprecated or vulnerable charms
+// can be blocked for all the tools using the repository. The errors
+// returned by the policy have a cause that is their own cause,
+// as returned by errgo.Cause.
+func WithPolicy(repo Interface, policy PolicyFunc) Interface {
+	return &policyRepo{
+		Interface: repo,
+		policy:    policy,
+	}
+}
+
+// Get implements Interface.Get.
+func (r *policyRepo) Get(curl *charm.URL) (charm.Charm, error) {
+	ch, err := r.Interface.Get(curl)
+	if err != nil {
+		return nil, err
+	}
+	if curl.Revision == -1 {
+		curl = curl.WithRevision(ch.Revision())
+	}
+	if err := r.check(curl, ch.Meta()); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Resolve implements Interface.Resolve.
+func (r *policyRepo) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	curl, err := r.Interface.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.check(curl, nil); err != nil {
+		return nil, err
+	}
+	return curl, nil
+}
+
+func (r *policyRepo) check(curl *charm.URL, meta *charm.Meta) error {
+	if err := r.policy(curl, meta); err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("charm %q denied by policy", curl), errgo.Any)
+	}
+	return nil
+}
+
+// DenyURLs returns a policy denying the charms referenced by
+// the given URLs. URLs with no revision deny all the revisions
+// of a charm. The schema of the URLs is ignored.
+func DenyURLs(curls ...*charm.URL) PolicyFunc {
+	return func(curl *charm.URL, meta *charm.Meta) error {
+		for _, deny := range curls {
+			if deny.Series != curl.Series || deny.Name != curl.Name || deny.User != curl.User {
+				continue
+			}
+			if deny.Revision == -1 || deny.Revision == curl.Revision {
+				return errgo.Newf("%s is on the deny list", deny.Path())
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type policySuite struct {
+	repo charmrepo.Interface
+}
+
+var _ = gc.Suite(&policySuite{})
+
+func (s *policySuite) SetUpTest(c *gc.C) {
+	root := c.MkDir()
+	seriesPath := filepath.Join(root, "quantal")
+	c.Assert(os.Mkdir(seriesPath, 0777), gc.IsNil)
+	for _, name := range []string{"wordpress", "mysql"} {
+		TestCharms.ClonedDirPath(seriesPath, name)
+	}
+	s.repo = &charmrepo.LocalRepository{Path: root}
+}
+
+func (s *policySuite) TestWithPolicy(c *gc.C) {
+	errVulnerable := errors.New("vulnerable")
+	type call struct {
+		url  string
+		meta bool
+	}
+	var calls []call
+	repo := charmrepo.WithPolicy(s.repo, func(curl *charm.URL, meta *charm.Meta) error {
+		calls = append(calls, call{curl.String(), meta != nil})
+		if curl.Name == "mysql" {
+			return errVulnerable
+		}
+		return nil
+	})
+
+	ch, err := repo.Get(charm.MustParseURL("local:quantal/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "wordpress")
+
+	_, err = repo.Get(charm.MustParseURL("local:quantal/mysql"))
+	c.Assert(err, gc.ErrorMatches, `charm "local:quantal/mysql-1" denied by policy: vulnerable`)
+	c.Assert(errgo.Cause(err), gc.Equals, errVulnerable)
+
+	url, err := repo.Resolve(charm.MustParseReference("local:quantal/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("local:quantal/wordpress-3"))
+
+	_, err = repo.Resolve(charm.MustParseReference("local:quantal/mysql"))
+	c.Assert(err, gc.ErrorMatches, `charm "local:quantal/mysql-1" denied by policy: vulnerable`)
+
+	c.Assert(calls, jc.DeepEquals, []call{
+		{"local:quantal/wordpress-3", true},
+		{"local:quantal/mysql-1", true},
+		{"local:quantal/wordpress-3", false},
+		{"local:quantal/mysql-1", false},
+	})
+}
+
+func (s *policySuite) TestDenyURLs(c *gc.C) {
+	repo := charmrepo.WithPolicy(s.repo, charmrepo.DenyURLs(
+		charm.MustParseURL("cs:quantal/wordpress-2"),
+		charm.MustParseURL("cs:quantal/mysql"),
+	))
+	_, err := repo.Get(charm.MustParseURL("local:quantal/wordpress"))
+	c.Assert(err, gc.IsNil)
+	_, err = repo.Get(charm.MustParseURL("local:quantal/mysql-1"))
+	c.Assert(err, gc.ErrorMatches, `charm "local:quantal/mysql-1" denied by policy: quantal/mysql is on the deny list`)
+}
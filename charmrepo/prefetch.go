@@ -0,0 +1,125 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// PrefetchProgress reports the retrieval of
+// a charm by Prefetch.
+type PrefetchProgress struct {
+	// Charm holds the charm URL, as used in the bundle.
+	Charm string
+
+	// URL holds the fully resolved URL of the
+	// charm, or nil if it could not be retrieved.
+	URL *charm.URL
+
+	// Err holds the error encountered when retrieving
+	// the charm, if any.
+	Err error
+
+	// Done holds the number of charms processed so far,
+	// including this one, and Total the number of charms
+	// to retrieve.
+	Done, Total int
+}
+
+// PrefetchError holds the errors encountered by Prefetch.
+type PrefetchError struct {
+	// Errors maps the URLs of the charms that could
+	// not be retrieved, as used in the bundle, to the
+	// corresponding errors.
+	Errors map[string]error
+}
+
+// Error implements error.
+func (err *PrefetchError) Error() string {
+	ids := make([]string, 0, len(err.Errors))
+	for id := range err.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = err.Errors[id].Error()
+	}
+	return fmt.Sprintf("cannot prefetch %d of the bundle charms: %s", len(ids), strings.Join(msgs, "; "))
+}
+
+// Prefetch retrieves all the charms used by the given bundle from
+// repo, with up to the given number of retrievals running at the same
+// time, so that the charms are in the repository cache by the time
+// the bundle is deployed. A concurrency of less than one means one.
+// The repository must be safe for concurrent use.
+//
+// Charm URLs with no series are resolved with the series of the
+// bundle, if any, as they are by ResolveAll. If progress is not nil,
+// it is called after each charm is processed; calls are never made
+// concurrently.
+//
+// Prefetch returns the resolved URLs of the charms that were
+// retrieved, keyed by their URLs in the bundle. All the charms are
+// processed even when some fail; the returned error is then a
+// *PrefetchError holding all the errors encountered.
+func Prefetch(bd *charm.BundleData, repo Interface, concurrency int, progress func(PrefetchProgress)) (map[string]*charm.URL, error) {
+	var ids []string
+	for _, id := range bd.RequiredCharms() {
+		if len(ids) == 0 || ids[len(ids)-1] != id {
+			ids = append(ids, id)
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		urls = make(map[string]*charm.URL)
+		errs = make(map[string]error)
+	)
+	idc := make(chan string)
+	for i := 0; i < concurrency && i < len(ids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range idc {
+				url, _, err := getBundleCharm(bd, repo, id)
+				mu.Lock()
+				if err != nil {
+					errs[id] = err
+				} else {
+					urls[id] = url
+				}
+				if progress != nil {
+					progress(PrefetchProgress{
+						Charm: id,
+						URL:   url,
+						Err:   err,
+						Done:  len(urls) + len(errs),
+						Total: len(ids),
+					})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range ids {
+		idc <- id
+	}
+	close(idc)
+	wg.Wait()
+	if len(errs) > 0 {
+		return urls, &PrefetchError{
+			Errors: errs,
+		}
+	}
+	return urls, nil
+}
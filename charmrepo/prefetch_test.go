@@ -0,0 +1,136 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type prefetchSuite struct {
+	repo *concurrencyRepo
+}
+
+var _ = gc.Suite(&prefetchSuite{})
+
+func (s *prefetchSuite) SetUpTest(c *gc.C) {
+	root := c.MkDir()
+	seriesPath := filepath.Join(root, "quantal")
+	c.Assert(os.Mkdir(seriesPath, 0777), gc.IsNil)
+	for _, name := range []string{"wordpress", "mysql", "logging", "varnish"} {
+		TestCharms.ClonedDirPath(seriesPath, name)
+	}
+	s.repo = &concurrencyRepo{
+		Interface: &charmrepo.LocalRepository{Path: root},
+	}
+}
+
+// concurrencyRepo wraps a repository, recording the
+// maximum number of concurrent calls to Get.
+type concurrencyRepo struct {
+	charmrepo.Interface
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (r *concurrencyRepo) Get(curl *charm.URL) (charm.Charm, error) {
+	r.mu.Lock()
+	r.current++
+	if r.current > r.max {
+		r.max = r.current
+	}
+	r.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	defer func() {
+		r.mu.Lock()
+		r.current--
+		r.mu.Unlock()
+	}()
+	return r.Interface.Get(curl)
+}
+
+const prefetchBundle = `
+series: quantal
+services:
+    blog:
+        charm: local:wordpress
+    blog2:
+        charm: local:wordpress
+    db:
+        charm: local:quantal/mysql
+    logging:
+        charm: local:logging
+    cache:
+        charm: local:varnish
+`
+
+func (s *prefetchSuite) TestPrefetch(c *gc.C) {
+	bd := readBundleData(c, prefetchBundle)
+	var progress []charmrepo.PrefetchProgress
+	urls, err := charmrepo.Prefetch(bd, s.repo, 2, func(p charmrepo.PrefetchProgress) {
+		progress = append(progress, p)
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(urls, jc.DeepEquals, map[string]*charm.URL{
+		"local:wordpress":     charm.MustParseURL("local:quantal/wordpress-3"),
+		"local:quantal/mysql": charm.MustParseURL("local:quantal/mysql-1"),
+		"local:logging":       charm.MustParseURL("local:quantal/logging-1"),
+		"local:varnish":       charm.MustParseURL("local:quantal/varnish-1"),
+	})
+	c.Assert(s.repo.max, gc.Equals, 2)
+
+	c.Assert(progress, gc.HasLen, 4)
+	for i, p := range progress {
+		c.Assert(p.Done, gc.Equals, i+1)
+		c.Assert(p.Total, gc.Equals, 4)
+		c.Assert(p.Err, gc.IsNil)
+		c.Assert(p.URL, jc.DeepEquals, urls[p.Charm])
+	}
+}
+
+func (s *prefetchSuite) TestPrefetchSequential(c *gc.C) {
+	bd := readBundleData(c, prefetchBundle)
+	urls, err := charmrepo.Prefetch(bd, s.repo, 0, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(urls, gc.HasLen, 4)
+	c.Assert(s.repo.max, gc.Equals, 1)
+}
+
+func (s *prefetchSuite) TestPrefetchErrors(c *gc.C) {
+	bd := readBundleData(c, `
+series: quantal
+services:
+    blog:
+        charm: local:wordpress
+    db:
+        charm: local:quantal/no-such
+    other:
+        charm: local:quantal/missing
+`)
+	var failed []string
+	urls, err := charmrepo.Prefetch(bd, s.repo, 3, func(p charmrepo.PrefetchProgress) {
+		if p.Err != nil {
+			c.Check(p.URL, gc.IsNil)
+			failed = append(failed, p.Charm)
+		}
+	})
+	c.Assert(err, gc.FitsTypeOf, (*charmrepo.PrefetchError)(nil))
+	c.Assert(err, gc.ErrorMatches, `cannot prefetch 2 of the bundle charms: `+
+		`cannot resolve charm URL local:quantal/missing: .*; `+
+		`cannot resolve charm URL local:quantal/no-such: .*`)
+	c.Assert(err.(*charmrepo.PrefetchError).Errors, gc.HasLen, 2)
+	c.Assert(failed, gc.HasLen, 2)
+	c.Assert(urls, jc.DeepEquals, map[string]*charm.URL{
+		"local:wordpress": charm.MustParseURL("local:quantal/wordpress-3"),
+	})
+}
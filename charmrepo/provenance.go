@@ -0,0 +1,222 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/juju/utils"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charmstore.v4/params"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// ProvenanceLevel describes how much is known about
+// the origin of a charm archive.
+type ProvenanceLevel int
+
+const (
+	// ProvenanceNone means that no hashes document is
+	// required; archives are only checked against the
+	// hash sent along with them.
+	ProvenanceNone ProvenanceLevel = iota
+
+	// ProvenanceDigest means that the archive digests must
+	// match the ones listed in the hashes document.
+	ProvenanceDigest
+
+	// ProvenanceSigned means that, in addition, the hashes
+	// document must be signed by the store.
+	ProvenanceSigned
+
+	// ProvenanceAttested means that, in addition, the hashes
+	// document must hold a build attestation, for instance
+	// a SLSA provenance statement.
+	ProvenanceAttested
+)
+
+var provenanceLevelNames = []string{
+	ProvenanceNone:     "none",
+	ProvenanceDigest:   "digest",
+	ProvenanceSigned:   "signed",
+	ProvenanceAttested: "attested",
+}
+
+// String returns the name of the provenance level.
+func (l ProvenanceLevel) String() string {
+	if l < 0 || int(l) >= len(provenanceLevelNames) {
+		return fmt.Sprintf("ProvenanceLevel(%d)", int(l))
+	}
+	return provenanceLevelNames[l]
+}
+
+// ErrInsufficientProvenance is the cause of the errors returned
+// when a charm archive does not satisfy the required provenance.
+var ErrInsufficientProvenance = errgo.New("insufficient charm provenance")
+
+// HashesFile holds the name of the per-charm hashes document
+// served by the charm store.
+const HashesFile = "hashes.yaml"
+
+// Hashes holds the contents of a hashes document, listing
+// the digests of a charm archive, as published by the store.
+type Hashes struct {
+	// Id holds the fully qualified id of the charm.
+	Id string `yaml:"id"`
+
+	// Digests maps hash algorithm names ("sha256", "sha384")
+	// to the hex-encoded digests of the archive.
+	Digests map[string]string `yaml:"digests"`
+
+	// Signature holds the store signature of the document,
+	// if any. It is checked by the VerifySignature function
+	// given to the repository.
+	Signature string `yaml:"signature,omitempty"`
+
+	// Attestation holds a build attestation for the
+	// archive, such as a SLSA provenance statement.
+	Attestation string `yaml:"attestation,omitempty"`
+}
+
+// hashFuncs holds the hash algorithms that
+// can be listed in a hashes document.
+var hashFuncs = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+}
+
+// ReadHashes parses a hashes document.
+func ReadHashes(r io.Reader) (*Hashes, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var h Hashes
+	if err := yaml.Unmarshal(data, &h); err != nil {
+		return nil, errgo.Notef(err, "cannot parse hashes document")
+	}
+	if h.Id == "" {
+		return nil, errgo.New("hashes document has no id")
+	}
+	if len(h.Digests) == 0 {
+		return nil, errgo.Newf("hashes document for %q has no digests", h.Id)
+	}
+	return &h, nil
+}
+
+// level returns the provenance level provided by the document.
+// verifySignature is used to check the signature, if any.
+func (h *Hashes) level(verifySignature func(*Hashes) error) (ProvenanceLevel, error) {
+	if h.Signature == "" || verifySignature == nil {
+		return ProvenanceDigest, nil
+	}
+	if err := verifySignature(h); err != nil {
+		return ProvenanceNone, errgo.WithCausef(err, ErrInsufficientProvenance, "invalid signature for %q", h.Id)
+	}
+	if h.Attestation == "" {
+		return ProvenanceSigned, nil
+	}
+	return ProvenanceAttested, nil
+}
+
+// Verify checks that the archive at path matches all the digests
+// of known algorithms listed in the document.
+func (h *Hashes) Verify(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hashes := make(map[string]hash.Hash)
+	writers := []io.Writer{}
+	for name := range h.Digests {
+		if newHash, ok := hashFuncs[name]; ok {
+			hashes[name] = newHash()
+			writers = append(writers, hashes[name])
+		}
+	}
+	if len(hashes) == 0 {
+		return errgo.WithCausef(nil, ErrInsufficientProvenance, "no supported digests for %q", h.Id)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return errgo.Notef(err, "cannot read charm archive")
+	}
+	for name, hash := range hashes {
+		if fmt.Sprintf("%x", hash.Sum(nil)) != h.Digests[name] {
+			return errgo.WithCausef(nil, ErrInsufficientProvenance, "%s digest mismatch for %q", name, h.Id)
+		}
+	}
+	return nil
+}
+
+// hashes returns the hashes document of the charm with the given id.
+// The document is retrieved from the charm store unless it is found
+// in the cache directory.
+func (s *CharmStoreV5) hashes(ctx context.Context, dir string, id *charm.URL) (*Hashes, error) {
+	path := s.env.entryPath(dir, id, "."+HashesFile)
+	if f, err := os.Open(path); err == nil {
+		h, err := ReadHashes(f)
+		f.Close()
+		if err == nil && h.Id == id.String() {
+			return h, nil
+		}
+	}
+	resp, err := s.do(ctx, s.endpoint(entityPath(id.Reference())+"/"+HashesFile, nil), nil)
+	if err != nil {
+		if errgo.Cause(err) == params.ErrNotFound {
+			return nil, errgo.WithCausef(nil, ErrInsufficientProvenance, "no hashes document for %q", id)
+		}
+		return nil, errgo.NoteMask(err, fmt.Sprintf("cannot retrieve hashes document for %q", id), errgo.Any)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read hashes document")
+	}
+	h, err := ReadHashes(bytes.NewReader(data))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if h.Id != id.String() {
+		return nil, errgo.Newf("hashes document for %q returned for %q", h.Id, id)
+	}
+	if err := utils.AtomicWriteFile(path, data, 0644); err != nil {
+		return nil, errgo.Notef(err, "cannot cache hashes document")
+	}
+	return h, nil
+}
+
+// checkProvenance checks that the archive at path, holding the
+// charm with the given id, satisfies the provenance level required
+// by the repository.
+func (s *CharmStoreV5) checkProvenance(ctx context.Context, dir string, id *charm.URL, path string) error {
+	if s.provenance <= ProvenanceNone {
+		return nil
+	}
+	h, err := s.hashes(ctx, dir, id)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	level, err := h.level(s.verifySignature)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	if level < s.provenance {
+		return errgo.WithCausef(nil, ErrInsufficientProvenance, "charm %q has provenance %v, %v required", id, level, s.provenance)
+	}
+	if err := h.Verify(path); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	return nil
+}
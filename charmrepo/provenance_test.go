@@ -0,0 +1,106 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type provenanceSuite struct{}
+
+var _ = gc.Suite(&provenanceSuite{})
+
+func (s *provenanceSuite) TestProvenanceLevelString(c *gc.C) {
+	c.Assert(charmrepo.ProvenanceNone.String(), gc.Equals, "none")
+	c.Assert(charmrepo.ProvenanceDigest.String(), gc.Equals, "digest")
+	c.Assert(charmrepo.ProvenanceSigned.String(), gc.Equals, "signed")
+	c.Assert(charmrepo.ProvenanceAttested.String(), gc.Equals, "attested")
+	c.Assert(charmrepo.ProvenanceLevel(42).String(), gc.Equals, "ProvenanceLevel(42)")
+}
+
+var readHashesTests = []struct {
+	about  string
+	doc    string
+	expect *charmrepo.Hashes
+	err    string
+}{{
+	about: "full document",
+	doc: `
+id: cs:trusty/mysql-3
+digests:
+    sha256: abc
+    sha384: def
+signature: sig
+attestation: att
+`,
+	expect: &charmrepo.Hashes{
+		Id: "cs:trusty/mysql-3",
+		Digests: map[string]string{
+			"sha256": "abc",
+			"sha384": "def",
+		},
+		Signature:   "sig",
+		Attestation: "att",
+	},
+}, {
+	about: "no id",
+	doc:   "digests: {sha256: abc}",
+	err:   "hashes document has no id",
+}, {
+	about: "no digests",
+	doc:   "id: cs:trusty/mysql-3",
+	err:   `hashes document for "cs:trusty/mysql-3" has no digests`,
+}, {
+	about: "invalid yaml",
+	doc:   "id: [",
+	err:   "cannot parse hashes document: .*",
+}}
+
+func (s *provenanceSuite) TestReadHashes(c *gc.C) {
+	for i, test := range readHashesTests {
+		c.Logf("test %d: %s", i, test.about)
+		h, err := charmrepo.ReadHashes(strings.NewReader(test.doc))
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(h, jc.DeepEquals, test.expect)
+	}
+}
+
+func (s *provenanceSuite) TestVerify(c *gc.C) {
+	data := []byte("archive contents")
+	path := filepath.Join(c.MkDir(), "archive")
+	err := ioutil.WriteFile(path, data, 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	h := &charmrepo.Hashes{
+		Id: "cs:trusty/mysql-3",
+		Digests: map[string]string{
+			"sha256": fmt.Sprintf("%x", sha256.Sum256(data)),
+			"md4":    "ignored",
+		},
+	}
+	c.Assert(h.Verify(path), jc.ErrorIsNil)
+
+	h.Digests["sha256"] = "bad"
+	err = h.Verify(path)
+	c.Assert(err, gc.ErrorMatches, `sha256 digest mismatch for "cs:trusty/mysql-3"`)
+	c.Assert(errgo.Cause(err), gc.Equals, charmrepo.ErrInsufficientProvenance)
+
+	h.Digests = map[string]string{"md4": "unknown"}
+	err = h.Verify(path)
+	c.Assert(err, gc.ErrorMatches, `no supported digests for "cs:trusty/mysql-3"`)
+}
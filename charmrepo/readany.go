@@ -0,0 +1,155 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// SourceKind describes where an entity read by ReadAny came from.
+type SourceKind string
+
+const (
+	// SourceDir is the kind of entities read from a
+	// charm or bundle directory.
+	SourceDir SourceKind = "directory"
+
+	// SourceArchive is the kind of entities read from a
+	// charm or bundle archive file.
+	SourceArchive SourceKind = "archive"
+
+	// SourceRepository is the kind of entities
+	// retrieved from a repository.
+	SourceRepository SourceKind = "repository"
+)
+
+// Entity holds a charm or a bundle read by ReadAny,
+// along with its provenance.
+type Entity struct {
+	// Charm holds the charm read, if the entity is a charm.
+	Charm charm.Charm
+
+	// Bundle holds the bundle read, if the entity is a bundle.
+	Bundle charm.Bundle
+
+	// Kind holds where the entity came from.
+	Kind SourceKind
+
+	// Path holds the absolute path of the directory or archive
+	// the entity was read from. It is empty for entities
+	// retrieved from a repository.
+	Path string
+
+	// URL holds the fully resolved URL of the entity in the
+	// repository. It is nil for entities read from a path.
+	URL *charm.URL
+}
+
+// bundleGetter is implemented by repositories
+// that can retrieve bundles.
+type bundleGetter interface {
+	GetBundle(curl *charm.URL) (charm.Bundle, error)
+}
+
+// ReadAny reads the charm or bundle designated by input, which may
+// be the path of a charm or bundle directory, the path of a charm or
+// bundle archive, or a reference to an entity in repo, such as
+// "cs:trusty/wordpress" or "local:precise/mysql". Paths take
+// precedence over references, so that a charm directory named after a
+// charm in the store is read from disk. The repository may be nil if
+// only paths are to be accepted.
+func ReadAny(input string, repo Interface) (*Entity, error) {
+	info, err := os.Stat(input)
+	if err == nil {
+		return readPath(input, info)
+	}
+	if !os.IsNotExist(err) {
+		return nil, errgo.Mask(err)
+	}
+	ref, refErr := charm.ParseReference(input)
+	if refErr != nil {
+		if strings.ContainsRune(input, os.PathSeparator) || strings.HasPrefix(input, ".") {
+			return nil, errgo.Notef(err, "cannot read %q", input)
+		}
+		return nil, errgo.Notef(refErr, "%q is neither a path nor a valid reference", input)
+	}
+	if repo == nil {
+		return nil, errgo.Newf("cannot read %q: no such file or directory and no repository given", input)
+	}
+	curl, err := repo.Resolve(ref)
+	if err != nil {
+		return nil, errgo.NoteMask(err, "cannot resolve "+ref.String(), errgo.Any)
+	}
+	e := &Entity{
+		Kind: SourceRepository,
+		URL:  curl,
+	}
+	if curl.Series == "bundle" {
+		getter, ok := repo.(bundleGetter)
+		if !ok {
+			return nil, errgo.Newf("cannot read %q: repository does not hold bundles", curl)
+		}
+		if e.Bundle, err = getter.GetBundle(curl); err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		return e, nil
+	}
+	if e.Charm, err = repo.Get(curl); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return e, nil
+}
+
+// readPath reads the charm or bundle at the given path,
+// which has the given file information.
+func readPath(path string, info os.FileInfo) (*Entity, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	e := &Entity{
+		Kind: SourceArchive,
+		Path: path,
+	}
+	var isBundle bool
+	if info.IsDir() {
+		e.Kind = SourceDir
+		_, err := os.Stat(filepath.Join(path, charm.BundleFile))
+		isBundle = err == nil
+	} else if isBundle, err = isBundleArchive(path); err != nil {
+		return nil, errgo.Notef(err, "cannot read %q", path)
+	}
+	if isBundle {
+		e.Bundle, err = charm.ReadBundle(path)
+	} else {
+		e.Charm, err = charm.ReadCharm(path)
+	}
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return e, nil
+}
+
+// isBundleArchive reports whether the zip archive
+// at path holds a bundle rather than a charm.
+func isBundleArchive(path string) (bool, error) {
+	zipr, err := zip.OpenReader(path)
+	if err != nil {
+		return false, err
+	}
+	defer zipr.Close()
+	for _, f := range zipr.File {
+		if f.Name == charm.BundleFile {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type readAnySuite struct{}
+
+var _ = gc.Suite(&readAnySuite{})
+
+func (s *readAnySuite) TestCharmDir(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	e, err := charmrepo.ReadAny(path, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(e.Kind, gc.Equals, charmrepo.SourceDir)
+	c.Assert(e.Path, gc.Equals, path)
+	c.Assert(e.URL, gc.IsNil)
+	c.Assert(e.Bundle, gc.IsNil)
+	c.Assert(e.Charm, gc.FitsTypeOf, (*charm.CharmDir)(nil))
+	c.Assert(e.Charm.Meta().Name, gc.Equals, "dummy")
+}
+
+func (s *readAnySuite) TestCharmArchive(c *gc.C) {
+	path := TestCharms.CharmArchivePath(c.MkDir(), "dummy")
+	e, err := charmrepo.ReadAny(path, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(e.Kind, gc.Equals, charmrepo.SourceArchive)
+	c.Assert(e.Path, gc.Equals, path)
+	c.Assert(e.Charm, gc.FitsTypeOf, (*charm.CharmArchive)(nil))
+	c.Assert(e.Charm.Meta().Name, gc.Equals, "dummy")
+}
+
+func (s *readAnySuite) TestBundleDir(c *gc.C) {
+	path := TestCharms.ClonedBundleDirPath(c.MkDir(), "wordpress-simple")
+	e, err := charmrepo.ReadAny(path, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(e.Kind, gc.Equals, charmrepo.SourceDir)
+	c.Assert(e.Charm, gc.IsNil)
+	c.Assert(e.Bundle, gc.FitsTypeOf, (*charm.BundleDir)(nil))
+	c.Assert(e.Bundle.Data().Services, jc.DeepEquals, TestCharms.BundleDir("wordpress-simple").Data().Services)
+}
+
+func (s *readAnySuite) TestBundleArchive(c *gc.C) {
+	path := TestCharms.BundleArchivePath(c.MkDir(), "wordpress-simple")
+	e, err := charmrepo.ReadAny(path, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(e.Kind, gc.Equals, charmrepo.SourceArchive)
+	c.Assert(e.Charm, gc.IsNil)
+	c.Assert(e.Bundle, gc.FitsTypeOf, (*charm.BundleArchive)(nil))
+}
+
+func (s *readAnySuite) TestRelativePath(c *gc.C) {
+	dir := c.MkDir()
+	TestCharms.ClonedDirPath(dir, "dummy")
+	cwd, err := os.Getwd()
+	c.Assert(err, jc.ErrorIsNil)
+	defer os.Chdir(cwd)
+	err = os.Chdir(dir)
+	c.Assert(err, jc.ErrorIsNil)
+
+	// The directory takes precedence over the charm
+	// of the same name in the repository.
+	e, err := charmrepo.ReadAny("dummy", &charmrepo.LocalRepository{Path: c.MkDir()})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(e.Kind, gc.Equals, charmrepo.SourceDir)
+	c.Assert(e.Path, gc.Equals, filepath.Join(dir, "dummy"))
+}
+
+func (s *readAnySuite) TestRepository(c *gc.C) {
+	root := c.MkDir()
+	seriesPath := filepath.Join(root, "quantal")
+	err := os.Mkdir(seriesPath, 0777)
+	c.Assert(err, jc.ErrorIsNil)
+	TestCharms.ClonedDirPath(seriesPath, "dummy")
+	repo := &charmrepo.LocalRepository{Path: root}
+
+	e, err := charmrepo.ReadAny("local:quantal/dummy", repo)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(e.Kind, gc.Equals, charmrepo.SourceRepository)
+	c.Assert(e.Path, gc.Equals, "")
+	c.Assert(e.URL, jc.DeepEquals, charm.MustParseURL("local:quantal/dummy-1"))
+	c.Assert(e.Charm.Meta().Name, gc.Equals, "dummy")
+
+	_, err = charmrepo.ReadAny("local:quantal/missing", repo)
+	c.Assert(err, gc.ErrorMatches, `cannot resolve local:quantal/missing: charm not found in ".*": local:quantal/missing`)
+
+	_, err = charmrepo.ReadAny("local:bundle/wordpress-simple", repo)
+	c.Assert(err, gc.ErrorMatches, `cannot resolve local:bundle/wordpress-simple: .*`)
+}
+
+func (s *readAnySuite) TestErrors(c *gc.C) {
+	_, err := charmrepo.ReadAny("cs:trusty/wordpress", nil)
+	c.Assert(err, gc.ErrorMatches, `cannot read "cs:trusty/wordpress": no such file or directory and no repository given`)
+
+	_, err = charmrepo.ReadAny(filepath.Join(c.MkDir(), "missing"), nil)
+	c.Assert(err, gc.ErrorMatches, `cannot read ".*missing": stat .*missing: no such file or directory`)
+
+	_, err = charmrepo.ReadAny("Not A Charm", nil)
+	c.Assert(err, gc.ErrorMatches, `"Not A Charm" is neither a path nor a valid reference: .*`)
+}
@@ -0,0 +1,262 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// revisionCacheFile holds the name of the file, in the charm cache
+// directory, where the legacy charm store revision index is stored.
+const revisionCacheFile = "revisions.json"
+
+// timeNow is replaced in tests. It is used by WallClock.
+var timeNow = time.Now
+
+// unreachableError is returned when a store cannot be reached, as
+// opposed to the store returning an error. Only such errors cause
+// the revisions recorded in the revision cache to be used instead.
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return e.err.Error()
+}
+
+// isUnreachable reports whether the cause of err
+// is an *unreachableError.
+func isUnreachable(err error) bool {
+	_, ok := errgo.Cause(err).(*unreachableError)
+	return ok
+}
+
+// revisionCacheEntry holds the revision and digest of a charm,
+// along with the time they were retrieved from the store.
+type revisionCacheEntry struct {
+	Revision int       `json:"revision"`
+	Sha256   string    `json:"sha256"`
+	Time     time.Time `json:"time"`
+}
+
+// revisionCacheLocks holds the locks serializing the accesses to the
+// revision cache files, keyed by cache directory, so that stores
+// using different cache directories do not wait for each other.
+var revisionCacheLocks = struct {
+	sync.Mutex
+	dirs map[string]*sync.Mutex
+}{
+	dirs: make(map[string]*sync.Mutex),
+}
+
+// revisionCacheLock returns the lock serializing the
+// accesses to the revision cache file in dir.
+func revisionCacheLock(dir string) *sync.Mutex {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	revisionCacheLocks.Lock()
+	defer revisionCacheLocks.Unlock()
+	mu := revisionCacheLocks.dirs[dir]
+	if mu == nil {
+		mu = new(sync.Mutex)
+		revisionCacheLocks.dirs[dir] = mu
+	}
+	return mu
+}
+
+// readRevisionCache reads the revision index stored in the given
+// directory. A missing or corrupted index is treated as empty.
+func (env cacheEnv) readRevisionCache(dir string) map[string]revisionCacheEntry {
+	entries := make(map[string]revisionCacheEntry)
+	data, err := env.fs.ReadFile(filepath.Join(dir, revisionCacheFile))
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logger.Warningf("ignoring invalid revision cache: %v", err)
+		return make(map[string]revisionCacheEntry)
+	}
+	return entries
+}
+
+// writeRevisionCache stores the revision index in the given directory.
+func (env cacheEnv) writeRevisionCache(dir string, entries map[string]revisionCacheEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := env.fs.MkdirAll(dir, 0755); err != nil {
+		return errgo.Notef(err, "cannot create the cache directory")
+	}
+	if err := env.fs.WriteFile(filepath.Join(dir, revisionCacheFile), data, 0644); err != nil {
+		return errgo.Notef(err, "cannot write revision cache")
+	}
+	return nil
+}
+
+// cachedRevisions returns the revisions of the charms referenced by
+// curls. When s.RevisionCacheTTL is positive, the revisions that were
+// retrieved from the store more recently than that are taken from the
+// on-disk index, and only the others are retrieved from the store.
+// When s.StaleIfError is set, the revisions retrieved are recorded in
+// the index, and the recorded revisions are returned, flagged as
+// stale, when the store cannot be reached. Errors returned by the
+// store, such as authorization failures, are returned as such.
+func (s *LegacyCharmStore) cachedRevisions(curls ...charm.Location) ([]CharmRevision, error) {
+	dir := cacheDir(s.CacheDir)
+	if (s.RevisionCacheTTL <= 0 && !s.StaleIfError) || dir == "" {
+		return s.revisions(curls...)
+	}
+	env := s.cacheEnv()
+	mu := revisionCacheLock(dir)
+	mu.Lock()
+	entries := env.readRevisionCache(dir)
+	mu.Unlock()
+
+	now := env.clock.Now()
+	revisions := make([]CharmRevision, len(curls))
+	var missing []charm.Location
+	var missingIndexes []int
+	for i, curl := range curls {
+		entry, ok := entries[s.revisionCacheKey(curl)]
+		if ok && s.RevisionCacheTTL > 0 && now.Sub(entry.Time) < s.RevisionCacheTTL {
+			revisions[i] = CharmRevision{
+				Revision: entry.Revision,
+				Sha256:   entry.Sha256,
+			}
+			continue
+		}
+		missing = append(missing, curl)
+		missingIndexes = append(missingIndexes, i)
+	}
+	if len(missing) == 0 {
+		return revisions, nil
+	}
+	fetched, err := s.refresh(dir, missing...)
+	if err != nil {
+		if !s.StaleIfError || !isUnreachable(err) {
+			return nil, err
+		}
+		var ok bool
+		if fetched, ok = env.staleRevisions(dir, s.revisionCacheKeys(missing), err); !ok {
+			return nil, err
+		}
+	}
+	for i, rev := range fetched {
+		revisions[missingIndexes[i]] = rev
+	}
+	return revisions, nil
+}
+
+// Refresh retrieves the revisions of the charms referenced by curls
+// from the store, bypassing the revision cache, and stores them in
+// the cache.
+func (s *LegacyCharmStore) Refresh(curls ...*charm.URL) ([]CharmRevision, error) {
+	locations := make([]charm.Location, len(curls))
+	for i, curl := range curls {
+		locations[i] = curl
+	}
+	dir := cacheDir(s.CacheDir)
+	if (s.RevisionCacheTTL <= 0 && !s.StaleIfError) || dir == "" {
+		return s.revisions(locations...)
+	}
+	return s.refresh(dir, locations...)
+}
+
+// refresh retrieves the revisions of the charms referenced by curls
+// from the store and records them in the revision cache in dir.
+func (s *LegacyCharmStore) refresh(dir string, curls ...charm.Location) ([]CharmRevision, error) {
+	revisions, err := s.revisions(curls...)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheEnv().recordRevisions(dir, s.revisionCacheKeys(curls), revisions)
+	return revisions, nil
+}
+
+// revisionCacheKey returns the key under which the revision of the
+// charm referenced by curl is recorded in the revision cache. As
+// stores with different base URLs may share a cache directory, the
+// key includes the base URL.
+func (s *LegacyCharmStore) revisionCacheKey(curl charm.Location) string {
+	return s.BaseURL + " " + curl.String()
+}
+
+// revisionCacheKeys returns the keys of the given
+// charms, as returned by revisionCacheKey.
+func (s *LegacyCharmStore) revisionCacheKeys(curls []charm.Location) []string {
+	keys := make([]string, len(curls))
+	for i, curl := range curls {
+		keys[i] = s.revisionCacheKey(curl)
+	}
+	return keys
+}
+
+// recordRevisions records in the revision cache in dir the given
+// revisions, retrieved from the store for the entities with the
+// given cache keys. The entries of the entities whose revisions could
+// not be retrieved are removed. A failure to update the cache is
+// logged rather than returned.
+func (env cacheEnv) recordRevisions(dir string, keys []string, revisions []CharmRevision) {
+	mu := revisionCacheLock(dir)
+	mu.Lock()
+	defer mu.Unlock()
+	entries := env.readRevisionCache(dir)
+	now := env.clock.Now()
+	for i, rev := range revisions {
+		if rev.Err != nil {
+			delete(entries, keys[i])
+			continue
+		}
+		entries[keys[i]] = revisionCacheEntry{
+			Revision: rev.Revision,
+			Sha256:   rev.Sha256,
+			Time:     now,
+		}
+	}
+	if err := env.writeRevisionCache(dir, entries); err != nil {
+		logger.Warningf("cannot update revision cache: %v", err)
+	}
+}
+
+// staleRevisions returns the revisions held in the revision cache in
+// dir for the entities with the given cache keys, flagged as stale,
+// for use when the store cannot be reached. The revisions of the
+// entities that are not cached hold the given error, which was
+// returned when contacting the store. It returns false if none of
+// the entities is cached.
+func (env cacheEnv) staleRevisions(dir string, keys []string, storeErr error) ([]CharmRevision, bool) {
+	mu := revisionCacheLock(dir)
+	mu.Lock()
+	entries := env.readRevisionCache(dir)
+	mu.Unlock()
+	revisions := make([]CharmRevision, len(keys))
+	found := false
+	for i, key := range keys {
+		entry, ok := entries[key]
+		if !ok {
+			revisions[i] = CharmRevision{Err: storeErr}
+			continue
+		}
+		revisions[i] = CharmRevision{
+			Revision: entry.Revision,
+			Sha256:   entry.Sha256,
+			Stale:    true,
+		}
+		found = true
+	}
+	if !found {
+		return nil, false
+	}
+	logger.Warningf("using cached revisions: %v", storeErr)
+	return revisions, true
+}
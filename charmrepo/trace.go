@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceParentHeader is the W3C Trace Context header used to propagate
+// the current span to the charm store.
+const TraceParentHeader = "Traceparent"
+
+// SpanContext identifies a span within a distributed trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both the trace and span ids are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent returns the value of the W3C traceparent header
+// identifying the span.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", sc.TraceID[:], sc.SpanID[:], flags)
+}
+
+// ParseTraceParent parses the value of a W3C traceparent header.
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	sc.Sampled = flags[0]&1 != 0
+	return sc, nil
+}
+
+// Span represents a traced operation.
+type Span interface {
+	// SpanContext returns the identity of the span.
+	SpanContext() SpanContext
+
+	// End completes the span. If err is not nil, the
+	// operation is recorded as having failed.
+	End(err error)
+}
+
+// Tracer is implemented by tracing systems, for instance
+// by an adapter to an OpenTelemetry tracer.
+type Tracer interface {
+	// Start starts a span with the given name as a child of the
+	// given parent span, which is the span of the caller held by
+	// ctx, as added by ContextWithSpan. The parent is not valid
+	// when the caller has no span, in which case a new trace is
+	// started.
+	Start(ctx context.Context, name string, parent SpanContext) Span
+}
+
+// Names of the spans started by the charm store repositories.
+const (
+	SpanInfo     = "charmrepo.info"
+	SpanDownload = "charmrepo.download"
+	SpanVerify   = "charmrepo.verify"
+)
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx holding the given span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span held by ctx,
+// or nil if there is none.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// startSpan starts a span with the given name using tracer, as a
+// child of the span held by ctx, if any. It returns the new span and
+// a context holding it. If tracer is nil, no span is started and the
+// returned span is nil; spans already held by ctx are still
+// propagated to the store.
+func startSpan(ctx context.Context, tracer Tracer, name string) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tracer == nil {
+		return ctx, nil
+	}
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.SpanContext()
+	}
+	span := tracer.Start(ctx, name, parent)
+	return ContextWithSpan(ctx, span), span
+}
+
+// endSpan ends the given span, if it is not nil.
+func endSpan(span Span, err error) {
+	if span != nil {
+		span.End(err)
+	}
+}
+
+// setTraceParent sets the traceparent field of header
+// from the span held by ctx, if any.
+func setTraceParent(ctx context.Context, header http.Header) {
+	if span := SpanFromContext(ctx); span != nil {
+		if sc := span.SpanContext(); sc.IsValid() {
+			header.Set(TraceParentHeader, sc.TraceParent())
+		}
+	}
+}
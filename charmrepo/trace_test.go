@@ -0,0 +1,127 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"context"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type traceSuite struct{}
+
+var _ = gc.Suite(&traceSuite{})
+
+var parseTraceParentTests = []struct {
+	about  string
+	value  string
+	expect charmrepo.SpanContext
+	err    string
+}{{
+	about: "sampled",
+	value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	expect: charmrepo.SpanContext{
+		TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Sampled: true,
+	},
+}, {
+	about: "not sampled",
+	value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+	expect: charmrepo.SpanContext{
+		TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	},
+}, {
+	about: "unknown version",
+	value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	err:   `invalid traceparent ".*"`,
+}, {
+	about: "bad trace id",
+	value: "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	err:   `invalid traceparent ".*"`,
+}, {
+	about: "zero span id",
+	value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	err:   `invalid traceparent ".*"`,
+}, {
+	about: "missing fields",
+	value: "00-4bf92f3577b34da6a3ce929d0e0e4736",
+	err:   `invalid traceparent ".*"`,
+}}
+
+func (s *traceSuite) TestParseTraceParent(c *gc.C) {
+	for i, test := range parseTraceParentTests {
+		c.Logf("test %d: %s", i, test.about)
+		sc, err := charmrepo.ParseTraceParent(test.value)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(sc, jc.DeepEquals, test.expect)
+		c.Assert(sc.TraceParent(), gc.Equals, test.value)
+	}
+}
+
+func (s *traceSuite) TestContextWithSpan(c *gc.C) {
+	ctx := context.Background()
+	c.Assert(charmrepo.SpanFromContext(ctx), gc.IsNil)
+	span := &fakeSpan{name: "test"}
+	ctx = charmrepo.ContextWithSpan(ctx, span)
+	c.Assert(charmrepo.SpanFromContext(ctx), gc.Equals, span)
+}
+
+// fakeSpan implements charmrepo.Span.
+type fakeSpan struct {
+	name   string
+	sc     charmrepo.SpanContext
+	parent *fakeSpan
+	ended  bool
+	err    error
+}
+
+func (s *fakeSpan) SpanContext() charmrepo.SpanContext {
+	return s.sc
+}
+
+func (s *fakeSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+// fakeTracer implements charmrepo.Tracer by recording
+// the started spans.
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) Start(ctx context.Context, name string, parent charmrepo.SpanContext) charmrepo.Span {
+	span := &fakeSpan{
+		name: name,
+		sc: charmrepo.SpanContext{
+			TraceID: [16]byte{1},
+			SpanID:  [8]byte{byte(len(t.spans) + 1)},
+			Sampled: true,
+		},
+	}
+	for _, s := range t.spans {
+		if parent.IsValid() && s.sc == parent {
+			span.parent = s
+			span.sc.TraceID = parent.TraceID
+		}
+	}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+// start starts a span with no parent and returns
+// it along with a context holding it.
+func (t *fakeTracer) start(name string) (context.Context, *fakeSpan) {
+	span := t.Start(context.Background(), name, charmrepo.SpanContext{})
+	return charmrepo.ContextWithSpan(context.Background(), span), span.(*fakeSpan)
+}
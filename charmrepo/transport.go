@@ -0,0 +1,76 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo
+
+import (
+	"net/http"
+)
+
+// Doer is the interface used by the charm store repositories to send
+// HTTP requests. It is implemented by *http.Client, and may be
+// implemented by other types, for instance to record and replay
+// interactions with a charm store in tests, or to decorate all the
+// requests sent to a charm store.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc is a function that implements Doer.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do implements Doer.Do by calling f.
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithHeader returns a Doer that adds the given header fields to
+// every request before sending it with d. Existing values of
+// the same fields in a request are replaced.
+func WithHeader(d Doer, header http.Header) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		req = withHeader(req, header)
+		return d.Do(req)
+	})
+}
+
+// withHeader returns a shallow copy of req with the given header
+// fields set. The original request is left untouched, as required
+// by http.RoundTripper.
+func withHeader(req *http.Request, header http.Header) *http.Request {
+	req1 := new(http.Request)
+	*req1 = *req
+	req1.Header = make(http.Header, len(req.Header)+len(header))
+	for key, values := range req.Header {
+		req1.Header[key] = values
+	}
+	for key, values := range header {
+		req1.Header[key] = values
+	}
+	return req1
+}
+
+// httpClient returns an *http.Client sending all its requests
+// with the given Doer, for use by APIs that require one.
+// If d is nil, the given default client is returned.
+func httpClient(d Doer, defaultClient *http.Client) *http.Client {
+	switch d := d.(type) {
+	case nil:
+		return defaultClient
+	case *http.Client:
+		return d
+	}
+	return &http.Client{
+		Transport: doerTransport{d},
+	}
+}
+
+// doerTransport implements http.RoundTripper by using a Doer.
+type doerTransport struct {
+	doer Doer
+}
+
+// RoundTrip implements http.RoundTripper.RoundTrip.
+func (t doerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.doer.Do(req)
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charmrepo_test
+
+import (
+	"net/http"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5/charmrepo"
+)
+
+type transportSuite struct{}
+
+var _ = gc.Suite(&transportSuite{})
+
+func (s *transportSuite) TestWithHeader(c *gc.C) {
+	var got http.Header
+	d := charmrepo.WithHeader(charmrepo.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		got = req.Header
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}), http.Header{
+		"User-Agent": {"charm-test/1.0"},
+		"X-Trace":    {"abc"},
+	})
+	req, err := http.NewRequest("GET", "http://0.1.2.3/v5/meta/any", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	req.Header.Set("User-Agent", "other")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := d.Do(req)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	c.Assert(got, jc.DeepEquals, http.Header{
+		"User-Agent": {"charm-test/1.0"},
+		"X-Trace":    {"abc"},
+		"Accept":     {"application/json"},
+	})
+
+	// The original request is left untouched.
+	c.Assert(req.Header, jc.DeepEquals, http.Header{
+		"User-Agent": {"other"},
+		"Accept":     {"application/json"},
+	})
+}
@@ -6,7 +6,6 @@ package charm
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strconv"
 
 	"github.com/juju/schema"
@@ -20,16 +19,16 @@ type Settings map[string]interface{}
 
 // Option represents a single charm config option.
 type Option struct {
-	Type        string      `yaml:"type"`
-	Description string      `yaml:"description,omitempty"`
-	Default     interface{} `yaml:"default,omitempty"`
+	Type        string      `yaml:"type" json:"type"`
+	Description string      `yaml:"description,omitempty" json:"description,omitempty"`
+	Default     interface{} `yaml:"default,omitempty" json:"default,omitempty"`
 }
 
 // error replaces any supplied non-nil error with a new error describing a
 // validation failure for the supplied value.
 func (option Option) error(err *error, name string, value interface{}) {
 	if *err != nil {
-		*err = fmt.Errorf("option %q expected %s, got %#v", name, option.Type, value)
+		*err = errorCodef(CodeInvalidOptionValue, "option %q expected %s, got %#v", name, option.Type, value)
 	}
 }
 
@@ -78,58 +77,79 @@ func (option Option) parse(name, str string) (_ interface{}, err error) {
 // as declared in its config.yaml file.
 type Config struct {
 	Options map[string]Option
+
+	// Extensions holds any vendor extension fields found
+	// in the config, keyed by their name, which
+	// starts with ExtensionPrefix.
+	Extensions map[string]interface{} `yaml:"-"`
+
+	// Warnings holds any warnings found when reading
+	// the config, such as options with no type.
+	Warnings []Warning `bson:"-" json:"-" yaml:"-"`
 }
 
 // NewConfig returns a new Config without any options.
 func NewConfig() *Config {
-	return &Config{map[string]Option{}}
+	return &Config{Options: map[string]Option{}}
+}
+
+// GetYAML implements yaml.Getter.GetYAML.
+func (c Config) GetYAML() (tag string, value interface{}) {
+	return "", withExtensions(struct {
+		Options map[string]Option `yaml:"options"`
+	}{c.Options}, c.Extensions)
 }
 
 // ReadConfig reads a Config in YAML format.
 func ReadConfig(r io.Reader) (*Config, error) {
-	data, err := ioutil.ReadAll(r)
+	data, err := readDocument(r, ConfigFile, MaxDocumentSize)
 	if err != nil {
 		return nil, err
 	}
 	var config *Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, err
+		return nil, withCode(CodeInvalidConfig, err)
 	}
 	if config == nil {
-		return nil, fmt.Errorf("invalid config: empty configuration")
+		return nil, errorCodef(CodeInvalidConfig, "invalid config: empty configuration")
 	}
+	// The raw fields are needed to find any extension fields and
+	// to check whether the options field was explicitly specified.
+	var configInterface interface{}
+	if err := yaml.Unmarshal(data, &configInterface); err != nil {
+		return nil, withCode(CodeInvalidConfig, err)
+	}
+	m, _ := configInterface.(map[interface{}]interface{})
 	if config.Options == nil {
 		// We are allowed an empty configuration if the options
-		// field is explicitly specified, but there is no easy way
-		// to tell if it was specified or not without unmarshaling
-		// into interface{} and explicitly checking the field.
-		var configInterface interface{}
-		if err := yaml.Unmarshal(data, &configInterface); err != nil {
-			return nil, err
-		}
-		m, _ := configInterface.(map[interface{}]interface{})
+		// field is explicitly specified.
 		if _, ok := m["options"]; !ok {
-			return nil, fmt.Errorf("invalid config: empty configuration")
+			return nil, errorCodef(CodeInvalidConfig, "invalid config: empty configuration")
 		}
 	}
+	if config.Extensions, err = readExtensions(m); err != nil {
+		return nil, errorCodef(CodeInvalidConfig, "invalid config: %v", err)
+	}
 	for name, option := range config.Options {
 		switch option.Type {
 		case "string", "int", "float", "boolean":
 		case "":
 			// Missing type is valid in python.
 			option.Type = "string"
+			config.Warnings = append(config.Warnings, warningf(CodeImplicitType, "config option %q has no type; assuming %q", name, option.Type))
 		default:
-			return nil, fmt.Errorf("invalid config: option %q has unknown type %q", name, option.Type)
+			return nil, errorCodef(CodeInvalidOptionType, "invalid config: option %q has unknown type %q", name, option.Type)
 		}
 		def := option.Default
 		if def == "" && option.Type == "string" {
 			// Skip normal validation for compatibility with pyjuju.
 		} else if option.Default, err = option.validate(name, def); err != nil {
 			option.error(&err, name, def)
-			return nil, fmt.Errorf("invalid config default: %v", err)
+			return nil, annotateCodef(CodeInvalidOptionValue, err, "invalid config default: %v", err)
 		}
 		config.Options[name] = option
 	}
+	sortWarnings(config.Warnings)
 	return config, nil
 }
 
@@ -139,7 +159,7 @@ func (c *Config) option(name string) (Option, error) {
 	if option, ok := c.Options[name]; ok {
 		return option, nil
 	}
-	return Option{}, fmt.Errorf("unknown option %q", name)
+	return Option{}, errorCodef(CodeUnknownOption, "unknown option %q", name)
 }
 
 // DefaultSettings returns settings containing the default value of every
@@ -208,11 +228,11 @@ func (c *Config) ParseSettingsStrings(values map[string]string) (Settings, error
 func (c *Config) ParseSettingsYAML(yamlData []byte, key string) (Settings, error) {
 	var allSettings map[string]Settings
 	if err := yaml.Unmarshal(yamlData, &allSettings); err != nil {
-		return nil, fmt.Errorf("cannot parse settings data: %v", err)
+		return nil, errorCodef(CodeInvalidSettings, "cannot parse settings data: %v", err)
 	}
 	settings, ok := allSettings[key]
 	if !ok {
-		return nil, fmt.Errorf("no settings found for %q", key)
+		return nil, errorCodef(CodeInvalidSettings, "no settings found for %q", key)
 	}
 	out := make(Settings)
 	for name, value := range settings {
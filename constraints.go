@@ -0,0 +1,143 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Constraints holds the machine constraints declared in a bundle,
+// such as "mem=4G cores=2", keyed by constraint name. Aliases of
+// constraint names are replaced by the canonical names, so
+// "cpu-cores" is held as "cores".
+type Constraints map[string]string
+
+// constraintAliases maps the aliases of constraint
+// names to the canonical names.
+var constraintAliases = map[string]string{
+	"cpu-cores": "cores",
+}
+
+// constraintCheckers holds the functions checking the
+// values of the known constraints, keyed by name.
+var constraintCheckers = map[string]func(string) error{
+	"arch":          checkConstraintEnum("amd64", "arm64", "armhf", "i386", "ppc64el", "s390x"),
+	"container":     checkConstraintEnum("kvm", "lxc", "lxd", "none"),
+	"cores":         checkConstraintCount,
+	"cpu-power":     checkConstraintCount,
+	"mem":           checkConstraintSize,
+	"root-disk":     checkConstraintSize,
+	"tags":          checkConstraintList(false),
+	"spaces":        checkConstraintList(true),
+	"zones":         checkConstraintList(false),
+	"instance-type": checkConstraintAny,
+	"virt-type":     checkConstraintAny,
+}
+
+// ParseConstraints parses the given space-separated list of
+// name=value constraints, such as "mem=4G cores=2 arch=amd64". It
+// returns an error with code CodeInvalidConstraints describing the
+// first invalid constraint found. An empty value, as in "mem=", is
+// accepted for all constraints and means no constraint.
+func ParseConstraints(s string) (Constraints, error) {
+	cons := make(Constraints)
+	for _, field := range strings.Fields(s) {
+		i := strings.Index(field, "=")
+		if i <= 0 {
+			return nil, errorCodef(CodeInvalidConstraints, "malformed constraint %q", field)
+		}
+		name, value := field[:i], field[i+1:]
+		if canonical, ok := constraintAliases[name]; ok {
+			name = canonical
+		}
+		check, ok := constraintCheckers[name]
+		if !ok {
+			return nil, errorCodef(CodeInvalidConstraints, "unknown constraint %q", name)
+		}
+		if _, ok := cons[name]; ok {
+			return nil, errorCodef(CodeInvalidConstraints, "constraint %q specified more than once", name)
+		}
+		if value != "" {
+			if err := check(value); err != nil {
+				return nil, errorCodef(CodeInvalidConstraints, "bad %q constraint: %v", name, err)
+			}
+		}
+		cons[name] = value
+	}
+	return cons, nil
+}
+
+// VerifyConstraints checks that s holds valid constraints, as
+// checked by ParseConstraints. It may be passed to
+// BundleData.Verify and BundleData.VerifyWithCharms.
+func VerifyConstraints(s string) error {
+	_, err := ParseConstraints(s)
+	return err
+}
+
+// String returns the constraints in the form parsed by
+// ParseConstraints, sorted by name.
+func (cons Constraints) String() string {
+	names := make([]string, 0, len(cons))
+	for name := range cons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + cons[name]
+	}
+	return strings.Join(names, " ")
+}
+
+func checkConstraintEnum(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if value == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(values, ", "))
+	}
+}
+
+func checkConstraintCount(value string) error {
+	if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+		return fmt.Errorf("%q is not a non-negative integer", value)
+	}
+	return nil
+}
+
+var constraintSize = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?)([MGTP]?)$`)
+
+func checkConstraintSize(value string) error {
+	if !constraintSize.MatchString(value) {
+		return fmt.Errorf("%q is not a size, such as 512M or 4G", value)
+	}
+	return nil
+}
+
+// checkConstraintList returns a function checking comma-separated
+// lists of names, where names may be negated with a leading caret
+// if negation is true.
+func checkConstraintList(negation bool) func(string) error {
+	return func(value string) error {
+		for _, item := range strings.Split(value, ",") {
+			if negation {
+				item = strings.TrimPrefix(item, "^")
+			}
+			if item == "" {
+				return fmt.Errorf("%q holds an empty item", value)
+			}
+		}
+		return nil
+	}
+}
+
+func checkConstraintAny(value string) error {
+	return nil
+}
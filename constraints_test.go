@@ -0,0 +1,118 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ConstraintsSuite struct{}
+
+var _ = gc.Suite(&ConstraintsSuite{})
+
+var parseConstraintsTests = []struct {
+	about       string
+	cons        string
+	expect      charm.Constraints
+	expectError string
+}{{
+	about:  "empty",
+	cons:   "",
+	expect: charm.Constraints{},
+}, {
+	about: "all constraints",
+	cons:  "arch=amd64 container=lxd cores=2 cpu-power=100 mem=4G root-disk=1.5T tags=foo,bar spaces=db,^dmz zones=a instance-type=m1.small virt-type=kvm",
+	expect: charm.Constraints{
+		"arch":          "amd64",
+		"container":     "lxd",
+		"cores":         "2",
+		"cpu-power":     "100",
+		"mem":           "4G",
+		"root-disk":     "1.5T",
+		"tags":          "foo,bar",
+		"spaces":        "db,^dmz",
+		"zones":         "a",
+		"instance-type": "m1.small",
+		"virt-type":     "kvm",
+	},
+}, {
+	about:  "alias and empty value",
+	cons:   "  cpu-cores=4   mem= ",
+	expect: charm.Constraints{"cores": "4", "mem": ""},
+}, {
+	about:       "malformed",
+	cons:        "mem=4G 2cores",
+	expectError: `malformed constraint "2cores"`,
+}, {
+	about:       "unknown constraint",
+	cons:        "memory=4G",
+	expectError: `unknown constraint "memory"`,
+}, {
+	about:       "repeated constraint",
+	cons:        "cores=2 cpu-cores=4",
+	expectError: `constraint "cores" specified more than once`,
+}, {
+	about:       "bad size",
+	cons:        "mem=4X",
+	expectError: `bad "mem" constraint: "4X" is not a size, such as 512M or 4G`,
+}, {
+	about:       "bad count",
+	cons:        "cores=-1",
+	expectError: `bad "cores" constraint: "-1" is not a non-negative integer`,
+}, {
+	about:       "bad arch",
+	cons:        "arch=sparc",
+	expectError: `bad "arch" constraint: "sparc" is not one of amd64, arm64, armhf, i386, ppc64el, s390x`,
+}, {
+	about:       "empty list item",
+	cons:        "tags=foo,,bar",
+	expectError: `bad "tags" constraint: "foo,,bar" holds an empty item`,
+}, {
+	about:       "negated tag",
+	cons:        "tags=^foo",
+	expectError: `bad "tags" constraint: "\^foo" holds an empty item`,
+}}
+
+func (s *ConstraintsSuite) TestParseConstraints(c *gc.C) {
+	for i, test := range parseConstraintsTests {
+		c.Logf("test %d: %s", i, test.about)
+		cons, err := charm.ParseConstraints(test.cons)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidConstraints)
+			c.Assert(cons, gc.IsNil)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(cons, jc.DeepEquals, test.expect)
+	}
+}
+
+func (s *ConstraintsSuite) TestString(c *gc.C) {
+	cons, err := charm.ParseConstraints("mem=4G cpu-cores=2 arch=amd64")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cons.String(), gc.Equals, "arch=amd64 cores=2 mem=4G")
+}
+
+func (s *ConstraintsSuite) TestVerifyBundleConstraints(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+services:
+    mysql:
+        charm: cs:trusty/mysql-1
+        num_units: 1
+        constraints: mem=4G cores=2
+    wordpress:
+        charm: cs:trusty/wordpress-2
+        num_units: 1
+        constraints: mem=lots
+`))
+	c.Assert(err, jc.ErrorIsNil)
+	err = bd.Verify(charm.VerifyConstraints)
+	c.Assert(err, gc.ErrorMatches, `invalid constraints "mem=lots" in service "wordpress": bad "mem" constraint: "lots" is not a size, such as 512M or 4G`)
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/juju/schema"
+)
+
+var containerSchema = schema.FieldMap(
+	schema.Fields{
+		"resource": schema.String(),
+		"mounts":   schema.List(mountSchema),
+		"uid":      schema.Int(),
+		"gid":      schema.Int(),
+	},
+	schema.Defaults{
+		"resource": schema.Omit,
+		"mounts":   schema.Omit,
+		"uid":      schema.Omit,
+		"gid":      schema.Omit,
+	},
+)
+
+var mountSchema = schema.FieldMap(
+	schema.Fields{
+		"storage":  schema.String(),
+		"location": schema.String(),
+	},
+	schema.Defaults{
+		"location": schema.Omit,
+	},
+)
+
+var validContainerName = regexp.MustCompile("^[a-z]([a-z0-9]*(-[a-z0-9]+)*)?$")
+
+// Container holds the information about a workload container run
+// alongside the charm (a "sidecar" container) by charms deployed
+// to Kubernetes, as stored in a charm's metadata.
+type Container struct {
+	// Name identifies the container.
+	Name string `bson:"name" json:"name"`
+
+	// Resource holds the name of the oci-image resource
+	// holding the container's image.
+	Resource string `bson:"resource,omitempty" json:"resource,omitempty"`
+
+	// Mounts holds the storage mounted into the container.
+	Mounts []Mount `bson:"mounts,omitempty" json:"mounts,omitempty"`
+
+	// Uid and Gid hold the user and group ids the container
+	// runs as, or nil if the image defaults apply.
+	Uid *int `bson:"uid,omitempty" json:"uid,omitempty"`
+	Gid *int `bson:"gid,omitempty" json:"gid,omitempty"`
+}
+
+// Mount holds the information about storage mounted into a container.
+type Mount struct {
+	// Storage holds the name of the charm storage to mount.
+	Storage string `bson:"storage" json:"storage"`
+
+	// Location holds the absolute path at which the storage is
+	// mounted in the container. If it is empty, the location
+	// of the storage itself is used.
+	Location string `bson:"location,omitempty" json:"location,omitempty"`
+}
+
+func parseContainers(data interface{}) map[string]Container {
+	if data == nil {
+		return nil
+	}
+	result := make(map[string]Container)
+	for name, val := range data.(map[string]interface{}) {
+		result[name] = parseContainer(name, val)
+	}
+	return result
+}
+
+func parseContainer(name string, data interface{}) Container {
+	container := Container{
+		Name: name,
+	}
+	cMap := data.(map[string]interface{})
+	if resource, ok := cMap["resource"].(string); ok {
+		container.Resource = resource
+	}
+	if mounts, ok := cMap["mounts"].([]interface{}); ok {
+		for _, m := range mounts {
+			mMap := m.(map[string]interface{})
+			mount := Mount{
+				Storage: mMap["storage"].(string),
+			}
+			if location, ok := mMap["location"].(string); ok {
+				mount.Location = location
+			}
+			container.Mounts = append(container.Mounts, mount)
+		}
+	}
+	if uid, ok := cMap["uid"].(int64); ok {
+		id := int(uid)
+		container.Uid = &id
+	}
+	if gid, ok := cMap["gid"].(int64); ok {
+		id := int(gid)
+		container.Gid = &id
+	}
+	return container
+}
+
+// Validate checks the container to ensure its data is valid and that
+// the resource and storage it refers to are declared by meta.
+func (c Container) Validate(meta *Meta) error {
+	if !validContainerName.MatchString(c.Name) {
+		return errorCodef(CodeInvalidContainer, "charm %q has invalid container name: %q", meta.Name, c.Name)
+	}
+	if c.Resource == "" {
+		return errorCodef(CodeInvalidContainer, "charm %q container %q: resource must be specified", meta.Name, c.Name)
+	}
+	resource, ok := meta.Resources[c.Resource]
+	if !ok {
+		return errorCodef(CodeInvalidContainer, "charm %q container %q: reference to undefined resource %q", meta.Name, c.Name, c.Resource)
+	}
+	if resource.Type != ResourceTypeContainerImage {
+		return errorCodef(CodeInvalidContainer, "charm %q container %q: resource %q is of type %q; expected %q", meta.Name, c.Name, c.Resource, resource.Type, ResourceTypeContainerImage)
+	}
+	locations := make(map[string]bool)
+	for _, mount := range c.Mounts {
+		store, ok := meta.Storage[mount.Storage]
+		if !ok {
+			return errorCodef(CodeInvalidContainer, "charm %q container %q: reference to undefined storage %q", meta.Name, c.Name, mount.Storage)
+		}
+		if store.Type != StorageFilesystem {
+			return errorCodef(CodeInvalidContainer, "charm %q container %q: storage %q is of type %q; expected %q", meta.Name, c.Name, mount.Storage, store.Type, StorageFilesystem)
+		}
+		location := mount.Location
+		if location == "" {
+			location = store.Location
+		}
+		if location != "" && !path.IsAbs(location) {
+			return errorCodef(CodeInvalidContainer, "charm %q container %q: mount location %q is not absolute", meta.Name, c.Name, location)
+		}
+		if location != "" && locations[location] {
+			return errorCodef(CodeInvalidContainer, "charm %q container %q: duplicated mount location %q", meta.Name, c.Name, location)
+		}
+		locations[location] = true
+	}
+	if c.Uid != nil && *c.Uid < 0 {
+		return errorCodef(CodeInvalidContainer, "charm %q container %q: uid %d is negative", meta.Name, c.Name, *c.Uid)
+	}
+	if c.Gid != nil && *c.Gid < 0 {
+		return errorCodef(CodeInvalidContainer, "charm %q container %q: gid %d is negative", meta.Name, c.Name, *c.Gid)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ContainersSuite struct{}
+
+var _ = gc.Suite(&ContainersSuite{})
+
+const sidecarMetadata = `
+name: sidecar
+summary: b
+description: c
+series: [kubernetes]
+resources:
+  app-image:
+    type: oci-image
+    description: the application image
+  config-file:
+    type: file
+    filename: config.tar
+storage:
+  data:
+    type: filesystem
+    location: /srv/data
+  logs:
+    type: filesystem
+containers:
+  app:
+    resource: app-image
+    mounts:
+      - storage: data
+      - storage: logs
+        location: /var/log/app
+    uid: 1000
+    gid: 1001
+`
+
+func (s *ContainersSuite) TestReadContainers(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(sidecarMetadata))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Resources, jc.DeepEquals, map[string]charm.Resource{
+		"app-image": {
+			Name:        "app-image",
+			Type:        charm.ResourceTypeContainerImage,
+			Description: "the application image",
+		},
+		"config-file": {
+			Name:     "config-file",
+			Type:     charm.ResourceTypeFile,
+			Filename: "config.tar",
+		},
+	})
+	uid, gid := 1000, 1001
+	c.Assert(meta.Containers, jc.DeepEquals, map[string]charm.Container{
+		"app": {
+			Name:     "app",
+			Resource: "app-image",
+			Mounts: []charm.Mount{
+				{Storage: "data"},
+				{Storage: "logs", Location: "/var/log/app"},
+			},
+			Uid: &uid,
+			Gid: &gid,
+		},
+	})
+}
+
+var containerErrorTests = []struct {
+	about   string
+	replace [2]string
+	expect  string
+}{{
+	about:   "undefined resource",
+	replace: [2]string{"resource: app-image", "resource: missing"},
+	expect:  `charm "sidecar" container "app": reference to undefined resource "missing"`,
+}, {
+	about:   "resource of wrong type",
+	replace: [2]string{"resource: app-image", "resource: config-file"},
+	expect:  `charm "sidecar" container "app": resource "config-file" is of type "file"; expected "oci-image"`,
+}, {
+	about:   "undefined storage",
+	replace: [2]string{"- storage: data", "- storage: missing"},
+	expect:  `charm "sidecar" container "app": reference to undefined storage "missing"`,
+}, {
+	about:   "relative mount location",
+	replace: [2]string{"location: /var/log/app", "location: var/log/app"},
+	expect:  `charm "sidecar" container "app": mount location "var/log/app" is not absolute`,
+}, {
+	about:   "duplicated mount location",
+	replace: [2]string{"location: /var/log/app", "location: /srv/data"},
+	expect:  `charm "sidecar" container "app": duplicated mount location "/srv/data"`,
+}, {
+	about:   "negative uid",
+	replace: [2]string{"uid: 1000", "uid: -1"},
+	expect:  `charm "sidecar" container "app": uid -1 is negative`,
+}, {
+	about:   "invalid container name",
+	replace: [2]string{"  app:\n", "  App:\n"},
+	expect:  `charm "sidecar" has invalid container name: "App"`,
+}, {
+	about:   "file resource without filename",
+	replace: [2]string{"filename: config.tar", "description: no filename"},
+	expect:  `resource "config-file" missing filename`,
+}}
+
+func (s *ContainersSuite) TestContainerErrors(c *gc.C) {
+	for i, test := range containerErrorTests {
+		c.Logf("test %d: %s", i, test.about)
+		text := strings.Replace(sidecarMetadata, test.replace[0], test.replace[1], 1)
+		c.Assert(text, gc.Not(gc.Equals), sidecarMetadata)
+		_, err := charm.ReadMeta(strings.NewReader(text))
+		c.Check(err, gc.ErrorMatches, test.expect)
+		code := charm.ErrorCode(err)
+		c.Check(code == charm.CodeInvalidContainer || code == charm.CodeInvalidResource, jc.IsTrue)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// versionFile holds the name of the file in which charm
+// build tools record the version control revision of a charm.
+const versionFile = "version"
+
+// ContentHash returns the hex-encoded SHA256 hash of the content
+// of the charm directory, as CharmArchive.ContentHash does for
+// charm archives.
+func (dir *CharmDir) ContentHash() (string, error) {
+	return contentHash(dir.FS(), dir.Meta().Hooks())
+}
+
+// ContentHash returns the hex-encoded SHA256 hash of the content of
+// the charm archive. Unlike the hash returned by SHA256, it does not
+// depend on the revision of the charm or on the way the archive was
+// written, so it can be used to find whether a charm uploaded under a
+// new revision has the same content as an existing one. A charm
+// directory has the same content hash as the archives made from it.
+func (a *CharmArchive) ContentHash() (string, error) {
+	return contentHash(a.FS(), a.Meta().Hooks())
+}
+
+// contentHash returns the hash of the charm files in fsys, as walked
+// by walkCharmFiles, leaving out the revision and version files. The
+// hash covers the path, executable bit and content of each file, and
+// the path and target of each symlink. Files in the hooks directory
+// named in hooks count as executable, as they are made executable
+// when a charm directory is archived.
+func contentHash(fsys fs.FS, hooks map[string]bool) (string, error) {
+	h := sha256.New()
+	err := walkCharmFiles(fsys, func(p string, d fs.DirEntry) error {
+		if p == RevisionFile || p == versionFile {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := readLink(fsys, p)
+			if err != nil {
+				return fmt.Errorf("cannot read symlink %q: %v", p, err)
+			}
+			fmt.Fprintf(h, "%s\x00link\x00%s\x00", p, target)
+			return nil
+		}
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		executable := info.Mode()&0100 != 0
+		if path.Dir(p) == HooksDir && hooks[path.Base(p)] {
+			executable = true
+		}
+		fmt.Fprintf(h, "%s\x00%t\x00%d\x00", p, executable, info.Size())
+		n, err := io.Copy(h, f)
+		if err != nil {
+			return fmt.Errorf("cannot read %q: %v", p, err)
+		}
+		if n != info.Size() {
+			return fmt.Errorf("cannot read %q: file changed while being read", p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ContentHashSuite struct{}
+
+var _ = gc.Suite(&ContentHashSuite{})
+
+func (s *ContentHashSuite) TestContentHashIgnoresRevision(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	dirHash, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(dirHash, gc.HasLen, 64)
+
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	archiveHash, err := archive.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(archiveHash, gc.Equals, dirHash)
+
+	dir.SetDiskRevision(42)
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "version"), []byte("abcdef\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	hash, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hash, gc.Equals, dirHash)
+}
+
+func (s *ContentHashSuite) TestContentHashChangesWithContent(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	hash0, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "config.yaml"), []byte("options: {}\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	hash1, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hash1, gc.Not(gc.Equals), hash0)
+
+	err = os.Chmod(filepath.Join(dir.Path, "config.yaml"), 0755)
+	c.Assert(err, gc.IsNil)
+	hash2, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hash2, gc.Not(gc.Equals), hash1)
+}
+
+func (s *ContentHashSuite) TestContentHashMatchesArchive(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	// Nested hidden files and symlinks are archived, and
+	// hooks are made executable.
+	err := os.MkdirAll(filepath.Join(dir.Path, "lib", ".data"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "lib", ".data", "x"), []byte("x\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	err = os.Symlink("../lib/.data/x", filepath.Join(dir.Path, "hooks", "x"))
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "hooks", "install"), []byte("#!/bin/sh\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	// Top-level hidden files are not archived.
+	err = ioutil.WriteFile(filepath.Join(dir.Path, ".hidden"), []byte("x\n"), 0644)
+	c.Assert(err, gc.IsNil)
+
+	dirHash, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+	path := filepath.Join(c.MkDir(), "dummy.charm")
+	f, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(f)
+	f.Close()
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	archiveHash, err := archive.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(archiveHash, gc.Equals, dirHash)
+
+	// The nested hidden file and the symlink count.
+	err = os.Remove(filepath.Join(dir.Path, "hooks", "x"))
+	c.Assert(err, gc.IsNil)
+	hash, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hash, gc.Not(gc.Equals), dirHash)
+	err = os.Remove(filepath.Join(dir.Path, "lib", ".data", "x"))
+	c.Assert(err, gc.IsNil)
+	hash1, err := dir.ContentHash()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hash1, gc.Not(gc.Equals), hash)
+}
@@ -0,0 +1,188 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DeployOrder is a convenience function that calls
+// DeployOrderWithCharms with a nil charms map.
+func DeployOrder(bd *BundleData) ([]string, error) {
+	return DeployOrderWithCharms(bd, nil)
+}
+
+// DeployOrderWithCharms returns the names of the services in the
+// bundle in an order in which they may be deployed, so that every
+// service is deployed after the services it depends on. Services
+// whose dependencies are equally satisfied are ordered by name.
+//
+// A service depends on any service named by its placement
+// directives. If charms is not nil, it should hold a map with an
+// entry for each charm url returned by bd.RequiredCharms, and
+// services also depend on the services they are related to when
+// the direction of the relation can be determined: a subordinate
+// service depends on the principal services it is related to, and
+// otherwise a service requiring a relation depends on the service
+// providing it. Relations that cannot be resolved are ignored, so
+// the bundle should be verified first.
+//
+// If the dependencies form a cycle, DeployOrderWithCharms returns an
+// error with code CodeDependencyCycle that describes the cycle.
+func DeployOrderWithCharms(bd *BundleData, charms map[string]Charm) ([]string, error) {
+	// deps maps each service to the set of services it depends on.
+	deps := make(map[string]map[string]bool)
+	for name := range bd.Services {
+		deps[name] = make(map[string]bool)
+	}
+	addDep := func(svc, dep string) {
+		if svc != dep && deps[svc] != nil && deps[dep] != nil {
+			deps[svc][dep] = true
+		}
+	}
+	for name, svc := range bd.Services {
+		for _, to := range svc.To {
+			if up, err := ParsePlacement(to); err == nil && up.Service != "" {
+				addDep(name, up.Service)
+			}
+		}
+	}
+	if charms != nil {
+		getMeta := func(svcName string) (*Meta, error) {
+			svc, ok := bd.Services[svcName]
+			if !ok {
+				return nil, fmt.Errorf("service %q not found", svcName)
+			}
+			ch, ok := charms[svc.Charm]
+			if !ok {
+				return nil, fmt.Errorf("charm %q from service %q not found", svc.Charm, svcName)
+			}
+			return ch.Meta(), nil
+		}
+		for _, relPair := range bd.Relations {
+			if first, second, ok := relationDeployOrder(relPair, getMeta); ok {
+				addDep(second, first)
+			}
+		}
+	}
+	var order []string
+	for len(deps) > 0 {
+		var ready []string
+		for name, svcDeps := range deps {
+			if len(svcDeps) == 0 {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			return nil, errorCodef(CodeDependencyCycle, "services have cyclic dependencies: %s", dependencyCycle(deps))
+		}
+		sort.Strings(ready)
+		for _, name := range ready {
+			delete(deps, name)
+		}
+		for _, svcDeps := range deps {
+			for _, name := range ready {
+				delete(svcDeps, name)
+			}
+		}
+		order = append(order, ready...)
+	}
+	return order, nil
+}
+
+// relationDeployOrder returns the names of the services related by
+// relPair in the order in which they should be deployed, using
+// getMeta to retrieve their charm metadata. It returns false if
+// the order cannot be determined.
+func relationDeployOrder(relPair []string, getMeta func(svc string) (*Meta, error)) (first, second string, ok bool) {
+	if len(relPair) != 2 {
+		return "", "", false
+	}
+	ep0, err := parseEndpoint(relPair[0])
+	if err != nil {
+		return "", "", false
+	}
+	ep1, err := parseEndpoint(relPair[1])
+	if err != nil {
+		return "", "", false
+	}
+	ep0, ep1, err = inferEndpoints(ep0, ep1, getMeta)
+	if err != nil {
+		return "", "", false
+	}
+	meta0, err := getMeta(ep0.service)
+	if err != nil {
+		return "", "", false
+	}
+	meta1, err := getMeta(ep1.service)
+	if err != nil {
+		return "", "", false
+	}
+	switch {
+	case meta0.Subordinate && !meta1.Subordinate:
+		return ep1.service, ep0.service, true
+	case meta1.Subordinate && !meta0.Subordinate:
+		return ep0.service, ep1.service, true
+	}
+	role0, ok0 := endpointRole(meta0, ep0.relation)
+	role1, ok1 := endpointRole(meta1, ep1.relation)
+	switch {
+	case !ok0 || !ok1:
+	case role0 == RoleProvider && role1 == RoleRequirer:
+		return ep0.service, ep1.service, true
+	case role0 == RoleRequirer && role1 == RoleProvider:
+		return ep1.service, ep0.service, true
+	}
+	return "", "", false
+}
+
+// endpointRole returns the role of the named relation
+// of the given charm, and whether the charm has it.
+func endpointRole(meta *Meta, relation string) (RelationRole, bool) {
+	if _, ok := meta.Provides[relation]; ok {
+		return RoleProvider, true
+	}
+	if _, ok := meta.Requires[relation]; ok {
+		return RoleRequirer, true
+	}
+	if _, ok := meta.Peers[relation]; ok {
+		return RolePeer, true
+	}
+	if relation == infoRelation.Name {
+		// The juju-info relation is provided implicitly by every charm.
+		return RoleProvider, true
+	}
+	return "", false
+}
+
+// dependencyCycle returns a description of a cycle found in deps,
+// which must not hold any service without dependencies, in the
+// form "a -> b -> a", where each service depends on the next.
+func dependencyCycle(deps map[string]map[string]bool) string {
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// Follow the first dependency of each service
+	// until we come back to a service already seen.
+	var path []string
+	seen := make(map[string]int)
+	name := names[0]
+	for {
+		if i, ok := seen[name]; ok {
+			return strings.Join(append(path[i:], name), " -> ")
+		}
+		seen[name] = len(path)
+		path = append(path, name)
+		next := make([]string, 0, len(deps[name]))
+		for dep := range deps[name] {
+			next = append(next, dep)
+		}
+		sort.Strings(next)
+		name = next[0]
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type DeployOrderSuite struct{}
+
+var _ = gc.Suite(&DeployOrderSuite{})
+
+func (s *DeployOrderSuite) charms() map[string]charm.Charm {
+	return map[string]charm.Charm{
+		"wordpress": TestCharms.CharmDir("wordpress"),
+		"mysql":     TestCharms.CharmDir("mysql"),
+		"varnish":   TestCharms.CharmDir("varnish"),
+		"logging":   TestCharms.CharmDir("logging"),
+	}
+}
+
+var deployOrderTests = []struct {
+	about      string
+	data       string
+	withCharms bool
+	expect     []string
+	expectErr  string
+}{{
+	about: "no dependencies",
+	data: `
+services:
+    wordpress:
+        charm: wordpress
+    mysql:
+        charm: mysql
+relations:
+    - [wordpress, mysql]
+`,
+	expect: []string{"mysql", "wordpress"},
+}, {
+	about: "providers before requirers",
+	data: `
+services:
+    aaa:
+        charm: wordpress
+    zzz:
+        charm: mysql
+    cache:
+        charm: varnish
+relations:
+    - [aaa:db, zzz]
+    - [aaa, cache]
+`,
+	withCharms: true,
+	expect:     []string{"cache", "zzz", "aaa"},
+}, {
+	about: "subordinates after principals",
+	data: `
+services:
+    wordpress:
+        charm: wordpress
+    mysql:
+        charm: mysql
+    alogger:
+        charm: logging
+relations:
+    - [wordpress, mysql]
+    - [alogger:info, mysql]
+    - [alogger:logging-directory, wordpress:logging-dir]
+`,
+	withCharms: true,
+	expect:     []string{"mysql", "wordpress", "alogger"},
+}, {
+	about: "placement dependencies",
+	data: `
+services:
+    wordpress:
+        charm: wordpress
+        num_units: 1
+        to: ["lxc:mysql/0"]
+    mysql:
+        charm: mysql
+        num_units: 1
+        to: ["varnish"]
+    varnish:
+        charm: varnish
+        num_units: 1
+`,
+	expect: []string{"varnish", "mysql", "wordpress"},
+}, {
+	about: "unresolvable relations are ignored",
+	data: `
+services:
+    wordpress:
+        charm: wordpress
+    mysql:
+        charm: mysql
+    other:
+        charm: unknown
+relations:
+    - [wordpress, other]
+    - [wordpress:db, mysql:nothing]
+`,
+	withCharms: true,
+	expect:     []string{"mysql", "other", "wordpress"},
+}, {
+	about: "cycle",
+	data: `
+services:
+    wordpress:
+        charm: wordpress
+        num_units: 1
+        to: ["mysql"]
+    mysql:
+        charm: mysql
+        num_units: 1
+        to: ["varnish"]
+    varnish:
+        charm: varnish
+        num_units: 1
+        to: ["wordpress"]
+`,
+	expectErr: `services have cyclic dependencies: mysql -> varnish -> wordpress -> mysql`,
+}}
+
+func (s *DeployOrderSuite) TestDeployOrder(c *gc.C) {
+	for i, test := range deployOrderTests {
+		c.Logf("test %d: %s", i, test.about)
+		bd, err := charm.ReadBundleData(strings.NewReader(test.data))
+		c.Assert(err, jc.ErrorIsNil)
+		var order []string
+		if test.withCharms {
+			order, err = charm.DeployOrderWithCharms(bd, s.charms())
+		} else {
+			order, err = charm.DeployOrder(bd)
+		}
+		if test.expectErr != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectErr)
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeDependencyCycle)
+			c.Assert(order, gc.IsNil)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(order, jc.DeepEquals, test.expect)
+	}
+}
+
+func (s *DeployOrderSuite) TestDeployOrderBundleDir(c *gc.C) {
+	bd := TestCharms.BundleDir("wordpress-with-logging").Data()
+	order, err := charm.DeployOrderWithCharms(bd, s.charms())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(order, jc.DeepEquals, []string{"mysql", "wordpress", "logging"})
+}
@@ -0,0 +1,195 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// MaxMetadataSize holds the maximum size in bytes of the metadata
+// read by ReadMeta. Reading stops as soon as it is exceeded, so that
+// services accepting uploads are not made to hold pathologically
+// large documents in memory. If it is not positive, there is no limit.
+var MaxMetadataSize int64 = 1024 * 1024
+
+// MaxBundleDataSize holds the maximum size in bytes of the bundle
+// data read by ReadBundleData, which is enforced as MaxMetadataSize
+// is. If it is not positive, there is no limit.
+var MaxBundleDataSize int64 = 4 * 1024 * 1024
+
+// MaxDocumentSize holds the maximum size in bytes of the other YAML
+// documents of a charm, such as config.yaml and actions.yaml, which
+// is enforced as MaxMetadataSize is. If it is not positive, there is
+// no limit.
+var MaxDocumentSize int64 = 1024 * 1024
+
+// MaxExpandedSize holds the maximum size in bytes of the YAML
+// documents read by this package once their aliases are expanded,
+// so that a small document cannot use nested aliases to produce a
+// huge value. The expanded size is estimated from above before the
+// document is parsed. If it is not positive, there is no limit.
+var MaxExpandedSize int64 = 16 * 1024 * 1024
+
+// DocumentTooLargeError is returned when a document
+// exceeds the maximum size allowed for it.
+type DocumentTooLargeError struct {
+	// Document holds the name of the document,
+	// such as "metadata.yaml".
+	Document string
+
+	// Limit holds the maximum size of the document, in bytes.
+	Limit int64
+
+	// Expanded holds whether the document exceeds the
+	// limit once its aliases are expanded.
+	Expanded bool
+}
+
+func (err *DocumentTooLargeError) Error() string {
+	if err.Expanded {
+		return fmt.Sprintf("%s exceeds maximum size of %d bytes once its aliases are expanded", err.Document, err.Limit)
+	}
+	return fmt.Sprintf("%s exceeds maximum size of %d bytes", err.Document, err.Limit)
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (err *DocumentTooLargeError) ErrorCode() string {
+	return CodeDocumentTooLarge
+}
+
+// readDocument reads the whole of the named YAML document from r,
+// but returns a *DocumentTooLargeError after reading no more than
+// limit+1 bytes if it is larger than limit bytes, or if it would
+// be larger than MaxExpandedSize once its aliases are expanded.
+func readDocument(r io.Reader, name string, limit int64) ([]byte, error) {
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, &DocumentTooLargeError{
+			Document: name,
+			Limit:    limit,
+		}
+	}
+	if MaxExpandedSize > 0 && expandsBeyond(data, MaxExpandedSize) {
+		return nil, &DocumentTooLargeError{
+			Document: name,
+			Limit:    MaxExpandedSize,
+			Expanded: true,
+		}
+	}
+	return data, nil
+}
+
+// expandsBeyond reports whether the YAML document held in data may
+// be larger than limit bytes once its aliases are expanded.
+//
+// Anchors and aliases are found by a scan of the document which
+// skips comments, quoted scalars and block scalars. An anchored node
+// ends before the first alias to it, so it is no larger than the
+// expanded text between its anchor and that alias, which is the
+// size used for all the aliases to it.
+func expandsBeyond(data []byte, limit int64) bool {
+	type anchor struct {
+		start, size int64
+	}
+	anchors := make(map[string]*anchor)
+	// extra holds the number of bytes added
+	// by the aliases expanded so far.
+	var extra int64
+	// flow holds the depth of the current flow collection,
+	// quote holds the quote character of the current quoted
+	// scalar, if any, and blockIndent holds the indentation
+	// of the line that started the current block scalar, if any.
+	flow, quote, blockIndent := 0, byte(0), -1
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += start
+		}
+		line := data[start:end]
+		indent := len(line) - len(bytes.TrimLeft(line, " "))
+		if blockIndent >= 0 && (indent > blockIndent || len(bytes.TrimSpace(line)) == 0) {
+			start = end + 1
+			continue
+		}
+		blockIndent = -1
+		nodeStart := true
+	scan:
+		for i := indent; i < len(line); i++ {
+			c := line[i]
+			if quote != 0 {
+				switch {
+				case c == '\\' && quote == '"':
+					i++
+				case c == '\'' && quote == '\'' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+				case c == quote:
+					quote = 0
+					nodeStart = false
+				}
+				continue
+			}
+			switch {
+			case c == ' ' || c == '\t':
+			case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+				break scan
+			case nodeStart && (c == '"' || c == '\''):
+				quote = c
+			case nodeStart && flow == 0 && (c == '|' || c == '>'):
+				blockIndent = indent
+				break scan
+			case nodeStart && c == '!':
+				// Skip the tag, which is followed by the node.
+				for i+1 < len(line) && line[i+1] != ' ' {
+					i++
+				}
+			case nodeStart && (c == '&' || c == '*'):
+				j := i + 1
+				for j < len(line) && strings.IndexByte(" \t,[]{}", line[j]) < 0 {
+					j++
+				}
+				name := string(line[i+1 : j])
+				pos := int64(start+i) + extra
+				if c == '&' {
+					// The anchor is followed by the node.
+					anchors[name] = &anchor{start: pos, size: -1}
+				} else if a := anchors[name]; a != nil {
+					if a.size < 0 {
+						a.size = pos - a.start
+					}
+					extra += a.size
+					if int64(len(data))+extra > limit {
+						return true
+					}
+					nodeStart = false
+				}
+				i = j - 1
+			case nodeStart && (c == '[' || c == '{'):
+				flow++
+			case flow > 0 && (c == ']' || c == '}'):
+				flow--
+				nodeStart = false
+			case flow > 0 && c == ',':
+				nodeStart = true
+			case (c == '-' || c == '?' || c == ':') && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t'):
+				nodeStart = true
+			default:
+				nodeStart = false
+			}
+		}
+		start = end + 1
+	}
+	return int64(len(data))+extra > limit
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type DocumentLimitSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&DocumentLimitSuite{})
+
+// endlessReader is an io.Reader that never runs out of data, and
+// records how much has been read from it.
+type endlessReader struct {
+	read int64
+}
+
+func (r *endlessReader) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = '#'
+	}
+	r.read += int64(len(buf))
+	return len(buf), nil
+}
+
+func (s *DocumentLimitSuite) TestReadMetaTooLarge(c *gc.C) {
+	s.PatchValue(&charm.MaxMetadataSize, int64(1024))
+	r := &endlessReader{}
+	_, err := charm.ReadMeta(r)
+	c.Assert(err, gc.ErrorMatches, `metadata.yaml exceeds maximum size of 1024 bytes`)
+	c.Assert(err, gc.FitsTypeOf, (*charm.DocumentTooLargeError)(nil))
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeDocumentTooLarge)
+	c.Assert(r.read < 64*1024, gc.Equals, true)
+}
+
+func (s *DocumentLimitSuite) TestReadMetaWithinLimit(c *gc.C) {
+	s.PatchValue(&charm.MaxMetadataSize, int64(len(dummyMetadata)))
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "a")
+}
+
+func (s *DocumentLimitSuite) TestReadMetaNoLimit(c *gc.C) {
+	s.PatchValue(&charm.MaxMetadataSize, int64(0))
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\n#" + strings.Repeat(" ", 2*1024*1024)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "a")
+}
+
+func (s *DocumentLimitSuite) TestReadBundleDataTooLarge(c *gc.C) {
+	s.PatchValue(&charm.MaxBundleDataSize, int64(100))
+	r := &endlessReader{}
+	_, err := charm.ReadBundleData(r)
+	c.Assert(err, gc.ErrorMatches, `bundle.yaml exceeds maximum size of 100 bytes`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeDocumentTooLarge)
+	c.Assert(r.read < 64*1024, gc.Equals, true)
+}
+
+func (s *DocumentLimitSuite) TestReadConfigTooLarge(c *gc.C) {
+	s.PatchValue(&charm.MaxDocumentSize, int64(100))
+	r := &endlessReader{}
+	_, err := charm.ReadConfig(r)
+	c.Assert(err, gc.ErrorMatches, `config.yaml exceeds maximum size of 100 bytes`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeDocumentTooLarge)
+	c.Assert(r.read < 64*1024, gc.Equals, true)
+}
+
+func (s *DocumentLimitSuite) TestReadActionsTooLarge(c *gc.C) {
+	s.PatchValue(&charm.MaxDocumentSize, int64(100))
+	_, err := charm.ReadActionsYaml(&endlessReader{})
+	c.Assert(err, gc.ErrorMatches, `actions.yaml exceeds maximum size of 100 bytes`)
+}
+
+// aliasBomb returns a YAML document of the given number of levels,
+// each holding ten aliases to the level below.
+func aliasBomb(levels int) string {
+	doc := `l0: &l0 ["lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol"]` + "\n"
+	for i := 1; i < levels; i++ {
+		alias := fmt.Sprintf("*l%d", i-1)
+		doc += fmt.Sprintf("l%d: &l%d [%s]\n", i, i, strings.Repeat(alias+", ", 9)+alias)
+	}
+	return doc
+}
+
+func (s *DocumentLimitSuite) TestReadConfigAliasBomb(c *gc.C) {
+	_, err := charm.ReadConfig(strings.NewReader("options: {}\n" + aliasBomb(9)))
+	c.Assert(err, gc.ErrorMatches, `config.yaml exceeds maximum size of 16777216 bytes once its aliases are expanded`)
+	c.Assert(err, gc.FitsTypeOf, (*charm.DocumentTooLargeError)(nil))
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeDocumentTooLarge)
+
+	_, err = charm.ReadBundleData(strings.NewReader(aliasBomb(9)))
+	c.Assert(err, gc.ErrorMatches, `bundle.yaml exceeds maximum size of 16777216 bytes once its aliases are expanded`)
+}
+
+func (s *DocumentLimitSuite) TestReadConfigAliases(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader(`
+options:
+    title: &option
+        type: string
+        description: "A title: &not *an alias"
+        default: "*"
+    subtitle: *option
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Options["subtitle"], gc.Equals, config.Options["title"])
+
+	s.PatchValue(&charm.MaxExpandedSize, int64(0))
+	_, err = charm.ReadConfig(strings.NewReader("options: {}\n" + aliasBomb(3)))
+	c.Assert(err, gc.IsNil)
+}
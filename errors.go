@@ -0,0 +1,149 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import "fmt"
+
+// Error codes attached to the errors produced when parsing or
+// validating charm URLs, metadata, config, actions and bundles. The
+// codes are stable, so API servers may rely on them to map errors to
+// HTTP responses or translated messages.
+const (
+	// Charm URL errors.
+	CodeInvalidSchema      = "invalid-schema"
+	CodeMissingSchema      = "missing-schema"
+	CodeInvalidUser        = "invalid-user"
+	CodeUserNotAllowed     = "user-not-allowed"
+	CodeInvalidForm        = "invalid-form"
+	CodeInvalidSeries      = "invalid-series"
+	CodeUnknownSeries      = "unknown-series"
+	CodeUnresolvedSeries   = "unresolved-series"
+	CodeUnsupportedSeries  = "unsupported-series"
+	CodeMissingName        = "missing-name"
+	CodeInvalidName        = "invalid-name"
+	CodeBadRevision        = "bad-revision"
+	CodeUnresolvedRevision = "unresolved-revision"
+	CodeInvalidChannel     = "invalid-channel"
+	CodeInvalidAlias       = "invalid-alias"
+
+	// Charm metadata errors.
+	CodeInvalidMetadata     = "invalid-metadata"
+	CodeInvalidRelation     = "invalid-relation"
+	CodeReservedName        = "reserved-name"
+	CodeDuplicateName       = "duplicate-name"
+	CodeInvalidSubordinate  = "invalid-subordinate"
+	CodeInvalidStorage      = "invalid-storage"
+	CodeInvalidPayloadClass = "invalid-payload-class"
+	CodeInvalidResource     = "invalid-resource"
+	CodeInvalidContainer    = "invalid-container"
+	CodeInvalidTag          = "invalid-tag"
+	CodeInvalidLicense      = "invalid-license"
+
+	// Charm content errors.
+	CodeInvalidFileMode    = "invalid-file-mode"
+	CodeInvalidPebbleLayer = "invalid-pebble-layer"
+	CodeInvalidManifest    = "invalid-manifest"
+	CodeInvalidIcon        = "invalid-icon"
+	CodeInconsistentCharm  = "inconsistent-charm"
+	CodeEmbeddedSecret     = "embedded-secret"
+	CodeInvalidArchive     = "invalid-archive"
+	CodeDocumentTooLarge   = "document-too-large"
+
+	// Charm config errors.
+	CodeInvalidConfig      = "invalid-config"
+	CodeUnknownOption      = "unknown-option"
+	CodeInvalidOptionType  = "invalid-option-type"
+	CodeInvalidOptionValue = "invalid-option-value"
+	CodeInvalidSettings    = "invalid-settings"
+
+	// Charm actions errors.
+	CodeInvalidActions      = "invalid-actions"
+	CodeInvalidActionName   = "invalid-action-name"
+	CodeInvalidActionParams = "invalid-action-params"
+
+	// Bundle errors.
+	CodeInvalidBundle       = "invalid-bundle"
+	CodeVerificationFailed  = "verification-failed"
+	CodeInvalidMachine      = "invalid-machine"
+	CodeUnusedMachine       = "unused-machine"
+	CodeInvalidService      = "invalid-service"
+	CodeInvalidPlacement    = "invalid-placement"
+	CodeInvalidConstraints  = "invalid-constraints"
+	CodeInvalidUnitCount    = "invalid-unit-count"
+	CodeCharmNotFound       = "charm-not-found"
+	CodeInvalidBundleOption = "invalid-bundle-option"
+	CodeInvalidExpose       = "invalid-expose"
+	CodeDependencyCycle     = "dependency-cycle"
+	CodeInvalidDevice       = "invalid-device"
+	CodeInvalidBinding      = "invalid-binding"
+)
+
+// CodedError is implemented by all the errors produced when parsing
+// or validating charm URLs, metadata, config, actions and bundles.
+type CodedError interface {
+	error
+
+	// ErrorCode returns a stable machine-readable code
+	// describing the kind of error, such as "invalid-series".
+	ErrorCode() string
+}
+
+// ErrorCode returns the code of err if it implements CodedError,
+// or the empty string otherwise.
+func ErrorCode(err error) string {
+	if err, ok := err.(CodedError); ok {
+		return err.ErrorCode()
+	}
+	return ""
+}
+
+// codedError is the implementation of CodedError used
+// throughout the package.
+type codedError struct {
+	code string
+	msg  string
+}
+
+func (err *codedError) Error() string {
+	return err.msg
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (err *codedError) ErrorCode() string {
+	return err.code
+}
+
+// errorCodef returns a new error with the given code and a
+// message formatted according to the format specifier.
+func errorCodef(code string, f string, a ...interface{}) error {
+	return &codedError{
+		code: code,
+		msg:  fmt.Sprintf(f, a...),
+	}
+}
+
+// withCode returns an error with the given code and the same message
+// as err. If err already has a code, that code is preserved.
+func withCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(CodedError); ok {
+		return err
+	}
+	return &codedError{
+		code: code,
+		msg:  err.Error(),
+	}
+}
+
+// annotateCodef returns an error with a message formatted according
+// to the format specifier, keeping the code of err if it has one, and
+// using the given code otherwise.
+func annotateCodef(code string, err error, f string, a ...interface{}) error {
+	if c := ErrorCode(err); c != "" {
+		code = c
+	}
+	return errorCodef(code, f, a...)
+}
@@ -0,0 +1,202 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ErrorCodeSuite struct{}
+
+var _ = gc.Suite(&ErrorCodeSuite{})
+
+func parseURLError(s string) func() error {
+	return func() error {
+		_, err := charm.ParseURL(s)
+		return err
+	}
+}
+
+func readMetaError(s string) func() error {
+	return func() error {
+		_, err := charm.ReadMeta(strings.NewReader(s))
+		return err
+	}
+}
+
+func readConfigError(s string) func() error {
+	return func() error {
+		_, err := charm.ReadConfig(strings.NewReader(s))
+		return err
+	}
+}
+
+func readActionsError(s string) func() error {
+	return func() error {
+		_, err := charm.ReadActionsYaml(strings.NewReader(s))
+		return err
+	}
+}
+
+func verifyBundleError(s string) func() error {
+	return func() error {
+		bd, err := charm.ReadBundleData(strings.NewReader(s))
+		if err != nil {
+			return err
+		}
+		err = bd.Verify(nil)
+		if err, ok := err.(*charm.VerificationError); ok && len(err.Errors) == 1 {
+			return err.Errors[0]
+		}
+		return err
+	}
+}
+
+var errorCodeTests = []struct {
+	about  string
+	err    func() error
+	expect string
+}{{
+	about:  "invalid schema",
+	err:    parseURLError("bs:trusty/wordpress"),
+	expect: charm.CodeInvalidSchema,
+}, {
+	about:  "missing schema",
+	err:    parseURLError("trusty/wordpress"),
+	expect: charm.CodeMissingSchema,
+}, {
+	about:  "invalid series",
+	err:    parseURLError("cs:Trusty/wordpress"),
+	expect: charm.CodeInvalidSeries,
+}, {
+	about:  "unresolved series",
+	err:    parseURLError("cs:wordpress"),
+	expect: charm.CodeUnresolvedSeries,
+}, {
+	about:  "missing name",
+	err:    parseURLError("cs:~who"),
+	expect: charm.CodeMissingName,
+}, {
+	about:  "invalid name",
+	err:    parseURLError("cs:trusty/Wordpress"),
+	expect: charm.CodeInvalidName,
+}, {
+	about:  "invalid user",
+	err:    parseURLError("cs:~_/trusty/wordpress"),
+	expect: charm.CodeInvalidUser,
+}, {
+	about:  "user not allowed",
+	err:    parseURLError("local:~who/trusty/wordpress"),
+	expect: charm.CodeUserNotAllowed,
+}, {
+	about: "inferred series",
+	err: func() error {
+		_, err := charm.InferURL("wordpress", "")
+		return err
+	},
+	expect: charm.CodeUnresolvedSeries,
+}, {
+	about:  "metadata yaml",
+	err:    readMetaError("name: [}"),
+	expect: charm.CodeInvalidMetadata,
+}, {
+	about:  "metadata schema",
+	err:    readMetaError("name: foo\n"),
+	expect: charm.CodeInvalidMetadata,
+}, {
+	about:  "reserved relation name",
+	err:    readMetaError("name: foo\nsummary: x\ndescription: x\nprovides:\n  juju-foo: http\n"),
+	expect: charm.CodeReservedName,
+}, {
+	about:  "duplicated relation name",
+	err:    readMetaError("name: foo\nsummary: x\ndescription: x\nprovides:\n  db: mysql\nrequires:\n  db: mysql\n"),
+	expect: charm.CodeDuplicateName,
+}, {
+	about:  "subordinate without container relation",
+	err:    readMetaError("name: foo\nsummary: x\ndescription: x\nsubordinate: true\n"),
+	expect: charm.CodeInvalidSubordinate,
+}, {
+	about:  "metadata series",
+	err:    readMetaError("name: foo\nsummary: x\ndescription: x\nseries: Trusty\n"),
+	expect: charm.CodeInvalidSeries,
+}, {
+	about:  "empty config",
+	err:    readConfigError(""),
+	expect: charm.CodeInvalidConfig,
+}, {
+	about:  "unknown option type",
+	err:    readConfigError("options:\n  foo:\n    type: blob\n"),
+	expect: charm.CodeInvalidOptionType,
+}, {
+	about:  "bad option default",
+	err:    readConfigError("options:\n  foo:\n    type: int\n    default: blah\n"),
+	expect: charm.CodeInvalidOptionValue,
+}, {
+	about: "unknown option",
+	err: func() error {
+		_, err := charm.NewConfig().ValidateSettings(charm.Settings{"foo": 1})
+		return err
+	},
+	expect: charm.CodeUnknownOption,
+}, {
+	about: "bad settings yaml",
+	err: func() error {
+		_, err := charm.NewConfig().ParseSettingsYAML([]byte("foo: [}"), "foo")
+		return err
+	},
+	expect: charm.CodeInvalidSettings,
+}, {
+	about:  "bad action name",
+	err:    readActionsError("Snapshot:\n  description: x\n"),
+	expect: charm.CodeInvalidActionName,
+}, {
+	about:  "bad action description",
+	err:    readActionsError("snapshot:\n  description: [1]\n"),
+	expect: charm.CodeInvalidActions,
+}, {
+	about:  "bundle yaml",
+	err:    verifyBundleError("services: [}"),
+	expect: charm.CodeInvalidBundle,
+}, {
+	about:  "bundle without services",
+	err:    verifyBundleError("series: trusty\n"),
+	expect: charm.CodeInvalidService,
+}, {
+	about:  "bundle placement",
+	err:    verifyBundleError("services:\n  wp:\n    charm: wordpress\n    num_units: 1\n    to: [\"0\"]\n"),
+	expect: charm.CodeInvalidPlacement,
+}, {
+	about:  "bundle relation",
+	err:    verifyBundleError("services:\n  wp:\n    charm: wordpress\nrelations:\n  - [\"wp:db\", \"mysql:db\"]\n"),
+	expect: charm.CodeInvalidRelation,
+}, {
+	about:  "bundle with several errors",
+	err:    verifyBundleError("series: Trusty\n"),
+	expect: charm.CodeVerificationFailed,
+}, {
+	about:  "not a charm error",
+	err:    func() error { return fmt.Errorf("something else") },
+	expect: "",
+}, {
+	about:  "nil error",
+	err:    func() error { return nil },
+	expect: "",
+}}
+
+func (s *ErrorCodeSuite) TestErrorCode(c *gc.C) {
+	for i, test := range errorCodeTests {
+		c.Logf("test %d: %s", i, test.about)
+		err := test.err()
+		if test.expect != "" {
+			c.Assert(err, gc.NotNil)
+			c.Assert(err, gc.Implements, new(charm.CodedError))
+		}
+		c.Assert(charm.ErrorCode(err), gc.Equals, test.expect)
+	}
+}
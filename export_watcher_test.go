@@ -0,0 +1,9 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build fsnotify
+// +build fsnotify
+
+package charm
+
+var WatchDebounce = &watchDebounce
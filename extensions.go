@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v1"
+)
+
+// ExtensionPrefix holds the prefix of the names of top level fields
+// in metadata.yaml and config.yaml that are reserved for vendor
+// extensions. Such fields are not interpreted, but they are preserved
+// in the Extensions fields of Meta and Config.
+const ExtensionPrefix = "x-"
+
+// IsExtensionField reports whether name is the name of
+// a vendor extension field.
+func IsExtensionField(name string) bool {
+	return strings.HasPrefix(name, ExtensionPrefix) && len(name) > len(ExtensionPrefix)
+}
+
+// readExtensions returns the extension fields found in raw, or nil if
+// there are none. Maps in the values are converted to have string
+// keys, so that they can be serialized as BSON or JSON.
+func readExtensions(raw map[interface{}]interface{}) (map[string]interface{}, error) {
+	var extensions map[string]interface{}
+	for key, value := range raw {
+		name, ok := key.(string)
+		if !ok || !IsExtensionField(name) {
+			continue
+		}
+		value, err := cleanseExtension(value)
+		if err != nil {
+			return nil, fmt.Errorf("extension field %q: %v", name, err)
+		}
+		if extensions == nil {
+			extensions = make(map[string]interface{})
+		}
+		extensions[name] = value
+	}
+	return extensions, nil
+}
+
+// cleanseExtension returns value with any maps
+// converted to be keyed by strings.
+func cleanseExtension(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for key, elem := range value {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map keyed with non-string value %#v", key)
+			}
+			elem, err := cleanseExtension(elem)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = elem
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(value))
+		for i, elem := range value {
+			elem, err := cleanseExtension(elem)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = elem
+		}
+		return s, nil
+	}
+	return value, nil
+}
+
+// withExtensions returns the value to marshal as YAML in place of v,
+// with the given extension fields added at the top level.
+func withExtensions(v interface{}, extensions map[string]interface{}) interface{} {
+	if len(extensions) == 0 {
+		return v
+	}
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("cannot marshal %T: %v", v, err))
+	}
+	m := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, m); err != nil {
+		panic(fmt.Errorf("cannot unmarshal %T: %v", v, err))
+	}
+	for name, value := range extensions {
+		if IsExtensionField(name) {
+			m[name] = value
+		}
+	}
+	return m
+}
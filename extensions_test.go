@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ExtensionsSuite struct{}
+
+var _ = gc.Suite(&ExtensionsSuite{})
+
+func (s *ExtensionsSuite) TestIsExtensionField(c *gc.C) {
+	c.Assert(charm.IsExtensionField("x-vendor"), jc.IsTrue)
+	c.Assert(charm.IsExtensionField("x-"), jc.IsFalse)
+	c.Assert(charm.IsExtensionField("vendor"), jc.IsFalse)
+	c.Assert(charm.IsExtensionField("X-vendor"), jc.IsFalse)
+}
+
+const extensionsMetadata = dummyMetadata + `
+x-vendor: acme
+x-build:
+  tool: make
+  targets: [all, {name: docs}]
+unknown: ignored
+`
+
+func (s *ExtensionsSuite) TestMetaExtensions(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Extensions, gc.IsNil)
+
+	meta, err = charm.ReadMeta(strings.NewReader(extensionsMetadata))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Extensions, jc.DeepEquals, map[string]interface{}{
+		"x-vendor": "acme",
+		"x-build": map[string]interface{}{
+			"tool": "make",
+			"targets": []interface{}{
+				"all",
+				map[string]interface{}{"name": "docs"},
+			},
+		},
+	})
+
+	// The extensions survive a round trip through YAML.
+	data, err := yaml.Marshal(meta)
+	c.Assert(err, gc.IsNil)
+	got, err := charm.ReadMeta(strings.NewReader(string(data)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, jc.DeepEquals, meta)
+}
+
+func (s *ExtensionsSuite) TestMetaExtensionWithNonStringKey(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nx-vendor: {1: one}\n"))
+	c.Assert(err, gc.ErrorMatches, `metadata: extension field "x-vendor": map keyed with non-string value 1`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidMetadata)
+}
+
+const extensionsConfig = `
+options:
+  title:
+    type: string
+    default: My Title
+x-vendor:
+  support: https://example.com
+`
+
+func (s *ExtensionsSuite) TestConfigExtensions(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader(extensionsConfig))
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Extensions, jc.DeepEquals, map[string]interface{}{
+		"x-vendor": map[string]interface{}{
+			"support": "https://example.com",
+		},
+	})
+
+	data, err := yaml.Marshal(config)
+	c.Assert(err, gc.IsNil)
+	got, err := charm.ReadConfig(strings.NewReader(string(data)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, jc.DeepEquals, config)
+}
+
+func (s *ExtensionsSuite) TestConfigWithoutExtensions(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader("options: {}\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Extensions, gc.IsNil)
+
+	data, err := yaml.Marshal(config)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "options: {}\n")
+}
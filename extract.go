@@ -0,0 +1,176 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ExtractFiles expands the files in the charm archive that match any
+// of the given patterns into dest, creating it if necessary. A pattern
+// ending in a slash, such as "hooks/", matches the named directory and
+// everything below it; other patterns are matched against the whole
+// slash-separated path of each file, using the syntax of path.Match.
+// A pattern matching "revision" causes the revision file to be written,
+// as it is by ExpandTo.
+//
+// The same checks are made as by ExpandTo: nothing is extracted if a
+// selected file has a mode not accepted by the archive's file mode
+// policy, or a path or symbolic link leading outside dest, and hooks
+// are made executable.
+func (a *CharmArchive) ExtractFiles(dest string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+
+	// Check all the selected files before extracting anything.
+	policy := a.fileModePolicy()
+	var selected []*zip.File
+	for _, fh := range zipr.File {
+		name := strings.TrimSuffix(fh.Name, "/")
+		if !matchAny(patterns, name) {
+			continue
+		}
+		if err := checkExtractPath(fh); err != nil {
+			return err
+		}
+		if hasUnixMode(fh) {
+			if err := policy.Check(fh.Name, fh.Mode()); err != nil {
+				return err
+			}
+		}
+		selected = append(selected, fh)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	for _, fh := range selected {
+		if err := extractFile(fh, dest, policy); err != nil {
+			return fmt.Errorf("cannot extract %q: %v", fh.Name, err)
+		}
+	}
+	hooksDir := filepath.Join(dest, HooksDir)
+	if err := filepath.Walk(hooksDir, fixHookFunc(hooksDir, a.meta.Hooks())); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if matchAny(patterns, RevisionFile) {
+		err := ioutil.WriteFile(filepath.Join(dest, RevisionFile), []byte(strconv.Itoa(a.revision)), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether the slash-separated path name
+// matches any of the given patterns, as documented for
+// CharmArchive.ExtractFiles.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			dir := strings.TrimSuffix(pattern, "/")
+			if name == dir || strings.HasPrefix(name, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExtractPath checks that extracting the given file cannot
+// write outside of the destination directory, returning errors
+// like those of ExpandTo.
+func checkExtractPath(fh *zip.File) error {
+	name := path.Clean(fh.Name)
+	if path.IsAbs(fh.Name) || outOfScope(name) {
+		return fmt.Errorf("cannot extract %q: path leads out of scope", fh.Name)
+	}
+	if fh.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	target, err := readZipFile(fh)
+	if err != nil {
+		return fmt.Errorf("cannot extract %q: %v", fh.Name, err)
+	}
+	if path.IsAbs(string(target)) {
+		return fmt.Errorf("cannot extract %q: symlink %q is absolute", fh.Name, target)
+	}
+	if outOfScope(path.Join(path.Dir(name), string(target))) {
+		return fmt.Errorf("cannot extract %q: symlink %q leads out of scope", fh.Name, target)
+	}
+	return nil
+}
+
+// outOfScope reports whether the cleaned relative
+// path p refers to a location above its root.
+func outOfScope(p string) bool {
+	return p == ".." || strings.HasPrefix(p, "../")
+}
+
+func readZipFile(fh *zip.File) ([]byte, error) {
+	r, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// extractFile extracts the given file into dest, applying policy
+// to its mode.
+func extractFile(fh *zip.File, dest string, policy FileModePolicy) error {
+	target := filepath.Join(dest, filepath.FromSlash(path.Clean(fh.Name)))
+	mode := checkedMode(fh)
+	if mode.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if mode&os.ModeSymlink != 0 {
+		link, err := readZipFile(fh)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(string(link), target)
+	}
+	r, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode&os.ModePerm&^0002)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(target, expandedMode(mode, policy))
+}
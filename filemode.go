@@ -0,0 +1,93 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"os"
+)
+
+// FileModePolicy determines which potentially dangerous file
+// permission bits are accepted in a charm when it is archived or
+// expanded. Bits that are accepted are preserved through the cycle.
+// Setuid and setgid files that are not accepted cause an error;
+// world-writable permissions that are not accepted are removed,
+// as archiving and expanding always have.
+type FileModePolicy struct {
+	// AllowSetuid allows files with the setuid bit set.
+	AllowSetuid bool
+
+	// AllowSetgid allows files with the setgid bit set.
+	AllowSetgid bool
+
+	// AllowWorldWritable preserves the group and world write
+	// permissions of files and directories that are writable
+	// by any user.
+	AllowWorldWritable bool
+}
+
+// DefaultFileModePolicy holds the policy used by charm directories
+// and archives unless another is set. It rejects setuid and setgid
+// files and removes the write permissions of world-writable ones.
+var DefaultFileModePolicy = FileModePolicy{}
+
+// Check returns an error if the given mode of the file at path
+// is not accepted by the policy. Symbolic links are always accepted,
+// as their permission bits are not meaningful.
+func (p FileModePolicy) Check(path string, mode os.FileMode) error {
+	if mode&os.ModeSymlink != 0 {
+		return nil
+	}
+	switch {
+	case mode&os.ModeSetuid != 0 && !p.AllowSetuid:
+		return errorCodef(CodeInvalidFileMode, "file %q is setuid", path)
+	case mode&os.ModeSetgid != 0 && !p.AllowSetgid:
+		return errorCodef(CodeInvalidFileMode, "file %q is setgid", path)
+	}
+	return nil
+}
+
+// writePerm returns the group and world write permissions of mode
+// that are preserved by the policy.
+func (p FileModePolicy) writePerm(mode os.FileMode) os.FileMode {
+	if !p.AllowWorldWritable || mode&0002 == 0 || mode&os.ModeSymlink != 0 {
+		return 0
+	}
+	return mode & 0022
+}
+
+// zipCreatorUnix and zipCreatorMacOSX hold the "version made by" host
+// systems of zip files created on unix and Mac OS X, the systems
+// whose unix modes are decoded by archive/zip, and so are checked
+// when an archive is expanded; other systems record nominal modes
+// such as 0666 for every file.
+const (
+	zipCreatorUnix   = 3
+	zipCreatorMacOSX = 19
+)
+
+// hasUnixMode reports whether the mode of fh was recorded on unix.
+func hasUnixMode(fh *zip.File) bool {
+	switch fh.CreatorVersion >> 8 {
+	case zipCreatorUnix, zipCreatorMacOSX:
+		return true
+	}
+	return false
+}
+
+// preservedModeBits holds the mode bits, other than the normalized
+// permission bits, that are carried through archiving and expansion
+// once a file has passed the policy check.
+const preservedModeBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// checkedMode returns the mode of fh with which it is expanded. The
+// preservedModeBits are removed unless the mode was recorded on unix,
+// as they are only checked against the policy then.
+func checkedMode(fh *zip.File) os.FileMode {
+	mode := fh.Mode()
+	if !hasUnixMode(fh) {
+		mode &^= preservedModeBits
+	}
+	return mode
+}
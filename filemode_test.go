@@ -0,0 +1,75 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"os"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type FileModePolicySuite struct{}
+
+var _ = gc.Suite(&FileModePolicySuite{})
+
+var fileModePolicyTests = []struct {
+	about  string
+	policy charm.FileModePolicy
+	mode   os.FileMode
+	expect string
+}{{
+	about: "plain file",
+	mode:  0644,
+}, {
+	about: "executable file",
+	mode:  0755,
+}, {
+	about: "plain directory",
+	mode:  os.ModeDir | 0755,
+}, {
+	about: "world-writable symlink",
+	mode:  os.ModeSymlink | 0777,
+}, {
+	about:  "setuid file",
+	mode:   os.ModeSetuid | 0755,
+	expect: `file "foo" is setuid`,
+}, {
+	about:  "setuid file allowed",
+	policy: charm.FileModePolicy{AllowSetuid: true},
+	mode:   os.ModeSetuid | 0755,
+}, {
+	about:  "setgid file",
+	mode:   os.ModeSetgid | 0755,
+	expect: `file "foo" is setgid`,
+}, {
+	about:  "setgid file allowed",
+	policy: charm.FileModePolicy{AllowSetgid: true},
+	mode:   os.ModeSetgid | 0755,
+}, {
+	about: "world-writable file",
+	mode:  0666,
+}, {
+	about: "world-writable directory",
+	mode:  os.ModeDir | 0777,
+}, {
+	about:  "setuid allowed but not setgid",
+	policy: charm.FileModePolicy{AllowSetuid: true},
+	mode:   os.ModeSetuid | os.ModeSetgid | 0755,
+	expect: `file "foo" is setgid`,
+}}
+
+func (s *FileModePolicySuite) TestCheck(c *gc.C) {
+	for i, test := range fileModePolicyTests {
+		c.Logf("test %d: %s", i, test.about)
+		err := test.policy.Check("foo", test.mode)
+		if test.expect == "" {
+			c.Check(err, gc.IsNil)
+			continue
+		}
+		c.Check(err, gc.ErrorMatches, test.expect)
+		c.Check(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidFileMode)
+	}
+}
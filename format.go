@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io/fs"
+
+	"github.com/juju/utils/set"
+)
+
+// Format identifies the layout and conventions followed by a charm.
+type Format int
+
+const (
+	// FormatUnknown is the zero value of Format.
+	FormatUnknown Format = iota
+
+	// FormatV1 identifies charms that declare their series in
+	// metadata.yaml and run hooks directly.
+	FormatV1
+
+	// FormatV2 identifies charms that declare their bases in
+	// manifest.yaml or that define workload containers.
+	FormatV2
+)
+
+// String returns the string representation of f.
+func (f Format) String() string {
+	switch f {
+	case FormatV1:
+		return "v1"
+	case FormatV2:
+		return "v2"
+	}
+	return "unknown"
+}
+
+// Capabilities holds the features of the charm format used by a charm.
+type Capabilities struct {
+	// HasContainers holds whether the charm defines
+	// workload containers in its metadata.
+	HasContainers bool
+
+	// HasBases holds whether the charm declares its bases
+	// in a manifest.yaml file.
+	HasBases bool
+
+	// UsesDispatch holds whether the charm has a dispatch
+	// script that is run in place of individual hooks.
+	UsesDispatch bool
+
+	// The remaining fields are only filled in by CapabilitiesOf.
+
+	// SupportsKubernetes holds whether the charm may be
+	// deployed to Kubernetes.
+	SupportsKubernetes bool
+
+	// RequiresTrust holds whether the charm has a relation
+	// over an interface that gives access to the credentials of
+	// the cloud, such as "aws-integration", so that it must be
+	// trusted by the operator when deployed.
+	RequiresTrust bool
+
+	// NeedsLXDProfile holds whether the charm has an
+	// lxd-profile.yaml file to be applied to the LXD
+	// containers its units are deployed to.
+	NeedsLXDProfile bool
+
+	// MinJujuVersion holds the minimum version of Juju
+	// required by the charm, or the empty string if the charm
+	// does not declare one.
+	MinJujuVersion string
+
+	// UsesResources holds whether the charm defines resources.
+	UsesResources bool
+}
+
+// FormatOf returns the format of the charm with the given metadata and
+// manifest, as returned by CharmArchive.Manifest, along with the
+// capabilities it uses, so that callers can branch on the format once
+// instead of inspecting individual fields and files.
+func FormatOf(meta *Meta, manifest set.Strings) (Format, Capabilities) {
+	caps := Capabilities{
+		HasContainers: len(meta.Containers) > 0,
+		HasBases:      manifest.Contains(ManifestFile),
+		UsesDispatch:  manifest.Contains(DispatchFile),
+	}
+	if caps.HasBases || caps.HasContainers {
+		return FormatV2, caps
+	}
+	return FormatV1, caps
+}
+
+// trustInterfaces holds the relation interfaces that give charms
+// access to the credentials of the cloud.
+var trustInterfaces = set.NewStrings(
+	"aws-integration",
+	"azure-integration",
+	"gcp-integration",
+	"openstack-integration",
+	"vsphere-integration",
+)
+
+// CapabilitiesOf returns all the capabilities of the given charm, so
+// that deployment pre-checks have a single value to consult. The
+// files of charm directories and archives are inspected; only the
+// metadata is consulted for other implementations of Charm.
+func CapabilitiesOf(ch Charm) (Capabilities, error) {
+	meta := ch.Meta()
+	manifest := set.NewStrings()
+	if ch, ok := ch.(interface {
+		FS() fs.FS
+	}); ok {
+		entries, err := fs.ReadDir(ch.FS(), ".")
+		if err != nil {
+			return Capabilities{}, err
+		}
+		for _, entry := range entries {
+			manifest.Add(entry.Name())
+		}
+	}
+	_, caps := FormatOf(meta, manifest)
+	caps.SupportsKubernetes = caps.HasContainers
+	for _, series := range meta.supportedSeries() {
+		if series == KubernetesSeries {
+			caps.SupportsKubernetes = true
+		}
+	}
+	for _, rels := range []map[string]Relation{meta.Provides, meta.Requires} {
+		for _, rel := range rels {
+			if trustInterfaces.Contains(rel.Interface) {
+				caps.RequiresTrust = true
+			}
+		}
+	}
+	caps.NeedsLXDProfile = manifest.Contains(LXDProfileFile)
+	caps.MinJujuVersion = meta.MinJujuVersion
+	caps.UsesResources = len(meta.Resources) > 0
+	return caps, nil
+}
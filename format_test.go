@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/utils/set"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type FormatSuite struct{}
+
+var _ = gc.Suite(&FormatSuite{})
+
+var formatOfTests = []struct {
+	about        string
+	manifest     []string
+	expectFormat charm.Format
+	expectCaps   charm.Capabilities
+}{{
+	about:        "hooks only",
+	manifest:     []string{"metadata.yaml", "hooks", "hooks/install"},
+	expectFormat: charm.FormatV1,
+}, {
+	about:        "dispatch without bases",
+	manifest:     []string{"metadata.yaml", "dispatch"},
+	expectFormat: charm.FormatV1,
+	expectCaps:   charm.Capabilities{UsesDispatch: true},
+}, {
+	about:        "bases and dispatch",
+	manifest:     []string{"metadata.yaml", "manifest.yaml", "dispatch"},
+	expectFormat: charm.FormatV2,
+	expectCaps:   charm.Capabilities{HasBases: true, UsesDispatch: true},
+}}
+
+func (s *FormatSuite) TestFormatOfContainers(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(sidecarMetadata))
+	c.Assert(err, gc.IsNil)
+	format, caps := charm.FormatOf(meta, set.NewStrings("metadata.yaml", "dispatch"))
+	c.Assert(format, gc.Equals, charm.FormatV2)
+	c.Assert(caps, gc.Equals, charm.Capabilities{HasContainers: true, UsesDispatch: true})
+}
+
+func (s *FormatSuite) TestFormatOf(c *gc.C) {
+	meta := &charm.Meta{Name: "a"}
+	for i, test := range formatOfTests {
+		c.Logf("test %d: %s", i, test.about)
+		format, caps := charm.FormatOf(meta, set.NewStrings(test.manifest...))
+		c.Check(format, gc.Equals, test.expectFormat)
+		c.Check(caps, gc.Equals, test.expectCaps)
+	}
+}
+
+func (s *FormatSuite) TestFormatOfArchive(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	format, caps := charm.FormatOf(archive.Meta(), manifest)
+	c.Assert(format, gc.Equals, charm.FormatV1)
+	c.Assert(caps, gc.Equals, charm.Capabilities{})
+}
+
+func (s *FormatSuite) TestString(c *gc.C) {
+	c.Assert(charm.FormatV1.String(), gc.Equals, "v1")
+	c.Assert(charm.FormatV2.String(), gc.Equals, "v2")
+	c.Assert(charm.FormatUnknown.String(), gc.Equals, "unknown")
+}
+
+func (s *FormatSuite) TestCapabilitiesOfDir(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "lxd-profile.yaml"), []byte("config: {}\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	dir.Meta().MinJujuVersion = "2.9"
+	dir.Meta().Requires = map[string]charm.Relation{
+		"aws": {Name: "aws", Role: charm.RoleRequirer, Interface: "aws-integration", Scope: charm.ScopeGlobal},
+	}
+	caps, err := charm.CapabilitiesOf(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(caps, gc.Equals, charm.Capabilities{
+		RequiresTrust:   true,
+		NeedsLXDProfile: true,
+		MinJujuVersion:  "2.9",
+	})
+}
+
+func (s *FormatSuite) TestCapabilitiesOfArchive(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	caps, err := charm.CapabilitiesOf(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(caps, gc.Equals, charm.Capabilities{})
+}
+
+func (s *FormatSuite) TestCapabilitiesOfMetaOnly(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(sidecarMetadata))
+	c.Assert(err, gc.IsNil)
+	ch := testCharm("sidecar", "").(testCharmImpl)
+	ch.meta = meta
+	caps, err := charm.CapabilitiesOf(ch)
+	c.Assert(err, gc.IsNil)
+	c.Assert(caps, gc.Equals, charm.Capabilities{
+		HasContainers:      true,
+		SupportsKubernetes: true,
+		UsesResources:      true,
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// HookFile describes the file run for a hook,
+// as recorded by HookInventory.
+type HookFile struct {
+	// SHA256 holds the hex-encoded SHA256 hash of the contents
+	// of the file run for the hook, or the empty string if the
+	// hook is a symbolic link that cannot be resolved to a file
+	// inside the charm.
+	SHA256 string
+
+	// Executable holds whether the file run for the hook
+	// is executable.
+	Executable bool
+}
+
+// HookDiff describes the differences between the hooks
+// of two revisions of a charm, as found by DiffHooks.
+type HookDiff struct {
+	// Added holds the names of the hooks found only in the new
+	// revision, Removed those found only in the old revision,
+	// and Changed those whose files differ, all sorted by name.
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether the hooks of the two revisions are the same.
+func (d *HookDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Issues returns the differences as upgrade issues, so that they
+// can be reported along with those found by CheckUpgrade. Removed
+// hooks are reported as warnings, as the events they handled are no
+// longer acted upon.
+func (d *HookDiff) Issues() UpgradeIssues {
+	c := &upgradeChecker{}
+	for _, name := range d.Removed {
+		c.addf(SeverityWarning, "hook %q removed", name)
+	}
+	for _, name := range d.Added {
+		c.addf(SeverityInfo, "hook %q added", name)
+	}
+	for _, name := range d.Changed {
+		c.addf(SeverityInfo, "hook %q changed", name)
+	}
+	sort.Sort(c.issues)
+	return c.issues
+}
+
+// hookCharm is implemented by the charms whose hook
+// files can be read, such as *CharmDir and *CharmArchive.
+type hookCharm interface {
+	Charm
+	HookImplementations() (map[string]HookImplementation, error)
+	UsesDispatch() (bool, error)
+	FS() fs.FS
+}
+
+// HookInventory returns the files run for the hooks of the given
+// charm, which must be a *CharmDir or a *CharmArchive, indexed by
+// hook name. Hooks implemented by symbolic links are described by
+// the files the links lead to, so that the hooks of a charm that
+// uses dispatch all change when its dispatch script does.
+func HookInventory(ch Charm) (map[string]HookFile, error) {
+	hc, ok := ch.(hookCharm)
+	if !ok {
+		return nil, fmt.Errorf("cannot read the hooks of a charm of type %T", ch)
+	}
+	impls, err := hc.HookImplementations()
+	if err != nil {
+		return nil, err
+	}
+	fsys := hc.FS()
+	hashes := make(map[string]string)
+	inventory := make(map[string]HookFile)
+	for name, impl := range impls {
+		file := HookFile{
+			Executable: impl.Executable,
+		}
+		if impl.Target != "" {
+			hash, ok := hashes[impl.Target]
+			if !ok {
+				hash, err = fileSHA256(fsys, impl.Target)
+				if err != nil {
+					return nil, fmt.Errorf("cannot read hook %q: %v", name, err)
+				}
+				hashes[impl.Target] = hash
+			}
+			file.SHA256 = hash
+		}
+		inventory[name] = file
+	}
+	return inventory, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA256 hash
+// of the contents of the named file of fsys.
+func fileSHA256(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// DiffHooks compares the hooks of the old and new revisions of a
+// charm, as returned by HookInventory, so that upgrade pre-checks
+// can warn when the behaviour of the charm through its lifecycle is
+// likely to change. A hook is changed if the contents of its file
+// differ, or if it was made executable or not executable.
+func DiffHooks(oldCh, newCh Charm) (*HookDiff, error) {
+	oldHooks, err := HookInventory(oldCh)
+	if err != nil {
+		return nil, err
+	}
+	newHooks, err := HookInventory(newCh)
+	if err != nil {
+		return nil, err
+	}
+	return diffHookInventories(oldHooks, newHooks), nil
+}
+
+func diffHookInventories(oldHooks, newHooks map[string]HookFile) *HookDiff {
+	var d HookDiff
+	for name, oldFile := range oldHooks {
+		newFile, ok := newHooks[name]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, name)
+		case newFile != oldFile:
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for name := range newHooks {
+		if _, ok := oldHooks[name]; !ok {
+			d.Added = append(d.Added, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return &d
+}
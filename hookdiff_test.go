@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type HookDiffSuite struct{}
+
+var _ = gc.Suite(&HookDiffSuite{})
+
+// writeHook writes the named hook of the charm in dir.
+func writeHook(c *gc.C, dir, name, content string, perm os.FileMode) {
+	err := ioutil.WriteFile(filepath.Join(dir, "hooks", name), []byte(content), perm)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *HookDiffSuite) TestDiffHooks(c *gc.C) {
+	oldPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	writeHook(c, oldPath, "start", "#!/bin/sh\necho start\n", 0755)
+	writeHook(c, oldPath, "stop", "#!/bin/sh\necho stop\n", 0755)
+	writeHook(c, oldPath, "config-changed", "#!/bin/sh\necho config\n", 0755)
+
+	newPath := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	writeHook(c, newPath, "start", "#!/bin/sh\necho started\n", 0755)
+	writeHook(c, newPath, "config-changed", "#!/bin/sh\necho config\n", 0644)
+	writeHook(c, newPath, "upgrade-charm", "#!/bin/sh\necho upgrade\n", 0755)
+
+	oldDir, err := charm.ReadCharmDir(oldPath)
+	c.Assert(err, jc.ErrorIsNil)
+	newDir, err := charm.ReadCharmDir(newPath)
+	c.Assert(err, jc.ErrorIsNil)
+
+	d, err := charm.DiffHooks(oldDir, newDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(d, jc.DeepEquals, &charm.HookDiff{
+		Added:   []string{"upgrade-charm"},
+		Removed: []string{"stop"},
+		Changed: []string{"config-changed", "start"},
+	})
+	c.Assert(d.Empty(), jc.IsFalse)
+	c.Assert(d.Issues(), jc.DeepEquals, charm.UpgradeIssues{{
+		Severity: charm.SeverityWarning,
+		Message:  `hook "stop" removed`,
+	}, {
+		Severity: charm.SeverityInfo,
+		Message:  `hook "config-changed" changed`,
+	}, {
+		Severity: charm.SeverityInfo,
+		Message:  `hook "start" changed`,
+	}, {
+		Severity: charm.SeverityInfo,
+		Message:  `hook "upgrade-charm" added`,
+	}})
+}
+
+func (s *HookDiffSuite) TestDiffHooksArchive(c *gc.C) {
+	dir := TestCharms.CharmDir("dummy")
+	archive, err := charm.ReadCharmArchive(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, jc.ErrorIsNil)
+	d, err := charm.DiffHooks(dir, archive)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(d.Empty(), jc.IsTrue)
+}
+
+func (s *HookDiffSuite) TestHookInventorySymlinks(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "dispatch"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	for _, name := range []string{"start", "stop"} {
+		err := os.Symlink("../dispatch", filepath.Join(path, "hooks", name))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	err = os.Symlink("../../outside", filepath.Join(path, "hooks", "broken"))
+	c.Assert(err, jc.ErrorIsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, jc.ErrorIsNil)
+
+	inventory, err := charm.HookInventory(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(inventory["start"], gc.Equals, inventory["stop"])
+	c.Assert(inventory["start"].SHA256, gc.Not(gc.Equals), "")
+	c.Assert(inventory["start"].Executable, jc.IsTrue)
+	c.Assert(inventory["broken"], gc.Equals, charm.HookFile{})
+}
+
+func (s *HookDiffSuite) TestHookInventoryUnsupportedCharm(c *gc.C) {
+	_, err := charm.HookInventory(testCharmImpl{})
+	c.Assert(err, gc.ErrorMatches, `cannot read the hooks of a charm of type charm_test.testCharmImpl`)
+}
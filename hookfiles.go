@@ -0,0 +1,248 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxHookLinks holds the maximum number of symbolic links followed
+// when resolving a hook, so that link cycles are not followed forever.
+const maxHookLinks = 16
+
+// HookImplementation describes a file found in the hooks directory
+// of a charm.
+type HookImplementation struct {
+	// Symlink holds the target of the hook file if it is a symbolic
+	// link, as stored in the charm.
+	Symlink string
+
+	// Target holds the slash-separated path, relative to the root of
+	// the charm, of the file that is run for the hook once symbolic
+	// links have been followed. It is empty if the hook is a symbolic
+	// link that cannot be resolved to a file inside the charm.
+	Target string
+
+	// Executable holds whether the file run for the hook is
+	// executable. Hook files that are not executable are not run.
+	Executable bool
+}
+
+// Dispatch reports whether the hook runs the dispatch script of
+// the charm, as is the case for the hook symlinks created by charm
+// build tools for the benefit of agents that do not know about
+// dispatch.
+func (h HookImplementation) Dispatch() bool {
+	return h.Target == DispatchFile
+}
+
+// UsesDispatch reports whether the charm has a dispatch script, in
+// which case it is run in place of individual hooks and actions.
+func (dir *CharmDir) UsesDispatch() (bool, error) {
+	return usesDispatch(dirHookFiles{dir})
+}
+
+// HookImplementations returns the files found in the hooks directory
+// of the charm, indexed by hook name. Hidden files and directories
+// are ignored. A charm that uses dispatch may have no hooks at all.
+func (dir *CharmDir) HookImplementations() (map[string]HookImplementation, error) {
+	return hookImplementations(dirHookFiles{dir})
+}
+
+// UsesDispatch reports whether the charm has a dispatch script, in
+// which case it is run in place of individual hooks and actions.
+func (a *CharmArchive) UsesDispatch() (bool, error) {
+	files, err := a.hookFiles()
+	if err != nil {
+		return false, err
+	}
+	defer files.zipr.Close()
+	return usesDispatch(files)
+}
+
+// HookImplementations returns the files found in the hooks directory
+// of the charm, indexed by hook name. Hidden files and directories
+// are ignored. A charm that uses dispatch may have no hooks at all.
+func (a *CharmArchive) HookImplementations() (map[string]HookImplementation, error) {
+	files, err := a.hookFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer files.zipr.Close()
+	return hookImplementations(files)
+}
+
+func (a *CharmArchive) hookFiles() (*archiveHookFiles, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	files := &archiveHookFiles{
+		zipr:  zipr,
+		files: make(map[string]*zip.File),
+	}
+	for _, fh := range zipr.File {
+		files.files[path.Clean(fh.Name)] = fh
+	}
+	return files, nil
+}
+
+// hookFiles gives access to the files of a charm that
+// determine how its hooks are run.
+type hookFiles interface {
+	// lstat returns the mode of the file at the given
+	// slash-separated path and, if it is a symbolic link, its
+	// target. It returns an error satisfying os.IsNotExist
+	// if there is no such file.
+	lstat(p string) (mode os.FileMode, link string, err error)
+
+	// hookNames returns the names of the entries of the
+	// hooks directory.
+	hookNames() ([]string, error)
+}
+
+func usesDispatch(files hookFiles) (bool, error) {
+	mode, _, err := files.lstat(DispatchFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !mode.IsDir(), nil
+}
+
+func hookImplementations(files hookFiles) (map[string]HookImplementation, error) {
+	names, err := files.hookNames()
+	if err != nil {
+		return nil, err
+	}
+	hooks := make(map[string]HookImplementation)
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		p := path.Join(HooksDir, name)
+		mode, link, err := files.lstat(p)
+		if err != nil {
+			return nil, err
+		}
+		if mode.IsDir() {
+			continue
+		}
+		hook := HookImplementation{
+			Symlink: link,
+		}
+		if link == "" {
+			hook.Target = p
+			hook.Executable = mode&0111 != 0
+		} else if target, mode, ok, err := resolveHookLink(files, p, link); err != nil {
+			return nil, err
+		} else if ok && !mode.IsDir() {
+			hook.Target = target
+			hook.Executable = mode&0111 != 0
+		}
+		hooks[name] = hook
+	}
+	return hooks, nil
+}
+
+// resolveHookLink follows the symbolic link at p, which has the
+// given target, and returns the path and mode of the file it
+// eventually refers to. It returns false if the link does not lead
+// to an existing file inside the charm.
+func resolveHookLink(files hookFiles, p, link string) (string, os.FileMode, bool, error) {
+	for i := 0; i < maxHookLinks; i++ {
+		if path.IsAbs(link) {
+			return "", 0, false, nil
+		}
+		p = path.Join(path.Dir(p), link)
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return "", 0, false, nil
+		}
+		mode, next, err := files.lstat(p)
+		if os.IsNotExist(err) {
+			return "", 0, false, nil
+		}
+		if err != nil {
+			return "", 0, false, err
+		}
+		if next == "" {
+			return p, mode, true, nil
+		}
+		link = next
+	}
+	return "", 0, false, nil
+}
+
+// dirHookFiles implements hookFiles for a charm directory.
+type dirHookFiles struct {
+	dir *CharmDir
+}
+
+func (files dirHookFiles) lstat(p string) (os.FileMode, string, error) {
+	info, err := os.Lstat(files.dir.join(p))
+	if err != nil {
+		return 0, "", err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return info.Mode(), "", nil
+	}
+	link, err := os.Readlink(files.dir.join(p))
+	if err != nil {
+		return 0, "", err
+	}
+	return info.Mode(), link, nil
+}
+
+func (files dirHookFiles) hookNames() ([]string, error) {
+	infos, err := ioutil.ReadDir(files.dir.join(HooksDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, nil
+}
+
+// archiveHookFiles implements hookFiles for a charm archive.
+type archiveHookFiles struct {
+	zipr  *zipReadCloser
+	files map[string]*zip.File
+}
+
+func (files *archiveHookFiles) lstat(p string) (os.FileMode, string, error) {
+	fh, ok := files.files[p]
+	if !ok {
+		return 0, "", &os.PathError{Op: "lstat", Path: p, Err: os.ErrNotExist}
+	}
+	mode := fh.Mode()
+	if mode&os.ModeSymlink == 0 {
+		return mode, "", nil
+	}
+	link, err := readZipFile(fh)
+	if err != nil {
+		return 0, "", err
+	}
+	return mode, string(link), nil
+}
+
+func (files *archiveHookFiles) hookNames() ([]string, error) {
+	var names []string
+	for p := range files.files {
+		if dir, name := path.Split(p); dir == "hooks/" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type HookFilesSuite struct{}
+
+var _ = gc.Suite(&HookFilesSuite{})
+
+type hookCharm interface {
+	UsesDispatch() (bool, error)
+	HookImplementations() (map[string]charm.HookImplementation, error)
+}
+
+// dispatchCharmDir returns the path of a copy of the dummy charm
+// that uses dispatch, with hooks that are symbolic links to it.
+func dispatchCharmDir(c *gc.C) string {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "dispatch"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(path, "hooks", "helpers.sh"), nil, 0644)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(path, "hooks", ".hidden"), nil, 0755)
+	c.Assert(err, gc.IsNil)
+	links := []struct {
+		name, target string
+	}{
+		{"start", "../dispatch"},
+		{"stop", "start"},
+		{"upgrade-charm", "../missing"},
+	}
+	for _, link := range links {
+		if err := os.Symlink(link.target, filepath.Join(path, "hooks", link.name)); err != nil {
+			c.Skip("cannot symlink")
+		}
+	}
+	return path
+}
+
+func (s *HookFilesSuite) TestCharmDir(c *gc.C) {
+	dir, err := charm.ReadCharmDir(dispatchCharmDir(c))
+	c.Assert(err, gc.IsNil)
+	s.checkDispatchCharm(c, dir)
+}
+
+func (s *HookFilesSuite) TestCharmArchive(c *gc.C) {
+	s.checkDispatchCharm(c, archiveDir(c, dispatchCharmDir(c)))
+}
+
+func (s *HookFilesSuite) checkDispatchCharm(c *gc.C, ch hookCharm) {
+	ok, err := ch.UsesDispatch()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ok, jc.IsTrue)
+
+	hooks, err := ch.HookImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hooks, jc.DeepEquals, map[string]charm.HookImplementation{
+		"install": {
+			Target:     "hooks/install",
+			Executable: true,
+		},
+		"helpers.sh": {
+			Target: "hooks/helpers.sh",
+		},
+		"start": {
+			Symlink:    "../dispatch",
+			Target:     "dispatch",
+			Executable: true,
+		},
+		"stop": {
+			Symlink:    "start",
+			Target:     "dispatch",
+			Executable: true,
+		},
+		"upgrade-charm": {
+			Symlink: "../missing",
+		},
+	})
+	c.Assert(hooks["install"].Dispatch(), jc.IsFalse)
+	c.Assert(hooks["start"].Dispatch(), jc.IsTrue)
+	c.Assert(hooks["stop"].Dispatch(), jc.IsTrue)
+	c.Assert(hooks["upgrade-charm"].Dispatch(), jc.IsFalse)
+}
+
+func (s *HookFilesSuite) TestNoDispatch(c *gc.C) {
+	dir := TestCharms.CharmDir("dummy")
+	ok, err := dir.UsesDispatch()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ok, jc.IsFalse)
+	hooks, err := dir.HookImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hooks, jc.DeepEquals, map[string]charm.HookImplementation{
+		"install": {
+			Target:     "hooks/install",
+			Executable: true,
+		},
+	})
+
+	archive := TestCharms.CharmArchive(c.MkDir(), "dummy")
+	ok, err = archive.UsesDispatch()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (s *HookFilesSuite) TestNoHooksDirectory(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.RemoveAll(filepath.Join(path, "hooks"))
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	hooks, err := dir.HookImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(hooks, gc.HasLen, 0)
+}
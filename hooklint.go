@@ -0,0 +1,174 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// windowsHookExtensions holds the extensions of the
+// hook files that can only be run on Windows.
+var windowsHookExtensions = map[string]bool{
+	".ps1": true,
+	".cmd": true,
+	".bat": true,
+	".exe": true,
+}
+
+// elfMagic starts executable binaries, which have no shebang line.
+const elfMagic = "\x7fELF"
+
+// maxLintedHookSize holds the number of bytes of each hook file
+// inspected by LintHooks. Larger files are only partly inspected,
+// which is enough for the interpreter line and for binaries.
+const maxLintedHookSize = 64 * 1024
+
+// LintHooks inspects the hook files of ch, and the dispatch script if
+// there is one, for problems that would make hooks fail when they are
+// run, which are otherwise only reported by the agent running them.
+// It returns warnings with the following codes, sorted by message:
+//
+//   - CodeHookWindowsOnly: a Windows script or executable, such as
+//     hooks/install.ps1, in a charm supporting a Linux series;
+//   - CodeHookNoShebang: a script with no "#!" interpreter line;
+//   - CodeHookCRLF: a script with Windows line endings, which
+//     make the interpreter line invalid;
+//   - CodeHookNotUTF8: a script that is not valid UTF-8 text.
+//
+// Files run for several hooks are inspected once, only the first
+// 64KiB of each script is inspected, and executable binaries are
+// only checked for Windows formats. LintHooks returns no
+// warnings if ch is not a *CharmDir or *CharmArchive.
+func LintHooks(ch Charm) ([]Warning, error) {
+	hc, ok := ch.(hookCharm)
+	if !ok {
+		return nil, nil
+	}
+	hooks, err := hc.HookImplementations()
+	if err != nil {
+		return nil, err
+	}
+	dispatch, err := hc.UsesDispatch()
+	if err != nil {
+		return nil, err
+	}
+	fsys := hc.FS()
+	targets := make(map[string]bool)
+	if dispatch {
+		targets[DispatchFile] = true
+	}
+	for _, hook := range hooks {
+		if hook.Target != "" {
+			targets[hook.Target] = true
+		}
+	}
+	l := &hookLinter{
+		name:  ch.Meta().Name,
+		linux: supportsLinux(ch.Meta()),
+	}
+	for target := range targets {
+		if err := l.lint(fsys, target); err != nil {
+			return nil, err
+		}
+	}
+	sortWarnings(l.warnings)
+	return l.warnings, nil
+}
+
+// supportsLinux reports whether the charm may be deployed to a Linux
+// series. Series are assumed to be Linux series unless they are known
+// Windows series, so that series released after the catalogue was
+// last updated are linted. Charms that declare no series are deployed
+// to Ubuntu by default.
+func supportsLinux(meta *Meta) bool {
+	series := meta.supportedSeries()
+	if len(series) == 0 {
+		return true
+	}
+	for _, s := range series {
+		if os, err := SeriesOS(s); err != nil || os != Windows {
+			return true
+		}
+	}
+	return false
+}
+
+type hookLinter struct {
+	name     string
+	linux    bool
+	warnings []Warning
+}
+
+// warn records a warning about the hook file at p.
+func (l *hookLinter) warn(code, p, msg string) {
+	l.warnings = append(l.warnings, warningf(code, "charm %q hook file %q %s", l.name, p, msg))
+}
+
+// lint inspects the hook file at the given slash-separated path.
+func (l *hookLinter) lint(fsys fs.FS, p string) error {
+	if windowsHookExtensions[strings.ToLower(path.Ext(p))] {
+		if l.linux {
+			l.warn(CodeHookWindowsOnly, p, "can only be run on Windows but the charm supports Linux series")
+		}
+		return nil
+	}
+	if !l.linux {
+		// Scripts are run according to their
+		// extension on Windows.
+		return nil
+	}
+	f, err := fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Read the header first, so that binaries are not read further.
+	header := make([]byte, len(elfMagic))
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if string(header[:n]) == elfMagic {
+		return nil
+	}
+	rest, err := ioutil.ReadAll(io.LimitReader(f, maxLintedHookSize-int64(n)))
+	if err != nil {
+		return err
+	}
+	data := append(header[:n], rest...)
+	if len(data) == maxLintedHookSize {
+		// Do not report a character cut by the limit as invalid.
+		data = trimPartialRune(data)
+	}
+	if !bytes.HasPrefix(data, []byte("#!")) {
+		l.warn(CodeHookNoShebang, p, "has no \"#!\" interpreter line")
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		l.warn(CodeHookCRLF, p, "has Windows line endings")
+	}
+	if !utf8.Valid(data) {
+		l.warn(CodeHookNotUTF8, p, "is not valid UTF-8 text")
+	}
+	return nil
+}
+
+// trimPartialRune removes an incomplete UTF-8
+// sequence from the end of data.
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type HookLintSuite struct{}
+
+var _ = gc.Suite(&HookLintSuite{})
+
+func (s *HookLintSuite) TestLintHooks(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	writeHook(c, path, "config-changed", "echo changed\n", 0755)
+	writeHook(c, path, "start", "#!/bin/sh\r\necho started\r\n", 0755)
+	writeHook(c, path, "stop", "#!/bin/sh\necho \xff\n", 0755)
+	writeHook(c, path, "upgrade-charm.ps1", "Write-Host upgraded\n", 0755)
+	writeHook(c, path, "binary", "\x7fELF\x02\x01\x01\xff\r\n", 0755)
+	err := os.Symlink("install", filepath.Join(path, "hooks", "update-status"))
+	c.Assert(err, gc.IsNil)
+
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	c.Assert(dir.ArchiveTo(&buf), gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	for _, ch := range []charm.Charm{dir, archive} {
+		warnings, err := charm.LintHooks(ch)
+		c.Assert(err, gc.IsNil)
+		c.Assert(warnings, jc.DeepEquals, []charm.Warning{{
+			Code:    charm.CodeHookNoShebang,
+			Message: `charm "dummy" hook file "hooks/config-changed" has no "#!" interpreter line`,
+		}, {
+			Code:    charm.CodeHookCRLF,
+			Message: `charm "dummy" hook file "hooks/start" has Windows line endings`,
+		}, {
+			Code:    charm.CodeHookNotUTF8,
+			Message: `charm "dummy" hook file "hooks/stop" is not valid UTF-8 text`,
+		}, {
+			Code:    charm.CodeHookWindowsOnly,
+			Message: `charm "dummy" hook file "hooks/upgrade-charm.ps1" can only be run on Windows but the charm supports Linux series`,
+		}})
+	}
+}
+
+func (s *HookLintSuite) TestLintHooksClean(c *gc.C) {
+	warnings, err := charm.LintHooks(TestCharms.CharmDir("dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(warnings, gc.HasLen, 0)
+}
+
+func (s *HookLintSuite) TestLintHooksUnknownSeries(c *gc.C) {
+	// Series missing from the catalogue are assumed to be Linux series.
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	appendMetadata(c, path, "series:\n    - futurama\n")
+	writeHook(c, path, "start", "echo started\n", 0755)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	warnings, err := charm.LintHooks(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeHookNoShebang,
+		Message: `charm "dummy" hook file "hooks/start" has no "#!" interpreter line`,
+	}})
+}
+
+// appendMetadata appends the given text to the
+// metadata of the charm directory at path.
+func appendMetadata(c *gc.C, path, text string) {
+	metadata := filepath.Join(path, "metadata.yaml")
+	data, err := ioutil.ReadFile(metadata)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ioutil.WriteFile(metadata, append(data, text...), 0644), gc.IsNil)
+}
+
+func (s *HookLintSuite) TestLintHooksWindowsCharm(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	appendMetadata(c, path, "series:\n    - win2016\n")
+	c.Assert(os.Remove(filepath.Join(path, "hooks", "install")), gc.IsNil)
+	writeHook(c, path, "install.ps1", "Write-Host installed\r\n", 0755)
+
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	warnings, err := charm.LintHooks(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(warnings, gc.HasLen, 0)
+}
@@ -0,0 +1,373 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// MaxIconSize holds the maximum size in bytes of a charm icon
+// accepted by ValidateIcon and SanitizeIcon.
+var MaxIconSize int64 = 1024 * 1024
+
+// ValidateIcon checks that r holds a charm icon that is safe to serve
+// to web browsers: a well-formed SVG document no larger than
+// MaxIconSize, using only the SVG elements and attributes known to be
+// safe, with no links to external resources, entity declarations or
+// processing instructions. Scripts, animations, style sheets, foreign
+// objects and event handler attributes are all rejected.
+func ValidateIcon(r io.Reader) error {
+	_, err := checkIcon(r, false)
+	return err
+}
+
+// SanitizeIcon is like ValidateIcon, but instead of failing when the
+// icon contains unsafe content, it returns a copy of the icon with that
+// content removed. An error is still returned if the icon is too
+// large or is not a well-formed SVG document.
+func SanitizeIcon(r io.Reader) ([]byte, error) {
+	return checkIcon(r, true)
+}
+
+// checkIcon implements ValidateIcon and SanitizeIcon. When sanitize is
+// true, unsafe content is left out of the returned document; otherwise
+// an error is returned as soon as it is found.
+func checkIcon(r io.Reader, sanitize bool) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxIconSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxIconSize {
+		return nil, errorCodef(CodeInvalidIcon, "icon exceeds maximum size of %d bytes", MaxIconSize)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		out       bytes.Buffer
+		stack     []xml.Name
+		skipDepth = -1
+		seenRoot  bool
+		offset    int64
+	)
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errorCodef(CodeInvalidIcon, "icon is not valid XML: %v", err)
+		}
+		raw := data[offset:dec.InputOffset()]
+		offset = dec.InputOffset()
+		var unsafe string
+		keep := raw
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				if seenRoot {
+					return nil, errorCodef(CodeInvalidIcon, "icon is not valid XML: multiple root elements")
+				}
+				if tok.Name.Local != "svg" {
+					return nil, errorCodef(CodeInvalidIcon, "icon root element is %q, not \"svg\"", tok.Name.Local)
+				}
+				seenRoot = true
+			}
+			stack = append(stack, tok.Name)
+			switch {
+			case skipDepth >= 0:
+				keep = nil
+			case !isSafeIconElement(tok.Name):
+				// The content of an unsafe element is left out
+				// with it, as its meaning depends on the element.
+				unsafe = iconName(tok.Name) + " element"
+				skipDepth = len(stack)
+				keep = nil
+			default:
+				if attrs, reason := safeIconAttrs(tok.Attr); reason != "" {
+					unsafe = reason
+					tok.Attr = attrs
+					keep = iconStartElement(tok, bytes.HasSuffix(raw, []byte("/>")))
+				}
+			}
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1] != tok.Name {
+				return nil, errorCodef(CodeInvalidIcon, "icon is not valid XML: unexpected end element </%s>", iconName(tok.Name))
+			}
+			if skipDepth >= 0 {
+				keep = nil
+				if len(stack) == skipDepth {
+					skipDepth = -1
+				}
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 && len(bytes.TrimSpace(tok)) > 0 {
+				return nil, errorCodef(CodeInvalidIcon, "icon is not valid XML: text outside the root element")
+			}
+			if skipDepth >= 0 {
+				keep = nil
+			}
+		case xml.ProcInst:
+			if tok.Target != "xml" {
+				unsafe = "processing instruction"
+				keep = nil
+			}
+		case xml.Directive:
+			unsafe = "XML directive"
+			keep = nil
+		}
+		if unsafe != "" && !sanitize {
+			return nil, errorCodef(CodeInvalidIcon, "icon contains unsafe content: %s", unsafe)
+		}
+		out.Write(keep)
+	}
+	if !seenRoot {
+		return nil, errorCodef(CodeInvalidIcon, "icon is not valid XML: no root element")
+	}
+	if len(stack) > 0 {
+		return nil, errorCodef(CodeInvalidIcon, "icon is not valid XML: unclosed element <%s>", iconName(stack[len(stack)-1]))
+	}
+	if !sanitize {
+		return data, nil
+	}
+	return out.Bytes(), nil
+}
+
+// safeIconAttrs returns the attributes in attrs that are safe to serve
+// to a web browser. If any attributes were left out, it also returns
+// a description of the first unsafe attribute found.
+func safeIconAttrs(attrs []xml.Attr) ([]xml.Attr, string) {
+	var safe []xml.Attr
+	var reason string
+	for _, attr := range attrs {
+		if r := checkIconAttr(attr); r != "" {
+			if reason == "" {
+				reason = r
+			}
+			continue
+		}
+		safe = append(safe, attr)
+	}
+	return safe, reason
+}
+
+// checkIconAttr returns a description of why the given attribute
+// is unsafe, or the empty string if it is safe.
+func checkIconAttr(attr xml.Attr) string {
+	name := attr.Name
+	switch {
+	case name.Space == "" && name.Local == "xmlns":
+		if attr.Value != svgNamespace {
+			return "namespace " + attr.Value
+		}
+		return ""
+	case name.Space == "xmlns":
+		if ns, ok := iconPrefixes[name.Local]; ok && attr.Value != ns {
+			return "namespace " + attr.Value + " for prefix " + name.Local
+		}
+		// Elements and attributes with other prefixes are
+		// never accepted, so their declarations are harmless.
+		return ""
+	case name.Local == "href" && (name.Space == "" || name.Space == "xlink"):
+		if !isSafeIconRef(attr.Value) {
+			return "reference to " + attr.Value
+		}
+		return ""
+	case name.Space == "xml" && (name.Local == "space" || name.Local == "lang"):
+		return ""
+	case name.Space == "xlink" && name.Local == "title":
+		return ""
+	case name.Space != "" || !iconAttrs[name.Local] && name.Local != "style":
+		if name.Space == "" && strings.HasPrefix(strings.ToLower(name.Local), "on") {
+			return "event handler attribute " + name.Local
+		}
+		return "attribute " + iconName(name)
+	case name.Local == "style":
+		return checkIconStyle(attr.Value)
+	}
+	return checkIconValue(attr.Value)
+}
+
+// isSafeIconRef reports whether an icon may refer to the given
+// reference, which must point either within the icon itself or to
+// embedded raster image data.
+func isSafeIconRef(ref string) bool {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	if strings.HasPrefix(ref, "#") {
+		return true
+	}
+	return strings.HasPrefix(ref, "data:image/") && !strings.HasPrefix(ref, "data:image/svg")
+}
+
+// checkIconStyle returns a description of why the given style
+// attribute is unsafe, or the empty string if it is safe. Only
+// declarations of the properties that may also be given as
+// attributes are accepted.
+func checkIconStyle(style string) string {
+	for _, decl := range strings.Split(style, ";") {
+		if strings.TrimSpace(decl) == "" {
+			continue
+		}
+		parts := strings.SplitN(decl, ":", 2)
+		prop := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !iconAttrs[prop] {
+			return "style " + strings.TrimSpace(decl)
+		}
+		if reason := checkIconValue(parts[1]); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// checkIconValue returns a description of why the given attribute
+// or style property value is unsafe, or the empty string if it is
+// safe. Values may be parsed as CSS, so escapes and at-rules are
+// rejected, and any url() must refer to a location within the icon.
+func checkIconValue(value string) string {
+	if strings.ContainsAny(value, `\@<`) {
+		return "value " + value
+	}
+	rest := strings.ToLower(value)
+	for {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return ""
+		}
+		rest = rest[i+len("url("):]
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return "value " + value
+		}
+		ref := strings.Trim(strings.TrimSpace(rest[:end]), `"'`)
+		if !strings.HasPrefix(ref, "#") {
+			return "reference to " + ref
+		}
+		rest = rest[end+1:]
+	}
+}
+
+// isSafeIconElement reports whether the element with
+// the given name may appear in an icon.
+func isSafeIconElement(name xml.Name) bool {
+	return (name.Space == "" || name.Space == "svg") && iconElements[name.Local]
+}
+
+// iconStartElement returns the serialized form of the given
+// raw start element.
+func iconStartElement(tok xml.StartElement, selfClosing bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<")
+	buf.WriteString(iconName(tok.Name))
+	for _, attr := range tok.Attr {
+		buf.WriteString(" ")
+		buf.WriteString(iconName(attr.Name))
+		buf.WriteString(`="`)
+		xml.EscapeText(&buf, []byte(attr.Value))
+		buf.WriteString(`"`)
+	}
+	if selfClosing {
+		buf.WriteString("/>")
+	} else {
+		buf.WriteString(">")
+	}
+	return buf.Bytes()
+}
+
+// iconName returns the name as it appeared in the icon, with
+// its namespace prefix if any.
+func iconName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+)
+
+// iconPrefixes holds the namespace prefixes that may be used in
+// icons, and the namespaces they must be bound to.
+var iconPrefixes = map[string]string{
+	"svg":   svgNamespace,
+	"xlink": xlinkNamespace,
+	"xml":   xmlNamespace,
+}
+
+// iconElements holds the names of the SVG elements that may appear
+// in icons. Elements not listed, including script, style, animation
+// and foreignObject elements, are unsafe.
+var iconElements = setOf(
+	"a", "circle", "clipPath", "defs", "desc", "ellipse",
+	"feBlend", "feColorMatrix", "feComponentTransfer", "feComposite",
+	"feConvolveMatrix", "feDiffuseLighting", "feDisplacementMap",
+	"feDistantLight", "feFlood", "feFuncA", "feFuncB", "feFuncG",
+	"feFuncR", "feGaussianBlur", "feImage", "feMerge", "feMergeNode",
+	"feMorphology", "feOffset", "fePointLight", "feSpecularLighting",
+	"feSpotLight", "feTile", "feTurbulence", "filter", "g", "image",
+	"line", "linearGradient", "marker", "mask", "metadata", "path",
+	"pattern", "polygon", "polyline", "radialGradient", "rect", "stop",
+	"svg", "switch", "symbol", "text", "textPath", "title", "tspan",
+	"use",
+)
+
+// iconAttrs holds the names of the unprefixed attributes, other than
+// href, xmlns and style, that may appear in icons. The same names
+// are accepted as properties in style attributes.
+var iconAttrs = setOf(
+	// Core, geometry and structural attributes.
+	"baseProfile", "class", "cx", "cy", "d", "dx", "dy", "fr", "fx",
+	"fy", "height", "id", "lengthAdjust", "method", "offset",
+	"pathLength", "points", "preserveAspectRatio", "r", "rotate", "rx",
+	"ry", "spacing", "startOffset", "textLength", "transform", "version",
+	"viewBox", "width", "x", "x1", "x2", "y", "y1", "y2", "z",
+
+	// Paint servers, clipping, masking and markers.
+	"clipPathUnits", "gradientTransform", "gradientUnits",
+	"markerHeight", "markerUnits", "markerWidth", "maskContentUnits",
+	"maskUnits", "orient", "patternContentUnits", "patternTransform",
+	"patternUnits", "refX", "refY", "spreadMethod",
+
+	// Filter primitives.
+	"amplitude", "azimuth", "baseFrequency", "bias", "diffuseConstant",
+	"divisor", "edgeMode", "elevation", "exponent", "filterUnits", "in",
+	"in2", "intercept", "k1", "k2", "k3", "k4", "kernelMatrix",
+	"kernelUnitLength", "limitingConeAngle", "mode", "numOctaves",
+	"operator", "order", "pointsAtX", "pointsAtY", "pointsAtZ",
+	"preserveAlpha", "primitiveUnits", "radius", "result", "scale", "seed",
+	"slope", "specularConstant", "specularExponent", "stdDeviation",
+	"stitchTiles", "surfaceScale", "tableValues", "targetX", "targetY",
+	"type", "values", "xChannelSelector", "yChannelSelector",
+
+	// Presentation attributes.
+	"alignment-baseline", "baseline-shift", "clip", "clip-path",
+	"clip-rule", "color", "color-interpolation",
+	"color-interpolation-filters", "color-rendering", "direction",
+	"display", "dominant-baseline", "enable-background", "fill",
+	"fill-opacity", "fill-rule", "filter", "flood-color",
+	"flood-opacity", "font-family", "font-size", "font-size-adjust",
+	"font-stretch", "font-style", "font-variant", "font-weight",
+	"image-rendering", "letter-spacing", "lighting-color", "marker",
+	"marker-end", "marker-mid", "marker-start", "mask", "opacity",
+	"overflow", "paint-order", "shape-rendering", "stop-color",
+	"stop-opacity", "stroke", "stroke-dasharray", "stroke-dashoffset",
+	"stroke-linecap", "stroke-linejoin", "stroke-miterlimit",
+	"stroke-opacity", "stroke-width", "text-anchor", "text-decoration",
+	"text-rendering", "unicode-bidi", "vector-effect", "visibility",
+	"word-spacing", "writing-mode",
+)
+
+func setOf(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
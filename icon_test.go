@@ -0,0 +1,206 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type IconSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&IconSuite{})
+
+var iconTests = []struct {
+	about     string
+	icon      string
+	expectErr string
+	sanitized string
+}{{
+	about: "simple icon",
+	icon:  `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><circle r="1"/></svg>`,
+}, {
+	about: "internal and embedded references",
+	icon:  `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#a"/><image href="data:image/png;base64,AAAA"/></svg>`,
+}, {
+	about:     "script element",
+	icon:      `<svg><script type="text/javascript">alert(1)<b/></script><circle r="1"/></svg>`,
+	expectErr: `icon contains unsafe content: script element`,
+	sanitized: `<svg><circle r="1"/></svg>`,
+}, {
+	about:     "event handler attribute",
+	icon:      `<svg onload="alert(1)" width="10"><circle r="1"></circle></svg>`,
+	expectErr: `icon contains unsafe content: event handler attribute onload`,
+	sanitized: `<svg width="10"><circle r="1"></circle></svg>`,
+}, {
+	about:     "external reference",
+	icon:      `<svg><image xlink:href="http://example.com/x.png" width="1"/></svg>`,
+	expectErr: `icon contains unsafe content: reference to http://example.com/x.png`,
+	sanitized: `<svg><image width="1"/></svg>`,
+}, {
+	about:     "javascript reference",
+	icon:      `<svg><a href=" javascript:alert(1)">x</a></svg>`,
+	expectErr: `icon contains unsafe content: reference to  javascript:alert\(1\)`,
+	sanitized: `<svg><a>x</a></svg>`,
+}, {
+	about:     "animation setting a reference",
+	icon:      `<svg><a><set attributeName="href" to="javascript:alert(1)"/><circle r="1"/></a></svg>`,
+	expectErr: `icon contains unsafe content: set element`,
+	sanitized: `<svg><a><circle r="1"/></a></svg>`,
+}, {
+	about:     "animation with values",
+	icon:      `<svg><a><animate attributeName="href" values="javascript:alert(1)"/><text>x</text></a></svg>`,
+	expectErr: `icon contains unsafe content: animate element`,
+	sanitized: `<svg><a><text>x</text></a></svg>`,
+}, {
+	about:     "foreign object",
+	icon:      `<svg><foreignObject><iframe xmlns="http://www.w3.org/1999/xhtml" src="http://example.com"/></foreignObject><g/></svg>`,
+	expectErr: `icon contains unsafe content: foreignObject element`,
+	sanitized: `<svg><g/></svg>`,
+}, {
+	about:     "style element",
+	icon:      `<svg><style>@import url(http://example.com/a.css);</style><g/></svg>`,
+	expectErr: `icon contains unsafe content: style element`,
+	sanitized: `<svg><g/></svg>`,
+}, {
+	about: "safe style attribute",
+	icon:  `<svg><rect style="fill:url(#a); stroke: #000000;stroke-width:2"/></svg>`,
+}, {
+	about:     "style attribute with external url",
+	icon:      `<svg><rect style="fill:url(http://example.com/a.png)" width="1"/></svg>`,
+	expectErr: `icon contains unsafe content: reference to http://example.com/a.png`,
+	sanitized: `<svg><rect width="1"/></svg>`,
+}, {
+	about:     "style attribute with import",
+	icon:      `<svg><rect style="@import 'http://example.com/a.css'" width="1"/></svg>`,
+	expectErr: `icon contains unsafe content: style @import 'http://example.com/a.css'`,
+	sanitized: `<svg><rect width="1"/></svg>`,
+}, {
+	about:     "style attribute with unknown property",
+	icon:      `<svg><rect style="behavior: url(#a)" width="1"/></svg>`,
+	expectErr: `icon contains unsafe content: style behavior: url\(#a\)`,
+	sanitized: `<svg><rect width="1"/></svg>`,
+}, {
+	about:     "presentation attribute with external url",
+	icon:      `<svg><rect fill="url('http://example.com/a.svg#p')" width="1"/></svg>`,
+	expectErr: `icon contains unsafe content: reference to http://example.com/a.svg#p`,
+	sanitized: `<svg><rect width="1"/></svg>`,
+}, {
+	about:     "escaped presentation attribute",
+	icon:      `<svg><rect fill="u\72l(http://example.com/a.svg)" width="1"/></svg>`,
+	expectErr: `icon contains unsafe content: value .*`,
+	sanitized: `<svg><rect width="1"/></svg>`,
+}, {
+	about:     "unknown attribute",
+	icon:      `<svg><rect requiredExtensions="x" width="1"/></svg>`,
+	expectErr: `icon contains unsafe content: attribute requiredExtensions`,
+	sanitized: `<svg><rect width="1"/></svg>`,
+}, {
+	about:     "rebound xlink prefix",
+	icon:      `<svg xmlns:xlink="http://www.w3.org/1999/xhtml"></svg>`,
+	expectErr: `icon contains unsafe content: namespace http://www.w3.org/1999/xhtml for prefix xlink`,
+	sanitized: `<svg></svg>`,
+}, {
+	about:     "prefixed element",
+	icon:      `<svg xmlns:h="http://www.w3.org/1999/xhtml"><h:script>alert(1)</h:script></svg>`,
+	expectErr: `icon contains unsafe content: h:script element`,
+	sanitized: `<svg xmlns:h="http://www.w3.org/1999/xhtml"></svg>`,
+}, {
+	about:     "entity declaration",
+	icon:      `<!DOCTYPE svg [<!ENTITY x SYSTEM "file:///etc/passwd">]><svg></svg>`,
+	expectErr: `icon contains unsafe content: XML directive`,
+	sanitized: `<svg></svg>`,
+}, {
+	about:     "processing instruction",
+	icon:      `<?xml-stylesheet href="http://example.com/a.css"?><svg></svg>`,
+	expectErr: `icon contains unsafe content: processing instruction`,
+	sanitized: `<svg></svg>`,
+}}
+
+func (s *IconSuite) TestValidateIcon(c *gc.C) {
+	for i, test := range iconTests {
+		c.Logf("test %d: %s", i, test.about)
+		err := charm.ValidateIcon(strings.NewReader(test.icon))
+		if test.expectErr == "" {
+			c.Assert(err, gc.IsNil)
+			continue
+		}
+		c.Assert(err, gc.ErrorMatches, test.expectErr)
+		c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidIcon)
+	}
+}
+
+func (s *IconSuite) TestSanitizeIcon(c *gc.C) {
+	for i, test := range iconTests {
+		c.Logf("test %d: %s", i, test.about)
+		data, err := charm.SanitizeIcon(strings.NewReader(test.icon))
+		c.Assert(err, gc.IsNil)
+		expect := test.sanitized
+		if expect == "" {
+			expect = test.icon
+		}
+		c.Assert(string(data), gc.Equals, expect)
+		c.Assert(charm.ValidateIcon(strings.NewReader(string(data))), gc.IsNil)
+	}
+}
+
+var invalidIconTests = []struct {
+	about     string
+	icon      string
+	expectErr string
+}{{
+	about:     "not XML",
+	icon:      `not an icon`,
+	expectErr: `icon is not valid XML: text outside the root element`,
+}, {
+	about:     "empty",
+	icon:      ``,
+	expectErr: `icon is not valid XML: no root element`,
+}, {
+	about:     "wrong root element",
+	icon:      `<html></html>`,
+	expectErr: `icon root element is "html", not "svg"`,
+}, {
+	about:     "mismatched elements",
+	icon:      `<svg><g></svg>`,
+	expectErr: `icon is not valid XML: unexpected end element </svg>`,
+}, {
+	about:     "unclosed element",
+	icon:      `<svg><g>`,
+	expectErr: `icon is not valid XML: unclosed element <g>`,
+}, {
+	about:     "multiple roots",
+	icon:      `<svg></svg><svg></svg>`,
+	expectErr: `icon is not valid XML: multiple root elements`,
+}, {
+	about:     "undefined entity",
+	icon:      `<svg>&xxe;</svg>`,
+	expectErr: `icon is not valid XML: .*`,
+}}
+
+func (s *IconSuite) TestInvalidIcon(c *gc.C) {
+	for i, test := range invalidIconTests {
+		c.Logf("test %d: %s", i, test.about)
+		err := charm.ValidateIcon(strings.NewReader(test.icon))
+		c.Assert(err, gc.ErrorMatches, test.expectErr)
+		c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidIcon)
+		_, err = charm.SanitizeIcon(strings.NewReader(test.icon))
+		c.Assert(err, gc.ErrorMatches, test.expectErr)
+	}
+}
+
+func (s *IconSuite) TestIconTooLarge(c *gc.C) {
+	s.PatchValue(&charm.MaxIconSize, int64(20))
+	err := charm.ValidateIcon(strings.NewReader(`<svg>` + strings.Repeat(" ", 20) + `</svg>`))
+	c.Assert(err, gc.ErrorMatches, `icon exceeds maximum size of 20 bytes`)
+	err = charm.ValidateIcon(strings.NewReader(`<svg></svg>`))
+	c.Assert(err, jc.ErrorIsNil)
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// internShardCount holds the number of independently locked shards of
+// the intern table, which keeps lock contention low when many
+// goroutines intern URLs at the same time.
+const internShardCount = 32
+
+type internShard struct {
+	mu   sync.RWMutex
+	urls map[URL]*URL
+}
+
+var internTable [internShardCount]internShard
+
+// Intern returns a canonical URL equal to url. All calls to Intern with
+// equal URLs return the same pointer, so that programs holding many
+// copies of the same URL share memory, and pointer equality can be used
+// as a fast pre-check before comparing interned URLs.
+//
+// The returned URL is shared and must not be modified. Interned URLs
+// are never released, so Intern should only be used for URLs that are
+// expected to stay in use for the lifetime of the program.
+func Intern(url *URL) *URL {
+	if url == nil {
+		return nil
+	}
+	shard := &internTable[internShardIndex(url)]
+	shard.mu.RLock()
+	interned, ok := shard.urls[*url]
+	shard.mu.RUnlock()
+	if ok {
+		return interned
+	}
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if interned, ok := shard.urls[*url]; ok {
+		return interned
+	}
+	if shard.urls == nil {
+		shard.urls = make(map[URL]*URL)
+	}
+	// Store a copy so that later changes to url made by the
+	// caller do not affect the canonical value.
+	interned = new(URL)
+	*interned = *url
+	shard.urls[*interned] = interned
+	return interned
+}
+
+// internShardIndex returns the index of the intern table shard
+// holding URLs equal to url.
+func internShardIndex(url *URL) int {
+	h := fnv.New32a()
+	for _, s := range []string{url.Schema, url.User, url.Name, url.Series} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return int((h.Sum32() ^ uint32(url.Revision)) % internShardCount)
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"sync"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type InternSuite struct{}
+
+var _ = gc.Suite(&InternSuite{})
+
+func (s *InternSuite) TestIntern(c *gc.C) {
+	url1 := charm.MustParseURL("cs:~who/trusty/intern-test-42")
+	url2 := charm.MustParseURL("cs:~who/trusty/intern-test-42")
+	c.Assert(url1, gc.Not(gc.Equals), url2)
+
+	interned1 := charm.Intern(url1)
+	interned2 := charm.Intern(url2)
+	c.Assert(interned1, gc.Equals, interned2)
+	c.Assert(*interned1, gc.Equals, *url1)
+
+	// Different URLs are interned separately.
+	other := charm.Intern(url1.WithRevision(43))
+	c.Assert(other, gc.Not(gc.Equals), interned1)
+	c.Assert(other.Revision, gc.Equals, 43)
+
+	// Changing the original URL does not affect the interned one.
+	url1.Name = "changed"
+	c.Assert(interned1.Name, gc.Equals, "intern-test")
+	c.Assert(charm.Intern(url2), gc.Equals, interned1)
+}
+
+func (s *InternSuite) TestInternNil(c *gc.C) {
+	c.Assert(charm.Intern(nil), gc.IsNil)
+}
+
+func (s *InternSuite) TestInternConcurrent(c *gc.C) {
+	const n = 50
+	results := make([]*charm.URL, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = charm.Intern(charm.MustParseURL("cs:precise/intern-concurrent-1"))
+		}(i)
+	}
+	wg.Wait()
+	for _, url := range results {
+		c.Assert(url, gc.Equals, results[0])
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxLicenseFileSize holds the number of bytes of each license file
+// read when trying to identify the license it holds.
+const maxLicenseFileSize = 64 * 1024
+
+// licenseFilePrefixes holds the upper case prefixes of the names
+// of the files recognized as holding license terms.
+var licenseFilePrefixes = []string{"LICENSE", "LICENCE", "COPYING", "UNLICENSE"}
+
+// LicenseReport describes the licensing of a charm, as returned by
+// the Licenses methods of CharmDir and CharmArchive.
+type LicenseReport struct {
+	// Expression holds the license declared by the license field of
+	// the charm metadata, if any, which should be an SPDX license
+	// expression such as "Apache-2.0 OR MIT".
+	Expression string
+
+	// Files holds the license files found in the charm,
+	// sorted by path.
+	Files []LicenseFile
+}
+
+// LicenseFile describes a file holding license terms,
+// such as LICENSE, COPYING or LICENSE-MIT.txt.
+type LicenseFile struct {
+	// Path holds the slash-separated path of the file,
+	// relative to the root of the charm.
+	Path string
+
+	// Identifier holds the SPDX license expression for the
+	// file, taken from an SPDX-License-Identifier line or
+	// derived from well-known license text. It is empty if
+	// the license was not identified.
+	Identifier string
+}
+
+// Licenses returns a report on the licensing of the charm, made from
+// the license field of its metadata and the license files found
+// anywhere in the charm, such as in vendored libraries. Hidden
+// files and directories and the build directory are not searched, as
+// they are not archived.
+func (dir *CharmDir) Licenses() (*LicenseReport, error) {
+	return readLicenses(dir.FS(), dir.Meta())
+}
+
+// Licenses returns a report on the licensing of the charm, made from
+// the license field of its metadata and the license files found
+// anywhere in the charm, such as in vendored libraries.
+func (a *CharmArchive) Licenses() (*LicenseReport, error) {
+	return readLicenses(a.FS(), a.Meta())
+}
+
+// Validate checks that the license expression declared in the
+// metadata and the identifiers found in license files are valid
+// SPDX license expressions, as checked by ValidateSPDXExpression.
+// It returns an error if no license is declared or found at all.
+func (r *LicenseReport) Validate() error {
+	if r.Expression == "" && len(r.Files) == 0 {
+		return errorCodef(CodeInvalidLicense, "charm has no license")
+	}
+	if r.Expression != "" {
+		if err := ValidateSPDXExpression(r.Expression); err != nil {
+			return annotateCodef(CodeInvalidLicense, err, "metadata: %v", err)
+		}
+	}
+	for _, f := range r.Files {
+		if f.Identifier == "" {
+			continue
+		}
+		if err := ValidateSPDXExpression(f.Identifier); err != nil {
+			return annotateCodef(CodeInvalidLicense, err, "%s: %v", f.Path, err)
+		}
+	}
+	return nil
+}
+
+func readLicenses(fsys fs.FS, meta *Meta) (*LicenseReport, error) {
+	report := &LicenseReport{
+		Expression: strings.TrimSpace(meta.License),
+	}
+	err := walkCharmFiles(fsys, func(p string, d fs.DirEntry) error {
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if !isLicenseFile(path.Base(p)) {
+			return nil
+		}
+		id, err := identifyLicenseFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		report.Files = append(report.Files, LicenseFile{
+			Path:       p,
+			Identifier: id,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(licenseFilesByPath(report.Files))
+	return report, nil
+}
+
+// isLicenseFile reports whether a file with the given name is
+// expected to hold license terms. Names are matched without regard
+// to case, and may have a suffix such as ".txt" or "-MIT".
+func isLicenseFile(name string) bool {
+	name = strings.ToUpper(name)
+	for _, prefix := range licenseFilePrefixes {
+		if name == prefix || strings.HasPrefix(name, prefix+".") || strings.HasPrefix(name, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+var spdxIdentifierLine = regexp.MustCompile(`SPDX-License-Identifier:\s*(.*?)\s*(\*/|-->)?\s*$`)
+
+// wellKnownLicenses holds the text that identifies the licenses
+// recognised in license files without an SPDX-License-Identifier
+// line. All the fragments must be present, once white space has
+// been collapsed.
+var wellKnownLicenses = []struct {
+	id        string
+	fragments []string
+}{
+	{"Apache-2.0", []string{"Apache License", "Version 2.0, January 2004"}},
+	{"MPL-2.0", []string{"Mozilla Public License Version 2.0"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge", "THE SOFTWARE IS PROVIDED \"AS IS\""}},
+}
+
+// identifyLicenseFile returns the SPDX license expression for
+// the license file at p, or the empty string if it is unknown.
+func identifyLicenseFile(fsys fs.FS, p string) (string, error) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(f, maxLicenseFileSize))
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if m := spdxIdentifierLine.FindStringSubmatch(scanner.Text()); m != nil {
+			return m[1], nil
+		}
+	}
+	text := strings.Join(strings.Fields(string(data)), " ")
+	for _, license := range wellKnownLicenses {
+		found := true
+		for _, fragment := range license.fragments {
+			found = found && strings.Contains(text, fragment)
+		}
+		if found {
+			return license.id, nil
+		}
+	}
+	return "", nil
+}
+
+type licenseFilesByPath []LicenseFile
+
+func (files licenseFilesByPath) Len() int           { return len(files) }
+func (files licenseFilesByPath) Swap(i, j int)      { files[i], files[j] = files[j], files[i] }
+func (files licenseFilesByPath) Less(i, j int) bool { return files[i].Path < files[j].Path }
+
+var (
+	spdxLicenseID = regexp.MustCompile(`^(DocumentRef-[A-Za-z0-9.-]+:)?(LicenseRef-)?[A-Za-z0-9.-]+\+?$`)
+	spdxTokens    = regexp.MustCompile(`\(|\)|[^\s()]+`)
+)
+
+// ValidateSPDXExpression checks that expr is a well-formed SPDX
+// license expression, such as "MIT", "GPL-2.0-or-later WITH
+// Classpath-exception-2.0" or "(Apache-2.0 OR MIT) AND BSD-3-Clause".
+// The syntax of license identifiers is checked, but not whether they
+// are on the SPDX license list, so that custom LicenseRef identifiers
+// and identifiers added to the list later are accepted.
+func ValidateSPDXExpression(expr string) error {
+	p := &spdxParser{
+		expr:   expr,
+		tokens: spdxTokens.FindAllString(expr, -1),
+	}
+	if len(p.tokens) == 0 {
+		return errorCodef(CodeInvalidLicense, "empty license expression")
+	}
+	if err := p.parseOr(); err != nil {
+		return err
+	}
+	if p.pos < len(p.tokens) {
+		return p.errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return nil
+}
+
+// spdxParser is a recursive descent parser for SPDX
+// license expressions.
+type spdxParser struct {
+	expr   string
+	tokens []string
+	pos    int
+}
+
+func (p *spdxParser) errorf(f string, a ...interface{}) error {
+	a = append([]interface{}{p.expr}, a...)
+	return errorCodef(CodeInvalidLicense, "invalid license expression %q: "+f, a...)
+}
+
+// next returns the next token, or the empty string at the end of
+// the expression.
+func (p *spdxParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+// accept consumes the next token and returns true
+// if it is the given operator.
+func (p *spdxParser) accept(op string) bool {
+	if p.pos < len(p.tokens) && strings.ToUpper(p.tokens[p.pos]) == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *spdxParser) parseOr() error {
+	if err := p.parseAnd(); err != nil {
+		return err
+	}
+	for p.accept("OR") {
+		if err := p.parseAnd(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *spdxParser) parseAnd() error {
+	if err := p.parseWith(); err != nil {
+		return err
+	}
+	for p.accept("AND") {
+		if err := p.parseWith(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *spdxParser) parseWith() error {
+	if err := p.parseAtom(); err != nil {
+		return err
+	}
+	if p.accept("WITH") {
+		exception := p.next()
+		if !p.isIdentifier(exception) || strings.HasSuffix(exception, "+") {
+			return p.errorf("invalid license exception %q", exception)
+		}
+	}
+	return nil
+}
+
+func (p *spdxParser) parseAtom() error {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return p.errorf("unexpected end of expression")
+	case tok == "(":
+		if err := p.parseOr(); err != nil {
+			return err
+		}
+		if p.next() != ")" {
+			return p.errorf("missing closing parenthesis")
+		}
+		return nil
+	case !p.isIdentifier(tok):
+		return p.errorf("unexpected %q", tok)
+	}
+	return nil
+}
+
+// isIdentifier reports whether tok is a license identifier
+// rather than an operator or parenthesis.
+func (p *spdxParser) isIdentifier(tok string) bool {
+	switch strings.ToUpper(tok) {
+	case "AND", "OR", "WITH":
+		return false
+	}
+	return spdxLicenseID.MatchString(tok)
+}
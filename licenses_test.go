@@ -0,0 +1,175 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type LicensesSuite struct{}
+
+var _ = gc.Suite(&LicensesSuite{})
+
+const mitLicense = `Copyright (c) 2015 Example
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND.
+`
+
+// licensedCharmDir returns the path of a copy of the dummy charm
+// with license files and a license field in its metadata.
+func licensedCharmDir(c *gc.C) string {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	files := map[string]string{
+		"LICENSE":                  "// SPDX-License-Identifier: Apache-2.0 OR MIT\n",
+		"src/lib/COPYING.txt":      mitLicense,
+		"src/lib/license-other.md": "All rights reserved.\n",
+		"src/licenses.go":          "package licenses\n",
+		".git/LICENSE":             "ignored\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(path, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+	f, err := os.OpenFile(filepath.Join(path, "metadata.yaml"), os.O_APPEND|os.O_WRONLY, 0)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	_, err = f.WriteString("\nlicense: Apache-2.0\n")
+	c.Assert(err, gc.IsNil)
+	return path
+}
+
+var expectedLicenseReport = &charm.LicenseReport{
+	Expression: "Apache-2.0",
+	Files: []charm.LicenseFile{{
+		Path:       "LICENSE",
+		Identifier: "Apache-2.0 OR MIT",
+	}, {
+		Path:       "src/lib/COPYING.txt",
+		Identifier: "MIT",
+	}, {
+		Path: "src/lib/license-other.md",
+	}},
+}
+
+func (s *LicensesSuite) TestCharmDirLicenses(c *gc.C) {
+	dir, err := charm.ReadCharmDir(licensedCharmDir(c))
+	c.Assert(err, gc.IsNil)
+	report, err := dir.Licenses()
+	c.Assert(err, gc.IsNil)
+	c.Assert(report, jc.DeepEquals, expectedLicenseReport)
+	c.Assert(report.Validate(), gc.IsNil)
+}
+
+func (s *LicensesSuite) TestCharmArchiveLicenses(c *gc.C) {
+	archive := archiveDir(c, licensedCharmDir(c))
+	report, err := archive.Licenses()
+	c.Assert(err, gc.IsNil)
+	c.Assert(report, jc.DeepEquals, expectedLicenseReport)
+}
+
+func (s *LicensesSuite) TestNoLicense(c *gc.C) {
+	report, err := TestCharms.CharmDir("dummy").Licenses()
+	c.Assert(err, gc.IsNil)
+	c.Assert(report, jc.DeepEquals, &charm.LicenseReport{})
+	err = report.Validate()
+	c.Assert(err, gc.ErrorMatches, "charm has no license")
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidLicense)
+}
+
+func (s *LicensesSuite) TestValidateReport(c *gc.C) {
+	report := &charm.LicenseReport{
+		Expression: "Apache-2.0 AND",
+	}
+	err := report.Validate()
+	c.Assert(err, gc.ErrorMatches, `metadata: invalid license expression "Apache-2.0 AND": unexpected end of expression`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidLicense)
+
+	report = &charm.LicenseReport{
+		Files: []charm.LicenseFile{{
+			Path:       "COPYING",
+			Identifier: "GPL 3",
+		}},
+	}
+	err = report.Validate()
+	c.Assert(err, gc.ErrorMatches, `COPYING: invalid license expression "GPL 3": unexpected "3"`)
+}
+
+func (s *LicensesSuite) TestReadMetaLicense(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nlicense: MIT\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.License, gc.Equals, "MIT")
+	c.Assert(meta.Warnings, gc.HasLen, 0)
+}
+
+var validateSPDXExpressionTests = []struct {
+	expr string
+	err  string
+}{{
+	expr: "MIT",
+}, {
+	expr: "GPL-2.0+",
+}, {
+	expr: "GPL-2.0-or-later WITH Classpath-exception-2.0",
+}, {
+	expr: "(Apache-2.0 OR MIT) AND BSD-3-Clause",
+}, {
+	expr: "LicenseRef-proprietary or DocumentRef-spdx-tool-1.2:LicenseRef-MIT-Style-2",
+}, {
+	expr: "((MIT))",
+}, {
+	expr: " ",
+	err:  `empty license expression`,
+}, {
+	expr: "MIT OR",
+	err:  `invalid license expression "MIT OR": unexpected end of expression`,
+}, {
+	expr: "MIT Apache-2.0",
+	err:  `invalid license expression "MIT Apache-2.0": unexpected "Apache-2.0"`,
+}, {
+	expr: "(MIT OR Apache-2.0",
+	err:  `invalid license expression "\(MIT OR Apache-2.0": missing closing parenthesis`,
+}, {
+	expr: "MIT)",
+	err:  `invalid license expression "MIT\)": unexpected "\)"`,
+}, {
+	expr: "AND MIT",
+	err:  `invalid license expression "AND MIT": unexpected "AND"`,
+}, {
+	expr: "MIT WITH",
+	err:  `invalid license expression "MIT WITH": invalid license exception ""`,
+}, {
+	expr: "GPL-2.0 WITH exception+",
+	err:  `invalid license expression "GPL-2.0 WITH exception\+": invalid license exception "exception\+"`,
+}, {
+	expr: "MIT/X11",
+	err:  `invalid license expression "MIT/X11": unexpected "MIT/X11"`,
+}}
+
+func (s *LicensesSuite) TestValidateSPDXExpression(c *gc.C) {
+	for i, test := range validateSPDXExpressionTests {
+		c.Logf("test %d: %q", i, test.expr)
+		err := charm.ValidateSPDXExpression(test.expr)
+		if test.err == "" {
+			c.Assert(err, gc.IsNil)
+			continue
+		}
+		c.Assert(err, gc.ErrorMatches, test.err)
+		c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidLicense)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	goyaml "gopkg.in/yaml.v1"
+)
+
+// Base identifies an operating system release a charm runs on.
+type Base struct {
+	// Name holds the name of the operating system, such as "ubuntu".
+	Name string `yaml:"name"`
+
+	// Channel holds the release of the operating system,
+	// such as "20.04", optionally followed by a risk,
+	// as in "20.04/stable".
+	Channel string `yaml:"channel"`
+
+	// Architectures holds the architectures supported
+	// on the base. If empty, all architectures are.
+	Architectures []string `yaml:"architectures,omitempty"`
+}
+
+// ubuntuSeries maps Ubuntu releases to their series names.
+var ubuntuSeries = map[string]string{
+	"12.04": "precise",
+	"12.10": "quantal",
+	"13.04": "raring",
+	"13.10": "saucy",
+	"14.04": "trusty",
+	"14.10": "utopic",
+	"15.04": "vivid",
+	"15.10": "wily",
+	"16.04": "xenial",
+	"16.10": "yakkety",
+	"17.04": "zesty",
+	"17.10": "artful",
+	"18.04": "bionic",
+	"18.10": "cosmic",
+	"19.04": "disco",
+	"19.10": "eoan",
+	"20.04": "focal",
+	"20.10": "groovy",
+	"21.04": "hirsute",
+	"21.10": "impish",
+	"22.04": "jammy",
+	"22.10": "kinetic",
+	"23.04": "lunar",
+	"23.10": "mantic",
+	"24.04": "noble",
+	"24.10": "oracular",
+	"25.04": "plucky",
+	"25.10": "questing",
+	"26.04": "resolute",
+}
+
+// ubuntuVersion matches the form of Ubuntu release versions.
+var ubuntuVersion = regexp.MustCompile(`^[0-9]{2}\.(04|10)$`)
+
+// Series returns the series name corresponding to the base, such as
+// "focal" for ubuntu 20.04. Bases of other operating systems map to
+// the operating system name followed by the major release, such as
+// "centos7", as do Ubuntu releases that are not yet in the series
+// catalogue, such as "ubuntu99.04".
+func (b Base) Series() (string, error) {
+	track := b.Channel
+	if i := strings.Index(track, "/"); i >= 0 {
+		track = track[:i]
+	}
+	switch b.Name {
+	case "ubuntu":
+		if series, ok := ubuntuSeries[track]; ok {
+			return series, nil
+		}
+		if ubuntuVersion.MatchString(track) {
+			return "ubuntu" + track, nil
+		}
+	case "centos":
+		if track != "" && !strings.Contains(track, ".") {
+			return "centos" + track, nil
+		}
+	}
+	return "", errorCodef(CodeInvalidManifest, "unknown base %q", b.String())
+}
+
+// String returns the base in the form name@channel.
+func (b Base) String() string {
+	return b.Name + "@" + b.Channel
+}
+
+// Manifest represents the contents of a charm's manifest.yaml file.
+type Manifest struct {
+	Bases []Base `yaml:"bases"`
+}
+
+// ReadManifest reads a Manifest in YAML format.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	data, err := readDocument(r, ManifestFile, MaxDocumentSize)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := goyaml.Unmarshal(data, &manifest); err != nil {
+		return nil, withCode(CodeInvalidManifest, err)
+	}
+	if len(manifest.Bases) == 0 {
+		return nil, errorCodef(CodeInvalidManifest, "manifest: no bases declared")
+	}
+	for i, base := range manifest.Bases {
+		if base.Name == "" || base.Channel == "" {
+			return nil, errorCodef(CodeInvalidManifest, "manifest: base %d must have a name and a channel", i)
+		}
+	}
+	return &manifest, nil
+}
+
+// manifestWarning returns the warning reported when a charm's
+// manifest.yaml file cannot be read. The manifest is optional, so
+// a charm with an invalid one is treated as having none.
+func manifestWarning(err error) Warning {
+	return warningf(CodeIgnoredManifest, "%s is invalid and has been ignored: %v", ManifestFile, err)
+}
+
+// Series returns the series of the manifest bases, in order,
+// without duplicates.
+func (m *Manifest) Series() ([]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, base := range m.Bases {
+		series, err := base.Series()
+		if err != nil {
+			return nil, err
+		}
+		if !seen[series] {
+			seen[series] = true
+			result = append(result, series)
+		}
+	}
+	return result, nil
+}
+
+// manifestCharm is implemented by charms that
+// may hold a manifest.yaml file.
+type manifestCharm interface {
+	CharmManifest() *Manifest
+}
+
+// ComputedSeries returns the effective series supported by the
+// given charm, which was retrieved with the given URL; curl may
+// be nil. The series are reconciled with these precedence rules:
+//
+//   - The bases in the charm's manifest.yaml, if any, take precedence
+//     over the series declared in its metadata.
+//   - Otherwise the series declared in the metadata are used.
+//   - If the URL has a series, it must be one of the series above,
+//     and it is moved to the front of the returned list, as the
+//     preferred series. If the charm declares no series at all,
+//     the URL series is the only supported one.
+//
+// A nil slice is returned when neither the charm nor the URL
+// declare any series, meaning that any series is supported.
+func ComputedSeries(ch Charm, curl *URL) ([]string, error) {
+	var series []string
+	if mc, ok := ch.(manifestCharm); ok && mc.CharmManifest() != nil {
+		var err error
+		if series, err = mc.CharmManifest().Series(); err != nil {
+			return nil, err
+		}
+	} else {
+		series = ch.Meta().supportedSeries()
+	}
+	if curl == nil || curl.Series == "" || curl.IsBundle() {
+		return series, nil
+	}
+	if len(series) == 0 {
+		return []string{curl.Series}, nil
+	}
+	result := []string{curl.Series}
+	found := false
+	for _, s := range series {
+		if s == curl.Series {
+			found = true
+			continue
+		}
+		result = append(result, s)
+	}
+	if !found {
+		return nil, &UnsupportedSeriesError{
+			Charm:     ch.Meta().Name,
+			Requested: []string{curl.Series},
+			Supported: series,
+		}
+	}
+	return result, nil
+}
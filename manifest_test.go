@@ -0,0 +1,232 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ManifestSuite struct{}
+
+var _ = gc.Suite(&ManifestSuite{})
+
+var readManifestTests = []struct {
+	about  string
+	yaml   string
+	expect *charm.Manifest
+	err    string
+}{{
+	about: "valid manifest",
+	yaml: `
+bases:
+    - name: ubuntu
+      channel: "20.04/stable"
+      architectures: [amd64, arm64]
+    - name: ubuntu
+      channel: "18.04"
+`,
+	expect: &charm.Manifest{
+		Bases: []charm.Base{{
+			Name:          "ubuntu",
+			Channel:       "20.04/stable",
+			Architectures: []string{"amd64", "arm64"},
+		}, {
+			Name:    "ubuntu",
+			Channel: "18.04",
+		}},
+	},
+}, {
+	about: "no bases",
+	yaml:  "bases: []",
+	err:   "manifest: no bases declared",
+}, {
+	about: "missing channel",
+	yaml:  "bases: [{name: ubuntu}]",
+	err:   "manifest: base 0 must have a name and a channel",
+}}
+
+func (s *ManifestSuite) TestReadManifest(c *gc.C) {
+	for i, test := range readManifestTests {
+		c.Logf("test %d: %s", i, test.about)
+		m, err := charm.ReadManifest(strings.NewReader(test.yaml))
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidManifest)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(m, jc.DeepEquals, test.expect)
+	}
+}
+
+func (s *ManifestSuite) TestBaseSeries(c *gc.C) {
+	for _, test := range []struct {
+		base   charm.Base
+		series string
+		err    string
+	}{{
+		base:   charm.Base{Name: "ubuntu", Channel: "20.04"},
+		series: "focal",
+	}, {
+		base:   charm.Base{Name: "ubuntu", Channel: "14.04/edge"},
+		series: "trusty",
+	}, {
+		base:   charm.Base{Name: "centos", Channel: "7"},
+		series: "centos7",
+	}, {
+		base:   charm.Base{Name: "ubuntu", Channel: "99.04/stable"},
+		series: "ubuntu99.04",
+	}, {
+		base: charm.Base{Name: "ubuntu", Channel: "9.04"},
+		err:  `unknown base "ubuntu@9.04"`,
+	}} {
+		series, err := test.base.Series()
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(series, gc.Equals, test.series)
+	}
+}
+
+func (s *ManifestSuite) TestCharmDirManifest(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(dir.CharmManifest(), gc.IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(path, "manifest.yaml"), []byte("bases: [{name: ubuntu, channel: '20.04'}]"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	dir, err = charm.ReadCharmDir(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(dir.CharmManifest().Bases, jc.DeepEquals, []charm.Base{{Name: "ubuntu", Channel: "20.04"}})
+
+	// The manifest is also read from archives.
+	archivePath := filepath.Join(c.MkDir(), "archive.charm")
+	file, err := os.Create(archivePath)
+	c.Assert(err, jc.ErrorIsNil)
+	err = dir.ArchiveTo(file)
+	file.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	archive, err := charm.ReadCharmArchive(archivePath)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(archive.CharmManifest(), jc.DeepEquals, dir.CharmManifest())
+}
+
+func (s *ManifestSuite) TestInvalidManifestIgnored(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "manifest.yaml"), []byte("bases: []"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(dir.CharmManifest(), gc.IsNil)
+	expect := charm.Warning{
+		Code:    charm.CodeIgnoredManifest,
+		Message: "manifest.yaml is invalid and has been ignored: manifest: no bases declared",
+	}
+	c.Assert(dir.Meta().Warnings, jc.DeepEquals, []charm.Warning{expect})
+
+	archivePath := filepath.Join(c.MkDir(), "archive.charm")
+	file, err := os.Create(archivePath)
+	c.Assert(err, jc.ErrorIsNil)
+	err = dir.ArchiveTo(file)
+	file.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	archive, err := charm.ReadCharmArchive(archivePath)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(archive.CharmManifest(), gc.IsNil)
+	c.Assert(archive.Meta().Warnings, jc.DeepEquals, []charm.Warning{expect})
+}
+
+var computedSeriesTests = []struct {
+	about    string
+	meta     string
+	manifest string
+	url      string
+	expect   []string
+	err      string
+}{{
+	about: "no series anywhere",
+	meta:  "name: a\nsummary: a\ndescription: a\n",
+}, {
+	about:  "metadata series",
+	meta:   "name: a\nsummary: a\ndescription: a\nseries: [trusty, xenial]\n",
+	expect: []string{"trusty", "xenial"},
+}, {
+	about:  "url series with no declared series",
+	meta:   "name: a\nsummary: a\ndescription: a\n",
+	url:    "cs:precise/a-1",
+	expect: []string{"precise"},
+}, {
+	about:  "url series is preferred",
+	meta:   "name: a\nsummary: a\ndescription: a\nseries: [trusty, xenial]\n",
+	url:    "cs:xenial/a-1",
+	expect: []string{"xenial", "trusty"},
+}, {
+	about: "url series not supported",
+	meta:  "name: a\nsummary: a\ndescription: a\nseries: [trusty, xenial]\n",
+	url:   "cs:precise/a-1",
+	err:   `charm "a" does not support series precise; supported series are: trusty, xenial`,
+}, {
+	about:    "manifest takes precedence over metadata",
+	meta:     "name: a\nsummary: a\ndescription: a\nseries: [trusty]\n",
+	manifest: "bases: [{name: ubuntu, channel: '20.04'}, {name: ubuntu, channel: '18.04'}, {name: ubuntu, channel: '20.04/edge'}]",
+	expect:   []string{"focal", "bionic"},
+}, {
+	about:    "url series with manifest",
+	meta:     "name: a\nsummary: a\ndescription: a\n",
+	manifest: "bases: [{name: ubuntu, channel: '20.04'}, {name: ubuntu, channel: '18.04'}]",
+	url:      "cs:bionic/a",
+	expect:   []string{"bionic", "focal"},
+}, {
+	about:    "ubuntu release not in the catalogue",
+	meta:     "name: a\nsummary: a\ndescription: a\n",
+	manifest: "bases: [{name: ubuntu, channel: '99.04'}, {name: ubuntu, channel: '20.04'}]",
+	expect:   []string{"ubuntu99.04", "focal"},
+}, {
+	about:    "invalid manifest",
+	meta:     "name: a\nsummary: a\ndescription: a\nseries: [trusty]\n",
+	manifest: "bases: []",
+	expect:   []string{"trusty"},
+}, {
+	about:    "unknown base",
+	meta:     "name: a\nsummary: a\ndescription: a\n",
+	manifest: "bases: [{name: ubuntu, channel: '9.04'}]",
+	err:      `unknown base "ubuntu@9.04"`,
+}}
+
+func (s *ManifestSuite) TestComputedSeries(c *gc.C) {
+	for i, test := range computedSeriesTests {
+		c.Logf("test %d: %s", i, test.about)
+		path := c.MkDir()
+		err := ioutil.WriteFile(filepath.Join(path, "metadata.yaml"), []byte(test.meta), 0644)
+		c.Assert(err, jc.ErrorIsNil)
+		if test.manifest != "" {
+			err := ioutil.WriteFile(filepath.Join(path, "manifest.yaml"), []byte(test.manifest), 0644)
+			c.Assert(err, jc.ErrorIsNil)
+		}
+		dir, err := charm.ReadCharmDir(path)
+		c.Assert(err, jc.ErrorIsNil)
+		var curl *charm.URL
+		if test.url != "" {
+			curl = charm.MustParseURL(test.url)
+		}
+		series, err := charm.ComputedSeries(dir, curl)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(series, jc.DeepEquals, test.expect)
+	}
+}
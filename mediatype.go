@@ -0,0 +1,107 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Content types of the files served by charm stores.
+const (
+	ContentTypeCharmArchive  = "application/zip"
+	ContentTypeBundleArchive = "application/zip"
+	ContentTypeIcon          = "image/svg+xml"
+	ContentTypeYAML          = "application/x-yaml"
+	ContentTypeMarkdown      = "text/markdown; charset=utf-8"
+	ContentTypeTar           = "application/x-tar"
+	ContentTypeGzip          = "application/gzip"
+	ContentTypeOctetStream   = "application/octet-stream"
+)
+
+// sniffLen holds the number of bytes read by DetectContentType,
+// which is the number considered by http.DetectContentType.
+const sniffLen = 512
+
+// DetectContentType returns the content type of the data read from r,
+// judging by its first 512 bytes, which are the only ones read. Zip
+// files are reported as ContentTypeCharmArchive, and SVG documents
+// as ContentTypeIcon; the content type of other data is determined
+// as by http.DetectContentType.
+func DetectContentType(r io.Reader) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, zipMagic), bytes.HasPrefix(head, emptyZipMagic):
+		return ContentTypeCharmArchive, nil
+	case bytes.HasPrefix(head, gzipMagic):
+		return ContentTypeGzip, nil
+	case isTarHeader(head):
+		return ContentTypeTar, nil
+	case isSVG(head):
+		return ContentTypeIcon, nil
+	}
+	return http.DetectContentType(head), nil
+}
+
+// isSVG reports whether head looks like the start of an SVG document:
+// an svg element, preceded only by white space, an XML declaration,
+// comments or a document type declaration.
+func isSVG(head []byte) bool {
+	s := string(bytes.TrimLeft(head, " \t\r\n"))
+	for strings.HasPrefix(s, "<?") || strings.HasPrefix(s, "<!") {
+		end := strings.Index(s, ">")
+		if end == -1 {
+			return false
+		}
+		s = strings.TrimLeft(s[end+1:], " \t\r\n")
+	}
+	return strings.HasPrefix(s, "<svg")
+}
+
+// ContentTypeForName returns the content type to serve the file of a
+// charm or bundle with the given slash-separated name with, judging
+// by its extension. Names with an unknown extension are served as
+// ContentTypeOctetStream.
+func ContentTypeForName(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	switch ext {
+	case ".charm", ".bundle", ".zip":
+		return ContentTypeCharmArchive
+	case ".svg":
+		return ContentTypeIcon
+	case ".yaml", ".yml":
+		return ContentTypeYAML
+	case ".md":
+		return ContentTypeMarkdown
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return ContentTypeOctetStream
+}
+
+// CheckArchiveContent checks that the data read from r starts as a
+// zip file does, so that uploads of charm and bundle archives can be
+// rejected before they are read in full. At most the first few
+// kilobytes are read. If the data is not a zip file, the returned error
+// is an *ArchiveFormatError with the detected format.
+func CheckArchiveContent(r io.Reader) error {
+	format, err := SniffArchiveFormat(r)
+	if err != nil {
+		return err
+	}
+	if format != ArchiveZip {
+		return &ArchiveFormatError{Format: format}
+	}
+	return nil
+}
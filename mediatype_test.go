@@ -0,0 +1,97 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type MediaTypeSuite struct{}
+
+var _ = gc.Suite(&MediaTypeSuite{})
+
+var detectContentTypeTests = []struct {
+	about  string
+	data   string
+	expect string
+}{{
+	about:  "zip",
+	data:   "PK\x03\x04rest of the archive",
+	expect: charm.ContentTypeCharmArchive,
+}, {
+	about:  "gzip",
+	data:   "\x1f\x8b\x08\x00",
+	expect: charm.ContentTypeGzip,
+}, {
+	about:  "svg",
+	data:   "<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>",
+	expect: charm.ContentTypeIcon,
+}, {
+	about:  "svg with prolog",
+	data:   "<?xml version=\"1.0\"?>\n<!-- icon -->\n<!DOCTYPE svg>\n<svg></svg>",
+	expect: charm.ContentTypeIcon,
+}, {
+	about:  "text",
+	data:   "name: wordpress\n",
+	expect: "text/plain; charset=utf-8",
+}, {
+	about:  "empty",
+	data:   "",
+	expect: "text/plain; charset=utf-8",
+}}
+
+func (s *MediaTypeSuite) TestDetectContentType(c *gc.C) {
+	for i, test := range detectContentTypeTests {
+		c.Logf("test %d: %s", i, test.about)
+		t, err := charm.DetectContentType(strings.NewReader(test.data))
+		c.Assert(err, gc.IsNil)
+		c.Assert(t, gc.Equals, test.expect)
+	}
+}
+
+func (s *MediaTypeSuite) TestDetectContentTypeArchive(c *gc.C) {
+	f, err := os.Open(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	t, err := charm.DetectContentType(f)
+	c.Assert(err, gc.IsNil)
+	c.Assert(t, gc.Equals, charm.ContentTypeCharmArchive)
+}
+
+var contentTypeForNameTests = []struct {
+	name   string
+	expect string
+}{
+	{"wordpress.charm", charm.ContentTypeCharmArchive},
+	{"bundle.ZIP", charm.ContentTypeBundleArchive},
+	{"icon.svg", charm.ContentTypeIcon},
+	{"metadata.yaml", charm.ContentTypeYAML},
+	{"hooks/config.yml", charm.ContentTypeYAML},
+	{"README.md", charm.ContentTypeMarkdown},
+	{"hooks/install", charm.ContentTypeOctetStream},
+}
+
+func (s *MediaTypeSuite) TestContentTypeForName(c *gc.C) {
+	for i, test := range contentTypeForNameTests {
+		c.Logf("test %d: %s", i, test.name)
+		c.Assert(charm.ContentTypeForName(test.name), gc.Equals, test.expect)
+	}
+}
+
+func (s *MediaTypeSuite) TestCheckArchiveContent(c *gc.C) {
+	data, err := ioutil.ReadFile(TestCharms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(charm.CheckArchiveContent(bytes.NewReader(data)), gc.IsNil)
+
+	err = charm.CheckArchiveContent(strings.NewReader("<svg></svg>"))
+	c.Assert(err, gc.ErrorMatches, `cannot read archive: not a zip archive`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidArchive)
+}
@@ -4,11 +4,10 @@
 package charm
 
 import (
-	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -53,45 +52,45 @@ type Storage struct {
 	// Name is the name of the store.
 	//
 	// Name has no default, and must be specified.
-	Name string `bson:"name"`
+	Name string `bson:"name" json:"name"`
 
 	// Description is a description of the store.
 	//
 	// Description has no default, and is optional.
-	Description string `bson:"description"`
+	Description string `bson:"description" json:"description"`
 
 	// Type is the storage type: filesystem or block-device.
 	//
 	// Type has no default, and must be specified.
-	Type StorageType `bson:"type"`
+	Type StorageType `bson:"type" json:"type"`
 
 	// Shared indicates that the storage is shared between all units of
 	// a service deployed from the charm. It is an error to attempt to
 	// assign non-shareable storage to a "shared" storage requirement.
 	//
 	// Shared defaults to false.
-	Shared bool `bson:"shared"`
+	Shared bool `bson:"shared" json:"shared"`
 
 	// ReadOnly indicates that the storage should be made read-only if
 	// possible. If the storage cannot be made read-only, Juju will warn
 	// the user.
 	//
 	// ReadOnly defaults to false.
-	ReadOnly bool `bson:"read-only"`
+	ReadOnly bool `bson:"read-only" json:"read-only"`
 
 	// CountMin is the number of storage instances that must be attached
 	// to the charm for it to be useful; the charm will not install until
 	// this number has been satisfied. This must be a non-negative number.
 	//
 	// CountMin defaults to 1 for singleton stores.
-	CountMin int `bson:"countmin"`
+	CountMin int `bson:"countmin" json:"count-min"`
 
 	// CountMax is the largest number of storage instances that can be
 	// attached to the charm. If CountMax is -1, then there is no upper
 	// bound.
 	//
 	// CountMax defaults to 1 for singleton stores.
-	CountMax int `bson:"countmax"`
+	CountMax int `bson:"countmax" json:"count-max"`
 
 	// MinimumSize is the minimum size of store that the charm needs to
 	// work at all. This is not a recommended size or a comfortable size
@@ -101,14 +100,14 @@ type Storage struct {
 	//
 	// There is no default MinimumSize; if left unspecified, a provider
 	// specific default will be used, typically 1GB for block storage.
-	MinimumSize uint64 `bson:"minimum-size"`
+	MinimumSize uint64 `bson:"minimum-size" json:"minimum-size"`
 
 	// Location is the mount location for filesystem stores. For multi-
 	// stores, the location acts as the parent directory for each mounted
 	// store.
 	//
 	// Location has no default, and is optional.
-	Location string `bson:"location,omitempty"`
+	Location string `bson:"location,omitempty" json:"location,omitempty"`
 
 	// Properties allow the charm author to characterise the relative storage
 	// performance requirements and sensitivities for each store.
@@ -116,18 +115,18 @@ type Storage struct {
 	// such as tmpfs or ephemeral instance disks.
 	//
 	// Properties has no default, and is optional.
-	Properties []string `bson:"properties,omitempty"`
+	Properties []string `bson:"properties,omitempty" json:"properties,omitempty"`
 }
 
 // Relation represents a single relation defined in the charm
 // metadata.yaml file.
 type Relation struct {
-	Name      string        `bson:"name"`
-	Role      RelationRole  `bson:"role"`
-	Interface string        `bson:"interface"`
-	Optional  bool          `bson:"optional"`
-	Limit     int           `bson:"limit"`
-	Scope     RelationScope `bson:"scope"`
+	Name      string        `bson:"name" json:"name"`
+	Role      RelationRole  `bson:"role" json:"role"`
+	Interface string        `bson:"interface" json:"interface"`
+	Optional  bool          `bson:"optional" json:"optional"`
+	Limit     int           `bson:"limit" json:"limit"`
+	Scope     RelationScope `bson:"scope" json:"scope"`
 }
 
 // ImplementedBy returns whether the relation is implemented by the supplied charm.
@@ -163,6 +162,14 @@ func (r Relation) ImplementedBy(ch Charm) bool {
 	return false
 }
 
+// ExtraBinding represents an extra binding declared in the
+// extra-bindings field of a charm's metadata.yaml file: a name
+// that may be bound to a space like an endpoint, although no
+// relation can be made to it.
+type ExtraBinding struct {
+	Name string `bson:"name" json:"name"`
+}
+
 // IsImplicit returns whether the relation is supplied by juju itself,
 // rather than by a charm.
 func (r Relation) IsImplicit() bool {
@@ -174,20 +181,43 @@ func (r Relation) IsImplicit() bool {
 // Meta represents all the known content that may be defined
 // within a charm's metadata.yaml file.
 type Meta struct {
-	Name           string                  `bson:"name"`
-	Summary        string                  `bson:"summary"`
-	Description    string                  `bson:"description"`
-	Subordinate    bool                    `bson:"subordinate"`
-	Provides       map[string]Relation     `bson:"provides,omitempty"`
-	Requires       map[string]Relation     `bson:"requires,omitempty"`
-	Peers          map[string]Relation     `bson:"peers,omitempty"`
-	Format         int                     `bson:"format,omitempty"`
-	OldRevision    int                     `bson:"oldrevision,omitempty"` // Obsolete
-	Categories     []string                `bson:"categories,omitempty"`
-	Tags           []string                `bson:"tags,omitempty"`
-	Series         string                  `bson:"series,omitempty"`
-	Storage        map[string]Storage      `bson:"storage,omitempty"`
-	PayloadClasses map[string]PayloadClass `bson:"payloadclasses,omitempty" json:"payloadclasses,omitempty"`
+	Name            string                  `bson:"name"`
+	Summary         string                  `bson:"summary"`
+	Description     string                  `bson:"description"`
+	Subordinate     bool                    `bson:"subordinate"`
+	Provides        map[string]Relation     `bson:"provides,omitempty"`
+	Requires        map[string]Relation     `bson:"requires,omitempty"`
+	Peers           map[string]Relation     `bson:"peers,omitempty"`
+	Format          int                     `bson:"format,omitempty"`
+	OldRevision     int                     `bson:"oldrevision,omitempty"` // Obsolete
+	Categories      []string                `bson:"categories,omitempty"`
+	Tags            []string                `bson:"tags,omitempty"`
+	Series          string                  `bson:"series,omitempty"`
+	SupportedSeries []string                `bson:"supportedseries,omitempty"`
+	Maintainers     []string                `bson:"maintainers,omitempty"`
+	License         string                  `bson:"license,omitempty"`
+	MinJujuVersion  string                  `bson:"minjujuversion,omitempty"`
+	Storage         map[string]Storage      `bson:"storage,omitempty"`
+	PayloadClasses  map[string]PayloadClass `bson:"payloadclasses,omitempty" json:"payloadclasses,omitempty"`
+	Resources       map[string]Resource     `bson:"resources,omitempty"`
+	Containers      map[string]Container    `bson:"containers,omitempty"`
+	ExtraBindings   map[string]ExtraBinding `bson:"extrabindings,omitempty"`
+
+	// Extensions holds any vendor extension fields found
+	// in the metadata, keyed by their name, which
+	// starts with ExtensionPrefix.
+	Extensions map[string]interface{} `bson:"extensions,omitempty"`
+
+	// Locales holds the translations of the summary and
+	// description found in the charm's metadata-locale
+	// directory, keyed by lower case language tag, such
+	// as "fr" or "pt-br".
+	Locales map[string]LocalizedMeta `bson:"locales,omitempty"`
+
+	// Warnings holds any warnings found when reading
+	// the metadata, such as the use of deprecated or
+	// unknown fields.
+	Warnings []Warning `bson:"-" json:"-"`
 }
 
 func generateRelationHooks(relName string, allHooks map[string]bool) {
@@ -232,20 +262,31 @@ func parseStringList(list interface{}) []string {
 }
 
 // ReadMeta reads the content of a metadata.yaml file and returns
-// its representation.
+// its representation. It returns a *DocumentTooLargeError if the
+// content exceeds MaxMetadataSize.
 func ReadMeta(r io.Reader) (meta *Meta, err error) {
-	data, err := ioutil.ReadAll(r)
+	return ReadMetaWithOptions(r, ReadMetaOptions{})
+}
+
+// ReadMetaWithOptions is like ReadMeta, but reads
+// the metadata as specified by opts.
+func ReadMetaWithOptions(r io.Reader, opts ReadMetaOptions) (meta *Meta, err error) {
+	data, err := readDocument(r, MetadataFile, MaxMetadataSize)
 	if err != nil {
 		return
 	}
 	raw := make(map[interface{}]interface{})
 	err = yaml.Unmarshal(data, raw)
 	if err != nil {
-		return
+		return nil, withCode(CodeInvalidMetadata, err)
+	}
+	var legacyWarnings []Warning
+	if opts.Legacy {
+		legacyWarnings = normalizeLegacyMeta(raw)
 	}
 	v, err := charmSchema.Coerce(raw, nil)
 	if err != nil {
-		return nil, errors.New("metadata: " + err.Error())
+		return nil, annotateCodef(CodeInvalidMetadata, err, "metadata: %v", err)
 	}
 	m := v.(map[string]interface{})
 	meta = &Meta{}
@@ -270,21 +311,65 @@ func ReadMeta(r io.Reader) (meta *Meta, err error) {
 	if series, ok := m["series"]; ok && series != nil {
 		multiseries, ok := series.([]interface{})
 		if ok {
+			meta.SupportedSeries = parseStringList(multiseries)
 			if len(multiseries) > 0 {
 				meta.Series = multiseries[0].(string)
 			}
 		} else {
 			meta.Series = series.(string)
+			meta.SupportedSeries = []string{meta.Series}
 		}
 	}
+	if maintainer := m["maintainer"]; maintainer != nil {
+		meta.Maintainers = append(meta.Maintainers, maintainer.(string))
+	}
+	meta.Maintainers = append(meta.Maintainers, parseStringList(m["maintainers"])...)
+	if license, ok := m["license"].(string); ok {
+		meta.License = license
+	}
+	if minVersion, ok := m["min-juju-version"].(string); ok {
+		meta.MinJujuVersion = minVersion
+	}
 	meta.Storage = parseStorage(m["storage"])
 	meta.PayloadClasses = parsePayloadClasses(m["payloads"])
+	meta.Resources = parseResources(m["resources"])
+	meta.Containers = parseContainers(m["containers"])
+	meta.ExtraBindings = parseExtraBindings(m["extra-bindings"])
+	if meta.Extensions, err = readExtensions(raw); err != nil {
+		return nil, errorCodef(CodeInvalidMetadata, "metadata: %v", err)
+	}
 	if err := meta.Check(); err != nil {
 		return nil, err
 	}
+	meta.Warnings = metaWarnings(raw)
+	tags, tagWarnings := normalizeTags(meta.Tags, meta.Categories)
+	meta.Warnings = append(meta.Warnings, tagWarnings...)
+	meta.Warnings = append(meta.Warnings, unknownTagWarnings(tags)...)
+	meta.Warnings = append(meta.Warnings, legacyWarnings...)
 	return meta, nil
 }
 
+// metaWarnings returns the warnings for the given raw metadata.
+func metaWarnings(raw map[interface{}]interface{}) []Warning {
+	var warnings []Warning
+	for key := range raw {
+		name, ok := key.(string)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "revision":
+			warnings = append(warnings, warningf(CodeDeprecatedField, "metadata field %q is deprecated; use a revision file instead", name))
+		case name == "categories":
+			warnings = append(warnings, warningf(CodeDeprecatedField, "metadata field %q is deprecated; use tags instead", name))
+		case charmSchemaFields[name] == nil && !IsExtensionField(name):
+			warnings = append(warnings, warningf(CodeUnknownField, "metadata field %q is unknown and has been ignored", name))
+		}
+	}
+	sortWarnings(warnings)
+	return warnings
+}
+
 // GetYAML implements yaml.Getter.GetYAML.
 func (m Meta) GetYAML() (tag string, value interface{}) {
 	marshaledRelations := func(rs map[string]Relation) map[string]marshaledRelation {
@@ -294,7 +379,7 @@ func (m Meta) GetYAML() (tag string, value interface{}) {
 		}
 		return mrs
 	}
-	return "", struct {
+	return "", withExtensions(struct {
 		Name        string                       `yaml:"name"`
 		Summary     string                       `yaml:"summary"`
 		Description string                       `yaml:"description"`
@@ -304,7 +389,11 @@ func (m Meta) GetYAML() (tag string, value interface{}) {
 		Categories  []string                     `yaml:"categories,omitempty"`
 		Tags        []string                     `yaml:"tags,omitempty"`
 		Subordinate bool                         `yaml:"subordinate,omitempty"`
-		Series      string                       `yaml:"series,omitempty"`
+		Series      interface{}                  `yaml:"series,omitempty"`
+		Maintainers []string                     `yaml:"maintainers,omitempty"`
+		License     string                       `yaml:"license,omitempty"`
+		MinVersion  string                       `yaml:"min-juju-version,omitempty"`
+		Bindings    map[string]interface{}       `yaml:"extra-bindings,omitempty"`
 	}{
 		Name:        m.Name,
 		Summary:     m.Summary,
@@ -315,8 +404,39 @@ func (m Meta) GetYAML() (tag string, value interface{}) {
 		Categories:  m.Categories,
 		Tags:        m.Tags,
 		Subordinate: m.Subordinate,
-		Series:      m.Series,
+		Series:      marshaledSeries(m),
+		Maintainers: m.Maintainers,
+		License:     m.License,
+		MinVersion:  m.MinJujuVersion,
+		Bindings:    marshaledExtraBindings(m.ExtraBindings),
+	}, m.Extensions)
+}
+
+// marshaledExtraBindings returns the value of the extra-bindings
+// field when the given bindings are marshaled as YAML, or nil
+// when there are none.
+func marshaledExtraBindings(bindings map[string]ExtraBinding) map[string]interface{} {
+	if len(bindings) == 0 {
+		return nil
 	}
+	mbs := make(map[string]interface{})
+	for name := range bindings {
+		mbs[name] = nil
+	}
+	return mbs
+}
+
+// marshaledSeries returns the value of the series field when
+// m is marshaled as YAML: a list when several series are
+// supported, a string when only one is, or nil when none is.
+func marshaledSeries(m Meta) interface{} {
+	if len(m.SupportedSeries) > 1 {
+		return m.SupportedSeries
+	}
+	if m.Series != "" {
+		return m.Series
+	}
+	return nil
 }
 
 type marshaledRelation Relation
@@ -352,43 +472,8 @@ func (r marshaledRelation) GetYAML() (tag string, value interface{}) {
 
 // Check checks that the metadata is well-formed.
 func (meta Meta) Check() error {
-	// Check for duplicate or forbidden relation names or interfaces.
-	names := map[string]bool{}
-	checkRelations := func(src map[string]Relation, role RelationRole) error {
-		for name, rel := range src {
-			if rel.Name != name {
-				return fmt.Errorf("charm %q has mismatched relation name %q; expected %q", meta.Name, rel.Name, name)
-			}
-			if rel.Role != role {
-				return fmt.Errorf("charm %q has mismatched role %q; expected %q", meta.Name, rel.Role, role)
-			}
-			// Container-scoped require relations on subordinates are allowed
-			// to use the otherwise-reserved juju-* namespace.
-			if !meta.Subordinate || role != RoleRequirer || rel.Scope != ScopeContainer {
-				if reservedName(name) {
-					return fmt.Errorf("charm %q using a reserved relation name: %q", meta.Name, name)
-				}
-			}
-			if role != RoleRequirer {
-				if reservedName(rel.Interface) {
-					return fmt.Errorf("charm %q relation %q using a reserved interface: %q", meta.Name, name, rel.Interface)
-				}
-			}
-			if names[name] {
-				return fmt.Errorf("charm %q using a duplicated relation name: %q", meta.Name, name)
-			}
-			names[name] = true
-		}
-		return nil
-	}
-	if err := checkRelations(meta.Provides, RoleProvider); err != nil {
-		return err
-	}
-	if err := checkRelations(meta.Requires, RoleRequirer); err != nil {
-		return err
-	}
-	if err := checkRelations(meta.Peers, RolePeer); err != nil {
-		return err
+	if errs := meta.endpointNameErrors(); len(errs) > 0 {
+		return errs[0]
 	}
 
 	// Subordinate charms must have at least one relation that
@@ -405,52 +490,200 @@ func (meta Meta) Check() error {
 			}
 		}
 		if !valid {
-			return fmt.Errorf("subordinate charm %q lacks \"requires\" relation with container scope", meta.Name)
+			return errorCodef(CodeInvalidSubordinate, "subordinate charm %q lacks \"requires\" relation with container scope", meta.Name)
 		}
 	}
 
 	if meta.Series != "" {
 		if !IsValidSeries(meta.Series) {
-			return fmt.Errorf("charm %q declares invalid series: %q", meta.Name, meta.Series)
+			return errorCodef(CodeInvalidSeries, "charm %q declares invalid series: %q", meta.Name, meta.Series)
 		}
 	}
+	if err := meta.checkSupportedSeries(); err != nil {
+		return err
+	}
+	if meta.MinJujuVersion != "" && !validJujuVersion.MatchString(meta.MinJujuVersion) {
+		return errorCodef(CodeInvalidMetadata, "charm %q declares invalid minimum Juju version: %q", meta.Name, meta.MinJujuVersion)
+	}
 
-	names = make(map[string]bool)
+	names := make(map[string]bool)
 	for name, store := range meta.Storage {
 		if store.Location != "" && store.Type != StorageFilesystem {
-			return fmt.Errorf(`charm %q storage %q: location may not be specified for "type: %s"`, meta.Name, name, store.Type)
+			return errorCodef(CodeInvalidStorage, `charm %q storage %q: location may not be specified for "type: %s"`, meta.Name, name, store.Type)
 		}
 		if store.Type == "" {
-			return fmt.Errorf("charm %q storage %q: type must be specified", meta.Name, name)
+			return errorCodef(CodeInvalidStorage, "charm %q storage %q: type must be specified", meta.Name, name)
 		}
 		if store.CountMin < 0 {
-			return fmt.Errorf("charm %q storage %q: invalid minimum count %d", meta.Name, name, store.CountMin)
+			return errorCodef(CodeInvalidStorage, "charm %q storage %q: invalid minimum count %d", meta.Name, name, store.CountMin)
 		}
 		if store.CountMax == 0 || store.CountMax < -1 {
-			return fmt.Errorf("charm %q storage %q: invalid maximum count %d", meta.Name, name, store.CountMax)
+			return errorCodef(CodeInvalidStorage, "charm %q storage %q: invalid maximum count %d", meta.Name, name, store.CountMax)
 		}
 		if names[name] {
-			return fmt.Errorf("charm %q storage %q: duplicated storage name", meta.Name, name)
+			return errorCodef(CodeDuplicateName, "charm %q storage %q: duplicated storage name", meta.Name, name)
 		}
 		names[name] = true
 	}
 
 	for name, payloadClass := range meta.PayloadClasses {
 		if payloadClass.Name != name {
-			return fmt.Errorf("mismatch on payload class name (%q != %q)", payloadClass.Name, name)
+			return errorCodef(CodeInvalidPayloadClass, "mismatch on payload class name (%q != %q)", payloadClass.Name, name)
 		}
 		if err := payloadClass.Validate(); err != nil {
 			return err
 		}
 	}
 
+	for name, resource := range meta.Resources {
+		if resource.Name != name {
+			return errorCodef(CodeInvalidResource, "mismatch on resource name (%q != %q)", resource.Name, name)
+		}
+		if err := resource.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, container := range meta.Containers {
+		if container.Name != name {
+			return errorCodef(CodeInvalidContainer, "mismatch on container name (%q != %q)", container.Name, name)
+		}
+		if err := container.Validate(&meta); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// CheckEndpointNames checks the names of the relations and extra
+// bindings of the charm, which together form the endpoints of its
+// applications. Relation names must be unique across the provides,
+// requires and peers roles, and may not be reserved, as the juju-*
+// names are, nor be used by an extra binding. Unlike Check, which
+// stops at the first of these errors, it returns a *ValidationError
+// holding a problem for each offending endpoint.
+func (meta Meta) CheckEndpointNames() error {
+	errs := meta.endpointNameErrors()
+	if len(errs) == 0 {
+		return nil
+	}
+	problems := make([]ValidationProblem, len(errs))
+	for i, err := range errs {
+		problems[i] = ValidationProblem{
+			Code:    ErrorCode(err),
+			Message: err.Error(),
+		}
+	}
+	return &ValidationError{
+		Problems: problems,
+	}
+}
+
+// endpointNameErrors returns the errors found in the names and
+// interfaces of the relations and extra bindings of the charm, at
+// most one per endpoint, sorted by message.
+func (meta Meta) endpointNameErrors() []error {
+	var errs []error
+	roles := make(map[string]RelationRole)
+	checkRelations := func(src map[string]Relation, role RelationRole) {
+		for _, name := range sortedRelationNames(src) {
+			rel := src[name]
+			err := meta.checkRelation(name, rel, role)
+			if err == nil {
+				if _, ok := roles[name]; ok {
+					err = errorCodef(CodeDuplicateName, "charm %q using a duplicated relation name: %q", meta.Name, name)
+				}
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if _, ok := roles[name]; !ok {
+				roles[name] = role
+			}
+		}
+	}
+	checkRelations(meta.Provides, RoleProvider)
+	checkRelations(meta.Requires, RoleRequirer)
+	checkRelations(meta.Peers, RolePeer)
+	names := make([]string, 0, len(meta.ExtraBindings))
+	for name := range meta.ExtraBindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		binding := meta.ExtraBindings[name]
+		switch {
+		case binding.Name != name:
+			errs = append(errs, errorCodef(CodeInvalidMetadata, "charm %q has mismatched extra binding name %q; expected %q", meta.Name, binding.Name, name))
+		case !validEndpointName.MatchString(name):
+			errs = append(errs, errorCodef(CodeInvalidMetadata, "charm %q has invalid extra binding name %q", meta.Name, name))
+		case reservedName(name):
+			errs = append(errs, errorCodef(CodeReservedName, "charm %q using a reserved extra binding name: %q", meta.Name, name))
+		default:
+			if _, ok := roles[name]; ok {
+				errs = append(errs, errorCodef(CodeDuplicateName, "charm %q extra binding %q has the same name as a relation", meta.Name, name))
+			}
+		}
+	}
+	sort.Sort(errorsByMessage(errs))
+	return errs
+}
+
+// checkRelation checks the name, role and interface
+// of the relation with the given name and role.
+func (meta Meta) checkRelation(name string, rel Relation, role RelationRole) error {
+	if rel.Name != name {
+		return errorCodef(CodeInvalidRelation, "charm %q has mismatched relation name %q; expected %q", meta.Name, rel.Name, name)
+	}
+	if rel.Role != role {
+		return errorCodef(CodeInvalidRelation, "charm %q has mismatched role %q; expected %q", meta.Name, rel.Role, role)
+	}
+	// Container-scoped require relations on subordinates are allowed
+	// to use the otherwise-reserved juju-* namespace.
+	if !meta.Subordinate || role != RoleRequirer || rel.Scope != ScopeContainer {
+		if reservedName(name) {
+			return errorCodef(CodeReservedName, "charm %q using a reserved relation name: %q", meta.Name, name)
+		}
+	}
+	if role != RoleRequirer {
+		if reservedName(rel.Interface) {
+			return errorCodef(CodeReservedName, "charm %q relation %q using a reserved interface: %q", meta.Name, name, rel.Interface)
+		}
+	}
+	return nil
+}
+
+func sortedRelationNames(rels map[string]Relation) []string {
+	names := make([]string, 0, len(rels))
+	for name := range rels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type errorsByMessage []error
+
+func (errs errorsByMessage) Len() int           { return len(errs) }
+func (errs errorsByMessage) Swap(i, j int)      { errs[i], errs[j] = errs[j], errs[i] }
+func (errs errorsByMessage) Less(i, j int) bool { return errs[i].Error() < errs[j].Error() }
+
 func reservedName(name string) bool {
 	return name == "juju" || strings.HasPrefix(name, "juju-")
 }
 
+func parseExtraBindings(bindings interface{}) map[string]ExtraBinding {
+	if bindings == nil {
+		return nil
+	}
+	result := make(map[string]ExtraBinding)
+	for name := range bindings.(map[string]interface{}) {
+		result[name] = ExtraBinding{Name: name}
+	}
+	return result
+}
+
 func parseRelations(relations interface{}, role RelationRole) map[string]Relation {
 	if relations == nil {
 		return nil
@@ -625,13 +858,13 @@ func (c storageCountC) Coerce(v interface{}, path []string) (newv interface{}, e
 		// We've got a count of the form "m": m represents
 		// both the minimum and maximum.
 		if m <= 0 {
-			return nil, fmt.Errorf("%s: invalid count %v", strings.Join(path[1:], ""), m)
+			return nil, errorCodef(CodeInvalidStorage, "%s: invalid count %v", strings.Join(path[1:], ""), m)
 		}
 		return [2]int{int(m), int(m)}, nil
 	}
 	match := storageCountRE.FindStringSubmatch(s.(string))
 	if match == nil {
-		return nil, fmt.Errorf("%s: value %q does not match 'm', 'm-n', or 'm+'", strings.Join(path[1:], ""), s)
+		return nil, errorCodef(CodeInvalidStorage, "%s: value %q does not match 'm', 'm-n', or 'm+'", strings.Join(path[1:], ""), s)
 	}
 	var m, n int
 	if m, err = strconv.Atoi(match[1]); err != nil {
@@ -666,34 +899,58 @@ func (c propertiesC) Coerce(v interface{}, path []string) (newv interface{}, err
 	return schema.OneOf(schema.Const("transient")).Coerce(v, path)
 }
 
+// validJujuVersion matches the Juju versions that may be given in the
+// min-juju-version field of metadata.yaml. It follows the Juju version
+// grammar, major.minor.patch or major.minor-tagpatch with an optional
+// build number, as in "2.9.42", "2.0-beta3" or "2.9.1.1", and also
+// allows the patch to be omitted, as in "2.9".
+var validJujuVersion = regexp.MustCompile(`^[0-9]{1,9}\.[0-9]{1,9}(?:(?:\.|-[a-z]+)[0-9]{1,9}(?:\.[0-9]{1,9})?)?$`)
+
+// charmSchemaFields holds the fields of metadata.yaml.
+var charmSchemaFields = schema.Fields{
+	"name":             schema.String(),
+	"summary":          schema.String(),
+	"description":      schema.String(),
+	"peers":            schema.StringMap(ifaceExpander(int64(1))),
+	"provides":         schema.StringMap(ifaceExpander(nil)),
+	"requires":         schema.StringMap(ifaceExpander(int64(1))),
+	"revision":         schema.Int(), // Obsolete
+	"format":           schema.Int(),
+	"subordinate":      schema.Bool(),
+	"categories":       schema.List(schema.String()),
+	"tags":             schema.List(schema.String()),
+	"series":           schema.OneOf(schema.String(), schema.List(schema.String())),
+	"storage":          schema.StringMap(storageSchema),
+	"payloads":         schema.StringMap(payloadClassSchema),
+	"resources":        schema.StringMap(resourceSchema),
+	"containers":       schema.StringMap(containerSchema),
+	"maintainer":       schema.String(),
+	"maintainers":      schema.List(schema.String()),
+	"license":          schema.String(),
+	"min-juju-version": schema.String(),
+	"extra-bindings":   schema.StringMap(schema.Const(nil)),
+}
+
 var charmSchema = schema.FieldMap(
-	schema.Fields{
-		"name":        schema.String(),
-		"summary":     schema.String(),
-		"description": schema.String(),
-		"peers":       schema.StringMap(ifaceExpander(int64(1))),
-		"provides":    schema.StringMap(ifaceExpander(nil)),
-		"requires":    schema.StringMap(ifaceExpander(int64(1))),
-		"revision":    schema.Int(), // Obsolete
-		"format":      schema.Int(),
-		"subordinate": schema.Bool(),
-		"categories":  schema.List(schema.String()),
-		"tags":        schema.List(schema.String()),
-		"series":      schema.OneOf(schema.String(), schema.List(schema.String())),
-		"storage":     schema.StringMap(storageSchema),
-		"payloads":    schema.StringMap(payloadClassSchema),
-	},
+	charmSchemaFields,
 	schema.Defaults{
-		"provides":    schema.Omit,
-		"requires":    schema.Omit,
-		"peers":       schema.Omit,
-		"revision":    schema.Omit,
-		"format":      1,
-		"subordinate": schema.Omit,
-		"categories":  schema.Omit,
-		"tags":        schema.Omit,
-		"series":      schema.Omit,
-		"storage":     schema.Omit,
-		"payloads":    schema.Omit,
+		"provides":         schema.Omit,
+		"requires":         schema.Omit,
+		"peers":            schema.Omit,
+		"revision":         schema.Omit,
+		"format":           1,
+		"subordinate":      schema.Omit,
+		"categories":       schema.Omit,
+		"tags":             schema.Omit,
+		"series":           schema.Omit,
+		"storage":          schema.Omit,
+		"payloads":         schema.Omit,
+		"resources":        schema.Omit,
+		"containers":       schema.Omit,
+		"maintainer":       schema.Omit,
+		"maintainers":      schema.Omit,
+		"license":          schema.Omit,
+		"min-juju-version": schema.Omit,
+		"extra-bindings":   schema.Omit,
 	},
 )
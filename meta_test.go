@@ -300,6 +300,208 @@ func (s *MetaSuite) TestMultiSeries(c *gc.C) {
 	}
 }
 
+func (s *MetaSuite) TestMaintainers(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Maintainers, gc.HasLen, 0)
+
+	meta, err = charm.ReadMeta(strings.NewReader(dummyMetadata + `
+maintainer: Alice <alice@example.com>
+maintainers:
+  - Bob <bob@example.com>
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Maintainers, jc.DeepEquals, []string{
+		"Alice <alice@example.com>",
+		"Bob <bob@example.com>",
+	})
+}
+
+func (s *MetaSuite) TestMinJujuVersion(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nmin-juju-version: 2.9.42\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.MinJujuVersion, gc.Equals, "2.9.42")
+
+	data, err := yaml.Marshal(meta)
+	c.Assert(err, gc.IsNil)
+	meta1, err := charm.ReadMeta(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta1.MinJujuVersion, gc.Equals, "2.9.42")
+
+	_, err = charm.ReadMeta(strings.NewReader(dummyMetadata + "\nmin-juju-version: latest\n"))
+	c.Assert(err, gc.ErrorMatches, `charm "a" declares invalid minimum Juju version: "latest"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidMetadata)
+}
+
+var jujuVersionTests = []struct {
+	version string
+	valid   bool
+}{
+	{"2.9", true},
+	{"2.9.42", true},
+	{"2.0-beta3", true},
+	{"2.9.1.1", true},
+	{"2.0-rc1.2", true},
+	{"2", false},
+	{"2.9.", false},
+	{"2.0-beta", false},
+	{"2.0-BETA3", false},
+	{"2.9.1.1.1", false},
+	{"v2.9", false},
+}
+
+func (s *MetaSuite) TestMinJujuVersionGrammar(c *gc.C) {
+	for i, test := range jujuVersionTests {
+		c.Logf("test %d: %q", i, test.version)
+		meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nmin-juju-version: \"" + test.version + "\"\n"))
+		if !test.valid {
+			c.Assert(err, gc.ErrorMatches, `charm "a" declares invalid minimum Juju version: .*`)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(meta.MinJujuVersion, gc.Equals, test.version)
+	}
+}
+
+func (s *MetaSuite) TestCheckEndpointNames(c *gc.C) {
+	rel := func(name string, role charm.RelationRole, iface string) charm.Relation {
+		return charm.Relation{
+			Name:      name,
+			Role:      role,
+			Interface: iface,
+			Scope:     charm.ScopeGlobal,
+		}
+	}
+	meta := charm.Meta{
+		Name:    "a",
+		Summary: "b",
+		Provides: map[string]charm.Relation{
+			"db":       rel("db", charm.RoleProvider, "mysql"),
+			"juju-foo": rel("juju-foo", charm.RoleProvider, "foo"),
+		},
+		Requires: map[string]charm.Relation{
+			"db":      rel("db", charm.RoleRequirer, "mysql"),
+			"website": rel("website", charm.RoleRequirer, "http"),
+		},
+		Peers: map[string]charm.Relation{
+			"cluster": rel("cluster", charm.RolePeer, "juju"),
+			"db":      rel("db", charm.RolePeer, "mysql"),
+		},
+		ExtraBindings: map[string]charm.ExtraBinding{
+			"admin":      {Name: "admin"},
+			"juju-admin": {Name: "juju-admin"},
+			"website":    {Name: "website"},
+		},
+	}
+	err := meta.CheckEndpointNames()
+	c.Assert(err, gc.FitsTypeOf, (*charm.ValidationError)(nil))
+	c.Assert(err.(*charm.ValidationError).Problems, jc.DeepEquals, []charm.ValidationProblem{{
+		Code:    charm.CodeDuplicateName,
+		Message: `charm "a" extra binding "website" has the same name as a relation`,
+	}, {
+		Code:    charm.CodeReservedName,
+		Message: `charm "a" relation "cluster" using a reserved interface: "juju"`,
+	}, {
+		Code:    charm.CodeDuplicateName,
+		Message: `charm "a" using a duplicated relation name: "db"`,
+	}, {
+		Code:    charm.CodeReservedName,
+		Message: `charm "a" using a reserved extra binding name: "juju-admin"`,
+	}, {
+		Code:    charm.CodeReservedName,
+		Message: `charm "a" using a reserved relation name: "juju-foo"`,
+	}})
+
+	// Check reports the first of the problems.
+	err = meta.Check()
+	c.Assert(err, gc.ErrorMatches, `charm "a" extra binding "website" has the same name as a relation`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeDuplicateName)
+
+	delete(meta.Provides, "juju-foo")
+	delete(meta.Requires, "db")
+	delete(meta.Peers, "cluster")
+	delete(meta.Peers, "db")
+	delete(meta.ExtraBindings, "juju-admin")
+	delete(meta.ExtraBindings, "website")
+	c.Assert(meta.CheckEndpointNames(), gc.IsNil)
+	c.Assert(meta.Check(), gc.IsNil)
+}
+
+func (s *MetaSuite) TestExtraBindings(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nextra-bindings:\n  admin-api:\n  cluster:\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.ExtraBindings, jc.DeepEquals, map[string]charm.ExtraBinding{
+		"admin-api": {Name: "admin-api"},
+		"cluster":   {Name: "cluster"},
+	})
+
+	data, err := yaml.Marshal(meta)
+	c.Assert(err, gc.IsNil)
+	meta1, err := charm.ReadMeta(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta1.ExtraBindings, jc.DeepEquals, meta.ExtraBindings)
+
+	_, err = charm.ReadMeta(strings.NewReader(dummyMetadata + "\nextra-bindings:\n  juju-admin:\n"))
+	c.Assert(err, gc.ErrorMatches, `charm "a" using a reserved extra binding name: "juju-admin"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeReservedName)
+
+	_, err = charm.ReadMeta(strings.NewReader(dummyMetadata + "\nprovides:\n  db: mysql\nextra-bindings:\n  db:\n"))
+	c.Assert(err, gc.ErrorMatches, `charm "a" extra binding "db" has the same name as a relation`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeDuplicateName)
+}
+
+const legacyMetadata = `
+ensemble: formula
+name: mysql
+description: |
+    MySQL database server.
+    A fast, stable and true multi-user SQL database.
+subordinate: 0
+provides:
+    server: mysql
+requires:
+    info: ensemble-info
+    master:
+        interface: mysql-oneway-replication
+        optional: 1
+`
+
+func (s *MetaSuite) TestReadMetaLegacy(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader(legacyMetadata))
+	c.Assert(err, gc.NotNil)
+
+	meta, err := charm.ReadMetaWithOptions(strings.NewReader(legacyMetadata), charm.ReadMetaOptions{Legacy: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Summary, gc.Equals, "MySQL database server.")
+	c.Assert(meta.Subordinate, gc.Equals, false)
+	c.Assert(meta.Requires["info"].Interface, gc.Equals, "juju-info")
+	c.Assert(meta.Requires["master"].Optional, gc.Equals, true)
+	c.Assert(meta.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeLegacyField,
+		Message: `field "optional" of relation "master" holds an integer; using true`,
+	}, {
+		Code:    charm.CodeLegacyField,
+		Message: `legacy metadata field "ensemble" has been ignored`,
+	}, {
+		Code:    charm.CodeLegacyField,
+		Message: `metadata field "subordinate" holds an integer; using false`,
+	}, {
+		Code:    charm.CodeLegacyField,
+		Message: `metadata has no summary; using "MySQL database server."`,
+	}, {
+		Code:    charm.CodeLegacyField,
+		Message: `relation "info" uses the legacy interface "ensemble-info"; using "juju-info"`,
+	}})
+}
+
+func (s *MetaSuite) TestReadMetaLegacyNoDescription(c *gc.C) {
+	meta, err := charm.ReadMetaWithOptions(strings.NewReader("name: foo\n"), charm.ReadMetaOptions{Legacy: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Summary, gc.Equals, "foo")
+	c.Assert(meta.Description, gc.Equals, "foo")
+	c.Assert(meta.Warnings, gc.HasLen, 2)
+}
+
 func (s *MetaSuite) TestCheckMismatchedRelationName(c *gc.C) {
 	// This  Check case cannot be covered by the above
 	// TestRelationsConstraints tests.
@@ -720,6 +922,9 @@ storage:
 		c.Logf("\n%s\n", prefix+test.yaml)
 		_, err := charm.ReadMeta(strings.NewReader(prefix + test.yaml))
 		c.Assert(err, gc.ErrorMatches, test.err)
+		if strings.HasPrefix(test.desc, "range") {
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidStorage)
+		}
 	}
 }
 
@@ -0,0 +1,233 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"encoding/json"
+)
+
+// jsonMeta holds the JSON representation of Meta. Its field names
+// match those used by the Juju API, and must not change, so that
+// services can serve charm metadata without converting it.
+type jsonMeta struct {
+	Name           string                   `json:"name"`
+	Summary        string                   `json:"summary"`
+	Description    string                   `json:"description"`
+	Subordinate    bool                     `json:"subordinate"`
+	Provides       map[string]Relation      `json:"provides,omitempty"`
+	Requires       map[string]Relation      `json:"requires,omitempty"`
+	Peers          map[string]Relation      `json:"peers,omitempty"`
+	Categories     []string                 `json:"categories,omitempty"`
+	Tags           []string                 `json:"tags,omitempty"`
+	Series         []string                 `json:"series,omitempty"`
+	Maintainers    []string                 `json:"maintainers,omitempty"`
+	License        string                   `json:"license,omitempty"`
+	MinJujuVersion string                   `json:"min-juju-version,omitempty"`
+	Storage        map[string]Storage       `json:"storage,omitempty"`
+	PayloadClasses map[string]PayloadClass  `json:"payload-classes,omitempty"`
+	Resources      map[string]Resource      `json:"resources,omitempty"`
+	Containers     map[string]Container     `json:"containers,omitempty"`
+	ExtraBindings  map[string]ExtraBinding  `json:"extra-bindings,omitempty"`
+	Extensions     map[string]interface{}   `json:"extensions,omitempty"`
+	Locales        map[string]LocalizedMeta `json:"locales,omitempty"`
+	Format         int                      `json:"format,omitempty"`
+	OldRevision    int                      `json:"old-revision,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The metadata is encoded with
+// the field names used by the Juju API, such as "payload-classes"
+// and "count-min"; all the series supported by the charm are held in
+// the "series" field. Warnings are not encoded.
+func (m Meta) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMeta{
+		Name:           m.Name,
+		Summary:        m.Summary,
+		Description:    m.Description,
+		Subordinate:    m.Subordinate,
+		Provides:       m.Provides,
+		Requires:       m.Requires,
+		Peers:          m.Peers,
+		Categories:     m.Categories,
+		Tags:           m.Tags,
+		Series:         m.supportedSeries(),
+		Maintainers:    m.Maintainers,
+		License:        m.License,
+		MinJujuVersion: m.MinJujuVersion,
+		Storage:        m.Storage,
+		PayloadClasses: m.PayloadClasses,
+		Resources:      m.Resources,
+		Containers:     m.Containers,
+		ExtraBindings:  m.ExtraBindings,
+		Extensions:     m.Extensions,
+		Locales:        m.Locales,
+		Format:         m.Format,
+		OldRevision:    m.OldRevision,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler by decoding metadata
+// encoded by MarshalJSON. Metadata encoded before Meta implemented
+// json.Marshaler, with Go field names and a single series, is also
+// accepted.
+func (m *Meta) UnmarshalJSON(data []byte) error {
+	var jm struct {
+		jsonMeta
+		Series json.RawMessage `json:"series"`
+
+		// Fields encoded only before Meta implemented json.Marshaler.
+		LegacyOldRevision    int                     `json:"OldRevision"`
+		LegacyPayloadClasses map[string]PayloadClass `json:"payloadclasses"`
+	}
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return err
+	}
+	*m = Meta{
+		Name:           jm.Name,
+		Summary:        jm.Summary,
+		Description:    jm.Description,
+		Subordinate:    jm.Subordinate,
+		Provides:       jm.Provides,
+		Requires:       jm.Requires,
+		Peers:          jm.Peers,
+		Categories:     jm.Categories,
+		Tags:           jm.Tags,
+		Maintainers:    jm.Maintainers,
+		License:        jm.License,
+		MinJujuVersion: jm.MinJujuVersion,
+		Storage:        jm.Storage,
+		PayloadClasses: jm.PayloadClasses,
+		Resources:      jm.Resources,
+		Containers:     jm.Containers,
+		ExtraBindings:  jm.ExtraBindings,
+		Extensions:     jm.Extensions,
+		Locales:        jm.Locales,
+		Format:         jm.Format,
+		OldRevision:    jm.OldRevision,
+	}
+	if m.PayloadClasses == nil {
+		m.PayloadClasses = jm.LegacyPayloadClasses
+	}
+	if m.OldRevision == 0 {
+		m.OldRevision = jm.LegacyOldRevision
+	}
+	if len(jm.Series) == 0 || string(jm.Series) == "null" {
+		return nil
+	}
+	if jm.Series[0] == '"' {
+		// Before Meta implemented json.Marshaler, only
+		// the default series was encoded.
+		return json.Unmarshal(jm.Series, &m.Series)
+	}
+	if err := json.Unmarshal(jm.Series, &m.SupportedSeries); err != nil {
+		return err
+	}
+	if len(m.SupportedSeries) > 0 {
+		m.Series = m.SupportedSeries[0]
+	}
+	return nil
+}
+
+// jsonStorage holds the JSON representation of Storage;
+// it has no methods so that it can be decoded without
+// recursion.
+type jsonStorage Storage
+
+// UnmarshalJSON implements json.Unmarshaler. As well as the field
+// names of the Juju API, the Go field names encoded before Meta
+// implemented json.Marshaler are accepted.
+func (s *Storage) UnmarshalJSON(data []byte) error {
+	var js struct {
+		jsonStorage
+
+		// Fields encoded only before Meta implemented json.Marshaler.
+		LegacyReadOnly    *bool   `json:"ReadOnly"`
+		LegacyCountMin    *int    `json:"CountMin"`
+		LegacyCountMax    *int    `json:"CountMax"`
+		LegacyMinimumSize *uint64 `json:"MinimumSize"`
+	}
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	*s = Storage(js.jsonStorage)
+	if js.LegacyReadOnly != nil {
+		s.ReadOnly = *js.LegacyReadOnly
+	}
+	if js.LegacyCountMin != nil {
+		s.CountMin = *js.LegacyCountMin
+	}
+	if js.LegacyCountMax != nil {
+		s.CountMax = *js.LegacyCountMax
+	}
+	if js.LegacyMinimumSize != nil {
+		s.MinimumSize = *js.LegacyMinimumSize
+	}
+	return nil
+}
+
+// jsonConfig holds the JSON representation of Config.
+type jsonConfig struct {
+	Options map[string]Option `json:"options"`
+}
+
+// MarshalJSON implements json.Marshaler. The config is encoded
+// with the field names used by the Juju API; extensions and
+// warnings are not encoded.
+func (c Config) MarshalJSON() ([]byte, error) {
+	options := c.Options
+	if options == nil {
+		options = make(map[string]Option)
+	}
+	return json.Marshal(jsonConfig{options})
+}
+
+// UnmarshalJSON implements json.Unmarshaler by decoding a config
+// encoded by MarshalJSON; as JSON field names are matched without
+// regard to case, configs encoded with Go field names before Config
+// implemented json.Marshaler are also accepted. As usual with JSON, numeric defaults are
+// decoded as float64 values.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var jc jsonConfig
+	if err := json.Unmarshal(data, &jc); err != nil {
+		return err
+	}
+	*c = Config{
+		Options: jc.Options,
+	}
+	if c.Options == nil {
+		c.Options = make(map[string]Option)
+	}
+	return nil
+}
+
+// jsonActions holds the JSON representation of Actions.
+type jsonActions struct {
+	ActionSpecs map[string]ActionSpec `json:"specs,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The actions are
+// encoded with the field names used by the Juju API;
+// warnings are not encoded.
+func (a Actions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonActions{a.ActionSpecs})
+}
+
+// UnmarshalJSON implements json.Unmarshaler by decoding actions
+// encoded by MarshalJSON, or encoded with Go field names before
+// Actions implemented json.Marshaler.
+func (a *Actions) UnmarshalJSON(data []byte) error {
+	var ja struct {
+		jsonActions
+		LegacyActionSpecs map[string]ActionSpec `json:"ActionSpecs"`
+	}
+	if err := json.Unmarshal(data, &ja); err != nil {
+		return err
+	}
+	*a = Actions{
+		ActionSpecs: ja.ActionSpecs,
+	}
+	if a.ActionSpecs == nil {
+		a.ActionSpecs = ja.LegacyActionSpecs
+	}
+	return nil
+}
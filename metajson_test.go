@@ -0,0 +1,275 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type MetaJSONSuite struct{}
+
+var _ = gc.Suite(&MetaJSONSuite{})
+
+const jsonTestMetadata = `
+name: storage
+summary: b
+description: c
+series: [trusty, xenial]
+provides:
+    website: http
+requires:
+    db:
+        interface: mysql
+        optional: true
+storage:
+    data:
+        type: filesystem
+        multiple:
+            range: 1-3
+        minimum-size: 1G
+resources:
+    blob:
+        type: file
+        filename: blob.tgz
+payloads:
+    monitor:
+        type: docker
+`
+
+// jsonFields returns the fields of the JSON encoding of v.
+func jsonFields(c *gc.C, v interface{}) map[string]interface{} {
+	data, err := json.Marshal(v)
+	c.Assert(err, jc.ErrorIsNil)
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	c.Assert(err, jc.ErrorIsNil)
+	return fields
+}
+
+func (s *MetaJSONSuite) TestMarshalMeta(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(jsonTestMetadata))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(jsonFields(c, meta), jc.DeepEquals, map[string]interface{}{
+		"name":        "storage",
+		"summary":     "b",
+		"description": "c",
+		"subordinate": false,
+		"series":      []interface{}{"trusty", "xenial"},
+		"provides": map[string]interface{}{
+			"website": map[string]interface{}{
+				"name":      "website",
+				"role":      "provider",
+				"interface": "http",
+				"optional":  false,
+				"limit":     0.0,
+				"scope":     "global",
+			},
+		},
+		"requires": map[string]interface{}{
+			"db": map[string]interface{}{
+				"name":      "db",
+				"role":      "requirer",
+				"interface": "mysql",
+				"optional":  true,
+				"limit":     1.0,
+				"scope":     "global",
+			},
+		},
+		"storage": map[string]interface{}{
+			"data": map[string]interface{}{
+				"name":         "data",
+				"description":  "",
+				"type":         "filesystem",
+				"shared":       false,
+				"read-only":    false,
+				"count-min":    1.0,
+				"count-max":    3.0,
+				"minimum-size": 1024.0,
+			},
+		},
+		"resources": map[string]interface{}{
+			"blob": map[string]interface{}{
+				"name":     "blob",
+				"type":     "file",
+				"filename": "blob.tgz",
+			},
+		},
+		"payload-classes": map[string]interface{}{
+			"monitor": map[string]interface{}{
+				"name": "monitor",
+				"type": "docker",
+			},
+		},
+	})
+}
+
+func (s *MetaJSONSuite) TestMetaRoundTrip(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(jsonTestMetadata))
+	c.Assert(err, jc.ErrorIsNil)
+	meta.Warnings = nil
+	data, err := json.Marshal(meta)
+	c.Assert(err, jc.ErrorIsNil)
+	var got charm.Meta
+	err = json.Unmarshal(data, &got)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(&got, jc.DeepEquals, meta)
+}
+
+func (s *MetaJSONSuite) TestMarshalConfig(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader(`
+options:
+    title:
+        type: string
+        description: The title.
+        default: My Title
+    port:
+        type: int
+`))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(jsonFields(c, config), jc.DeepEquals, map[string]interface{}{
+		"options": map[string]interface{}{
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "The title.",
+				"default":     "My Title",
+			},
+			"port": map[string]interface{}{
+				"type": "int",
+			},
+		},
+	})
+	c.Assert(jsonFields(c, charm.NewConfig()), jc.DeepEquals, map[string]interface{}{
+		"options": map[string]interface{}{},
+	})
+
+	data, err := json.Marshal(config)
+	c.Assert(err, jc.ErrorIsNil)
+	var got charm.Config
+	err = json.Unmarshal(data, &got)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(got.Options, jc.DeepEquals, config.Options)
+}
+
+func (s *MetaJSONSuite) TestMarshalActions(c *gc.C) {
+	actions := &charm.Actions{
+		ActionSpecs: map[string]charm.ActionSpec{
+			"snapshot": {
+				Description: "Take a snapshot.",
+				Params: map[string]interface{}{
+					"type": "object",
+				},
+			},
+		},
+	}
+	c.Assert(jsonFields(c, actions), jc.DeepEquals, map[string]interface{}{
+		"specs": map[string]interface{}{
+			"snapshot": map[string]interface{}{
+				"description": "Take a snapshot.",
+				"params": map[string]interface{}{
+					"type": "object",
+				},
+			},
+		},
+	})
+
+	data, err := json.Marshal(actions)
+	c.Assert(err, jc.ErrorIsNil)
+	var got charm.Actions
+	err = json.Unmarshal(data, &got)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(&got, jc.DeepEquals, actions)
+}
+
+// legacyMetaJSON holds metadata as it was encoded
+// before Meta implemented json.Marshaler.
+const legacyMetaJSON = `{
+	"Name": "storage",
+	"Summary": "b",
+	"Description": "c",
+	"Subordinate": false,
+	"Provides": {"website": {"Name": "website", "Role": "provider", "Interface": "http", "Optional": false, "Limit": 0, "Scope": "global"}},
+	"Requires": null,
+	"Peers": null,
+	"Format": 1,
+	"OldRevision": 7,
+	"Categories": ["misc"],
+	"Tags": null,
+	"Series": "trusty",
+	"Storage": {"data": {"Name": "data", "Description": "", "Type": "filesystem", "Shared": false, "ReadOnly": true, "CountMin": 1, "CountMax": 3, "MinimumSize": 1024, "Location": "/data", "Properties": ["transient"]}},
+	"payloadclasses": {"monitor": {"Name": "monitor", "Type": "docker"}}
+}`
+
+func (s *MetaJSONSuite) TestUnmarshalLegacyMeta(c *gc.C) {
+	var meta charm.Meta
+	err := json.Unmarshal([]byte(legacyMetaJSON), &meta)
+	c.Assert(err, jc.ErrorIsNil)
+	expect := charm.Meta{
+		Name:        "storage",
+		Summary:     "b",
+		Description: "c",
+		Provides: map[string]charm.Relation{
+			"website": {
+				Name:      "website",
+				Role:      charm.RoleProvider,
+				Interface: "http",
+				Scope:     charm.ScopeGlobal,
+			},
+		},
+		Format:      1,
+		OldRevision: 7,
+		Categories:  []string{"misc"},
+		Series:      "trusty",
+		Storage: map[string]charm.Storage{
+			"data": {
+				Name:        "data",
+				Type:        charm.StorageFilesystem,
+				ReadOnly:    true,
+				CountMin:    1,
+				CountMax:    3,
+				MinimumSize: 1024,
+				Location:    "/data",
+				Properties:  []string{"transient"},
+			},
+		},
+		PayloadClasses: map[string]charm.PayloadClass{
+			"monitor": {Name: "monitor", Type: "docker"},
+		},
+	}
+	c.Assert(meta, jc.DeepEquals, expect)
+
+	// The legacy metadata survives a round trip
+	// through the current encoding.
+	data, err := json.Marshal(meta)
+	c.Assert(err, jc.ErrorIsNil)
+	var got charm.Meta
+	err = json.Unmarshal(data, &got)
+	c.Assert(err, jc.ErrorIsNil)
+	expect.SupportedSeries = []string{"trusty"}
+	c.Assert(got, jc.DeepEquals, expect)
+}
+
+func (s *MetaJSONSuite) TestUnmarshalLegacyConfigAndActions(c *gc.C) {
+	var config charm.Config
+	err := json.Unmarshal([]byte(`{"Options": {"title": {"Type": "string", "Description": "The title.", "Default": "My Title"}}}`), &config)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(config.Options, jc.DeepEquals, map[string]charm.Option{
+		"title": {Type: "string", Description: "The title.", Default: "My Title"},
+	})
+
+	var actions charm.Actions
+	err = json.Unmarshal([]byte(`{"ActionSpecs": {"snapshot": {"Description": "Take a snapshot.", "Params": {"type": "object"}}}}`), &actions)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(actions.ActionSpecs, jc.DeepEquals, map[string]charm.ActionSpec{
+		"snapshot": {
+			Description: "Take a snapshot.",
+			Params:      map[string]interface{}{"type": "object"},
+		},
+	})
+}
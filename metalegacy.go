@@ -0,0 +1,95 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"strings"
+)
+
+// ReadMetaOptions holds options for ReadMetaWithOptions,
+// ReadCharmDirWithOptions and ReadCharmArchiveWithOptions.
+type ReadMetaOptions struct {
+	// Legacy specifies that the quirks of the metadata of very old
+	// charms, written for Ensemble or early versions of Juju, are
+	// accepted. Such metadata is normalized before being read,
+	// and a warning with the CodeLegacyField code is reported for
+	// each change made. The quirks accepted are:
+	//
+	//  - the ensemble field, which is ignored;
+	//  - the ensemble-info interface, which is read as juju-info;
+	//  - a missing summary, which is taken from the first
+	//    line of the description, or else from the name;
+	//  - a missing description, which is taken from the summary;
+	//  - integers in place of the booleans held by the subordinate
+	//    field and by the optional field of relations.
+	Legacy bool
+}
+
+// normalizeLegacyMeta rewrites the quirks of very old metadata held
+// in raw, as described in ReadMetaOptions.Legacy, and returns a
+// warning for each change made.
+func normalizeLegacyMeta(raw map[interface{}]interface{}) []Warning {
+	var warnings []Warning
+	if _, ok := raw["ensemble"]; ok {
+		delete(raw, "ensemble")
+		warnings = append(warnings, warningf(CodeLegacyField, "legacy metadata field %q has been ignored", "ensemble"))
+	}
+	name, _ := raw["name"].(string)
+	summary, _ := raw["summary"].(string)
+	description, _ := raw["description"].(string)
+	if summary == "" {
+		summary = strings.TrimSpace(strings.SplitN(strings.TrimSpace(description), "\n", 2)[0])
+		if summary == "" {
+			summary = name
+		}
+		raw["summary"] = summary
+		warnings = append(warnings, warningf(CodeLegacyField, "metadata has no summary; using %q", summary))
+	}
+	if description == "" {
+		raw["description"] = summary
+		warnings = append(warnings, warningf(CodeLegacyField, "metadata has no description; using the summary"))
+	}
+	if b, ok := legacyBool(raw["subordinate"]); ok {
+		raw["subordinate"] = b
+		warnings = append(warnings, warningf(CodeLegacyField, "metadata field %q holds an integer; using %v", "subordinate", b))
+	}
+	for _, role := range []string{"provides", "requires", "peers"} {
+		rels, ok := raw[role].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for relName, rel := range rels {
+			switch rel := rel.(type) {
+			case string:
+				if rel == "ensemble-info" {
+					rels[relName] = "juju-info"
+					warnings = append(warnings, warningf(CodeLegacyField, "relation %q uses the legacy interface %q; using %q", relName, "ensemble-info", "juju-info"))
+				}
+			case map[interface{}]interface{}:
+				if rel["interface"] == "ensemble-info" {
+					rel["interface"] = "juju-info"
+					warnings = append(warnings, warningf(CodeLegacyField, "relation %q uses the legacy interface %q; using %q", relName, "ensemble-info", "juju-info"))
+				}
+				if b, ok := legacyBool(rel["optional"]); ok {
+					rel["optional"] = b
+					warnings = append(warnings, warningf(CodeLegacyField, "field %q of relation %q holds an integer; using %v", "optional", relName, b))
+				}
+			}
+		}
+	}
+	sortWarnings(warnings)
+	return warnings
+}
+
+// legacyBool returns the boolean represented by v
+// and true if v holds an integer, or false otherwise.
+func legacyBool(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case int:
+		return v != 0, true
+	case int64:
+		return v != 0, true
+	}
+	return false, false
+}
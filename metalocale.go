@@ -0,0 +1,158 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/juju/schema"
+	"gopkg.in/yaml.v1"
+)
+
+// localeDir holds the name of the charm directory holding
+// translations of the charm metadata, in files named after their
+// language, such as metadata-locale/fr.yaml or
+// metadata-locale/pt-BR.yaml.
+const localeDir = "metadata-locale"
+
+// LocalizedMeta holds the translation of the summary and the
+// description of a charm into a single language.
+type LocalizedMeta struct {
+	Summary     string `bson:"summary,omitempty" json:"summary,omitempty"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+}
+
+var localizedMetaSchema = schema.FieldMap(
+	schema.Fields{
+		"summary":     schema.String(),
+		"description": schema.String(),
+	},
+	schema.Defaults{
+		"summary":     schema.Omit,
+		"description": schema.Omit,
+	},
+)
+
+// ReadLocalizedMeta reads the content of a file from the
+// metadata-locale directory of a charm.
+func ReadLocalizedMeta(r io.Reader) (LocalizedMeta, error) {
+	data, err := readDocument(r, "metadata translation", MaxDocumentSize)
+	if err != nil {
+		return LocalizedMeta{}, err
+	}
+	raw := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, raw); err != nil {
+		return LocalizedMeta{}, withCode(CodeInvalidMetadata, err)
+	}
+	v, err := localizedMetaSchema.Coerce(raw, nil)
+	if err != nil {
+		return LocalizedMeta{}, errorCodef(CodeInvalidMetadata, "metadata translation: %v", err)
+	}
+	m := v.(map[string]interface{})
+	var lm LocalizedMeta
+	if s, ok := m["summary"].(string); ok {
+		lm.Summary = s
+	}
+	if s, ok := m["description"].(string); ok {
+		lm.Description = s
+	}
+	return lm, nil
+}
+
+var validLanguage = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{1,8})*$`)
+
+// normalizeLanguage returns the given language tag in the form used
+// as a key of Meta.Locales: lower case, with subtags separated by
+// hyphens and without any encoding or modifier, so that POSIX locale
+// names such as "pt_BR.UTF-8" are accepted.
+func normalizeLanguage(lang string) string {
+	if i := strings.IndexAny(lang, ".@"); i >= 0 {
+		lang = lang[:i]
+	}
+	return strings.ToLower(strings.Replace(lang, "_", "-", -1))
+}
+
+// languageFallbacks returns the languages to look for, in order,
+// when text in the given language is requested: the language
+// itself, followed by the language with its trailing subtags
+// removed one by one.
+func languageFallbacks(lang string) []string {
+	lang = normalizeLanguage(lang)
+	var langs []string
+	for lang != "" {
+		langs = append(langs, lang)
+		i := strings.LastIndex(lang, "-")
+		if i < 0 {
+			break
+		}
+		lang = lang[:i]
+	}
+	return langs
+}
+
+// LocalizedSummary returns the summary of the charm in the given
+// language, such as "pt-BR". If there is no translation for that
+// language, the translation for the language without its region or
+// other subtags is used, if any, and failing that, the summary from
+// the charm metadata.
+func (m *Meta) LocalizedSummary(lang string) string {
+	return m.localized(lang, m.Summary, func(lm LocalizedMeta) string {
+		return lm.Summary
+	})
+}
+
+// LocalizedDescription is like LocalizedSummary,
+// but returns the description of the charm.
+func (m *Meta) LocalizedDescription(lang string) string {
+	return m.localized(lang, m.Description, func(lm LocalizedMeta) string {
+		return lm.Description
+	})
+}
+
+func (m *Meta) localized(lang, def string, get func(LocalizedMeta) string) string {
+	for _, l := range languageFallbacks(lang) {
+		if s := get(m.Locales[l]); s != "" {
+			return s
+		}
+	}
+	return def
+}
+
+// readLocales reads the translations of the charm metadata from the
+// given files of the charm's metadata-locale directory, using open
+// to open them. Files without the .yaml extension are ignored.
+func readLocales(names []string, open func(name string) (io.ReadCloser, error)) (map[string]LocalizedMeta, error) {
+	sort.Strings(names)
+	var locales map[string]LocalizedMeta
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".yaml") {
+			continue
+		}
+		lang := normalizeLanguage(strings.TrimSuffix(name, ".yaml"))
+		if !validLanguage.MatchString(lang) {
+			return nil, errorCodef(CodeInvalidMetadata, "invalid metadata translation file name %q", path.Join(localeDir, name))
+		}
+		if _, ok := locales[lang]; ok {
+			return nil, errorCodef(CodeInvalidMetadata, "duplicate metadata translation for language %q", lang)
+		}
+		r, err := open(path.Join(localeDir, name))
+		if err != nil {
+			return nil, err
+		}
+		lm, err := ReadLocalizedMeta(r)
+		r.Close()
+		if err != nil {
+			return nil, annotateCodef(CodeInvalidMetadata, err, "cannot read %s: %v", path.Join(localeDir, name), err)
+		}
+		if locales == nil {
+			locales = make(map[string]LocalizedMeta)
+		}
+		locales[lang] = lm
+	}
+	return locales, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type MetaLocaleSuite struct{}
+
+var _ = gc.Suite(&MetaLocaleSuite{})
+
+func (s *MetaLocaleSuite) TestReadLocalizedMeta(c *gc.C) {
+	lm, err := charm.ReadLocalizedMeta(strings.NewReader(`
+summary: Résumé
+description: Une description.
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(lm, jc.DeepEquals, charm.LocalizedMeta{
+		Summary:     "Résumé",
+		Description: "Une description.",
+	})
+
+	lm, err = charm.ReadLocalizedMeta(strings.NewReader(`summary: Résumé`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(lm, jc.DeepEquals, charm.LocalizedMeta{Summary: "Résumé"})
+}
+
+func (s *MetaLocaleSuite) TestReadLocalizedMetaErrors(c *gc.C) {
+	_, err := charm.ReadLocalizedMeta(strings.NewReader(`summary: [a, b]`))
+	c.Assert(err, gc.ErrorMatches, `metadata translation: summary: expected string, got .*`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidMetadata)
+
+	_, err = charm.ReadLocalizedMeta(strings.NewReader(`{`))
+	c.Assert(err, gc.NotNil)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidMetadata)
+}
+
+var localizedTests = []struct {
+	lang        string
+	summary     string
+	description string
+}{{
+	lang:        "en",
+	summary:     "summary",
+	description: "description",
+}, {
+	lang:        "",
+	summary:     "summary",
+	description: "description",
+}, {
+	lang:        "fr",
+	summary:     "résumé",
+	description: "description en français",
+}, {
+	lang:        "fr-CA",
+	summary:     "résumé",
+	description: "description en français",
+}, {
+	lang:        "pt-BR",
+	summary:     "resumo brasileiro",
+	description: "descrição",
+}, {
+	lang:        "pt_BR.UTF-8",
+	summary:     "resumo brasileiro",
+	description: "descrição",
+}, {
+	// Missing fields fall back field by field.
+	lang:        "pt-PT",
+	summary:     "resumo",
+	description: "descrição",
+}}
+
+func (s *MetaLocaleSuite) TestLocalized(c *gc.C) {
+	meta := &charm.Meta{
+		Summary:     "summary",
+		Description: "description",
+		Locales: map[string]charm.LocalizedMeta{
+			"fr": {
+				Summary:     "résumé",
+				Description: "description en français",
+			},
+			"pt": {
+				Summary:     "resumo",
+				Description: "descrição",
+			},
+			"pt-br": {
+				Summary: "resumo brasileiro",
+			},
+		},
+	}
+	for i, test := range localizedTests {
+		c.Logf("test %d: %q", i, test.lang)
+		c.Assert(meta.LocalizedSummary(test.lang), gc.Equals, test.summary)
+		c.Assert(meta.LocalizedDescription(test.lang), gc.Equals, test.description)
+	}
+}
+
+func (s *MetaLocaleSuite) writeLocales(c *gc.C, dir string, files map[string]string) {
+	localeDir := filepath.Join(dir, "metadata-locale")
+	err := os.Mkdir(localeDir, 0755)
+	c.Assert(err, gc.IsNil)
+	for name, data := range files {
+		err := ioutil.WriteFile(filepath.Join(localeDir, name), []byte(data), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+}
+
+func (s *MetaLocaleSuite) TestReadCharmWithLocales(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	s.writeLocales(c, path, map[string]string{
+		"fr.yaml":    "summary: résumé\n",
+		"pt_BR.yaml": "summary: resumo\ndescription: descrição\n",
+		"README":     "not a translation",
+	})
+	expect := map[string]charm.LocalizedMeta{
+		"fr":    {Summary: "résumé"},
+		"pt-br": {Summary: "resumo", Description: "descrição"},
+	}
+
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta().Locales, jc.DeepEquals, expect)
+	c.Assert(dir.Meta().LocalizedSummary("fr-FR"), gc.Equals, "résumé")
+
+	archive := archiveDir(c, path)
+	c.Assert(archive.Meta().Locales, jc.DeepEquals, expect)
+}
+
+func (s *MetaLocaleSuite) TestReadCharmWithoutLocales(c *gc.C) {
+	dir, err := charm.ReadCharmDir(TestCharms.CharmDirPath("dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta().Locales, gc.IsNil)
+}
+
+func (s *MetaLocaleSuite) TestReadCharmWithBadLocales(c *gc.C) {
+	path := TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	s.writeLocales(c, path, map[string]string{
+		"french.yaml": "summary: résumé\n",
+	})
+	_, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.ErrorMatches, `invalid metadata translation file name "metadata-locale/french.yaml"`)
+
+	path = TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	s.writeLocales(c, path, map[string]string{
+		"fr.yaml": "summary: 42\n",
+	})
+	_, err = charm.ReadCharmDir(path)
+	c.Assert(err, gc.ErrorMatches, `cannot read metadata-locale/fr.yaml: metadata translation: summary: expected string, got int\(42\)`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidMetadata)
+
+	path = TestCharms.ClonedDirPath(c.MkDir(), "dummy")
+	s.writeLocales(c, path, map[string]string{
+		"pt-BR.yaml": "summary: resumo\n",
+		"pt_BR.yaml": "summary: resumo\n",
+	})
+	_, err = charm.ReadCharmDir(path)
+	c.Assert(err, gc.ErrorMatches, `duplicate metadata translation for language "pt-br"`)
+}
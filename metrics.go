@@ -6,7 +6,6 @@ package charm
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strconv"
 	"strings"
 
@@ -63,7 +62,7 @@ type Metrics struct {
 
 // ReadMetrics reads a MetricsDeclaration in YAML format.
 func ReadMetrics(r io.Reader) (*Metrics, error) {
-	data, err := ioutil.ReadAll(r)
+	data, err := readDocument(r, MetricsFile, MaxDocumentSize)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,104 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// NameValidationProfile holds a set of rules for validating charm
+// names. A profile may be chosen for a single parse, by using its
+// ParseURL and ParseReference methods, or for the whole package with
+// SetDefaultNameValidationProfile.
+type NameValidationProfile struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var (
+	// LegacyNameValidationProfile holds the rules traditionally
+	// used for charm names: lower case letters, digits and
+	// hyphens, starting with a letter, where no hyphen-separated
+	// part may consist only of digits. It is the default profile.
+	LegacyNameValidationProfile = &NameValidationProfile{
+		name:    "legacy",
+		pattern: validName,
+	}
+
+	// CharmHubNameValidationProfile holds the rules used by
+	// Charmhub, which also allows names to start with a digit
+	// and hyphen-separated parts made only of digits. Note that
+	// a trailing part made only of digits is still interpreted
+	// as a revision when parsing URLs.
+	CharmHubNameValidationProfile = &NameValidationProfile{
+		name:    "charmhub",
+		pattern: regexp.MustCompile("^[a-z0-9]+(-[a-z0-9]+)*$"),
+	}
+)
+
+// NewNameValidationProfile returns a profile with the given name
+// that accepts charm names matching the given regular expression.
+// The expression is anchored at both ends.
+func NewNameValidationProfile(name, pattern string) (*NameValidationProfile, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid name validation pattern %q: %v", pattern, err)
+	}
+	return &NameValidationProfile{
+		name:    name,
+		pattern: re,
+	}, nil
+}
+
+// Name returns the name of the profile.
+func (p *NameValidationProfile) Name() string {
+	return p.name
+}
+
+// IsValid reports whether name is a valid charm name
+// according to the profile.
+func (p *NameValidationProfile) IsValid(name string) bool {
+	return p.pattern.MatchString(name)
+}
+
+// ParseURL is like the ParseURL function, but validates
+// the charm name with the profile.
+func (p *NameValidationProfile) ParseURL(url string) (*URL, error) {
+	return parseURLWith(url, &urlValidator{profile: p})
+}
+
+// ParseReference is like the ParseReference function, but validates
+// the charm name with the profile.
+func (p *NameValidationProfile) ParseReference(url string) (*Reference, error) {
+	return parseReferenceAndSchema(url, &urlValidator{profile: p})
+}
+
+var (
+	defaultNameProfileMutex sync.RWMutex
+	defaultNameProfile      = LegacyNameValidationProfile
+)
+
+// DefaultNameValidationProfile returns the profile used by IsValidName
+// and by the functions parsing charm URLs.
+func DefaultNameValidationProfile() *NameValidationProfile {
+	defaultNameProfileMutex.RLock()
+	defer defaultNameProfileMutex.RUnlock()
+	return defaultNameProfile
+}
+
+// SetDefaultNameValidationProfile sets the profile returned by
+// DefaultNameValidationProfile and returns the previous one.
+// If p is nil, LegacyNameValidationProfile is used.
+func SetDefaultNameValidationProfile(p *NameValidationProfile) *NameValidationProfile {
+	if p == nil {
+		p = LegacyNameValidationProfile
+	}
+	defaultNameProfileMutex.Lock()
+	defer defaultNameProfileMutex.Unlock()
+	old := defaultNameProfile
+	defaultNameProfile = p
+	return old
+}
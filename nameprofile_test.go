@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type NameProfileSuite struct{}
+
+var _ = gc.Suite(&NameProfileSuite{})
+
+var nameProfileTests = []struct {
+	name     string
+	legacy   bool
+	charmhub bool
+}{
+	{"wordpress", true, true},
+	{"mysql-server", true, true},
+	{"7zip", false, true},
+	{"foo-2x", true, true},
+	{"foo-22-bar", false, true},
+	{"foo--bar", false, false},
+	{"Foo", false, false},
+	{"foo-", false, false},
+}
+
+func (s *NameProfileSuite) TestBuiltinProfiles(c *gc.C) {
+	for i, test := range nameProfileTests {
+		c.Logf("test %d: %q", i, test.name)
+		c.Assert(charm.LegacyNameValidationProfile.IsValid(test.name), gc.Equals, test.legacy)
+		c.Assert(charm.CharmHubNameValidationProfile.IsValid(test.name), gc.Equals, test.charmhub)
+	}
+	c.Assert(charm.LegacyNameValidationProfile.Name(), gc.Equals, "legacy")
+	c.Assert(charm.CharmHubNameValidationProfile.Name(), gc.Equals, "charmhub")
+}
+
+func (s *NameProfileSuite) TestCustomProfile(c *gc.C) {
+	p, err := charm.NewNameValidationProfile("strict", "[a-z]{3,10}")
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Name(), gc.Equals, "strict")
+	c.Assert(p.IsValid("wordpress"), gc.Equals, true)
+	c.Assert(p.IsValid("mysql-server"), gc.Equals, false)
+	c.Assert(p.IsValid("ab"), gc.Equals, false)
+	// The pattern is anchored.
+	c.Assert(p.IsValid("wordpress wordpress"), gc.Equals, false)
+
+	_, err = charm.NewNameValidationProfile("bad", "[a-z")
+	c.Assert(err, gc.ErrorMatches, `invalid name validation pattern "\[a-z": .*`)
+}
+
+func (s *NameProfileSuite) TestParseWithProfile(c *gc.C) {
+	_, err := charm.ParseURL("cs:trusty/7zip-3")
+	c.Assert(err, gc.ErrorMatches, `charm URL has invalid charm name: "cs:trusty/7zip-3"`)
+
+	url, err := charm.CharmHubNameValidationProfile.ParseURL("cs:trusty/7zip-3")
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, gc.DeepEquals, &charm.URL{
+		Schema:   "cs",
+		Series:   "trusty",
+		Name:     "7zip",
+		Revision: 3,
+	})
+
+	ref, err := charm.CharmHubNameValidationProfile.ParseReference("7zip")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ref.Schema, gc.Equals, "cs")
+	c.Assert(ref.Name, gc.Equals, "7zip")
+
+	strict, err := charm.NewNameValidationProfile("strict", "[a-z]+")
+	c.Assert(err, gc.IsNil)
+	_, err = strict.ParseURL("cs:trusty/mysql-server")
+	c.Assert(err, gc.ErrorMatches, `charm URL has invalid charm name: "cs:trusty/mysql-server"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidName)
+}
+
+func (s *NameProfileSuite) TestDefaultProfile(c *gc.C) {
+	c.Assert(charm.DefaultNameValidationProfile(), gc.Equals, charm.LegacyNameValidationProfile)
+	old := charm.SetDefaultNameValidationProfile(charm.CharmHubNameValidationProfile)
+	defer charm.SetDefaultNameValidationProfile(old)
+	c.Assert(old, gc.Equals, charm.LegacyNameValidationProfile)
+
+	c.Assert(charm.IsValidName("7zip"), gc.Equals, true)
+	_, err := charm.ParseURL("cs:trusty/7zip")
+	c.Assert(err, gc.IsNil)
+	urls, errs := charm.ParseURLs([]string{"cs:trusty/7zip"})
+	c.Assert(errs[0], gc.IsNil)
+	c.Assert(urls[0].Name, gc.Equals, "7zip")
+	c.Assert(charm.ValidateURLString("cs:trusty/7zip", charm.ValidateURLOptions{}), gc.HasLen, 0)
+	c.Assert(charm.ValidateURLString("cs:trusty/7zip", charm.ValidateURLOptions{
+		NameProfile: charm.LegacyNameValidationProfile,
+	}), gc.HasLen, 1)
+
+	// Setting a nil profile restores the legacy rules.
+	charm.SetDefaultNameValidationProfile(nil)
+	c.Assert(charm.IsValidName("7zip"), gc.Equals, false)
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/juju/names"
+)
+
+// parallelParseThreshold holds the number of URLs above which
+// ParseURLs parses its input in parallel.
+const parallelParseThreshold = 1024
+
+// ParseURLs parses each of the given charm URL strings as ParseURL
+// does. It returns a slice of URLs and a slice of errors, both with
+// the same length as urlStrs; for each index, exactly one of the
+// URL and the error is non-nil.
+//
+// ParseURLs is intended for parsing large numbers of URLs: the
+// results of validating URL components such as series and user
+// names are shared between URLs, and large inputs are parsed
+// in parallel.
+func ParseURLs(urlStrs []string) ([]*URL, []error) {
+	urls := make([]*URL, len(urlStrs))
+	errs := make([]error, len(urlStrs))
+	workers := runtime.GOMAXPROCS(0)
+	if len(urlStrs) < parallelParseThreshold || workers < 2 {
+		parseURLRange(urlStrs, urls, errs, newURLValidator())
+		return urls, errs
+	}
+	chunk := (len(urlStrs) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(urlStrs); start += chunk {
+		end := start + chunk
+		if end > len(urlStrs) {
+			end = len(urlStrs)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			parseURLRange(urlStrs[start:end], urls[start:end], errs[start:end], newURLValidator())
+		}(start, end)
+	}
+	wg.Wait()
+	return urls, errs
+}
+
+func parseURLRange(urlStrs []string, urls []*URL, errs []error, v *urlValidator) {
+	for i, urlStr := range urlStrs {
+		urls[i], errs[i] = parseURLWith(urlStr, v)
+	}
+}
+
+// urlValidator validates the components of charm URLs. If its maps
+// are not nil, it remembers the results in them so that each distinct
+// value is only checked once; such a urlValidator must not be used
+// concurrently. If profile is not nil, it is used to validate charm
+// names instead of the default profile. A nil *urlValidator validates
+// without remembering anything.
+type urlValidator struct {
+	profile *NameValidationProfile
+	series  map[string]bool
+	users   map[string]bool
+	names   map[string]bool
+}
+
+func newURLValidator() *urlValidator {
+	return &urlValidator{
+		profile: DefaultNameValidationProfile(),
+		series:  make(map[string]bool),
+		users:   make(map[string]bool),
+		names:   make(map[string]bool),
+	}
+}
+
+func (v *urlValidator) isValidSeries(series string) bool {
+	if v == nil {
+		return IsValidSeries(series)
+	}
+	return v.check(v.series, series, IsValidSeries)
+}
+
+func (v *urlValidator) isValidUser(user string) bool {
+	if v == nil {
+		return names.IsValidUser(user)
+	}
+	return v.check(v.users, user, names.IsValidUser)
+}
+
+func (v *urlValidator) isValidName(name string) bool {
+	if v == nil {
+		return IsValidName(name)
+	}
+	valid := IsValidName
+	if v.profile != nil {
+		valid = v.profile.IsValid
+	}
+	return v.check(v.names, name, valid)
+}
+
+// check returns the result of valid(s), using cache to remember
+// it if cache is not nil.
+func (v *urlValidator) check(cache map[string]bool, s string, valid func(string) bool) bool {
+	if cache == nil {
+		return valid(s)
+	}
+	ok, found := cache[s]
+	if !found {
+		ok = valid(s)
+		cache[s] = ok
+	}
+	return ok
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ParseURLsSuite struct{}
+
+var _ = gc.Suite(&ParseURLsSuite{})
+
+func (s *ParseURLsSuite) TestParseURLs(c *gc.C) {
+	in := []string{
+		"cs:~user/trusty/wordpress-42",
+		"cs:trusty/wordpress",
+		"local:precise/mysql-1",
+		"cs:~bad_user/trusty/wordpress",
+		"cs:trusty/wordpress",
+		"cs:wordpress",
+		"bs:trusty/wordpress",
+	}
+	urls, errs := charm.ParseURLs(in)
+	c.Assert(urls, gc.HasLen, len(in))
+	c.Assert(errs, gc.HasLen, len(in))
+	for i, urlStr := range in {
+		c.Logf("test %d: %q", i, urlStr)
+		expectURL, expectErr := charm.ParseURL(urlStr)
+		if expectErr != nil {
+			c.Assert(urls[i], gc.IsNil)
+			c.Assert(errs[i].Error(), gc.Equals, expectErr.Error())
+			continue
+		}
+		c.Assert(errs[i], gc.IsNil)
+		c.Assert(urls[i], jc.DeepEquals, expectURL)
+	}
+	// Equal inputs produce distinct URL values.
+	c.Assert(urls[1], gc.Not(gc.Equals), urls[4])
+}
+
+func (s *ParseURLsSuite) TestParseURLsParallel(c *gc.C) {
+	const n = 5000
+	in := make([]string, n)
+	for i := range in {
+		if i%100 == 0 {
+			in[i] = fmt.Sprintf("cs:trusty/Bad-%d", i)
+		} else {
+			in[i] = fmt.Sprintf("cs:~user%d/trusty/wordpress-%d", i%7, i)
+		}
+	}
+	urls, errs := charm.ParseURLs(in)
+	c.Assert(urls, gc.HasLen, n)
+	c.Assert(errs, gc.HasLen, n)
+	for i := range in {
+		if i%100 == 0 {
+			c.Assert(urls[i], gc.IsNil)
+			c.Assert(errs[i], gc.ErrorMatches, `charm URL has invalid charm name: ".*"`)
+			continue
+		}
+		c.Assert(errs[i], gc.IsNil)
+		c.Assert(urls[i].String(), gc.Equals, in[i])
+	}
+}
+
+func (s *ParseURLsSuite) TestParseURLsEmpty(c *gc.C) {
+	urls, errs := charm.ParseURLs(nil)
+	c.Assert(urls, gc.HasLen, 0)
+	c.Assert(errs, gc.HasLen, 0)
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+// MetaPatch holds overrides that may be applied to charm metadata
+// with Meta.Patch, for instance to generate the metadata of a
+// forked charm.
+type MetaPatch struct {
+	// Summary, if not empty, replaces the charm's summary.
+	Summary string
+
+	// Description, if not empty, replaces the charm's description.
+	Description string
+
+	// Maintainers, if not nil, replaces the charm's maintainers.
+	Maintainers []string
+
+	// Provides, Requires and Peers hold relations to add to the
+	// charm, keyed by relation name. The Name and Role fields of
+	// each relation are filled in from the key and the map it is
+	// held in, and an empty Scope defaults to ScopeGlobal. They
+	// may not replace relations the charm already defines.
+	Provides map[string]Relation
+	Requires map[string]Relation
+	Peers    map[string]Relation
+}
+
+// Patch returns a copy of the metadata with the given overrides
+// applied. The receiver is not modified. The resulting metadata
+// is checked for validity.
+func (m *Meta) Patch(patch MetaPatch) (*Meta, error) {
+	meta := *m
+	if patch.Summary != "" {
+		meta.Summary = patch.Summary
+	}
+	if patch.Description != "" {
+		meta.Description = patch.Description
+	}
+	if patch.Maintainers != nil {
+		meta.Maintainers = append([]string(nil), patch.Maintainers...)
+	}
+	var err error
+	if meta.Provides, err = meta.patchRelations(m.Provides, patch.Provides, RoleProvider); err != nil {
+		return nil, err
+	}
+	if meta.Requires, err = meta.patchRelations(m.Requires, patch.Requires, RoleRequirer); err != nil {
+		return nil, err
+	}
+	if meta.Peers, err = meta.patchRelations(m.Peers, patch.Peers, RolePeer); err != nil {
+		return nil, err
+	}
+	if err := meta.Check(); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// patchRelations returns a new map holding the relations in orig
+// along with the extra relations, which are given the specified role.
+func (m *Meta) patchRelations(orig, extra map[string]Relation, role RelationRole) (map[string]Relation, error) {
+	if len(extra) == 0 {
+		return orig, nil
+	}
+	rels := make(map[string]Relation, len(orig)+len(extra))
+	for name, rel := range orig {
+		rels[name] = rel
+	}
+	for name, rel := range extra {
+		if m.hasRelation(name) {
+			return nil, errorCodef(CodeDuplicateName, "charm %q already has a relation named %q", m.Name, name)
+		}
+		rel.Name = name
+		rel.Role = role
+		if rel.Scope == "" {
+			rel.Scope = ScopeGlobal
+		}
+		rels[name] = rel
+	}
+	return rels, nil
+}
+
+func (m *Meta) hasRelation(name string) bool {
+	for _, rels := range []map[string]Relation{m.Provides, m.Requires, m.Peers} {
+		if _, ok := rels[name]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type PatchSuite struct{}
+
+var _ = gc.Suite(&PatchSuite{})
+
+const patchMetadata = `
+name: wordpress
+summary: "blog engine"
+description: "A pretty popular blog engine"
+maintainer: Alice <alice@example.com>
+provides:
+  url: http
+requires:
+  db: mysql
+`
+
+func readPatchMeta(c *gc.C) *charm.Meta {
+	meta, err := charm.ReadMeta(strings.NewReader(patchMetadata))
+	c.Assert(err, gc.IsNil)
+	return meta
+}
+
+func (s *PatchSuite) TestPatch(c *gc.C) {
+	meta := readPatchMeta(c)
+	patched, err := meta.Patch(charm.MetaPatch{
+		Summary:     "internal blog engine",
+		Maintainers: []string{"Ops <ops@example.com>"},
+		Requires: map[string]charm.Relation{
+			"logging": {Interface: "syslog", Limit: 1},
+		},
+		Peers: map[string]charm.Relation{
+			"cluster": {Interface: "wp-cluster"},
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(patched.Summary, gc.Equals, "internal blog engine")
+	c.Assert(patched.Description, gc.Equals, meta.Description)
+	c.Assert(patched.Maintainers, jc.DeepEquals, []string{"Ops <ops@example.com>"})
+	c.Assert(patched.Provides, jc.DeepEquals, meta.Provides)
+	c.Assert(patched.Requires, jc.DeepEquals, map[string]charm.Relation{
+		"db": meta.Requires["db"],
+		"logging": {
+			Name:      "logging",
+			Role:      charm.RoleRequirer,
+			Interface: "syslog",
+			Limit:     1,
+			Scope:     charm.ScopeGlobal,
+		},
+	})
+	c.Assert(patched.Peers, jc.DeepEquals, map[string]charm.Relation{
+		"cluster": {
+			Name:      "cluster",
+			Role:      charm.RolePeer,
+			Interface: "wp-cluster",
+			Scope:     charm.ScopeGlobal,
+		},
+	})
+
+	// The original metadata is left untouched.
+	c.Assert(meta, jc.DeepEquals, readPatchMeta(c))
+}
+
+func (s *PatchSuite) TestPatchEmpty(c *gc.C) {
+	meta := readPatchMeta(c)
+	patched, err := meta.Patch(charm.MetaPatch{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(patched, jc.DeepEquals, meta)
+	c.Assert(patched, gc.Not(gc.Equals), meta)
+}
+
+var patchErrorTests = []struct {
+	about      string
+	patch      charm.MetaPatch
+	expectErr  string
+	expectCode string
+}{{
+	about: "existing relation",
+	patch: charm.MetaPatch{
+		Provides: map[string]charm.Relation{
+			"db": {Interface: "mysql"},
+		},
+	},
+	expectErr:  `charm "wordpress" already has a relation named "db"`,
+	expectCode: charm.CodeDuplicateName,
+}, {
+	about: "duplicate relation in patch",
+	patch: charm.MetaPatch{
+		Provides: map[string]charm.Relation{
+			"website": {Interface: "http"},
+		},
+		Peers: map[string]charm.Relation{
+			"website": {Interface: "http"},
+		},
+	},
+	expectErr:  `charm "wordpress" already has a relation named "website"`,
+	expectCode: charm.CodeDuplicateName,
+}, {
+	about: "reserved relation name",
+	patch: charm.MetaPatch{
+		Provides: map[string]charm.Relation{
+			"juju-foo": {Interface: "http"},
+		},
+	},
+	expectErr:  `charm "wordpress" using a reserved relation name: "juju-foo"`,
+	expectCode: charm.CodeReservedName,
+}}
+
+func (s *PatchSuite) TestPatchErrors(c *gc.C) {
+	for i, test := range patchErrorTests {
+		c.Logf("test %d: %s", i, test.about)
+		meta := readPatchMeta(c)
+		patched, err := meta.Patch(test.patch)
+		c.Check(err, gc.ErrorMatches, test.expectErr)
+		c.Check(charm.ErrorCode(err), gc.Equals, test.expectCode)
+		c.Check(patched, gc.IsNil)
+		c.Check(meta, jc.DeepEquals, readPatchMeta(c))
+	}
+}
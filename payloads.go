@@ -3,11 +3,7 @@
 
 package charm
 
-import (
-	"fmt"
-
-	"github.com/juju/schema"
-)
+import "github.com/juju/schema"
 
 var payloadClassSchema = schema.FieldMap(
 	schema.Fields{
@@ -20,10 +16,10 @@ var payloadClassSchema = schema.FieldMap(
 // in a charm's metadata.
 type PayloadClass struct {
 	// Name identifies the payload class.
-	Name string
+	Name string `json:"name"`
 
 	// Type identifies the type of payload (e.g. kvm, docker).
-	Type string
+	Type string `json:"type"`
 }
 
 func parsePayloadClasses(data interface{}) map[string]PayloadClass {
@@ -58,10 +54,10 @@ func parsePayloadClass(name string, data interface{}) PayloadClass {
 // Validate checks the payload class to ensure its data is valid.
 func (pc PayloadClass) Validate() error {
 	if pc.Name == "" {
-		return fmt.Errorf("payload class missing name")
+		return errorCodef(CodeInvalidPayloadClass, "payload class missing name")
 	}
 	if pc.Type == "" {
-		return fmt.Errorf("payload class missing type")
+		return errorCodef(CodeInvalidPayloadClass, "payload class missing type")
 	}
 	return nil
 }
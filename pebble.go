@@ -0,0 +1,201 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/juju/schema"
+	"gopkg.in/yaml.v1"
+)
+
+// PebbleLayersDir holds the directory, relative to the root of a
+// charm, holding the pebble layer files of a sidecar charm.
+const PebbleLayersDir = "layers"
+
+// validPebbleLayerFile matches the names of pebble layer files,
+// which are prefixed by their order, for instance "001-base.yaml".
+var validPebbleLayerFile = regexp.MustCompile(`^[0-9]{3}-[a-z](-?[a-z0-9])*\.yaml$`)
+
+// PebbleLayer holds a pebble layer, which declares the services
+// run in a workload container.
+type PebbleLayer struct {
+	Summary     string
+	Description string
+	Services    map[string]PebbleService
+}
+
+// PebbleService holds a service declared in a pebble layer.
+type PebbleService struct {
+	Override    string
+	Summary     string
+	Description string
+	Startup     string
+	Command     string
+	After       []string
+	Before      []string
+	Requires    []string
+	Environment map[string]string
+	User        string
+	UserID      *int
+	Group       string
+	GroupID     *int
+	WorkingDir  string
+	OnSuccess   string
+	OnFailure   string
+}
+
+var pebbleLayerSchema = schema.FieldMap(
+	schema.Fields{
+		"summary":     schema.String(),
+		"description": schema.String(),
+		"services":    schema.StringMap(pebbleServiceSchema),
+	},
+	schema.Defaults{
+		"summary":     schema.Omit,
+		"description": schema.Omit,
+		"services":    schema.Omit,
+	},
+)
+
+var pebbleActionSchema = schema.OneOf(
+	schema.Const("restart"),
+	schema.Const("shutdown"),
+	schema.Const("ignore"),
+)
+
+var pebbleServiceSchema = schema.FieldMap(
+	schema.Fields{
+		"override":    schema.OneOf(schema.Const("merge"), schema.Const("replace")),
+		"summary":     schema.String(),
+		"description": schema.String(),
+		"startup":     schema.OneOf(schema.Const("enabled"), schema.Const("disabled")),
+		"command":     schema.String(),
+		"after":       schema.List(schema.String()),
+		"before":      schema.List(schema.String()),
+		"requires":    schema.List(schema.String()),
+		"environment": schema.StringMap(schema.String()),
+		"user":        schema.String(),
+		"user-id":     schema.Int(),
+		"group":       schema.String(),
+		"group-id":    schema.Int(),
+		"working-dir": schema.String(),
+		"on-success":  pebbleActionSchema,
+		"on-failure":  pebbleActionSchema,
+	},
+	schema.Defaults{
+		"summary":     schema.Omit,
+		"description": schema.Omit,
+		"startup":     schema.Omit,
+		"command":     schema.Omit,
+		"after":       schema.Omit,
+		"before":      schema.Omit,
+		"requires":    schema.Omit,
+		"environment": schema.Omit,
+		"user":        schema.Omit,
+		"user-id":     schema.Omit,
+		"group":       schema.Omit,
+		"group-id":    schema.Omit,
+		"working-dir": schema.Omit,
+		"on-success":  schema.Omit,
+		"on-failure":  schema.Omit,
+	},
+)
+
+// IsValidPebbleLayerFile reports whether name is a valid
+// name for a pebble layer file, such as "001-base.yaml".
+func IsValidPebbleLayerFile(name string) bool {
+	return validPebbleLayerFile.MatchString(name)
+}
+
+// ReadPebbleLayer reads a pebble layer in YAML format
+// and checks that it is valid.
+func ReadPebbleLayer(r io.Reader) (*PebbleLayer, error) {
+	data, err := readDocument(r, "pebble layer", MaxDocumentSize)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, raw); err != nil {
+		return nil, withCode(CodeInvalidPebbleLayer, err)
+	}
+	v, err := pebbleLayerSchema.Coerce(raw, nil)
+	if err != nil {
+		return nil, errorCodef(CodeInvalidPebbleLayer, "pebble layer: %v", err)
+	}
+	m := v.(map[string]interface{})
+	layer := &PebbleLayer{}
+	layer.Summary, _ = m["summary"].(string)
+	layer.Description, _ = m["description"].(string)
+	if services, ok := m["services"].(map[string]interface{}); ok {
+		layer.Services = make(map[string]PebbleService)
+		for name, service := range services {
+			layer.Services[name] = parsePebbleService(service.(map[string]interface{}))
+		}
+	}
+	if err := layer.Check(); err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+func parsePebbleService(m map[string]interface{}) PebbleService {
+	service := PebbleService{
+		Override: m["override"].(string),
+		After:    parseStringList(m["after"]),
+		Before:   parseStringList(m["before"]),
+		Requires: parseStringList(m["requires"]),
+	}
+	service.Summary, _ = m["summary"].(string)
+	service.Description, _ = m["description"].(string)
+	service.Startup, _ = m["startup"].(string)
+	service.Command, _ = m["command"].(string)
+	service.User, _ = m["user"].(string)
+	service.Group, _ = m["group"].(string)
+	service.WorkingDir, _ = m["working-dir"].(string)
+	service.OnSuccess, _ = m["on-success"].(string)
+	service.OnFailure, _ = m["on-failure"].(string)
+	if env, ok := m["environment"].(map[string]interface{}); ok {
+		service.Environment = make(map[string]string)
+		for k, v := range env {
+			service.Environment[k] = v.(string)
+		}
+	}
+	if id, ok := m["user-id"].(int64); ok {
+		userID := int(id)
+		service.UserID = &userID
+	}
+	if id, ok := m["group-id"].(int64); ok {
+		groupID := int(id)
+		service.GroupID = &groupID
+	}
+	return service
+}
+
+// Check checks that the pebble layer is well-formed.
+func (layer *PebbleLayer) Check() error {
+	for name, service := range layer.Services {
+		if name == "" {
+			return errorCodef(CodeInvalidPebbleLayer, "pebble layer has service with empty name")
+		}
+		if service.Override == "replace" && service.Command == "" {
+			return errorCodef(CodeInvalidPebbleLayer, "pebble service %q: command must be specified when replacing", name)
+		}
+		for _, deps := range [][]string{service.After, service.Before, service.Requires} {
+			for _, dep := range deps {
+				if dep == name {
+					return errorCodef(CodeInvalidPebbleLayer, "pebble service %q depends on itself", name)
+				}
+			}
+		}
+		if service.UserID != nil && *service.UserID < 0 {
+			return errorCodef(CodeInvalidPebbleLayer, "pebble service %q: user-id %d is negative", name, *service.UserID)
+		}
+		if service.GroupID != nil && *service.GroupID < 0 {
+			return errorCodef(CodeInvalidPebbleLayer, "pebble service %q: group-id %d is negative", name, *service.GroupID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type PebbleSuite struct{}
+
+var _ = gc.Suite(&PebbleSuite{})
+
+const pebbleLayer = `
+summary: web layer
+services:
+  web:
+    override: replace
+    command: /bin/web --port 8080
+    startup: enabled
+    after: [db]
+    environment:
+      PORT: "8080"
+    user-id: 1000
+    on-failure: restart
+  db:
+    override: merge
+`
+
+func (s *PebbleSuite) TestReadPebbleLayer(c *gc.C) {
+	layer, err := charm.ReadPebbleLayer(strings.NewReader(pebbleLayer))
+	c.Assert(err, gc.IsNil)
+	userID := 1000
+	c.Assert(layer, jc.DeepEquals, &charm.PebbleLayer{
+		Summary: "web layer",
+		Services: map[string]charm.PebbleService{
+			"web": {
+				Override:    "replace",
+				Command:     "/bin/web --port 8080",
+				Startup:     "enabled",
+				After:       []string{"db"},
+				Environment: map[string]string{"PORT": "8080"},
+				UserID:      &userID,
+				OnFailure:   "restart",
+			},
+			"db": {
+				Override: "merge",
+			},
+		},
+	})
+}
+
+var pebbleLayerErrorTests = []struct {
+	about  string
+	layer  string
+	expect string
+}{{
+	about:  "invalid yaml",
+	layer:  "services: [",
+	expect: "YAML error: .*",
+}, {
+	about:  "missing override",
+	layer:  "services: {web: {command: /bin/web}}",
+	expect: `pebble layer: services.web.override: .*`,
+}, {
+	about:  "invalid startup",
+	layer:  "services: {web: {override: merge, startup: sometimes}}",
+	expect: `pebble layer: services.web.startup: .*`,
+}, {
+	about:  "replace without command",
+	layer:  "services: {web: {override: replace}}",
+	expect: `pebble service "web": command must be specified when replacing`,
+}, {
+	about:  "self dependency",
+	layer:  "services: {web: {override: merge, requires: [web]}}",
+	expect: `pebble service "web" depends on itself`,
+}, {
+	about:  "negative group id",
+	layer:  "services: {web: {override: merge, group-id: -1}}",
+	expect: `pebble service "web": group-id -1 is negative`,
+}}
+
+func (s *PebbleSuite) TestReadPebbleLayerErrors(c *gc.C) {
+	for i, test := range pebbleLayerErrorTests {
+		c.Logf("test %d: %s", i, test.about)
+		_, err := charm.ReadPebbleLayer(strings.NewReader(test.layer))
+		c.Check(err, gc.ErrorMatches, test.expect)
+		c.Check(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidPebbleLayer)
+	}
+}
+
+func (s *PebbleSuite) TestIsValidPebbleLayerFile(c *gc.C) {
+	c.Assert(charm.IsValidPebbleLayerFile("001-base.yaml"), jc.IsTrue)
+	c.Assert(charm.IsValidPebbleLayerFile("010-web-app.yaml"), jc.IsTrue)
+	c.Assert(charm.IsValidPebbleLayerFile("base.yaml"), jc.IsFalse)
+	c.Assert(charm.IsValidPebbleLayerFile("1-base.yaml"), jc.IsFalse)
+	c.Assert(charm.IsValidPebbleLayerFile("001-Base.yaml"), jc.IsFalse)
+	c.Assert(charm.IsValidPebbleLayerFile("001-base.yml"), jc.IsFalse)
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import "fmt"
+
+// PromulgationResolver provides the ownership data needed to translate
+// between the promulgated form of a charm URL (for instance
+// cs:trusty/wordpress) and the owner-specific form of the same URL (for
+// instance cs:~charmers/trusty/wordpress). It is usually implemented
+// by a charm store client.
+type PromulgationResolver interface {
+	// PromulgatedOwner returns the name of the user owning the
+	// charm that is currently promulgated under the given URL,
+	// which has no user set. It returns the empty string if no
+	// charm is promulgated under that name.
+	PromulgatedOwner(url *URL) (string, error)
+
+	// IsPromulgated reports whether the charm referred to by the
+	// given owner-specific URL is currently promulgated.
+	IsPromulgated(url *URL) (bool, error)
+}
+
+// OwnerURL returns the owner-specific form of the given promulgated
+// URL, using r to find out who owns it. If url already has a user, it
+// is returned unchanged.
+func OwnerURL(r PromulgationResolver, url *URL) (*URL, error) {
+	if url.User != "" {
+		return url, nil
+	}
+	owner, err := r.PromulgatedOwner(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find owner of %q: %v", url, err)
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("charm %q is not promulgated", url)
+	}
+	return url.WithOwner(owner), nil
+}
+
+// PromulgatedURL returns the promulgated form of the given
+// owner-specific URL, using r to check that the charm really is
+// promulgated. If url has no user, it is returned unchanged.
+func PromulgatedURL(r PromulgationResolver, url *URL) (*URL, error) {
+	if url.User == "" {
+		return url, nil
+	}
+	ok, err := r.IsPromulgated(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot check promulgation of %q: %v", url, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("charm %q is not promulgated", url)
+	}
+	return url.Promulgated(), nil
+}
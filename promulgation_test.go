@@ -0,0 +1,117 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type PromulgationSuite struct{}
+
+var _ = gc.Suite(&PromulgationSuite{})
+
+// fakePromulgationResolver implements charm.PromulgationResolver by looking up
+// promulgated charm names in a map from name to owner.
+type fakePromulgationResolver map[string]string
+
+func (r fakePromulgationResolver) PromulgatedOwner(url *charm.URL) (string, error) {
+	if url.Name == "broken" {
+		return "", fmt.Errorf("store unavailable")
+	}
+	return r[url.Name], nil
+}
+
+func (r fakePromulgationResolver) IsPromulgated(url *charm.URL) (bool, error) {
+	if url.Name == "broken" {
+		return false, fmt.Errorf("store unavailable")
+	}
+	return r[url.Name] == url.User, nil
+}
+
+var promulgationResolver = fakePromulgationResolver{
+	"wordpress": "charmers",
+	"mysql":     "mysql-team",
+}
+
+func (s *PromulgationSuite) TestWithOwner(c *gc.C) {
+	url := charm.MustParseURL("cs:trusty/wordpress-3")
+	other := url.WithOwner("who")
+	c.Assert(other, jc.DeepEquals, charm.MustParseURL("cs:~who/trusty/wordpress-3"))
+	// The original URL is not modified.
+	c.Assert(url, jc.DeepEquals, charm.MustParseURL("cs:trusty/wordpress-3"))
+	c.Assert(other.Promulgated(), jc.DeepEquals, url)
+	c.Assert(other.Promulgated(), gc.Not(gc.Equals), url)
+}
+
+var ownerURLTests = []struct {
+	url    string
+	expect string
+	err    string
+}{{
+	url:    "cs:trusty/wordpress-3",
+	expect: "cs:~charmers/trusty/wordpress-3",
+}, {
+	url:    "cs:precise/mysql",
+	expect: "cs:~mysql-team/precise/mysql",
+}, {
+	url:    "cs:~who/trusty/wordpress",
+	expect: "cs:~who/trusty/wordpress",
+}, {
+	url: "cs:trusty/django",
+	err: `charm "cs:trusty/django" is not promulgated`,
+}, {
+	url: "cs:trusty/broken",
+	err: `cannot find owner of "cs:trusty/broken": store unavailable`,
+}}
+
+func (s *PromulgationSuite) TestOwnerURL(c *gc.C) {
+	for i, test := range ownerURLTests {
+		c.Logf("test %d: %s", i, test.url)
+		url, err := charm.OwnerURL(promulgationResolver, charm.MustParseURL(test.url))
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(url, gc.IsNil)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(url.String(), gc.Equals, test.expect)
+	}
+}
+
+var promulgatedURLTests = []struct {
+	url    string
+	expect string
+	err    string
+}{{
+	url:    "cs:~charmers/trusty/wordpress-3",
+	expect: "cs:trusty/wordpress-3",
+}, {
+	url:    "cs:precise/mysql",
+	expect: "cs:precise/mysql",
+}, {
+	url: "cs:~who/trusty/wordpress",
+	err: `charm "cs:~who/trusty/wordpress" is not promulgated`,
+}, {
+	url: "cs:~who/trusty/broken",
+	err: `cannot check promulgation of "cs:~who/trusty/broken": store unavailable`,
+}}
+
+func (s *PromulgationSuite) TestPromulgatedURL(c *gc.C) {
+	for i, test := range promulgatedURLTests {
+		c.Logf("test %d: %s", i, test.url)
+		url, err := charm.PromulgatedURL(promulgationResolver, charm.MustParseURL(test.url))
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(url, gc.IsNil)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(url.String(), gc.Equals, test.expect)
+	}
+}
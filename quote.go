@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// MaxQuotedLen holds the maximum length of a name returned by QuoteV2.
+// It leaves room for a file extension within the 255 byte name limit
+// of common filesystems.
+const MaxQuotedLen = 200
+
+// quoteHashLen holds the number of hex digits of the SHA256 hash
+// appended to names that QuoteV2 has to truncate.
+const quoteHashLen = 32
+
+// QuoteV2 translates a charm url string into one which can be safely
+// used as a file name, in the same way as Quote.
+//
+// Unlike Quote, the result is never longer than MaxQuotedLen: longer
+// names are truncated and suffixed with "%~" and a hash of the original
+// string, which keeps them unique. Shorter names are the same as those
+// returned by Quote, so files named with Quote can still be found, and
+// they can be translated back with Unquote.
+func QuoteV2(unsafe string) string {
+	safe := Quote(unsafe)
+	if len(safe) <= MaxQuotedLen {
+		return safe
+	}
+	prefix := safe[:MaxQuotedLen-quoteHashLen-2]
+	// Do not leave a partial escape sequence at the end of the prefix.
+	if i := strings.LastIndex(prefix, "_"); i >= 0 && strings.Count(prefix, "_")%2 == 1 {
+		prefix = prefix[:i]
+	}
+	sum := sha256.Sum256([]byte(unsafe))
+	return prefix + "%~" + hex.EncodeToString(sum[:])[:quoteHashLen]
+}
+
+// Unquote reverses the translation made by Quote and QuoteV2. It
+// returns an error if the name is not a valid Quote result or if it
+// was truncated by QuoteV2, in which case the original string cannot
+// be recovered.
+func Unquote(quoted string) (string, error) {
+	if strings.Contains(quoted, "%~") {
+		return "", fmt.Errorf("cannot unquote %q: name was truncated", quoted)
+	}
+	unsafe := make([]byte, 0, len(quoted))
+	for i := 0; i < len(quoted); i++ {
+		b := quoted[i]
+		if b != '_' {
+			unsafe = append(unsafe, b)
+			continue
+		}
+		if i+3 >= len(quoted) || quoted[i+3] != '_' {
+			return "", fmt.Errorf("cannot unquote %q: truncated escape sequence", quoted)
+		}
+		v, ok := unhexByte(quoted[i+1], quoted[i+2])
+		if !ok {
+			return "", fmt.Errorf("cannot unquote %q: invalid escape sequence %q", quoted, quoted[i:i+4])
+		}
+		unsafe = append(unsafe, v)
+		i += 3
+	}
+	return string(unsafe), nil
+}
+
+func unhexByte(hi, lo byte) (byte, bool) {
+	h, ok := unhex(hi)
+	if !ok {
+		return 0, false
+	}
+	l, ok := unhex(lo)
+	if !ok {
+		return 0, false
+	}
+	return h<<4 | l, true
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
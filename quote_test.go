@@ -0,0 +1,63 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type QuoteV2Suite struct{}
+
+var _ = gc.Suite(&QuoteV2Suite{})
+
+var quoteV2Tests = []struct {
+	in  string
+	out string
+}{{
+	in:  "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-",
+	out: "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-",
+}, {
+	in:  "cs:~who/trusty/mysql-3",
+	out: "cs_3a__7e_who_2f_trusty_2f_mysql-3",
+}, {
+	in:  "hello_there%",
+	out: "hello_5f_there_25_",
+}}
+
+func (s *QuoteV2Suite) TestQuoteV2(c *gc.C) {
+	for i, test := range quoteV2Tests {
+		c.Logf("test %d: %q", i, test.in)
+		out := charm.QuoteV2(test.in)
+		c.Assert(out, gc.Equals, test.out)
+		c.Assert(charm.Quote(test.in), gc.Equals, out)
+		unquoted, err := charm.Unquote(out)
+		c.Assert(err, gc.IsNil)
+		c.Assert(unquoted, gc.Equals, test.in)
+	}
+}
+
+func (s *QuoteV2Suite) TestQuoteV2Long(c *gc.C) {
+	in1 := "cs:~who/trusty/" + strings.Repeat("/", 300) + "a"
+	in2 := "cs:~who/trusty/" + strings.Repeat("/", 300) + "b"
+	out1, out2 := charm.QuoteV2(in1), charm.QuoteV2(in2)
+	c.Assert(len(out1) <= charm.MaxQuotedLen, gc.Equals, true)
+	c.Assert(len(out2) <= charm.MaxQuotedLen, gc.Equals, true)
+	c.Assert(out1, gc.Not(gc.Equals), out2)
+	c.Assert(out1, gc.Matches, `cs_3a__7e_who_2f_trusty(_2f_)+%~[0-9a-f]{32}`)
+	c.Assert(charm.QuoteV2(in1), gc.Equals, out1)
+
+	_, err := charm.Unquote(out1)
+	c.Assert(err, gc.ErrorMatches, `cannot unquote ".*": name was truncated`)
+}
+
+func (s *QuoteV2Suite) TestUnquoteErrors(c *gc.C) {
+	_, err := charm.Unquote("cs_3a")
+	c.Assert(err, gc.ErrorMatches, `cannot unquote "cs_3a": truncated escape sequence`)
+	_, err = charm.Unquote("cs_zz_trusty")
+	c.Assert(err, gc.ErrorMatches, `cannot unquote "cs_zz_trusty": invalid escape sequence "_zz_"`)
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Resolver turns possibly incomplete charm references, as typed by
+// users, into fully resolved charm URLs. Any part of the URL that is
+// not specified in the reference is inferred from the Resolver's
+// fields, and each inference is reported to the caller.
+type Resolver struct {
+	// DefaultSchema holds the schema to use when the reference
+	// does not specify one. If it is empty, "cs" is used.
+	DefaultSchema string
+
+	// DefaultSeries holds the series to use when the reference
+	// does not specify one, usually the default series of the
+	// model the charm will be deployed to. If it is empty,
+	// references without a series cannot be resolved.
+	DefaultSeries string
+
+	// LatestRevision, if not nil, is used to find the revision
+	// of charms when the reference does not specify one.
+	// It is usually implemented in terms of charmrepo.Latest.
+	// If it is nil, the resolved URL will have no revision.
+	LatestRevision func(url *URL) (int, error)
+}
+
+// InferenceStep describes a part of a charm URL that was
+// inferred by a Resolver rather than specified by the reference.
+type InferenceStep struct {
+	// Field holds the inferred part of the URL: one of
+	// "schema", "series" or "revision".
+	Field string
+
+	// Value holds the inferred value.
+	Value string
+}
+
+// String returns a human readable description of the step.
+func (step InferenceStep) String() string {
+	return fmt.Sprintf("inferred %s %q", step.Field, step.Value)
+}
+
+// Resolve parses src as a charm reference, which may be in any of the
+// forms accepted by ParseReference, so charmhub.io URLs with a channel
+// are rejected as they are by ParseReference. It returns the charm URL it
+// refers to, along with the steps taken to infer any missing parts.
+func (r *Resolver) Resolve(src string) (*URL, []InferenceStep, error) {
+	var ref *Reference
+	var err error
+	if isCharmHubURL(src) {
+		ref, err = parseCharmHubReference(src)
+	} else {
+		ref, err = parseReference(src)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var steps []InferenceStep
+	if ref.Schema == "" {
+		ref.Schema = r.DefaultSchema
+		if ref.Schema == "" {
+			ref.Schema = "cs"
+		}
+		steps = append(steps, InferenceStep{"schema", ref.Schema})
+	}
+	series := ref.Series
+	url, err := ref.URL(r.DefaultSeries)
+	if err != nil {
+		return nil, nil, annotateCodef(CodeUnresolvedSeries, err, "cannot infer charm URL for %q: %v", src, err)
+	}
+	if series == "" {
+		steps = append(steps, InferenceStep{"series", url.Series})
+	}
+	if url.Revision == -1 && r.LatestRevision != nil {
+		rev, err := r.LatestRevision(url)
+		if err != nil {
+			return nil, nil, annotateCodef(CodeUnresolvedRevision, err, "cannot infer revision for %q: %v", url, err)
+		}
+		url = url.WithRevision(rev)
+		steps = append(steps, InferenceStep{"revision", strconv.Itoa(rev)})
+	}
+	return url, steps, nil
+}
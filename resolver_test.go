@@ -0,0 +1,143 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ResolverSuite struct{}
+
+var _ = gc.Suite(&ResolverSuite{})
+
+func latestRevision(url *charm.URL) (int, error) {
+	if url.Name == "missing" {
+		return 0, fmt.Errorf("charm not found")
+	}
+	return 42, nil
+}
+
+var resolveTests = []struct {
+	about    string
+	resolver charm.Resolver
+	src      string
+	expect   string
+	steps    []charm.InferenceStep
+	err      string
+}{{
+	about:  "fully specified",
+	src:    "cs:~who/trusty/wordpress-1",
+	expect: "cs:~who/trusty/wordpress-1",
+}, {
+	about: "default schema and series",
+	resolver: charm.Resolver{
+		DefaultSeries: "trusty",
+	},
+	src:    "wordpress",
+	expect: "cs:trusty/wordpress",
+	steps: []charm.InferenceStep{
+		{Field: "schema", Value: "cs"},
+		{Field: "series", Value: "trusty"},
+	},
+}, {
+	about: "configured schema",
+	resolver: charm.Resolver{
+		DefaultSchema: "local",
+	},
+	src:    "precise/wordpress-3",
+	expect: "local:precise/wordpress-3",
+	steps: []charm.InferenceStep{
+		{Field: "schema", Value: "local"},
+	},
+}, {
+	about: "revision from repository",
+	resolver: charm.Resolver{
+		DefaultSeries:  "trusty",
+		LatestRevision: latestRevision,
+	},
+	src:    "cs:wordpress",
+	expect: "cs:trusty/wordpress-42",
+	steps: []charm.InferenceStep{
+		{Field: "series", Value: "trusty"},
+		{Field: "revision", Value: "42"},
+	},
+}, {
+	about: "explicit revision is not looked up",
+	resolver: charm.Resolver{
+		LatestRevision: latestRevision,
+	},
+	src:    "cs:trusty/missing-2",
+	expect: "cs:trusty/missing-2",
+}, {
+	about: "revision lookup failure",
+	resolver: charm.Resolver{
+		LatestRevision: latestRevision,
+	},
+	src: "cs:trusty/missing",
+	err: `cannot infer revision for "cs:trusty/missing": charm not found`,
+}, {
+	about: "no default series",
+	src:   "cs:wordpress",
+	err:   `cannot infer charm URL for "cs:wordpress": charm url series is not resolved`,
+}, {
+	about: "invalid default series",
+	resolver: charm.Resolver{
+		DefaultSeries: "bad-series",
+	},
+	src: "cs:wordpress",
+	err: `cannot infer charm URL for "cs:wordpress": default series "bad-series" is invalid`,
+}, {
+	about: "invalid reference",
+	src:   "cs:~user/series/name-1-2",
+	err:   `charm URL has invalid charm name: "cs:~user/series/name-1-2"`,
+}, {
+	about: "charmhub URL",
+	resolver: charm.Resolver{
+		DefaultSeries: "trusty",
+	},
+	src:    "https://charmhub.io/wordpress",
+	expect: "ch:trusty/wordpress",
+	steps: []charm.InferenceStep{
+		{Field: "series", Value: "trusty"},
+	},
+}, {
+	about: "charmhub URL with channel",
+	resolver: charm.Resolver{
+		DefaultSeries: "trusty",
+	},
+	src: "https://charmhub.io/wordpress?channel=edge",
+	err: `charmhub URL with channel cannot be parsed as a reference: "https://charmhub.io/wordpress\?channel=edge"`,
+}}
+
+func (s *ResolverSuite) TestResolve(c *gc.C) {
+	for i, test := range resolveTests {
+		c.Logf("test %d: %s", i, test.about)
+		url, steps, err := test.resolver.Resolve(test.src)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(url, gc.IsNil)
+			c.Assert(steps, gc.IsNil)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(url.String(), gc.Equals, test.expect)
+		c.Assert(steps, jc.DeepEquals, test.steps)
+	}
+}
+
+func (s *ResolverSuite) TestResolveCharmHubChannelCode(c *gc.C) {
+	r := charm.Resolver{DefaultSeries: "trusty"}
+	_, _, err := r.Resolve("https://charmhub.io/wordpress?channel=edge")
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidChannel)
+}
+
+func (s *ResolverSuite) TestInferenceStepString(c *gc.C) {
+	step := charm.InferenceStep{Field: "series", Value: "trusty"}
+	c.Assert(step.String(), gc.Equals, `inferred series "trusty"`)
+}
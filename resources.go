@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import "github.com/juju/schema"
+
+// ResourceType identifies the kind of a charm resource.
+type ResourceType string
+
+const (
+	// ResourceTypeFile identifies resources that are
+	// provided to the charm as a file.
+	ResourceTypeFile ResourceType = "file"
+
+	// ResourceTypeContainerImage identifies resources that
+	// hold an OCI image, as used by containers.
+	ResourceTypeContainerImage ResourceType = "oci-image"
+)
+
+var resourceSchema = schema.FieldMap(
+	schema.Fields{
+		"type":        schema.OneOf(schema.Const(string(ResourceTypeFile)), schema.Const(string(ResourceTypeContainerImage))),
+		"filename":    schema.String(),
+		"description": schema.String(),
+	},
+	schema.Defaults{
+		"type":        string(ResourceTypeFile),
+		"filename":    schema.Omit,
+		"description": schema.Omit,
+	},
+)
+
+// Resource holds the information about a resource, as stored
+// in a charm's metadata.
+type Resource struct {
+	// Name identifies the resource.
+	Name string `bson:"name" json:"name"`
+
+	// Type identifies the kind of resource.
+	Type ResourceType `bson:"type" json:"type"`
+
+	// Filename holds the name of the file resource as seen
+	// by the charm. It is only used by file resources.
+	Filename string `bson:"filename,omitempty" json:"filename,omitempty"`
+
+	// Description holds an optional description of the resource.
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+}
+
+func parseResources(data interface{}) map[string]Resource {
+	if data == nil {
+		return nil
+	}
+	result := make(map[string]Resource)
+	for name, val := range data.(map[string]interface{}) {
+		rMap := val.(map[string]interface{})
+		resource := Resource{
+			Name: name,
+			Type: ResourceType(rMap["type"].(string)),
+		}
+		if filename, ok := rMap["filename"].(string); ok {
+			resource.Filename = filename
+		}
+		if desc, ok := rMap["description"].(string); ok {
+			resource.Description = desc
+		}
+		result[name] = resource
+	}
+	return result
+}
+
+// Validate checks the resource to ensure its data is valid.
+func (r Resource) Validate() error {
+	if r.Name == "" {
+		return errorCodef(CodeInvalidResource, "resource missing name")
+	}
+	switch r.Type {
+	case ResourceTypeFile:
+		if r.Filename == "" {
+			return errorCodef(CodeInvalidResource, "resource %q missing filename", r.Name)
+		}
+	case ResourceTypeContainerImage:
+		if r.Filename != "" {
+			return errorCodef(CodeInvalidResource, "resource %q of type %q may not specify a filename", r.Name, r.Type)
+		}
+	default:
+		return errorCodef(CodeInvalidResource, "resource %q has unknown type %q", r.Name, r.Type)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/juju/utils/set"
+)
+
+// SearchDocument holds a flat, normalized view of charm metadata,
+// suitable for feeding search indexes. All the slices are sorted
+// and hold no duplicates.
+type SearchDocument struct {
+	// Name holds the charm name.
+	Name string `json:"name"`
+
+	// Summary holds the charm summary, unchanged.
+	Summary string `json:"summary"`
+
+	// Terms holds the normalized terms of the summary.
+	Terms []string `json:"terms,omitempty"`
+
+	// Tags holds the charm tags and categories, lower-cased.
+	Tags []string `json:"tags,omitempty"`
+
+	// Provides holds the interfaces of the relations
+	// provided by the charm.
+	Provides []string `json:"provides,omitempty"`
+
+	// Requires holds the interfaces of the relations
+	// required by the charm.
+	Requires []string `json:"requires,omitempty"`
+
+	// Series holds the series declared by the charm.
+	Series []string `json:"series,omitempty"`
+
+	// Subordinate holds whether the charm is subordinate.
+	Subordinate bool `json:"subordinate,omitempty"`
+}
+
+// stopWords holds the terms that are not worth indexing.
+var stopWords = set.NewStrings(
+	"a", "an", "and", "are", "as", "at", "be", "by", "for", "from",
+	"in", "into", "is", "it", "its", "of", "on", "or", "that", "the",
+	"this", "to", "with",
+)
+
+// searchTerms returns the normalized terms of the given text:
+// lower-cased words split on anything other than letters and
+// digits, excluding stop words and single characters.
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := set.NewStrings()
+	for _, word := range words {
+		if len(word) > 1 && !stopWords.Contains(word) {
+			terms.Add(word)
+		}
+	}
+	return terms.SortedValues()
+}
+
+// relationInterfaces returns the interfaces of the given relations.
+func relationInterfaces(relations map[string]Relation) []string {
+	ifaces := set.NewStrings()
+	for _, rel := range relations {
+		ifaces.Add(rel.Interface)
+	}
+	return ifaces.SortedValues()
+}
+
+// nonEmpty returns nil if values is empty, and values otherwise.
+func nonEmpty(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// SearchDocument returns the search document of the charm.
+// Relations implemented by peers are not included.
+func (m *Meta) SearchDocument() SearchDocument {
+	tags := set.NewStrings()
+	for _, tag := range append(m.Tags, m.Categories...) {
+		tags.Add(strings.ToLower(tag))
+	}
+	series := set.NewStrings(m.supportedSeries()...)
+	return SearchDocument{
+		Name:        m.Name,
+		Summary:     m.Summary,
+		Terms:       nonEmpty(searchTerms(m.Summary)),
+		Tags:        nonEmpty(tags.SortedValues()),
+		Provides:    nonEmpty(relationInterfaces(m.Provides)),
+		Requires:    nonEmpty(relationInterfaces(m.Requires)),
+		Series:      nonEmpty(series.SortedValues()),
+		Subordinate: m.Subordinate,
+	}
+}
+
+// Keywords returns the sorted, unique keywords describing the charm:
+// its name and the parts of its name, the terms of its summary, its
+// tags and the interfaces of the relations it provides and requires.
+func (m *Meta) Keywords() []string {
+	doc := m.SearchDocument()
+	keywords := set.NewStrings(doc.Name)
+	for _, values := range [][]string{
+		searchTerms(doc.Name),
+		doc.Terms,
+		doc.Tags,
+		doc.Provides,
+		doc.Requires,
+	} {
+		for _, value := range values {
+			keywords.Add(value)
+		}
+	}
+	return keywords.SortedValues()
+}
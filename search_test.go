@@ -0,0 +1,77 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type SearchSuite struct{}
+
+var _ = gc.Suite(&SearchSuite{})
+
+const searchMeta = `
+name: mysql-server
+summary: "The MySQL database, with replication support!"
+description: A long description.
+tags: [Databases, databases, sql]
+categories: [Storage]
+series: [xenial, trusty]
+provides:
+    db: mysql
+    db-admin: mysql
+    monitoring: nrpe
+requires:
+    ha: hacluster
+peers:
+    cluster: mysql-ha
+`
+
+func (s *SearchSuite) TestSearchDocument(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(searchMeta))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(meta.SearchDocument(), jc.DeepEquals, charm.SearchDocument{
+		Name:     "mysql-server",
+		Summary:  "The MySQL database, with replication support!",
+		Terms:    []string{"database", "mysql", "replication", "support"},
+		Tags:     []string{"databases", "sql", "storage"},
+		Provides: []string{"mysql", "nrpe"},
+		Requires: []string{"hacluster"},
+		Series:   []string{"trusty", "xenial"},
+	})
+}
+
+func (s *SearchSuite) TestSearchDocumentMinimal(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader("name: dummy\nsummary: x\ndescription: x\nsubordinate: true\nrequires:\n  juju-info:\n    interface: juju-info\n    scope: container\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(meta.SearchDocument(), jc.DeepEquals, charm.SearchDocument{
+		Name:        "dummy",
+		Summary:     "x",
+		Requires:    []string{"juju-info"},
+		Subordinate: true,
+	})
+}
+
+func (s *SearchSuite) TestKeywords(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(searchMeta))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(meta.Keywords(), jc.DeepEquals, []string{
+		"database",
+		"databases",
+		"hacluster",
+		"mysql",
+		"mysql-server",
+		"nrpe",
+		"replication",
+		"server",
+		"sql",
+		"storage",
+		"support",
+	})
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+)
+
+// maxSecretScanLineLength holds the length of the longest line
+// scanned for secrets. The rest of a file with a longer line, such
+// as minified code, is not scanned.
+const maxSecretScanLineLength = 1024 * 1024
+
+// SecretDetector detects a kind of credential
+// embedded in the contents of a charm.
+type SecretDetector interface {
+	// DetectSecret reports whether the given line, without
+	// its line terminator, holds a credential, and if so
+	// returns a description of it.
+	DetectSecret(line []byte) (description string, found bool)
+}
+
+// NewRegexpSecretDetector returns a SecretDetector that reports
+// lines matching the given pattern, using the given description.
+func NewRegexpSecretDetector(description string, pattern *regexp.Regexp) SecretDetector {
+	return &regexpSecretDetector{
+		description: description,
+		pattern:     pattern,
+	}
+}
+
+type regexpSecretDetector struct {
+	description string
+	pattern     *regexp.Regexp
+}
+
+// DetectSecret implements SecretDetector.DetectSecret.
+func (d *regexpSecretDetector) DetectSecret(line []byte) (string, bool) {
+	return d.description, d.pattern.Match(line)
+}
+
+// DefaultSecretDetectors holds the detectors used by ScanSecrets and
+// ValidateSecrets when none are given. They detect AWS credentials
+// and PEM-encoded private keys, which are obvious enough to be found
+// without too many false positives.
+var DefaultSecretDetectors = []SecretDetector{
+	NewRegexpSecretDetector("AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)),
+	NewRegexpSecretDetector("AWS secret access key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+]{40}\b`)),
+	NewRegexpSecretDetector("private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )*PRIVATE KEY( BLOCK)?-----`)),
+}
+
+// SecretFinding describes a credential found in a charm.
+type SecretFinding struct {
+	// Path holds the slash-separated path of the file holding
+	// the credential, relative to the root of the charm.
+	Path string
+
+	// Line holds the number of the line holding
+	// the credential, starting at 1.
+	Line int
+
+	// Description describes the kind of credential found,
+	// as returned by the detector that found it.
+	Description string
+}
+
+// String returns a description of the finding in the
+// conventional file:line: message form.
+func (f SecretFinding) String() string {
+	return fmt.Sprintf("%s:%d: possible %s", f.Path, f.Line, f.Description)
+}
+
+// ScanSecrets scans the files in fsys, such as returned by the FS
+// methods of CharmDir and CharmArchive, for embedded credentials,
+// using the given detectors, or DefaultSecretDetectors if there are
+// none. Files that appear to be binary are not scanned, nor are
+// top-level hidden files and directories and the build directory, which
+// are not archived. The findings are returned sorted by path and line.
+func ScanSecrets(fsys fs.FS, detectors []SecretDetector) ([]SecretFinding, error) {
+	if len(detectors) == 0 {
+		detectors = DefaultSecretDetectors
+	}
+	var findings []SecretFinding
+	err := walkCharmFiles(fsys, func(p string, d fs.DirEntry) error {
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fileFindings, err := scanSecrets(p, f, detectors)
+		if err != nil {
+			return fmt.Errorf("cannot scan %q: %v", p, err)
+		}
+		findings = append(findings, fileFindings...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(secretFindings(findings))
+	return findings, nil
+}
+
+// scanSecrets returns the credentials found by the
+// detectors in the file at path p, read from r.
+func scanSecrets(p string, r io.Reader, detectors []SecretDetector) ([]SecretFinding, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		// Binary file.
+		return nil, nil
+	}
+	var findings []SecretFinding
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(nil, maxSecretScanLineLength)
+	for line := 1; scanner.Scan(); line++ {
+		for _, d := range detectors {
+			if desc, ok := d.DetectSecret(scanner.Bytes()); ok {
+				findings = append(findings, SecretFinding{
+					Path:        p,
+					Line:        line,
+					Description: desc,
+				})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// ValidateSecrets scans the contents of ch for embedded credentials
+// with ScanSecrets, and returns a *ValidationError holding a problem
+// with code CodeEmbeddedSecret for each one found. It is not part of
+// Validate because scanning reads every file in the charm; stores can
+// call it when charms are uploaded. Only the contents of a *CharmDir
+// or *CharmArchive can be scanned; other charms are accepted.
+func ValidateSecrets(ch Charm, detectors []SecretDetector) error {
+	var fsys fs.FS
+	switch ch := ch.(type) {
+	case *CharmDir:
+		fsys = ch.FS()
+	case *CharmArchive:
+		fsys = ch.FS()
+	default:
+		return nil
+	}
+	findings, err := ScanSecrets(fsys, detectors)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	problems := make([]ValidationProblem, len(findings))
+	for i, f := range findings {
+		problems[i] = ValidationProblem{
+			Code:    CodeEmbeddedSecret,
+			Message: f.String(),
+		}
+	}
+	return &ValidationError{
+		Problems: problems,
+	}
+}
+
+type secretFindings []SecretFinding
+
+func (findings secretFindings) Len() int { return len(findings) }
+func (findings secretFindings) Swap(i, j int) {
+	findings[i], findings[j] = findings[j], findings[i]
+}
+func (findings secretFindings) Less(i, j int) bool {
+	if findings[i].Path != findings[j].Path {
+		return findings[i].Path < findings[j].Path
+	}
+	return findings[i].Line < findings[j].Line
+}
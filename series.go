@@ -0,0 +1,133 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KubernetesSeries holds the series used by charms that are
+// deployed to Kubernetes. It may not be mixed with other
+// series in a charm's metadata.
+const KubernetesSeries = "kubernetes"
+
+// UnsupportedSeriesError is returned when none of the
+// requested series is supported by a charm.
+type UnsupportedSeriesError struct {
+	// Charm holds the name of the charm.
+	Charm string
+
+	// Requested holds the requested series.
+	Requested []string
+
+	// Supported holds the series supported by the charm. It
+	// is empty if the charm does not declare any series.
+	Supported []string
+}
+
+func (err *UnsupportedSeriesError) Error() string {
+	msg := fmt.Sprintf("charm %q does not support series %s", err.Charm, strings.Join(err.Requested, ", "))
+	if len(err.Supported) > 0 {
+		msg += "; supported series are: " + strings.Join(err.Supported, ", ")
+	}
+	return msg
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (err *UnsupportedSeriesError) ErrorCode() string {
+	return CodeUnsupportedSeries
+}
+
+// supportedSeries returns the series declared by the charm. Metadata
+// created without SupportedSeries falls back to Series.
+func (m *Meta) supportedSeries() []string {
+	if len(m.SupportedSeries) > 0 || m.Series == "" {
+		return m.SupportedSeries
+	}
+	return []string{m.Series}
+}
+
+// SupportsSeries reports whether the charm may be deployed to the
+// given series. A charm that declares no series in its metadata
+// supports any series other than KubernetesSeries, which must be
+// declared explicitly.
+func (m *Meta) SupportsSeries(series string) bool {
+	supported := m.supportedSeries()
+	if len(supported) == 0 {
+		return series != KubernetesSeries
+	}
+	for _, s := range supported {
+		if s == series {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSeries returns an *UnsupportedSeriesError if the charm
+// does not support the given series.
+func (m *Meta) CheckSeries(series string) error {
+	if m.SupportsSeries(series) {
+		return nil
+	}
+	return m.unsupportedSeries([]string{series})
+}
+
+// CheckURLSeries returns an *UnsupportedSeriesError if the charm does
+// not support the series of the given URL. It returns an error with
+// the CodeUnresolvedSeries code if the URL has no series.
+func (m *Meta) CheckURLSeries(url *URL) error {
+	if url.Series == "" {
+		return errorCodef(CodeUnresolvedSeries, "charm URL %q has no series", url)
+	}
+	return m.CheckSeries(url.Series)
+}
+
+// SelectSeries returns the first of the preferred series that is
+// supported by the charm. If no preference is given, the first series
+// declared in the charm's metadata is returned. It returns an
+// *UnsupportedSeriesError if none of the preferred series is supported.
+func (m *Meta) SelectSeries(preferred ...string) (string, error) {
+	if len(preferred) == 0 {
+		supported := m.supportedSeries()
+		if len(supported) == 0 {
+			return "", errorCodef(CodeUnresolvedSeries, "charm %q does not declare a series and none was requested", m.Name)
+		}
+		return supported[0], nil
+	}
+	for _, series := range preferred {
+		if m.SupportsSeries(series) {
+			return series, nil
+		}
+	}
+	return "", m.unsupportedSeries(preferred)
+}
+
+func (m *Meta) unsupportedSeries(requested []string) error {
+	return &UnsupportedSeriesError{
+		Charm:     m.Name,
+		Requested: requested,
+		Supported: m.supportedSeries(),
+	}
+}
+
+// checkSupportedSeries checks the validity of the series
+// declared in the charm's metadata.
+func (m *Meta) checkSupportedSeries() error {
+	seen := make(map[string]bool)
+	for _, series := range m.SupportedSeries {
+		if !IsValidSeries(series) {
+			return errorCodef(CodeInvalidSeries, "charm %q declares invalid series: %q", m.Name, series)
+		}
+		if seen[series] {
+			return errorCodef(CodeInvalidSeries, "charm %q declares series %q more than once", m.Name, series)
+		}
+		seen[series] = true
+	}
+	if seen[KubernetesSeries] && len(seen) > 1 {
+		return errorCodef(CodeInvalidSeries, "charm %q cannot mix series %q with other series", m.Name, KubernetesSeries)
+	}
+	return checkSeriesOS(m.Name, m.SupportedSeries)
+}
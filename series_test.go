@@ -0,0 +1,200 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type SeriesSuite struct{}
+
+var _ = gc.Suite(&SeriesSuite{})
+
+func readSeriesMeta(c *gc.C, series string) *charm.Meta {
+	text := dummyMetadata
+	if series != "" {
+		text += "\nseries: " + series + "\n"
+	}
+	meta, err := charm.ReadMeta(strings.NewReader(text))
+	c.Assert(err, gc.IsNil)
+	return meta
+}
+
+func (s *SeriesSuite) TestReadSupportedSeries(c *gc.C) {
+	meta := readSeriesMeta(c, "")
+	c.Assert(meta.SupportedSeries, gc.HasLen, 0)
+
+	meta = readSeriesMeta(c, "trusty")
+	c.Assert(meta.SupportedSeries, jc.DeepEquals, []string{"trusty"})
+
+	meta = readSeriesMeta(c, "[focal, jammy]")
+	c.Assert(meta.Series, gc.Equals, "focal")
+	c.Assert(meta.SupportedSeries, jc.DeepEquals, []string{"focal", "jammy"})
+}
+
+var invalidSupportedSeriesTests = []struct {
+	series string
+	expect string
+}{{
+	series: "[focal, bad-series]",
+	expect: `charm "a" declares invalid series: "bad-series"`,
+}, {
+	series: "[focal, jammy, focal]",
+	expect: `charm "a" declares series "focal" more than once`,
+}, {
+	series: "[kubernetes, focal]",
+	expect: `charm "a" cannot mix series "kubernetes" with other series`,
+}}
+
+func (s *SeriesSuite) TestInvalidSupportedSeries(c *gc.C) {
+	for i, test := range invalidSupportedSeriesTests {
+		c.Logf("test %d: %s", i, test.series)
+		_, err := charm.ReadMeta(strings.NewReader(
+			fmt.Sprintf("%s\nseries: %s\n", dummyMetadata, test.series)))
+		c.Check(err, gc.ErrorMatches, test.expect)
+		c.Check(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidSeries)
+	}
+}
+
+var supportsSeriesTests = []struct {
+	about    string
+	declared string
+	series   string
+	expect   bool
+}{{
+	about:    "no series declared",
+	declared: "",
+	series:   "trusty",
+	expect:   true,
+}, {
+	about:    "no series declared, kubernetes requested",
+	declared: "",
+	series:   "kubernetes",
+	expect:   false,
+}, {
+	about:    "series declared",
+	declared: "[focal, jammy]",
+	series:   "jammy",
+	expect:   true,
+}, {
+	about:    "series not declared",
+	declared: "[focal, jammy]",
+	series:   "trusty",
+	expect:   false,
+}, {
+	about:    "kubernetes charm",
+	declared: "[kubernetes]",
+	series:   "kubernetes",
+	expect:   true,
+}, {
+	about:    "kubernetes charm, machine series requested",
+	declared: "kubernetes",
+	series:   "focal",
+	expect:   false,
+}}
+
+func (s *SeriesSuite) TestSupportsSeries(c *gc.C) {
+	for i, test := range supportsSeriesTests {
+		c.Logf("test %d: %s", i, test.about)
+		meta := readSeriesMeta(c, test.declared)
+		c.Check(meta.SupportsSeries(test.series), gc.Equals, test.expect)
+		err := meta.CheckSeries(test.series)
+		if test.expect {
+			c.Check(err, gc.IsNil)
+		} else {
+			c.Check(err, gc.FitsTypeOf, &charm.UnsupportedSeriesError{})
+			c.Check(charm.ErrorCode(err), gc.Equals, charm.CodeUnsupportedSeries)
+		}
+	}
+}
+
+func (s *SeriesSuite) TestSupportsSeriesWithoutSupportedSeries(c *gc.C) {
+	meta := &charm.Meta{Name: "a", Series: "trusty"}
+	c.Assert(meta.SupportsSeries("trusty"), jc.IsTrue)
+	c.Assert(meta.SupportsSeries("precise"), jc.IsFalse)
+}
+
+func (s *SeriesSuite) TestCheckURLSeries(c *gc.C) {
+	meta := readSeriesMeta(c, "[focal, jammy]")
+	err := meta.CheckURLSeries(charm.MustParseURL("cs:jammy/a"))
+	c.Assert(err, gc.IsNil)
+	err = meta.CheckURLSeries(charm.MustParseURL("cs:trusty/a"))
+	c.Assert(err, gc.ErrorMatches, `charm "a" does not support series trusty; supported series are: focal, jammy`)
+	err = meta.CheckURLSeries(&charm.URL{Schema: "cs", Name: "a", Revision: -1})
+	c.Assert(err, gc.ErrorMatches, `charm URL "cs:a" has no series`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeUnresolvedSeries)
+}
+
+var selectSeriesTests = []struct {
+	about     string
+	declared  string
+	preferred []string
+	expect    string
+	expectErr string
+}{{
+	about:    "default series",
+	declared: "[focal, jammy]",
+	expect:   "focal",
+}, {
+	about:     "first supported preference",
+	declared:  "[focal, jammy]",
+	preferred: []string{"trusty", "jammy", "focal"},
+	expect:    "jammy",
+}, {
+	about:     "no supported preference",
+	declared:  "[focal, jammy]",
+	preferred: []string{"trusty", "xenial"},
+	expectErr: `charm "a" does not support series trusty, xenial; supported series are: focal, jammy`,
+}, {
+	about:     "no series declared",
+	preferred: []string{"trusty"},
+	expect:    "trusty",
+}, {
+	about:     "no series declared or preferred",
+	expectErr: `charm "a" does not declare a series and none was requested`,
+}, {
+	about:     "kubernetes must be declared",
+	preferred: []string{"kubernetes"},
+	expectErr: `charm "a" does not support series kubernetes`,
+}, {
+	about:     "kubernetes charm",
+	declared:  "kubernetes",
+	preferred: []string{"focal", "kubernetes"},
+	expect:    "kubernetes",
+}}
+
+func (s *SeriesSuite) TestSelectSeries(c *gc.C) {
+	for i, test := range selectSeriesTests {
+		c.Logf("test %d: %s", i, test.about)
+		meta := readSeriesMeta(c, test.declared)
+		series, err := meta.SelectSeries(test.preferred...)
+		if test.expectErr != "" {
+			c.Check(err, gc.ErrorMatches, test.expectErr)
+			c.Check(series, gc.Equals, "")
+			continue
+		}
+		c.Check(err, gc.IsNil)
+		c.Check(series, gc.Equals, test.expect)
+	}
+}
+
+func (s *SeriesSuite) TestMarshalSupportedSeries(c *gc.C) {
+	for _, series := range []string{"", "trusty", "[focal, jammy]"} {
+		c.Logf("series %q", series)
+		meta := readSeriesMeta(c, series)
+		data, err := yaml.Marshal(meta)
+		c.Assert(err, gc.IsNil)
+		got, err := charm.ReadMeta(strings.NewReader(string(data)))
+		c.Assert(err, gc.IsNil)
+		c.Assert(got.Series, gc.Equals, meta.Series)
+		c.Assert(got.SupportedSeries, jc.DeepEquals, meta.SupportedSeries)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SeriesInfo holds information about a series from the series
+// catalogue.
+type SeriesInfo struct {
+	// Series holds the name of the series, such as "focal".
+	Series string
+
+	// OS holds the operating system of the series.
+	OS OSType
+
+	// Version holds the release version of the series, such
+	// as "20.04". It is empty if the series has no version.
+	Version string
+
+	// LTS holds whether the series is a long term
+	// support release.
+	LTS bool
+
+	// EOL holds the date at which the series reaches its end
+	// of life. It is the zero time if the date is not known.
+	EOL time.Time
+}
+
+// IsEOL reports whether the series has reached its end
+// of life at the given time.
+func (info SeriesInfo) IsEOL(now time.Time) bool {
+	return !info.EOL.IsZero() && !now.Before(info.EOL)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// seriesEOL holds the end of life dates of the standard support
+// of the series in the catalogue.
+var seriesEOL = map[string]time.Time{
+	"precise":  date(2017, time.April, 28),
+	"quantal":  date(2014, time.May, 16),
+	"raring":   date(2014, time.January, 27),
+	"saucy":    date(2014, time.July, 17),
+	"trusty":   date(2019, time.April, 30),
+	"utopic":   date(2015, time.July, 23),
+	"vivid":    date(2016, time.February, 4),
+	"wily":     date(2016, time.July, 28),
+	"xenial":   date(2021, time.April, 30),
+	"yakkety":  date(2017, time.July, 20),
+	"zesty":    date(2018, time.January, 13),
+	"artful":   date(2018, time.July, 19),
+	"bionic":   date(2023, time.May, 31),
+	"cosmic":   date(2019, time.July, 18),
+	"disco":    date(2020, time.January, 23),
+	"eoan":     date(2020, time.July, 17),
+	"focal":    date(2025, time.May, 29),
+	"groovy":   date(2021, time.July, 22),
+	"hirsute":  date(2022, time.January, 20),
+	"impish":   date(2022, time.July, 14),
+	"jammy":    date(2027, time.June, 1),
+	"kinetic":  date(2023, time.July, 20),
+	"lunar":    date(2024, time.January, 25),
+	"mantic":   date(2024, time.July, 11),
+	"noble":    date(2029, time.May, 31),
+	"oracular": date(2025, time.July, 10),
+	"plucky":   date(2026, time.January, 15),
+	"centos7":  date(2024, time.June, 30),
+	"centos8":  date(2021, time.December, 31),
+	"centos9":  date(2027, time.May, 31),
+}
+
+var (
+	seriesEOLMutex     sync.RWMutex
+	seriesEOLOverrides = make(map[string]time.Time)
+)
+
+// SetSeriesEOL overrides the end of life date of the given series
+// in the catalogue. If eol is the zero time, the series is treated
+// as having no known end of life. It returns a function that
+// restores the previous date.
+func SetSeriesEOL(series string, eol time.Time) (restore func()) {
+	seriesEOLMutex.Lock()
+	defer seriesEOLMutex.Unlock()
+	old, overridden := seriesEOLOverrides[series]
+	seriesEOLOverrides[series] = eol
+	return func() {
+		seriesEOLMutex.Lock()
+		defer seriesEOLMutex.Unlock()
+		if overridden {
+			seriesEOLOverrides[series] = old
+		} else {
+			delete(seriesEOLOverrides, series)
+		}
+	}
+}
+
+func eolOf(series string) time.Time {
+	seriesEOLMutex.RLock()
+	defer seriesEOLMutex.RUnlock()
+	if eol, ok := seriesEOLOverrides[series]; ok {
+		return eol
+	}
+	return seriesEOL[series]
+}
+
+// LookupSeries returns the catalogue information about the given
+// series. It returns an error with the CodeUnknownSeries code if
+// the series is not known.
+func LookupSeries(series string) (SeriesInfo, error) {
+	os, err := SeriesOS(series)
+	if err != nil {
+		return SeriesInfo{}, err
+	}
+	info := SeriesInfo{
+		Series: series,
+		OS:     os,
+		EOL:    eolOf(series),
+	}
+	switch os {
+	case Ubuntu:
+		for version, s := range ubuntuSeries {
+			if s == series {
+				info.Version = version
+				break
+			}
+		}
+		// Long term support releases are made every
+		// two years, in April of even years.
+		info.LTS = len(info.Version) == 5 && strings.HasSuffix(info.Version, ".04") && (info.Version[1]-'0')%2 == 0
+	case CentOS:
+		info.Version = strings.TrimPrefix(series, "centos")
+	}
+	return info, nil
+}
+
+// SeriesVersion returns the release version of the given series,
+// such as "20.04" for "focal". It returns an error with the
+// CodeUnknownSeries code if the series is not known or has no
+// version.
+func SeriesVersion(series string) (string, error) {
+	info, err := LookupSeries(series)
+	if err != nil {
+		return "", err
+	}
+	if info.Version == "" {
+		return "", errorCodef(CodeUnknownSeries, "series %q has no version", series)
+	}
+	return info.Version, nil
+}
+
+// AllSeries returns the catalogue information about all
+// known series, ordered by series name.
+func AllSeries() []SeriesInfo {
+	var names []string
+	for _, s := range ubuntuSeries {
+		names = append(names, s)
+	}
+	for s := range otherSeriesOS {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	infos := make([]SeriesInfo, len(names))
+	for i, name := range names {
+		infos[i], _ = LookupSeries(name)
+	}
+	return infos
+}
+
+// eolSeries returns those of the given series that have
+// reached their end of life at the given time.
+func eolSeries(series []string, now time.Time) []string {
+	var eol []string
+	for _, s := range series {
+		info, err := LookupSeries(s)
+		if err == nil && info.IsEOL(now) {
+			eol = append(eol, s)
+		}
+	}
+	return eol
+}
+
+// EOLWarnings returns a warning about the charm if all the series it
+// supports have reached their end of life at the given time. Unlike
+// other warnings, these depend on the time, so they are not reported
+// when the metadata is read.
+func (m *Meta) EOLWarnings(now time.Time) []Warning {
+	series := m.supportedSeries()
+	if len(series) == 0 {
+		return nil
+	}
+	eol := eolSeries(series, now)
+	if len(eol) < len(series) {
+		return nil
+	}
+	return []Warning{warningf(CodeEOLSeries, "charm %q only supports end-of-life series: %s", m.Name, strings.Join(eol, ", "))}
+}
+
+// EOLWarnings returns warnings about the series used by the bundle
+// that have reached their end of life at the given time, either as
+// the default series or in the charm URLs of its services.
+func (bd *BundleData) EOLWarnings(now time.Time) []Warning {
+	var warnings []Warning
+	if len(eolSeries([]string{bd.Series}, now)) > 0 {
+		warnings = append(warnings, warningf(CodeEOLSeries, "bundle default series %q is end-of-life", bd.Series))
+	}
+	for name, svc := range bd.Services {
+		ref, err := ParseReference(svc.Charm)
+		if err != nil || ref.Series == "" {
+			continue
+		}
+		if len(eolSeries([]string{ref.Series}, now)) > 0 {
+			warnings = append(warnings, warningf(CodeEOLSeries, "service %q uses charm %q with end-of-life series %q", name, svc.Charm, ref.Series))
+		}
+	}
+	sortWarnings(warnings)
+	return warnings
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type SeriesInfoSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&SeriesInfoSuite{})
+
+// eolTestTime holds the time at which end of life is checked.
+var eolTestTime = time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func (s *SeriesInfoSuite) TestLookupSeries(c *gc.C) {
+	info, err := charm.LookupSeries("focal")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info, jc.DeepEquals, charm.SeriesInfo{
+		Series:  "focal",
+		OS:      charm.Ubuntu,
+		Version: "20.04",
+		LTS:     true,
+		EOL:     time.Date(2025, time.May, 29, 0, 0, 0, 0, time.UTC),
+	})
+
+	info, err = charm.LookupSeries("trusty")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.LTS, gc.Equals, true)
+
+	info, err = charm.LookupSeries("groovy")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Version, gc.Equals, "20.10")
+	c.Assert(info.LTS, gc.Equals, false)
+
+	info, err = charm.LookupSeries("noble")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Version, gc.Equals, "24.04")
+	c.Assert(info.LTS, gc.Equals, true)
+
+	info, err = charm.LookupSeries("centos7")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Version, gc.Equals, "7")
+
+	info, err = charm.LookupSeries("win2012r2")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Version, gc.Equals, "")
+	c.Assert(info.EOL.IsZero(), gc.Equals, true)
+
+	_, err = charm.LookupSeries("plan9")
+	c.Assert(err, gc.ErrorMatches, `unknown series "plan9"`)
+}
+
+func (s *SeriesInfoSuite) TestSeriesVersion(c *gc.C) {
+	version, err := charm.SeriesVersion("focal")
+	c.Assert(err, gc.IsNil)
+	c.Assert(version, gc.Equals, "20.04")
+
+	_, err = charm.SeriesVersion("kubernetes")
+	c.Assert(err, gc.ErrorMatches, `series "kubernetes" has no version`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeUnknownSeries)
+}
+
+func (s *SeriesInfoSuite) TestAllSeries(c *gc.C) {
+	all := charm.AllSeries()
+	c.Assert(len(all) > 20, gc.Equals, true)
+	for i := 1; i < len(all); i++ {
+		c.Assert(all[i-1].Series < all[i].Series, gc.Equals, true)
+	}
+}
+
+func (s *SeriesInfoSuite) TestIsEOL(c *gc.C) {
+	info := charm.SeriesInfo{EOL: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	c.Assert(info.IsEOL(time.Date(2019, time.December, 31, 0, 0, 0, 0, time.UTC)), gc.Equals, false)
+	c.Assert(info.IsEOL(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)), gc.Equals, true)
+	c.Assert(charm.SeriesInfo{}.IsEOL(time.Now()), gc.Equals, false)
+}
+
+func (s *SeriesInfoSuite) TestSetSeriesEOL(c *gc.C) {
+	eol := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	restore := charm.SetSeriesEOL("trusty", eol)
+	info, err := charm.LookupSeries("trusty")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.EOL, gc.DeepEquals, eol)
+
+	restore2 := charm.SetSeriesEOL("trusty", time.Time{})
+	info, err = charm.LookupSeries("trusty")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.EOL.IsZero(), gc.Equals, true)
+
+	restore2()
+	info, err = charm.LookupSeries("trusty")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.EOL, gc.DeepEquals, eol)
+
+	restore()
+	info, err = charm.LookupSeries("trusty")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.EOL, gc.DeepEquals, time.Date(2019, time.April, 30, 0, 0, 0, 0, time.UTC))
+}
+
+func (s *SeriesInfoSuite) TestMetaEOLWarning(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nseries: [precise, trusty]\n"))
+	c.Assert(err, gc.IsNil)
+	// The warnings depend on the time, so are not
+	// reported when the metadata is read.
+	c.Assert(meta.Warnings, gc.HasLen, 0)
+	c.Assert(meta.EOLWarnings(eolTestTime), jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeEOLSeries,
+		Message: `charm "a" only supports end-of-life series: precise, trusty`,
+	}})
+	c.Assert(meta.EOLWarnings(time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC)), gc.HasLen, 0)
+
+	meta, err = charm.ReadMeta(strings.NewReader(dummyMetadata + "\nseries: [trusty, focal]\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.EOLWarnings(eolTestTime), gc.HasLen, 0)
+}
+
+func (s *SeriesInfoSuite) TestBundleEOLWarnings(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+series: precise
+services:
+    wordpress:
+        charm: cs:trusty/wordpress-1
+    mysql:
+        charm: cs:focal/mysql-2
+    haproxy:
+        charm: haproxy
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd.EOLWarnings(eolTestTime), jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeEOLSeries,
+		Message: `bundle default series "precise" is end-of-life`,
+	}, {
+		Code:    charm.CodeEOLSeries,
+		Message: `service "wordpress" uses charm "cs:trusty/wordpress-1" with end-of-life series "trusty"`,
+	}})
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sort"
+)
+
+// OSType identifies the kind of operating system a series belongs to.
+type OSType string
+
+const (
+	UnknownOS    OSType = "unknown"
+	Ubuntu       OSType = "ubuntu"
+	CentOS       OSType = "centos"
+	OpenSUSE     OSType = "opensuse"
+	Windows      OSType = "windows"
+	Kubernetes   OSType = "kubernetes"
+	GenericLinux OSType = "genericlinux"
+)
+
+// IsLinux reports whether the operating system is a Linux
+// distribution, including GenericLinux.
+func (os OSType) IsLinux() bool {
+	switch os {
+	case Ubuntu, CentOS, OpenSUSE, GenericLinux:
+		return true
+	}
+	return false
+}
+
+// otherSeriesOS maps the known series of operating systems
+// other than Ubuntu, whose series are held in ubuntuSeries,
+// to their operating system.
+var otherSeriesOS = map[string]OSType{
+	"centos7":      CentOS,
+	"centos8":      CentOS,
+	"centos9":      CentOS,
+	"opensuseleap": OpenSUSE,
+	"win2008r2":    Windows,
+	"win2012":      Windows,
+	"win2012hv":    Windows,
+	"win2012hvr2":  Windows,
+	"win2012r2":    Windows,
+	"win2016":      Windows,
+	"win2016hv":    Windows,
+	"win2016nano":  Windows,
+	"win2019":      Windows,
+	"win7":         Windows,
+	"win8":         Windows,
+	"win81":        Windows,
+	"win10":        Windows,
+	"genericlinux": GenericLinux,
+
+	KubernetesSeries: Kubernetes,
+}
+
+// SeriesOS returns the operating system of the given series. It
+// returns UnknownOS and an error with the CodeUnknownSeries code
+// if the series is not known.
+func SeriesOS(series string) (OSType, error) {
+	if os, ok := otherSeriesOS[series]; ok {
+		return os, nil
+	}
+	for _, s := range ubuntuSeries {
+		if s == series {
+			return Ubuntu, nil
+		}
+	}
+	return UnknownOS, errorCodef(CodeUnknownSeries, "unknown series %q", series)
+}
+
+// OSSeries returns the known series of the given operating
+// system, in alphabetical order.
+func OSSeries(os OSType) []string {
+	var series []string
+	if os == Ubuntu {
+		for _, s := range ubuntuSeries {
+			series = append(series, s)
+		}
+	}
+	for s, sos := range otherSeriesOS {
+		if sos == os {
+			series = append(series, s)
+		}
+	}
+	sort.Strings(series)
+	return series
+}
+
+// checkSeriesOS checks that the given series declared by the named
+// charm do not mix Windows series with series of other operating
+// systems, as the hooks of Windows charms cannot run elsewhere.
+// Unknown series are ignored.
+func checkSeriesOS(charmName string, series []string) error {
+	var windows, other string
+	for _, s := range series {
+		os, err := SeriesOS(s)
+		if err != nil {
+			continue
+		}
+		if os == Windows {
+			if windows == "" {
+				windows = s
+			}
+		} else if other == "" {
+			other = s
+		}
+	}
+	if windows != "" && other != "" {
+		return errorCodef(CodeInvalidSeries, "charm %q cannot mix Windows series %q with series %q", charmName, windows, other)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type SeriesOSSuite struct{}
+
+var _ = gc.Suite(&SeriesOSSuite{})
+
+var seriesOSTests = []struct {
+	series string
+	os     charm.OSType
+}{
+	{"trusty", charm.Ubuntu},
+	{"focal", charm.Ubuntu},
+	{"centos7", charm.CentOS},
+	{"opensuseleap", charm.OpenSUSE},
+	{"win2012r2", charm.Windows},
+	{"win10", charm.Windows},
+	{"kubernetes", charm.Kubernetes},
+	{"genericlinux", charm.GenericLinux},
+}
+
+func (s *SeriesOSSuite) TestSeriesOS(c *gc.C) {
+	for i, test := range seriesOSTests {
+		c.Logf("test %d: %s", i, test.series)
+		os, err := charm.SeriesOS(test.series)
+		c.Assert(err, gc.IsNil)
+		c.Assert(os, gc.Equals, test.os)
+	}
+}
+
+func (s *SeriesOSSuite) TestSeriesOSUnknown(c *gc.C) {
+	os, err := charm.SeriesOS("plan9")
+	c.Assert(err, gc.ErrorMatches, `unknown series "plan9"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeUnknownSeries)
+	c.Assert(os, gc.Equals, charm.UnknownOS)
+}
+
+func (s *SeriesOSSuite) TestOSSeries(c *gc.C) {
+	c.Assert(charm.OSSeries(charm.CentOS), jc.DeepEquals, []string{"centos7", "centos8", "centos9"})
+	c.Assert(charm.OSSeries(charm.Kubernetes), jc.DeepEquals, []string{"kubernetes"})
+	c.Assert(charm.OSSeries(charm.UnknownOS), gc.HasLen, 0)
+	ubuntu := charm.OSSeries(charm.Ubuntu)
+	c.Assert(ubuntu, jc.Contains, "trusty")
+	c.Assert(ubuntu, jc.Contains, "jammy")
+	for _, series := range charm.OSSeries(charm.Windows) {
+		os, err := charm.SeriesOS(series)
+		c.Assert(err, gc.IsNil)
+		c.Assert(os, gc.Equals, charm.Windows)
+	}
+}
+
+func (s *SeriesOSSuite) TestIsLinux(c *gc.C) {
+	c.Assert(charm.Ubuntu.IsLinux(), gc.Equals, true)
+	c.Assert(charm.CentOS.IsLinux(), gc.Equals, true)
+	c.Assert(charm.GenericLinux.IsLinux(), gc.Equals, true)
+	c.Assert(charm.Windows.IsLinux(), gc.Equals, false)
+	c.Assert(charm.Kubernetes.IsLinux(), gc.Equals, false)
+}
+
+func (s *SeriesOSSuite) TestMetaMixedWindowsSeries(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nseries: [win2012r2, trusty]\n"))
+	c.Assert(err, gc.ErrorMatches, `charm "a" cannot mix Windows series "win2012r2" with series "trusty"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidSeries)
+
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\nseries: [win2012r2, win2016]\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.SupportedSeries, jc.DeepEquals, []string{"win2012r2", "win2016"})
+
+	_, err = charm.ReadMeta(strings.NewReader(dummyMetadata + "\nseries: [trusty, centos7]\n"))
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *SeriesOSSuite) TestValidateURLKnownSeries(c *gc.C) {
+	opts := charm.ValidateURLOptions{RequireKnownSeries: true}
+	c.Assert(charm.ValidateURLString("cs:win2012r2/iis", opts), gc.HasLen, 0)
+	c.Assert(charm.ValidateURLString("cs:bundle/wordpress", opts), gc.HasLen, 0)
+	c.Assert(charm.ValidateURLString("cs:plan9/wordpress", opts), jc.DeepEquals, []charm.URLProblem{{
+		Field:   "series",
+		Value:   "plan9",
+		Message: `unknown series "plan9"`,
+	}})
+	c.Assert(charm.ValidateURLString("cs:plan9/wordpress", charm.ValidateURLOptions{}), gc.HasLen, 0)
+}
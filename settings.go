@@ -0,0 +1,62 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+// CoercedSettings returns the default settings of the config
+// overridden by the given settings, with each value coerced to the
+// Go type of its option: string, int64, float64 or bool. Options with
+// no default and no setting have a nil value. The values can then be
+// read with Get and GetDefault rather than with type switches. It
+// returns an error if the settings contain unknown keys or invalid
+// values.
+func (c *Config) CoercedSettings(settings Settings) (Settings, error) {
+	out := make(Settings)
+	for name, option := range c.Options {
+		value, err := option.validate(name, option.Default)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = value
+	}
+	validated, err := c.ValidateSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range validated {
+		out[name] = value
+	}
+	return out, nil
+}
+
+// Get returns the value of the given key in settings as a T. As the
+// int options of a config are coerced to int64, an int64 value may
+// also be returned as an int. It returns an error with code
+// CodeInvalidSettings if the key has no value, and one with code
+// CodeInvalidOptionType if the value is not a T.
+func Get[T any](settings Settings, key string) (T, error) {
+	var result T
+	value, ok := settings[key]
+	if !ok || value == nil {
+		return result, errorCodef(CodeInvalidSettings, "setting %q has no value", key)
+	}
+	if v, ok := value.(T); ok {
+		return v, nil
+	}
+	if p, ok := any(&result).(*int); ok {
+		if v, ok := value.(int64); ok && int64(int(v)) == v {
+			*p = int(v)
+			return result, nil
+		}
+	}
+	return result, errorCodef(CodeInvalidOptionType, "setting %q holds %T, not %T", key, value, result)
+}
+
+// GetDefault is like Get, but returns the given
+// value if the key has no value or is not a T.
+func GetDefault[T any](settings Settings, key string, dflt T) T {
+	if v, err := Get[T](settings, key); err == nil {
+		return v
+	}
+	return dflt
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type SettingsSuite struct{}
+
+var _ = gc.Suite(&SettingsSuite{})
+
+const settingsTestConfig = `
+options:
+    title:
+        type: string
+        default: My Title
+    port:
+        type: int
+        default: 80
+    ratio:
+        type: float
+    debug:
+        type: boolean
+        default: false
+`
+
+func (s *SettingsSuite) readConfig(c *gc.C) *charm.Config {
+	config, err := charm.ReadConfig(strings.NewReader(settingsTestConfig))
+	c.Assert(err, jc.ErrorIsNil)
+	return config
+}
+
+func (s *SettingsSuite) TestCoercedSettings(c *gc.C) {
+	config := s.readConfig(c)
+	settings, err := config.CoercedSettings(charm.Settings{
+		"port":  8080,
+		"ratio": 1.5,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, charm.Settings{
+		"title": "My Title",
+		"port":  int64(8080),
+		"ratio": 1.5,
+		"debug": false,
+	})
+}
+
+func (s *SettingsSuite) TestCoercedSettingsError(c *gc.C) {
+	config := s.readConfig(c)
+	_, err := config.CoercedSettings(charm.Settings{
+		"colour": "blue",
+	})
+	c.Assert(err, gc.ErrorMatches, `unknown option "colour"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeUnknownOption)
+}
+
+func (s *SettingsSuite) TestGet(c *gc.C) {
+	config := s.readConfig(c)
+	settings, err := config.CoercedSettings(nil)
+	c.Assert(err, jc.ErrorIsNil)
+
+	title, err := charm.Get[string](settings, "title")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(title, gc.Equals, "My Title")
+
+	port, err := charm.Get[int64](settings, "port")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(port, gc.Equals, int64(80))
+
+	intPort, err := charm.Get[int](settings, "port")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(intPort, gc.Equals, 80)
+
+	debug, err := charm.Get[bool](settings, "debug")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(debug, jc.IsFalse)
+
+	_, err = charm.Get[float64](settings, "ratio")
+	c.Assert(err, gc.ErrorMatches, `setting "ratio" has no value`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidSettings)
+
+	_, err = charm.Get[string](settings, "port")
+	c.Assert(err, gc.ErrorMatches, `setting "port" holds int64, not string`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidOptionType)
+}
+
+func (s *SettingsSuite) TestGetDefault(c *gc.C) {
+	settings := charm.Settings{
+		"title": "My Title",
+		"ratio": nil,
+	}
+	c.Assert(charm.GetDefault(settings, "title", "none"), gc.Equals, "My Title")
+	c.Assert(charm.GetDefault(settings, "ratio", 0.5), gc.Equals, 0.5)
+	c.Assert(charm.GetDefault(settings, "title", 3), gc.Equals, 3)
+	c.Assert(charm.GetDefault(settings, "missing", true), jc.IsTrue)
+}
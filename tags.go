@@ -0,0 +1,164 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/juju/utils/set"
+)
+
+// DefaultKnownTags holds the tags recognised by the charm store
+// search. It is the vocabulary used unless another one is set with
+// SetKnownTags.
+var DefaultKnownTags = []string{
+	"analytics",
+	"app-servers",
+	"apps",
+	"big-data",
+	"cache-proxy",
+	"databases",
+	"file-servers",
+	"kubernetes",
+	"misc",
+	"monitoring",
+	"network",
+	"openstack",
+	"ops",
+	"security",
+	"storage",
+}
+
+// categoryTags maps the values of the deprecated categories field that
+// differ from their equivalent tags. Other categories are used as tags
+// unchanged, once normalized.
+var categoryTags = map[string]string{
+	"application":  "apps",
+	"applications": "apps",
+	"app-server":   "app-servers",
+	"bigdata":      "big-data",
+	"database":     "databases",
+	"file-server":  "file-servers",
+	"networking":   "network",
+}
+
+var (
+	knownTagsMutex sync.RWMutex
+	knownTags      = set.NewStrings(DefaultKnownTags...)
+)
+
+var validTag = regexp.MustCompile("^[a-z0-9]+(-[a-z0-9]+)*$")
+
+// KnownTags returns the sorted vocabulary of tags
+// currently used by IsKnownTag and ValidateTags.
+func KnownTags() []string {
+	knownTagsMutex.RLock()
+	defer knownTagsMutex.RUnlock()
+	return knownTags.SortedValues()
+}
+
+// SetKnownTags sets the vocabulary of tags used by IsKnownTag and
+// ValidateTags and returns the previous one. The tags are normalized
+// with NormalizeTag. If tags is nil, DefaultKnownTags is used.
+func SetKnownTags(tags []string) []string {
+	if tags == nil {
+		tags = DefaultKnownTags
+	}
+	vocabulary := set.NewStrings()
+	for _, tag := range tags {
+		vocabulary.Add(NormalizeTag(tag))
+	}
+	knownTagsMutex.Lock()
+	defer knownTagsMutex.Unlock()
+	old := knownTags.SortedValues()
+	knownTags = vocabulary
+	return old
+}
+
+// IsKnownTag reports whether the given tag, once normalized,
+// is part of the current vocabulary.
+func IsKnownTag(tag string) bool {
+	knownTagsMutex.RLock()
+	defer knownTagsMutex.RUnlock()
+	return knownTags.Contains(NormalizeTag(tag))
+}
+
+// NormalizeTag returns the canonical form of the given tag: lower
+// case, with surrounding white space removed and inner runs of white
+// space and underscores replaced by single hyphens, so that
+// "Big Data" and "big_data" both become "big-data".
+func NormalizeTag(tag string) string {
+	tag = strings.Replace(strings.ToLower(tag), "_", " ", -1)
+	return strings.Join(strings.Fields(tag), "-")
+}
+
+// ValidateTags returns an error if any of the given tags is not well
+// formed or, once normalized, is not part of the current vocabulary.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		normalized := NormalizeTag(tag)
+		if !validTag.MatchString(normalized) {
+			return errorCodef(CodeInvalidTag, "invalid tag %q", tag)
+		}
+		if !IsKnownTag(normalized) {
+			return errorCodef(CodeInvalidTag, "unknown tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// NormalizedTags returns the normalized tags of the charm, taken
+// from its tags and deprecated categories, sorted and without
+// duplicates. Categories are mapped to their equivalent tags, and
+// tags that are not well formed once normalized are left out.
+func (m *Meta) NormalizedTags() []string {
+	tags, _ := normalizeTags(m.Tags, m.Categories)
+	return tags
+}
+
+// normalizeTags implements Meta.NormalizedTags. It also returns a
+// warning for each of the given tags and categories that is left out
+// because it is not well formed.
+func normalizeTags(tags, categories []string) ([]string, []Warning) {
+	all := set.NewStrings()
+	var warnings []Warning
+	for _, tag := range tags {
+		normalized := NormalizeTag(tag)
+		if !validTag.MatchString(normalized) {
+			warnings = append(warnings, warningf(CodeMalformedTag, "tag %q is not well formed and has been ignored", tag))
+			continue
+		}
+		all.Add(normalized)
+	}
+	for _, category := range categories {
+		normalized := NormalizeTag(category)
+		if !validTag.MatchString(normalized) {
+			warnings = append(warnings, warningf(CodeMalformedTag, "category %q is not well formed and has been ignored", category))
+			continue
+		}
+		if tag, ok := categoryTags[normalized]; ok {
+			normalized = tag
+		}
+		all.Add(normalized)
+	}
+	if all.IsEmpty() {
+		return nil, warnings
+	}
+	return all.SortedValues(), warnings
+}
+
+// unknownTagWarnings returns a warning for each of the given
+// tags that is not part of the current vocabulary.
+func unknownTagWarnings(tags []string) []Warning {
+	var warnings []Warning
+	for _, tag := range tags {
+		if !IsKnownTag(tag) {
+			warnings = append(warnings, warningf(CodeUnknownTag, "tag %q is not a known tag", tag))
+		}
+	}
+	sortWarnings(warnings)
+	return warnings
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type TagsSuite struct{}
+
+var _ = gc.Suite(&TagsSuite{})
+
+var normalizeTagTests = []struct {
+	tag    string
+	expect string
+}{
+	{"databases", "databases"},
+	{"  Databases ", "databases"},
+	{"Big Data", "big-data"},
+	{"big_data", "big-data"},
+	{"big \t data", "big-data"},
+	{"", ""},
+}
+
+func (s *TagsSuite) TestNormalizeTag(c *gc.C) {
+	for i, test := range normalizeTagTests {
+		c.Logf("test %d: %q", i, test.tag)
+		c.Assert(charm.NormalizeTag(test.tag), gc.Equals, test.expect)
+	}
+}
+
+func (s *TagsSuite) TestValidateTags(c *gc.C) {
+	err := charm.ValidateTags([]string{"databases", "Big Data", "OpenStack"})
+	c.Assert(err, gc.IsNil)
+
+	err = charm.ValidateTags([]string{"databases", "sql"})
+	c.Assert(err, gc.ErrorMatches, `unknown tag "sql"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidTag)
+
+	err = charm.ValidateTags([]string{"data/bases"})
+	c.Assert(err, gc.ErrorMatches, `invalid tag "data/bases"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidTag)
+}
+
+func (s *TagsSuite) TestSetKnownTags(c *gc.C) {
+	c.Assert(charm.KnownTags(), jc.DeepEquals, charm.DefaultKnownTags)
+	old := charm.SetKnownTags([]string{"SQL", "databases"})
+	defer charm.SetKnownTags(old)
+	c.Assert(old, jc.DeepEquals, charm.DefaultKnownTags)
+	c.Assert(charm.KnownTags(), jc.DeepEquals, []string{"databases", "sql"})
+	c.Assert(charm.IsKnownTag("Sql"), jc.IsTrue)
+	c.Assert(charm.IsKnownTag("storage"), jc.IsFalse)
+	c.Assert(charm.ValidateTags([]string{"sql"}), gc.IsNil)
+
+	charm.SetKnownTags(nil)
+	c.Assert(charm.KnownTags(), jc.DeepEquals, charm.DefaultKnownTags)
+}
+
+func (s *TagsSuite) TestReadMetaNormalizesTags(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + `
+tags: [" Storage", OpenStack, big_data, storage]
+categories: [Database, applications, monitoring]
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Tags, jc.DeepEquals, []string{" Storage", "OpenStack", "big_data", "storage"})
+	c.Assert(meta.NormalizedTags(), jc.DeepEquals, []string{"apps", "big-data", "databases", "monitoring", "openstack", "storage"})
+	c.Assert(meta.Categories, jc.DeepEquals, []string{"Database", "applications", "monitoring"})
+	c.Assert(meta.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeDeprecatedField,
+		Message: `metadata field "categories" is deprecated; use tags instead`,
+	}})
+}
+
+func (s *TagsSuite) TestReadMetaUnknownTags(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\ntags: [sql, databases, nosql]\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Tags, jc.DeepEquals, []string{"sql", "databases", "nosql"})
+	c.Assert(meta.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeUnknownTag,
+		Message: `tag "nosql" is not a known tag`,
+	}, {
+		Code:    charm.CodeUnknownTag,
+		Message: `tag "sql" is not a known tag`,
+	}})
+}
+
+func (s *TagsSuite) TestReadMetaInvalidTag(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata + "\ntags: [\"c++\", databases]\ncategories: [\"\"]\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Tags, jc.DeepEquals, []string{"c++", "databases"})
+	c.Assert(meta.NormalizedTags(), jc.DeepEquals, []string{"databases"})
+	c.Assert(meta.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeDeprecatedField,
+		Message: `metadata field "categories" is deprecated; use tags instead`,
+	}, {
+		Code:    charm.CodeMalformedTag,
+		Message: `tag "c++" is not well formed and has been ignored`,
+	}, {
+		Code:    charm.CodeMalformedTag,
+		Message: `category "" is not well formed and has been ignored`,
+	}})
+}
@@ -5,7 +5,9 @@ package testing
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -37,6 +39,10 @@ type MockStore struct {
 	InfoRequestCountNoStats int
 	DefaultSeries           string
 
+	// InfoRequestCountNotModified holds the number of
+	// charm info requests answered with 304 Not Modified.
+	InfoRequestCountNotModified int
+
 	charms map[string]int
 }
 
@@ -136,6 +142,13 @@ func (s *MockStore) serveInfo(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		s.InfoRequestCountNotModified += 1
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
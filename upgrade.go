@@ -0,0 +1,231 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/juju/utils/set"
+)
+
+// UpgradeSeverity describes how much a change between two
+// revisions of a charm affects deployments being upgraded.
+type UpgradeSeverity int
+
+const (
+	// SeverityInfo is used for changes that do not
+	// affect existing deployments.
+	SeverityInfo UpgradeSeverity = iota
+
+	// SeverityWarning is used for changes that may
+	// affect existing deployments.
+	SeverityWarning
+
+	// SeverityBreaking is used for changes that break
+	// existing deployments.
+	SeverityBreaking
+)
+
+var upgradeSeverityNames = []string{
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityBreaking: "breaking",
+}
+
+// String returns the name of the severity.
+func (s UpgradeSeverity) String() string {
+	if s < 0 || int(s) >= len(upgradeSeverityNames) {
+		return fmt.Sprintf("UpgradeSeverity(%d)", int(s))
+	}
+	return upgradeSeverityNames[s]
+}
+
+// UpgradeIssue describes a change found by CheckUpgrade.
+type UpgradeIssue struct {
+	Severity UpgradeSeverity
+	Message  string
+}
+
+// String returns the issue prefixed by its severity.
+func (i UpgradeIssue) String() string {
+	return i.Severity.String() + ": " + i.Message
+}
+
+// UpgradeIssues holds the issues found by CheckUpgrade.
+type UpgradeIssues []UpgradeIssue
+
+// MaxSeverity returns the highest severity of the issues,
+// or SeverityInfo if there are none.
+func (issues UpgradeIssues) MaxSeverity() UpgradeSeverity {
+	max := SeverityInfo
+	for _, issue := range issues {
+		if issue.Severity > max {
+			max = issue.Severity
+		}
+	}
+	return max
+}
+
+// Breaking reports whether any of the issues is breaking.
+func (issues UpgradeIssues) Breaking() bool {
+	return issues.MaxSeverity() >= SeverityBreaking
+}
+
+func (issues UpgradeIssues) Len() int      { return len(issues) }
+func (issues UpgradeIssues) Swap(i, j int) { issues[i], issues[j] = issues[j], issues[i] }
+func (issues UpgradeIssues) Less(i, j int) bool {
+	if issues[i].Severity != issues[j].Severity {
+		return issues[i].Severity > issues[j].Severity
+	}
+	return issues[i].Message < issues[j].Message
+}
+
+// upgradeChecker accumulates the issues found when
+// comparing two revisions of a charm.
+type upgradeChecker struct {
+	issues UpgradeIssues
+}
+
+func (c *upgradeChecker) addf(severity UpgradeSeverity, f string, a ...interface{}) {
+	c.issues = append(c.issues, UpgradeIssue{
+		Severity: severity,
+		Message:  fmt.Sprintf(f, a...),
+	})
+}
+
+// CheckUpgrade compares the old and new revisions of a charm and
+// returns the changes that affect deployments being upgraded from
+// old to new, sorted by decreasing severity. It flags removed
+// relations and changed relation interfaces, removed or retyped
+// configuration options, dropped series and changes in the shape
+// of storage.
+func CheckUpgrade(oldCh, newCh Charm) UpgradeIssues {
+	c := &upgradeChecker{}
+	oldMeta, newMeta := oldCh.Meta(), newCh.Meta()
+	if oldMeta.Subordinate != newMeta.Subordinate {
+		c.addf(SeverityBreaking, "subordinate changed from %v to %v", oldMeta.Subordinate, newMeta.Subordinate)
+	}
+	c.checkRelations(RoleProvider, oldMeta.Provides, newMeta.Provides)
+	c.checkRelations(RoleRequirer, oldMeta.Requires, newMeta.Requires)
+	c.checkRelations(RolePeer, oldMeta.Peers, newMeta.Peers)
+	c.checkConfig(oldCh.Config(), newCh.Config())
+	c.checkSeries(oldMeta, newMeta)
+	c.checkStorage(oldMeta.Storage, newMeta.Storage)
+	sort.Sort(c.issues)
+	return c.issues
+}
+
+func (c *upgradeChecker) checkRelations(role RelationRole, oldRels, newRels map[string]Relation) {
+	for name, oldRel := range oldRels {
+		newRel, ok := newRels[name]
+		if !ok {
+			c.addf(SeverityBreaking, "%s relation %q removed", role, name)
+			continue
+		}
+		if newRel.Interface != oldRel.Interface {
+			c.addf(SeverityBreaking, "%s relation %q interface changed from %q to %q", role, name, oldRel.Interface, newRel.Interface)
+		}
+		if newRel.Scope != oldRel.Scope {
+			c.addf(SeverityWarning, "%s relation %q scope changed from %q to %q", role, name, oldRel.Scope, newRel.Scope)
+		}
+		if newRel.Limit != 0 && (oldRel.Limit == 0 || newRel.Limit < oldRel.Limit) {
+			c.addf(SeverityWarning, "%s relation %q limit reduced to %d", role, name, newRel.Limit)
+		}
+	}
+	for name := range newRels {
+		if _, ok := oldRels[name]; !ok {
+			c.addf(SeverityInfo, "%s relation %q added", role, name)
+		}
+	}
+}
+
+func (c *upgradeChecker) checkConfig(oldConfig, newConfig *Config) {
+	var oldOptions, newOptions map[string]Option
+	if oldConfig != nil {
+		oldOptions = oldConfig.Options
+	}
+	if newConfig != nil {
+		newOptions = newConfig.Options
+	}
+	for name, oldOpt := range oldOptions {
+		newOpt, ok := newOptions[name]
+		if !ok {
+			c.addf(SeverityBreaking, "config option %q removed", name)
+			continue
+		}
+		if newOpt.Type != oldOpt.Type {
+			c.addf(SeverityBreaking, "config option %q type changed from %s to %s", name, oldOpt.Type, newOpt.Type)
+			continue
+		}
+		if !reflect.DeepEqual(newOpt.Default, oldOpt.Default) {
+			c.addf(SeverityInfo, "config option %q default changed from %v to %v", name, oldOpt.Default, newOpt.Default)
+		}
+	}
+	for name := range newOptions {
+		if _, ok := oldOptions[name]; !ok {
+			c.addf(SeverityInfo, "config option %q added", name)
+		}
+	}
+}
+
+func (c *upgradeChecker) checkSeries(oldMeta, newMeta *Meta) {
+	newSeries := newMeta.supportedSeries()
+	if len(newSeries) == 0 {
+		return
+	}
+	oldSeries := oldMeta.supportedSeries()
+	if len(oldSeries) == 0 {
+		c.addf(SeverityWarning, "supported series restricted to %v", newSeries)
+		return
+	}
+	supported := set.NewStrings(newSeries...)
+	for _, series := range oldSeries {
+		if !supported.Contains(series) {
+			c.addf(SeverityBreaking, "series %q no longer supported", series)
+		}
+	}
+}
+
+func (c *upgradeChecker) checkStorage(oldStores, newStores map[string]Storage) {
+	for name, oldStore := range oldStores {
+		newStore, ok := newStores[name]
+		if !ok {
+			c.addf(SeverityBreaking, "storage %q removed", name)
+			continue
+		}
+		if newStore.Type != oldStore.Type {
+			c.addf(SeverityBreaking, "storage %q type changed from %s to %s", name, oldStore.Type, newStore.Type)
+		}
+		if newStore.Shared != oldStore.Shared {
+			c.addf(SeverityBreaking, "storage %q shared changed from %v to %v", name, oldStore.Shared, newStore.Shared)
+		}
+		if newStore.CountMin > oldStore.CountMin {
+			c.addf(SeverityBreaking, "storage %q minimum count increased from %d to %d", name, oldStore.CountMin, newStore.CountMin)
+		}
+		if newStore.CountMax != -1 && (oldStore.CountMax == -1 || newStore.CountMax < oldStore.CountMax) {
+			c.addf(SeverityBreaking, "storage %q maximum count reduced to %d", name, newStore.CountMax)
+		}
+		if newStore.ReadOnly != oldStore.ReadOnly {
+			c.addf(SeverityWarning, "storage %q read-only changed from %v to %v", name, oldStore.ReadOnly, newStore.ReadOnly)
+		}
+		if newStore.MinimumSize > oldStore.MinimumSize {
+			c.addf(SeverityWarning, "storage %q minimum size increased from %dM to %dM", name, oldStore.MinimumSize, newStore.MinimumSize)
+		}
+		if newStore.Location != oldStore.Location {
+			c.addf(SeverityWarning, "storage %q location changed from %q to %q", name, oldStore.Location, newStore.Location)
+		}
+	}
+	for name, newStore := range newStores {
+		if _, ok := oldStores[name]; ok {
+			continue
+		}
+		if newStore.CountMin > 0 {
+			c.addf(SeverityWarning, "storage %q added, requiring at least %d instance(s)", name, newStore.CountMin)
+		} else {
+			c.addf(SeverityInfo, "storage %q added", name)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type UpgradeSuite struct{}
+
+var _ = gc.Suite(&UpgradeSuite{})
+
+// upgradeCharm implements charm.Charm for upgrade tests.
+type upgradeCharm struct {
+	meta   *charm.Meta
+	config *charm.Config
+}
+
+func (c *upgradeCharm) Meta() *charm.Meta       { return c.meta }
+func (c *upgradeCharm) Config() *charm.Config   { return c.config }
+func (c *upgradeCharm) Metrics() *charm.Metrics { return nil }
+func (c *upgradeCharm) Actions() *charm.Actions { return nil }
+func (c *upgradeCharm) Revision() int           { return 0 }
+
+func newUpgradeCharm(c *gc.C, meta, config string) charm.Charm {
+	m, err := charm.ReadMeta(strings.NewReader(meta))
+	c.Assert(err, jc.ErrorIsNil)
+	cfg, err := charm.ReadConfig(strings.NewReader(config))
+	c.Assert(err, jc.ErrorIsNil)
+	return &upgradeCharm{meta: m, config: cfg}
+}
+
+const upgradeOldMeta = `
+name: app
+summary: app
+description: app
+series: [trusty, xenial]
+provides:
+    website: http
+    api: rest
+requires:
+    db: mysql
+storage:
+    data:
+        type: filesystem
+        location: /srv/data
+    logs:
+        type: filesystem
+        multiple:
+            range: 1-4
+    cache:
+        type: block
+`
+
+const upgradeOldConfig = `
+options:
+    port:
+        type: int
+        default: 80
+        description: port
+    title:
+        type: string
+        default: app
+        description: title
+    debug:
+        type: boolean
+        default: false
+        description: debug
+`
+
+func (s *UpgradeSuite) TestCheckUpgradeNoChanges(c *gc.C) {
+	oldCh := newUpgradeCharm(c, upgradeOldMeta, upgradeOldConfig)
+	newCh := newUpgradeCharm(c, upgradeOldMeta, upgradeOldConfig)
+	issues := charm.CheckUpgrade(oldCh, newCh)
+	c.Assert(issues, gc.HasLen, 0)
+	c.Assert(issues.MaxSeverity(), gc.Equals, charm.SeverityInfo)
+	c.Assert(issues.Breaking(), jc.IsFalse)
+}
+
+func (s *UpgradeSuite) TestCheckUpgrade(c *gc.C) {
+	oldCh := newUpgradeCharm(c, upgradeOldMeta, upgradeOldConfig)
+	newCh := newUpgradeCharm(c, `
+name: app
+summary: app
+description: app
+series: [xenial]
+provides:
+    website: https
+requires:
+    db: mysql
+    cache: memcache
+storage:
+    data:
+        type: filesystem
+        location: /var/data
+    logs:
+        type: filesystem
+        multiple:
+            range: 2-3
+    scratch:
+        type: block
+`, `
+options:
+    port:
+        type: string
+        default: "80"
+        description: port
+    title:
+        type: string
+        default: new app
+        description: title
+`)
+	issues := charm.CheckUpgrade(oldCh, newCh)
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	c.Assert(got, jc.DeepEquals, []string{
+		`breaking: config option "debug" removed`,
+		`breaking: config option "port" type changed from int to string`,
+		`breaking: provider relation "api" removed`,
+		`breaking: provider relation "website" interface changed from "http" to "https"`,
+		`breaking: series "trusty" no longer supported`,
+		`breaking: storage "cache" removed`,
+		`breaking: storage "logs" maximum count reduced to 3`,
+		`breaking: storage "logs" minimum count increased from 1 to 2`,
+		`warning: storage "data" location changed from "/srv/data" to "/var/data"`,
+		`warning: storage "scratch" added, requiring at least 1 instance(s)`,
+		`info: config option "title" default changed from app to new app`,
+		`info: requirer relation "cache" added`,
+	})
+	c.Assert(issues.MaxSeverity(), gc.Equals, charm.SeverityBreaking)
+	c.Assert(issues.Breaking(), jc.IsTrue)
+}
+
+func (s *UpgradeSuite) TestCheckUpgradeRestrictsSeries(c *gc.C) {
+	oldCh := newUpgradeCharm(c, "name: app\nsummary: app\ndescription: app\n", "options: {}")
+	newCh := newUpgradeCharm(c, "name: app\nsummary: app\ndescription: app\nseries: xenial\n", "options: {}")
+	issues := charm.CheckUpgrade(oldCh, newCh)
+	c.Assert(issues, jc.DeepEquals, charm.UpgradeIssues{{
+		Severity: charm.SeverityWarning,
+		Message:  `supported series restricted to [xenial]`,
+	}})
+	c.Assert(issues.Breaking(), jc.IsFalse)
+}
+
+func (s *UpgradeSuite) TestUpgradeSeverityString(c *gc.C) {
+	c.Assert(charm.SeverityInfo.String(), gc.Equals, "info")
+	c.Assert(charm.SeverityWarning.String(), gc.Equals, "warning")
+	c.Assert(charm.SeverityBreaking.String(), gc.Equals, "breaking")
+	c.Assert(charm.UpgradeSeverity(7).String(), gc.Equals, "UpgradeSeverity(7)")
+}
@@ -6,11 +6,11 @@ package charm
 import (
 	"encoding/json"
 	"fmt"
+	neturl "net/url"
 	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/juju/names"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -29,7 +29,7 @@ type Location interface {
 //     local:oneiric/wordpress
 //
 type URL struct {
-	Schema   string // "cs" or "local"
+	Schema   string // "cs", "ch" or "local"
 	User     string // "joe"
 	Name     string // "wordpress"
 	Revision int    // -1 if unset, N otherwise
@@ -44,7 +44,7 @@ type URL struct {
 //     cs:precise/wordpress
 type Reference URL
 
-var ErrUnresolvedUrl error = fmt.Errorf("charm url series is not resolved")
+var ErrUnresolvedUrl error = errorCodef(CodeUnresolvedSeries, "charm url series is not resolved")
 
 var (
 	validSeries = regexp.MustCompile("^[a-z]+([a-z0-9]+)?$")
@@ -56,9 +56,56 @@ func IsValidSeries(series string) bool {
 	return validSeries.MatchString(series)
 }
 
-// IsValidName returns whether name is a valid charm name.
+// IsValidName returns whether name is a valid charm name
+// according to the default name validation profile.
 func IsValidName(name string) bool {
-	return validName.MatchString(name)
+	return DefaultNameValidationProfile().IsValid(name)
+}
+
+// BundleSeries holds the series used in the URLs of bundles.
+const BundleSeries = "bundle"
+
+// Kind identifies the kind of entity a charm URL refers to.
+type Kind string
+
+const (
+	// KindUnknown is the kind of references with no series,
+	// which may refer to either a charm or a bundle.
+	KindUnknown Kind = ""
+
+	// KindCharm is the kind of charms.
+	KindCharm Kind = "charm"
+
+	// KindBundle is the kind of bundles.
+	KindBundle Kind = "bundle"
+)
+
+// IsBundle reports whether url refers to a bundle.
+func (url *URL) IsBundle() bool {
+	return url.Series == BundleSeries
+}
+
+// Kind returns the kind of entity url refers to.
+func (url *URL) Kind() Kind {
+	if url.IsBundle() {
+		return KindBundle
+	}
+	return KindCharm
+}
+
+// IsBundle reports whether r refers to a bundle.
+// It returns false if the series of r is not resolved.
+func (r *Reference) IsBundle() bool {
+	return r.Series == BundleSeries
+}
+
+// Kind returns the kind of entity r refers to, or KindUnknown
+// if the series of r is not resolved.
+func (r *Reference) Kind() Kind {
+	if r.Series == "" {
+		return KindUnknown
+	}
+	return (*URL)(r).Kind()
 }
 
 // WithRevision returns a URL equivalent to url but with Revision set
@@ -69,6 +116,26 @@ func (url *URL) WithRevision(revision int) *URL {
 	return &urlCopy
 }
 
+// WithOwner returns a URL equivalent to url but with User set
+// to owner. For example, cs:trusty/wordpress.WithOwner("charmers")
+// returns cs:~charmers/trusty/wordpress.
+func (url *URL) WithOwner(owner string) *URL {
+	urlCopy := *url
+	urlCopy.User = owner
+	return &urlCopy
+}
+
+// Promulgated returns a URL equivalent to url but with no User set,
+// which is the form used to refer to promulgated charms. For example,
+// cs:~charmers/trusty/wordpress.Promulgated() returns
+// cs:trusty/wordpress.
+//
+// Note that Promulgated does not check that the charm really is
+// promulgated; use a PromulgationResolver for that.
+func (url *URL) Promulgated() *URL {
+	return url.WithOwner("")
+}
+
 // MustParseURL works like ParseURL, but panics in case of errors.
 func MustParseURL(url string) *URL {
 	u, err := ParseURL(url)
@@ -81,7 +148,11 @@ func MustParseURL(url string) *URL {
 // ParseURL parses the provided charm URL string into its respective
 // structure.
 func ParseURL(urlStr string) (*URL, error) {
-	r, err := parseReference(urlStr)
+	return parseURLWith(urlStr, nil)
+}
+
+func parseURLWith(urlStr string, v *urlValidator) (*URL, error) {
+	r, err := parseReferenceWith(urlStr, v)
 	if err != nil {
 		return nil, err
 	}
@@ -89,7 +160,7 @@ func ParseURL(urlStr string) (*URL, error) {
 		return nil, ErrUnresolvedUrl
 	}
 	if r.Schema == "" {
-		return nil, fmt.Errorf("charm URL has no schema: %q", urlStr)
+		return nil, errorCodef(CodeMissingSchema, "charm URL has no schema: %q", urlStr)
 	}
 	url, err := r.URL("")
 	if err != nil {
@@ -110,7 +181,7 @@ func (ref *Reference) URL(defaultSeries string) (*URL, error) {
 		return nil, ErrUnresolvedUrl
 	}
 	if !IsValidSeries(defaultSeries) {
-		return nil, fmt.Errorf("default series %q is invalid", defaultSeries)
+		return nil, errorCodef(CodeInvalidSeries, "default series %q is invalid", defaultSeries)
 	}
 	url := *(*URL)(ref)
 	url.Series = defaultSeries
@@ -139,8 +210,36 @@ func MustParseReference(url string) *Reference {
 //    schema:~user/name-revision
 //
 // A missing schema is assumed to be 'cs'.
+//
+// The src may also be a charmhub.io browse URL, as accepted by
+// ParseCharmHubURL, as long as it has no channel, which a reference
+// cannot hold. An error with the CodeInvalidChannel code is returned
+// otherwise; ParseCharmHubURL should be used to read such URLs.
 func ParseReference(url string) (*Reference, error) {
-	ref, err := parseReference(url)
+	if isCharmHubURL(url) {
+		return parseCharmHubReference(url)
+	}
+	return parseReferenceAndSchema(url, nil)
+}
+
+// parseCharmHubReference parses the given charmhub.io browse URL
+// as a reference, returning an error with the CodeInvalidChannel
+// code if it has a channel, which a reference cannot hold.
+func parseCharmHubReference(url string) (*Reference, error) {
+	ref, channel, err := ParseCharmHubURL(url)
+	if err != nil {
+		return nil, err
+	}
+	if channel != (Channel{}) {
+		return nil, errorCodef(CodeInvalidChannel, "charmhub URL with channel cannot be parsed as a reference: %q", url)
+	}
+	return ref, nil
+}
+
+// parseReferenceAndSchema is like parseReferenceWith,
+// but assumes the "cs" schema when none is specified.
+func parseReferenceAndSchema(url string, v *urlValidator) (*Reference, error) {
+	ref, err := parseReferenceWith(url, v)
 	if err != nil {
 		return nil, err
 	}
@@ -150,13 +249,35 @@ func ParseReference(url string) (*Reference, error) {
 	return ref, nil
 }
 
+// ParseReferenceWithWarnings is like ParseReference but also returns
+// any warnings about the reference, such as a missing schema that has
+// been assumed to be "cs". Warnings cannot be stored in URL or
+// Reference values, which must remain comparable.
+func ParseReferenceWithWarnings(url string) (*Reference, []Warning, error) {
+	ref, err := ParseReference(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []Warning
+	if !isCharmHubURL(url) && !strings.Contains(url, ":") {
+		warnings = append(warnings, warningf(CodeImplicitSchema, "charm URL %q has no schema; assuming %q", url, ref.Schema))
+	}
+	return ref, warnings, nil
+}
+
 func parseReference(url string) (*Reference, error) {
+	return parseReferenceWith(url, nil)
+}
+
+// parseReferenceWith is like parseReference but validates the
+// components of the URL with v, which may be nil.
+func parseReferenceWith(url string, v *urlValidator) (*Reference, error) {
 	var r Reference
 	i := strings.Index(url, ":")
 	if i >= 0 {
 		r.Schema = url[:i]
-		if r.Schema != "cs" && r.Schema != "local" {
-			return nil, fmt.Errorf("charm URL has invalid schema: %q", url)
+		if r.Schema != "cs" && r.Schema != "ch" && r.Schema != "local" {
+			return nil, errorCodef(CodeInvalidSchema, "charm URL has invalid schema: %q", url)
 		}
 		i++
 	} else {
@@ -164,33 +285,36 @@ func parseReference(url string) (*Reference, error) {
 	}
 	parts := strings.Split(url[i:], "/")
 	if len(parts) < 1 || len(parts) > 3 {
-		return nil, fmt.Errorf("charm URL has invalid form: %q", url)
+		return nil, errorCodef(CodeInvalidForm, "charm URL has invalid form: %q", url)
 	}
 
 	// ~<username>
 	if strings.HasPrefix(parts[0], "~") {
-		if r.Schema == "local" {
-			return nil, fmt.Errorf("local charm URL with user name: %q", url)
+		switch r.Schema {
+		case "local":
+			return nil, errorCodef(CodeUserNotAllowed, "local charm URL with user name: %q", url)
+		case "ch":
+			return nil, errorCodef(CodeUserNotAllowed, "charmhub charm URL with user name: %q", url)
 		}
 		r.User = parts[0][1:]
-		if !names.IsValidUser(r.User) {
-			return nil, fmt.Errorf("charm URL has invalid user name: %q", url)
+		if !v.isValidUser(r.User) {
+			return nil, errorCodef(CodeInvalidUser, "charm URL has invalid user name: %q", url)
 		}
 		parts = parts[1:]
 	}
 	if len(parts) > 2 {
-		return nil, fmt.Errorf("charm URL has invalid form: %q", url)
+		return nil, errorCodef(CodeInvalidForm, "charm URL has invalid form: %q", url)
 	}
 	// <series>
 	if len(parts) == 2 {
 		r.Series = parts[0]
-		if !IsValidSeries(r.Series) {
-			return nil, fmt.Errorf("charm URL has invalid series: %q", url)
+		if !v.isValidSeries(r.Series) {
+			return nil, errorCodef(CodeInvalidSeries, "charm URL has invalid series: %q", url)
 		}
 		parts = parts[1:]
 	}
 	if len(parts) < 1 {
-		return nil, fmt.Errorf("charm URL without charm name: %q", url)
+		return nil, errorCodef(CodeMissingName, "charm URL without charm name: %q", url)
 	}
 
 	// <name>[-<revision>]
@@ -211,8 +335,8 @@ func parseReference(url string) (*Reference, error) {
 		}
 		break
 	}
-	if !IsValidName(r.Name) {
-		return nil, fmt.Errorf("charm URL has invalid charm name: %q", url)
+	if !v.isValidName(r.Name) {
+		return nil, errorCodef(CodeInvalidName, "charm URL has invalid charm name: %q", url)
 	}
 	return &r, nil
 }
@@ -237,21 +361,77 @@ func (r Reference) Path() string {
 	return r.path()
 }
 
+var charmHubPrefixes = []string{
+	"https://charmhub.io/",
+	"http://charmhub.io/",
+	"https://www.charmhub.io/",
+	"http://www.charmhub.io/",
+}
+
+func isCharmHubURL(s string) bool {
+	for _, prefix := range charmHubPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCharmHubURL parses a charmhub.io browse URL, such as
+//
+//     https://charmhub.io/wordpress
+//     https://charmhub.io/wordpress?channel=1.0/edge
+//
+// into a ch: reference. It also returns the channel held in the
+// channel query parameter, or the zero Channel if there is none;
+// the channel must be accepted by ParseChannel.
+// Other query parameters are ignored.
+func ParseCharmHubURL(src string) (ref *Reference, channel Channel, err error) {
+	if !isCharmHubURL(src) {
+		return nil, Channel{}, errorCodef(CodeInvalidSchema, "not a charmhub URL: %q", src)
+	}
+	u, err := neturl.Parse(src)
+	if err != nil {
+		return nil, Channel{}, errorCodef(CodeInvalidForm, "cannot parse charmhub URL %q: %v", src, err)
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(u.Path, "/"), "/")
+	if name == "" {
+		return nil, Channel{}, errorCodef(CodeMissingName, "charmhub URL without charm name: %q", src)
+	}
+	if strings.Contains(name, "/") {
+		return nil, Channel{}, errorCodef(CodeInvalidForm, "charmhub URL has invalid form: %q", src)
+	}
+	if !IsValidName(name) {
+		return nil, Channel{}, errorCodef(CodeInvalidName, "charmhub URL has invalid charm name: %q", src)
+	}
+	query := u.Query()
+	if channels, ok := query["channel"]; ok {
+		if len(channels) != 1 {
+			return nil, Channel{}, errorCodef(CodeInvalidChannel, "charmhub URL has invalid channel: %q", src)
+		}
+		channel, err = ParseChannel(channels[0])
+		if err != nil {
+			return nil, Channel{}, errorCodef(CodeInvalidChannel, "charmhub URL has invalid channel: %q", src)
+		}
+	}
+	return &Reference{
+		Schema:   "ch",
+		Name:     name,
+		Revision: -1,
+	}, channel, nil
+}
+
 // InferURL parses src as a reference, fills out the series in the
 // returned URL using defaultSeries if necessary.
 //
-// This function is deprecated. New code should use ParseReference
-// and/or Reference.URL instead.
+// This function is deprecated. New code should use a Resolver,
+// or ParseReference and/or Reference.URL instead.
 func InferURL(src, defaultSeries string) (*URL, error) {
-	ref, err := ParseReference(src)
-	if err != nil {
-		return nil, err
-	}
-	url, err := ref.URL(defaultSeries)
-	if err != nil {
-		return nil, fmt.Errorf("cannot infer charm URL for %q: %v", src, err)
+	r := Resolver{
+		DefaultSeries: defaultSeries,
 	}
-	return url, nil
+	url, _, err := r.Resolve(src)
+	return url, err
 }
 
 // Reference returns a reference aliased to u. Note that
@@ -272,6 +452,50 @@ func (r Reference) String() string {
 	return fmt.Sprintf("%s:%s", r.Schema, r.Path())
 }
 
+// WebLink returns the URL of the page describing the charm
+// on the web site rooted at baseSite, for example
+// https://jujucharms.com. Any trailing slash on baseSite
+// is ignored. The resulting path has the form:
+//
+//     [u/<user>/]<name>[/<series>][/<revision>]
+//
+// Charmhub (ch:) charms are linked by name only, and only
+// when baseSite is charmhub.io, as other sites do not
+// describe them. WebLink returns the empty string for them
+// otherwise, as it does for local charms, which have no
+// web page.
+func (u *URL) WebLink(baseSite string) string {
+	return u.Reference().WebLink(baseSite)
+}
+
+// WebLink is like URL.WebLink except that the series
+// is omitted from the link when it is not specified.
+func (r *Reference) WebLink(baseSite string) string {
+	baseSite = strings.TrimSuffix(baseSite, "/")
+	switch r.Schema {
+	case "local":
+		return ""
+	case "ch":
+		if !isCharmHubURL(baseSite + "/") {
+			return ""
+		}
+		// Charmhub pages are only keyed by charm name.
+		return baseSite + "/" + r.Name
+	}
+	parts := []string{baseSite}
+	if r.User != "" {
+		parts = append(parts, "u", r.User)
+	}
+	parts = append(parts, r.Name)
+	if r.Series != "" {
+		parts = append(parts, r.Series)
+	}
+	if r.Revision >= 0 {
+		parts = append(parts, strconv.Itoa(r.Revision))
+	}
+	return strings.Join(parts, "/")
+}
+
 // GetBSON turns u into a bson.Getter so it can be saved directly
 // on a MongoDB database with mgo.
 func (u *URL) GetBSON() (interface{}, error) {
@@ -368,7 +592,8 @@ func (r *Reference) UnmarshalJSON(b []byte) error {
 // Quote translates a charm url string into one which can be safely used
 // in a file path.  ASCII letters, ASCII digits, dot and dash stay the
 // same; other characters are translated to their hex representation
-// surrounded by underscores.
+// surrounded by underscores. New code should use QuoteV2, which
+// bounds the length of its result.
 func Quote(unsafe string) string {
 	safe := make([]byte, 0, len(unsafe)*4)
 	for i := 0; i < len(unsafe); i++ {
@@ -52,6 +52,15 @@ var urlTests = []struct {
 }, {
 	s:   "local:name",
 	ref: &charm.Reference{"local", "", "name", -1, ""},
+}, {
+	s:   "ch:series/name-42",
+	ref: &charm.Reference{"ch", "", "name", 42, "series"},
+}, {
+	s:   "ch:name",
+	ref: &charm.Reference{"ch", "", "name", -1, ""},
+}, {
+	s:   "ch:~user/series/name",
+	err: "charmhub charm URL with user name: .*",
 }, {
 	s:   "bs:~user/series/name-1",
 	err: "charm URL has invalid schema: .*",
@@ -318,6 +327,195 @@ func (s *URLSuite) TestWithRevision(c *gc.C) {
 	c.Assert(other.WithRevision(1), gc.DeepEquals, other)
 }
 
+var webLinkTests = []struct {
+	url    string
+	expect string
+}{{
+	url:    "cs:wordpress",
+	expect: "https://jujucharms.com/wordpress",
+}, {
+	url:    "cs:trusty/wordpress",
+	expect: "https://jujucharms.com/wordpress/trusty",
+}, {
+	url:    "cs:trusty/wordpress-42",
+	expect: "https://jujucharms.com/wordpress/trusty/42",
+}, {
+	url:    "cs:wordpress-0",
+	expect: "https://jujucharms.com/wordpress/0",
+}, {
+	url:    "cs:~who/trusty/wordpress-3",
+	expect: "https://jujucharms.com/u/who/wordpress/trusty/3",
+}, {
+	url:    "cs:~who/wordpress",
+	expect: "https://jujucharms.com/u/who/wordpress",
+}, {
+	url:    "ch:trusty/wordpress-3",
+	expect: "",
+}, {
+	url:    "local:trusty/wordpress",
+	expect: "",
+}}
+
+var kindTests = []struct {
+	url    string
+	kind   charm.Kind
+	bundle bool
+}{{
+	url:  "cs:trusty/wordpress-42",
+	kind: charm.KindCharm,
+}, {
+	url:    "cs:bundle/wordpress-simple",
+	kind:   charm.KindBundle,
+	bundle: true,
+}, {
+	url:    "cs:~who/bundle/wordpress-simple-1",
+	kind:   charm.KindBundle,
+	bundle: true,
+}, {
+	url:  "cs:wordpress",
+	kind: charm.KindUnknown,
+}}
+
+func (s *URLSuite) TestKind(c *gc.C) {
+	for i, test := range kindTests {
+		c.Logf("test %d: %s", i, test.url)
+		ref := charm.MustParseReference(test.url)
+		c.Assert(ref.Kind(), gc.Equals, test.kind)
+		c.Assert(ref.IsBundle(), gc.Equals, test.bundle)
+		if test.kind == charm.KindUnknown {
+			continue
+		}
+		url := charm.MustParseURL(test.url)
+		c.Assert(url.Kind(), gc.Equals, test.kind)
+		c.Assert(url.IsBundle(), gc.Equals, test.bundle)
+	}
+}
+
+func (s *URLSuite) TestWebLink(c *gc.C) {
+	for i, test := range webLinkTests {
+		c.Logf("test %d: %s", i, test.url)
+		ref := charm.MustParseReference(test.url)
+		c.Assert(ref.WebLink("https://jujucharms.com"), gc.Equals, test.expect)
+		// A trailing slash on the base site makes no difference.
+		c.Assert(ref.WebLink("https://jujucharms.com/"), gc.Equals, test.expect)
+		if ref.Series != "" {
+			url, err := ref.URL("")
+			c.Assert(err, gc.IsNil)
+			c.Assert(url.WebLink("https://jujucharms.com"), gc.Equals, test.expect)
+		}
+	}
+}
+
+var charmHubWebLinkTests = []struct {
+	url      string
+	baseSite string
+	expect   string
+}{{
+	url:      "ch:wordpress",
+	baseSite: "https://charmhub.io",
+	expect:   "https://charmhub.io/wordpress",
+}, {
+	url:      "ch:trusty/wordpress-3",
+	baseSite: "https://charmhub.io/",
+	expect:   "https://charmhub.io/wordpress",
+}, {
+	url:      "ch:wordpress",
+	baseSite: "http://www.charmhub.io",
+	expect:   "http://www.charmhub.io/wordpress",
+}, {
+	url:      "ch:wordpress",
+	baseSite: "https://jujucharms.com",
+	expect:   "",
+}, {
+	url:      "ch:wordpress",
+	baseSite: "https://charmhub.io.example.com",
+	expect:   "",
+}, {
+	url:      "cs:trusty/wordpress-42",
+	baseSite: "https://charmhub.io",
+	expect:   "https://charmhub.io/wordpress/trusty/42",
+}}
+
+func (s *URLSuite) TestCharmHubWebLink(c *gc.C) {
+	for i, test := range charmHubWebLinkTests {
+		c.Logf("test %d: %s on %s", i, test.url, test.baseSite)
+		ref := charm.MustParseReference(test.url)
+		c.Assert(ref.WebLink(test.baseSite), gc.Equals, test.expect)
+	}
+}
+
+var charmHubURLTests = []struct {
+	url     string
+	ref     *charm.Reference
+	channel string
+	err     string
+}{{
+	url: "https://charmhub.io/wordpress",
+	ref: &charm.Reference{"ch", "", "wordpress", -1, ""},
+}, {
+	url: "https://charmhub.io/wordpress/",
+	ref: &charm.Reference{"ch", "", "wordpress", -1, ""},
+}, {
+	url: "http://www.charmhub.io/wordpress",
+	ref: &charm.Reference{"ch", "", "wordpress", -1, ""},
+}, {
+	url:     "https://charmhub.io/wordpress?channel=1.0/edge",
+	ref:     &charm.Reference{"ch", "", "wordpress", -1, ""},
+	channel: "1.0/edge",
+}, {
+	url:     "https://charmhub.io/wordpress?utm_source=x&channel=stable",
+	ref:     &charm.Reference{"ch", "", "wordpress", -1, ""},
+	channel: "stable",
+}, {
+	url: "https://charmhub.io/",
+	err: `charmhub URL without charm name: "https://charmhub.io/"`,
+}, {
+	url: "https://charmhub.io/wordpress/docs",
+	err: `charmhub URL has invalid form: "https://charmhub.io/wordpress/docs"`,
+}, {
+	url: "https://charmhub.io/Word^Press",
+	err: `charmhub URL has invalid charm name: .*`,
+}, {
+	url: "https://charmhub.io/wordpress?channel=",
+	err: `charmhub URL has invalid channel: .*`,
+}, {
+	url: "https://charmhub.io/wordpress?channel=1.0/bleeding",
+	err: `charmhub URL has invalid channel: .*`,
+}, {
+	url: "https://charmhub.io/wordpress?channel=stable&channel=edge",
+	err: `charmhub URL has invalid channel: .*`,
+}, {
+	url: "https://jujucharms.com/wordpress",
+	err: `not a charmhub URL: "https://jujucharms.com/wordpress"`,
+}}
+
+func (s *URLSuite) TestParseCharmHubURL(c *gc.C) {
+	for i, test := range charmHubURLTests {
+		c.Logf("test %d: %s", i, test.url)
+		ref, channel, err := charm.ParseCharmHubURL(test.url)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(ref, gc.IsNil)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(ref, gc.DeepEquals, test.ref)
+		c.Assert(channel.String(), gc.Equals, test.channel)
+		c.Assert(ref.String(), gc.Equals, "ch:wordpress")
+
+		// ParseReference also accepts charmhub URLs,
+		// but not their channel.
+		ref, err = charm.ParseReference(test.url)
+		if test.channel != "" {
+			c.Assert(err, gc.ErrorMatches, `charmhub URL with channel cannot be parsed as a reference: .*`)
+			c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidChannel)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(ref, gc.DeepEquals, test.ref)
+	}
+}
+
 var codecs = []struct {
 	Marshal   func(interface{}) ([]byte, error)
 	Unmarshal func([]byte, interface{}) error
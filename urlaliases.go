@@ -0,0 +1,182 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/yaml.v1"
+)
+
+// URLAliases maps the charm URLs of renamed or migrated charms to
+// their current URLs, so that long-lived data referring to charms by
+// their old names can still be resolved.
+//
+// Each alias maps a reference, such as cs:~joe/mysql or
+// cs:trusty/mysql-42, to a replacement reference. An alias applies
+// to all URLs with the same schema, user and name as its source, and
+// with the same series and revision if the source specifies them;
+// when several aliases apply, the most specific one is used. The
+// schema, user and name of the URL are replaced by those of the
+// target, as are its series and revision if the target specifies
+// them.
+//
+// A URLAliases value must not be modified while it is being used
+// concurrently.
+type URLAliases struct {
+	// aliases holds the aliases indexed by the
+	// schema, user and name of their sources.
+	aliases map[aliasKey][]urlAlias
+}
+
+type aliasKey struct {
+	schema, user, name string
+}
+
+type urlAlias struct {
+	from, to *Reference
+}
+
+// specificity returns how specific the source of the alias is.
+// Aliases with a series are more specific than aliases without,
+// and aliases with a revision are more specific again.
+func (alias urlAlias) specificity() int {
+	n := 0
+	if alias.from.Series != "" {
+		n += 2
+	}
+	if alias.from.Revision >= 0 {
+		n++
+	}
+	return n
+}
+
+// matches reports whether the alias applies to r.
+func (alias urlAlias) matches(r *Reference) bool {
+	return (alias.from.Series == "" || alias.from.Series == r.Series) &&
+		(alias.from.Revision < 0 || alias.from.Revision == r.Revision)
+}
+
+// NewURLAliases returns an empty set of aliases.
+func NewURLAliases() *URLAliases {
+	return &URLAliases{
+		aliases: make(map[aliasKey][]urlAlias),
+	}
+}
+
+// ReadURLAliases reads a table of aliases in YAML format from r. The
+// table maps each source reference to its target, for example:
+//
+//	cs:~joe/mysql: ch:mysql
+//	cs:trusty/wordpress-3: cs:trusty/wordpress-classic-3
+//
+// References without a schema are assumed to use "cs".
+func ReadURLAliases(r io.Reader) (*URLAliases, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var table map[string]string
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return nil, errorCodef(CodeInvalidAlias, "cannot parse URL aliases: %v", err)
+	}
+	froms := make([]string, 0, len(table))
+	for from := range table {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	aliases := NewURLAliases()
+	for _, from := range froms {
+		if err := aliases.Add(from, table[from]); err != nil {
+			return nil, err
+		}
+	}
+	return aliases, nil
+}
+
+// Add adds an alias from the charm reference from to the reference
+// to. It returns an error if either reference is invalid, if an alias
+// with the same source already exists, or if the alias would make
+// the source refer back to itself.
+func (a *URLAliases) Add(from, to string) error {
+	fromRef, err := ParseReference(from)
+	if err != nil {
+		return annotateCodef(CodeInvalidAlias, err, "invalid URL alias source: %v", err)
+	}
+	toRef, err := ParseReference(to)
+	if err != nil {
+		return annotateCodef(CodeInvalidAlias, err, "invalid URL alias target: %v", err)
+	}
+	key := aliasKey{fromRef.Schema, fromRef.User, fromRef.Name}
+	for _, alias := range a.aliases[key] {
+		if *alias.from == *fromRef {
+			return errorCodef(CodeInvalidAlias, "URL alias for %q already defined", fromRef)
+		}
+	}
+	alias := urlAlias{fromRef, toRef}
+	a.aliases[key] = append(a.aliases[key], alias)
+	if _, ok := a.rewrite(fromRef); !ok {
+		a.aliases[key] = a.aliases[key][:len(a.aliases[key])-1]
+		return errorCodef(CodeInvalidAlias, "URL alias from %q to %q creates a cycle", fromRef, toRef)
+	}
+	return nil
+}
+
+// Rewrite returns the current URL for the charm with the given URL,
+// following aliases to aliased targets as necessary. It returns u
+// itself if no alias applies.
+func (a *URLAliases) Rewrite(u *URL) *URL {
+	r, _ := a.rewrite(u.Reference())
+	return (*URL)(r)
+}
+
+// RewriteReference is like Rewrite but operates on references,
+// which may not specify a series.
+func (a *URLAliases) RewriteReference(r *Reference) *Reference {
+	r, _ = a.rewrite(r)
+	return r
+}
+
+// rewrite applies the aliases to r until none applies. It reports
+// whether that happened without applying the same alias twice; if it
+// did not, the reference is returned as it was when the cycle was
+// found.
+func (a *URLAliases) rewrite(r *Reference) (*Reference, bool) {
+	seen := make(map[Reference]bool)
+	for {
+		alias, ok := a.lookup(r)
+		if !ok {
+			return r, true
+		}
+		if seen[*alias.from] {
+			return r, false
+		}
+		seen[*alias.from] = true
+		next := *r
+		next.Schema = alias.to.Schema
+		next.User = alias.to.User
+		next.Name = alias.to.Name
+		if alias.to.Series != "" {
+			next.Series = alias.to.Series
+		}
+		if alias.to.Revision >= 0 {
+			next.Revision = alias.to.Revision
+		}
+		r = &next
+	}
+}
+
+// lookup returns the most specific alias that applies to r.
+func (a *URLAliases) lookup(r *Reference) (urlAlias, bool) {
+	var best urlAlias
+	found := false
+	for _, alias := range a.aliases[aliasKey{r.Schema, r.User, r.Name}] {
+		if alias.matches(r) && (!found || alias.specificity() > best.specificity()) {
+			best, found = alias, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type URLAliasesSuite struct{}
+
+var _ = gc.Suite(&URLAliasesSuite{})
+
+const aliasTable = `
+cs:~joe/mysql: ch:mysql
+cs:trusty/wordpress: cs:trusty/wordpress-classic
+cs:trusty/wordpress-3: cs:trusty/wordpress-legacy-1
+cs:wordpress-classic: ch:wordpress-classic
+old-name: cs:new-name
+cs:new-name: cs:newer-name
+`
+
+var rewriteTests = []struct {
+	url    string
+	expect string
+}{{
+	url:    "cs:~joe/trusty/mysql-5",
+	expect: "ch:trusty/mysql-5",
+}, {
+	url:    "cs:~bob/trusty/mysql-5",
+	expect: "cs:~bob/trusty/mysql-5",
+}, {
+	// Aliases are followed through to the end.
+	url:    "cs:trusty/wordpress-2",
+	expect: "ch:trusty/wordpress-classic-2",
+}, {
+	// The most specific alias wins.
+	url:    "cs:trusty/wordpress-3",
+	expect: "cs:trusty/wordpress-legacy-1",
+}, {
+	// The series of the alias source must match.
+	url:    "cs:precise/wordpress-2",
+	expect: "cs:precise/wordpress-2",
+}, {
+	url:    "cs:precise/old-name-7",
+	expect: "cs:precise/newer-name-7",
+}, {
+	url:    "local:precise/old-name-7",
+	expect: "local:precise/old-name-7",
+}}
+
+func (s *URLAliasesSuite) TestRewrite(c *gc.C) {
+	aliases, err := charm.ReadURLAliases(strings.NewReader(aliasTable))
+	c.Assert(err, gc.IsNil)
+	for i, test := range rewriteTests {
+		c.Logf("test %d: %s", i, test.url)
+		u := charm.MustParseURL(test.url)
+		got := aliases.Rewrite(u)
+		c.Assert(got.String(), gc.Equals, test.expect)
+		if test.url == test.expect {
+			c.Assert(got, gc.Equals, u)
+		}
+	}
+}
+
+func (s *URLAliasesSuite) TestRewriteReference(c *gc.C) {
+	aliases, err := charm.ReadURLAliases(strings.NewReader(aliasTable))
+	c.Assert(err, gc.IsNil)
+	ref := charm.MustParseReference("cs:~joe/mysql")
+	c.Assert(aliases.RewriteReference(ref).String(), gc.Equals, "ch:mysql")
+}
+
+func (s *URLAliasesSuite) TestAddErrors(c *gc.C) {
+	aliases := charm.NewURLAliases()
+	err := aliases.Add("cs:~joe/mysql", "ch:mysql")
+	c.Assert(err, gc.IsNil)
+
+	err = aliases.Add("cs:~joe/mysql", "ch:mariadb")
+	c.Assert(err, gc.ErrorMatches, `URL alias for "cs:~joe/mysql" already defined`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidAlias)
+
+	err = aliases.Add("bad:mysql", "ch:mysql")
+	c.Assert(err, gc.ErrorMatches, `invalid URL alias source: charm URL has invalid schema: "bad:mysql"`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidSchema)
+
+	err = aliases.Add("cs:mysql", "ch:~joe/mysql")
+	c.Assert(err, gc.ErrorMatches, `invalid URL alias target: charmhub charm URL with user name: "ch:~joe/mysql"`)
+
+	err = aliases.Add("ch:mysql", "cs:~joe/mysql")
+	c.Assert(err, gc.ErrorMatches, `URL alias from "ch:mysql" to "cs:~joe/mysql" creates a cycle`)
+
+	// The failed alias was not added.
+	c.Assert(aliases.Rewrite(charm.MustParseURL("ch:trusty/mysql")).String(), gc.Equals, "ch:trusty/mysql")
+}
+
+func (s *URLAliasesSuite) TestReadURLAliasesError(c *gc.C) {
+	_, err := charm.ReadURLAliases(strings.NewReader("{unclosed"))
+	c.Assert(err, gc.ErrorMatches, `cannot parse URL aliases: .*`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInvalidAlias)
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"strings"
+)
+
+// TwoPartPreference states how the first part of a reference with two
+// path parts and no user, such as "trusty/mysql", is interpreted.
+type TwoPartPreference int
+
+const (
+	// PreferSeries interprets the first part as the series,
+	// as ParseReference does: "trusty/mysql" is the mysql
+	// charm for the trusty series.
+	PreferSeries TwoPartPreference = iota
+
+	// PreferUser interprets the first part as the user:
+	// "joe/mysql" is the same as "~joe/mysql". Local and
+	// charmhub charm URLs have no user, so the series is
+	// always preferred for them.
+	PreferUser
+)
+
+// ParseOptions holds options for ParseReferenceWithOptions.
+type ParseOptions struct {
+	// TwoPart holds how references with two path parts
+	// and no user are interpreted.
+	TwoPart TwoPartPreference
+
+	// Disambiguate, if not nil, is called with the two path parts
+	// of such references, and returns how the reference is
+	// interpreted, overriding TwoPart.
+	Disambiguate func(first, second string) TwoPartPreference
+}
+
+// ParseReferenceWithOptions is like ParseReferenceWithWarnings, but
+// lets the caller choose how references with two path parts and no
+// user are interpreted. Such references are ambiguous: "mysql/trusty"
+// is parsed as the trusty charm for the mysql series when the series
+// is preferred. When the chosen interpretation looks wrong, because
+// the part taken as the series is not a known series or the part
+// taken as the user is, a warning with the CodeAmbiguousURL code
+// is returned.
+func ParseReferenceWithOptions(url string, opts ParseOptions) (*Reference, []Warning, error) {
+	prefix, first, second, ok := twoPartPath(url)
+	if !ok {
+		return ParseReferenceWithWarnings(url)
+	}
+	pref := opts.TwoPart
+	if opts.Disambiguate != nil {
+		pref = opts.Disambiguate(first, second)
+	}
+	if prefix == "local:" || prefix == "ch:" {
+		pref = PreferSeries
+	}
+	src := url
+	if pref == PreferUser {
+		src = prefix + "~" + first + "/" + second
+	}
+	ref, err := ParseReference(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []Warning
+	if prefix == "" {
+		warnings = append(warnings, warningf(CodeImplicitSchema, "charm URL %q has no schema; assuming %q", url, ref.Schema))
+	}
+	_, err = SeriesOS(first)
+	firstIsSeries := err == nil
+	switch {
+	case pref == PreferSeries && !firstIsSeries:
+		warnings = append(warnings, warningf(CodeAmbiguousURL, "charm URL %q is ambiguous: %q is not a known series but is taken as the series", url, first))
+	case pref == PreferUser && firstIsSeries:
+		warnings = append(warnings, warningf(CodeAmbiguousURL, "charm URL %q is ambiguous: %q is a known series but is taken as the user", url, first))
+	}
+	return ref, warnings, nil
+}
+
+// twoPartPath returns the schema prefix, such as "cs:", and the path
+// parts of url if it is a reference with two path parts and no user.
+// Charmhub URLs are never such references.
+func twoPartPath(url string) (prefix, first, second string, ok bool) {
+	if isCharmHubURL(url) {
+		return "", "", "", false
+	}
+	path := url
+	if i := strings.Index(url, ":"); i >= 0 {
+		prefix, path = url[:i+1], url[i+1:]
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || strings.HasPrefix(parts[0], "~") {
+		return "", "", "", false
+	}
+	return prefix, parts[0], parts[1], true
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type URLAmbiguitySuite struct{}
+
+var _ = gc.Suite(&URLAmbiguitySuite{})
+
+var parseReferenceWithOptionsTests = []struct {
+	src      string
+	opts     charm.ParseOptions
+	expect   string
+	warnings []string
+	err      string
+}{{
+	src:    "cs:trusty/mysql",
+	expect: "cs:trusty/mysql",
+}, {
+	src:      "cs:mysql/trusty",
+	expect:   "cs:mysql/trusty",
+	warnings: []string{`ambiguous-url: charm URL "cs:mysql/trusty" is ambiguous: "mysql" is not a known series but is taken as the series`},
+}, {
+	src:    "cs:joe/mysql",
+	opts:   charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect: "cs:~joe/mysql",
+}, {
+	src:      "cs:trusty/mysql-2",
+	opts:     charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect:   "cs:~trusty/mysql-2",
+	warnings: []string{`ambiguous-url: charm URL "cs:trusty/mysql-2" is ambiguous: "trusty" is a known series but is taken as the user`},
+}, {
+	src:    "joe/mysql",
+	opts:   charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect: "cs:~joe/mysql",
+	warnings: []string{
+		`implicit-schema: charm URL "joe/mysql" has no schema; assuming "cs"`,
+	},
+}, {
+	src: "cs:joe/mysql",
+	opts: charm.ParseOptions{
+		Disambiguate: func(first, second string) charm.TwoPartPreference {
+			if first == "joe" {
+				return charm.PreferUser
+			}
+			return charm.PreferSeries
+		},
+	},
+	expect: "cs:~joe/mysql",
+}, {
+	src:    "cs:~joe/mysql",
+	opts:   charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect: "cs:~joe/mysql",
+}, {
+	src:    "local:trusty/mysql",
+	opts:   charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect: "local:trusty/mysql",
+}, {
+	src:      "local:joe/mysql",
+	opts:     charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect:   "local:joe/mysql",
+	warnings: []string{`ambiguous-url: charm URL "local:joe/mysql" is ambiguous: "joe" is not a known series but is taken as the series`},
+}, {
+	src:    "ch:trusty/mysql",
+	opts:   charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect: "ch:trusty/mysql",
+}, {
+	src: "ch:trusty/mysql",
+	opts: charm.ParseOptions{
+		Disambiguate: func(first, second string) charm.TwoPartPreference {
+			return charm.PreferUser
+		},
+	},
+	expect: "ch:trusty/mysql",
+}, {
+	src:    "cs:noble/mysql",
+	expect: "cs:noble/mysql",
+}, {
+	src:    "cs:resolute/mysql",
+	expect: "cs:resolute/mysql",
+}, {
+	src:      "cs:oracular/mysql",
+	opts:     charm.ParseOptions{TwoPart: charm.PreferUser},
+	expect:   "cs:~oracular/mysql",
+	warnings: []string{`ambiguous-url: charm URL "cs:oracular/mysql" is ambiguous: "oracular" is a known series but is taken as the user`},
+}}
+
+func (s *URLAmbiguitySuite) TestParseReferenceWithOptions(c *gc.C) {
+	for i, test := range parseReferenceWithOptionsTests {
+		c.Logf("test %d: %s", i, test.src)
+		ref, warnings, err := charm.ParseReferenceWithOptions(test.src, test.opts)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(ref.String(), gc.Equals, test.expect)
+		var got []string
+		for _, w := range warnings {
+			got = append(got, w.Code+": "+w.Message)
+		}
+		c.Assert(got, gc.DeepEquals, test.warnings)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build mongodriver
+// +build mongodriver
+
+package charm
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// The methods in this file let URLs and references be stored with the
+// official MongoDB driver, as GetBSON and SetBSON do for mgo. Both
+// drivers store them as strings, so either may read documents written
+// by the other. So that the driver is not a dependency of every user
+// of this package, they are only built with the mongodriver build tag.
+
+// MarshalBSONValue implements bson.ValueMarshaler.
+func (u *URL) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if u == nil {
+		return bsontype.Null, nil, nil
+	}
+	return bsontype.String, bsoncore.AppendString(nil, u.String()), nil
+}
+
+// UnmarshalBSONValue implements bson.ValueUnmarshaler. A null or
+// undefined value leaves u as the zero URL.
+func (u *URL) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	s, ok, err := unmarshalBSONString(t, data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		*u = URL{}
+		return nil
+	}
+	url, err := ParseURL(s)
+	if err != nil {
+		return err
+	}
+	*u = *url
+	return nil
+}
+
+// MarshalBSONValue implements bson.ValueMarshaler.
+func (r *Reference) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if r == nil {
+		return bsontype.Null, nil, nil
+	}
+	return bsontype.String, bsoncore.AppendString(nil, r.String()), nil
+}
+
+// UnmarshalBSONValue implements bson.ValueUnmarshaler. A null or
+// undefined value leaves r as the zero Reference.
+func (r *Reference) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	s, ok, err := unmarshalBSONString(t, data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		*r = Reference{}
+		return nil
+	}
+	ref, err := ParseReference(s)
+	if err != nil {
+		return err
+	}
+	*r = *ref
+	return nil
+}
+
+// unmarshalBSONString returns the string held in the given BSON
+// value. It returns false if the value is null or undefined.
+func unmarshalBSONString(t bsontype.Type, data []byte) (string, bool, error) {
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		return "", false, nil
+	case bsontype.String:
+	default:
+		return "", false, fmt.Errorf("cannot unmarshal BSON %s into charm URL", t)
+	}
+	s, _, ok := bsoncore.ReadString(data)
+	if !ok {
+		return "", false, fmt.Errorf("cannot unmarshal charm URL: invalid BSON string")
+	}
+	return s, true, nil
+}
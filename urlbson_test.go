@@ -0,0 +1,65 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build mongodriver
+// +build mongodriver
+
+package charm_test
+
+import (
+	mongobson "go.mongodb.org/mongo-driver/bson"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+func init() {
+	codecs = append(codecs, struct {
+		Marshal   func(interface{}) ([]byte, error)
+		Unmarshal func([]byte, interface{}) error
+	}{
+		Marshal:   mongobson.Marshal,
+		Unmarshal: mongobson.Unmarshal,
+	})
+}
+
+func (s *URLSuite) TestMongoDriverBSONInterop(c *gc.C) {
+	// Documents written with mgo can be read with the
+	// official driver, and vice versa.
+	type doc struct {
+		URL *charm.URL       `bson:"url"`
+		Ref *charm.Reference `bson:"ref"`
+	}
+	url := charm.MustParseURL("cs:~joe/trusty/wordpress-42")
+	v0 := doc{url, charm.MustParseReference("cs:wordpress")}
+
+	data, err := bson.Marshal(v0)
+	c.Assert(err, gc.IsNil)
+	var v doc
+	err = mongobson.Unmarshal(data, &v)
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.DeepEquals, v0)
+
+	data, err = mongobson.Marshal(v0)
+	c.Assert(err, gc.IsNil)
+	v = doc{}
+	err = bson.Unmarshal(data, &v)
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.DeepEquals, v0)
+}
+
+func (s *URLSuite) TestMongoDriverBSONErrors(c *gc.C) {
+	type doc struct {
+		URL *charm.URL `bson:"url"`
+	}
+	data, err := mongobson.Marshal(map[string]interface{}{"url": 42})
+	c.Assert(err, gc.IsNil)
+	err = mongobson.Unmarshal(data, new(doc))
+	c.Assert(err, gc.ErrorMatches, `.*cannot unmarshal BSON 32-bit integer into charm URL`)
+
+	data, err = mongobson.Marshal(map[string]interface{}{"url": "cs:~_~/bad"})
+	c.Assert(err, gc.IsNil)
+	err = mongobson.Unmarshal(data, new(doc))
+	c.Assert(err, gc.ErrorMatches, `.*charm URL has invalid user name.*`)
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// URLValue implements flag.Value for a charm URL given on the command
+// line, so that command line tools need not write their own adapter.
+// It also implements the Type method required by pflag.Value.
+//
+// For example:
+//
+//	var curl charm.URLValue
+//	flag.Var(&curl, "charm", "the charm to deploy")
+type URLValue struct {
+	// URL holds the URL parsed from the flag,
+	// or nil if the flag was not given.
+	URL *URL
+
+	// Resolver, if not nil, is used to resolve references
+	// that are not fully qualified URLs, such as "wordpress".
+	// If it is nil, the flag must hold a URL that ParseURL
+	// accepts.
+	Resolver *Resolver
+}
+
+// Set implements flag.Value.Set.
+func (v *URLValue) Set(s string) error {
+	url, err := v.parse(s)
+	if err != nil {
+		return err
+	}
+	v.URL = url
+	return nil
+}
+
+// String implements flag.Value.String. It returns
+// the empty string if the URL has not been set.
+func (v *URLValue) String() string {
+	if v == nil || v.URL == nil {
+		return ""
+	}
+	return v.URL.String()
+}
+
+// Type implements pflag.Value.Type.
+func (v *URLValue) Type() string {
+	return "charm-url"
+}
+
+// parse parses s as a charm URL, resolving it with
+// v.Resolver if it is not nil.
+func (v *URLValue) parse(s string) (*URL, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errorCodef(CodeMissingName, "empty charm URL")
+	}
+	if v.Resolver == nil {
+		return ParseURL(s)
+	}
+	url, _, err := v.Resolver.Resolve(s)
+	return url, err
+}
+
+// URLSliceValue implements flag.Value for a list of charm URLs given
+// on the command line, either by repeating the flag or as a
+// comma-separated list. It also implements the methods required by
+// pflag.Value and pflag.SliceValue.
+type URLSliceValue struct {
+	// URLs holds the URLs parsed from the flags,
+	// in the order they were given.
+	URLs []*URL
+
+	// Resolver, if not nil, is used to resolve references
+	// that are not fully qualified URLs, as for URLValue.
+	Resolver *Resolver
+}
+
+// Set implements flag.Value.Set by appending the URLs in the
+// comma-separated list s. No URL is appended if any is invalid.
+func (v *URLSliceValue) Set(s string) error {
+	urls, err := v.parse(strings.Split(s, ","))
+	if err != nil {
+		return err
+	}
+	v.URLs = append(v.URLs, urls...)
+	return nil
+}
+
+// String implements flag.Value.String by returning
+// the URLs as a comma-separated list.
+func (v *URLSliceValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(v.GetSlice(), ",")
+}
+
+// Type implements pflag.Value.Type.
+func (v *URLSliceValue) Type() string {
+	return "charm-urls"
+}
+
+// Append implements pflag.SliceValue.Append
+// by appending the single URL s.
+func (v *URLSliceValue) Append(s string) error {
+	urls, err := v.parse([]string{s})
+	if err != nil {
+		return err
+	}
+	v.URLs = append(v.URLs, urls...)
+	return nil
+}
+
+// Replace implements pflag.SliceValue.Replace by replacing the URLs
+// with those in ss. The URLs are left unchanged if any is invalid.
+func (v *URLSliceValue) Replace(ss []string) error {
+	urls, err := v.parse(ss)
+	if err != nil {
+		return err
+	}
+	v.URLs = urls
+	return nil
+}
+
+// GetSlice implements pflag.SliceValue.GetSlice.
+func (v *URLSliceValue) GetSlice() []string {
+	ss := make([]string, len(v.URLs))
+	for i, url := range v.URLs {
+		ss[i] = url.String()
+	}
+	return ss
+}
+
+// parse parses each of ss as a charm URL. The error
+// returned for an invalid URL includes its position.
+func (v *URLSliceValue) parse(ss []string) ([]*URL, error) {
+	single := URLValue{Resolver: v.Resolver}
+	urls := make([]*URL, len(ss))
+	for i, s := range ss {
+		url, err := single.parse(s)
+		if err != nil {
+			if len(ss) == 1 {
+				return nil, err
+			}
+			return nil, &urlListError{index: i, err: err}
+		}
+		urls[i] = url
+	}
+	return urls, nil
+}
+
+// urlListError is returned for an invalid URL in a list. It preserves
+// the code of the error returned when parsing the URL.
+type urlListError struct {
+	index int
+	err   error
+}
+
+func (err *urlListError) Error() string {
+	return fmt.Sprintf("URL #%d: %v", err.index+1, err.err)
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (err *urlListError) ErrorCode() string {
+	return ErrorCode(err.err)
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"flag"
+	"io/ioutil"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type URLFlagSuite struct{}
+
+var _ = gc.Suite(&URLFlagSuite{})
+
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+func (s *URLFlagSuite) TestURLValue(c *gc.C) {
+	var v charm.URLValue
+	c.Assert(v.String(), gc.Equals, "")
+	c.Assert(v.Type(), gc.Equals, "charm-url")
+	fs := newFlagSet()
+	fs.Var(&v, "charm", "")
+	err := fs.Parse([]string{"-charm", "cs:trusty/wordpress-3"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(v.URL, jc.DeepEquals, charm.MustParseURL("cs:trusty/wordpress-3"))
+	c.Assert(v.String(), gc.Equals, "cs:trusty/wordpress-3")
+}
+
+func (s *URLFlagSuite) TestURLValueErrors(c *gc.C) {
+	var v charm.URLValue
+	fs := newFlagSet()
+	fs.Var(&v, "charm", "")
+	err := fs.Parse([]string{"-charm", "cs:wordpress"})
+	c.Assert(err, gc.ErrorMatches, `invalid value "cs:wordpress" for flag -charm: charm url series is not resolved`)
+	c.Assert(v.URL, gc.IsNil)
+
+	err = v.Set(" ")
+	c.Assert(err, gc.ErrorMatches, `empty charm URL`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeMissingName)
+}
+
+func (s *URLFlagSuite) TestURLValueResolver(c *gc.C) {
+	v := charm.URLValue{
+		Resolver: &charm.Resolver{DefaultSeries: "trusty"},
+	}
+	err := v.Set("wordpress")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v.String(), gc.Equals, "cs:trusty/wordpress")
+}
+
+func (s *URLFlagSuite) TestURLSliceValue(c *gc.C) {
+	var v charm.URLSliceValue
+	c.Assert(v.Type(), gc.Equals, "charm-urls")
+	fs := newFlagSet()
+	fs.Var(&v, "charm", "")
+	err := fs.Parse([]string{"-charm", "cs:trusty/wordpress,cs:trusty/mysql-2", "-charm", "local:precise/logging"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(v.GetSlice(), jc.DeepEquals, []string{
+		"cs:trusty/wordpress",
+		"cs:trusty/mysql-2",
+		"local:precise/logging",
+	})
+	c.Assert(v.String(), gc.Equals, "cs:trusty/wordpress,cs:trusty/mysql-2,local:precise/logging")
+
+	err = v.Append("cs:trusty/varnish")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v.URLs, gc.HasLen, 4)
+
+	err = v.Replace([]string{"cs:trusty/haproxy"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(v.GetSlice(), jc.DeepEquals, []string{"cs:trusty/haproxy"})
+}
+
+func (s *URLFlagSuite) TestURLSliceValueErrors(c *gc.C) {
+	v := charm.URLSliceValue{
+		Resolver: &charm.Resolver{DefaultSeries: "trusty"},
+	}
+	err := v.Set("wordpress,,mysql")
+	c.Assert(err, gc.ErrorMatches, `URL #2: empty charm URL`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeMissingName)
+	c.Assert(v.URLs, gc.HasLen, 0)
+
+	err = v.Replace([]string{"wordpress", "cs:~bad user/mysql"})
+	c.Assert(err, gc.ErrorMatches, `URL #2: .*`)
+	c.Assert(v.URLs, gc.HasLen, 0)
+
+	err = v.Set("wordpress")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v.String(), gc.Equals, "cs:trusty/wordpress")
+}
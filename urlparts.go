@@ -0,0 +1,97 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"encoding/json"
+)
+
+// URLParts holds the components of a charm URL as separate fields,
+// for APIs that need charm URLs decomposed rather than as strings.
+// Its JSON form looks like:
+//
+//	{"schema": "cs", "user": "joe", "name": "wordpress", "series": "trusty", "revision": 42}
+type URLParts struct {
+	Schema string `json:"schema"`
+	User   string `json:"user,omitempty"`
+	Name   string `json:"name"`
+	Series string `json:"series"`
+
+	// Revision holds the revision of the charm,
+	// or -1 if the URL does not specify one.
+	Revision int `json:"revision"`
+}
+
+// Parts returns the components of u.
+func (u *URL) Parts() URLParts {
+	return URLParts{
+		Schema:   u.Schema,
+		User:     u.User,
+		Name:     u.Name,
+		Series:   u.Series,
+		Revision: u.Revision,
+	}
+}
+
+// URL returns the charm URL made from the components in p. The
+// components are validated as they are by ParseURL, and an error is
+// returned if they do not form a valid URL.
+func (p URLParts) URL() (*URL, error) {
+	if p.Schema == "" {
+		return nil, errorCodef(CodeMissingSchema, "charm URL parts have no schema")
+	}
+	if p.Revision < -1 {
+		return nil, errorCodef(CodeBadRevision, "charm URL parts have invalid revision %d", p.Revision)
+	}
+	u := &URL{
+		Schema:   p.Schema,
+		User:     p.User,
+		Name:     p.Name,
+		Series:   p.Series,
+		Revision: p.Revision,
+	}
+	// Check that the parts survive a round trip through the string
+	// form, which catches empty or malformed components.
+	parsed, err := ParseURL(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if *parsed != *u {
+		return nil, errorCodef(CodeInvalidForm, "charm URL parts do not form a valid URL: %q", u)
+	}
+	return parsed, nil
+}
+
+// StructuredURL wraps a charm URL so that it is marshaled to and from
+// JSON as a URLParts object rather than as a string.
+type StructuredURL struct {
+	*URL
+}
+
+// MarshalJSON implements json.Marshaler.
+func (u StructuredURL) MarshalJSON() ([]byte, error) {
+	if u.URL == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(u.URL.Parts())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (u *StructuredURL) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		u.URL = nil
+		return nil
+	}
+	// Unset revisions are omitted by some producers.
+	p := URLParts{Revision: -1}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	url, err := p.URL()
+	if err != nil {
+		return err
+	}
+	u.URL = url
+	return nil
+}
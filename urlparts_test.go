@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type URLPartsSuite struct{}
+
+var _ = gc.Suite(&URLPartsSuite{})
+
+func (s *URLPartsSuite) TestRoundTrip(c *gc.C) {
+	for i, str := range []string{
+		"cs:~joe/trusty/wordpress-42",
+		"cs:trusty/wordpress",
+		"cs:precise/mysql-0",
+		"local:quantal/dummy-1",
+		"ch:focal/postgresql",
+	} {
+		c.Logf("test %d: %s", i, str)
+		u := charm.MustParseURL(str)
+		got, err := u.Parts().URL()
+		c.Assert(err, gc.IsNil)
+		c.Assert(got, jc.DeepEquals, u)
+
+		data, err := json.Marshal(charm.StructuredURL{URL: u})
+		c.Assert(err, gc.IsNil)
+		var su charm.StructuredURL
+		err = json.Unmarshal(data, &su)
+		c.Assert(err, gc.IsNil)
+		c.Assert(su.URL, jc.DeepEquals, u)
+	}
+}
+
+func (s *URLPartsSuite) TestMarshalJSON(c *gc.C) {
+	type doc struct {
+		URL charm.StructuredURL `json:"url"`
+	}
+	data, err := json.Marshal(doc{charm.StructuredURL{URL: charm.MustParseURL("cs:~joe/trusty/wordpress-42")}})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{"url":{"schema":"cs","user":"joe","name":"wordpress","series":"trusty","revision":42}}`)
+
+	data, err = json.Marshal(doc{charm.StructuredURL{URL: charm.MustParseURL("cs:trusty/wordpress")}})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{"url":{"schema":"cs","name":"wordpress","series":"trusty","revision":-1}}`)
+
+	data, err = json.Marshal(doc{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{"url":null}`)
+	var d doc
+	err = json.Unmarshal(data, &d)
+	c.Assert(err, gc.IsNil)
+	c.Assert(d.URL.URL, gc.IsNil)
+}
+
+func (s *URLPartsSuite) TestUnmarshalJSONWithoutRevision(c *gc.C) {
+	var su charm.StructuredURL
+	err := json.Unmarshal([]byte(`{"schema":"cs","name":"wordpress","series":"trusty"}`), &su)
+	c.Assert(err, gc.IsNil)
+	c.Assert(su.URL, jc.DeepEquals, charm.MustParseURL("cs:trusty/wordpress"))
+}
+
+var badURLPartsTests = []struct {
+	parts      charm.URLParts
+	expectErr  string
+	expectCode string
+}{{
+	parts:      charm.URLParts{Name: "wordpress", Series: "trusty", Revision: -1},
+	expectErr:  `charm URL parts have no schema`,
+	expectCode: charm.CodeMissingSchema,
+}, {
+	parts:      charm.URLParts{Schema: "cs", Name: "wordpress", Revision: -1},
+	expectErr:  `charm url series is not resolved`,
+	expectCode: charm.CodeUnresolvedSeries,
+}, {
+	parts:      charm.URLParts{Schema: "cs", Name: "wordpress", Series: "trusty", Revision: -2},
+	expectErr:  `charm URL parts have invalid revision -2`,
+	expectCode: charm.CodeBadRevision,
+}, {
+	parts:      charm.URLParts{Schema: "cs", Name: "wordpress-3", Series: "trusty", Revision: -1},
+	expectErr:  `charm URL parts do not form a valid URL: "cs:trusty/wordpress-3"`,
+	expectCode: charm.CodeInvalidForm,
+}, {
+	parts:      charm.URLParts{Schema: "cs", Name: "word/press", Series: "trusty", Revision: -1},
+	expectErr:  `charm URL has invalid form: .*`,
+	expectCode: charm.CodeInvalidForm,
+}, {
+	parts:      charm.URLParts{Schema: "local", User: "joe", Name: "wordpress", Series: "trusty", Revision: -1},
+	expectErr:  `local charm URL with user name: .*`,
+	expectCode: charm.CodeUserNotAllowed,
+}}
+
+func (s *URLPartsSuite) TestBadParts(c *gc.C) {
+	for i, test := range badURLPartsTests {
+		c.Logf("test %d: %#v", i, test.parts)
+		_, err := test.parts.URL()
+		c.Assert(err, gc.ErrorMatches, test.expectErr)
+		c.Assert(charm.ErrorCode(err), gc.Equals, test.expectCode)
+	}
+	var su charm.StructuredURL
+	err := json.Unmarshal([]byte(`{"schema":"cs","name":"wordpress"}`), &su)
+	c.Assert(err, gc.ErrorMatches, `charm url series is not resolved`)
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Grammar identifies a syntax of charm references.
+type Grammar string
+
+const (
+	// GrammarV1 is the syntax of charm store URLs and their
+	// abbreviations, as listed by ParseReference:
+	// [schema:][~user/][series/]name[-revision].
+	GrammarV1 Grammar = "v1"
+
+	// GrammarV2Web is the syntax of charmhub.io browse
+	// URLs, as accepted by ParseCharmHubURL.
+	GrammarV2Web Grammar = "v2-web"
+)
+
+// Provenance describes how a charm reference was parsed
+// by ParseURLVerbose.
+type Provenance struct {
+	// Grammar holds the syntax the reference was parsed with.
+	Grammar Grammar
+
+	// Specified holds the fields of the reference specified by the
+	// input, in the order they appear in the reference: some of
+	// "schema", "user", "series", "name" and "revision".
+	Specified []string
+
+	// Defaulted holds the fields of the reference that were not
+	// specified by the input but given a default value. Fields in
+	// neither Specified nor Defaulted are unset.
+	Defaulted []InferenceStep
+
+	// Discarded holds the parts of the input that
+	// were parsed but are not part of the reference,
+	// such as the channel of a charmhub.io URL.
+	Discarded []string
+}
+
+// String returns a human readable description of p,
+// such as:
+//
+//	v1 grammar; specified series, name; inferred schema "cs"
+func (p *Provenance) String() string {
+	parts := []string{fmt.Sprintf("%s grammar", p.Grammar)}
+	if len(p.Specified) > 0 {
+		parts = append(parts, "specified "+strings.Join(p.Specified, ", "))
+	}
+	for _, step := range p.Defaulted {
+		parts = append(parts, step.String())
+	}
+	if len(p.Discarded) > 0 {
+		parts = append(parts, "discarded "+strings.Join(p.Discarded, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ParseURLVerbose parses src as ParseReference does, and also returns
+// a description of how it was parsed, to help understand the parsing
+// of ambiguous input. For instance, the provenance of "mysql/trusty"
+// shows that "mysql" was taken as the series and "trusty" as the name.
+// Unlike ParseReference, it accepts charmhub.io URLs with a channel,
+// reporting the channel as discarded.
+func ParseURLVerbose(src string) (*Reference, *Provenance, error) {
+	if isCharmHubURL(src) {
+		ref, channel, err := ParseCharmHubURL(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		p := &Provenance{
+			Grammar:   GrammarV2Web,
+			Specified: []string{"name"},
+			Defaulted: []InferenceStep{{"schema", ref.Schema}},
+		}
+		if channel != (Channel{}) {
+			p.Discarded = append(p.Discarded, "channel")
+		}
+		return ref, p, nil
+	}
+	ref, err := parseReference(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &Provenance{
+		Grammar: GrammarV1,
+	}
+	if ref.Schema != "" {
+		p.Specified = append(p.Specified, "schema")
+	}
+	if ref.User != "" {
+		p.Specified = append(p.Specified, "user")
+	}
+	if ref.Series != "" {
+		p.Specified = append(p.Specified, "series")
+	}
+	p.Specified = append(p.Specified, "name")
+	if ref.Revision != -1 {
+		p.Specified = append(p.Specified, "revision")
+	}
+	if ref.Schema == "" {
+		ref.Schema = "cs"
+		p.Defaulted = append(p.Defaulted, InferenceStep{"schema", ref.Schema})
+	}
+	return ref, p, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type URLProvenanceSuite struct{}
+
+var _ = gc.Suite(&URLProvenanceSuite{})
+
+var parseURLVerboseTests = []struct {
+	src        string
+	expect     string
+	provenance string
+	err        string
+}{{
+	src:        "cs:~joe/trusty/mysql-3",
+	expect:     "cs:~joe/trusty/mysql-3",
+	provenance: `v1 grammar; specified schema, user, series, name, revision`,
+}, {
+	src:        "mysql",
+	expect:     "cs:mysql",
+	provenance: `v1 grammar; specified name; inferred schema "cs"`,
+}, {
+	src:        "mysql/trusty",
+	expect:     "cs:mysql/trusty",
+	provenance: `v1 grammar; specified series, name; inferred schema "cs"`,
+}, {
+	src:        "local:wordpress-2",
+	expect:     "local:wordpress-2",
+	provenance: `v1 grammar; specified schema, name, revision`,
+}, {
+	src:        "https://charmhub.io/wordpress?channel=edge",
+	expect:     "ch:wordpress",
+	provenance: `v2-web grammar; specified name; inferred schema "ch"; discarded channel`,
+}, {
+	src: "cs:~joe/x/y/z",
+	err: `charm URL has invalid form: "cs:~joe/x/y/z"`,
+}}
+
+func (s *URLProvenanceSuite) TestParseURLVerbose(c *gc.C) {
+	for i, test := range parseURLVerboseTests {
+		c.Logf("test %d: %s", i, test.src)
+		ref, p, err := charm.ParseURLVerbose(test.src)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(ref.String(), gc.Equals, test.expect)
+		c.Assert(p.String(), gc.Equals, test.provenance)
+
+		// The reference is the one returned by ParseReference.
+		expect, err := charm.ParseReference(test.src)
+		c.Assert(err, gc.IsNil)
+		c.Assert(ref, jc.DeepEquals, expect)
+	}
+}
+
+func (s *URLProvenanceSuite) TestProvenanceFields(c *gc.C) {
+	_, p, err := charm.ParseURLVerbose("trusty/mysql")
+	c.Assert(err, gc.IsNil)
+	c.Assert(p, jc.DeepEquals, &charm.Provenance{
+		Grammar:   charm.GrammarV1,
+		Specified: []string{"series", "name"},
+		Defaulted: []charm.InferenceStep{{"schema", "cs"}},
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"regexp"
+	"strings"
+)
+
+// URLFormat holds the name of the JSON Schema and OpenAPI
+// string format used for charm URLs.
+const URLFormat = "charm-url"
+
+// URLPattern holds a regular expression matching fully resolved charm
+// URLs, suitable for use with the JSON Schema and OpenAPI "pattern"
+// keyword. It is derived from the rules used by ParseURL, although
+// user names are only checked approximately.
+var URLPattern = "^(cs:(~" + validUserSnippet + "/)?|ch:|local:)" +
+	unanchored(validSeries) + "/" +
+	unanchored(validName) + "(-[0-9]+)?$"
+
+// validUserSnippet matches the user names
+// accepted by names.IsValidUser.
+const validUserSnippet = "[a-zA-Z0-9][a-zA-Z0-9.+-]*[a-zA-Z0-9]"
+
+var validURLPattern = regexp.MustCompile(URLPattern)
+
+func unanchored(re *regexp.Regexp) string {
+	return strings.TrimSuffix(strings.TrimPrefix(re.String(), "^"), "$")
+}
+
+// URLJSONSchema returns a JSON Schema fragment describing a string
+// holding a fully resolved charm URL. It may be embedded in the
+// schemas of APIs, and is also valid as an OpenAPI schema object.
+func URLJSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "string",
+		"format":      URLFormat,
+		"pattern":     URLPattern,
+		"description": "A fully resolved charm URL, such as cs:~user/trusty/wordpress-42.",
+	}
+}
+
+// URLFormatChecker checks values for the URLFormat format. Its IsFormat
+// method matches the interface used by JSON Schema validators such as
+// gojsonschema, so it can be registered with them as the checker for
+// URLFormat.
+type URLFormatChecker struct{}
+
+// IsFormat reports whether input is a string holding
+// a charm URL that is accepted by ParseURL.
+func (URLFormatChecker) IsFormat(input interface{}) bool {
+	s, ok := input.(string)
+	if !ok {
+		return false
+	}
+	_, err := ParseURL(s)
+	return err == nil
+}
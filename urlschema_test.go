@@ -0,0 +1,61 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"regexp"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type URLSchemaSuite struct{}
+
+var _ = gc.Suite(&URLSchemaSuite{})
+
+var urlFormatTests = []struct {
+	s     string
+	valid bool
+}{
+	{"cs:~user/trusty/wordpress", true},
+	{"cs:~user.name/trusty/wordpress-42", true},
+	{"cs:trusty/wordpress-0", true},
+	{"cs:trusty/my-charm-2", true},
+	{"ch:jammy/wordpress", true},
+	{"local:trusty/wordpress", true},
+	{"cs:wordpress", false},
+	{"trusty/wordpress", false},
+	{"local:~user/trusty/wordpress", false},
+	{"ch:~user/jammy/wordpress", false},
+	{"cs:~user/Trusty/wordpress", false},
+	{"cs:trusty/Wordpress", false},
+	{"cs:trusty/wordpress-", false},
+	{"cs:trusty/word--press", false},
+	{"http:trusty/wordpress", false},
+	{"cs:~user/trusty/wordpress/extra", false},
+}
+
+func (s *URLSchemaSuite) TestURLPattern(c *gc.C) {
+	re := regexp.MustCompile(charm.URLPattern)
+	checker := charm.URLFormatChecker{}
+	for i, test := range urlFormatTests {
+		c.Logf("test %d: %q", i, test.s)
+		c.Check(re.MatchString(test.s), gc.Equals, test.valid)
+		c.Check(checker.IsFormat(test.s), gc.Equals, test.valid)
+	}
+}
+
+func (s *URLSchemaSuite) TestURLFormatCheckerNonString(c *gc.C) {
+	c.Assert(charm.URLFormatChecker{}.IsFormat(42), gc.Equals, false)
+	c.Assert(charm.URLFormatChecker{}.IsFormat(nil), gc.Equals, false)
+}
+
+func (s *URLSchemaSuite) TestURLJSONSchema(c *gc.C) {
+	schema := charm.URLJSONSchema()
+	c.Assert(schema["type"], gc.Equals, "string")
+	c.Assert(schema["format"], gc.Equals, charm.URLFormat)
+	c.Assert(schema["format"], gc.Equals, "charm-url")
+	c.Assert(schema["pattern"], gc.Equals, charm.URLPattern)
+}
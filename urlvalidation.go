@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juju/names"
+)
+
+// ValidateURLOptions holds options for ValidateURLString.
+type ValidateURLOptions struct {
+	// RequireSchema specifies that the string must include
+	// a schema, as required by ParseURL.
+	RequireSchema bool
+
+	// RequireSeries specifies that the string must include
+	// a series, as required by ParseURL.
+	RequireSeries bool
+
+	// RequireKnownSeries specifies that the series, if present,
+	// must be one known to SeriesOS.
+	RequireKnownSeries bool
+
+	// NameProfile holds the profile used to validate the
+	// charm name. If it is nil, the default profile is used.
+	NameProfile *NameValidationProfile
+}
+
+// URLProblem describes a single problem found in a charm URL string
+// by ValidateURLString.
+type URLProblem struct {
+	// Field holds the part of the URL the problem was found in:
+	// one of "schema", "user", "series", "name", "revision"
+	// or "form" when the overall shape of the URL is wrong.
+	Field string
+
+	// Value holds the offending part of the URL. It may be
+	// empty when the part is missing.
+	Value string
+
+	// Message holds a human readable description of the problem.
+	Message string
+}
+
+// String returns the problem's message.
+func (p URLProblem) String() string {
+	return p.Message
+}
+
+// ValidateURLString checks whether s is a valid charm reference, as
+// accepted by ParseReference, or a valid charm URL if opts requires
+// both a schema and a series. Unlike the parsing functions, it does
+// not stop at the first problem but returns all the problems it finds,
+// which makes it suitable for validating user input in forms. It
+// returns nil if s is valid.
+func ValidateURLString(s string, opts ValidateURLOptions) []URLProblem {
+	var problems []URLProblem
+	add := func(field, value, f string, a ...interface{}) {
+		problems = append(problems, URLProblem{
+			Field:   field,
+			Value:   value,
+			Message: fmt.Sprintf(f, a...),
+		})
+	}
+	schema := ""
+	rest := s
+	if i := strings.Index(s, ":"); i >= 0 {
+		schema, rest = s[:i], s[i+1:]
+		if schema != "cs" && schema != "ch" && schema != "local" {
+			add("schema", schema, "invalid schema %q", schema)
+		}
+	} else if opts.RequireSchema {
+		add("schema", "", "missing schema")
+	}
+	parts := strings.Split(rest, "/")
+	if strings.HasPrefix(parts[0], "~") {
+		user := parts[0][1:]
+		switch schema {
+		case "local", "ch":
+			add("user", user, "user name not allowed in %s charm URL", schema)
+		default:
+			if !names.IsValidUser(user) {
+				add("user", user, "invalid user name %q", user)
+			}
+		}
+		parts = parts[1:]
+	}
+	if len(parts) > 2 {
+		add("form", rest, "too many path elements in %q", rest)
+		return problems
+	}
+	if len(parts) == 2 {
+		if series := parts[0]; !IsValidSeries(series) {
+			add("series", series, "invalid series %q", series)
+		} else if _, err := SeriesOS(series); err != nil && opts.RequireKnownSeries && series != BundleSeries {
+			add("series", series, "unknown series %q", series)
+		}
+		parts = parts[1:]
+	} else if opts.RequireSeries {
+		add("series", "", "missing series")
+	}
+	if len(parts) == 0 || parts[0] == "" {
+		add("name", "", "missing charm name")
+		return problems
+	}
+	name, rev := splitNameRevision(parts[0])
+	profile := opts.NameProfile
+	if profile == nil {
+		profile = DefaultNameValidationProfile()
+	}
+	if !profile.IsValid(name) {
+		add("name", name, "invalid charm name %q", name)
+	}
+	if rev != "" {
+		if _, err := strconv.Atoi(rev); err != nil {
+			add("revision", rev, "invalid revision %q", rev)
+		}
+	}
+	return problems
+}
+
+// splitNameRevision splits s into a charm name and a revision, using
+// the same rules as ParseReference. The revision is empty if none
+// is present.
+func splitNameRevision(s string) (name, rev string) {
+	for i := len(s) - 1; i > 0; i-- {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		if c == '-' && i != len(s)-1 {
+			return s[:i], s[i+1:]
+		}
+		break
+	}
+	return s, ""
+}
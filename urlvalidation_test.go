@@ -0,0 +1,119 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type URLValidationSuite struct{}
+
+var _ = gc.Suite(&URLValidationSuite{})
+
+var validateURLStringTests = []struct {
+	about  string
+	s      string
+	opts   charm.ValidateURLOptions
+	expect []charm.URLProblem
+}{{
+	about: "valid reference",
+	s:     "cs:~who/trusty/wordpress-42",
+}, {
+	about: "valid reference with no schema or series",
+	s:     "wordpress",
+}, {
+	about: "missing schema and series",
+	s:     "wordpress",
+	opts: charm.ValidateURLOptions{
+		RequireSchema: true,
+		RequireSeries: true,
+	},
+	expect: []charm.URLProblem{{
+		Field:   "schema",
+		Message: "missing schema",
+	}, {
+		Field:   "series",
+		Message: "missing series",
+	}},
+}, {
+	about: "bad name and bad series",
+	s:     "cs:Trusty/Word^Press",
+	expect: []charm.URLProblem{{
+		Field:   "series",
+		Value:   "Trusty",
+		Message: `invalid series "Trusty"`,
+	}, {
+		Field:   "name",
+		Value:   "Word^Press",
+		Message: `invalid charm name "Word^Press"`,
+	}},
+}, {
+	about: "every part invalid",
+	s:     "bs:~_/1/-foo",
+	expect: []charm.URLProblem{{
+		Field:   "schema",
+		Value:   "bs",
+		Message: `invalid schema "bs"`,
+	}, {
+		Field:   "user",
+		Value:   "_",
+		Message: `invalid user name "_"`,
+	}, {
+		Field:   "series",
+		Value:   "1",
+		Message: `invalid series "1"`,
+	}, {
+		Field:   "name",
+		Value:   "-foo",
+		Message: `invalid charm name "-foo"`,
+	}},
+}, {
+	about: "user in local URL",
+	s:     "local:~who/trusty/wordpress",
+	expect: []charm.URLProblem{{
+		Field:   "user",
+		Value:   "who",
+		Message: "user name not allowed in local charm URL",
+	}},
+}, {
+	about: "too many path elements",
+	s:     "cs:~who/trusty/wordpress/extra",
+	expect: []charm.URLProblem{{
+		Field:   "form",
+		Value:   "~who/trusty/wordpress/extra",
+		Message: `too many path elements in "~who/trusty/wordpress/extra"`,
+	}},
+}, {
+	about: "missing name",
+	s:     "cs:~who",
+	expect: []charm.URLProblem{{
+		Field:   "name",
+		Message: "missing charm name",
+	}},
+}, {
+	about: "invalid name with revision",
+	s:     "cs:trusty/wordpress-1-2",
+	expect: []charm.URLProblem{{
+		Field:   "name",
+		Value:   "wordpress-1",
+		Message: `invalid charm name "wordpress-1"`,
+	}},
+}}
+
+func (s *URLValidationSuite) TestValidateURLString(c *gc.C) {
+	for i, test := range validateURLStringTests {
+		c.Logf("test %d: %s", i, test.about)
+		problems := charm.ValidateURLString(test.s, test.opts)
+		c.Assert(problems, jc.DeepEquals, test.expect)
+		// ValidateURLString must agree with ParseReference
+		// about whether the string is valid.
+		_, err := charm.ParseReference(test.s)
+		if test.opts == (charm.ValidateURLOptions{}) {
+			c.Assert(err == nil, gc.Equals, problems == nil)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ValidationProblem describes an inconsistency found by Validate.
+type ValidationProblem struct {
+	// Code holds the code describing the kind of problem,
+	// such as CodeInvalidActions.
+	Code string
+
+	// Message holds a description of the problem.
+	Message string
+}
+
+// Error implements error.
+func (p ValidationProblem) Error() string {
+	return p.Message
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (p ValidationProblem) ErrorCode() string {
+	return p.Code
+}
+
+// ValidationError is returned by Validate when a charm is
+// inconsistent. It holds all the problems found.
+type ValidationError struct {
+	Problems []ValidationProblem
+}
+
+// Error implements error.
+func (err *ValidationError) Error() string {
+	msgs := make([]string, len(err.Problems))
+	for i, p := range err.Problems {
+		msgs[i] = p.Message
+	}
+	return fmt.Sprintf("charm is inconsistent: %s", strings.Join(msgs, "; "))
+}
+
+// ErrorCode implements CodedError.ErrorCode.
+func (err *ValidationError) ErrorCode() string {
+	return CodeInconsistentCharm
+}
+
+// Validate checks that the documents making up ch are consistent
+// with each other. Unlike the checks made when each document is
+// read, which stop at the first error, Validate reports all the
+// problems found, in a *ValidationError.
+//
+// It checks that:
+//
+//   - the metadata is well-formed, as checked by Meta.Check, with
+//     a problem reported for each endpoint whose name is invalid,
+//     as by Meta.CheckEndpointNames;
+//   - containers refer to declared resources and storage;
+//   - the locations of filesystem stores do not collide;
+//   - config option defaults match the option types;
+//   - every action has a script in the actions directory, when ch is
+//     a *CharmDir or *CharmArchive that does not use a dispatch script.
+func Validate(ch Charm) error {
+	v := &validator{
+		seen: make(map[string]bool),
+	}
+	meta := ch.Meta()
+	for _, err := range meta.endpointNameErrors() {
+		v.add(ErrorCode(err), err.Error())
+	}
+	// The first endpoint name error, if any, is returned
+	// by Check too, and is only recorded once.
+	if err := meta.Check(); err != nil {
+		v.add(ErrorCode(err), err.Error())
+	}
+	v.checkContainers(meta)
+	v.checkStorage(meta)
+	if config := ch.Config(); config != nil {
+		v.checkConfig(config)
+	}
+	if actions := ch.Actions(); actions != nil {
+		if err := v.checkActions(ch, actions); err != nil {
+			return err
+		}
+	}
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.Sort(validationProblems(v.problems))
+	return &ValidationError{
+		Problems: v.problems,
+	}
+}
+
+type validator struct {
+	problems []ValidationProblem
+	seen     map[string]bool
+}
+
+// add records a problem, ignoring problems already recorded.
+func (v *validator) add(code, msg string) {
+	if v.seen[msg] {
+		return
+	}
+	v.seen[msg] = true
+	v.problems = append(v.problems, ValidationProblem{
+		Code:    code,
+		Message: msg,
+	})
+}
+
+func (v *validator) checkContainers(meta *Meta) {
+	for _, container := range meta.Containers {
+		if err := container.Validate(meta); err != nil {
+			v.add(ErrorCode(err), err.Error())
+		}
+	}
+}
+
+// checkStorage checks that no filesystem store is mounted at or
+// inside the location of another one.
+func (v *validator) checkStorage(meta *Meta) {
+	var names []string
+	for name, store := range meta.Storage {
+		if store.Type == StorageFilesystem && store.Location != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for i, name1 := range names {
+		loc1 := path.Clean(meta.Storage[name1].Location)
+		for _, name2 := range names[i+1:] {
+			loc2 := path.Clean(meta.Storage[name2].Location)
+			if loc1 == loc2 || isPathWithin(loc1, loc2) || isPathWithin(loc2, loc1) {
+				v.add(CodeInvalidStorage, fmt.Sprintf("charm %q storage %q location %q collides with storage %q location %q", meta.Name, name1, loc1, name2, loc2))
+			}
+		}
+	}
+}
+
+// isPathWithin reports whether p is inside the directory dir.
+func isPathWithin(p, dir string) bool {
+	return strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func (v *validator) checkConfig(config *Config) {
+	for name, option := range config.Options {
+		if option.Type == "" {
+			option.Type = "string"
+		}
+		if optionTypeCheckers[option.Type] == nil {
+			v.add(CodeInvalidOptionType, fmt.Sprintf("invalid config: option %q has unknown type %q", name, option.Type))
+			continue
+		}
+		def := option.Default
+		if def == "" && option.Type == "string" {
+			continue
+		}
+		if _, err := option.validate(name, def); err != nil {
+			option.error(&err, name, def)
+			v.add(CodeInvalidOptionValue, fmt.Sprintf("invalid config default: %v", err))
+		}
+	}
+}
+
+// checkActions checks that all actions have a script, if the
+// files of ch can be inspected.
+func (v *validator) checkActions(ch Charm, actions *Actions) error {
+	exists, err := charmFileChecker(ch)
+	if err != nil || exists == nil {
+		return err
+	}
+	if ok, err := exists(DispatchFile); err != nil {
+		return err
+	} else if ok {
+		// Actions are run by the dispatch script.
+		return nil
+	}
+	for name := range actions.ActionSpecs {
+		ok, err := exists(path.Join("actions", name))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			v.add(CodeInvalidActions, fmt.Sprintf("charm %q action %q has no script in the actions directory", ch.Meta().Name, name))
+		}
+	}
+	return nil
+}
+
+// charmFileChecker returns a function reporting whether the file at
+// the given slash-separated path exists in ch, or nil if the files
+// of ch cannot be inspected.
+func charmFileChecker(ch Charm) (func(string) (bool, error), error) {
+	switch ch := ch.(type) {
+	case *CharmDir:
+		return func(p string) (bool, error) {
+			_, err := os.Stat(ch.join(p))
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return err == nil, err
+		}, nil
+	case *CharmArchive:
+		manifest, err := ch.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		return func(p string) (bool, error) {
+			return manifest.Contains(p), nil
+		}, nil
+	}
+	return nil, nil
+}
+
+type validationProblems []ValidationProblem
+
+func (ps validationProblems) Len() int      { return len(ps) }
+func (ps validationProblems) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps validationProblems) Less(i, j int) bool {
+	if ps[i].Code != ps[j].Code {
+		return ps[i].Code < ps[j].Code
+	}
+	return ps[i].Message < ps[j].Message
+}
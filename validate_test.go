@@ -0,0 +1,168 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type ValidateSuite struct{}
+
+var _ = gc.Suite(&ValidateSuite{})
+
+func (s *ValidateSuite) TestValidateMissingActionScript(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	err := charm.Validate(dir)
+	c.Assert(err, gc.ErrorMatches, `charm is inconsistent: charm "dummy" action "snapshot" has no script in the actions directory`)
+	c.Assert(charm.ErrorCode(err), gc.Equals, charm.CodeInconsistentCharm)
+	c.Assert(err.(*charm.ValidationError).Problems, jc.DeepEquals, []charm.ValidationProblem{{
+		Code:    charm.CodeInvalidActions,
+		Message: `charm "dummy" action "snapshot" has no script in the actions directory`,
+	}})
+
+	// The same problem is found in archives.
+	path := filepath.Join(c.MkDir(), "archive.charm")
+	file, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(file)
+	file.Close()
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	err = charm.Validate(archive)
+	c.Assert(err, gc.ErrorMatches, `charm is inconsistent: charm "dummy" action "snapshot" has no script in the actions directory`)
+}
+
+func (s *ValidateSuite) TestValidateActionScripts(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	err := os.Mkdir(filepath.Join(dir.Path, "actions"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "actions", "snapshot"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	c.Assert(charm.Validate(dir), gc.IsNil)
+}
+
+func (s *ValidateSuite) TestValidateDispatch(c *gc.C) {
+	dir := TestCharms.ClonedDir(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "dispatch"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	c.Assert(charm.Validate(dir), gc.IsNil)
+}
+
+// validateCharm is a charm whose documents have not been
+// checked when read.
+type validateCharm struct {
+	meta    *charm.Meta
+	config  *charm.Config
+	actions *charm.Actions
+}
+
+func (ch *validateCharm) Meta() *charm.Meta       { return ch.meta }
+func (ch *validateCharm) Config() *charm.Config   { return ch.config }
+func (ch *validateCharm) Metrics() *charm.Metrics { return nil }
+func (ch *validateCharm) Actions() *charm.Actions { return ch.actions }
+func (ch *validateCharm) Revision() int           { return 0 }
+
+func (s *ValidateSuite) TestValidateAggregatesProblems(c *gc.C) {
+	ch := &validateCharm{
+		meta: &charm.Meta{
+			Name: "sidecar",
+			Storage: map[string]charm.Storage{
+				"data": {
+					Name:     "data",
+					Type:     charm.StorageFilesystem,
+					Location: "/srv/data",
+					CountMin: 1,
+					CountMax: 1,
+				},
+				"cache": {
+					Name:     "cache",
+					Type:     charm.StorageFilesystem,
+					Location: "/srv/data/cache/",
+					CountMin: 1,
+					CountMax: 1,
+				},
+				"logs": {
+					Name:     "logs",
+					Type:     charm.StorageFilesystem,
+					Location: "/srv/logs",
+					CountMin: 1,
+					CountMax: 1,
+				},
+			},
+			Containers: map[string]charm.Container{
+				"app": {
+					Name:     "app",
+					Resource: "app-image",
+				},
+			},
+		},
+		config: &charm.Config{
+			Options: map[string]charm.Option{
+				"port": {
+					Type:    "int",
+					Default: "eighty",
+				},
+				"mode": {
+					Type: "enum",
+				},
+				"title": {
+					Type:    "string",
+					Default: "",
+				},
+			},
+		},
+		actions: &charm.Actions{
+			ActionSpecs: map[string]charm.ActionSpec{
+				"snapshot": {},
+			},
+		},
+	}
+	err := charm.Validate(ch)
+	c.Assert(err, gc.NotNil)
+	c.Assert(err.(*charm.ValidationError).Problems, jc.DeepEquals, []charm.ValidationProblem{{
+		Code:    charm.CodeInvalidContainer,
+		Message: `charm "sidecar" container "app": reference to undefined resource "app-image"`,
+	}, {
+		Code:    charm.CodeInvalidOptionType,
+		Message: `invalid config: option "mode" has unknown type "enum"`,
+	}, {
+		Code:    charm.CodeInvalidOptionValue,
+		Message: `invalid config default: option "port" expected int, got "eighty"`,
+	}, {
+		Code:    charm.CodeInvalidStorage,
+		Message: `charm "sidecar" storage "cache" location "/srv/data/cache" collides with storage "data" location "/srv/data"`,
+	}})
+}
+
+func (s *ValidateSuite) TestValidateEndpointNames(c *gc.C) {
+	ch := &validateCharm{
+		meta: &charm.Meta{
+			Name: "a",
+			Provides: map[string]charm.Relation{
+				"db": {Name: "db", Role: charm.RoleProvider, Interface: "mysql", Scope: charm.ScopeGlobal},
+			},
+			Requires: map[string]charm.Relation{
+				"db":       {Name: "db", Role: charm.RoleRequirer, Interface: "mysql", Scope: charm.ScopeGlobal},
+				"juju-foo": {Name: "juju-foo", Role: charm.RoleRequirer, Interface: "foo", Scope: charm.ScopeGlobal},
+			},
+		},
+	}
+	err := charm.Validate(ch)
+	c.Assert(err, gc.FitsTypeOf, (*charm.ValidationError)(nil))
+	c.Assert(err.(*charm.ValidationError).Problems, jc.DeepEquals, []charm.ValidationProblem{{
+		Code:    charm.CodeDuplicateName,
+		Message: `charm "a" using a duplicated relation name: "db"`,
+	}, {
+		Code:    charm.CodeReservedName,
+		Message: `charm "a" using a reserved relation name: "juju-foo"`,
+	}})
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Warning codes attached to the warnings produced when reading charm
+// documents and URLs. Like error codes, they are stable.
+const (
+	CodeDeprecatedField = "deprecated-field"
+	CodeUnknownField    = "unknown-field"
+	CodeImplicitType    = "implicit-type"
+	CodeImplicitSchema  = "implicit-schema"
+	CodeEOLSeries       = "eol-series"
+	CodeUnknownTag      = "unknown-tag"
+	CodeMalformedTag    = "malformed-tag"
+	CodeIgnoredManifest = "ignored-manifest"
+	CodeMissingReadme   = "missing-readme"
+	CodeLegacyField     = "legacy-field"
+	CodeAmbiguousURL    = "ambiguous-url"
+	CodeHookNoShebang   = "hook-no-shebang"
+	CodeHookCRLF        = "hook-crlf"
+	CodeHookNotUTF8     = "hook-not-utf8"
+	CodeHookWindowsOnly = "hook-windows-only"
+)
+
+// Warning describes something suspicious found when reading a charm
+// document or URL that does not prevent it from being used, such as
+// the use of a deprecated field. Warnings are available from the
+// Warnings field of the value read, so that tools can report them
+// without failing.
+type Warning struct {
+	// Code holds a stable machine-readable code describing
+	// the kind of warning, such as CodeDeprecatedField.
+	Code string
+
+	// Message holds a description of the warning.
+	Message string
+}
+
+// String returns the warning message.
+func (w Warning) String() string {
+	return w.Message
+}
+
+// warningf returns a new warning with the given code and a message
+// formatted according to the format specifier.
+func warningf(code string, f string, a ...interface{}) Warning {
+	return Warning{
+		Code:    code,
+		Message: fmt.Sprintf(f, a...),
+	}
+}
+
+// sortWarnings sorts ws by message, so that warnings found
+// while iterating over maps are reported in a stable order.
+func sortWarnings(ws []Warning) {
+	sort.Sort(warningsByMessage(ws))
+}
+
+type warningsByMessage []Warning
+
+func (ws warningsByMessage) Len() int           { return len(ws) }
+func (ws warningsByMessage) Swap(i, j int)      { ws[i], ws[j] = ws[j], ws[i] }
+func (ws warningsByMessage) Less(i, j int) bool { return ws[i].Message < ws[j].Message }
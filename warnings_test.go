@@ -0,0 +1,116 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type WarningsSuite struct{}
+
+var _ = gc.Suite(&WarningsSuite{})
+
+func (s *WarningsSuite) TestMetaWarnings(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(`
+name: dummy
+summary: a
+description: b
+revision: 3
+requirez:
+  db: mysql
+x-vendor: ok
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeDeprecatedField,
+		Message: `metadata field "revision" is deprecated; use a revision file instead`,
+	}, {
+		Code:    charm.CodeUnknownField,
+		Message: `metadata field "requirez" is unknown and has been ignored`,
+	}})
+}
+
+func (s *WarningsSuite) TestMetaNoWarnings(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(dummyMetadata))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Warnings, gc.HasLen, 0)
+}
+
+func (s *WarningsSuite) TestConfigWarnings(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader(`
+options:
+  title:
+    default: My Title
+  port:
+    type: int
+    default: 80
+  name:
+    description: The name.
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Options["title"].Type, gc.Equals, "string")
+	c.Assert(config.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeImplicitType,
+		Message: `config option "name" has no type; assuming "string"`,
+	}, {
+		Code:    charm.CodeImplicitType,
+		Message: `config option "title" has no type; assuming "string"`,
+	}})
+}
+
+func (s *WarningsSuite) TestActionsWarnings(c *gc.C) {
+	actions, err := charm.ReadActionsYaml(strings.NewReader(`
+snapshot:
+  description: Take a snapshot.
+  params:
+    outfile:
+      description: The file to write to.
+    compression:
+      enum: [gzip, bzip2]
+    level:
+      type: integer
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(actions.Warnings, jc.DeepEquals, []charm.Warning{{
+		Code:    charm.CodeImplicitSchema,
+		Message: `action "snapshot" parameter "outfile" has no type; any value is accepted`,
+	}})
+}
+
+var referenceWarningsTests = []struct {
+	url            string
+	expectWarnings []charm.Warning
+}{{
+	url: "cs:trusty/wordpress",
+}, {
+	url: "trusty/wordpress",
+	expectWarnings: []charm.Warning{{
+		Code:    charm.CodeImplicitSchema,
+		Message: `charm URL "trusty/wordpress" has no schema; assuming "cs"`,
+	}},
+}, {
+	url: "https://charmhub.io/wordpress",
+}}
+
+func (s *WarningsSuite) TestParseReferenceWithWarnings(c *gc.C) {
+	for i, test := range referenceWarningsTests {
+		c.Logf("test %d: %s", i, test.url)
+		ref, warnings, err := charm.ParseReferenceWithWarnings(test.url)
+		c.Assert(err, gc.IsNil)
+		expectRef, err := charm.ParseReference(test.url)
+		c.Assert(err, gc.IsNil)
+		c.Assert(ref, jc.DeepEquals, expectRef)
+		c.Assert(warnings, jc.DeepEquals, test.expectWarnings)
+	}
+}
+
+func (s *WarningsSuite) TestParseReferenceWithWarningsError(c *gc.C) {
+	_, _, err := charm.ParseReferenceWithWarnings("cs:~1/wordpress")
+	c.Assert(err, gc.ErrorMatches, `charm URL has invalid user name: "cs:~1/wordpress"`)
+}
@@ -0,0 +1,149 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Names of the files with a meaning to Juju in charms and bundles,
+// relative to their root directory.
+const (
+	// MetadataFile holds the metadata of a charm. See ReadMeta.
+	MetadataFile = "metadata.yaml"
+
+	// ConfigFile holds the configuration options
+	// of a charm. See ReadConfig.
+	ConfigFile = "config.yaml"
+
+	// ActionsFile holds the actions of a charm. See ReadActionsYaml.
+	ActionsFile = "actions.yaml"
+
+	// FunctionsFile is the deprecated name of ActionsFile,
+	// which is only read when ActionsFile is absent.
+	FunctionsFile = "functions.yaml"
+
+	// MetricsFile holds the metrics of a charm. See ReadMetrics.
+	MetricsFile = "metrics.yaml"
+
+	// RevisionFile holds the revision of a charm.
+	RevisionFile = "revision"
+
+	// ManifestFile holds the bases a charm runs on. See ReadManifest.
+	ManifestFile = "manifest.yaml"
+
+	// LXDProfileFile holds the LXD profile applied to the
+	// LXD containers a charm is deployed to.
+	LXDProfileFile = "lxd-profile.yaml"
+
+	// IconFile holds the SVG icon of a charm.
+	IconFile = "icon.svg"
+
+	// HooksDir holds the hooks of a charm.
+	HooksDir = "hooks"
+
+	// DispatchFile holds the script that newer charms
+	// use to run all their hooks and actions.
+	DispatchFile = "dispatch"
+
+	// ReadmeFile, ReadmeRSTFile and ReadmeTextFile are the names
+	// recognized as the README of a charm or bundle, in order of
+	// preference. They are matched case-insensitively.
+	ReadmeFile     = "README.md"
+	ReadmeRSTFile  = "README.rst"
+	ReadmeTextFile = "README.txt"
+
+	// BundleFile holds the data of a bundle. See ReadBundleData.
+	BundleFile = "bundle.yaml"
+)
+
+// WellKnownFile describes a file with a meaning
+// to Juju in a charm or a bundle.
+type WellKnownFile struct {
+	// Name holds the name of the file, such as MetadataFile.
+	Name string
+
+	// Bundle holds whether the file is found in
+	// bundles rather than in charms.
+	Bundle bool
+
+	// Required holds whether the file must be present.
+	Required bool
+
+	// Read, if not nil, reads the content of the file as this
+	// package does, returning a value of the type returned by
+	// the package function documented for the file, such as
+	// *Meta for MetadataFile, or an int for RevisionFile.
+	Read func(r io.Reader) (interface{}, error)
+}
+
+// WellKnownFiles returns descriptions of all the files with a meaning
+// to Juju in charms and bundles, in the order of the constants naming
+// them. Tools should use it rather than hard-coding the names of the
+// files and the way they are read.
+func WellKnownFiles() []WellKnownFile {
+	return []WellKnownFile{{
+		Name:     MetadataFile,
+		Required: true,
+		Read: func(r io.Reader) (interface{}, error) {
+			return ReadMeta(r)
+		},
+	}, {
+		Name: ConfigFile,
+		Read: func(r io.Reader) (interface{}, error) {
+			return ReadConfig(r)
+		},
+	}, {
+		Name: ActionsFile,
+		Read: func(r io.Reader) (interface{}, error) {
+			return ReadActionsYaml(r)
+		},
+	}, {
+		Name: FunctionsFile,
+		Read: func(r io.Reader) (interface{}, error) {
+			return ReadActionsYaml(r)
+		},
+	}, {
+		Name: MetricsFile,
+		Read: func(r io.Reader) (interface{}, error) {
+			return ReadMetrics(r)
+		},
+	}, {
+		Name: RevisionFile,
+		Read: func(r io.Reader) (interface{}, error) {
+			return readRevision(r)
+		},
+	}, {
+		Name: ManifestFile,
+		Read: func(r io.Reader) (interface{}, error) {
+			return ReadManifest(r)
+		},
+	}, {
+		Name: LXDProfileFile,
+	}, {
+		Name: IconFile,
+	}, {
+		Name: HooksDir,
+	}, {
+		Name: DispatchFile,
+	}, {
+		Name:     BundleFile,
+		Bundle:   true,
+		Required: true,
+		Read: func(r io.Reader) (interface{}, error) {
+			return ReadBundleData(r)
+		},
+	}}
+}
+
+// readRevision reads the content of a revision file.
+func readRevision(r io.Reader) (int, error) {
+	var revision int
+	if _, err := fmt.Fscan(r, &revision); err != nil {
+		return 0, errors.New("invalid revision file")
+	}
+	return revision, nil
+}
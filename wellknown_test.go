@@ -0,0 +1,61 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+type WellKnownSuite struct{}
+
+var _ = gc.Suite(&WellKnownSuite{})
+
+func (s *WellKnownSuite) TestWellKnownFilesRead(c *gc.C) {
+	dir := TestCharms.CharmDirPath("dummy")
+	found := make(map[string]bool)
+	for _, f := range charm.WellKnownFiles() {
+		c.Logf("file %s", f.Name)
+		c.Assert(found[f.Name], gc.Equals, false)
+		found[f.Name] = true
+		if f.Bundle || f.Read == nil {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, f.Name))
+		if os.IsNotExist(err) {
+			c.Assert(f.Required, gc.Equals, false)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		v, err := f.Read(file)
+		file.Close()
+		c.Assert(err, gc.IsNil)
+		switch f.Name {
+		case charm.MetadataFile:
+			c.Assert(v.(*charm.Meta).Name, gc.Equals, "dummy")
+		case charm.RevisionFile:
+			c.Assert(v, gc.Equals, 1)
+		}
+	}
+	c.Assert(found[charm.MetadataFile], gc.Equals, true)
+	c.Assert(found[charm.BundleFile], gc.Equals, true)
+}
+
+func (s *WellKnownSuite) TestWellKnownFilesReadBundle(c *gc.C) {
+	for _, f := range charm.WellKnownFiles() {
+		if !f.Bundle {
+			continue
+		}
+		file, err := os.Open(filepath.Join(TestCharms.BundleDirPath("wordpress-simple"), f.Name))
+		c.Assert(err, gc.IsNil)
+		v, err := f.Read(file)
+		file.Close()
+		c.Assert(err, gc.IsNil)
+		c.Assert(v.(*charm.BundleData).Services, gc.HasLen, 2)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strconv"
 	"strings"
 
@@ -39,7 +38,7 @@ type Workload struct {
 
 // ReadWorkloads
 func ReadWorkloads(r io.Reader, provides map[string]Relation, storage map[string]Storage) (map[string]Workload, error) {
-	data, err := ioutil.ReadAll(r)
+	data, err := readDocument(r, "workloads", MaxDocumentSize)
 	if err != nil {
 		return nil, err
 	}